@@ -9,6 +9,18 @@ mkdir -p "$OUT_DIR"/files
 mkdir -p "$OUT_DIR"/bin
 mkdir -p "$OUT_DIR"/scripts
 
+if [[ $OS =~ linux ]]; then
+  if [[ -f /etc/debian_version ]]; then
+    apt-get update -y
+    apt-get install -y --no-install-recommends llvm clang libbpf-dev
+  fi
+
+  # Generate the objects of the BPF dataplane
+  pushd "$REPO_ROOT"
+    GOOS="$OS" go generate ./bpf-prog/npm-policy/...
+  popd
+fi
+
 pushd "$REPO_ROOT"/npm
   GOOS="$OS" go build -a -v -trimpath \
     -o "$OUT_DIR"/bin/azure-npm"$FILE_EXT" \
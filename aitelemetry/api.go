@@ -3,7 +3,9 @@ package aitelemetry
 import (
 	"sync"
 
+	"github.com/Azure/azure-container-networking/aitelemetry/spool"
 	"github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/otlp"
 	"github.com/microsoft/ApplicationInsights-Go/appinsights"
 	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
 )
@@ -42,6 +44,12 @@ type AIConfig struct {
 	GetEnvRetryCount             int
 	GetEnvRetryWaitTimeInSecs    int
 	DebugMode                    bool
+	// SpoolDir enables spooling telemetry to disk while AppInsights is unreachable, and replaying it once it's back.
+	SpoolDir string
+	// SpoolMaxSizeInBytes caps the size of the spool. The oldest telemetry is dropped beyond it.
+	SpoolMaxSizeInBytes int64
+	// OTLP, if set, mirrors the telemetry to an OpenTelemetry collector.
+	OTLP *otlp.Config
 }
 
 // TelmetryHandle holds appinsight handles and metadata
@@ -54,6 +62,10 @@ type telemetryHandle struct {
 	disableMetadataRefreshThread bool
 	refreshTimeout               int
 	rwmutex                      sync.RWMutex
+	spooler                      *spoolingTransport
+	stopReplay                   chan struct{}
+	replayWG                     sync.WaitGroup
+	otlp                         *otlpMirror
 }
 
 // Telemetry Interface to send metrics/Logs to appinsights
@@ -71,4 +83,6 @@ type TelemetryHandle interface {
 	Close(timeout int)
 	// Flush - forces the current queue to be sent
 	Flush()
+	// SpoolStats returns the counters of the disk spool, which are zero if spooling is disabled
+	SpoolStats() spool.Stats
 }
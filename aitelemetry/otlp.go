@@ -0,0 +1,143 @@
+package aitelemetry
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azure/azure-container-networking/otlp"
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// eventNameKey is the attribute of the log records which carry events.
+const eventNameKey = "event.name"
+
+// tagNames are the names of the AppInsights tags in the zapai field mappers.
+var tagNames = map[string]string{
+	"ai.application.ver":    "version",
+	"ai.operation.id":       "operation_id",
+	"ai.operation.parentId": "parent_id",
+	"ai.session.id":         "session_id",
+	"ai.user.accountId":     "account",
+	"ai.user.authUserId":    "user_id",
+	"ai.user.id":            "anonymous_user_id",
+}
+
+// otlpMirror sends the telemetry of a handle to an OpenTelemetry collector as well. Reports and events become log
+// records, the name of an event in the event.name attribute, and metrics become gauges. The AppInsights properties
+// and tags become attributes, named like the zapai field mappers name them.
+type otlpMirror struct {
+	exporter *otlp.Exporter
+	batcher  *otlp.Batcher
+}
+
+// newOTLPMirror creates the mirror if OTLP is configured. Like spooling, it's best effort: if the exporter can't be
+// created, telemetry only goes to AppInsights.
+func newOTLPMirror(aiConfig AIConfig) *otlpMirror {
+	if aiConfig.OTLP == nil {
+		return nil
+	}
+	exporter, err := otlp.NewExporter(aiConfig.OTLP, aiConfig.AppName)
+	if err != nil {
+		debugLog("[OTLP] Error creating exporter, telemetry will not be mirrored: %v", err)
+		return nil
+	}
+	return &otlpMirror{
+		exporter: exporter,
+		batcher: otlp.NewBatcher(exporter, func(err error) {
+			debugLog("[OTLP] %v", err)
+		}),
+	}
+}
+
+// attributes merges the properties of an AppInsights item with its tags.
+func attributes(props, tags map[string]string) []*commonpb.KeyValue {
+	merged := make(map[string]string, len(props)+len(tags))
+	for k, v := range props {
+		merged[k] = v
+	}
+	for tag, v := range tags {
+		if name, ok := tagNames[tag]; ok && v != "" {
+			merged[name] = v
+		}
+	}
+	return otlp.StringAttributes(merged)
+}
+
+func (m *otlpMirror) report(report Report, props, tags map[string]string) {
+	if m == nil {
+		return
+	}
+	m.batcher.EmitLog(&logspb.LogRecord{
+		TimeUnixNano:   uint64(time.Now().UnixNano()),
+		SeverityNumber: severity(report.Level),
+		SeverityText:   report.Level.String(),
+		Body:           &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: report.Message}},
+		Attributes:     attributes(props, tags),
+	})
+}
+
+func (m *otlpMirror) event(event Event, props, tags map[string]string) {
+	if m == nil {
+		return
+	}
+	m.batcher.EmitLog(&logspb.LogRecord{
+		TimeUnixNano:   uint64(time.Now().UnixNano()),
+		SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_INFO,
+		Body:           &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: event.EventName}},
+		Attributes:     append(attributes(props, tags), otlp.StringAttribute(eventNameKey, event.EventName)),
+	})
+}
+
+func (m *otlpMirror) metric(metric Metric, props, tags map[string]string) {
+	if m == nil {
+		return
+	}
+	m.batcher.EmitMetric(&metricspb.Metric{
+		Name: metric.Name,
+		Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+			DataPoints: []*metricspb.NumberDataPoint{{
+				Attributes:   attributes(props, tags),
+				TimeUnixNano: uint64(time.Now().UnixNano()),
+				Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: metric.Value},
+			}},
+		}},
+	})
+}
+
+func (m *otlpMirror) flush() {
+	if m == nil {
+		return
+	}
+	_ = m.batcher.Flush(context.Background())
+}
+
+func (m *otlpMirror) close(timeout time.Duration) {
+	if m == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	_ = m.batcher.Close(ctx)
+	_ = m.exporter.Close()
+}
+
+// severity maps AppInsights severity levels to the OTLP severity numbers.
+func severity(level contracts.SeverityLevel) logspb.SeverityNumber {
+	switch level {
+	case contracts.Verbose:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG
+	case contracts.Information:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_INFO
+	case contracts.Warning:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_WARN
+	case contracts.Error:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_ERROR
+	case contracts.Critical:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_FATAL
+	default:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED
+	}
+}
@@ -0,0 +1,59 @@
+package aitelemetry
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/otlp"
+	"github.com/Azure/azure-container-networking/otlp/otlptest"
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+	"github.com/stretchr/testify/require"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+)
+
+func stringAttributes(kvs []*commonpb.KeyValue) map[string]string {
+	out := map[string]string{}
+	for _, kv := range kvs {
+		out[kv.GetKey()] = kv.GetValue().GetStringValue()
+	}
+	return out
+}
+
+func TestMirrorToOTLP(t *testing.T) {
+	server := httptest.NewServer(&ingestionStandIn{})
+	defer server.Close()
+	receiver := otlptest.NewReceiver(t)
+
+	cfg := aiConfig
+	cfg.OTLP = &otlp.Config{Endpoint: receiver.GRPCEndpoint, Insecure: true}
+	th, err := NewWithConnectionString("InstrumentationKey=00000000-0000-0000-0000-000000000000;IngestionEndpoint="+server.URL+"/", cfg)
+	require.NoError(t, err)
+
+	th.TrackLog(Report{Message: "hello", Level: contracts.Warning, Context: "nc-1", CustomDimensions: map[string]string{"k": "v"}})
+	th.TrackEvent(Event{EventName: "CNSStarted", ResourceID: "nc-2"})
+	th.TrackMetric(Metric{Name: "AllocatedIPCount", Value: 3})
+	th.Close(1)
+
+	records := receiver.LogRecords()
+	require.Len(t, records, 2)
+	require.Equal(t, "hello", records[0].GetBody().GetStringValue())
+	require.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_WARN, records[0].GetSeverityNumber())
+	report := stringAttributes(records[0].GetAttributes())
+	require.Equal(t, "v", report["k"])
+	require.Equal(t, "nc-1", report["operation_id"])
+	require.Equal(t, cfg.AppName, report[appNameStr])
+
+	event := stringAttributes(records[1].GetAttributes())
+	require.Equal(t, "CNSStarted", event[eventNameKey])
+	require.Equal(t, "nc-2", event["operation_id"])
+
+	metrics := receiver.Metrics()
+	require.Len(t, metrics, 1)
+	require.Equal(t, "AllocatedIPCount", metrics[0].GetName())
+	require.InDelta(t, 3, metrics[0].GetGauge().GetDataPoints()[0].GetAsDouble(), 0)
+
+	for _, res := range receiver.Resources() {
+		require.Equal(t, cfg.AppName, stringAttributes(res.GetAttributes())["service.name"])
+	}
+}
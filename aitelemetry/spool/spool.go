@@ -0,0 +1,434 @@
+// Package spool implements a bounded, disk-backed FIFO of records which outlives the process that wrote them.
+// It buffers telemetry while its destination is unreachable, so that it can be replayed in order once it's back.
+//
+// Records are appended to segment files in the spool's directory. Every record is framed by its length and a CRC,
+// so that a torn or corrupted segment loses only its damaged tail. The read position of the spool is persisted in a
+// cursor file, so a record which has been replayed is not replayed again after a restart. Multiple processes may append
+// to a spool, since every operation is serialized by a lock file in the directory, but only one should replay it.
+package spool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-container-networking/processlock"
+	"github.com/pkg/errors"
+)
+
+const (
+	segmentExtension = ".seg"
+	cursorFileName   = "cursor"
+	lockFileName     = "spool.lock"
+	headerSize       = 8
+
+	// DefaultMaxSizeInBytes is the default cap on the size of all segments of a spool.
+	DefaultMaxSizeInBytes = 16 << 20
+	// DefaultSegmentSizeInBytes is the default size at which a new segment is started.
+	DefaultSegmentSizeInBytes = 1 << 20
+	// MaxRecordSizeInBytes is the largest record which can be appended.
+	MaxRecordSizeInBytes = 1 << 20
+)
+
+var (
+	// ErrRecordTooLarge is returned when appending a record larger than MaxRecordSizeInBytes.
+	ErrRecordTooLarge = errors.New("record is too large to spool")
+	// ErrDiscard can be returned by the send function of Replay to drop a record which can never be delivered,
+	// instead of stopping the replay to retry it later.
+	ErrDiscard = errors.New("discard record")
+
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// Config of a Spool.
+type Config struct {
+	// Dir is the directory of the spool's files. It is created if it doesn't exist.
+	Dir string
+	// MaxSizeInBytes caps the size of the spool. When it's exceeded, the oldest segments are dropped.
+	MaxSizeInBytes int64
+	// SegmentSizeInBytes is the size after which appends go to a new segment.
+	SegmentSizeInBytes int64
+}
+
+// Stats are the counters of a Spool since it was opened by this process.
+type Stats struct {
+	// Spooled is the number of records appended.
+	Spooled uint64
+	// Replayed is the number of records sent successfully by Replay.
+	Replayed uint64
+	// Dropped is the number of records dropped to stay within the size cap, or discarded by Replay.
+	Dropped uint64
+	// Corrupted is the number of segments whose tail was lost because a record failed its CRC or was truncated.
+	Corrupted uint64
+}
+
+// Spool is a disk-backed FIFO of records.
+type Spool struct {
+	cfg   Config
+	mu    sync.Mutex
+	lock  processlock.Interface
+	stats Stats
+}
+
+// cursor is the read position of the spool: the offset of the next record in a segment.
+type cursor struct {
+	segment uint64
+	offset  int64
+}
+
+// New opens the spool in the configured directory, creating it if necessary.
+func New(cfg Config) (*Spool, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("spool directory is empty")
+	}
+	if cfg.MaxSizeInBytes <= 0 {
+		cfg.MaxSizeInBytes = DefaultMaxSizeInBytes
+	}
+	if cfg.SegmentSizeInBytes <= 0 {
+		cfg.SegmentSizeInBytes = DefaultSegmentSizeInBytes
+	}
+	if cfg.SegmentSizeInBytes > cfg.MaxSizeInBytes {
+		cfg.SegmentSizeInBytes = cfg.MaxSizeInBytes
+	}
+	//nolint:gomnd // 0o755 - permission to create directory in octal
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, errors.Wrapf(err, "failed to create spool directory %s", cfg.Dir)
+	}
+	lock, err := processlock.NewFileLock(filepath.Join(cfg.Dir, lockFileName))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create spool lock")
+	}
+	return &Spool{cfg: cfg, lock: lock}, nil
+}
+
+// Stats returns the spool's counters.
+func (s *Spool) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// Append adds a record to the tail of the spool, dropping the oldest segments if the spool would exceed its size cap.
+func (s *Spool) Append(record []byte) error {
+	if len(record) > MaxRecordSizeInBytes {
+		return ErrRecordTooLarge
+	}
+	return s.withLock(func() error {
+		segments, err := s.segments()
+		if err != nil {
+			return err
+		}
+		cur, err := s.readCursor()
+		if err != nil {
+			return err
+		}
+
+		frameSize := int64(headerSize + len(record))
+		// an empty spool starts a new segment at the cursor, unless the cursor is inside a segment which is gone
+		tail := cur.segment
+		if cur.offset > 0 {
+			tail++
+		}
+		if len(segments) > 0 {
+			tail = segments[len(segments)-1]
+			tailSize, err := s.segmentSize(tail)
+			if err != nil {
+				return err
+			}
+			if tailSize > 0 && tailSize+frameSize > s.cfg.SegmentSizeInBytes {
+				tail++
+			}
+		}
+		if err := s.enforceCap(segments, tail, frameSize); err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(s.segmentPath(tail), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644) //nolint:gomnd // file permissions
+		if err != nil {
+			return errors.Wrap(err, "failed to open spool segment")
+		}
+		frame := make([]byte, frameSize)
+		binary.LittleEndian.PutUint32(frame[0:4], uint32(len(record)))
+		binary.LittleEndian.PutUint32(frame[4:8], crc32.Checksum(record, crcTable))
+		copy(frame[headerSize:], record)
+		if _, err := f.Write(frame); err != nil {
+			f.Close()
+			return errors.Wrap(err, "failed to write spool record")
+		}
+		if err := f.Close(); err != nil {
+			return errors.Wrap(err, "failed to close spool segment")
+		}
+		s.stats.Spooled++
+		return nil
+	})
+}
+
+// enforceCap drops the oldest segments until a frame of the given size fits in the cap.
+// The tail segment, which the frame will be appended to, is never dropped.
+func (s *Spool) enforceCap(segments []uint64, tail uint64, frameSize int64) error {
+	total := frameSize
+	sizes := make(map[uint64]int64, len(segments))
+	for _, seg := range segments {
+		size, err := s.segmentSize(seg)
+		if err != nil {
+			return err
+		}
+		sizes[seg] = size
+		total += size
+	}
+	for _, seg := range segments {
+		if total <= s.cfg.MaxSizeInBytes || seg == tail {
+			break
+		}
+		records, err := s.countRecords(seg)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(s.segmentPath(seg)); err != nil {
+			return errors.Wrap(err, "failed to drop spool segment")
+		}
+		s.stats.Dropped += uint64(records)
+		total -= sizes[seg]
+	}
+	return nil
+}
+
+// Replay sends the records of the spool in order, removing each record once send succeeds.
+// It stops at the first error from send and returns it, and the record is kept to be replayed again.
+// If send returns ErrDiscard, the record is dropped and replay continues.
+// The spool's lock is released while send runs, so that other processes can append meanwhile.
+func (s *Spool) Replay(send func(record []byte) error) error {
+	for {
+		var record []byte
+		var next cursor
+		err := s.withLock(func() error {
+			var err error
+			record, next, err = s.next()
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if record == nil {
+			return nil
+		}
+
+		sendErr := send(record)
+		if sendErr != nil && !errors.Is(sendErr, ErrDiscard) {
+			return sendErr
+		}
+		if err := s.withLock(func() error {
+			if sendErr != nil {
+				s.stats.Dropped++
+			} else {
+				s.stats.Replayed++
+			}
+			return s.writeCursor(next)
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+// next reads the record at the cursor. It skips segments which have been fully read or were dropped, and removes
+// them. It returns a nil record if the spool is empty, along with the cursor after the record.
+func (s *Spool) next() ([]byte, cursor, error) {
+	cur, err := s.readCursor()
+	if err != nil {
+		return nil, cur, err
+	}
+	segments, err := s.segments()
+	if err != nil {
+		return nil, cur, err
+	}
+	for i, seg := range segments {
+		if seg < cur.segment {
+			// a leftover of a crash between reading the segment and removing it
+			if err := os.Remove(s.segmentPath(seg)); err != nil {
+				return nil, cur, errors.Wrap(err, "failed to remove replayed spool segment")
+			}
+			continue
+		}
+		if seg > cur.segment {
+			// the segment at the cursor was dropped or removed
+			cur = cursor{segment: seg}
+		}
+		record, size, err := s.readRecord(seg, cur.offset)
+		if err != nil {
+			return nil, cur, err
+		}
+		if record != nil {
+			return record, cursor{segment: seg, offset: cur.offset + size}, nil
+		}
+		if i == len(segments)-1 {
+			// the tail has been read to its end, so the spool is empty. The tail is removed and the cursor moves
+			// past it so that the next append starts a fresh segment.
+			if err := os.Remove(s.segmentPath(seg)); err != nil {
+				return nil, cur, errors.Wrap(err, "failed to remove replayed spool segment")
+			}
+			return nil, cur, s.writeCursor(cursor{segment: seg + 1})
+		}
+		if err := os.Remove(s.segmentPath(seg)); err != nil {
+			return nil, cur, errors.Wrap(err, "failed to remove replayed spool segment")
+		}
+		cur = cursor{segment: segments[i+1]}
+	}
+	return nil, cur, nil
+}
+
+// readRecord reads the record at the offset of a segment, returning it with the size of its frame.
+// It returns a nil record at the end of the segment. A record which is truncated or fails its CRC ends the segment.
+func (s *Spool) readRecord(seg uint64, offset int64) ([]byte, int64, error) {
+	f, err := os.Open(s.segmentPath(seg))
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to open spool segment")
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to seek in spool segment")
+	}
+
+	record, err := readFrame(bufio.NewReader(f))
+	switch {
+	case errors.Is(err, io.EOF):
+		return nil, 0, nil
+	case errors.Is(err, errCorrupt):
+		s.stats.Corrupted++
+		return nil, 0, nil
+	case err != nil:
+		return nil, 0, err
+	}
+	return record, int64(headerSize + len(record)), nil
+}
+
+var errCorrupt = errors.New("corrupt spool record")
+
+// readFrame reads a framed record. It returns io.EOF at a clean end, and errCorrupt for a damaged frame.
+func readFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, errCorrupt
+		}
+		return nil, errors.Wrap(err, "failed to read spool record header")
+	}
+	length := binary.LittleEndian.Uint32(header[0:4])
+	if length > MaxRecordSizeInBytes {
+		return nil, errCorrupt
+	}
+	record := make([]byte, length)
+	if _, err := io.ReadFull(r, record); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, errCorrupt
+		}
+		return nil, errors.Wrap(err, "failed to read spool record")
+	}
+	if crc32.Checksum(record, crcTable) != binary.LittleEndian.Uint32(header[4:8]) {
+		return nil, errCorrupt
+	}
+	return record, nil
+}
+
+// countRecords counts the intact records of a segment.
+func (s *Spool) countRecords(seg uint64) (int, error) {
+	f, err := os.Open(s.segmentPath(seg))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to open spool segment")
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	count := 0
+	for {
+		_, err := readFrame(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, errCorrupt) {
+				return count, nil
+			}
+			return count, err
+		}
+		count++
+	}
+}
+
+// segments lists the sequence numbers of the segments in order.
+func (s *Spool) segments() ([]uint64, error) {
+	entries, err := os.ReadDir(s.cfg.Dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list spool segments")
+	}
+	var segments []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExtension) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExtension), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, seq)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return segments, nil
+}
+
+func (s *Spool) segmentSize(seg uint64) (int64, error) {
+	info, err := os.Stat(s.segmentPath(seg))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to stat spool segment")
+	}
+	return info.Size(), nil
+}
+
+func (s *Spool) segmentPath(seg uint64) string {
+	return filepath.Join(s.cfg.Dir, fmt.Sprintf("%020d%s", seg, segmentExtension))
+}
+
+func (s *Spool) readCursor() (cursor, error) {
+	b, err := os.ReadFile(filepath.Join(s.cfg.Dir, cursorFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return cursor{}, nil
+	}
+	if err != nil {
+		return cursor{}, errors.Wrap(err, "failed to read spool cursor")
+	}
+	var cur cursor
+	if _, err := fmt.Sscanf(string(b), "%d %d", &cur.segment, &cur.offset); err != nil {
+		// a damaged cursor restarts from the oldest segment, which may replay some records twice
+		return cursor{}, nil
+	}
+	return cur, nil
+}
+
+// writeCursor replaces the cursor file atomically.
+func (s *Spool) writeCursor(cur cursor) error {
+	path := filepath.Join(s.cfg.Dir, cursorFileName)
+	tmp := path + ".tmp"
+	//nolint:gomnd // file permissions
+	if err := os.WriteFile(tmp, []byte(fmt.Sprintf("%d %d", cur.segment, cur.offset)), 0o644); err != nil {
+		return errors.Wrap(err, "failed to write spool cursor")
+	}
+	return errors.Wrap(os.Rename(tmp, path), "failed to replace spool cursor")
+}
+
+// withLock runs f while holding both the in-process and the cross-process lock of the spool.
+func (s *Spool) withLock(f func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.lock.Lock(); err != nil {
+		return errors.Wrap(err, "failed to lock spool")
+	}
+	defer s.lock.Unlock() //nolint:errcheck // the lock is released when its file is closed
+	return f()
+}
@@ -0,0 +1,153 @@
+package spool
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func appendRecords(t *testing.T, s *Spool, from, to int) {
+	t.Helper()
+	for i := from; i < to; i++ {
+		require.NoError(t, s.Append([]byte(fmt.Sprintf("record-%03d", i))))
+	}
+}
+
+func replayAll(t *testing.T, s *Spool) []string {
+	t.Helper()
+	var got []string
+	require.NoError(t, s.Replay(func(record []byte) error {
+		got = append(got, string(record))
+		return nil
+	}))
+	return got
+}
+
+func records(from, to int) []string {
+	var out []string
+	for i := from; i < to; i++ {
+		out = append(out, fmt.Sprintf("record-%03d", i))
+	}
+	return out
+}
+
+func TestReplayInOrderAcrossSegments(t *testing.T) {
+	s, err := New(Config{Dir: t.TempDir(), SegmentSizeInBytes: 64})
+	require.NoError(t, err)
+
+	appendRecords(t, s, 0, 20)
+	segments, err := s.segments()
+	require.NoError(t, err)
+	require.Greater(t, len(segments), 1, "expected records to span multiple segments")
+
+	require.Equal(t, records(0, 20), replayAll(t, s))
+	require.Empty(t, replayAll(t, s))
+
+	// appending after the spool has been drained continues in order
+	appendRecords(t, s, 20, 25)
+	require.Equal(t, records(20, 25), replayAll(t, s))
+	require.Equal(t, Stats{Spooled: 25, Replayed: 25}, s.Stats())
+}
+
+func TestReplayStopsAtFailureAndResumes(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(Config{Dir: dir, SegmentSizeInBytes: 64})
+	require.NoError(t, err)
+	appendRecords(t, s, 0, 10)
+
+	unreachable := errors.New("unreachable")
+	var got []string
+	err = s.Replay(func(record []byte) error {
+		if len(got) == 4 {
+			return unreachable
+		}
+		got = append(got, string(record))
+		return nil
+	})
+	require.ErrorIs(t, err, unreachable)
+	require.Equal(t, records(0, 4), got)
+
+	// a new process resumes after the last record which was sent
+	reopened, err := New(Config{Dir: dir, SegmentSizeInBytes: 64})
+	require.NoError(t, err)
+	require.Equal(t, records(4, 10), replayAll(t, reopened))
+}
+
+func TestDiscard(t *testing.T) {
+	s, err := New(Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	appendRecords(t, s, 0, 3)
+
+	var got []string
+	require.NoError(t, s.Replay(func(record []byte) error {
+		if string(record) == "record-001" {
+			return errors.Wrap(ErrDiscard, "rejected")
+		}
+		got = append(got, string(record))
+		return nil
+	}))
+	require.Equal(t, []string{"record-000", "record-002"}, got)
+	require.Equal(t, uint64(1), s.Stats().Dropped)
+}
+
+func TestSizeCapDropsOldestSegments(t *testing.T) {
+	// every frame is 18 bytes, so a segment holds 3 records and the spool 3 segments
+	s, err := New(Config{Dir: t.TempDir(), SegmentSizeInBytes: 54, MaxSizeInBytes: 162})
+	require.NoError(t, err)
+
+	appendRecords(t, s, 0, 12)
+	require.Equal(t, uint64(3), s.Stats().Dropped)
+	require.Equal(t, records(3, 12), replayAll(t, s))
+}
+
+func TestCorruptRecordEndsSegment(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(Config{Dir: dir, SegmentSizeInBytes: 54})
+	require.NoError(t, err)
+	appendRecords(t, s, 0, 6)
+
+	// flip a byte of the second record of the first segment
+	segments, err := s.segments()
+	require.NoError(t, err)
+	path := s.segmentPath(segments[0])
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	b[18+headerSize] ^= 0xff
+	require.NoError(t, os.WriteFile(path, b, 0o644))
+
+	require.Equal(t, []string{"record-000", "record-003", "record-004", "record-005"}, replayAll(t, s))
+	require.Equal(t, uint64(1), s.Stats().Corrupted)
+}
+
+func TestTruncatedSegment(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(Config{Dir: dir})
+	require.NoError(t, err)
+	appendRecords(t, s, 0, 2)
+
+	// a writer which crashed mid-record leaves a torn frame at the tail
+	segments, err := s.segments()
+	require.NoError(t, err)
+	f, err := os.OpenFile(s.segmentPath(segments[0]), os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0xff, 0x00, 0x00})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	require.Equal(t, records(0, 2), replayAll(t, s))
+	require.Equal(t, uint64(1), s.Stats().Corrupted)
+
+	entries, err := filepath.Glob(filepath.Join(dir, "*"+segmentExtension))
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestRecordTooLarge(t *testing.T) {
+	s, err := New(Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	require.ErrorIs(t, s.Append(make([]byte, MaxRecordSizeInBytes+1)), ErrRecordTooLarge)
+}
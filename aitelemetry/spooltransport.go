@@ -0,0 +1,162 @@
+package aitelemetry
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-container-networking/aitelemetry/spool"
+	"github.com/pkg/errors"
+)
+
+// acceptedBody is the body of the response which acknowledges a spooled batch to the AppInsights channel.
+const acceptedBody = `{"itemsReceived":0,"itemsAccepted":0,"errors":[]}`
+
+var errIngestionUnavailable = errors.New("ingestion endpoint unavailable")
+
+// spoolingTransport is the http.RoundTripper of the AppInsights client when spooling is enabled.
+// A batch which can't be delivered, because the ingestion endpoint is unreachable or asks for a retry, is appended to
+// the spool and acknowledged to the AppInsights channel, which would otherwise hold it in memory until it gives up.
+// While the spool holds batches, new batches are spooled behind them, so that replay delivers everything in order.
+type spoolingTransport struct {
+	transport http.RoundTripper
+	spool     *spool.Spool
+
+	mu sync.Mutex
+	// pending is set while the spool may hold batches. It starts set since a previous process may have left some.
+	pending bool
+}
+
+func newSpoolingTransport(transport http.RoundTripper, s *spool.Spool) *spoolingTransport {
+	return &spoolingTransport{
+		transport: transport,
+		spool:     s,
+		pending:   true,
+	}
+}
+
+func (t *spoolingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	payload, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read telemetry batch")
+	}
+
+	t.mu.Lock()
+	pending := t.pending
+	t.mu.Unlock()
+	if !pending {
+		resp, err := t.transport.RoundTrip(withBody(req, payload))
+		if err == nil && !isRetryable(resp.StatusCode) {
+			return resp, nil
+		}
+		if err == nil {
+			resp.Body.Close()
+		}
+		debugLog("[AppInsights] spooling telemetry batch, ingestion failed: %v", describe(resp, err))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.spool.Append(payload); err != nil {
+		debugLog("[AppInsights] failed to spool telemetry batch: %v", err)
+		return nil, errors.Wrap(err, "failed to spool telemetry batch")
+	}
+	t.pending = true
+	return acceptedResponse(req), nil
+}
+
+// replay sends the spooled batches to the ingestion endpoint in order.
+func (t *spoolingTransport) replay(endpoint string) error {
+	send := func(payload []byte) error {
+		req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return errors.Wrap(err, "failed to create replay request")
+		}
+		req.Header.Set("Content-Encoding", "gzip")
+		req.Header.Set("Content-Type", "application/x-json-stream")
+		resp, err := t.transport.RoundTrip(req)
+		if err != nil {
+			return errors.Wrap(err, "failed to replay telemetry batch")
+		}
+		resp.Body.Close()
+		switch {
+		case isRetryable(resp.StatusCode):
+			return errors.Wrapf(errIngestionUnavailable, "status %d", resp.StatusCode)
+		case resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent:
+			// the endpoint will never accept this batch
+			return errors.Wrapf(spool.ErrDiscard, "status %d", resp.StatusCode)
+		}
+		return nil
+	}
+
+	if err := t.spool.Replay(send); err != nil {
+		return errors.Wrap(err, "failed to replay telemetry spool")
+	}
+	// batches may have been spooled while replaying, so live batches keep going to the spool until it has been
+	// drained while holding the lock
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.spool.Replay(send); err != nil {
+		return errors.Wrap(err, "failed to replay telemetry spool")
+	}
+	t.pending = false
+	return nil
+}
+
+// run replays the spool every interval until stop is closed.
+func (t *spoolingTransport) run(endpoint string, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := t.replay(endpoint); err != nil {
+			debugLog("[AppInsights] %v", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// isRetryable is true for the status codes on which the AppInsights channel retries a batch.
+func isRetryable(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusServiceUnavailable,
+		439: //nolint:gomnd // AppInsights' too many requests over an extended time
+		return true
+	}
+	return false
+}
+
+func describe(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return resp.Status
+}
+
+func withBody(req *http.Request, payload []byte) *http.Request {
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(payload))
+	out.ContentLength = int64(len(payload))
+	return out
+}
+
+func acceptedResponse(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(strings.NewReader(acceptedBody)),
+		ContentLength: int64(len(acceptedBody)),
+		Request:       req,
+	}
+}
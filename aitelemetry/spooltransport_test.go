@@ -0,0 +1,126 @@
+package aitelemetry
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// ingestionStandIn is a local stand-in for the AppInsights ingestion endpoint which records the messages of the
+// traces it accepts, and can be made unavailable.
+type ingestionStandIn struct {
+	mu          sync.Mutex
+	unavailable bool
+	messages    []string
+}
+
+func (i *ingestionStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.unavailable {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	zr, err := gzip.NewReader(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	scanner := bufio.NewScanner(zr)
+	received := 0
+	for scanner.Scan() {
+		var envelope struct {
+			Data struct {
+				BaseData struct {
+					Message string `json:"message"`
+				} `json:"baseData"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &envelope); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		i.messages = append(i.messages, envelope.Data.BaseData.Message)
+		received++
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"itemsReceived": received, "itemsAccepted": received, "errors": []any{}})
+}
+
+func (i *ingestionStandIn) setUnavailable(unavailable bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.unavailable = unavailable
+}
+
+func (i *ingestionStandIn) received() []string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return append([]string(nil), i.messages...)
+}
+
+func TestSpoolWhileIngestionUnavailable(t *testing.T) {
+	ingestion := &ingestionStandIn{unavailable: true}
+	server := httptest.NewServer(ingestion)
+	defer server.Close()
+
+	cfg := aiConfig
+	cfg.BatchInterval = 1
+	cfg.SpoolDir = t.TempDir()
+	th, err := NewWithConnectionString("InstrumentationKey=00000000-0000-0000-0000-000000000000;IngestionEndpoint="+server.URL+"/", cfg)
+	require.NoError(t, err)
+	defer th.Close(1)
+
+	track := func(msg string) {
+		th.TrackLog(Report{Message: msg, CustomDimensions: map[string]string{}})
+		th.Flush()
+	}
+
+	track("first")
+	require.Eventually(t, func() bool { return th.SpoolStats().Spooled == 1 }, 10*time.Second, 50*time.Millisecond)
+	track("second")
+	require.Eventually(t, func() bool { return th.SpoolStats().Spooled == 2 }, 10*time.Second, 50*time.Millisecond)
+	require.Empty(t, ingestion.received())
+
+	// once ingestion is back, the spool is replayed in order and new telemetry is sent after it
+	ingestion.setUnavailable(false)
+	require.Eventually(t, func() bool { return len(ingestion.received()) == 2 }, 10*time.Second, 50*time.Millisecond)
+	track("third")
+	require.Eventually(t, func() bool { return len(ingestion.received()) == 3 }, 10*time.Second, 50*time.Millisecond)
+
+	require.Equal(t, []string{"first", "second", "third"}, ingestion.received())
+	stats := th.SpoolStats()
+	require.Equal(t, uint64(2), stats.Replayed)
+	require.Zero(t, stats.Dropped)
+}
+
+func TestSpoolSurvivesRestart(t *testing.T) {
+	ingestion := &ingestionStandIn{unavailable: true}
+	server := httptest.NewServer(ingestion)
+	defer server.Close()
+
+	cfg := aiConfig
+	cfg.BatchInterval = 1
+	cfg.SpoolDir = t.TempDir()
+	connectionString := "InstrumentationKey=00000000-0000-0000-0000-000000000000;IngestionEndpoint=" + server.URL + "/"
+
+	th, err := NewWithConnectionString(connectionString, cfg)
+	require.NoError(t, err)
+	th.TrackLog(Report{Message: "before restart", CustomDimensions: map[string]string{}})
+	th.Flush()
+	require.Eventually(t, func() bool { return th.SpoolStats().Spooled == 1 }, 10*time.Second, 50*time.Millisecond)
+	th.Close(1)
+
+	ingestion.setUnavailable(false)
+	restarted, err := NewWithConnectionString(connectionString, cfg)
+	require.NoError(t, err)
+	defer restarted.Close(1)
+	require.Eventually(t, func() bool { return len(ingestion.received()) == 1 }, 10*time.Second, 50*time.Millisecond)
+	require.Equal(t, []string{"before restart"}, ingestion.received())
+}
@@ -2,11 +2,13 @@ package aitelemetry
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
 	"time"
 
+	"github.com/Azure/azure-container-networking/aitelemetry/spool"
 	"github.com/Azure/azure-container-networking/common"
 	"github.com/Azure/azure-container-networking/log"
 	"github.com/Azure/azure-container-networking/processlock"
@@ -172,6 +174,39 @@ func isPublicEnvironment(url string, retryCount, waitTimeInSecs int) (bool, erro
 	return false, err
 }
 
+// newSpooler routes the AppInsights client through a spoolingTransport if a spool directory is configured.
+// Spooling is best effort: if the spool can't be opened, telemetry is sent without it.
+func newSpooler(telemetryConfig *appinsights.TelemetryConfiguration, aiConfig AIConfig) *spoolingTransport {
+	if aiConfig.SpoolDir == "" {
+		return nil
+	}
+	s, err := spool.New(spool.Config{Dir: aiConfig.SpoolDir, MaxSizeInBytes: aiConfig.SpoolMaxSizeInBytes})
+	if err != nil {
+		debugLog("[AppInsights] Error opening spool, telemetry will not be spooled: %v", err)
+		return nil
+	}
+	transport := http.DefaultTransport
+	if telemetryConfig.Client != nil && telemetryConfig.Client.Transport != nil {
+		transport = telemetryConfig.Client.Transport
+	}
+	spooler := newSpoolingTransport(transport, s)
+	telemetryConfig.Client = &http.Client{Transport: spooler}
+	return spooler
+}
+
+// startReplay replays the spool in the background until the handle is closed.
+func (th *telemetryHandle) startReplay(endpoint string, interval time.Duration) {
+	if th.spooler == nil {
+		return
+	}
+	th.stopReplay = make(chan struct{})
+	th.replayWG.Add(1)
+	go func() {
+		defer th.replayWG.Done()
+		th.spooler.run(endpoint, interval, th.stopReplay)
+	}()
+}
+
 // NewAITelemetry creates telemetry handle with user specified appinsights id.
 func NewAITelemetry(
 	azEnvUrl string,
@@ -197,6 +232,7 @@ func NewAITelemetry(
 	telemetryConfig.MaxBatchSize = aiConfig.BatchSize
 	telemetryConfig.MaxBatchInterval = time.Duration(aiConfig.BatchInterval) * time.Second
 
+	spooler := newSpooler(telemetryConfig, aiConfig)
 	th := &telemetryHandle{
 		client:                       appinsights.NewTelemetryClientFromConfig(telemetryConfig),
 		appName:                      aiConfig.AppName,
@@ -204,7 +240,10 @@ func NewAITelemetry(
 		diagListener:                 messageListener(),
 		disableMetadataRefreshThread: aiConfig.DisableMetadataRefreshThread,
 		refreshTimeout:               aiConfig.RefreshTimeout,
+		spooler:                      spooler,
+		otlp:                         newOTLPMirror(aiConfig),
 	}
+	th.startReplay(telemetryConfig.EndpointUrl, time.Duration(aiConfig.BatchInterval)*time.Second)
 
 	if th.disableMetadataRefreshThread {
 		getMetadata(th)
@@ -237,6 +276,7 @@ func NewWithConnectionString(connectionString string, aiConfig AIConfig) (Teleme
 	telemetryConfig.MaxBatchSize = aiConfig.BatchSize
 	telemetryConfig.MaxBatchInterval = time.Duration(aiConfig.BatchInterval) * time.Second
 
+	spooler := newSpooler(telemetryConfig, aiConfig)
 	th := &telemetryHandle{
 		client:                       appinsights.NewTelemetryClientFromConfig(telemetryConfig),
 		appName:                      aiConfig.AppName,
@@ -244,7 +284,10 @@ func NewWithConnectionString(connectionString string, aiConfig AIConfig) (Teleme
 		diagListener:                 messageListener(),
 		disableMetadataRefreshThread: aiConfig.DisableMetadataRefreshThread,
 		refreshTimeout:               aiConfig.RefreshTimeout,
+		spooler:                      spooler,
+		otlp:                         newOTLPMirror(aiConfig),
 	}
+	th.startReplay(telemetryConfig.EndpointUrl, time.Duration(aiConfig.BatchInterval)*time.Second)
 
 	if th.disableMetadataRefreshThread {
 		getMetadata(th)
@@ -300,6 +343,7 @@ func (th *telemetryHandle) TrackLog(report Report) {
 
 	// send to appinsights resource
 	th.client.Track(trace)
+	th.otlp.report(report, trace.Properties, trace.Tags)
 }
 
 // TrackEvent function sends events to appinsights resource. It overrides a few of the existing columns
@@ -343,6 +387,7 @@ func (th *telemetryHandle) TrackEvent(event Event) {
 	aiEvent.Properties[appNameStr] = th.appName
 	aiEvent.Properties[versionStr] = th.appVersion
 	th.client.Track(aiEvent)
+	th.otlp.event(event, aiEvent.Properties, aiEvent.Tags)
 }
 
 // TrackMetric function sends metric to appinsights resource. It overrides few of the existing columns with app information
@@ -379,6 +424,7 @@ func (th *telemetryHandle) TrackMetric(metric Metric) {
 
 	// send metric to appinsights
 	th.client.Track(aimetric)
+	th.otlp.metric(metric, aimetric.Properties, aimetric.Tags)
 }
 
 // Close - should be called for each NewAITelemetry call. Will release resources acquired
@@ -417,6 +463,14 @@ func (th *telemetryHandle) Close(timeout int) {
 		// to complete, so let's just exit.
 	}
 
+	th.otlp.close(time.Duration(timeout) * time.Second)
+
+	if th.stopReplay != nil {
+		close(th.stopReplay)
+		th.replayWG.Wait()
+		th.stopReplay = nil
+	}
+
 	// Remove diganostic message listener
 	if th.diagListener != nil {
 		th.diagListener.Remove()
@@ -427,4 +481,13 @@ func (th *telemetryHandle) Close(timeout int) {
 // Flush - forces the current queue to be sent
 func (th *telemetryHandle) Flush() {
 	th.client.Channel().Flush()
+	th.otlp.flush()
+}
+
+// SpoolStats returns the counters of the disk spool, which are zero if spooling is disabled
+func (th *telemetryHandle) SpoolStats() spool.Stats {
+	if th.spooler == nil {
+		return spool.Stats{}
+	}
+	return th.spooler.spool.Stats()
 }
@@ -5,16 +5,23 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
 	"net"
+	"os"
+	"path/filepath"
 
 	"github.com/Azure/azure-container-networking/azure-ipam/internal/buildinfo"
 	"github.com/Azure/azure-container-networking/azure-ipam/ipconfig"
 	"github.com/Azure/azure-container-networking/cns"
 	cnscli "github.com/Azure/azure-container-networking/cns/client"
 	"github.com/Azure/azure-container-networking/cns/fsnotify"
+	"github.com/Azure/azure-container-networking/cns/lease"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/errcode"
 	cniSkel "github.com/containernetworking/cni/pkg/skel"
 	cniTypes "github.com/containernetworking/cni/pkg/types"
 	types100 "github.com/containernetworking/cni/pkg/types/100"
+	cniVersion "github.com/containernetworking/cni/pkg/version"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
@@ -31,7 +38,8 @@ type IPAMPlugin struct {
 	Options   map[string]interface{}
 	logger    *zap.Logger
 	cnsClient cnsClient
-	out       io.Writer // indicate the output channel for the plugin
+	out       io.Writer    // indicate the output channel for the plugin
+	leases    *lease.Cache // the IPs CNS pre-leased, which are assigned to pods while CNS is unreachable
 }
 
 type cnsClient interface {
@@ -39,6 +47,8 @@ type cnsClient interface {
 	RequestIPs(context.Context, cns.IPConfigsRequest) (*cns.IPConfigsResponse, error)
 	ReleaseIPs(context.Context, cns.IPConfigsRequest) error
 	ReleaseIPAddress(context.Context, cns.IPConfigRequest) error
+	GetIPAddressesMatchingStates(context.Context, ...types.IPState) ([]cns.IPConfigurationStatus, error)
+	GCIPs(context.Context, cns.GCIPConfigsRequest) (*cns.GCIPConfigsResponse, error)
 }
 
 // NewPlugin constructs a new IPAM plugin instance with given logger and CNS client
@@ -49,6 +59,7 @@ func NewPlugin(logger *zap.Logger, c cnsClient, out io.Writer) (*IPAMPlugin, err
 		logger:    logger,
 		out:       out,
 		cnsClient: c,
+		leases:    lease.New(lease.DefaultPath),
 	}
 	return plugin, nil
 }
@@ -58,6 +69,15 @@ func NewPlugin(logger *zap.Logger, c cnsClient, out io.Writer) (*IPAMPlugin, err
 // https://github.com/containernetworking/cni/blob/master/SPEC.md
 //
 
+// cnsError translates an error of a CNS request into a CNI error. Errors which CNS classified keep the CNI code of
+// their errcode.Code, with the structured error as details; others get the plugin specific code.
+func cnsError(err error, code uint, details string) *cniTypes.Error {
+	if errcode.Classified(err) {
+		return errcode.CNIError(err)
+	}
+	return cniTypes.NewError(code, err.Error(), details)
+}
+
 // CmdAdd handles CNI add commands.
 func (p *IPAMPlugin) CmdAdd(args *cniSkel.CmdArgs) error {
 	p.logger.Info("ADD called", zap.Any("args", args))
@@ -98,7 +118,7 @@ func (p *IPAMPlugin) CmdAdd(args *cniSkel.CmdArgs) error {
 			// if the old API fails as well then we just return the error
 			if err != nil {
 				p.logger.Error("Failed to request IP address from CNS using RequestIPAddress", zap.Error(err), zap.Any("request", ipconfigReq))
-				return cniTypes.NewError(ErrRequestIPConfigFromCNS, err.Error(), "failed to request IP address from CNS using RequestIPAddress")
+				return cnsError(err, ErrRequestIPConfigFromCNS, "failed to request IP address from CNS using RequestIPAddress")
 			}
 			// takes values from the IPConfigResponse struct and puts them in a IPConfigsResponse struct
 			resp = &cns.IPConfigsResponse{
@@ -107,9 +127,9 @@ func (p *IPAMPlugin) CmdAdd(args *cniSkel.CmdArgs) error {
 					res.PodIpInfo,
 				},
 			}
-		} else {
+		} else if resp, err = cnscli.ConsumeLease(p.leases, req, err, p.logger); err != nil {
 			p.logger.Error("Failed to request IP address from CNS", zap.Error(err), zap.Any("request", req))
-			return cniTypes.NewError(ErrRequestIPConfigFromCNS, err.Error(), "failed to request IP address from CNS")
+			return cnsError(err, ErrRequestIPConfigFromCNS, "failed to request IP address from CNS")
 		}
 	}
 	p.logger.Debug("Received CNS IP config response", zap.Any("response", resp))
@@ -195,6 +215,9 @@ func (p *IPAMPlugin) CmdDel(args *cniSkel.CmdArgs) error {
 	}
 	p.logger.Debug("Created CNS IP config request", zap.Any("request", req))
 
+	// the pod is deleted whatever CNS answers, so the lease it consumed must not be adopted by CNS
+	leaseReleased := cnscli.ReleaseLease(p.leases, args.ContainerID, p.logger)
+
 	p.logger.Debug("Making request to CNS")
 	// cnsClient enforces it own timeout
 	if err := p.cnsClient.ReleaseIPs(context.TODO(), req); err != nil {
@@ -213,6 +236,9 @@ func (p *IPAMPlugin) CmdDel(args *cniSkel.CmdArgs) error {
 
 			if err != nil {
 				if errors.As(err, &connectionErr) {
+					if leaseReleased {
+						return nil
+					}
 					p.logger.Info("Failed to release IP address from CNS due to connection failure, saving to watcher to delete")
 					addErr := fsnotify.AddFile(args.ContainerID, args.ContainerID, watcherPath)
 					if addErr != nil {
@@ -223,10 +249,13 @@ func (p *IPAMPlugin) CmdDel(args *cniSkel.CmdArgs) error {
 					}
 				} else {
 					p.logger.Error("Failed to release IP address to CNS using ReleaseIPAddress", zap.Error(err), zap.Any("request", ipconfigReq))
-					return cniTypes.NewError(ErrRequestIPConfigFromCNS, err.Error(), "failed to release IP address from CNS using ReleaseIPAddress")
+					return cnsError(err, ErrRequestIPConfigFromCNS, "failed to release IP address from CNS using ReleaseIPAddress")
 				}
 			}
 		} else if errors.As(err, &connectionErr) {
+			if leaseReleased {
+				return nil
+			}
 			p.logger.Info("Failed to release IP addresses from CNS due to connection failure, saving to watcher to delete")
 			addErr := fsnotify.AddFile(args.ContainerID, args.ContainerID, watcherPath)
 			if addErr != nil {
@@ -246,9 +275,98 @@ func (p *IPAMPlugin) CmdDel(args *cniSkel.CmdArgs) error {
 	return nil
 }
 
-// CmdCheck handles CNI check command - not implemented
+// CmdCheck handles CNI check commands. It verifies with CNS that the IPs of the previous result are still assigned to
+// the container.
 func (p *IPAMPlugin) CmdCheck(args *cniSkel.CmdArgs) error {
-	p.logger.Info("CHECK called")
+	p.logger.Info("CHECK called", zap.Any("args", args))
+
+	// Parsing network conf
+	nwCfg, err := parseNetConf(args.StdinData)
+	if err != nil {
+		p.logger.Error("Failed to parse CNI network config from stdin", zap.Error(err), zap.Any("argStdinData", args.StdinData))
+		return cniTypes.NewError(cniTypes.ErrDecodingFailure, err.Error(), "failed to parse CNI network config from stdin")
+	}
+	if err = cniVersion.ParsePrevResult(nwCfg); err != nil {
+		p.logger.Error("Failed to parse prevResult", zap.Error(err))
+		return cniTypes.NewError(cniTypes.ErrDecodingFailure, err.Error(), "failed to parse prevResult")
+	}
+	if nwCfg.PrevResult == nil {
+		return cniTypes.NewError(cniTypes.ErrInvalidNetworkConfig, "prevResult is required", "CHECK requires the result of ADD")
+	}
+	prevResult, err := types100.NewResultFromResult(nwCfg.PrevResult)
+	if err != nil {
+		p.logger.Error("Failed to convert prevResult", zap.Error(err), zap.Any("prevResult", nwCfg.PrevResult))
+		return cniTypes.NewError(cniTypes.ErrIncompatibleCNIVersion, err.Error(), "failed to convert prevResult to the current CNI version")
+	}
+
+	p.logger.Debug("Making request to CNS")
+	ipConfigs, err := p.cnsClient.GetIPAddressesMatchingStates(context.TODO(), types.Assigned)
+	if err != nil {
+		p.logger.Error("Failed to get assigned IP addresses from CNS", zap.Error(err))
+		return cnsError(err, ErrRequestIPConfigFromCNS, "failed to get assigned IP addresses from CNS")
+	}
+	assigned := map[string]struct{}{}
+	for i := range ipConfigs {
+		if ipConfigs[i].PodInfo != nil && ipConfigs[i].PodInfo.InfraContainerID() == args.ContainerID {
+			assigned[ipConfigs[i].IPAddress] = struct{}{}
+		}
+	}
+	if len(assigned) == 0 {
+		err = errcode.New(errcode.NotFound, fmt.Sprintf("no IPs are assigned to container %s", args.ContainerID))
+		p.logger.Error("CHECK failed", zap.Error(err))
+		return errcode.CNIError(err)
+	}
+	for _, ip := range prevResult.IPs {
+		if _, ok := assigned[ip.Address.IP.String()]; !ok {
+			err = errcode.New(errcode.NotFound, fmt.Sprintf("IP %s isn't assigned to container %s", ip.Address.IP, args.ContainerID))
+			p.logger.Error("CHECK failed", zap.Error(err))
+			return errcode.CNIError(err)
+		}
+	}
+
+	p.logger.Info("CHECK success")
+	return nil
+}
+
+// CmdGC handles CNI garbage collection commands. CNS releases the IPs of any container which isn't one of the valid
+// attachments, such as those whose DEL never reached it. Missed deletes which are pending in the watcher directory are
+// resolved by the same release, so their files are removed.
+func (p *IPAMPlugin) CmdGC(args *cniSkel.CmdArgs) error {
+	p.logger.Info("GC called", zap.Any("args", args))
+
+	// Parsing network conf
+	nwCfg, err := parseNetConf(args.StdinData)
+	if err != nil {
+		p.logger.Error("Failed to parse CNI network config from stdin", zap.Error(err), zap.Any("argStdinData", args.StdinData))
+		return cniTypes.NewError(cniTypes.ErrDecodingFailure, err.Error(), "failed to parse CNI network config from stdin")
+	}
+	req := cns.GCIPConfigsRequest{
+		ValidContainerIDs: make([]string, 0, len(nwCfg.ValidAttachments)),
+		Owner:             ipconfig.Owner,
+	}
+	for _, attachment := range nwCfg.ValidAttachments {
+		req.ValidContainerIDs = append(req.ValidContainerIDs, attachment.ContainerID)
+	}
+
+	p.logger.Debug("Making request to CNS", zap.Int("validContainers", len(req.ValidContainerIDs)))
+	resp, err := p.cnsClient.GCIPs(context.TODO(), req)
+	if err != nil {
+		if cnscli.IsUnsupportedAPI(err) {
+			// GC is best effort: an older CNS still releases missed deletes from the watcher directory
+			p.logger.Warn("CNS doesn't support GC", zap.Error(err))
+			return nil
+		}
+		p.logger.Error("Failed to GC IP addresses in CNS", zap.Error(err))
+		return cnsError(err, ErrRequestIPConfigFromCNS, "failed to GC IP addresses in CNS")
+	}
+
+	for _, containerID := range resp.ReleasedContainerIDs {
+		if err := os.Remove(filepath.Join(watcherPath, containerID)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			p.logger.Error("Failed to remove missed delete from watcher", zap.String("containerID", containerID), zap.Error(err))
+		}
+	}
+
+	p.logger.Info("GC success", zap.Strings("releasedContainerIDs", resp.ReleasedContainerIDs))
 	return nil
 }
 
@@ -5,11 +5,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/Azure/azure-container-networking/azure-ipam/ipconfig"
 	"github.com/Azure/azure-container-networking/azure-ipam/logger"
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/cns/client"
+	"github.com/Azure/azure-container-networking/cns/lease"
 	"github.com/Azure/azure-container-networking/cns/types"
 	cniSkel "github.com/containernetworking/cni/pkg/skel"
 	cniTypes "github.com/containernetworking/cni/pkg/types"
@@ -323,6 +329,31 @@ func (c *MockCNSClient) ReleaseIPs(ctx context.Context, ipconfig cns.IPConfigsRe
 	}
 }
 
+func (c *MockCNSClient) GetIPAddressesMatchingStates(context.Context, ...types.IPState) ([]cns.IPConfigurationStatus, error) {
+	assigned := func(ip, containerID string) cns.IPConfigurationStatus {
+		ipConfig := cns.IPConfigurationStatus{
+			IPAddress: ip,
+			PodInfo:   cns.NewPodInfo(containerID, containerID+"-eth0", "testname", "testns"),
+		}
+		ipConfig.SetState(types.Assigned)
+		return ipConfig
+	}
+	return []cns.IPConfigurationStatus{
+		assigned("10.0.1.10", "happyArgsSingle"),
+		assigned("10.0.1.10", "happyArgsDual"),
+		assigned("fd11:1234::1", "happyArgsDual"),
+		assigned("10.0.1.11", "otherArgs"),
+	}, nil
+}
+
+func (c *MockCNSClient) GCIPs(_ context.Context, req cns.GCIPConfigsRequest) (*cns.GCIPConfigsResponse, error) {
+	// like CNS, GC without an owner is rejected
+	if len(req.ValidContainerIDs) == 0 || req.Owner != ipconfig.Owner {
+		return nil, errFoo
+	}
+	return &cns.GCIPConfigsResponse{ReleasedContainerIDs: []string{"leakedArgs"}}, nil
+}
+
 // cniResultsWriter is a helper struct to write CNI results to a byte array
 type cniResultsWriter struct {
 	result *types100.Result
@@ -567,13 +598,207 @@ func TestCmdDel(t *testing.T) {
 }
 
 func TestCmdCheck(t *testing.T) {
-	mockCNSClient := &MockCNSClient{}
-	testLogger, cleanup, err := logger.New(loggerCfg)
-	if err != nil {
-		return
+	checkNetConf := func(ips ...string) []byte {
+		prevResult := map[string]interface{}{"cniVersion": "1.0.0"}
+		ipConfigs := []map[string]string{}
+		for _, ip := range ips {
+			ipConfigs = append(ipConfigs, map[string]string{"address": ip})
+		}
+		prevResult["ips"] = ipConfigs
+		b, err := json.Marshal(map[string]interface{}{
+			"cniVersion": "1.0.0",
+			"name":       "happynetconf",
+			"prevResult": prevResult,
+		})
+		if err != nil {
+			panic(err)
+		}
+		return b
+	}
+
+	tests := []scenario{
+		{
+			name: "Happy CNI check single IP",
+			args: buildArgs("happyArgsSingle", happyPodArgs, checkNetConf("10.0.1.10/24")),
+		},
+		{
+			name: "Happy CNI check dual IP",
+			args: buildArgs("happyArgsDual", happyPodArgs, checkNetConf("10.0.1.10/24", "fd11:1234::1/120")),
+		},
+		{
+			name:    "Fail CNI check when IP is assigned to another container",
+			args:    buildArgs("happyArgsSingle", happyPodArgs, checkNetConf("10.0.1.11/24")),
+			wantErr: true,
+		},
+		{
+			name:    "Fail CNI check when no IPs are assigned to the container",
+			args:    buildArgs("leakedArgs", happyPodArgs, checkNetConf("10.0.1.12/24")),
+			wantErr: true,
+		},
+		{
+			name:    "Fail CNI check without prevResult",
+			args:    buildArgs("happyArgsSingle", happyPodArgs, []byte(`{"cniVersion":"1.0.0","name":"happynetconf"}`)),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			mockCNSClient := &MockCNSClient{}
+			testLogger, cleanup, err := logger.New(loggerCfg)
+			if err != nil {
+				return
+			}
+			defer cleanup()
+			ipamPlugin, _ := NewPlugin(testLogger, mockCNSClient, nil)
+			err = ipamPlugin.CmdCheck(tt.args)
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCmdGC(t *testing.T) {
+	gcNetConf := func(containerIDs ...string) []byte {
+		netConf := &cniTypes.NetConf{
+			CNIVersion: "1.1.0",
+			Name:       "happynetconf",
+		}
+		for _, containerID := range containerIDs {
+			netConf.ValidAttachments = append(netConf.ValidAttachments, cniTypes.GCAttachment{ContainerID: containerID, IfName: "eth0"})
+		}
+		b, err := json.Marshal(netConf)
+		if err != nil {
+			panic(err)
+		}
+		return b
 	}
+
+	tests := []scenario{
+		{
+			name: "Happy CNI GC",
+			args: buildArgs("", "", gcNetConf("happyArgsSingle", "happyArgsDual")),
+		},
+		{
+			name:    "Fail request CNS GC",
+			args:    buildArgs("", "", gcNetConf()),
+			wantErr: true,
+		},
+		{
+			name:    "Fail to parse CNI GC network config",
+			args:    buildArgs("", "", []byte("invalidNetConf")),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			mockCNSClient := &MockCNSClient{}
+			testLogger, cleanup, err := logger.New(loggerCfg)
+			if err != nil {
+				return
+			}
+			defer cleanup()
+			ipamPlugin, _ := NewPlugin(testLogger, mockCNSClient, nil)
+			err = ipamPlugin.CmdGC(tt.args)
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+// unreachableCNSClient fails the IP requests like a CNS which isn't listening.
+type unreachableCNSClient struct {
+	MockCNSClient
+	cns *client.Client
+}
+
+func (c *unreachableCNSClient) RequestIPs(ctx context.Context, ipconfig cns.IPConfigsRequest) (*cns.IPConfigsResponse, error) {
+	return c.cns.RequestIPs(ctx, ipconfig) //nolint:wrapcheck // mock
+}
+
+func (c *unreachableCNSClient) ReleaseIPs(ctx context.Context, ipconfig cns.IPConfigsRequest) error {
+	return c.cns.ReleaseIPs(ctx, ipconfig) //nolint:wrapcheck // mock
+}
+
+func TestCmdAddDelWithLease(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	cnsClient, err := client.New(srv.URL, time.Second)
+	require.NoError(t, err)
+
+	netConf, err := json.Marshal(&cniTypes.NetConf{CNIVersion: "1.0.0", Name: "happynetconf"})
+	require.NoError(t, err)
+	testLogger, cleanup, err := logger.New(loggerCfg)
+	require.NoError(t, err)
 	defer cleanup()
-	ipamPlugin, _ := NewPlugin(testLogger, mockCNSClient, nil)
-	err = ipamPlugin.CmdCheck(nil)
+	writer := &cniResultsWriter{}
+	ipamPlugin, _ := NewPlugin(testLogger, &unreachableCNSClient{cns: cnsClient}, writer)
+	ipamPlugin.leases = lease.New(filepath.Join(t.TempDir(), "ipleases.json"))
+
+	// without leases the error of the request to CNS is returned
+	require.Error(t, ipamPlugin.CmdAdd(buildArgs("leaseArgs", happyPodArgs, netConf)))
+
+	require.NoError(t, ipamPlugin.leases.Update(func([]lease.Lease) ([]lease.Lease, error) {
+		return []lease.Lease{{
+			ID: "1",
+			PodIPInfo: []cns.PodIpInfo{{
+				PodIPConfig: cns.IPSubnet{IPAddress: "10.0.1.20", PrefixLength: 24},
+				NetworkContainerPrimaryIPConfig: cns.IPConfiguration{
+					IPSubnet:         cns.IPSubnet{IPAddress: "10.0.1.0", PrefixLength: 24},
+					GatewayIPAddress: "10.0.0.1",
+				},
+				HostPrimaryIPInfo: cns.HostIPInfo{Gateway: "10.0.0.1", PrimaryIP: "10.0.0.1", Subnet: "10.0.0.0/24"},
+			}},
+		}}, nil
+	}))
+	require.NoError(t, ipamPlugin.CmdAdd(buildArgs("leaseArgs", happyPodArgs, netConf)))
+	require.Len(t, writer.result.IPs, 1)
+	require.Equal(t, "10.0.1.20/24", writer.result.IPs[0].Address.String())
+
+	// the lease is released instead of queueing the container for CNS to release its IPs
+	require.NoError(t, ipamPlugin.CmdDel(buildArgs("leaseArgs", happyPodArgs, netConf)))
+	require.NoError(t, ipamPlugin.leases.Update(func(leases []lease.Lease) ([]lease.Lease, error) {
+		require.True(t, leases[0].Consumer.Released)
+		return leases, nil
+	}))
+}
+
+func TestCmdDelReleasesLease(t *testing.T) {
+	netConf, err := json.Marshal(&cniTypes.NetConf{CNIVersion: "1.0.0", Name: "happynetconf"})
 	require.NoError(t, err)
+	testLogger, cleanup, err := logger.New(loggerCfg)
+	require.NoError(t, err)
+	defer cleanup()
+
+	tests := []struct {
+		name        string
+		containerID string
+	}{
+		{name: "CNS releases the IPs", containerID: "leaseArgs"},
+		{name: "CNS releases the IPs using ReleaseIPAddress", containerID: "happyArgsSingle"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipamPlugin, _ := NewPlugin(testLogger, &MockCNSClient{}, nil)
+			ipamPlugin.leases = lease.New(filepath.Join(t.TempDir(), "ipleases.json"))
+			require.NoError(t, ipamPlugin.leases.Update(func([]lease.Lease) ([]lease.Lease, error) {
+				return []lease.Lease{{ID: "1", Consumer: &lease.Consumer{InfraContainerID: tt.containerID}}}, nil
+			}))
+
+			// the lease consumed while CNS was unreachable is released even though CNS answers, so CNS never
+			// adopts it for the deleted pod
+			require.NoError(t, ipamPlugin.CmdDel(buildArgs(tt.containerID, happyPodArgs, netConf)))
+			require.NoError(t, ipamPlugin.leases.Update(func(leases []lease.Lease) ([]lease.Lease, error) {
+				require.True(t, leases[0].Consumer.Released)
+				return leases, nil
+			}))
+		})
+	}
 }
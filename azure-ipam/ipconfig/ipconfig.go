@@ -14,6 +14,8 @@ import (
 
 const (
 	defaultV6Gateway = "fe80::1234:5678:9abc"
+	// Owner marks the IPs which azure-ipam requests from CNS, so that its GC only releases those
+	Owner = "azure-ipam"
 )
 
 func CreateOrchestratorContext(args *cniSkel.CmdArgs) ([]byte, error) {
@@ -46,6 +48,7 @@ func CreateIPConfigReq(args *cniSkel.CmdArgs) (cns.IPConfigRequest, error) {
 		InfraContainerID:    args.ContainerID,
 		OrchestratorContext: orchestratorContext,
 		Ifname:              args.IfName,
+		Owner:               Owner,
 	}
 
 	return req, nil
@@ -63,6 +66,7 @@ func CreateIPConfigsReq(args *cniSkel.CmdArgs) (cns.IPConfigsRequest, error) {
 		InfraContainerID:    args.ContainerID,
 		OrchestratorContext: orchestratorContext,
 		Ifname:              args.IfName,
+		Owner:               Owner,
 	}
 
 	return req, nil
@@ -0,0 +1,146 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+// Map layouts shared with npm/pkg/dataplane/bpf/types.go. Keep both in sync.
+
+#ifndef __NPM_POLICY_H__
+#define __NPM_POLICY_H__
+
+#define NPM_MAX_PEERS 8
+#define NPM_MAX_RULES_PER_DIRECTION 256
+
+#define NPM_DIRECTION_INGRESS 0
+#define NPM_DIRECTION_EGRESS 1
+
+#define NPM_TIER_ADMIN 0
+#define NPM_TIER_NETWORK_POLICY 1
+#define NPM_TIER_BASELINE 2
+
+#define NPM_TARGET_ALLOW 0
+#define NPM_TARGET_DENY 1
+#define NPM_TARGET_PASS 2
+
+#define NPM_PEER_KIND_HASH 0
+#define NPM_PEER_KIND_CIDR 1
+#define NPM_PEER_KIND_NAMED_PORT 2
+
+#define NPM_PEER_MATCH_SRC 0
+#define NPM_PEER_MATCH_DST 1
+
+#define NPM_PROTOCOL_ANY 0
+
+#define NPM_FLOW_NEW 0
+#define NPM_FLOW_ESTABLISHED 1
+#define NPM_FLOW_CLOSING 2
+
+#define NPM_NSEC_PER_SEC 1000000000ULL
+// flows expire after being idle for the timeout of their state. Established TCP flows use the conntrack default.
+#define NPM_FLOW_NEW_TIMEOUT_NS (60 * NPM_NSEC_PER_SEC)
+#define NPM_FLOW_ESTABLISHED_TIMEOUT_NS (120 * NPM_NSEC_PER_SEC)
+#define NPM_FLOW_TCP_ESTABLISHED_TIMEOUT_NS (5 * 24 * 3600 * NPM_NSEC_PER_SEC)
+#define NPM_FLOW_CLOSING_TIMEOUT_NS (120 * NPM_NSEC_PER_SEC)
+// the first fragment of a datagram lets the others through for the default ipfrag_time
+#define NPM_FRAGMENT_TIMEOUT_NS (30 * NPM_NSEC_PER_SEC)
+
+#define NPM_TCP_FIN 0x01
+#define NPM_TCP_SYN 0x02
+#define NPM_TCP_RST 0x04
+#define NPM_TCP_ACK 0x10
+
+// 32 bits of the set ID precede the address in CIDR keys
+#define NPM_CIDR_SET_ID_BITS 32
+
+struct set_member_key {
+    __u32 set_id;
+    __u8 ip[4];
+};
+
+struct cidr_key {
+    __u32 prefix_len;
+    // big endian so that the set ID is part of the prefix
+    __be32 set_id;
+    __u8 ip[4];
+};
+
+struct named_port_key {
+    __u32 set_id;
+    __u8 ip[4];
+    __u16 port;
+    __u8 protocol;
+    __u8 pad;
+};
+
+struct endpoint_key {
+    __u8 ip[4];
+};
+
+// endpoint_info points at the rules of the endpoint in one of two slots.
+// NPM writes changed rules into the other slot and then switches the slot, so a packet never sees a mix of old and new rules.
+struct endpoint_info {
+    __u16 rule_count[2];
+    // 1 if a NetworkPolicy selects the endpoint in the direction
+    __u8 isolated[2];
+    __u8 slot;
+    __u8 pad;
+};
+
+struct rule_key {
+    __u8 ip[4];
+    __u16 index;
+    __u8 direction;
+    __u8 slot;
+};
+
+struct peer {
+    __u32 set_id;
+    __u8 kind;
+    __u8 match;
+    __u8 included;
+    __u8 pad;
+};
+
+struct rule {
+    __u32 policy_id;
+    __u16 port_start;
+    __u16 port_end;
+    __u8 tier;
+    __u8 target;
+    __u8 protocol;
+    __u8 peer_count;
+    struct peer peers[NPM_MAX_PEERS];
+};
+
+// flow_key identifies an allowed flow in the direction it was evaluated in
+struct flow_key {
+    __u8 src[4];
+    __u8 dst[4];
+    __u16 src_port;
+    __u16 dst_port;
+    __u8 protocol;
+    __u8 direction;
+    __u8 pad[2];
+};
+
+// flow_value is the state of an allowed flow.
+// generation is the policy generation which allowed the flow. NPM increments it on every apply, so older flows are evaluated again.
+struct flow_value {
+    __u64 last_seen_ns;
+    __u32 generation;
+    __u8 state;
+    __u8 pad[3];
+};
+
+// fragment_key identifies an IPv4 datagram whose first fragment was allowed, in the direction it was evaluated in
+struct fragment_key {
+    __u8 src[4];
+    __u8 dst[4];
+    __u16 id;
+    __u8 protocol;
+    __u8 direction;
+};
+
+struct fragment_value {
+    __u64 last_seen_ns;
+};
+
+#endif // __NPM_POLICY_H__
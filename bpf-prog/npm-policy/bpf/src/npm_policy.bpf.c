@@ -0,0 +1,460 @@
+//go:build ignore
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+// NetworkPolicy enforcement for the NPM BPF dataplane (npm/pkg/dataplane/bpf).
+// npm_from_pod runs on tcx ingress of a pod's host interface and evaluates the egress rules of the source pod.
+// npm_to_pod runs on tcx egress of the interface and evaluates the ingress rules of the destination pod.
+// NPM writes the maps; the program only reads them, except for the flows and fragments it allowed.
+// The rules only match IPv4, so IPv6 packets are dropped in the directions which NetworkPolicies isolate the pod in.
+
+#include "vmlinux.h"
+#include <bpf/bpf_helpers.h>
+#include <bpf/bpf_endian.h>
+#include <stdbool.h>
+#include "npm_policy.h"
+
+#define TC_ACT_OK 0
+#define TC_ACT_SHOT 2
+#define ETH_P_IP 0x0800
+#define ETH_P_IPV6 0x86DD
+#define IPPROTO_TCP 6
+#define IPPROTO_UDP 17
+#define IPPROTO_SCTP 132
+#define IP_MF 0x2000
+#define IP_OFFSET 0x1FFF
+
+char __license[] SEC("license") = "Dual MIT/GPL";
+
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, 262144);
+    __type(key, struct set_member_key);
+    __type(value, __u8);
+} set_members SEC(".maps");
+
+struct {
+    __uint(type, BPF_MAP_TYPE_LPM_TRIE);
+    __uint(max_entries, 65536);
+    __uint(map_flags, BPF_F_NO_PREALLOC);
+    __type(key, struct cidr_key);
+    __type(value, __u8);
+} cidr_members SEC(".maps");
+
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, 65536);
+    __type(key, struct named_port_key);
+    __type(value, __u8);
+} named_port_members SEC(".maps");
+
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, 4096);
+    __type(key, struct endpoint_key);
+    __type(value, struct endpoint_info);
+} endpoints SEC(".maps");
+
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, 131072);
+    __type(key, struct rule_key);
+    __type(value, struct rule);
+} rules SEC(".maps");
+
+// flows lets replies and later packets of allowed flows through without evaluating the rules again
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __uint(max_entries, 65536);
+    __type(key, struct flow_key);
+    __type(value, struct flow_value);
+} flows SEC(".maps");
+
+// fragments lets the non-first fragments of allowed datagrams through, since only the first fragment has the ports
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __uint(max_entries, 16384);
+    __type(key, struct fragment_key);
+    __type(value, struct fragment_value);
+} fragments SEC(".maps");
+
+// interfaces maps the index of a pod's host interface to the pod's endpoint, for packets which have no IPv4 header
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, 4096);
+    __type(key, __u32);
+    __type(value, struct endpoint_key);
+} interfaces SEC(".maps");
+
+// generation holds the current policy generation at index 0
+struct {
+    __uint(type, BPF_MAP_TYPE_ARRAY);
+    __uint(max_entries, 1);
+    __type(key, __u32);
+    __type(value, __u32);
+} generation SEC(".maps");
+
+struct packet {
+    __u8 src[4];
+    __u8 dst[4];
+    __u16 src_port;
+    __u16 dst_port;
+    __u8 protocol;
+    // flags of TCP packets
+    __u8 tcp_flags;
+    // the IP ID and fragment flags of fragments
+    __u16 id;
+    bool later_fragment;
+    bool more_fragments;
+};
+
+enum packet_kind {
+    PACKET_OTHER,
+    PACKET_IPV4,
+    PACKET_IPV6,
+};
+
+static __always_inline void copy_ip(__u8 *dst, const __u8 *src)
+{
+    dst[0] = src[0];
+    dst[1] = src[1];
+    dst[2] = src[2];
+    dst[3] = src[3];
+}
+
+// parse_packet only fills in the packet for IPv4. Ports are in host byte order, and 0 for non-first fragments.
+static __always_inline enum packet_kind parse_packet(struct __sk_buff *skb, struct packet *pkt)
+{
+    void *data = (void *)(long)skb->data;
+    void *data_end = (void *)(long)skb->data_end;
+
+    struct ethhdr *eth = data;
+    if ((void *)(eth + 1) > data_end)
+        return PACKET_OTHER;
+    if (eth->h_proto == bpf_htons(ETH_P_IPV6))
+        return PACKET_IPV6;
+    if (eth->h_proto != bpf_htons(ETH_P_IP))
+        return PACKET_OTHER;
+
+    struct iphdr *iph = (void *)(eth + 1);
+    if ((void *)(iph + 1) > data_end)
+        return PACKET_OTHER;
+
+    __builtin_memcpy(pkt->src, &iph->saddr, sizeof(pkt->src));
+    __builtin_memcpy(pkt->dst, &iph->daddr, sizeof(pkt->dst));
+    pkt->protocol = iph->protocol;
+    pkt->src_port = 0;
+    pkt->dst_port = 0;
+    pkt->tcp_flags = 0;
+    pkt->id = bpf_ntohs(iph->id);
+    pkt->later_fragment = (iph->frag_off & bpf_htons(IP_OFFSET)) != 0;
+    pkt->more_fragments = (iph->frag_off & bpf_htons(IP_MF)) != 0;
+
+    if (pkt->later_fragment)
+        return PACKET_IPV4;
+
+    // TCP, UDP, and SCTP headers all start with the source and destination ports
+    if (iph->protocol == IPPROTO_TCP || iph->protocol == IPPROTO_UDP || iph->protocol == IPPROTO_SCTP) {
+        __be16 *ports = (void *)iph + iph->ihl * 4;
+        if ((void *)(ports + 2) > data_end)
+            return PACKET_IPV4;
+        pkt->src_port = bpf_ntohs(ports[0]);
+        pkt->dst_port = bpf_ntohs(ports[1]);
+    }
+    if (iph->protocol == IPPROTO_TCP) {
+        // the flags are the 14th byte of the TCP header
+        __u8 *flags = (void *)iph + iph->ihl * 4 + 13;
+        if ((void *)(flags + 1) > data_end)
+            return PACKET_IPV4;
+        pkt->tcp_flags = *flags;
+    }
+    return PACKET_IPV4;
+}
+
+static __always_inline bool in_cidrs(__u32 set_id, const __u8 *ip)
+{
+    struct cidr_key key = {
+        .prefix_len = NPM_CIDR_SET_ID_BITS + 32,
+        .set_id = bpf_htonl(set_id),
+    };
+    copy_ip(key.ip, ip);
+
+    // nomatch entries have the value 0
+    __u8 *match = bpf_map_lookup_elem(&cidr_members, &key);
+    return match && *match;
+}
+
+static __always_inline bool is_member(const struct peer *peer, const struct packet *pkt)
+{
+    const __u8 *ip = peer->match == NPM_PEER_MATCH_SRC ? pkt->src : pkt->dst;
+
+    if (peer->kind == NPM_PEER_KIND_CIDR)
+        return in_cidrs(peer->set_id, ip);
+
+    if (peer->kind == NPM_PEER_KIND_NAMED_PORT) {
+        struct named_port_key key = {
+            .set_id = peer->set_id,
+            .port = pkt->dst_port,
+            .protocol = pkt->protocol,
+        };
+        copy_ip(key.ip, pkt->dst);
+        return bpf_map_lookup_elem(&named_port_members, &key) != NULL;
+    }
+
+    struct set_member_key key = {.set_id = peer->set_id};
+    copy_ip(key.ip, ip);
+    return bpf_map_lookup_elem(&set_members, &key) != NULL;
+}
+
+static __always_inline bool matches(const struct rule *rule, const struct packet *pkt)
+{
+    if (rule->protocol != NPM_PROTOCOL_ANY && rule->protocol != pkt->protocol)
+        return false;
+    if (rule->port_start != 0 && (pkt->dst_port < rule->port_start || pkt->dst_port > rule->port_end))
+        return false;
+
+    for (int i = 0; i < NPM_MAX_PEERS; i++) {
+        if (i >= rule->peer_count)
+            break;
+        if (is_member(&rule->peers[i], pkt) != (rule->peers[i].included != 0))
+            return false;
+    }
+    return true;
+}
+
+// npm_evaluate returns true if the rules of the endpoint allow the packet in the direction.
+// npm/pkg/dataplane/bpf/verdict.go mirrors it for tests. Keep both in sync.
+// It isn't inlined since npm_filter evaluates both the packet and the request of a reply.
+static __noinline bool npm_evaluate(const __u8 *endpoint, __u8 direction, const struct packet *pkt)
+{
+    struct endpoint_key ep_key = {};
+    copy_ip(ep_key.ip, endpoint);
+
+    struct endpoint_info *value = bpf_map_lookup_elem(&endpoints, &ep_key);
+    if (!value)
+        return true;
+    // the rule count and the slot must come from the same update
+    struct endpoint_info info = *value;
+
+    __u16 rule_count = direction == NPM_DIRECTION_INGRESS ? info.rule_count[0] : info.rule_count[1];
+    bool isolated = (direction == NPM_DIRECTION_INGRESS ? info.isolated[0] : info.isolated[1]) != 0;
+    bool passed = false;
+    __u32 skip_policy = 0;
+
+    struct rule_key key = {.direction = direction, .slot = info.slot};
+    copy_ip(key.ip, endpoint);
+
+    for (__u16 i = 0; i < NPM_MAX_RULES_PER_DIRECTION; i++) {
+        if (i >= rule_count)
+            break;
+        key.index = i;
+        struct rule *rule = bpf_map_lookup_elem(&rules, &key);
+        if (!rule)
+            continue;
+        if (rule->tier == NPM_TIER_ADMIN && passed)
+            continue;
+        // NetworkPolicies decided the flow
+        if (rule->tier == NPM_TIER_BASELINE && isolated)
+            break;
+        if (rule->policy_id == skip_policy || !matches(rule, pkt))
+            continue;
+
+        if (rule->tier != NPM_TIER_NETWORK_POLICY) {
+            if (rule->target == NPM_TARGET_ALLOW)
+                return true;
+            if (rule->target == NPM_TARGET_DENY)
+                return false;
+            passed = true;
+            continue;
+        }
+        // NetworkPolicies are additive, but the first matching rule decides the policy's verdict
+        if (rule->target == NPM_TARGET_ALLOW)
+            return true;
+        skip_policy = rule->policy_id;
+    }
+    return !isolated;
+}
+
+static __always_inline __u32 current_generation(void)
+{
+    __u32 key = 0;
+    __u32 *value = bpf_map_lookup_elem(&generation, &key);
+    return value ? *value : 0;
+}
+
+static __always_inline bool flow_live(const struct flow_value *value, __u8 protocol, __u64 now)
+{
+    __u64 timeout = NPM_FLOW_ESTABLISHED_TIMEOUT_NS;
+    if (value->state == NPM_FLOW_NEW)
+        timeout = NPM_FLOW_NEW_TIMEOUT_NS;
+    else if (value->state == NPM_FLOW_CLOSING)
+        timeout = NPM_FLOW_CLOSING_TIMEOUT_NS;
+    else if (protocol == IPPROTO_TCP)
+        timeout = NPM_FLOW_TCP_ESTABLISHED_TIMEOUT_NS;
+    return now - value->last_seen_ns <= timeout;
+}
+
+// track_flow updates the state of the flow with a packet which it let through
+static __always_inline int track_flow(struct flow_key *key, struct flow_value *value, const struct packet *pkt, bool reply, __u64 now)
+{
+    value->last_seen_ns = now;
+    if (pkt->tcp_flags & NPM_TCP_RST) {
+        bpf_map_delete_elem(&flows, key);
+        return TC_ACT_OK;
+    }
+    if (pkt->tcp_flags & NPM_TCP_FIN)
+        value->state = NPM_FLOW_CLOSING;
+    else if (reply && value->state == NPM_FLOW_NEW)
+        value->state = NPM_FLOW_ESTABLISHED;
+    return TC_ACT_OK;
+}
+
+// filter_flow lets a packet through if it belongs to a flow which is allowed in the current generation, or if the rules allow it.
+// Only a TCP SYN without ACK starts a TCP flow, and it never matches a flow, so packets shaped like replies can't get around the rules.
+// Other TCP packets which the rules allow are tracked as established, so that flows survive a restart of NPM.
+static __always_inline int filter_flow(const struct packet *pkt, __u8 direction, __u64 now)
+{
+    __u32 current = current_generation();
+    bool tcp = pkt->protocol == IPPROTO_TCP;
+    bool syn = tcp && (pkt->tcp_flags & (NPM_TCP_SYN | NPM_TCP_ACK)) == NPM_TCP_SYN;
+
+    struct flow_key flow = {
+        .src_port = pkt->src_port,
+        .dst_port = pkt->dst_port,
+        .protocol = pkt->protocol,
+        .direction = direction,
+    };
+    copy_ip(flow.src, pkt->src);
+    copy_ip(flow.dst, pkt->dst);
+
+    __u8 state = tcp && !syn ? NPM_FLOW_ESTABLISHED : NPM_FLOW_NEW;
+    if (!syn) {
+        struct flow_value *value = bpf_map_lookup_elem(&flows, &flow);
+        if (value && flow_live(value, pkt->protocol, now)) {
+            if (value->generation == current)
+                return track_flow(&flow, value, pkt, false, now);
+            // the rules changed since the flow was allowed, so the packet is evaluated below
+            state = value->state;
+        }
+
+        // a reply is evaluated in the opposite direction of its request
+        struct flow_key reply = {
+            .src_port = pkt->dst_port,
+            .dst_port = pkt->src_port,
+            .protocol = pkt->protocol,
+            .direction = direction == NPM_DIRECTION_INGRESS ? NPM_DIRECTION_EGRESS : NPM_DIRECTION_INGRESS,
+        };
+        copy_ip(reply.src, pkt->dst);
+        copy_ip(reply.dst, pkt->src);
+        value = bpf_map_lookup_elem(&flows, &reply);
+        if (value && flow_live(value, pkt->protocol, now)) {
+            if (value->generation == current)
+                return track_flow(&reply, value, pkt, true, now);
+
+            // the rules changed since the request was allowed, so check that they still allow it
+            struct packet request = {
+                .src_port = pkt->dst_port,
+                .dst_port = pkt->src_port,
+                .protocol = pkt->protocol,
+            };
+            copy_ip(request.src, pkt->dst);
+            copy_ip(request.dst, pkt->src);
+            const __u8 *request_endpoint = reply.direction == NPM_DIRECTION_INGRESS ? request.dst : request.src;
+            if (npm_evaluate(request_endpoint, reply.direction, &request)) {
+                value->generation = current;
+                return track_flow(&reply, value, pkt, true, now);
+            }
+            bpf_map_delete_elem(&flows, &reply);
+        }
+    }
+
+    const __u8 *endpoint = direction == NPM_DIRECTION_INGRESS ? pkt->dst : pkt->src;
+    if (!npm_evaluate(endpoint, direction, pkt)) {
+        bpf_map_delete_elem(&flows, &flow);
+        return TC_ACT_SHOT;
+    }
+    if (pkt->tcp_flags & NPM_TCP_RST) {
+        bpf_map_delete_elem(&flows, &flow);
+        return TC_ACT_OK;
+    }
+    if (pkt->tcp_flags & NPM_TCP_FIN)
+        state = NPM_FLOW_CLOSING;
+
+    struct flow_value value = {
+        .last_seen_ns = now,
+        .generation = current,
+        .state = state,
+    };
+    bpf_map_update_elem(&flows, &flow, &value, BPF_ANY);
+    return TC_ACT_OK;
+}
+
+// filter_ipv6 drops the IPv6 packets of a pod which is isolated in the direction, since the rules can't match them.
+static __always_inline int filter_ipv6(struct __sk_buff *skb, __u8 direction)
+{
+    __u32 ifindex = skb->ifindex;
+    struct endpoint_key *ep_key = bpf_map_lookup_elem(&interfaces, &ifindex);
+    if (!ep_key)
+        return TC_ACT_OK;
+    struct endpoint_info *info = bpf_map_lookup_elem(&endpoints, ep_key);
+    if (!info)
+        return TC_ACT_OK;
+
+    __u8 isolated = direction == NPM_DIRECTION_INGRESS ? info->isolated[0] : info->isolated[1];
+    return isolated ? TC_ACT_SHOT : TC_ACT_OK;
+}
+
+// npm_filter lets the non-first fragments of a datagram through if its first fragment was allowed in the direction.
+// Fragments of other datagrams are evaluated without ports.
+// npm/pkg/dataplane/bpf/verdict.go mirrors it for tests. Keep both in sync.
+static __always_inline int npm_filter(struct __sk_buff *skb, __u8 direction)
+{
+    struct packet pkt = {};
+    enum packet_kind kind = parse_packet(skb, &pkt);
+    if (kind == PACKET_IPV6)
+        return filter_ipv6(skb, direction);
+    if (kind != PACKET_IPV4)
+        return TC_ACT_OK;
+
+    __u64 now = bpf_ktime_get_ns();
+    struct fragment_key frag = {
+        .id = pkt.id,
+        .protocol = pkt.protocol,
+        .direction = direction,
+    };
+    copy_ip(frag.src, pkt.src);
+    copy_ip(frag.dst, pkt.dst);
+
+    if (pkt.later_fragment) {
+        struct fragment_value *value = bpf_map_lookup_elem(&fragments, &frag);
+        if (value && now - value->last_seen_ns <= NPM_FRAGMENT_TIMEOUT_NS) {
+            if (pkt.more_fragments)
+                value->last_seen_ns = now;
+            else
+                bpf_map_delete_elem(&fragments, &frag);
+            return TC_ACT_OK;
+        }
+        const __u8 *endpoint = direction == NPM_DIRECTION_INGRESS ? pkt.dst : pkt.src;
+        return npm_evaluate(endpoint, direction, &pkt) ? TC_ACT_OK : TC_ACT_SHOT;
+    }
+
+    int verdict = filter_flow(&pkt, direction, now);
+    if (verdict == TC_ACT_OK && pkt.more_fragments) {
+        struct fragment_value value = {.last_seen_ns = now};
+        bpf_map_update_elem(&fragments, &frag, &value, BPF_ANY);
+    }
+    return verdict;
+}
+
+SEC("tcx/ingress")
+int npm_from_pod(struct __sk_buff *skb)
+{
+    return npm_filter(skb, NPM_DIRECTION_EGRESS);
+}
+
+SEC("tcx/egress")
+int npm_to_pod(struct __sk_buff *skb)
+{
+    return npm_filter(skb, NPM_DIRECTION_INGRESS);
+}
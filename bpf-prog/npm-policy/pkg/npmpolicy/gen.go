@@ -0,0 +1,3 @@
+package npmpolicy
+
+//go:generate go run github.com/cilium/ebpf/cmd/bpf2go -target bpfel,bpfeb NpmPolicy ../../bpf/src/npm_policy.bpf.c -- -I../../bpf/include -I../../../azure-block-iptables/bpf/include
@@ -12,10 +12,12 @@ import (
 	"github.com/Azure/azure-container-networking/cns"
 	cnscli "github.com/Azure/azure-container-networking/cns/client"
 	"github.com/Azure/azure-container-networking/cns/fsnotify"
+	"github.com/Azure/azure-container-networking/cns/lease"
 	"github.com/Azure/azure-container-networking/iptables"
 	"github.com/Azure/azure-container-networking/network"
 	"github.com/Azure/azure-container-networking/network/networkutils"
 	"github.com/Azure/azure-container-networking/network/policy"
+	"github.com/Azure/azure-container-networking/nftables"
 	cniSkel "github.com/containernetworking/cni/pkg/skel"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
@@ -41,6 +43,10 @@ type CNSIPAMInvoker struct {
 	cnsClient     cnsclient
 	executionMode util.ExecutionMode
 	ipamMode      util.IpamMode
+	// ctx carries the trace of the CNI invocation, the CNS client propagates it to CNS
+	ctx context.Context
+	// leases are the IPs CNS pre-leased, which are assigned to pods while CNS is unreachable
+	leases *lease.Cache
 }
 
 type IPResultInfo struct {
@@ -81,9 +87,17 @@ func NewCNSInvoker(podName, namespace string, cnsClient cnsclient, executionMode
 		cnsClient:     cnsClient,
 		executionMode: executionMode,
 		ipamMode:      ipamMode,
+		leases:        lease.New(lease.DefaultPath),
 	}
 }
 
+func (invoker *CNSIPAMInvoker) context() context.Context {
+	if invoker.ctx == nil {
+		return context.Background()
+	}
+	return invoker.ctx
+}
+
 // Add uses the requestipconfig API in cns, and returns ipv4 and a nil ipv6 as CNS doesn't support IPv6 yet
 func (invoker *CNSIPAMInvoker) Add(addConfig IPAMAddConfig) (IPAMAddResult, error) {
 	// Parse Pod arguments.
@@ -111,7 +125,7 @@ func (invoker *CNSIPAMInvoker) Add(addConfig IPAMAddConfig) (IPAMAddResult, erro
 	logger.Info("Requesting IP for pod using ipconfig",
 		zap.Any("pod", podInfo),
 		zap.Any("ipconfig", ipconfigs))
-	response, err := invoker.cnsClient.RequestIPs(context.TODO(), ipconfigs)
+	response, err := invoker.cnsClient.RequestIPs(invoker.context(), ipconfigs)
 	if err != nil {
 		if cnscli.IsUnsupportedAPI(err) {
 			// If RequestIPs is not supported by CNS, use RequestIPAddress API
@@ -123,7 +137,7 @@ func (invoker *CNSIPAMInvoker) Add(addConfig IPAMAddConfig) (IPAMAddResult, erro
 				InfraContainerID:    addConfig.args.ContainerID,
 			}
 
-			res, errRequestIP := invoker.cnsClient.RequestIPAddress(context.TODO(), ipconfig)
+			res, errRequestIP := invoker.cnsClient.RequestIPAddress(invoker.context(), ipconfig)
 			if errRequestIP != nil {
 				// if the old API fails as well then we just return the error
 				logger.Error("Failed to request IP address from CNS using RequestIPAddress",
@@ -137,7 +151,7 @@ func (invoker *CNSIPAMInvoker) Add(addConfig IPAMAddConfig) (IPAMAddResult, erro
 					res.PodIpInfo,
 				},
 			}
-		} else {
+		} else if response, err = cnscli.ConsumeLease(invoker.leases, ipconfigs, err, logger); err != nil {
 			logger.Info("Failed to get IP address from CNS",
 				zap.Any("response", response))
 			return IPAMAddResult{}, errors.Wrap(err, "Failed to get IP address from CNS")
@@ -227,7 +241,7 @@ func (invoker *CNSIPAMInvoker) Add(addConfig IPAMAddConfig) (IPAMAddResult, erro
 	return addResult, nil
 }
 
-func setHostOptions(ncSubnetPrefix *net.IPNet, options map[string]interface{}, info *IPResultInfo) error {
+func setHostRoutes(ncSubnetPrefix *net.IPNet, options map[string]interface{}, info *IPResultInfo) error {
 	// get the host ip
 	hostIP := net.ParseIP(info.hostPrimaryIP)
 	if hostIP == nil {
@@ -248,37 +262,54 @@ func setHostOptions(ncSubnetPrefix *net.IPNet, options map[string]interface{}, i
 		},
 	}
 
-	azureDNSUDPMatch := fmt.Sprintf(" -m addrtype ! --dst-type local -s %s -d %s -p %s --dport %d", ncSubnetPrefix.String(), networkutils.AzureDNS, iptables.UDP, iptables.DNSPort)
-	azureDNSTCPMatch := fmt.Sprintf(" -m addrtype ! --dst-type local -s %s -d %s -p %s --dport %d", ncSubnetPrefix.String(), networkutils.AzureDNS, iptables.TCP, iptables.DNSPort)
-	azureIMDSMatch := fmt.Sprintf(" -m addrtype ! --dst-type local -s %s -d %s -p %s --dport %d", ncSubnetPrefix.String(), networkutils.AzureIMDS, iptables.TCP, iptables.HTTPPort)
-
-	snatPrimaryIPJump := fmt.Sprintf("%s --to %s", iptables.Snat, info.ncPrimaryIP)
-	// we need to snat IMDS traffic to node IP, this sets up snat '--to'
-	snatHostIPJump := fmt.Sprintf("%s --to %s", iptables.Snat, info.hostPrimaryIP)
+	return nil
+}
 
-	iptablesClient := iptables.NewClient()
-	var iptableCmds []iptables.IPTableEntry
-	if !iptablesClient.ChainExists(iptables.V4, iptables.Nat, iptables.Swift) {
-		iptableCmds = append(iptableCmds, iptablesClient.GetCreateChainCmd(iptables.V4, iptables.Nat, iptables.Swift))
+// setHostOptionsNftables sets the host routes and the azure-cni nftables SNAT endpoint for the NC subnet
+func setHostOptionsNftables(ncSubnetPrefix *net.IPNet, options map[string]interface{}, info *IPResultInfo) error {
+	if err := setHostRoutes(ncSubnetPrefix, options, info); err != nil {
+		return err
 	}
 
-	if !iptablesClient.RuleExists(iptables.V4, iptables.Nat, iptables.Postrouting, "", iptables.Swift) {
-		iptableCmds = append(iptableCmds, iptablesClient.GetAppendIptableRuleCmd(iptables.V4, iptables.Nat, iptables.Postrouting, "", iptables.Swift))
+	ncPrimaryIP := net.ParseIP(info.ncPrimaryIP)
+	if ncPrimaryIP == nil {
+		return fmt.Errorf("NC primary IP address %v from response is invalid", info.ncPrimaryIP)
 	}
 
-	if !iptablesClient.RuleExists(iptables.V4, iptables.Nat, iptables.Swift, azureDNSUDPMatch, snatPrimaryIPJump) {
-		iptableCmds = append(iptableCmds, iptablesClient.GetInsertIptableRuleCmd(iptables.V4, iptables.Nat, iptables.Swift, azureDNSUDPMatch, snatPrimaryIPJump))
+	options[network.NftablesSnatKey] = nftables.SnatEndpoint{
+		Owner:      nftables.OwnerCNI,
+		Subnet:     *ncSubnetPrefix,
+		DNSSnatIP:  ncPrimaryIP,
+		IMDSSnatIP: net.ParseIP(info.hostPrimaryIP),
 	}
 
-	if !iptablesClient.RuleExists(iptables.V4, iptables.Nat, iptables.Swift, azureDNSTCPMatch, snatPrimaryIPJump) {
-		iptableCmds = append(iptableCmds, iptablesClient.GetInsertIptableRuleCmd(iptables.V4, iptables.Nat, iptables.Swift, azureDNSTCPMatch, snatPrimaryIPJump))
-	}
+	return nil
+}
 
-	if !iptablesClient.RuleExists(iptables.V4, iptables.Nat, iptables.Swift, azureIMDSMatch, snatHostIPJump) {
-		iptableCmds = append(iptableCmds, iptablesClient.GetInsertIptableRuleCmd(iptables.V4, iptables.Nat, iptables.Swift, azureIMDSMatch, snatHostIPJump))
+func setHostOptions(ncSubnetPrefix *net.IPNet, options map[string]interface{}, info *IPResultInfo) error {
+	if err := setHostRoutes(ncSubnetPrefix, options, info); err != nil {
+		return err
 	}
 
-	options[network.IPTablesKey] = iptableCmds
+	azureDNSUDPMatch := fmt.Sprintf(" -m addrtype ! --dst-type local -s %s -d %s -p %s --dport %d", ncSubnetPrefix.String(), networkutils.AzureDNS, iptables.UDP, iptables.DNSPort)
+	azureDNSTCPMatch := fmt.Sprintf(" -m addrtype ! --dst-type local -s %s -d %s -p %s --dport %d", ncSubnetPrefix.String(), networkutils.AzureDNS, iptables.TCP, iptables.DNSPort)
+	azureIMDSMatch := fmt.Sprintf(" -m addrtype ! --dst-type local -s %s -d %s -p %s --dport %d", ncSubnetPrefix.String(), networkutils.AzureIMDS, iptables.TCP, iptables.HTTPPort)
+
+	snatPrimaryIPJump := fmt.Sprintf("%s --to %s", iptables.Snat, info.ncPrimaryIP)
+	// we need to snat IMDS traffic to node IP, this sets up snat '--to'
+	snatHostIPJump := fmt.Sprintf("%s --to %s", iptables.Snat, info.hostPrimaryIP)
+
+	// the rules are applied with a single iptables transaction when the endpoint is created
+	options[network.IPTablesKey] = iptables.ChainRules{
+		Table:  iptables.Nat,
+		Parent: iptables.Postrouting,
+		Chain:  iptables.Swift,
+		Rules: []iptables.Rule{
+			{Match: azureDNSUDPMatch, Target: snatPrimaryIPJump},
+			{Match: azureDNSTCPMatch, Target: snatPrimaryIPJump},
+			{Match: azureIMDSMatch, Target: snatHostIPJump},
+		},
+	}
 
 	return nil
 }
@@ -313,7 +344,10 @@ func (invoker *CNSIPAMInvoker) Delete(address *net.IPNet, nwCfg *cni.NetworkConf
 		logger.Info("CNS invoker called with empty IP address")
 	}
 
-	if err := invoker.cnsClient.ReleaseIPs(context.TODO(), ipConfigs); err != nil {
+	// the pod is deleted whatever CNS answers, so the lease it consumed must not be adopted by CNS
+	leaseReleased := cnscli.ReleaseLease(invoker.leases, args.ContainerID, logger)
+
+	if err := invoker.cnsClient.ReleaseIPs(invoker.context(), ipConfigs); err != nil {
 		if cnscli.IsUnsupportedAPI(err) {
 			// If ReleaseIPs is not supported by CNS, use ReleaseIPAddress API
 			logger.Error("ReleaseIPs not supported by CNS. Invoking ReleaseIPAddress API",
@@ -325,8 +359,11 @@ func (invoker *CNSIPAMInvoker) Delete(address *net.IPNet, nwCfg *cni.NetworkConf
 				InfraContainerID:    args.ContainerID,
 			}
 
-			if err = invoker.cnsClient.ReleaseIPAddress(context.TODO(), ipConfig); err != nil {
+			if err = invoker.cnsClient.ReleaseIPAddress(invoker.context(), ipConfig); err != nil {
 				if errors.As(err, &connectionErr) {
+					if leaseReleased {
+						return nil
+					}
 					addErr := fsnotify.AddFile(ipConfigs.PodInterfaceID, args.ContainerID, watcherPath)
 					if addErr != nil {
 						logger.Error("Failed to add file to watcher (unsupported api path)",
@@ -343,6 +380,9 @@ func (invoker *CNSIPAMInvoker) Delete(address *net.IPNet, nwCfg *cni.NetworkConf
 			}
 		} else {
 			if errors.As(err, &connectionErr) {
+				if leaseReleased {
+					return nil
+				}
 				addErr := fsnotify.AddFile(ipConfigs.PodInterfaceID, args.ContainerID, watcherPath)
 				if addErr != nil {
 					logger.Error("Failed to add file to watcher", zap.String("podInterfaceID", ipConfigs.PodInterfaceID), zap.String("containerID", args.ContainerID),
@@ -469,7 +509,11 @@ func configureDefaultAddResult(info *IPResultInfo, addConfig *IPAMAddConfig, add
 	// setHostOptions will execute if IPAM mode is not v4 overlay and not dualStackOverlay mode
 	// TODO: Remove v4overlay and dualstackoverlay options, after 'overlay' rolls out in AKS-RP
 	if !overlayMode {
-		if err := setHostOptions(ncIPNet, addConfig.options, info); err != nil {
+		if addConfig.nwCfg != nil && addConfig.nwCfg.HostRulesBackend == nftables.BackendNftables {
+			if err := setHostOptionsNftables(ncIPNet, addConfig.options, info); err != nil {
+				return err
+			}
+		} else if err := setHostOptions(ncIPNet, addConfig.options, info); err != nil {
 			return err
 		}
 	}
@@ -4,15 +4,18 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"path/filepath"
 	"runtime"
 	"testing"
 
 	"github.com/Azure/azure-container-networking/cni"
 	"github.com/Azure/azure-container-networking/cni/util"
 	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/lease"
 	"github.com/Azure/azure-container-networking/iptables"
 	"github.com/Azure/azure-container-networking/network"
 	"github.com/Azure/azure-container-networking/network/policy"
+	"github.com/Azure/azure-container-networking/nftables"
 	cniSkel "github.com/containernetworking/cni/pkg/skel"
 	"github.com/stretchr/testify/require"
 )
@@ -1333,6 +1336,60 @@ func TestCNSIPAMInvoker_Delete_NotSupportedAPI(t *testing.T) {
 	}
 }
 
+func TestCNSIPAMInvoker_Delete_ReleasesLease(t *testing.T) {
+	require := require.New(t) //nolint further usage of require without passing t
+	unsupportedAPIs := make(map[cnsAPIName]struct{})
+	unsupportedAPIs["ReleaseIPs"] = struct{}{}
+
+	tests := []struct {
+		name      string
+		cnsClient cnsclient
+	}{
+		{
+			name: "CNS releases the IPs",
+			cnsClient: &MockCNSClient{
+				require: require,
+				releaseIPs: releaseIPsHandler{
+					ipconfigArgument: getTestIPConfigsRequest(),
+				},
+			},
+		},
+		{
+			name: "CNS releases the IPs using ReleaseIPAddress",
+			cnsClient: &MockCNSClient{
+				unsupportedAPIs: unsupportedAPIs,
+				require:         require,
+				releaseIP: releaseIPHandler{
+					ipconfigArgument: getTestIPConfigRequest(),
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			invoker := &CNSIPAMInvoker{
+				podName:      testPodInfo.PodName,
+				podNamespace: testPodInfo.PodNamespace,
+				cnsClient:    tt.cnsClient,
+				leases:       lease.New(filepath.Join(t.TempDir(), "ipleases.json")),
+			}
+			require.NoError(invoker.leases.Update(func([]lease.Lease) ([]lease.Lease, error) {
+				return []lease.Lease{{ID: "1", Consumer: &lease.Consumer{InfraContainerID: "testcontainerid"}}}, nil
+			}))
+
+			// the lease consumed while CNS was unreachable is released even though CNS answers, so CNS never
+			// adopts it for the deleted pod
+			args := &cniSkel.CmdArgs{ContainerID: "testcontainerid", Netns: "testnetns", IfName: "testifname"}
+			require.NoError(invoker.Delete(nil, nil, args, map[string]interface{}{}))
+			require.NoError(invoker.leases.Update(func(leases []lease.Lease) ([]lease.Lease, error) {
+				require.True(leases[0].Consumer.Released)
+				return leases, nil
+			}))
+		})
+	}
+}
+
 func TestReleaseIPAPIsFail(t *testing.T) {
 	require := require.New(t) //nolint further usage of require without passing t
 	type fields struct {
@@ -1422,26 +1479,23 @@ func Test_setHostOptions(t *testing.T) {
 				},
 			},
 			wantOptions: map[string]interface{}{
-				network.IPTablesKey: []iptables.IPTableEntry{
-					{
-						Version: "4",
-						Params:  "-t nat -N SWIFT",
-					},
-					{
-						Version: "4",
-						Params:  "-t nat -A POSTROUTING  -j SWIFT",
-					},
-					{
-						Version: "4",
-						Params:  "-t nat -I SWIFT 1  -m addrtype ! --dst-type local -s 10.0.1.0/24 -d 168.63.129.16 -p udp --dport 53 -j SNAT --to 10.0.1.20",
-					},
-					{
-						Version: "4",
-						Params:  "-t nat -I SWIFT 1  -m addrtype ! --dst-type local -s 10.0.1.0/24 -d 168.63.129.16 -p tcp --dport 53 -j SNAT --to 10.0.1.20",
-					},
-					{
-						Version: "4",
-						Params:  "-t nat -I SWIFT 1  -m addrtype ! --dst-type local -s 10.0.1.0/24 -d 169.254.169.254 -p tcp --dport 80 -j SNAT --to 10.0.0.3",
+				network.IPTablesKey: iptables.ChainRules{
+					Table:  "nat",
+					Parent: "POSTROUTING",
+					Chain:  "SWIFT",
+					Rules: []iptables.Rule{
+						{
+							Match:  " -m addrtype ! --dst-type local -s 10.0.1.0/24 -d 168.63.129.16 -p udp --dport 53",
+							Target: "SNAT --to 10.0.1.20",
+						},
+						{
+							Match:  " -m addrtype ! --dst-type local -s 10.0.1.0/24 -d 168.63.129.16 -p tcp --dport 53",
+							Target: "SNAT --to 10.0.1.20",
+						},
+						{
+							Match:  " -m addrtype ! --dst-type local -s 10.0.1.0/24 -d 169.254.169.254 -p tcp --dport 80",
+							Target: "SNAT --to 10.0.0.3",
+						},
 					},
 				},
 				network.RoutesKey: []network.RouteInfo{
@@ -1488,6 +1542,40 @@ func Test_setHostOptions(t *testing.T) {
 	}
 }
 
+func Test_setHostOptionsNftables(t *testing.T) {
+	require := require.New(t) //nolint further usage of require without passing t
+	options := map[string]interface{}{}
+	info := IPResultInfo{
+		podIPAddress:       "10.0.1.10",
+		ncSubnetPrefix:     24,
+		ncPrimaryIP:        "10.0.1.20",
+		ncGatewayIPAddress: "10.0.1.1",
+		hostSubnet:         "10.0.0.0/24",
+		hostPrimaryIP:      "10.0.0.3",
+		hostGateway:        "10.0.0.1",
+	}
+
+	err := setHostOptionsNftables(getCIDRNotationForAddress("10.0.1.0/24"), options, &info)
+	require.NoError(err)
+	require.Exactly(map[string]interface{}{
+		network.NftablesSnatKey: nftables.SnatEndpoint{
+			Owner:      nftables.OwnerCNI,
+			Subnet:     *getCIDRNotationForAddress("10.0.1.0/24"),
+			DNSSnatIP:  net.ParseIP("10.0.1.20"),
+			IMDSSnatIP: net.ParseIP("10.0.0.3"),
+		},
+		network.RoutesKey: []network.RouteInfo{
+			{
+				Dst: *getCIDRNotationForAddress("10.0.1.0/24"),
+				Gw:  net.ParseIP("10.0.0.1"),
+			},
+		},
+	}, options)
+
+	info.ncPrimaryIP = ""
+	require.Error(setHostOptionsNftables(getCIDRNotationForAddress("10.0.1.0/24"), map[string]interface{}{}, &info))
+}
+
 func Test_getInterfaceInfoKey(t *testing.T) {
 	require := require.New(t) //nolint further usage of require without passing t
 	inv := &CNSIPAMInvoker{}
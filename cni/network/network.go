@@ -84,6 +84,9 @@ type NetPlugin struct {
 	nnsClient          NnsClient
 	multitenancyClient MultitenancyClient
 	netClient          InterfaceGetter
+	opTimer            *telemetry.OperationTimer
+	// ctx carries the trace of the current CNI invocation to the calls it makes to CNS
+	ctx context.Context
 }
 
 type PolicyArgs struct {
@@ -319,6 +322,37 @@ func addNatIPV6SubnetInfo(nwCfg *cni.NetworkConfig,
 	}
 }
 
+// SetOperationTimer sets the timer which records the phases of the current CNI invocation.
+func (plugin *NetPlugin) SetOperationTimer(timer *telemetry.OperationTimer) {
+	plugin.opTimer = timer
+	plugin.nm.SetPhaseTimer(timer.StartPhase)
+}
+
+// SetContext sets the context of the current CNI invocation.
+func (plugin *NetPlugin) SetContext(ctx context.Context) {
+	plugin.ctx = ctx
+}
+
+func (plugin *NetPlugin) context() context.Context {
+	if plugin.ctx == nil {
+		return context.Background()
+	}
+	return plugin.ctx
+}
+
+func (plugin *NetPlugin) startPhase(phase string) func(err error) {
+	if plugin.opTimer == nil {
+		return func(error) {}
+	}
+	return plugin.opTimer.StartPhase(phase)
+}
+
+func (plugin *NetPlugin) setOperationMode(mode string) {
+	if plugin.opTimer != nil {
+		plugin.opTimer.SetMode(mode)
+	}
+}
+
 func (plugin *NetPlugin) addIpamInvoker(ipamAddConfig IPAMAddConfig) (IPAMAddResult, error) {
 	ipamAddResult, err := plugin.ipamInvoker.Add(ipamAddConfig)
 	if err != nil {
@@ -391,6 +425,7 @@ func (plugin *NetPlugin) Add(args *cniSkel.CmdArgs) error {
 		args.ContainerID, args.Netns, args.IfName, args.Args, args.Path, args.StdinData))
 
 	iptables.DisableIPTableLock = nwCfg.DisableIPTableLock
+	plugin.setOperationMode(nwCfg.Mode)
 
 	defer func() {
 		// Add Interfaces to result.
@@ -506,7 +541,9 @@ func (plugin *NetPlugin) Add(args *cniSkel.CmdArgs) error {
 			return fmt.Errorf("%w", err)
 		}
 
-		ipamAddResult, err = plugin.multitenancyClient.GetAllNetworkContainers(context.TODO(), nwCfg, k8sPodName, k8sNamespace, args.IfName)
+		stopPhase := plugin.startPhase(telemetry.PhaseIPAM)
+		ipamAddResult, err = plugin.multitenancyClient.GetAllNetworkContainers(plugin.context(), nwCfg, k8sPodName, k8sNamespace, args.IfName)
+		stopPhase(err)
 		if err != nil {
 			err = fmt.Errorf("GetAllNetworkContainers failed for podname %s namespace %s. error: %w", k8sPodName, k8sNamespace, err)
 			logger.Error("GetAllNetworkContainers failed",
@@ -527,7 +564,9 @@ func (plugin *NetPlugin) Add(args *cniSkel.CmdArgs) error {
 		if plugin.ipamInvoker == nil {
 			switch nwCfg.IPAM.Type {
 			case network.AzureCNS:
-				plugin.ipamInvoker = NewCNSInvoker(k8sPodName, k8sNamespace, cnsClient, util.ExecutionMode(nwCfg.ExecutionMode), util.IpamMode(nwCfg.IPAM.Mode))
+				cnsInvoker := NewCNSInvoker(k8sPodName, k8sNamespace, cnsClient, util.ExecutionMode(nwCfg.ExecutionMode), util.IpamMode(nwCfg.IPAM.Mode))
+				cnsInvoker.ctx = plugin.context()
+				plugin.ipamInvoker = cnsInvoker
 			default:
 				// legacy
 				nwInfo := plugin.getNetworkInfo(args.Netns, nil, nwCfg)
@@ -535,9 +574,11 @@ func (plugin *NetPlugin) Add(args *cniSkel.CmdArgs) error {
 			}
 		}
 
+		stopPhase := plugin.startPhase(telemetry.PhaseIPAM)
 		ipamAddResult, err = plugin.addIpamInvoker(ipamAddConfig)
+		stopPhase(err)
 		if err != nil {
-			return fmt.Errorf("IPAM Invoker Add failed with error: %w", err)
+			return plugin.Error(fmt.Errorf("IPAM Invoker Add failed with error: %w", err))
 		}
 	}
 
@@ -764,6 +805,7 @@ func (plugin *NetPlugin) createEpInfo(opt *createEpInfoOpt) (*network.EndpointIn
 		NetworkContainerID:       opt.ifInfo.NetworkContainerID,
 		AllowInboundFromHostToNC: opt.ifInfo.AllowHostToNCCommunication,
 		AllowInboundFromNCToHost: opt.ifInfo.AllowNCToHostCommunication,
+		HostRulesBackend:         opt.nwCfg.HostRulesBackend,
 	}
 
 	if err = addSubnetToEndpointInfo(*opt.ifInfo, &endpointInfo); err != nil {
@@ -997,6 +1039,7 @@ func (plugin *NetPlugin) Delete(args *cniSkel.CmdArgs) error {
 		err = argErr
 		return err
 	}
+	plugin.setOperationMode(nwCfg.Mode)
 
 	// Parse Pod arguments.
 	if k8sPodName, k8sNamespace, err = plugin.getPodInfo(args.Args); err != nil {
@@ -1028,7 +1071,9 @@ func (plugin *NetPlugin) Delete(args *cniSkel.CmdArgs) error {
 				logger.Error("failed to create cns client", zap.Error(cnsErr))
 				return errors.Wrap(cnsErr, "failed to create cns client")
 			}
-			plugin.ipamInvoker = NewCNSInvoker(k8sPodName, k8sNamespace, cnsClient, util.ExecutionMode(nwCfg.ExecutionMode), util.IpamMode(nwCfg.IPAM.Mode))
+			cnsInvoker := NewCNSInvoker(k8sPodName, k8sNamespace, cnsClient, util.ExecutionMode(nwCfg.ExecutionMode), util.IpamMode(nwCfg.IPAM.Mode))
+			cnsInvoker.ctx = plugin.context()
+			plugin.ipamInvoker = cnsInvoker
 
 		default:
 			// nwInfo gets populated later in the function
@@ -1102,7 +1147,10 @@ func (plugin *NetPlugin) Delete(args *cniSkel.CmdArgs) error {
 
 			logger.Warn("Release ip by ContainerID (endpoint not found)",
 				zap.String("containerID", args.ContainerID))
-			if err = plugin.ipamInvoker.Delete(nil, nwCfg, args, nwInfo.Options); err != nil {
+			stopPhase := plugin.startPhase(telemetry.PhaseIPAM)
+			err = plugin.ipamInvoker.Delete(nil, nwCfg, args, nwInfo.Options)
+			stopPhase(err)
+			if err != nil {
 				return plugin.RetriableError(fmt.Errorf("failed to release address(no endpoint): %w", err))
 			}
 		}
@@ -1136,7 +1184,9 @@ func (plugin *NetPlugin) Delete(args *cniSkel.CmdArgs) error {
 			for i := range epInfo.IPAddresses {
 				logger.Info("Release ip", zap.String("ip", epInfo.IPAddresses[i].IP.String()))
 				telemetryClient.SendEvent(fmt.Sprintf("Release ip: %s container id: %s endpoint id: %s", epInfo.IPAddresses[i].IP.String(), args.ContainerID, epInfo.EndpointID))
+				stopPhase := plugin.startPhase(telemetry.PhaseIPAM)
 				err = plugin.ipamInvoker.Delete(&epInfo.IPAddresses[i], nwCfg, args, nwInfo.Options)
+				stopPhase(err)
 				if err != nil {
 					return plugin.RetriableError(fmt.Errorf("failed to release address: %w", err))
 				}
@@ -1144,7 +1194,9 @@ func (plugin *NetPlugin) Delete(args *cniSkel.CmdArgs) error {
 		} else if epInfo.EnableInfraVnet { // remove in future PR
 			nwCfg.IPAM.Subnet = nwInfo.Subnets[0].Prefix.String()
 			nwCfg.IPAM.Address = epInfo.InfraVnetIP.IP.String()
+			stopPhase := plugin.startPhase(telemetry.PhaseIPAM)
 			err = plugin.ipamInvoker.Delete(nil, nwCfg, args, nwInfo.Options)
+			stopPhase(err)
 			if err != nil {
 				return plugin.RetriableError(fmt.Errorf("failed to release address: %w", err))
 			}
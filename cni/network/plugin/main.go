@@ -4,6 +4,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"time"
@@ -16,7 +17,9 @@ import (
 	"github.com/Azure/azure-container-networking/nns"
 	"github.com/Azure/azure-container-networking/platform"
 	"github.com/Azure/azure-container-networking/telemetry"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
@@ -152,12 +155,27 @@ func rootExecute() error {
 		}
 	}
 
+	opTimer := telemetry.NewOperationTimer(cniCmd, "")
+	netPlugin.SetOperationTimer(opTimer)
+	// trace the command, the spans are exported by the telemetry service
+	shutdownTracing := tracing.Init(telemetry.AIClient.SpanExporter(), name, 1)
+	ctx, span := tracing.Start(context.Background(), "CNI "+cniCmd, attribute.String("cni.command", cniCmd))
+	netPlugin.SetContext(ctx)
 	handled, _ := network.HandleIfCniUpdate(netPlugin.Update)
 	if handled {
 		logger.Info("CNI UPDATE finished.")
 	} else if err = netPlugin.Execute(cni.PluginApi(netPlugin)); err != nil {
 		logger.Error("Failed to execute network plugin", zap.Error(err))
 	}
+	tracing.End(span, err)
+	if errTracing := shutdownTracing(ctx); errTracing != nil {
+		logger.Error("Failed to send spans to the telemetry service", zap.Error(errTracing))
+	}
+	if cniCmd == cni.CmdAdd || cniCmd == cni.CmdDel {
+		op := opTimer.Finish(cni.ResultCode(err))
+		op.ErrorCode = string(cni.ErrorCode(err))
+		telemetry.AIClient.SendOperation(op)
+	}
 
 	if cniCmd == cni.CmdVersion {
 		return errors.Wrap(err, "Execute netplugin failure")
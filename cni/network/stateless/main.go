@@ -4,6 +4,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"time"
@@ -17,7 +18,9 @@ import (
 	"github.com/Azure/azure-container-networking/nns"
 	"github.com/Azure/azure-container-networking/platform"
 	"github.com/Azure/azure-container-networking/telemetry"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
@@ -136,7 +139,23 @@ func rootExecute() error {
 		return errors.Wrap(err, "Execute netplugin failure")
 	}
 
-	if err = netPlugin.Execute(cni.PluginApi(netPlugin)); err != nil {
+	opTimer := telemetry.NewOperationTimer(cniCmd, "")
+	netPlugin.SetOperationTimer(opTimer)
+	// trace the command, the spans are exported by the telemetry service
+	shutdownTracing := tracing.Init(telemetry.AIClient.SpanExporter(), name, 1)
+	ctx, span := tracing.Start(context.Background(), "CNI "+cniCmd, attribute.String("cni.command", cniCmd))
+	netPlugin.SetContext(ctx)
+	err = netPlugin.Execute(cni.PluginApi(netPlugin))
+	tracing.End(span, err)
+	if errTracing := shutdownTracing(ctx); errTracing != nil {
+		logger.Error("Failed to send spans to the telemetry service", zap.Error(errTracing))
+	}
+	if cniCmd == cni.CmdAdd || cniCmd == cni.CmdDel {
+		op := opTimer.Finish(cni.ResultCode(err))
+		op.ErrorCode = string(cni.ErrorCode(err))
+		telemetry.AIClient.SendOperation(op)
+	}
+	if err != nil {
 		return errors.Wrap(err, "Failed to execute network plugin")
 	}
 	netPlugin.Stop()
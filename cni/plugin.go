@@ -12,6 +12,7 @@ import (
 
 	"github.com/Azure/azure-container-networking/cni/log"
 	"github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/errcode"
 	"github.com/Azure/azure-container-networking/platform"
 	"github.com/Azure/azure-container-networking/processlock"
 	"github.com/Azure/azure-container-networking/store"
@@ -155,9 +156,13 @@ func (plugin *Plugin) Error(err error) *cniTypes.Error {
 	var cniErr *cniTypes.Error
 	var ok bool
 
-	// Wrap error if necessary.
+	// Wrap error if necessary. Errors classified by errcode keep their code and retry hint.
 	if cniErr, ok = err.(*cniTypes.Error); !ok {
-		cniErr = &cniTypes.Error{Code: 100, Msg: err.Error()}
+		if errcode.Classified(err) {
+			cniErr = errcode.CNIError(err)
+		} else {
+			cniErr = &cniTypes.Error{Code: 100, Msg: err.Error()}
+		}
 	}
 
 	logger.Error("error",
@@ -172,6 +177,33 @@ func (plugin *Plugin) Errorf(format string, args ...interface{}) *cniTypes.Error
 	return plugin.Error(fmt.Errorf(format, args...))
 }
 
+// ResultCode returns the CNI error code the runtime sees for err, 0 if err is nil.
+func ResultCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var cniErr *cniTypes.Error
+	if errors.As(err, &cniErr) {
+		return int(cniErr.Code)
+	}
+	return int(cniTypes.ErrInternal)
+}
+
+// ErrorCode returns the errcode.Code of the CNI error the runtime sees for err, empty if it isn't classified.
+func ErrorCode(err error) errcode.Code {
+	var cniErr *cniTypes.Error
+	if errors.As(err, &cniErr) {
+		if e := errcode.FromCNI(cniErr); e != nil {
+			return e.Code
+		}
+		return ""
+	}
+	if errcode.Classified(err) {
+		return errcode.CodeOf(err)
+	}
+	return ""
+}
+
 // RetriableError logs and returns a CNI error with the TryAgainLater error code
 func (plugin *Plugin) RetriableError(err error) *cniTypes.Error {
 	tryAgainErr := cniTypes.NewError(cniTypes.ErrTryAgainLater, err.Error(), "")
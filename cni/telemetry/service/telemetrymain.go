@@ -10,9 +10,11 @@ import (
 	"time"
 
 	"github.com/Azure/azure-container-networking/aitelemetry"
+	"github.com/Azure/azure-container-networking/aitelemetry/spool"
 	"github.com/Azure/azure-container-networking/cni/log"
 	acn "github.com/Azure/azure-container-networking/common"
 	"github.com/Azure/azure-container-networking/telemetry"
+	"github.com/Azure/azure-container-networking/tracing"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -98,6 +100,10 @@ func setTelemetryDefaults(config *telemetry.TelemetryConfig) {
 	if config.GetEnvRetryWaitTimeInSecs == 0 {
 		config.GetEnvRetryWaitTimeInSecs = defaultGetEnvRetryWaitTimeInSecs
 	}
+
+	if config.SpoolDir == "" {
+		config.SpoolDir = telemetry.AISpoolDir
+	}
 }
 
 func main() {
@@ -143,6 +149,10 @@ func main() {
 	tbtemp.Cleanup(telemetry.FdName)
 
 	tb = telemetry.NewTelemetryBuffer(logger)
+	// replay the reports which CNI spooled while the telemetry service wasn't running
+	if err = tb.EnableSpool(spool.Config{Dir: telemetry.CNISpoolDir}); err != nil {
+		logger.Error("Failed to enable the CNI telemetry spool", zap.Error(err))
+	}
 	for {
 		logger.Info("Starting telemetry server")
 		err = tb.StartServer()
@@ -165,12 +175,29 @@ func main() {
 		DebugMode:                    config.DebugMode,
 		GetEnvRetryCount:             config.GetEnvRetryCount,
 		GetEnvRetryWaitTimeInSecs:    config.GetEnvRetryWaitTimeInSecs,
+		SpoolDir:                     config.SpoolDir,
+		SpoolMaxSizeInBytes:          config.SpoolMaxSizeInBytes,
+		OTLP:                         config.OTLP,
 	}
 
 	if err := tb.CreateAITelemetryHandle(aiConfig, config.DisableAll, config.DisableTrace, config.DisableMetric); err != nil { // nolint
 		logger.Error("AI Handle creation error:", zap.Error(err))
 	}
+	// export the spans which CNI sends over the telemetry socket
+	var relay *tracing.Relay
+	if config.OTLP != nil {
+		if exporter, err := tracing.NewOTLPExporter(config.OTLP, pluginName); err != nil {
+			logger.Error("OTLP span exporter creation error:", zap.Error(err))
+		} else {
+			relay = tracing.NewRelay(exporter)
+			tb.SetSpanHandler(relay.Export)
+		}
+	}
+
 	logger.Info("Report to host interval", zap.Duration("seconds", config.ReportToHostIntervalInSeconds))
 	tb.PushData(context.Background())
+	if relay != nil {
+		_ = relay.Shutdown(context.Background())
+	}
 	telemetry.CloseAITelemetryHandle()
 }
@@ -35,9 +35,11 @@ const (
 	RequestIPConfigs                         = "/network/requestipconfigs"
 	ReleaseIPConfig                          = "/network/releaseipconfig"
 	ReleaseIPConfigs                         = "/network/releaseipconfigs"
+	GCIPConfigs                              = "/network/gcipconfigs"
 	PathDebugIPAddresses                     = "/debug/ipaddresses"
 	PathDebugPodContext                      = "/debug/podcontext"
 	PathDebugRestData                        = "/debug/restdata"
+	PathDebugLogLevels                       = "/debug/loglevels"
 	NumberOfCPUCores                         = NumberOfCPUCoresPath
 	NMAgentSupportedAPIs                     = NmAgentSupportedApisPath
 	EndpointAPI                              = EndpointPath
@@ -238,6 +240,8 @@ type PodInfo interface {
 	String() string
 	// SecondaryInterfacesExist returns true if there exist a secondary interface for this pod
 	SecondaryInterfacesExist() bool
+	// Owner is the CNI plugin which requested the IPs of the pod, or empty if it didn't say.
+	Owner() string
 }
 
 type KubernetesPodInfo struct {
@@ -254,6 +258,7 @@ type podInfo struct {
 	PodInterfaceID        string
 	Version               podInfoScheme
 	SecondaryInterfaceSet bool
+	PodOwner              string `json:",omitempty"`
 }
 
 func (p podInfo) String() string {
@@ -314,6 +319,10 @@ func (p *podInfo) SecondaryInterfacesExist() bool {
 	return p.SecondaryInterfaceSet
 }
 
+func (p *podInfo) Owner() string {
+	return p.PodOwner
+}
+
 func (p *podInfo) UnmarshalJSON(b []byte) error {
 	type alias podInfo
 	// Unmarshal into a temporary struct to avoid infinite recursion
@@ -365,6 +374,7 @@ func NewPodInfoFromIPConfigsRequest(req IPConfigsRequest) (PodInfo, error) {
 	p.(*podInfo).PodInfraContainerID = req.InfraContainerID
 	p.(*podInfo).PodInterfaceID = req.PodInterfaceID
 	p.(*podInfo).SecondaryInterfaceSet = req.SecondaryInterfacesExist
+	p.(*podInfo).PodOwner = req.Owner
 	return p, nil
 }
 
@@ -542,6 +552,7 @@ type IPConfigRequest struct {
 	InfraContainerID    string
 	OrchestratorContext json.RawMessage
 	Ifname              string // Used by delegated IPAM
+	Owner               string `json:",omitempty"` // The CNI plugin requesting the IPs, see IPConfigsRequest
 }
 
 // Same as IPConfigRequest except that DesiredIPAddresses is passed in as a slice
@@ -554,6 +565,8 @@ type IPConfigsRequest struct {
 	SecondaryInterfacesExist     bool            `json:"secondaryInterfacesExist"` // will be set by SWIFT v2 validator func
 	BackendInterfaceExist        bool            `json:"BackendInterfaceExist"`    // will be set by SWIFT v2 validator func
 	BackendInterfaceMacAddresses []string        `json:"BacknendInterfaceMacAddress"`
+	// Owner is the CNI plugin requesting the IPs. Only the GC of the same owner releases them.
+	Owner string `json:"owner,omitempty"`
 }
 
 // IPConfigResponse is used in CNS IPAM mode as a response to CNI ADD
@@ -568,6 +581,21 @@ type IPConfigsResponse struct {
 	Response  Response    `json:"response"`
 }
 
+// GCIPConfigsRequest is used in CNS IPAM mode by CNI GC to release the IPs of containers which the runtime no longer
+// knows about. IPs which the Owner requested for any other container are released.
+type GCIPConfigsRequest struct {
+	ValidContainerIDs []string `json:"validContainerIDs"`
+	// Owner is the CNI plugin whose IPs are collected, as it's set in its IPConfigsRequests. It's required, so that
+	// IPs requested by other plugins, or before owners were recorded, are never released.
+	Owner string `json:"owner"`
+}
+
+// GCIPConfigsResponse is used in CNS IPAM mode as a response to CNI GC
+type GCIPConfigsResponse struct {
+	ReleasedContainerIDs []string `json:"releasedContainerIDs"`
+	Response             Response `json:"response"`
+}
+
 // GetIPAddressesRequest is used in CNS IPAM mode to get the states of IPConfigs
 // The IPConfigStateFilter is a slice of IPs to fetch from CNS that match those states
 type GetIPAddressesRequest struct {
@@ -14,6 +14,7 @@ import (
 	"github.com/Azure/azure-container-networking/cns/types"
 	"github.com/Azure/azure-container-networking/crd/multitenancy/api/v1alpha1"
 	"github.com/Azure/azure-container-networking/crd/nodenetworkconfig/api/v1alpha"
+	"github.com/Azure/azure-container-networking/errcode"
 	"github.com/pkg/errors"
 )
 
@@ -309,6 +310,20 @@ type IpamPoolMonitorStateSnapshot struct {
 type Response struct {
 	ReturnCode types.ResponseCode `json:"ReturnCode"`
 	Message    string             `json:"Message"`
+	// Error classifies a failure in the shared error taxonomy. Older versions of CNS don't set it, in which case the
+	// ReturnCode is classified instead.
+	Error *errcode.Error `json:"Error,omitempty"`
+}
+
+// StructuredError returns the Error of a failed Response, or classifies its ReturnCode. It returns nil on success.
+func (r *Response) StructuredError() *errcode.Error {
+	if r.ReturnCode == types.Success {
+		return nil
+	}
+	if r.Error != nil {
+		return r.Error
+	}
+	return errcode.New(r.ReturnCode.ErrorCode(), r.Message)
 }
 
 // NumOfCPUCoresResponse describes num of cpu cores present on host.
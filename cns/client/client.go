@@ -13,6 +13,8 @@ import (
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/cns/restserver"
 	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/errcode"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/pkg/errors"
 )
 
@@ -33,6 +35,7 @@ var clientPaths = []string{
 	cns.RequestIPConfigs,
 	cns.ReleaseIPConfig,
 	cns.ReleaseIPConfigs,
+	cns.GCIPConfigs,
 	cns.PathDebugIPAddresses,
 	cns.PathDebugPodContext,
 	cns.PathDebugRestData,
@@ -66,6 +69,11 @@ func (e *ConnectionFailureErr) Error() string {
 	return e.cause.Error()
 }
 
+// ErrorCode classifies connection failures as transient, CNS may be restarting.
+func (e *ConnectionFailureErr) ErrorCode() errcode.Code {
+	return errcode.CNSUnreachable
+}
+
 // New returns a new CNS client configured with the passed URL and timeout.
 func New(baseURL string, requestTimeout time.Duration) (*Client, error) {
 	if baseURL == "" {
@@ -80,6 +88,8 @@ func New(baseURL string, requestTimeout time.Duration) (*Client, error) {
 	return &Client{
 		client: &http.Client{
 			Timeout: requestTimeout,
+			// propagate the trace of the caller to CNS
+			Transport: tracing.NewTransport(http.DefaultTransport),
 		},
 		routes: routes,
 	}, nil
@@ -325,7 +335,7 @@ func (c *Client) RequestIPAddress(ctx context.Context, ipconfig cns.IPConfigRequ
 	req.Header.Set(headerContentType, contentTypeJSON)
 	res, err := c.client.Do(req)
 	if err != nil {
-		return nil, errors.Wrap(err, "http request failed")
+		return nil, errors.Wrap(&ConnectionFailureErr{cause: err}, "http request failed")
 	}
 
 	defer res.Body.Close()
@@ -341,7 +351,10 @@ func (c *Client) RequestIPAddress(ctx context.Context, ipconfig cns.IPConfigRequ
 	}
 
 	if response.Response.ReturnCode != 0 {
-		return nil, errors.New(response.Response.Message)
+		return nil, &CNSClientError{
+			Code: response.Response.ReturnCode,
+			Err:  response.Response.StructuredError(),
+		}
 	}
 
 	return &response, nil
@@ -381,7 +394,10 @@ func (c *Client) ReleaseIPAddress(ctx context.Context, ipconfig cns.IPConfigRequ
 	}
 
 	if resp.ReturnCode != 0 {
-		return errors.New(resp.Message)
+		return &CNSClientError{
+			Code: resp.ReturnCode,
+			Err:  resp.StructuredError(),
+		}
 	}
 
 	return nil
@@ -412,7 +428,7 @@ func (c *Client) RequestIPs(ctx context.Context, ipconfig cns.IPConfigsRequest)
 	req.Header.Set(headerContentType, contentTypeJSON)
 	res, err := c.client.Do(req)
 	if err != nil {
-		return nil, errors.Wrap(err, "http request failed")
+		return nil, errors.Wrap(&ConnectionFailureErr{cause: err}, "http request failed")
 	}
 	defer res.Body.Close()
 
@@ -434,7 +450,10 @@ func (c *Client) RequestIPs(ctx context.Context, ipconfig cns.IPConfigsRequest)
 	}
 
 	if response.Response.ReturnCode != 0 {
-		return nil, errors.New(response.Response.Message)
+		return nil, &CNSClientError{
+			Code: response.Response.ReturnCode,
+			Err:  response.Response.StructuredError(),
+		}
 	}
 
 	return &response, nil
@@ -482,12 +501,66 @@ func (c *Client) ReleaseIPs(ctx context.Context, ipconfig cns.IPConfigsRequest)
 	}
 
 	if resp.ReturnCode != 0 {
-		return errors.New(resp.Message)
+		return &CNSClientError{
+			Code: resp.ReturnCode,
+			Err:  resp.StructuredError(),
+		}
 	}
 
 	return nil
 }
 
+// GCIPs releases the IPs of all containers which aren't in the valid container IDs of the request, and returns the
+// containers whose IPs were released.
+func (c *Client) GCIPs(ctx context.Context, gcRequest cns.GCIPConfigsRequest) (*cns.GCIPConfigsResponse, error) {
+	var body bytes.Buffer
+	err := json.NewEncoder(&body).Encode(gcRequest)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode GCIPConfigsRequest")
+	}
+
+	u := c.routes[cns.GCIPConfigs]
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), &body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build request")
+	}
+	req.Header.Set(headerContentType, contentTypeJSON)
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, &ConnectionFailureErr{
+			cause: err,
+		}
+	}
+	defer res.Body.Close()
+
+	// if we get a 404 error
+	if res.StatusCode == http.StatusNotFound {
+		return nil, &CNSClientError{
+			Code: types.UnsupportedAPI,
+			Err:  errors.Errorf("Unsupported API"),
+		}
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("http response %d", res.StatusCode)
+	}
+
+	var resp cns.GCIPConfigsResponse
+	err = json.NewDecoder(res.Body).Decode(&resp)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode GCIPConfigsResponse")
+	}
+
+	if resp.Response.ReturnCode != 0 {
+		return &resp, &CNSClientError{
+			Code: resp.Response.ReturnCode,
+			Err:  resp.Response.StructuredError(),
+		}
+	}
+
+	return &resp, nil
+}
+
 // GetIPAddressesMatchingStates takes a variadic number of string parameters, to get all IP Addresses matching a number of states
 // usage GetIPAddressesWithStates(ctx, types.Available...)
 func (c *Client) GetIPAddressesMatchingStates(ctx context.Context, stateFilter ...types.IPState) ([]cns.IPConfigurationStatus, error) {
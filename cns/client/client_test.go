@@ -2067,6 +2067,58 @@ func TestReleaseIPs(t *testing.T) {
 	}
 }
 
+func TestGCIPs(t *testing.T) {
+	emptyRoutes, _ := buildRoutes(defaultBaseURL, clientPaths)
+	tests := []struct {
+		name    string
+		mockdo  *mockdo
+		want    *cns.GCIPConfigsResponse
+		wantErr bool
+	}{
+		{
+			name: "happy case",
+			mockdo: &mockdo{
+				objToReturn:            &cns.GCIPConfigsResponse{ReleasedContainerIDs: []string{"leakedcontainerid"}},
+				httpStatusCodeToReturn: http.StatusOK,
+			},
+			want: &cns.GCIPConfigsResponse{ReleasedContainerIDs: []string{"leakedcontainerid"}},
+		},
+		{
+			name: "unsupported api",
+			mockdo: &mockdo{
+				httpStatusCodeToReturn: http.StatusNotFound,
+			},
+			wantErr: true,
+		},
+		{
+			name: "cns return code not zero",
+			mockdo: &mockdo{
+				objToReturn: &cns.GCIPConfigsResponse{
+					Response: cns.Response{ReturnCode: types.UnexpectedError},
+				},
+				httpStatusCodeToReturn: http.StatusOK,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client := &Client{
+				client: tt.mockdo,
+				routes: emptyRoutes,
+			}
+			got, err := client.GCIPs(context.TODO(), cns.GCIPConfigsRequest{ValidContainerIDs: []string{"testcontainerid"}})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
 func TestGetIPAddressesMatchingStates(t *testing.T) {
 	emptyRoutes, _ := buildRoutes(defaultBaseURL, clientPaths)
 	tests := []struct {
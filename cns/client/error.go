@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/errcode"
 )
 
 // FailedHTTPRequest describes an HTTP request to CNS that has returned a
@@ -28,6 +29,16 @@ func (e *CNSClientError) Error() string {
 	return fmt.Sprintf("[Azure cnsclient] Code: %d , Error: %v", e.Code, e.Err)
 }
 
+// Unwrap returns the cause, which is the *errcode.Error of the response if CNS returned one.
+func (e *CNSClientError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorCode classifies the ResponseCode, for causes which aren't an *errcode.Error.
+func (e *CNSClientError) ErrorCode() errcode.Code {
+	return e.Code.ErrorCode()
+}
+
 // IsNotFound tests if the provided error is of type CNSClientError and then
 // further tests if the error code is of type UnknowContainerID
 func IsNotFound(err error) bool {
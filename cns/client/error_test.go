@@ -1,10 +1,16 @@
 package client
 
 import (
+	"context"
+	"net/http"
+	"net/url"
 	"testing"
 
+	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/errcode"
 	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
 )
 
 func TestIsNotFound(t *testing.T) {
@@ -44,3 +50,54 @@ func TestIsNotFound(t *testing.T) {
 		})
 	}
 }
+
+func TestRequestIPsErrorCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		mockdo *mockdo
+		want   errcode.Code
+	}{
+		{
+			name: "structured error",
+			mockdo: &mockdo{
+				objToReturn: &cns.IPConfigsResponse{
+					Response: cns.Response{
+						ReturnCode: types.FailedToAllocateIPConfig,
+						Message:    "AllocateIPConfig failed",
+						Error:      errcode.New(errcode.IPPoolExhausted, "not enough IPs available"),
+					},
+				},
+				httpStatusCodeToReturn: http.StatusOK,
+			},
+			want: errcode.IPPoolExhausted,
+		},
+		{
+			name: "return code of an older CNS",
+			mockdo: &mockdo{
+				objToReturn: &cns.IPConfigsResponse{
+					Response: cns.Response{
+						ReturnCode: types.InconsistentIPConfigState,
+						Message:    "inconsistent state",
+					},
+				},
+				httpStatusCodeToReturn: http.StatusOK,
+			},
+			want: errcode.StateStoreCorrupt,
+		},
+		{
+			name: "connection failure",
+			mockdo: &mockdo{
+				errToReturn: errors.New("connection refused"),
+			},
+			want: errcode.CNSUnreachable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := Client{client: tt.mockdo, routes: map[string]url.URL{}}
+			_, err := client.RequestIPs(context.TODO(), cns.IPConfigsRequest{})
+			require.Error(t, err)
+			require.Equal(t, tt.want, errcode.CodeOf(err))
+		})
+	}
+}
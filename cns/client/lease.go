@@ -0,0 +1,46 @@
+package client
+
+import (
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/lease"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// ConsumeLease assigns an IP lease from the cache to the pod if CNS is unreachable, else it returns the error of the
+// request to CNS. A nil cache disables leases.
+func ConsumeLease(leases *lease.Cache, req cns.IPConfigsRequest, cnsErr error, logger *zap.Logger) (*cns.IPConfigsResponse, error) {
+	var connectionErr *ConnectionFailureErr
+	if leases == nil || !errors.As(cnsErr, &connectionErr) {
+		return nil, cnsErr
+	}
+	consumer, err := lease.ConsumerOf(req)
+	if err != nil {
+		return nil, cnsErr
+	}
+	l, err := leases.Consume(consumer)
+	if err != nil {
+		logger.Info("CNS is unreachable and no IP lease could be consumed", zap.Error(err))
+		return nil, cnsErr
+	}
+	logger.Info("CNS is unreachable, consumed IP lease", zap.String("lease", l.ID), zap.Any("podIPInfo", l.PodIPInfo))
+	return l.Response(), nil
+}
+
+// ReleaseLease releases the IP lease consumed by the container, and reports whether there was one. It's called on every
+// DEL, whether CNS is reachable or not, so that CNS never adopts the lease of a deleted pod and frees its IPs instead.
+// A nil cache disables leases.
+func ReleaseLease(leases *lease.Cache, containerID string, logger *zap.Logger) bool {
+	if leases == nil {
+		return false
+	}
+	released, err := leases.Release(containerID)
+	if err != nil {
+		logger.Error("Failed to release IP lease", zap.String("containerID", containerID), zap.Error(err))
+		return false
+	}
+	if released {
+		logger.Info("Released IP lease", zap.String("containerID", containerID))
+	}
+	return released
+}
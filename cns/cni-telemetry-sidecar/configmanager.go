@@ -33,6 +33,9 @@ type SidecarTelemetrySettings struct {
 	EnableCNITelemetry bool `json:"EnableCNITelemetry"`
 	// Path to the CNI telemetry socket file that azure-vnet CNI connects to
 	CNITelemetrySocketPath string `json:"CNITelemetrySocketPath"`
+	// Address to serve Prometheus metrics aggregated from CNI operations on, e.g. ":10093".
+	// Metrics are not served if empty.
+	CNIMetricsAddress string `json:"CNIMetricsAddress"`
 }
 
 // SidecarConfig wraps the sidecar-specific telemetry settings.
@@ -0,0 +1,144 @@
+// Copyright Microsoft. All rights reserved.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Azure/azure-container-networking/errcode"
+	"github.com/Azure/azure-container-networking/otlp"
+	"github.com/Azure/azure-container-networking/telemetry"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+const (
+	commandLabel     = "command"
+	modeLabel        = "mode"
+	resultLabel      = "result"
+	resultCodeLabel  = "result_code"
+	failedPhaseLabel = "failed_phase"
+	phaseLabel       = "phase"
+	errorCodeLabel   = "error_code"
+	retryLabel       = "retry"
+
+	resultSuccess = "success"
+	resultFailure = "failure"
+
+	metricsShutdownTimeout = 5 * time.Second
+	metricsReadTimeout     = 10 * time.Second
+)
+
+// operationMetrics aggregates CNI operation records into Prometheus metrics.
+type operationMetrics struct {
+	duration      *prometheus.HistogramVec
+	phaseDuration *prometheus.HistogramVec
+	operations    *prometheus.CounterVec
+	failures      *prometheus.CounterVec
+}
+
+func newOperationMetrics(reg prometheus.Registerer) *operationMetrics {
+	m := &operationMetrics{
+		duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name: "cni_operation_duration_seconds",
+				Help: "CNI operation latency in seconds by command, network mode and result.",
+				//nolint:gomnd // default bucket consts
+				Buckets: prometheus.ExponentialBuckets(0.001, 2, 16), // 1 ms to ~32 seconds
+			},
+			[]string{commandLabel, modeLabel, resultLabel},
+		),
+		phaseDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name: "cni_operation_phase_duration_seconds",
+				Help: "Time spent in each phase of a CNI operation in seconds by command and phase.",
+				//nolint:gomnd // default bucket consts
+				Buckets: prometheus.ExponentialBuckets(0.001, 2, 16), // 1 ms to ~32 seconds
+			},
+			[]string{commandLabel, phaseLabel},
+		),
+		operations: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "cni_operations_total",
+				Help: "Count of CNI operations by command, network mode, CNI result code and the phase which failed.",
+			},
+			[]string{commandLabel, modeLabel, resultCodeLabel, failedPhaseLabel},
+		),
+		failures: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "cni_operation_failures_total",
+				Help: "Count of failed CNI operations by command, error code and its retry hint, which tells transient from permanent failures.",
+			},
+			[]string{commandLabel, errorCodeLabel, retryLabel},
+		),
+	}
+	reg.MustRegister(m.duration, m.phaseDuration, m.operations, m.failures)
+	return m
+}
+
+func (m *operationMetrics) observe(op telemetry.CNIOperation) {
+	result := resultSuccess
+	if op.ResultCode != 0 {
+		result = resultFailure
+	}
+	m.duration.WithLabelValues(op.Command, op.Mode, result).Observe(op.DurationSeconds)
+	for phase, seconds := range op.PhaseSeconds {
+		m.phaseDuration.WithLabelValues(op.Command, phase).Observe(seconds)
+	}
+	m.operations.WithLabelValues(op.Command, op.Mode, strconv.Itoa(op.ResultCode), op.FailedPhase).Inc()
+	if op.ResultCode != 0 {
+		code := errcode.Code(op.ErrorCode)
+		if code == "" {
+			code = errcode.Unknown
+		}
+		m.failures.WithLabelValues(op.Command, string(code), string(code.Retry())).Inc()
+	}
+}
+
+// serveMetrics serves the registry on address until ctx is cancelled.
+func serveMetrics(ctx context.Context, address string, reg *prometheus.Registry, logger *zap.Logger) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	srv := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: metricsReadTimeout,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Warn("Failed to shut down metrics server", zap.Error(err))
+		}
+	}()
+
+	go func() {
+		logger.Info("Serving CNI metrics", zap.String("address", address))
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Metrics server failed", zap.Error(fmt.Errorf("listen on %s: %w", address, err)))
+		}
+	}()
+}
+
+// exportMetrics exports the CNI operation metrics to an OpenTelemetry collector until the context is done.
+func exportMetrics(ctx context.Context, cfg *otlp.Config, reg *prometheus.Registry, logger *zap.Logger) {
+	exporter, err := otlp.NewExporter(cfg, pluginName)
+	if err != nil {
+		logger.Error("Failed to create the OTLP metrics exporter", zap.Error(err))
+		return
+	}
+	go func() {
+		defer exporter.Close()
+		logger.Info("Exporting CNI metrics over OTLP", zap.String("endpoint", cfg.Endpoint))
+		otlp.NewMetricsBridge(reg, exporter).Run(ctx, func(err error) {
+			logger.Warn("Failed to export CNI metrics over OTLP", zap.Error(err))
+		})
+	}()
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-container-networking/telemetry"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperationMetricsObserve(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := newOperationMetrics(reg)
+
+	m.observe(telemetry.CNIOperation{
+		Command:         "ADD",
+		Mode:            "transparent",
+		DurationSeconds: 0.2,
+		PhaseSeconds:    map[string]float64{telemetry.PhaseIPAM: 0.1, telemetry.PhaseNetNS: 0.05},
+	})
+	m.observe(telemetry.CNIOperation{
+		Command:         "ADD",
+		Mode:            "transparent",
+		ResultCode:      11,
+		ErrorCode:       "IPPoolExhausted",
+		FailedPhase:     telemetry.PhaseIPAM,
+		DurationSeconds: 1,
+		PhaseSeconds:    map[string]float64{telemetry.PhaseIPAM: 0.9},
+	})
+
+	require.InDelta(t, 1, testutil.ToFloat64(m.operations.WithLabelValues("ADD", "transparent", "0", "")), 0)
+	require.InDelta(t, 1, testutil.ToFloat64(m.operations.WithLabelValues("ADD", "transparent", "11", telemetry.PhaseIPAM)), 0)
+	require.InDelta(t, 1, testutil.ToFloat64(m.failures.WithLabelValues("ADD", "IPPoolExhausted", "Backoff")), 0)
+	require.Equal(t, 1, testutil.CollectAndCount(m.failures))
+	require.Equal(t, 2, testutil.CollectAndCount(m.duration))
+	require.Equal(t, 2, testutil.CollectAndCount(m.phaseDuration))
+}
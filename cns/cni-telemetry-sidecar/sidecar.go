@@ -8,8 +8,10 @@ import (
 	"time"
 
 	"github.com/Azure/azure-container-networking/aitelemetry"
+	"github.com/Azure/azure-container-networking/aitelemetry/spool"
 	"github.com/Azure/azure-container-networking/cns/configuration"
 	"github.com/Azure/azure-container-networking/telemetry"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 )
 
@@ -92,6 +94,9 @@ func (s *TelemetrySidecar) buildTelemetryConfig(cnsConfig *configuration.CNSConf
 		DebugMode:                     ts.DebugMode,
 		GetEnvRetryCount:              defaultGetEnvRetryCount,
 		GetEnvRetryWaitTimeInSecs:     defaultGetEnvRetryWaitTimeInSecs,
+		SpoolDir:                      ts.SpoolDir,
+		SpoolMaxSizeInBytes:           ts.SpoolMaxSizeInBytes,
+		OTLP:                          ts.OTLP,
 	}
 }
 
@@ -112,6 +117,10 @@ func (s *TelemetrySidecar) startTelemetryService(ctx context.Context, config tel
 	}
 
 	s.telemetryBuffer = telemetry.NewTelemetryBuffer(s.logger)
+	// replay the reports which CNI spooled while the telemetry service wasn't running
+	if err := s.telemetryBuffer.EnableSpool(spool.Config{Dir: telemetry.CNISpoolDir}); err != nil {
+		s.logger.Warn("Failed to enable the CNI telemetry spool", zap.Error(err))
+	}
 
 	// Retry starting server with bounded retries and context cancellation
 	for attempt := 0; attempt < maxServerStartRetries; attempt++ {
@@ -153,12 +162,33 @@ func (s *TelemetrySidecar) startTelemetryService(ctx context.Context, config tel
 			DebugMode:                    config.DebugMode,
 			GetEnvRetryCount:             config.GetEnvRetryCount,
 			GetEnvRetryWaitTimeInSecs:    config.GetEnvRetryWaitTimeInSecs,
+			SpoolDir:                     config.SpoolDir,
+			SpoolMaxSizeInBytes:          config.SpoolMaxSizeInBytes,
+			OTLP:                         config.OTLP,
 		}
 		if err := s.telemetryBuffer.CreateAITelemetryHandle(aiConfig, config.DisableAll, config.DisableTrace, config.DisableMetric); err != nil {
 			s.logger.Warn("AppInsights initialization failed, continuing without it", zap.Error(err))
 		}
 	}
 
+	var metricsAddress string
+	if sidecarConfig := s.configManager.GetSidecarConfig(); sidecarConfig != nil {
+		metricsAddress = sidecarConfig.TelemetrySettings.CNIMetricsAddress
+	}
+	if metricsAddress != "" || config.OTLP != nil {
+		reg := prometheus.NewRegistry()
+		s.telemetryBuffer.SetOperationHandler(newOperationMetrics(reg).observe)
+		if metricsAddress != "" {
+			serveMetrics(ctx, metricsAddress, reg, s.logger)
+		}
+		if config.OTLP != nil {
+			exportMetrics(ctx, config.OTLP, reg, s.logger)
+		}
+	}
+	if config.OTLP != nil {
+		relaySpans(ctx, config.OTLP, s.telemetryBuffer, s.logger)
+	}
+
 	s.logger.Info("Telemetry service started",
 		zap.Bool("appInsightsEnabled", telemetry.GetAIMetadata() != ""))
 
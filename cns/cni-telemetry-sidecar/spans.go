@@ -0,0 +1,29 @@
+// Copyright Microsoft. All rights reserved.
+package main
+
+import (
+	"context"
+
+	"github.com/Azure/azure-container-networking/otlp"
+	"github.com/Azure/azure-container-networking/telemetry"
+	"github.com/Azure/azure-container-networking/tracing"
+	"go.uber.org/zap"
+)
+
+// relaySpans exports the spans which CNI sends over the telemetry socket to an OpenTelemetry collector until the
+// context is done.
+func relaySpans(ctx context.Context, cfg *otlp.Config, tb *telemetry.TelemetryBuffer, logger *zap.Logger) {
+	exporter, err := tracing.NewOTLPExporter(cfg, pluginName)
+	if err != nil {
+		logger.Error("Failed to create the OTLP span exporter", zap.Error(err))
+		return
+	}
+	relay := tracing.NewRelay(exporter)
+	tb.SetSpanHandler(relay.Export)
+	go func() {
+		<-ctx.Done()
+		if err := relay.Shutdown(context.Background()); err != nil {
+			logger.Warn("Failed to export CNI spans over OTLP", zap.Error(err))
+		}
+	}()
+}
@@ -12,6 +12,8 @@ import (
 	"github.com/Azure/azure-container-networking/cns/logger"
 	loggerv2 "github.com/Azure/azure-container-networking/cns/logger/v2"
 	"github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/otlp"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/pkg/errors"
 )
 
@@ -34,9 +36,19 @@ type CNSConfig struct {
 	EnableK8sDevicePlugin       bool
 	EnableLoggerV2              bool
 	EnablePprof                 bool
-	EnableStateMigration        bool
-	EnableSubnetScarcity        bool
-	EnableSwiftV2               bool
+	// EnableProgrammedReadinessGate sets the networking.azure.com/programmed condition of pods which have it as a
+	// readiness gate, once NMAgent programmed all of their IPs and, with SWIFT v2, their MTPNC is ready
+	EnableProgrammedReadinessGate bool
+	EnableStateMigration          bool
+	EnableSubnetScarcity          bool
+	EnableSwiftV2                 bool
+	// HostRulesBackend selects how host rules are programmed: iptables (default) or nftables. With nftables, CNS
+	// removes the iptables rules replaced by the azure-cni table at startup, so CNI must select the same backend.
+	HostRulesBackend string
+	// IMDSEndpoint overrides the IMDS endpoint, e.g. to point CNS at an emulator. Defaults to http://169.254.169.254
+	IMDSEndpoint string
+	// IPLeaseCount is how many sets of IPs CNS pre-leases, so that CNI can assign them to pods while CNS is unreachable
+	IPLeaseCount                int
 	InitializeFromCNI           bool
 	KeyVaultSettings            KeyVaultSettings
 	Logger                      loggerv2.Config
@@ -45,6 +57,7 @@ type CNSConfig struct {
 	ManagedSettings             ManagedSettings
 	MellanoxMonitorIntervalSecs int
 	MetricsBindAddress          string
+	NMAgentSettings             NMAgentSettings
 	ProgramSNATIPTables         bool
 	SyncHostNCTimeoutMs         int
 	SyncHostNCVersionIntervalMs int
@@ -89,6 +102,14 @@ type TelemetrySettings struct {
 	ConfigSnapshotIntervalInMins int
 	// AppInsightsInstrumentationKey allows the user to override the default appinsights ikey
 	AppInsightsInstrumentationKey string
+	// SpoolDir enables spooling telemetry to disk while AppInsights is unreachable
+	SpoolDir string
+	// SpoolMaxSizeInBytes caps the size of the telemetry spool
+	SpoolMaxSizeInBytes int64
+	// OTLP exports telemetry and metrics to an OpenTelemetry collector alongside AppInsights
+	OTLP *otlp.Config
+	// Tracing exports the spans of CNS, which continue the traces of CNI commands, to an OpenTelemetry collector
+	Tracing *tracing.Config
 }
 
 type ManagedSettings struct {
@@ -102,6 +123,19 @@ type AZRSettings struct {
 	PopulateHomeAzCacheRetryIntervalSecs int
 }
 
+// NMAgentSettings tune how the NMAgent client behaves while NMAgent is unhealthy.
+// Zero values select the defaults of the client.
+type NMAgentSettings struct {
+	// BreakerThreshold is the number of consecutive failures of an NMAgent API which stops calls to it. Negative disables it.
+	BreakerThreshold int
+	// BreakerCooldownSecs is how long calls to a failing API are stopped before one is let through to probe it
+	BreakerCooldownSecs int
+	// RetryBudget is the number of retry tokens shared by all NMAgent calls. Negative disables it.
+	RetryBudget float64
+	// HedgeDelayMs is how long a GET to NMAgent waits before a second, hedged request is sent. Zero disables hedging.
+	HedgeDelayMs int
+}
+
 type MSISettings struct {
 	ResourceID string
 }
@@ -242,7 +276,7 @@ func SetCNSConfigDefaults(config *CNSConfig) {
 		config.MinTLSVersion = "TLS 1.2"
 	}
 	config.GRPCSettings.Enable = false
-	config.WatchPods = config.EnableIPAMv2 || config.EnableSwiftV2
+	config.WatchPods = config.EnableIPAMv2 || config.EnableSwiftV2 || config.EnableProgrammedReadinessGate
 }
 
 // isStalessCNIMode verify if the CNI is running stateless mode
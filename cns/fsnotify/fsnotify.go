@@ -5,6 +5,7 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -51,13 +52,21 @@ func New(cli ReleaseIPsClient, path string, logger *zap.Logger) (*watcher, error
 // invocation of CNS. This is okay because calling releaseIP on an already
 // processed containerID is a no-op, and we may be able to delete the file
 // during that future retry.
+// A file which no longer exists was removed by CNI GC after it released the
+// IPs of the containerID, so it's dropped from the map without calling CNS.
 func (w *watcher) releaseAll(ctx context.Context) {
 	w.lock.Lock()
 	defer w.lock.Unlock()
+	defer func() { pendingDeleteCount.Set(float64(len(w.pendingDelete))) }()
 	for containerID := range w.pendingDelete {
 		// read file contents
-		filepath := w.path + "/" + containerID
-		file, err := os.Open(filepath)
+		file, err := os.Open(w.path + "/" + containerID)
+		if errors.Is(err, fs.ErrNotExist) {
+			w.log.Info("missed delete was reconciled by GC", zap.String("containerID", containerID))
+			pendingDeleteProcessedCount.WithLabelValues(resultReconciled).Inc()
+			delete(w.pendingDelete, containerID)
+			continue
+		}
 		if err != nil {
 			w.log.Error("failed to open file", zap.Error(err))
 		}
@@ -72,9 +81,11 @@ func (w *watcher) releaseAll(ctx context.Context) {
 		w.log.Info("releasing IP for missed delete", zap.String("podInterfaceID", podInterfaceID), zap.String("containerID", containerID))
 		if err := w.releaseIP(ctx, podInterfaceID, containerID); err != nil {
 			w.log.Error("failed to release IP for missed delete", zap.String("containerID", containerID), zap.Error(err))
+			pendingDeleteProcessedCount.WithLabelValues(resultFailed).Inc()
 			continue
 		}
 		w.log.Info("successfully released IP for missed delete", zap.String("containerID", containerID))
+		pendingDeleteProcessedCount.WithLabelValues(resultReleased).Inc()
 		delete(w.pendingDelete, containerID)
 		if err := removeFile(containerID, w.path); err != nil {
 			w.log.Error("failed to remove file for missed delete", zap.Error(err))
@@ -135,6 +146,7 @@ func (w *watcher) watchFS(ctx context.Context) error {
 		w.log.Info("adding missed delete from file", zap.String("name", file.Name()))
 		w.pendingDelete[file.Name()] = struct{}{}
 	}
+	pendingDeleteCount.Set(float64(len(w.pendingDelete)))
 	w.lock.Unlock()
 
 	// Start listening for events.
@@ -153,7 +165,9 @@ func (w *watcher) watchFS(ctx context.Context) error {
 			}
 			w.log.Info("received create event", zap.String("event", event.Name))
 			w.lock.Lock()
-			w.pendingDelete[event.Name] = struct{}{}
+			// the event name is the path of the file, which is named by the containerID
+			w.pendingDelete[filepath.Base(event.Name)] = struct{}{}
+			pendingDeleteCount.Set(float64(len(w.pendingDelete)))
 			w.lock.Unlock()
 		case watcherErr := <-watcher.Errors:
 			w.log.Error("fsnotify watcher error", zap.Error(watcherErr))
@@ -1,13 +1,25 @@
 package fsnotify
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/Azure/azure-container-networking/cns"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 )
 
+type fakeReleaseIPsClient struct {
+	released []string
+}
+
+func (c *fakeReleaseIPsClient) ReleaseIPs(_ context.Context, ipconfig cns.IPConfigsRequest) error {
+	c.released = append(c.released, ipconfig.InfraContainerID)
+	return nil
+}
+
 func TestAddFile(t *testing.T) {
 	type args struct {
 		podInterfaceID string
@@ -100,3 +112,19 @@ func TestWatcherRemoveFile(t *testing.T) {
 		})
 	}
 }
+
+func TestReleaseAllSkipsReconciled(t *testing.T) {
+	cli := &fakeReleaseIPsClient{}
+	w, err := New(cli, t.TempDir(), zap.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, AddFile("pod-eth0", "missed", w.path))
+	// the file of a missed delete is removed by CNI GC once it has released the IPs
+	w.pendingDelete["missed"] = struct{}{}
+	w.pendingDelete["reconciled"] = struct{}{}
+
+	w.releaseAll(context.Background())
+	require.Equal(t, []string{"missed"}, cli.released)
+	require.Empty(t, w.pendingDelete)
+	_, err = os.Stat(filepath.Join(w.path, "missed"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,35 @@
+package fsnotify
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	pendingDeleteCount = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "async_pod_delete_pending",
+			Help: "Number of missed Pod deletes whose IPs are pending release",
+		},
+	)
+	pendingDeleteProcessedCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "async_pod_delete_processed_total",
+			Help: "Count of processed missed Pod deletes, by result: released, failed, or reconciled when CNI GC released the IPs first",
+		},
+		[]string{"result"},
+	)
+)
+
+const (
+	resultReleased   = "released"
+	resultFailed     = "failed"
+	resultReconciled = "reconciled"
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		pendingDeleteCount,
+		pendingDeleteProcessedCount,
+	)
+}
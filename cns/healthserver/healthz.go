@@ -74,3 +74,18 @@ func NewHealthzHandlerWithChecks(cfg *Config) (http.Handler, error) {
 		Checks: checks,
 	}, nil
 }
+
+// NewReadyzHandler will return a [http.Handler] for CNS's /readyz endpoint, which fails until ready passes.
+// If breakers is set, it also fails while calls to any NMAgent endpoint are stopped by its circuit breaker.
+// An open breaker doesn't fail /healthz, since restarting CNS doesn't help NMAgent recover.
+func NewReadyzHandler(ready healthz.Checker, breakers NMAgentBreakers) http.Handler {
+	checks := map[string]healthz.Checker{
+		"ready": ready,
+	}
+	if breakers != nil {
+		checks["nmagent"] = nmagentCheck(breakers)
+	}
+	return &healthz.Handler{
+		Checks: checks,
+	}
+}
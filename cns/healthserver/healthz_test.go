@@ -1,12 +1,14 @@
 package healthserver
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
 
+	"github.com/Azure/azure-container-networking/nmagent"
 	"github.com/stretchr/testify/require"
 	meta "k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -219,6 +221,53 @@ func TestNewHealthzHandlerWithChecks(t *testing.T) {
 	}
 }
 
+func TestNewReadyzHandler(t *testing.T) {
+	ready := func(*http.Request) error { return nil }
+	notReady := func(*http.Request) error { return errors.New("not ready") }
+
+	tests := []struct {
+		name          string
+		ready         func(*http.Request) error
+		breakers      NMAgentBreakers
+		expectedReady bool
+	}{
+		{
+			name:          "not ready before startup completes",
+			ready:         notReady,
+			expectedReady: false,
+		},
+		{
+			name:          "closed and half-open nmagent breakers should indicate ready",
+			ready:         ready,
+			breakers:      fakeBreakers{"GetNCVersionList": nmagent.BreakerClosed, "GetHomeAz": nmagent.BreakerHalfOpen},
+			expectedReady: true,
+		},
+		{
+			name:          "an open nmagent breaker should be not ready",
+			ready:         ready,
+			breakers:      fakeBreakers{"GetNCVersionList": nmagent.BreakerOpen, "GetHomeAz": nmagent.BreakerClosed},
+			expectedReady: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responseRecorder := httptest.NewRecorder()
+			readyHandler := http.StripPrefix("/readyz", NewReadyzHandler(tt.ready, tt.breakers))
+
+			readyHandler.ServeHTTP(responseRecorder, httptest.NewRequest("GET", "/readyz", http.NoBody))
+
+			require.Equal(t, tt.expectedReady, responseRecorder.Code == http.StatusOK)
+		})
+	}
+}
+
+type fakeBreakers map[string]nmagent.BreakerState
+
+func (f fakeBreakers) BreakerStates() map[string]nmagent.BreakerState {
+	return f
+}
+
 func configureLocalAPIServer(t *testing.T, expectedNNCStatusCode int) {
 	// setup apiserver
 	server := setupMockAPIServer(expectedNNCStatusCode)
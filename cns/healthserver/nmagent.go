@@ -0,0 +1,76 @@
+package healthserver
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/nmagent"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// NMAgentBreakers reports the circuit breaker state of every NMAgent endpoint, as the nmagent.Client does.
+type NMAgentBreakers interface {
+	BreakerStates() map[string]nmagent.BreakerState
+}
+
+var (
+	nmagentBreakerState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "nmagent_breaker_state",
+			Help: "Circuit breaker state of NMAgent endpoints, 1 for the current state and 0 otherwise",
+		},
+		[]string{"endpoint", "state"},
+	)
+	nmagentHedgedRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "nmagent_hedged_requests_total",
+			Help: "Count of hedged requests sent to NMAgent endpoints",
+		},
+		[]string{"endpoint"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		nmagentBreakerState,
+		nmagentHedgedRequests,
+	)
+}
+
+// ObserveNMAgentBreaker records a circuit breaker state change of an NMAgent endpoint.
+// It is meant to be used as the OnBreakerStateChange of the nmagent.ClientPolicy.
+func ObserveNMAgentBreaker(endpoint string, state nmagent.BreakerState) {
+	for _, s := range []nmagent.BreakerState{nmagent.BreakerClosed, nmagent.BreakerOpen, nmagent.BreakerHalfOpen} {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		nmagentBreakerState.WithLabelValues(endpoint, string(s)).Set(value)
+	}
+}
+
+// ObserveNMAgentHedge counts a hedged request to an NMAgent endpoint.
+// It is meant to be used as the OnHedge of the nmagent.ClientPolicy.
+func ObserveNMAgentHedge(endpoint string) {
+	nmagentHedgedRequests.WithLabelValues(endpoint).Inc()
+}
+
+// nmagentCheck fails while the breaker of any NMAgent endpoint is open, i.e. while CNS has stopped calling it.
+func nmagentCheck(breakers NMAgentBreakers) func(*http.Request) error {
+	return func(*http.Request) error {
+		var open []string
+		for endpoint, state := range breakers.BreakerStates() {
+			if state == nmagent.BreakerOpen {
+				open = append(open, endpoint)
+			}
+		}
+		if len(open) == 0 {
+			return nil
+		}
+		sort.Strings(open)
+		return errors.Errorf("nmagent circuit breaker open for %s", strings.Join(open, ", "))
+	}
+}
@@ -15,9 +15,11 @@ import (
 	"github.com/Azure/azure-container-networking/cns/types"
 	"github.com/Azure/azure-container-networking/crd/clustersubnetstate/api/v1alpha1"
 	"github.com/Azure/azure-container-networking/crd/nodenetworkconfig/api/v1alpha"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/avast/retry-go/v4"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -52,6 +54,8 @@ type metaState struct {
 type Options struct {
 	RefreshDelay time.Duration
 	MaxIPs       int64
+	// Traces are the IP requests which the Monitor continues the traces of when it scales the pool.
+	Traces *tracing.Pending
 }
 
 type Monitor struct {
@@ -153,7 +157,10 @@ func (pm *Monitor) Start(ctx context.Context) error {
 			})
 		}
 		// if control has flowed through the select(s) to this point, we can now reconcile.
-		err := pm.reconcile(ctx)
+		// the reconcile continues the traces of the IP requests it scales the pool for.
+		reconcileCtx, span := pm.opts.Traces.Start(ctx, "ipampool.reconcile")
+		err := pm.reconcile(reconcileCtx)
+		tracing.End(span, err)
 		if err != nil {
 			logger.Printf("[ipam-pool-monitor] Reconcile failed with err %v", err)
 		}
@@ -284,7 +291,7 @@ func (pm *Monitor) increasePoolSize(ctx context.Context, meta metaState, state i
 
 	logger.Printf("[ipam-pool-monitor] Increasing pool size, pool %+v, spec %+v", state, tempNNCSpec)
 
-	if _, err := pm.nnccli.PatchSpec(ctx, &tempNNCSpec, fieldManager); err != nil {
+	if err := pm.patchSpec(ctx, &tempNNCSpec); err != nil {
 		// caller will retry to update the CRD again
 		return errors.Wrap(err, "executing UpdateSpec with NNC client")
 	}
@@ -350,7 +357,7 @@ func (pm *Monitor) decreasePoolSize(ctx context.Context, meta metaState, state i
 	attempts := 0
 	if err := retry.Do(func() error {
 		attempts++
-		_, err := pm.nnccli.PatchSpec(ctx, &tempNNCSpec, fieldManager)
+		err := pm.patchSpec(ctx, &tempNNCSpec)
 		if err != nil {
 			// caller will retry to update the CRD again
 			logger.Printf("failed to update NNC spec attempt #%d, err: %v", attempts, err)
@@ -381,7 +388,7 @@ func (pm *Monitor) decreasePoolSize(ctx context.Context, meta metaState, state i
 func (pm *Monitor) cleanPendingRelease(ctx context.Context) error {
 	tempNNCSpec := pm.createNNCSpecForCRD()
 
-	_, err := pm.nnccli.PatchSpec(ctx, &tempNNCSpec, fieldManager)
+	err := pm.patchSpec(ctx, &tempNNCSpec)
 	if err != nil {
 		// caller will retry to update the CRD again
 		return errors.Wrap(err, "executing UpdateSpec with NNC client")
@@ -395,6 +402,14 @@ func (pm *Monitor) cleanPendingRelease(ctx context.Context) error {
 }
 
 // createNNCSpecForCRD translates CNS's map of IPs to be released and requested IP count into an NNC Spec.
+// patchSpec patches the NodeNetworkConfig spec in a child span of the reconcile.
+func (pm *Monitor) patchSpec(ctx context.Context, spec *v1alpha.NodeNetworkConfigSpec) error {
+	ctx, span := tracing.Start(ctx, "ipampool.PatchSpec", attribute.Int64("nnc.requested_ip_count", spec.RequestedIPCount))
+	_, err := pm.nnccli.PatchSpec(ctx, spec, fieldManager)
+	tracing.End(span, err)
+	return err //nolint:wrapcheck // wrapped by the callers
+}
+
 func (pm *Monitor) createNNCSpecForCRD() v1alpha.NodeNetworkConfigSpec {
 	var spec v1alpha.NodeNetworkConfigSpec
 
@@ -9,7 +9,9 @@ import (
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/crd/clustersubnetstate/api/v1alpha1"
 	"github.com/Azure/azure-container-networking/crd/nodenetworkconfig/api/v1alpha"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
@@ -49,6 +51,7 @@ type Monitor struct {
 	started               chan interface{}
 	once                  sync.Once
 	legacyMetricsObserver func(context.Context) error
+	traces                *tracing.Pending
 }
 
 func NewMonitor(z *zap.Logger, store ipStateStore, nnccli nodeNetworkConfigSpecUpdater, demandSource <-chan int, nncSource <-chan v1alpha.NodeNetworkConfig, cssSource <-chan v1alpha1.ClusterSubnetState) *Monitor { //nolint:lll // it's fine
@@ -100,7 +103,11 @@ func (pm *Monitor) Start(ctx context.Context) error {
 			continue // jumps to the next iteration of the outer for-loop
 		}
 		// if control has flowed through the select(s) to this point, we can now reconcile.
-		if err := pm.reconcile(ctx); err != nil {
+		// the reconcile continues the traces of the IP requests it scales the pool for.
+		reconcileCtx, span := pm.traces.Start(ctx, "ipampool.reconcile")
+		err := pm.reconcile(reconcileCtx)
+		tracing.End(span, err)
+		if err != nil {
 			pm.z.Error("reconcile failed", zap.Error(err))
 		}
 		if err := pm.legacyMetricsObserver(ctx); err != nil {
@@ -133,7 +140,10 @@ func (pm *Monitor) reconcile(ctx context.Context) error {
 		return errors.Wrapf(err, "failed to mark sufficient IPs as PendingRelease, wanted %d", pm.request-target)
 	}
 	spec := pm.buildNNCSpec(target)
-	if _, err := pm.nnccli.PatchSpec(ctx, &spec, fieldManager); err != nil {
+	patchCtx, span := tracing.Start(ctx, "ipampool.PatchSpec", attribute.Int64("nnc.requested_ip_count", spec.RequestedIPCount))
+	_, err := pm.nnccli.PatchSpec(patchCtx, &spec, fieldManager)
+	tracing.End(span, err)
+	if err != nil {
 		return errors.Wrap(err, "failed to UpdateSpec with NNC client")
 	}
 	pm.request = target
@@ -159,6 +169,11 @@ func (pm *Monitor) WithLegacyMetricsObserver(observer func(context.Context) erro
 	pm.legacyMetricsObserver = observer
 }
 
+// WithTraces sets the IP requests which the Monitor continues the traces of when it scales the pool.
+func (pm *Monitor) WithTraces(traces *tracing.Pending) {
+	pm.traces = traces
+}
+
 // calculateTargetIPCountOrMax calculates the target IP count request
 // using the scaling function and clamps the result at the max IPs.
 func calculateTargetIPCountOrMax(demand, batch, max int64, buffer float64) int64 {
@@ -0,0 +1,238 @@
+package pod
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns/configuration"
+	"github.com/Azure/azure-container-networking/crd/multitenancy/api/v1alpha1"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// ProgrammedCondition is the readiness gate condition of Pods which shouldn't become Ready before the network of their
+// IPs is programmed. Pods opt in by listing it in spec.readinessGates.
+const ProgrammedCondition v1.PodConditionType = "networking.azure.com/programmed"
+
+const (
+	reasonProgrammed          = "Programmed"
+	reasonProgrammingPending  = "ProgrammingPending"
+	reasonDelegatedNICPending = "DelegatedNICPending"
+
+	// maxReadinessBackoff caps the delay before a Pod whose network isn't programmed yet is checked again
+	maxReadinessBackoff = 30 * time.Second
+)
+
+type programmedChecker interface {
+	// PodIPsProgrammed reports whether IPs are assigned to the Pod and whether all of them are programmed.
+	PodIPsProgrammed(podName, podNamespace string) (assigned, programmed bool)
+}
+
+type readinessGateCli interface {
+	Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error
+	Status() client.SubResourceWriter
+}
+
+// ReadinessGate sets the ProgrammedCondition of Pods which have it as a readiness gate once all of their IPs are
+// programmed and, for SWIFT v2 Pods, once their MTPNC reports the delegated NICs as programmed.
+type ReadinessGate struct {
+	z       *zap.Logger
+	cli     readinessGateCli
+	checker programmedChecker
+	swiftV2 bool
+	backoff workqueue.TypedRateLimiter[reconcile.Request]
+}
+
+// NewReadinessGate returns a ReadinessGate. As CNS doesn't watch the programming state, Pods which aren't programmed
+// yet are checked again with an exponential backoff starting at baseBackoff. If swiftV2 is set, the MTPNCs of SWIFT v2
+// Pods are watched and gate them too.
+func NewReadinessGate(z *zap.Logger, checker programmedChecker, swiftV2 bool, baseBackoff time.Duration) *ReadinessGate {
+	return &ReadinessGate{
+		z:       z.With(zap.String("component", "pod-readiness-gate")),
+		checker: checker,
+		swiftV2: swiftV2,
+		backoff: workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](baseBackoff, max(baseBackoff, maxReadinessBackoff)),
+	}
+}
+
+func (r *ReadinessGate) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	pod := &v1.Pod{}
+	if err := r.cli.Get(ctx, req.NamespacedName, pod); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.backoff.Forget(req)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, errors.Wrap(err, "failed to get pod")
+	}
+	if !gated(pod) {
+		r.backoff.Forget(req)
+		return ctrl.Result{}, nil
+	}
+
+	reason, err := r.pendingReason(ctx, pod)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	status := v1.ConditionFalse
+	if reason == reasonProgrammed {
+		status = v1.ConditionTrue
+	}
+	if err := r.setCondition(ctx, pod, status, reason); err != nil {
+		return ctrl.Result{}, err
+	}
+	if status != v1.ConditionTrue {
+		return ctrl.Result{RequeueAfter: r.backoff.When(req)}, nil
+	}
+	r.backoff.Forget(req)
+	r.z.Info("pod network is programmed", zap.String("pod", req.NamespacedName.String()))
+	return ctrl.Result{}, nil
+}
+
+// pendingReason returns the reason for the ProgrammedCondition of the Pod, which is reasonProgrammed once nothing is
+// pending.
+func (r *ReadinessGate) pendingReason(ctx context.Context, pod *v1.Pod) (string, error) {
+	// host network Pods don't have IPs to program
+	if pod.Spec.HostNetwork {
+		return reasonProgrammed, nil
+	}
+	if _, programmed := r.checker.PodIPsProgrammed(pod.Name, pod.Namespace); !programmed {
+		return reasonProgrammingPending, nil
+	}
+	if !r.swiftV2 || !isSwiftV2Pod(pod) {
+		return reasonProgrammed, nil
+	}
+	programmed, err := r.delegatedNICsProgrammed(ctx, pod)
+	if err != nil {
+		return "", err
+	}
+	if !programmed {
+		return reasonDelegatedNICPending, nil
+	}
+	return reasonProgrammed, nil
+}
+
+// delegatedNICsProgrammed reports whether the MTPNC of the SWIFT v2 Pod is Ready and the InfiniBand devices of its
+// interfaces are programmed.
+func (r *ReadinessGate) delegatedNICsProgrammed(ctx context.Context, pod *v1.Pod) (bool, error) {
+	mtpnc := &v1alpha1.MultitenantPodNetworkConfig{}
+	if err := r.cli.Get(ctx, client.ObjectKeyFromObject(pod), mtpnc); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "failed to get mtpnc")
+	}
+	if !mtpnc.IsReady() || mtpnc.IsDeleting() {
+		return false, nil
+	}
+	// MTPNCs written before the status field was added are Ready once their status is populated
+	if mtpnc.Status.Status != "" && mtpnc.Status.Status != v1alpha1.MTPNCStatusReady {
+		return false, nil
+	}
+	for _, info := range mtpnc.Status.InterfaceInfos {
+		if info.DeviceType == v1alpha1.DeviceTypeInfiniBandNIC && info.IBStatus != v1alpha1.Programmed {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// setCondition patches the ProgrammedCondition of the Pod, unless it already has the status and reason.
+func (r *ReadinessGate) setCondition(ctx context.Context, pod *v1.Pod, status v1.ConditionStatus, reason string) error {
+	if cond := podCondition(pod, ProgrammedCondition); cond != nil && cond.Status == status && cond.Reason == reason {
+		return nil
+	}
+	patch := client.StrategicMergeFrom(pod.DeepCopy())
+	cond := v1.PodCondition{
+		Type:               ProgrammedCondition,
+		Status:             status,
+		Reason:             reason,
+		LastTransitionTime: metav1.Now(),
+	}
+	if existing := podCondition(pod, ProgrammedCondition); existing != nil {
+		if existing.Status == status {
+			cond.LastTransitionTime = existing.LastTransitionTime
+		}
+		*existing = cond
+	} else {
+		pod.Status.Conditions = append(pod.Status.Conditions, cond)
+	}
+	if err := r.cli.Status().Patch(ctx, pod, patch); err != nil {
+		return errors.Wrapf(err, "failed to set %s condition of pod", ProgrammedCondition)
+	}
+	return nil
+}
+
+// SetupWithManager sets up the ReadinessGate as its own Pod controller, so that Pods waiting on their network don't
+// hold up the Pod watcher.
+func (r *ReadinessGate) SetupWithManager(mgr ctrl.Manager) error {
+	r.cli = mgr.GetClient()
+	b := ctrl.NewControllerManagedBy(mgr).
+		Named("pod-readiness-gate").
+		For(&v1.Pod{}, builder.WithPredicates(predicate.Funcs{
+			CreateFunc: func(e event.CreateEvent) bool {
+				return gated(e.Object)
+			},
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				return gated(e.ObjectNew)
+			},
+			DeleteFunc: func(event.DeleteEvent) bool {
+				return false
+			},
+			GenericFunc: func(event.GenericEvent) bool {
+				return false
+			},
+		}))
+	if r.swiftV2 {
+		// MTPNCs have the name and namespace of their Pod
+		b = b.Watches(&v1alpha1.MultitenantPodNetworkConfig{}, &handler.EnqueueRequestForObject{})
+	}
+	if err := b.Complete(r); err != nil {
+		return errors.Wrap(err, "failed to set up pod readiness gate with manager")
+	}
+	return nil
+}
+
+// gated reports whether the Pod has the ProgrammedCondition as a readiness gate which isn't met yet.
+func gated(o client.Object) bool {
+	pod, ok := o.(*v1.Pod)
+	if !ok || pod.DeletionTimestamp != nil || !hasReadinessGate(pod, ProgrammedCondition) {
+		return false
+	}
+	cond := podCondition(pod, ProgrammedCondition)
+	return cond == nil || cond.Status != v1.ConditionTrue
+}
+
+func isSwiftV2Pod(pod *v1.Pod) bool {
+	_, podNetwork := pod.Labels[configuration.LabelPodSwiftV2]
+	_, podNetworkInstance := pod.Labels[configuration.LabelPodNetworkInstanceSwiftV2]
+	return podNetwork || podNetworkInstance
+}
+
+func hasReadinessGate(pod *v1.Pod, condition v1.PodConditionType) bool {
+	for _, gate := range pod.Spec.ReadinessGates {
+		if gate.ConditionType == condition {
+			return true
+		}
+	}
+	return false
+}
+
+func podCondition(pod *v1.Pod, condition v1.PodConditionType) *v1.PodCondition {
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type == condition {
+			return &pod.Status.Conditions[i]
+		}
+	}
+	return nil
+}
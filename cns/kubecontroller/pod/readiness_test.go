@@ -0,0 +1,170 @@
+package pod
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns/configuration"
+	"github.com/Azure/azure-container-networking/crd/multitenancy/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// mockCli serves a single Pod and its MTPNC, and stores the Pod its status is patched to.
+type mockCli struct {
+	pod     *v1.Pod
+	mtpnc   *v1alpha1.MultitenantPodNetworkConfig
+	patches int
+}
+
+func (m *mockCli) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	switch o := obj.(type) {
+	case *v1.Pod:
+		if m.pod != nil && key.Name == m.pod.Name && key.Namespace == m.pod.Namespace {
+			m.pod.DeepCopyInto(o)
+			return nil
+		}
+	case *v1alpha1.MultitenantPodNetworkConfig:
+		if m.mtpnc != nil && key.Name == m.mtpnc.Name && key.Namespace == m.mtpnc.Namespace {
+			m.mtpnc.DeepCopyInto(o)
+			return nil
+		}
+	}
+	return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+}
+
+func (m *mockCli) Status() client.SubResourceWriter {
+	return m
+}
+
+func (*mockCli) Create(context.Context, client.Object, client.Object, ...client.SubResourceCreateOption) error {
+	return nil
+}
+
+func (*mockCli) Update(context.Context, client.Object, ...client.SubResourceUpdateOption) error {
+	return nil
+}
+
+func (m *mockCli) Patch(_ context.Context, obj client.Object, _ client.Patch, _ ...client.SubResourcePatchOption) error {
+	m.patches++
+	m.pod = obj.(*v1.Pod).DeepCopy()
+	return nil
+}
+
+type mockChecker struct {
+	assigned, programmed bool
+}
+
+func (m *mockChecker) PodIPsProgrammed(string, string) (assigned, programmed bool) {
+	return m.assigned, m.programmed
+}
+
+func testPod(gated bool) *v1.Pod {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default"}}
+	if gated {
+		pod.Spec.ReadinessGates = []v1.PodReadinessGate{{ConditionType: ProgrammedCondition}}
+	}
+	return pod
+}
+
+func TestReadinessGate(t *testing.T) {
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "pod", Namespace: "default"}}
+	cli := &mockCli{pod: testPod(true)}
+	checker := &mockChecker{}
+	r := NewReadinessGate(zap.NewNop(), checker, false, time.Second)
+	r.cli = cli
+
+	// no IPs are assigned yet
+	res, err := r.Reconcile(context.Background(), req)
+	require.NoError(t, err)
+	require.Equal(t, time.Second, res.RequeueAfter)
+	require.Equal(t, v1.ConditionFalse, podCondition(cli.pod, ProgrammedCondition).Status)
+
+	// the condition is only patched when it changes, and the Pod is checked again with a backoff
+	checker.assigned = true
+	res, err = r.Reconcile(context.Background(), req)
+	require.NoError(t, err)
+	require.Equal(t, 2*time.Second, res.RequeueAfter)
+	require.Equal(t, 1, cli.patches)
+
+	checker.programmed = true
+	res, err = r.Reconcile(context.Background(), req)
+	require.NoError(t, err)
+	require.True(t, res.IsZero())
+	require.Equal(t, v1.ConditionTrue, podCondition(cli.pod, ProgrammedCondition).Status)
+	require.Equal(t, reasonProgrammed, podCondition(cli.pod, ProgrammedCondition).Reason)
+	require.Len(t, cli.pod.Status.Conditions, 1)
+	require.Equal(t, 2, cli.patches)
+	require.Zero(t, r.backoff.NumRequeues(req))
+}
+
+func TestReadinessGateSwiftV2(t *testing.T) {
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "pod", Namespace: "default"}}
+	pod := testPod(true)
+	pod.Labels = map[string]string{configuration.LabelPodSwiftV2: "podnetwork"}
+	cli := &mockCli{pod: pod}
+	r := NewReadinessGate(zap.NewNop(), &mockChecker{assigned: true, programmed: true}, true, time.Second)
+	r.cli = cli
+
+	// the MTPNC doesn't exist yet
+	res, err := r.Reconcile(context.Background(), req)
+	require.NoError(t, err)
+	require.NotZero(t, res.RequeueAfter)
+	require.Equal(t, reasonDelegatedNICPending, podCondition(cli.pod, ProgrammedCondition).Reason)
+
+	// the InfiniBand device of the delegated NIC isn't programmed yet
+	cli.mtpnc = &v1alpha1.MultitenantPodNetworkConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default"},
+		Status: v1alpha1.MultitenantPodNetworkConfigStatus{
+			Status: v1alpha1.MTPNCStatusReady,
+			InterfaceInfos: []v1alpha1.InterfaceInfo{
+				{NCID: "vnet", DeviceType: v1alpha1.DeviceTypeVnetNIC},
+				{NCID: "ib", DeviceType: v1alpha1.DeviceTypeInfiniBandNIC, IBStatus: v1alpha1.Programming},
+			},
+		},
+	}
+	res, err = r.Reconcile(context.Background(), req)
+	require.NoError(t, err)
+	require.NotZero(t, res.RequeueAfter)
+	require.Equal(t, v1.ConditionFalse, podCondition(cli.pod, ProgrammedCondition).Status)
+
+	cli.mtpnc.Status.InterfaceInfos[1].IBStatus = v1alpha1.Programmed
+	res, err = r.Reconcile(context.Background(), req)
+	require.NoError(t, err)
+	require.True(t, res.IsZero())
+	require.Equal(t, v1.ConditionTrue, podCondition(cli.pod, ProgrammedCondition).Status)
+}
+
+func TestReadinessGateSkipsPods(t *testing.T) {
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "pod", Namespace: "default"}}
+	hostNetwork := testPod(true)
+	hostNetwork.Spec.HostNetwork = true
+	tests := []struct {
+		name        string
+		pod         *v1.Pod
+		wantPatches int
+	}{
+		{name: "deleted pod", pod: nil},
+		{name: "pod without readiness gate", pod: testPod(false)},
+		{name: "host network pod", pod: hostNetwork, wantPatches: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli := &mockCli{pod: tt.pod}
+			r := NewReadinessGate(zap.NewNop(), &mockChecker{}, true, time.Second)
+			r.cli = cli
+			res, err := r.Reconcile(context.Background(), req)
+			require.NoError(t, err)
+			require.True(t, res.IsZero())
+			require.Equal(t, tt.wantPatches, cli.patches)
+		})
+	}
+}
@@ -0,0 +1,228 @@
+// Package lease is the offline IPAM lease cache. CNS pre-leases IPs into a node-local file, so that CNI can still
+// assign IPs to pods while CNS is unreachable, e.g. while it's upgraded or crash looping. CNS holds the IPs of each
+// lease as Assigned, so it never assigns them to another pod, and reconciles the leases which CNI consumed back into its
+// state once it's reachable again.
+package lease
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/Azure/azure-container-networking/processlock"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultPath is where CNS keeps the leases and CNI looks for them.
+	DefaultPath = "/var/run/azure-vnet/ipleases.json"
+	// Namespace is the namespace of the pods which CNS assigns the IPs of unconsumed leases to.
+	Namespace = "azure-cns-lease"
+
+	lockExtension = ".lock"
+)
+
+// ErrNoLeases is returned when there is no unconsumed lease left.
+var ErrNoLeases = errors.New("no IP leases available")
+
+// Consumer is the pod which CNI assigned the IPs of a lease to.
+type Consumer struct {
+	InfraContainerID string    `json:"infraContainerID"`
+	PodInterfaceID   string    `json:"podInterfaceID"`
+	PodName          string    `json:"podName"`
+	PodNamespace     string    `json:"podNamespace"`
+	ConsumedAt       time.Time `json:"consumedAt"`
+	// Released is set when the pod was deleted before CNS reconciled the lease, so CNS frees its IPs instead.
+	Released bool `json:"released,omitempty"`
+}
+
+// PodInfo is the PodInfo CNS assigns the IPs of the lease to when it reconciles it.
+func (c *Consumer) PodInfo() cns.PodInfo {
+	return cns.NewPodInfo(c.InfraContainerID, c.PodInterfaceID, c.PodName, c.PodNamespace)
+}
+
+// ConsumerOf returns the Consumer for the pod of the IP request.
+func ConsumerOf(req cns.IPConfigsRequest) (Consumer, error) {
+	podInfo, err := cns.NewPodInfoFromIPConfigsRequest(req)
+	if err != nil {
+		return Consumer{}, errors.Wrap(err, "failed to parse pod info of IP request")
+	}
+	return Consumer{
+		InfraContainerID: podInfo.InfraContainerID(),
+		PodInterfaceID:   podInfo.InterfaceID(),
+		PodName:          podInfo.Name(),
+		PodNamespace:     podInfo.Namespace(),
+	}, nil
+}
+
+// Lease is a set of IPs, one per NC and IP family like CNS assigns to a pod, with everything CNI needs to configure
+// them without CNS.
+type Lease struct {
+	ID        string          `json:"id"`
+	PodIPInfo []cns.PodIpInfo `json:"podIPInfo"`
+	LeasedAt  time.Time       `json:"leasedAt"`
+	Consumer  *Consumer       `json:"consumer,omitempty"`
+}
+
+// PodInfo is the PodInfo CNS holds the IPs of the lease with until it's consumed.
+func (l *Lease) PodInfo() cns.PodInfo {
+	return cns.NewPodInfo(l.ID, l.ID, l.ID, Namespace)
+}
+
+// Response is the IP response CNS would have returned for the IPs of the lease.
+func (l *Lease) Response() *cns.IPConfigsResponse {
+	return &cns.IPConfigsResponse{
+		Response:  cns.Response{ReturnCode: types.Success},
+		PodIPInfo: l.PodIPInfo,
+	}
+}
+
+// IsLease reports whether the PodInfo is the placeholder of an unconsumed lease rather than a pod.
+func IsLease(podInfo cns.PodInfo) bool {
+	return podInfo != nil && podInfo.Namespace() == Namespace
+}
+
+// Cache is the lease file. It's shared by CNS and CNI processes, which serialize their access with a file lock.
+type Cache struct {
+	path string
+}
+
+// New returns the Cache at the path. The file is created by the first Update.
+func New(path string) *Cache {
+	return &Cache{path: path}
+}
+
+// Exists reports whether the lease file exists, i.e. whether CNS ever leased IPs on this node.
+func (c *Cache) Exists() bool {
+	_, err := os.Stat(c.path)
+	return err == nil
+}
+
+// Update locks the Cache, passes its leases to fn, and replaces them with the leases fn returns. Nothing is written if
+// fn fails.
+func (c *Cache) Update(fn func([]Lease) ([]Lease, error)) error {
+	lock, err := processlock.NewFileLock(c.path + lockExtension)
+	if err != nil {
+		return errors.Wrap(err, "failed to create lease lock")
+	}
+	if err = lock.Lock(); err != nil {
+		return errors.Wrap(err, "failed to lock leases")
+	}
+	defer lock.Unlock() //nolint:errcheck // the lock is released when the file is closed
+
+	leases, err := c.read()
+	if err != nil {
+		return err
+	}
+	if leases, err = fn(leases); err != nil {
+		return err
+	}
+	return c.write(leases)
+}
+
+// Consume assigns an unconsumed lease to the consumer and returns it. A lease which the consumer's container already
+// consumed is returned again, so that retried CNI ADDs get the same IPs.
+func (c *Cache) Consume(consumer Consumer) (*Lease, error) {
+	if !c.Exists() {
+		return nil, ErrNoLeases
+	}
+	var consumed *Lease
+	err := c.Update(func(leases []Lease) ([]Lease, error) {
+		for i := range leases {
+			if leases[i].Consumer != nil && !leases[i].Consumer.Released && leases[i].Consumer.InfraContainerID == consumer.InfraContainerID {
+				consumed = &leases[i]
+				return leases, nil
+			}
+		}
+		for i := range leases {
+			if leases[i].Consumer == nil {
+				consumer.ConsumedAt = time.Now()
+				leases[i].Consumer = &consumer
+				consumed = &leases[i]
+				return leases, nil
+			}
+		}
+		return nil, ErrNoLeases
+	})
+	if err != nil {
+		return nil, err
+	}
+	return consumed, nil
+}
+
+// Release marks the lease consumed by the container as released, and reports whether there was one. CNS frees the IPs
+// of released leases when it reconciles them.
+func (c *Cache) Release(infraContainerID string) (bool, error) {
+	if !c.Exists() {
+		return false, nil
+	}
+	released := false
+	err := c.Update(func(leases []Lease) ([]Lease, error) {
+		for i := range leases {
+			if leases[i].Consumer != nil && leases[i].Consumer.InfraContainerID == infraContainerID {
+				leases[i].Consumer.Released = true
+				released = true
+			}
+		}
+		return leases, nil
+	})
+	return released, err
+}
+
+// Remove deletes the lease file, so that CNI has no leases to consume until CNS leases IPs again.
+func (c *Cache) Remove() error {
+	lock, err := processlock.NewFileLock(c.path + lockExtension)
+	if err != nil {
+		return errors.Wrap(err, "failed to create lease lock")
+	}
+	if err = lock.Lock(); err != nil {
+		return errors.Wrap(err, "failed to lock leases")
+	}
+	defer lock.Unlock() //nolint:errcheck // the lock is released when the file is closed
+
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return errors.Wrap(err, "failed to remove leases")
+	}
+	return nil
+}
+
+func (c *Cache) read() ([]Lease, error) {
+	b, err := os.ReadFile(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []Lease{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read leases")
+	}
+	leases := []Lease{}
+	if err := json.Unmarshal(b, &leases); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal leases")
+	}
+	return leases, nil
+}
+
+// write replaces the file atomically, so that a crash never leaves a partial file behind.
+func (c *Cache) write(leases []Lease) error {
+	b, err := json.MarshalIndent(leases, "", "\t")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal leases")
+	}
+	f, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path))
+	if err != nil {
+		return errors.Wrap(err, "failed to create temp lease file")
+	}
+	defer os.Remove(f.Name()) //nolint:errcheck // the temp file is gone once it replaced the leases
+	if _, err = f.Write(b); err != nil {
+		f.Close()
+		return errors.Wrap(err, "failed to write leases")
+	}
+	if err = f.Close(); err != nil {
+		return errors.Wrap(err, "failed to close temp lease file")
+	}
+	return errors.Wrap(platform.ReplaceFile(f.Name(), c.path), "failed to replace leases")
+}
@@ -0,0 +1,88 @@
+package lease
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/stretchr/testify/require"
+)
+
+func podIPInfo(ip string) []cns.PodIpInfo {
+	return []cns.PodIpInfo{{PodIPConfig: cns.IPSubnet{IPAddress: ip, PrefixLength: 24}}}
+}
+
+func TestConsume(t *testing.T) {
+	c := New(filepath.Join(t.TempDir(), "ipleases.json"))
+
+	_, err := c.Consume(Consumer{InfraContainerID: "a"})
+	require.ErrorIs(t, err, ErrNoLeases)
+
+	require.NoError(t, c.Update(func([]Lease) ([]Lease, error) {
+		return []Lease{{ID: "1", PodIPInfo: podIPInfo("10.0.0.1")}, {ID: "2", PodIPInfo: podIPInfo("10.0.0.2")}}, nil
+	}))
+
+	a, err := c.Consume(Consumer{InfraContainerID: "a", PodName: "pod-a", PodNamespace: "default"})
+	require.NoError(t, err)
+	require.Equal(t, "1", a.ID)
+	require.False(t, a.Consumer.ConsumedAt.IsZero())
+
+	// a retried ADD gets the same lease
+	again, err := c.Consume(Consumer{InfraContainerID: "a"})
+	require.NoError(t, err)
+	require.Equal(t, a.ID, again.ID)
+
+	b, err := c.Consume(Consumer{InfraContainerID: "b"})
+	require.NoError(t, err)
+	require.Equal(t, "2", b.ID)
+
+	_, err = c.Consume(Consumer{InfraContainerID: "c"})
+	require.ErrorIs(t, err, ErrNoLeases)
+}
+
+func TestRelease(t *testing.T) {
+	c := New(filepath.Join(t.TempDir(), "ipleases.json"))
+	released, err := c.Release("a")
+	require.NoError(t, err)
+	require.False(t, released)
+
+	require.NoError(t, c.Update(func([]Lease) ([]Lease, error) {
+		return []Lease{{ID: "1", PodIPInfo: podIPInfo("10.0.0.1")}}, nil
+	}))
+	_, err = c.Consume(Consumer{InfraContainerID: "a"})
+	require.NoError(t, err)
+
+	released, err = c.Release("a")
+	require.NoError(t, err)
+	require.True(t, released)
+	require.NoError(t, c.Update(func(leases []Lease) ([]Lease, error) {
+		require.True(t, leases[0].Consumer.Released)
+		return leases, nil
+	}))
+
+	// a released lease isn't handed out again until CNS reconciled it
+	_, err = c.Consume(Consumer{InfraContainerID: "b"})
+	require.ErrorIs(t, err, ErrNoLeases)
+}
+
+func TestRemove(t *testing.T) {
+	c := New(filepath.Join(t.TempDir(), "ipleases.json"))
+	require.NoError(t, c.Remove())
+
+	require.NoError(t, c.Update(func([]Lease) ([]Lease, error) {
+		return []Lease{{ID: "1", PodIPInfo: podIPInfo("10.0.0.1")}}, nil
+	}))
+	require.True(t, c.Exists())
+	require.NoError(t, c.Remove())
+	require.False(t, c.Exists())
+
+	_, err := c.Consume(Consumer{InfraContainerID: "a"})
+	require.ErrorIs(t, err, ErrNoLeases)
+}
+
+func TestIsLease(t *testing.T) {
+	l := Lease{ID: "1"}
+	require.True(t, IsLease(l.PodInfo()))
+	require.False(t, IsLease(cns.NewPodInfo("a", "a-eth0", "pod", "default")))
+	require.False(t, IsLease(nil))
+}
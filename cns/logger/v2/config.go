@@ -23,7 +23,8 @@ var defaultIKey = loggerv1.AppInsightsIKey
 
 // UnmarshalJSON implements json.Unmarshaler for the Config.
 // It only differs from the default by parsing the
-// Level string into a zapcore.Level and setting the level field.
+// Level string into a zapcore.Level and setting the level field,
+// and parsing the levels of the Components.
 func (c *Config) UnmarshalJSON(data []byte) error {
 	type Alias Config
 	aux := &struct {
@@ -39,9 +40,32 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 		return errors.Wrap(err, "failed to parse Config Level")
 	}
 	c.level = lvl
+	c.components = nil
+	for component, level := range c.Components {
+		lvl, err := zapcore.ParseLevel(level)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse level of component %s", component)
+		}
+		if c.components == nil {
+			c.components = map[string]zapcore.Level{}
+		}
+		c.components[component] = lvl
+	}
 	return nil
 }
 
+// Levels returns the component level overrides of the loggers built
+// from the Config, which can be changed at runtime.
+func (c *Config) Levels() *Levels {
+	if c.levels == nil {
+		c.levels = NewLevels()
+		for component, level := range c.components {
+			c.levels.Set(component, level)
+		}
+	}
+	return c.levels
+}
+
 // Normalize checks the Config for missing/default values and sets them
 // if appropriate.
 func (c *Config) Normalize() {
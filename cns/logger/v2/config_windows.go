@@ -13,7 +13,16 @@ type Config struct {
 	level       zapcore.Level            `json:"-"`
 	AppInsights *cores.AppInsightsConfig `json:"appInsights,omitempty"`
 	File        *cores.FileConfig        `json:"file,omitempty"`
-	ETW         *cores.ETWConfig         `json:"etw,omitempty"`
+	OTLP        *cores.OTLPConfig        `json:"otlp,omitempty"`
+	// Stdout configures the policies of the stdout core, and its level if it differs from the general Level.
+	Stdout *cores.StdoutConfig `json:"stdout,omitempty"`
+	// Components overrides the level of components, see Levels. The overrides can be changed at runtime.
+	Components map[string]string        `json:"components,omitempty"`
+	components map[string]zapcore.Level `json:"-"`
+	levels     *Levels                  `json:"-"`
+	// LevelsTokenFile holds the bearer token which authenticates requests to change the component levels.
+	LevelsTokenFile string           `json:"levelsTokenFile,omitempty"`
+	ETW             *cores.ETWConfig `json:"etw,omitempty"`
 }
 
 func (c *Config) normalize() {
@@ -0,0 +1,175 @@
+package logger
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	cores "github.com/Azure/azure-container-networking/cns/logger/v2/cores"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// maxDedupEntries bounds the logs a core remembers for deduplication. Expired entries are swept beyond it.
+const maxDedupEntries = 4096
+
+// policyCore wraps a core with the component levels and the policies of its config. The level of the wrapped core
+// is the default for components without an override; the policyCore decides what is logged and writes to the
+// wrapped core directly.
+type policyCore struct {
+	zapcore.Core
+	level     zapcore.Level
+	levels    *Levels
+	component string
+	// fields are the encoded fields of the logger, which are part of the deduplication key
+	fields  string
+	sampler *sampler
+	deduper *deduper
+}
+
+func newPolicyCore(core zapcore.Core, levels *Levels, policies cores.Policies) zapcore.Core {
+	level := zapcore.LevelOf(core)
+	if level == zapcore.InvalidLevel {
+		// the core is disabled, e.g. a no-op platform core
+		return core
+	}
+	c := &policyCore{
+		Core:   core,
+		level:  level,
+		levels: levels,
+	}
+	if s := policies.Sampling; s != nil {
+		c.sampler = &sampler{tick: s.Tick.Duration, first: s.First, thereafter: s.Thereafter, counts: map[string]int{}}
+	}
+	if d := policies.Dedup; d != nil {
+		c.deduper = &deduper{window: d.Window.Duration, seen: map[string]*dedupEntry{}}
+	}
+	return c
+}
+
+func (c *policyCore) Enabled(level zapcore.Level) bool {
+	return level >= c.level || level >= c.levels.minLevel()
+}
+
+func (c *policyCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.Core = c.Core.With(fields)
+	for i := range fields {
+		if fields[i].Key == componentKey && fields[i].Type == zapcore.StringType {
+			clone.component = fields[i].String
+		}
+	}
+	if c.deduper != nil {
+		clone.fields += encode(fields)
+	}
+	return &clone
+}
+
+func (c *policyCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	level := c.level
+	if override, ok := c.levels.lookup(c.name(ent)); ok {
+		level = override
+	}
+	if ent.Level < level {
+		return ce
+	}
+	if ent.Level < zapcore.ErrorLevel && c.sampler != nil && !c.sampler.sample(ent) {
+		return ce
+	}
+	return ce.AddCore(ent, c)
+}
+
+func (c *policyCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if ent.Level < zapcore.ErrorLevel && c.deduper != nil {
+		dropped, ok := c.deduper.check(ent.Level.String()+ent.LoggerName+ent.Message+c.fields+encode(fields), ent.Time)
+		if !ok {
+			return nil
+		}
+		if dropped > 0 {
+			fields = append(fields[:len(fields):len(fields)], zap.Int("duplicates_dropped", dropped))
+		}
+	}
+	return c.Core.Write(ent, fields) //nolint:wrapcheck // it's a wrapper
+}
+
+// name is the component of the entry: its logger name if it has one, otherwise the component field of the logger.
+func (c *policyCore) name(ent zapcore.Entry) string {
+	if ent.LoggerName != "" {
+		return ent.LoggerName
+	}
+	return c.component
+}
+
+func encode(fields []zapcore.Field) string {
+	enc := zapcore.NewMapObjectEncoder()
+	for i := range fields {
+		fields[i].AddTo(enc)
+	}
+	return fmt.Sprint(enc.Fields)
+}
+
+// sampler counts the logs by level and message in the current tick. It's shared by the loggers derived from a core.
+type sampler struct {
+	tick       time.Duration
+	first      int
+	thereafter int
+
+	mu     sync.Mutex
+	reset  time.Time
+	counts map[string]int
+}
+
+func (s *sampler) sample(ent zapcore.Entry) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ent.Time.Sub(s.reset) >= s.tick {
+		s.reset = ent.Time
+		s.counts = map[string]int{}
+	}
+	key := ent.Level.String() + ent.Message
+	s.counts[key]++
+	n := s.counts[key]
+	if n <= s.first {
+		return true
+	}
+	return s.thereafter > 0 && (n-s.first)%s.thereafter == 0
+}
+
+type dedupEntry struct {
+	written time.Time
+	dropped int
+}
+
+// deduper remembers when logs were last written. It's shared by the loggers derived from a core.
+type deduper struct {
+	window time.Duration
+
+	mu   sync.Mutex
+	seen map[string]*dedupEntry
+}
+
+// check returns whether the log should be written, and if so, how many duplicates of it were dropped.
+func (d *deduper) check(key string, now time.Time) (int, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.seen[key]; ok && now.Sub(e.written) < d.window {
+		e.dropped++
+		return 0, false
+	}
+	var dropped int
+	if e, ok := d.seen[key]; ok {
+		dropped = e.dropped
+	}
+	if len(d.seen) >= maxDedupEntries {
+		for k, e := range d.seen {
+			if now.Sub(e.written) >= d.window {
+				delete(d.seen, k)
+			}
+		}
+	}
+	// if too many distinct logs are written within the window, the rest isn't deduplicated
+	if len(d.seen) < maxDedupEntries {
+		d.seen[key] = &dedupEntry{written: now}
+	}
+	return dropped, true
+}
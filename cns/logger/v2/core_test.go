@@ -0,0 +1,107 @@
+package logger
+
+import (
+	"testing"
+	"time"
+
+	cores "github.com/Azure/azure-container-networking/cns/logger/v2/cores"
+	internaltime "github.com/Azure/azure-container-networking/internal/time"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestComponentOverride(t *testing.T) {
+	inner, logs := observer.New(zapcore.InfoLevel)
+	levels := NewLevels()
+	z := zap.New(newPolicyCore(inner, levels, cores.Policies{}))
+	poolMonitor := z.With(zap.String("component", "ipam-pool-monitor"))
+	restserver := z.With(zap.String("component", "restserver"))
+
+	poolMonitor.Debug("scaling")
+	require.Equal(t, 0, logs.Len())
+
+	levels.Set("ipam-pool-monitor", zapcore.DebugLevel)
+	poolMonitor.Debug("scaling")
+	restserver.Debug("request")
+	require.Equal(t, 1, logs.Len())
+	require.Equal(t, "scaling", logs.All()[0].Message)
+
+	// an override can also raise the level of a component
+	levels.Set("restserver", zapcore.ErrorLevel)
+	restserver.Info("request")
+	require.Equal(t, 1, logs.Len())
+
+	levels.Unset("ipam-pool-monitor")
+	levels.Unset("restserver")
+	poolMonitor.Debug("scaling")
+	restserver.Info("request")
+	require.Equal(t, 2, logs.Len())
+}
+
+func TestNamedLoggerOverride(t *testing.T) {
+	inner, logs := observer.New(zapcore.InfoLevel)
+	levels := NewLevels()
+	levels.Set("ipam", zapcore.DebugLevel)
+	z := zap.New(newPolicyCore(inner, levels, cores.Policies{}))
+
+	z.Named("ipam").Named("pool").Debug("scaling")
+	z.Named("ipamd").Debug("scaling")
+	z.Debug("scaling")
+	require.Equal(t, 1, logs.Len())
+	require.Equal(t, "ipam.pool", logs.All()[0].LoggerName)
+}
+
+func TestSamplingNeverDropsErrors(t *testing.T) {
+	inner, logs := observer.New(zapcore.InfoLevel)
+	z := zap.New(newPolicyCore(inner, NewLevels(), cores.Policies{
+		Sampling: &cores.SamplingConfig{Tick: internaltime.Duration{Duration: time.Hour}, First: 2, Thereafter: 10},
+	}))
+
+	for i := 0; i < 100; i++ {
+		z.Info("requesting ip")
+		z.Error("failed to request ip")
+	}
+	require.Equal(t, 100, logs.FilterMessage("failed to request ip").Len())
+	// the first 2, then every 10th of the remaining 98
+	require.Equal(t, 11, logs.FilterMessage("requesting ip").Len())
+}
+
+func TestDedup(t *testing.T) {
+	inner, logs := observer.New(zapcore.InfoLevel)
+	z := zap.New(newPolicyCore(inner, NewLevels(), cores.Policies{
+		Dedup: &cores.DedupConfig{Window: internaltime.Duration{Duration: time.Hour}},
+	}))
+	pod := z.With(zap.String("pod", "a"))
+
+	for i := 0; i < 5; i++ {
+		pod.Info("requesting ip")
+		z.Info("requesting ip", zap.String("pod", "b"))
+		z.Error("failed to request ip")
+	}
+	require.Equal(t, 1, logs.FilterMessage("requesting ip").FilterField(zap.String("pod", "a")).Len())
+	require.Equal(t, 1, logs.FilterMessage("requesting ip").FilterField(zap.String("pod", "b")).Len())
+	require.Equal(t, 5, logs.FilterMessage("failed to request ip").Len())
+}
+
+func TestDeduperReportsDropped(t *testing.T) {
+	d := &deduper{window: time.Minute, seen: map[string]*dedupEntry{}}
+	now := time.Now()
+
+	dropped, ok := d.check("key", now)
+	require.True(t, ok)
+	require.Zero(t, dropped)
+	for i := 0; i < 3; i++ {
+		_, ok = d.check("key", now.Add(time.Second))
+		require.False(t, ok)
+	}
+	dropped, ok = d.check("key", now.Add(time.Minute))
+	require.True(t, ok)
+	require.Equal(t, 3, dropped)
+}
+
+func TestDisabledCoreIsNotWrapped(t *testing.T) {
+	core := zapcore.NewNopCore()
+	require.Equal(t, core, newPolicyCore(core, NewLevels(), cores.Policies{}))
+}
@@ -19,6 +19,7 @@ type AppInsightsConfig struct {
 	MaxBatchInterval time.Duration   `json:"max_batch_interval"`
 	MaxBatchSize     int             `json:"max_batch_size"`
 	Fields           []zapcore.Field `json:"fields"`
+	Policies
 }
 
 // UnmarshalJSON implements json.Unmarshaler for the Config.
@@ -16,6 +16,7 @@ type ETWConfig struct {
 	level        zapcore.Level   `json:"-"`
 	ProviderName string          `json:"providername"`
 	Fields       []zapcore.Field `json:"fields"`
+	Policies
 }
 
 // UnmarshalJSON implements json.Unmarshaler for the Config.
@@ -17,6 +17,7 @@ type FileConfig struct {
 	MaxBackups int             `json:"maxBackups"`
 	MaxSize    int             `json:"maxSize"`
 	Fields     []zapcore.Field `json:"fields"`
+	Policies
 }
 
 // UnmarshalJSON implements json.Unmarshaler for the Config.
@@ -0,0 +1,54 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/Azure/azure-container-networking/otlp"
+	"github.com/pkg/errors"
+	"go.uber.org/zap/zapcore"
+)
+
+type OTLPConfig struct {
+	level       zapcore.Level   `json:"-"` // Zero value is default Info level.
+	Level       string          `json:"level"`
+	otlp.Config                 // The exporter config is inlined with the core config.
+	Fields      []zapcore.Field `json:"fields"`
+	Policies
+}
+
+// UnmarshalJSON implements json.Unmarshaler for the Config.
+// It only differs from the default by parsing the
+// Level string into a zapcore.Level and setting the level field.
+func (c *OTLPConfig) UnmarshalJSON(data []byte) error {
+	type Alias OTLPConfig
+	aux := &struct {
+		*Alias
+	}{
+		Alias: (*Alias)(c),
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return errors.Wrap(err, "failed to unmarshal OTLPConfig")
+	}
+	lvl, err := zapcore.ParseLevel(c.Level)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse OTLPConfig Level")
+	}
+	c.level = lvl
+	return nil
+}
+
+// OTLPCore builds a zapcore.Core that sends logs to an OpenTelemetry collector.
+// The first return is the core, the second is a function to flush and close the exporter.
+func OTLPCore(cfg *OTLPConfig) (zapcore.Core, func(), error) {
+	exporter, err := otlp.NewExporter(&cfg.Config, "azure-cns")
+	if err != nil {
+		return nil, func() {}, errors.Wrap(err, "failed to create OTLP exporter")
+	}
+	batcher := otlp.NewBatcher(exporter, nil)
+	closer := func() {
+		_ = batcher.Close(context.Background())
+		_ = exporter.Close()
+	}
+	return otlp.NewCore(cfg.level, batcher).With(cfg.Fields), closer, nil
+}
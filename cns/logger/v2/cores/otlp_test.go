@@ -0,0 +1,70 @@
+package logger
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/internal/time"
+	"github.com/Azure/azure-container-networking/otlp"
+	"github.com/Azure/azure-container-networking/otlp/otlptest"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestOTLPConfigUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		have    []byte
+		want    *OTLPConfig
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			have: []byte(`{"level":"warn","endpoint":"otel-collector:4318","protocol":"http/protobuf","insecure":true,"batch_interval":"10s"}`),
+			want: &OTLPConfig{
+				Level: "warn",
+				level: zapcore.WarnLevel,
+				Config: otlp.Config{
+					Endpoint:      "otel-collector:4318",
+					Protocol:      otlp.ProtocolHTTP,
+					Insecure:      true,
+					BatchInterval: time.Duration{Duration: 10 * time.Second},
+				},
+			},
+		},
+		{
+			name:    "invalid level",
+			have:    []byte(`{"level":"invalid"}`),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &OTLPConfig{}
+			err := json.Unmarshal(tt.have, c)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, c)
+		})
+	}
+}
+
+func TestOTLPCore(t *testing.T) {
+	r := otlptest.NewReceiver(t)
+	core, closer, err := OTLPCore(&OTLPConfig{
+		Config: otlp.Config{Endpoint: r.GRPCEndpoint, Insecure: true},
+		Fields: []zapcore.Field{zap.String("vm_id", "vm-1")},
+	})
+	require.NoError(t, err)
+	zap.New(core).Info("hello")
+	closer()
+
+	records := r.LogRecords()
+	require.Len(t, records, 1)
+	require.Equal(t, "hello", records[0].GetBody().GetStringValue())
+	require.Equal(t, "vm_id", records[0].GetAttributes()[0].GetKey())
+}
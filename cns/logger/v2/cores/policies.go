@@ -0,0 +1,26 @@
+package logger
+
+import (
+	"github.com/Azure/azure-container-networking/internal/time"
+)
+
+// Policies reduce the volume of logs written by a core. They only apply to logs below the error level: errors are
+// never sampled or deduplicated away.
+type Policies struct {
+	Sampling *SamplingConfig `json:"sampling,omitempty"`
+	Dedup    *DedupConfig    `json:"dedup,omitempty"`
+}
+
+// SamplingConfig samples logs by level and message: in every Tick, the First logs with the same level and message
+// are written, and after that every Thereafter-th. Thereafter defaults to dropping all of them.
+type SamplingConfig struct {
+	Tick       time.Duration `json:"tick"`
+	First      int           `json:"first"`
+	Thereafter int           `json:"thereafter"`
+}
+
+// DedupConfig drops logs which repeat a log written within the Window: same level, message and fields. The next
+// log written after the Window reports how many were dropped.
+type DedupConfig struct {
+	Window time.Duration `json:"window"`
+}
@@ -15,6 +15,7 @@ type StdoutConfig struct {
 	Level  string          `json:"level"`
 	level  zapcore.Level   `json:"-"`
 	Fields []zapcore.Field `json:"fields"`
+	Policies
 }
 
 // UnmarshalJSON implements json.Unmarshaler for the Config.
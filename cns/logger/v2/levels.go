@@ -0,0 +1,171 @@
+package logger
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap/zapcore"
+)
+
+// componentKey is the field which names the component of a logger, if it isn't a named logger.
+const componentKey = "component"
+
+var (
+	ErrUnauthorized = errors.New("request is not authenticated")
+	ErrNoComponent  = errors.New("no component in the request")
+)
+
+// Levels overrides the level of components at runtime. A component is the name of a named logger, or the value of
+// the "component" field of a logger, e.g. "ipam-pool-monitor". The override of a named logger also applies to the
+// loggers named after it, e.g. "ipam" to "ipam.pool". Overrides apply to every core, regardless of its own level.
+type Levels struct {
+	mu        sync.RWMutex
+	overrides map[string]zapcore.Level
+	// min is the lowest override, or zapcore.InvalidLevel if there are none, so that cores can tell if a level is
+	// enabled for any component without taking the lock.
+	min atomic.Int32
+}
+
+func NewLevels() *Levels {
+	l := &Levels{overrides: map[string]zapcore.Level{}}
+	l.min.Store(int32(zapcore.InvalidLevel))
+	return l
+}
+
+// Set overrides the level of the component.
+func (l *Levels) Set(component string, level zapcore.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.overrides[component] = level
+	l.updateMin()
+}
+
+// Unset removes the override of the component, it logs at the level of the cores again.
+func (l *Levels) Unset(component string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.overrides, component)
+	l.updateMin()
+}
+
+// Overrides returns a copy of the overrides by component.
+func (l *Levels) Overrides() map[string]zapcore.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	out := make(map[string]zapcore.Level, len(l.overrides))
+	for component, level := range l.overrides {
+		out[component] = level
+	}
+	return out
+}
+
+func (l *Levels) updateMin() {
+	lowest := zapcore.InvalidLevel
+	for _, level := range l.overrides {
+		if level < lowest {
+			lowest = level
+		}
+	}
+	l.min.Store(int32(lowest))
+}
+
+// minLevel is the lowest level which is enabled for any component.
+func (l *Levels) minLevel() zapcore.Level {
+	return zapcore.Level(l.min.Load())
+}
+
+// lookup returns the override of the component, or of the closest named logger it's named after.
+func (l *Levels) lookup(component string) (zapcore.Level, bool) {
+	if component == "" || l.minLevel() == zapcore.InvalidLevel {
+		return 0, false
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for {
+		if level, ok := l.overrides[component]; ok {
+			return level, true
+		}
+		i := strings.LastIndexByte(component, '.')
+		if i < 0 {
+			return 0, false
+		}
+		component = component[:i]
+	}
+}
+
+// levelRequest changes the level of a component. An empty Level removes the override.
+type levelRequest struct {
+	Component string `json:"component"`
+	Level     string `json:"level"`
+}
+
+// Handler serves the overrides over HTTP: GET returns them, PUT changes the level of a component. Requests must be
+// authenticated, either with a client certificate which the TLS server verified, or with the bearer token in the
+// token file. The file is read for every request so that the token can be rotated; without it, only requests with
+// a client certificate are accepted.
+func (l *Levels) Handler(tokenFile string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := authenticate(r, tokenFile); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var req levelRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if req.Component == "" {
+				http.Error(w, ErrNoComponent.Error(), http.StatusBadRequest)
+				return
+			}
+			if req.Level == "" {
+				l.Unset(req.Component)
+				break
+			}
+			level, err := zapcore.ParseLevel(req.Level)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			l.Set(req.Component, level)
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		overrides := map[string]string{}
+		for component, level := range l.Overrides() {
+			overrides[component] = level.String()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(overrides)
+	})
+}
+
+func authenticate(r *http.Request, tokenFile string) error {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return nil
+	}
+	if tokenFile == "" {
+		return ErrUnauthorized
+	}
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return errors.Wrap(ErrUnauthorized, "token file can't be read")
+	}
+	want := strings.TrimSpace(string(token))
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || want == "" || subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+		return ErrUnauthorized
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package logger
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLevelsHandler(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("secret\n"), 0o600))
+	levels := NewLevels()
+	h := levels.Handler(tokenFile)
+
+	do := func(method, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/debug/loglevels", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	require.Equal(t, http.StatusUnauthorized, do(http.MethodPut, "", `{"component":"ipam-pool-monitor","level":"debug"}`).Code)
+	require.Equal(t, http.StatusUnauthorized, do(http.MethodPut, "wrong", `{"component":"ipam-pool-monitor","level":"debug"}`).Code)
+	require.Empty(t, levels.Overrides())
+
+	w := do(http.MethodPut, "secret", `{"component":"ipam-pool-monitor","level":"debug"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var got map[string]string
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	require.Equal(t, map[string]string{"ipam-pool-monitor": "debug"}, got)
+	require.Equal(t, map[string]zapcore.Level{"ipam-pool-monitor": zapcore.DebugLevel}, levels.Overrides())
+
+	require.Equal(t, http.StatusBadRequest, do(http.MethodPut, "secret", `{"component":"ipam-pool-monitor","level":"loud"}`).Code)
+	require.Equal(t, http.StatusBadRequest, do(http.MethodPut, "secret", `{"level":"debug"}`).Code)
+	require.Equal(t, http.StatusMethodNotAllowed, do(http.MethodPost, "secret", "").Code)
+
+	// the token is rotated by rewriting the file
+	require.NoError(t, os.WriteFile(tokenFile, []byte("rotated"), 0o600))
+	require.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "secret", "").Code)
+	require.Equal(t, http.StatusOK, do(http.MethodPut, "rotated", `{"component":"ipam-pool-monitor"}`).Code)
+	require.Empty(t, levels.Overrides())
+}
+
+func TestLevelsHandlerClientCertificate(t *testing.T) {
+	h := NewLevels().Handler("")
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/loglevels", http.NoBody)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestConfigComponents(t *testing.T) {
+	c := &Config{}
+	require.NoError(t, json.Unmarshal([]byte(`{"level":"info","components":{"ipam-pool-monitor":"debug"}}`), c))
+	require.Equal(t, map[string]zapcore.Level{"ipam-pool-monitor": zapcore.DebugLevel}, c.Levels().Overrides())
+	require.Same(t, c.Levels(), c.Levels())
+
+	require.Error(t, json.Unmarshal([]byte(`{"level":"info","components":{"ipam-pool-monitor":"loud"}}`), &Config{}))
+}
@@ -1,9 +1,10 @@
 // Package logger provides an opinionated logger for CNS which knows how to
-// log to Application Insights, file, stdout and ETW (based on platform).
+// log to Application Insights, OpenTelemetry, file, stdout and ETW (based on platform).
 package logger
 
 import (
 	cores "github.com/Azure/azure-container-networking/cns/logger/v2/cores"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -19,7 +20,19 @@ func (c compoundCloser) Close() {
 // New creates a v2 CNS logger built with Zap.
 func New(cfg *Config) (*zap.Logger, func(), error) {
 	cfg.Normalize()
-	core := cores.StdoutCore(cfg.level)
+	levels := cfg.Levels()
+	stdoutLevel, stdoutPolicies := cfg.level, cores.Policies{}
+	if cfg.Stdout != nil {
+		if cfg.Stdout.Level != "" {
+			lvl, err := zapcore.ParseLevel(cfg.Stdout.Level)
+			if err != nil {
+				return nil, func() {}, errors.Wrap(err, "failed to parse Stdout Level")
+			}
+			stdoutLevel = lvl
+		}
+		stdoutPolicies = cfg.Stdout.Policies
+	}
+	core := newPolicyCore(cores.StdoutCore(stdoutLevel), levels, stdoutPolicies)
 	closer := compoundCloser{}
 	if cfg.File != nil {
 		fileCore, fileCloser, err := cores.FileCore(cfg.File)
@@ -27,7 +40,7 @@ func New(cfg *Config) (*zap.Logger, func(), error) {
 		if err != nil {
 			return nil, closer.Close, err //nolint:wrapcheck // it's an internal pkg
 		}
-		core = zapcore.NewTee(core, fileCore)
+		core = zapcore.NewTee(core, newPolicyCore(fileCore, levels, cfg.File.Policies))
 	}
 	if cfg.AppInsights != nil {
 		aiCore, aiCloser, err := cores.ApplicationInsightsCore(cfg.AppInsights)
@@ -35,13 +48,21 @@ func New(cfg *Config) (*zap.Logger, func(), error) {
 		if err != nil {
 			return nil, closer.Close, err //nolint:wrapcheck // it's an internal pkg
 		}
-		core = zapcore.NewTee(core, aiCore)
+		core = zapcore.NewTee(core, newPolicyCore(aiCore, levels, cfg.AppInsights.Policies))
+	}
+	if cfg.OTLP != nil {
+		otlpCore, otlpCloser, err := cores.OTLPCore(cfg.OTLP)
+		closer = append(closer, otlpCloser)
+		if err != nil {
+			return nil, closer.Close, err //nolint:wrapcheck // it's an internal pkg
+		}
+		core = zapcore.NewTee(core, newPolicyCore(otlpCore, levels, cfg.OTLP.Policies))
 	}
 	platformCore, platformCloser, err := platformCore(cfg)
 	closer = append(closer, platformCloser)
 	if err != nil {
 		return nil, closer.Close, err
 	}
-	core = zapcore.NewTee(core, platformCore)
+	core = zapcore.NewTee(core, newPolicyCore(platformCore, levels, platformPolicies(cfg)))
 	return zap.New(core), closer.Close, nil
 }
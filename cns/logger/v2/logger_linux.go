@@ -1,6 +1,7 @@
 package logger
 
 import (
+	cores "github.com/Azure/azure-container-networking/cns/logger/v2/cores"
 	"go.uber.org/zap/zapcore"
 )
 
@@ -8,3 +9,8 @@ import (
 func platformCore(*Config) (zapcore.Core, func(), error) {
 	return zapcore.NewNopCore(), func() {}, nil
 }
+
+// On Linux, there are no platformPolicies.
+func platformPolicies(*Config) cores.Policies {
+	return cores.Policies{}
+}
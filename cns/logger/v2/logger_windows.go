@@ -12,3 +12,11 @@ func platformCore(cfg *Config) (zapcore.Core, func(), error) {
 	}
 	return cores.ETWCore(cfg.ETW) //nolint:wrapcheck // ignore
 }
+
+// On Windows, platformPolicies are the policies of the ETW core.
+func platformPolicies(cfg *Config) cores.Policies {
+	if cfg.ETW == nil {
+		return cores.Policies{}
+	}
+	return cfg.ETW.Policies
+}
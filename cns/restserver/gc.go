@@ -0,0 +1,119 @@
+package restserver
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/lease"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/errcode"
+	"github.com/pkg/errors"
+)
+
+// gcGracePeriod is how long an IP stays assigned before GC may release it. The runtime computes the valid attachments
+// before it sends GC, so a pod which is being set up concurrently may not be among them yet.
+const gcGracePeriod = time.Minute
+
+var errGCWithoutOwner = errors.New("GC request has no owner")
+
+// GCIPConfigsHandler releases the IPs which the owner of the request assigned to pods whose infra container isn't in
+// its valid containers. It's called by CNI GC, so that IPs which leaked because DEL never reached CNS are returned to
+// the pool.
+func (service *HTTPRestService) GCIPConfigsHandler(w http.ResponseWriter, r *http.Request) {
+	opName := "gcIPConfigsHandler"
+	defer service.publishIPStateMetrics()
+	var req cns.GCIPConfigsRequest
+	err := common.Decode(w, r, &req)
+	logger.Request(opName, req, err)
+	if err == nil && req.Owner == "" {
+		err = errGCWithoutOwner
+	}
+	if err != nil {
+		resp := cns.GCIPConfigsResponse{
+			Response: cns.Response{
+				ReturnCode: types.UnexpectedError,
+				Message:    err.Error(),
+				Error:      errcode.Wrap(err, errcode.InvalidRequest),
+			},
+		}
+		w.Header().Set(cnsReturnCode, resp.Response.ReturnCode.String())
+		err = common.Encode(w, &resp)
+		logger.ResponseEx(opName, req, resp, resp.Response.ReturnCode, err)
+		return
+	}
+
+	resp := service.gcIPConfigs(r.Context(), req)
+	w.Header().Set(cnsReturnCode, resp.Response.ReturnCode.String())
+	err = common.Encode(w, resp)
+	logger.ResponseEx(opName, req, resp, resp.Response.ReturnCode, err)
+}
+
+// gcIPConfigs releases the IPs of each leaked pod. A pod which fails to release is retried by the next GC, so the
+// others are still released and the response is only a failure if none of them were.
+func (service *HTTPRestService) gcIPConfigs(ctx context.Context, req cns.GCIPConfigsRequest) *cns.GCIPConfigsResponse {
+	resp := &cns.GCIPConfigsResponse{ReleasedContainerIDs: []string{}}
+	var lastErr error
+	for _, podInfo := range service.leakedPods(req.Owner, req.ValidContainerIDs) {
+		if service.Options[common.OptManageEndpointState] == true {
+			if err := service.removeEndpointState(podInfo); err != nil {
+				logger.Errorf("[gcIPConfigs] Failed to remove endpoint state of pod %+v: %v", podInfo, err)
+				gcReleasedPodCount.WithLabelValues(strconv.FormatBool(false)).Inc()
+				lastErr = err
+				continue
+			}
+		}
+		if err := service.releaseIPConfigs(podInfo); err != nil {
+			logger.Errorf("[gcIPConfigs] Failed to release IPs of pod %+v: %v", podInfo, err)
+			gcReleasedPodCount.WithLabelValues(strconv.FormatBool(false)).Inc()
+			lastErr = err
+			continue
+		}
+		logger.Printf("[gcIPConfigs] Released IPs of pod %+v whose container %s isn't valid", podInfo, podInfo.InfraContainerID())
+		gcReleasedPodCount.WithLabelValues(strconv.FormatBool(true)).Inc()
+		resp.ReleasedContainerIDs = append(resp.ReleasedContainerIDs, podInfo.InfraContainerID())
+	}
+	if len(resp.ReleasedContainerIDs) > 0 {
+		service.ipRequestTraces.Add(ctx)
+	}
+	if lastErr != nil && len(resp.ReleasedContainerIDs) == 0 {
+		resp.Response = cns.Response{
+			ReturnCode: types.UnexpectedError,
+			Message:    lastErr.Error(),
+			Error:      errcode.From(lastErr),
+		}
+	}
+	return resp
+}
+
+// leakedPods returns the pods with IPs Assigned by the owner whose infra container isn't one of the valid container IDs,
+// and which have been assigned for longer than the gcGracePeriod. IPs without an infra container, such as those
+// reconciled from the API server or held for offline leases, aren't attached to any container the runtime knows about.
+func (service *HTTPRestService) leakedPods(owner string, validContainerIDs []string) []cns.PodInfo {
+	valid := make(map[string]struct{}, len(validContainerIDs))
+	for _, id := range validContainerIDs {
+		valid[id] = struct{}{}
+	}
+	service.RLock()
+	defer service.RUnlock()
+	leaked := []cns.PodInfo{}
+	for _, ipIDs := range service.PodIPIDByPodInterfaceKey {
+		for _, ipID := range ipIDs {
+			ipConfig, ok := service.PodIPConfigState[ipID]
+			if !ok || ipConfig.GetState() != types.Assigned || ipConfig.PodInfo == nil || lease.IsLease(ipConfig.PodInfo) ||
+				ipConfig.PodInfo.InfraContainerID() == "" || ipConfig.PodInfo.Owner() != owner {
+				continue
+			}
+			if _, ok := valid[ipConfig.PodInfo.InfraContainerID()]; ok || time.Since(ipConfig.LastStateTransition) < gcGracePeriod {
+				break
+			}
+			leaked = append(leaked, ipConfig.PodInfo)
+			break
+		}
+	}
+	return leaked
+}
@@ -0,0 +1,94 @@
+package restserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGCIPConfigsHandler(t *testing.T) {
+	const (
+		testIP5   = "10.0.0.5"
+		testIPID4 = "b7c2e0a4-52f1-4c8e-9d3a-6f1e2b7c9a04"
+		testIPID5 = "c8d3f1b5-63a2-4d9f-8e4b-7a2f3c8d0b05"
+	)
+	// a pod which was reconciled from the API server has no infra container
+	reconciledPod := cns.NewPodInfo("", "5c2a1d-eth0", "testpod5", "testpod5namespace")
+
+	svc := getTestService(cns.KubernetesCRD)
+	ipconfigs := map[string]cns.IPConfigurationStatus{}
+	for _, p := range []struct {
+		ip, id string
+		pod    cns.PodInfo
+	}{
+		{ip: testIP1, id: testIPID1, pod: withOwner(t, testPod1Info, "azure-ipam")},
+		{ip: testIP2, id: testIPID2, pod: withOwner(t, testPod2Info, "azure-ipam")},
+		{ip: testIP3, id: testIPID3, pod: withOwner(t, testPod3Info, "azure-ipam")},
+		{ip: testIP4, id: testIPID4, pod: withOwner(t, testPod8Info, "azure-vnet")},
+		{ip: testIP5, id: testIPID5, pod: withOwner(t, reconciledPod, "azure-ipam")},
+	} {
+		state, err := newPodStateWithOrchestratorContext(p.ip, p.id, testNCID, types.Assigned, ipPrefixBitsv4, 0, p.pod)
+		require.NoError(t, err)
+		ipconfigs[state.ID] = state
+	}
+	require.NoError(t, updatePodIPConfigState(t, svc, ipconfigs, testNCID))
+	// pod 3 was assigned its IP after the runtime listed its valid attachments
+	for _, id := range []string{testIPID1, testIPID2, testIPID4, testIPID5} {
+		ipconfig := svc.PodIPConfigState[id]
+		ipconfig.LastStateTransition = time.Now().Add(-2 * gcGracePeriod)
+		svc.PodIPConfigState[id] = ipconfig
+	}
+
+	// GC without an owner releases nothing
+	resp := gcIPConfigs(t, svc, cns.GCIPConfigsRequest{ValidContainerIDs: []string{testPod2Info.InfraContainerID()}})
+	require.NotEqual(t, types.Success, resp.Response.ReturnCode)
+	require.Equal(t, types.Assigned, stateOf(svc, testIPID1))
+
+	// only the IPs which the owner assigned to containers are released
+	resp = gcIPConfigs(t, svc, cns.GCIPConfigsRequest{ValidContainerIDs: []string{testPod2Info.InfraContainerID()}, Owner: "azure-ipam"})
+	require.Equal(t, types.Success, resp.Response.ReturnCode)
+	require.Equal(t, []string{testPod1Info.InfraContainerID()}, resp.ReleasedContainerIDs)
+	require.Equal(t, types.Available, stateOf(svc, testIPID1))
+	require.Equal(t, types.Assigned, stateOf(svc, testIPID2))
+	require.Equal(t, types.Assigned, stateOf(svc, testIPID3))
+	require.Equal(t, types.Assigned, stateOf(svc, testIPID4))
+	require.Equal(t, types.Assigned, stateOf(svc, testIPID5))
+	require.Empty(t, svc.PodIPIDByPodInterfaceKey[testPod1Info.Key()])
+}
+
+func gcIPConfigs(t *testing.T, svc *HTTPRestService, req cns.GCIPConfigsRequest) cns.GCIPConfigsResponse {
+	body, err := json.Marshal(req)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	svc.GCIPConfigsHandler(w, httptest.NewRequest(http.MethodPost, cns.GCIPConfigs, bytes.NewReader(body)))
+
+	var resp cns.GCIPConfigsResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	return resp
+}
+
+// withOwner returns the pod as it's recorded for an IP request of the owner.
+func withOwner(t *testing.T, pod cns.PodInfo, owner string) cns.PodInfo {
+	orchestratorContext, err := pod.OrchestratorContext()
+	require.NoError(t, err)
+	owned, err := cns.NewPodInfoFromIPConfigsRequest(cns.IPConfigsRequest{
+		PodInterfaceID:      pod.InterfaceID(),
+		InfraContainerID:    pod.InfraContainerID(),
+		OrchestratorContext: orchestratorContext,
+		Owner:               owner,
+	})
+	require.NoError(t, err)
+	return owned
+}
+
+func stateOf(svc *HTTPRestService, id string) types.IPState {
+	ipconfig := svc.PodIPConfigState[id]
+	return ipconfig.GetState()
+}
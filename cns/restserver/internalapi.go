@@ -523,7 +523,7 @@ func (service *HTTPRestService) DeleteNetworkContainerInternal(
 	req cns.DeleteNetworkContainerRequest,
 ) types.ResponseCode {
 	ncid := req.NetworkContainerid
-	_, exist := service.getNetworkContainerDetails(ncid)
+	ncDetails, exist := service.getNetworkContainerDetails(ncid)
 	if !exist {
 		logger.Printf("network container for id %v doesn't exist", ncid)
 		return types.Success
@@ -547,6 +547,10 @@ func (service *HTTPRestService) DeleteNetworkContainerInternal(
 		}
 	}
 
+	if service.Options[common.OptProgramSNATIPTables] == true {
+		service.deleteSNATRules(&ncDetails.CreateNetworkContainerRequest)
+	}
+
 	service.saveState()
 	return types.Success
 }
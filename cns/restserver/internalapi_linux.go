@@ -9,9 +9,11 @@ import (
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/cns/logger"
 	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/common"
 	"github.com/Azure/azure-container-networking/iptables"
 	"github.com/Azure/azure-container-networking/network/networkutils"
-	goiptables "github.com/coreos/go-iptables/iptables"
+	"github.com/Azure/azure-container-networking/network/snat"
+	"github.com/Azure/azure-container-networking/nftables"
 	"github.com/pkg/errors"
 )
 
@@ -20,8 +22,7 @@ const SWIFTPOSTROUTING = "SWIFT-POSTROUTING"
 type IPtablesProvider struct{}
 
 func (c *IPtablesProvider) GetIPTables() (iptablesClient, error) {
-	client, err := goiptables.New()
-	return client, errors.Wrap(err, "failed to get iptables client")
+	return iptables.NewClient(), nil
 }
 func (c *IPtablesProvider) GetIPTablesLegacy() (iptablesLegacyClient, error) {
 	return &iptablesLegacy{}, nil
@@ -39,6 +40,10 @@ func (service *HTTPRestService) programSNATRules(req *cns.CreateNetworkContainer
 	service.Lock()
 	defer service.Unlock()
 
+	if service.Options[common.OptHostRulesBackend] == nftables.BackendNftables {
+		return programSNATRulesNftables(req)
+	}
+
 	iptl, err := service.iptables.GetIPTablesLegacy()
 	if err == nil {
 		err = iptl.Delete(iptables.Nat, iptables.Postrouting, "-j", SWIFTPOSTROUTING)
@@ -55,126 +60,117 @@ func (service *HTTPRestService) programSNATRules(req *cns.CreateNetworkContainer
 		return types.UnexpectedError, fmt.Sprintf("[Azure CNS] Error. Failed to create iptables interface : %v", err)
 	}
 
-	chainExist, err := ipt.ChainExists(iptables.Nat, SWIFTPOSTROUTING)
+	podSubnet, err := snatPodSubnet(req)
 	if err != nil {
-		return types.UnexpectedError, fmt.Sprintf("[Azure CNS] Error. Failed to check for existence of SWIFT-POSTROUTING chain: %v", err)
+		return types.UnexpectedError, fmt.Sprintf("[Azure CNS] Error. Failed to parse pod subnet: %v", err)
 	}
-	if !chainExist { // create and append chain if it doesn't exist
-		logger.Printf("[Azure CNS] Creating SWIFT-POSTROUTING Chain ...")
-		err = ipt.NewChain(iptables.Nat, SWIFTPOSTROUTING)
-		if err != nil {
-			return types.FailedToRunIPTableCmd, "[Azure CNS] failed to create SWIFT-POSTROUTING chain : " + err.Error()
-		}
+
+	// one time migration from old SWIFT chain
+	// previously, CNI may have a jump to the SWIFT chain-- our jump to SWIFT-POSTROUTING needs to happen first, so it
+	// is moved ahead of the jump to SWIFT if it comes after it
+	tx := ipt.NewTransaction(iptables.V4).
+		CreateChain(iptables.Nat, SWIFTPOSTROUTING).
+		InsertIptableRuleBefore(iptables.Nat, iptables.Postrouting, "", SWIFTPOSTROUTING, "-j "+iptables.Swift)
+
+	// use any secondary ip + the nnc prefix length to get an iptables rule to allow dns and imds traffic from the pods.
+	// DNS and IMDS do not have IPv6 addresses, so only an IPv4 secondary ip is used. The chain is flushed and
+	// reprogrammed unless it holds exactly these rules.
+	if podSubnet != nil {
+		match := "-m addrtype ! --dst-type local -s " + podSubnet.String()
+		target := iptables.Snat + " --to " + req.HostPrimaryIP
+		tx.SyncChain(iptables.Nat, SWIFTPOSTROUTING, []iptables.Rule{
+			{Match: fmt.Sprintf("%s -d %s -p %s --dport %d", match, networkutils.AzureDNS, iptables.UDP, iptables.DNSPort), Target: target},
+			{Match: fmt.Sprintf("%s -d %s -p %s --dport %d", match, networkutils.AzureDNS, iptables.TCP, iptables.DNSPort), Target: target},
+			{Match: fmt.Sprintf("%s -d %s -p %s --dport %d", match, networkutils.AzureIMDS, iptables.TCP, iptables.HTTPPort), Target: target},
+		})
 	}
 
-	// reconcile jump to SWIFT-POSTROUTING chain
-	rules, err := ipt.List(iptables.Nat, iptables.Postrouting)
+	if err := tx.Commit(); err != nil {
+		return types.FailedToRunIPTableCmd, "[Azure CNS] failed to program SWIFT-POSTROUTING chain : " + err.Error()
+	}
+
+	return types.Success, ""
+}
+
+// programSNATRulesNftables maps the NC subnet into the CNS nftables SNAT maps of the azure-cni table so that DNS
+// and IMDS traffic from the pods is SNATed to the host ip.
+func programSNATRulesNftables(req *cns.CreateNetworkContainerRequest) (types.ResponseCode, string) {
+	podSubnet, err := snatPodSubnet(req)
 	if err != nil {
-		return types.UnexpectedError, fmt.Sprintf("[Azure CNS] Error. Failed to check rules in postrouting chain of nat table: %v", err)
+		return types.UnexpectedError, fmt.Sprintf("[Azure CNS] Error. Failed to parse pod subnet: %v", err)
 	}
-	swiftRuleIndex := len(rules) // append if neither jump rule from POSTROUTING is found
-	// one time migration from old SWIFT chain
-	// previously, CNI may have a jump to the SWIFT chain-- our jump to SWIFT-POSTROUTING needs to happen first
-	for index, rule := range rules {
-		if rule == "-A POSTROUTING -j SWIFT" {
-			// jump to SWIFT comes before jump to SWIFT-POSTROUTING, so potential reordering required
-			swiftRuleIndex = index
-			break
-		}
-		if rule == "-A POSTROUTING -j SWIFT-POSTROUTING" {
-			// jump to SWIFT-POSTROUTING comes before jump to SWIFT, which requires no further action
-			swiftRuleIndex = -1
-			break
-		}
+	if podSubnet == nil {
+		return types.Success, ""
 	}
-	if swiftRuleIndex != -1 {
-		// jump SWIFT rule exists, insert SWIFT-POSTROUTING rule at the same position so it ends up running first
-		// first, remove any existing SWIFT-POSTROUTING rules to avoid duplicates
-		// note: inserting at len(rules) and deleting a jump to SWIFT-POSTROUTING is mutually exclusive
-		swiftPostroutingExists, err := ipt.Exists(iptables.Nat, iptables.Postrouting, "-j", SWIFTPOSTROUTING)
-		if err != nil {
-			return types.UnexpectedError, fmt.Sprintf("[Azure CNS] Error. Failed to check for existence of SWIFT-POSTROUTING rule: %v", err)
-		}
-		if swiftPostroutingExists {
-			err = ipt.Delete(iptables.Nat, iptables.Postrouting, "-j", SWIFTPOSTROUTING)
-			if err != nil {
-				return types.FailedToRunIPTableCmd, "[Azure CNS] failed to delete existing SWIFT-POSTROUTING rule : " + err.Error()
-			}
-		}
 
-		// slice index is 0-based, iptables insert is 1-based, but list also gives us the -P POSTROUTING ACCEPT
-		// as the first rule so swiftRuleIndex gives us the correct 1-indexed iptables position.
-		// Example:
-		// -P POSTROUTING ACCEPT is at swiftRuleIndex 0
-		// -A POSTROUTING -j SWIFT is at swiftRuleIndex 1, and iptables index 1
-		logger.Printf("[Azure CNS] Inserting SWIFT-POSTROUTING Chain at iptables position %d", swiftRuleIndex)
-		err = ipt.Insert(iptables.Nat, iptables.Postrouting, swiftRuleIndex, "-j", SWIFTPOSTROUTING)
-		if err != nil {
-			return types.FailedToRunIPTableCmd, "[Azure CNS] failed to insert SWIFT-POSTROUTING chain : " + err.Error()
-		}
+	hostPrimaryIP := net.ParseIP(req.HostPrimaryIP)
+	err = nftables.NewClient().AddSnatEndpoint(nftables.SnatEndpoint{
+		Owner:      nftables.OwnerCNS,
+		Subnet:     *podSubnet,
+		DNSSnatIP:  hostPrimaryIP,
+		IMDSSnatIP: hostPrimaryIP,
+	})
+	if err != nil {
+		return types.FailedToRunIPTableCmd, "[Azure CNS] failed to program nftables SNAT endpoint : " + err.Error()
 	}
+	logger.Printf("[Azure CNS] Programmed nftables SNAT endpoint for %s", podSubnet.String())
 
-	// use any secondary ip + the nnc prefix length to get an iptables rule to allow dns and imds traffic from the pods
-	for _, v := range req.SecondaryIPConfigs {
-		// check if the ip address is IPv4. A check is required because DNS and IMDS do not have IPv6 addresses. Since support currently exists only for IPv4, other ip families are skipped.
-		if net.ParseIP(v.IPAddress).To4() == nil {
-			// skip if the ip address is not IPv4
-			continue
-		}
+	return types.Success, ""
+}
 
-		// put the ip address in standard cidr form (where we zero out the parts that are not relevant)
-		_, podSubnet, _ := net.ParseCIDR(v.IPAddress + "/" + fmt.Sprintf("%d", req.IPConfiguration.IPSubnet.PrefixLength))
+// deleteSNATRules removes the NC subnet from the CNS nftables SNAT maps once no remaining NC uses the subnet. The
+// iptables backend keeps the SWIFT-POSTROUTING chain, which is reconciled on the next NC create.
+func (service *HTTPRestService) deleteSNATRules(req *cns.CreateNetworkContainerRequest) {
+	if service.Options[common.OptHostRulesBackend] != nftables.BackendNftables {
+		return
+	}
 
-		// define all rules we want in the chain
-		rules := [][]string{
-			{"-m", "addrtype", "!", "--dst-type", "local", "-s", podSubnet.String(), "-d", networkutils.AzureDNS, "-p", iptables.UDP, "--dport", strconv.Itoa(iptables.DNSPort), "-j", iptables.Snat, "--to", req.HostPrimaryIP},
-			{"-m", "addrtype", "!", "--dst-type", "local", "-s", podSubnet.String(), "-d", networkutils.AzureDNS, "-p", iptables.TCP, "--dport", strconv.Itoa(iptables.DNSPort), "-j", iptables.Snat, "--to", req.HostPrimaryIP},
-			{"-m", "addrtype", "!", "--dst-type", "local", "-s", podSubnet.String(), "-d", networkutils.AzureIMDS, "-p", iptables.TCP, "--dport", strconv.Itoa(iptables.HTTPPort), "-j", iptables.Snat, "--to", req.HostPrimaryIP},
+	podSubnet, err := snatPodSubnet(req)
+	if err != nil || podSubnet == nil {
+		return
+	}
+	for _, nc := range service.state.ContainerStatus { //nolint:gocritic // copy is ok
+		if subnet, err := snatPodSubnet(&nc.CreateNetworkContainerRequest); err == nil && subnet != nil && subnet.String() == podSubnet.String() {
+			return
 		}
+	}
+
+	if err := nftables.NewClient().DeleteSnatEndpoint(nftables.OwnerCNS, *podSubnet); err != nil {
+		logger.Errorf("[Azure CNS] failed to delete nftables SNAT endpoint for %s: %v", podSubnet.String(), err)
+		return
+	}
+	logger.Printf("[Azure CNS] Deleted nftables SNAT endpoint for %s", podSubnet.String())
+}
 
-		// check if all rules exist
-		allRulesExist := true
-		for _, rule := range rules {
-			exists, err := ipt.Exists(iptables.Nat, SWIFTPOSTROUTING, rule...)
-			if err != nil {
-				return types.UnexpectedError, fmt.Sprintf("[Azure CNS] Error. Failed to check for existence of rule: %v", err)
-			}
-			if !exists {
-				allRulesExist = false
-				break
-			}
+// snatPodSubnet returns the IPv4 pod subnet of the NC, using any secondary ip and the NC prefix length. It returns
+// nil if the NC has no IPv4 secondary ip, since DNS and IMDS do not have IPv6 addresses.
+func snatPodSubnet(req *cns.CreateNetworkContainerRequest) (*net.IPNet, error) {
+	for _, v := range req.SecondaryIPConfigs {
+		if net.ParseIP(v.IPAddress).To4() == nil {
+			continue
 		}
 
-		// get current rule count in SWIFT-POSTROUTING chain
-		currentRules, err := ipt.List(iptables.Nat, SWIFTPOSTROUTING)
+		_, podSubnet, err := net.ParseCIDR(v.IPAddress + "/" + strconv.Itoa(int(req.IPConfiguration.IPSubnet.PrefixLength)))
 		if err != nil {
-			return types.UnexpectedError, fmt.Sprintf("[Azure CNS] Error. Failed to list rules in SWIFT-POSTROUTING chain: %v", err)
+			return nil, errors.Wrap(err, "failed to parse pod subnet")
 		}
+		return podSubnet, nil
+	}
 
-		// if rule count doesn't match or not all rules exist, reconcile
-		// add one because there is always a singular starting rule in the chain, in addition to the ones we add
-		if len(currentRules) != len(rules)+1 || !allRulesExist {
-			logger.Printf("[Azure CNS] Reconciling SWIFT-POSTROUTING chain rules to SNAT Azure DNS and IMDS to Host IP")
-
-			err = ipt.ClearChain(iptables.Nat, SWIFTPOSTROUTING)
-			if err != nil {
-				return types.FailedToRunIPTableCmd, "[Azure CNS] failed to flush SWIFT-POSTROUTING chain : " + err.Error()
-			}
-
-			for _, rule := range rules {
-				err = ipt.Append(iptables.Nat, SWIFTPOSTROUTING, rule...)
-				if err != nil {
-					return types.FailedToRunIPTableCmd, "[Azure CNS] failed to append rule to SWIFT-POSTROUTING chain : " + err.Error()
-				}
-			}
-			logger.Printf("[Azure CNS] Finished reconciling SWIFT-POSTROUTING chain")
-		}
+	return nil, nil
+}
 
-		// we only need to run this code once as the iptable rule applies to all secondary ip configs in the same subnet
-		break
+// MigrateHostRules removes the iptables rules replaced by the nftables host rules backend. It runs once at startup
+// when the nftables backend is selected.
+func (service *HTTPRestService) MigrateHostRules() error {
+	if service.Options[common.OptHostRulesBackend] != nftables.BackendNftables {
+		return nil
 	}
 
-	return types.Success, ""
+	if err := nftables.MigrateFromIptables(iptables.NewClient(), snat.SnatBridgeName); err != nil {
+		return errors.Wrap(err, "failed to migrate host rules from iptables")
+	}
+	return nil
 }
 
 // no-op for linux
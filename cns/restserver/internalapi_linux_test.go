@@ -4,7 +4,9 @@
 package restserver
 
 import (
+	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/Azure/azure-container-networking/cns"
@@ -12,18 +14,15 @@ import (
 	"github.com/Azure/azure-container-networking/cns/types"
 	"github.com/Azure/azure-container-networking/iptables"
 	"github.com/Azure/azure-container-networking/network/networkutils"
+	"github.com/Azure/azure-container-networking/platform"
 )
 
 type FakeIPTablesProvider struct {
-	iptables       *fakes.IPTablesMock
+	iptables       *iptables.Client
 	iptablesLegacy *fakes.IPTablesLegacyMock
 }
 
 func (c *FakeIPTablesProvider) GetIPTables() (iptablesClient, error) {
-	// persist iptables in testing
-	if c.iptables == nil {
-		c.iptables = fakes.NewIPTablesMock()
-	}
 	return c.iptables, nil
 }
 
@@ -35,340 +34,117 @@ func (c *FakeIPTablesProvider) GetIPTablesLegacy() (iptablesLegacyClient, error)
 }
 
 func TestAddSNATRules(t *testing.T) {
-	type chainExpectation struct {
-		table    string
-		chain    string
-		expected []string
+	req := func(primaryIP string, prefixLength uint8, secondaryIP string) *cns.CreateNetworkContainerRequest {
+		return &cns.CreateNetworkContainerRequest{
+			NetworkContainerid: ncID,
+			IPConfiguration: cns.IPConfiguration{
+				IPSubnet: cns.IPSubnet{
+					IPAddress:    primaryIP,
+					PrefixLength: prefixLength,
+				},
+			},
+			SecondaryIPConfigs: map[string]cns.SecondaryIPConfig{
+				"abc": {
+					IPAddress: secondaryIP,
+				},
+			},
+			HostPrimaryIP: "10.0.0.4",
+		}
 	}
-
-	type preExistingRule struct {
-		table string
-		chain string
-		rule  []string
+	snatRules := func(podSubnet string) string {
+		return "-A SWIFT-POSTROUTING -m addrtype ! --dst-type local -s " + podSubnet + " -d " + networkutils.AzureDNS + " -p udp --dport " + strconv.Itoa(iptables.DNSPort) + " -j SNAT --to 10.0.0.4\n" +
+			"-A SWIFT-POSTROUTING -m addrtype ! --dst-type local -s " + podSubnet + " -d " + networkutils.AzureDNS + " -p tcp --dport " + strconv.Itoa(iptables.DNSPort) + " -j SNAT --to 10.0.0.4\n" +
+			"-A SWIFT-POSTROUTING -m addrtype ! --dst-type local -s " + podSubnet + " -d " + networkutils.AzureIMDS + " -p tcp --dport " + strconv.Itoa(iptables.HTTPPort) + " -j SNAT --to 10.0.0.4\n"
 	}
 
 	tests := []struct {
-		name                    string
-		input                   *cns.CreateNetworkContainerRequest
-		preExistingRules        []preExistingRule
-		expectedChains          []chainExpectation
-		expectedClearChainCalls int
+		name string
+		// snapshot is the iptables-save output before the rules are programmed
+		snapshot string
+		input    *cns.CreateNetworkContainerRequest
+		// expected is the iptables-restore input, empty if nothing needs to be programmed
+		expected string
 	}{
 		{
 			// in pod subnet, the primary nic ip is in the same address space as the pod subnet
-			name: "podsubnet",
-			input: &cns.CreateNetworkContainerRequest{
-				NetworkContainerid: ncID,
-				IPConfiguration: cns.IPConfiguration{
-					IPSubnet: cns.IPSubnet{
-						IPAddress:    "240.1.2.1",
-						PrefixLength: 24,
-					},
-				},
-				SecondaryIPConfigs: map[string]cns.SecondaryIPConfig{
-					"abc": {
-						IPAddress: "240.1.2.7",
-					},
-				},
-				HostPrimaryIP: "10.0.0.4",
-			},
-			expectedChains: []chainExpectation{
-				{
-					table: iptables.Nat,
-					chain: SWIFTPOSTROUTING,
-					expected: []string{
-						"-N SWIFT-POSTROUTING",
-						"-A SWIFT-POSTROUTING -m addrtype ! --dst-type local -s 240.1.2.0/24 -d " + networkutils.AzureDNS + " -p udp --dport " + strconv.Itoa(iptables.DNSPort) + " -j SNAT --to 10.0.0.4",
-						"-A SWIFT-POSTROUTING -m addrtype ! --dst-type local -s 240.1.2.0/24 -d " + networkutils.AzureDNS + " -p tcp --dport " + strconv.Itoa(iptables.DNSPort) + " -j SNAT --to 10.0.0.4",
-						"-A SWIFT-POSTROUTING -m addrtype ! --dst-type local -s 240.1.2.0/24 -d " + networkutils.AzureIMDS + " -p tcp --dport " + strconv.Itoa(iptables.HTTPPort) + " -j SNAT --to 10.0.0.4",
-					},
-				},
-				{
-					table: iptables.Nat,
-					chain: iptables.Postrouting,
-					expected: []string{
-						"-P POSTROUTING ACCEPT",
-						"-A POSTROUTING -j SWIFT-POSTROUTING",
-					},
-				},
-			},
-			expectedClearChainCalls: 1,
+			name:     "podsubnet",
+			snapshot: "*nat\n:POSTROUTING ACCEPT [0:0]\nCOMMIT\n",
+			input:    req("240.1.2.1", 24, "240.1.2.7"),
+			expected: "*nat\n:SWIFT-POSTROUTING - [0:0]\n-A POSTROUTING -j SWIFT-POSTROUTING\n" + snatRules("240.1.2.0/24") + "COMMIT\n",
 		},
 		{
 			// test with pre-existing SWIFT rule that should be migrated
 			name: "migration from old SWIFT",
-			input: &cns.CreateNetworkContainerRequest{
-				NetworkContainerid: ncID,
-				IPConfiguration: cns.IPConfiguration{
-					IPSubnet: cns.IPSubnet{
-						IPAddress:    "240.1.2.1",
-						PrefixLength: 24,
-					},
-				},
-				SecondaryIPConfigs: map[string]cns.SecondaryIPConfig{
-					"abc": {
-						IPAddress: "240.1.2.7",
-					},
-				},
-				HostPrimaryIP: "10.0.0.4",
-			},
-			preExistingRules: []preExistingRule{
-				{
-					table: iptables.Nat,
-					chain: iptables.Postrouting,
-					rule:  []string{"-j", "SWIFT"},
-				},
-				{
-					// stale rule at lower priority should be cleaned up
-					table: iptables.Nat,
-					chain: iptables.Postrouting,
-					rule:  []string{"-j", "SWIFT-POSTROUTING"},
-				},
-				{
-					// should be cleaned up
-					table: iptables.Nat,
-					chain: SWIFTPOSTROUTING,
-					rule: []string{
-						"-m", "addrtype", "!", "--dst-type", "local", "-s", "240.1.2.0/24", "-d", networkutils.AzureDNS,
-						"-p", "udp", "--dport", strconv.Itoa(iptables.DNSPort), "-j", "SNAT", "--to", "99.1.2.1",
-					},
-				},
-				{
-					table: iptables.Nat,
-					chain: "SWIFT",
-					rule: []string{
-						"-m", "addrtype", "!", "--dst-type", "local", "-s", "240.1.2.0/24", "-d", networkutils.AzureDNS,
-						"-p", "udp", "--dport", strconv.Itoa(iptables.DNSPort), "-j", "SNAT", "--to", "192.1.2.1",
-					},
-				},
-			},
-			expectedChains: []chainExpectation{
-				{
-					table: iptables.Nat,
-					chain: SWIFTPOSTROUTING,
-					expected: []string{
-						"-N SWIFT-POSTROUTING",
-						"-A SWIFT-POSTROUTING -m addrtype ! --dst-type local -s 240.1.2.0/24 -d " + networkutils.AzureDNS + " -p udp --dport " + strconv.Itoa(iptables.DNSPort) + " -j SNAT --to 10.0.0.4",
-						"-A SWIFT-POSTROUTING -m addrtype ! --dst-type local -s 240.1.2.0/24 -d " + networkutils.AzureDNS + " -p tcp --dport " + strconv.Itoa(iptables.DNSPort) + " -j SNAT --to 10.0.0.4",
-						"-A SWIFT-POSTROUTING -m addrtype ! --dst-type local -s 240.1.2.0/24 -d " + networkutils.AzureIMDS + " -p tcp --dport " + strconv.Itoa(iptables.HTTPPort) + " -j SNAT --to 10.0.0.4",
-					},
-				},
-				{
-					table: iptables.Nat,
-					chain: iptables.Postrouting,
-					expected: []string{
-						"-P POSTROUTING ACCEPT",
-						"-A POSTROUTING -j SWIFT-POSTROUTING",
-						"-A POSTROUTING -j SWIFT",
-					},
-				},
-				{
-					// stale old rule can remain
-					table: iptables.Nat,
-					chain: "SWIFT",
-					expected: []string{
-						"-N SWIFT",
-						"-A SWIFT -m addrtype ! --dst-type local -s 240.1.2.0/24 -d " + networkutils.AzureDNS + " -p udp --dport " + strconv.Itoa(iptables.DNSPort) + " -j SNAT --to 192.1.2.1",
-					},
-				},
-			},
-			expectedClearChainCalls: 1,
+			snapshot: "*nat\n:POSTROUTING ACCEPT [0:0]\n:SWIFT - [0:0]\n:SWIFT-POSTROUTING - [0:0]\n" +
+				"-A POSTROUTING -j SWIFT\n" +
+				// stale rule at lower priority should be moved ahead of the jump to SWIFT
+				"-A POSTROUTING -j SWIFT-POSTROUTING\n" +
+				// stale old rule can remain
+				"-A SWIFT -s 240.1.2.0/24 -d 168.63.129.16/32 -p udp -m addrtype ! --dst-type LOCAL -m udp --dport 53 -j SNAT --to-source 192.1.2.1\n" +
+				// should be cleaned up
+				"-A SWIFT-POSTROUTING -s 240.1.2.0/24 -d 168.63.129.16/32 -p udp -m addrtype ! --dst-type LOCAL -m udp --dport 53 -j SNAT --to-source 99.1.2.1\n" +
+				"COMMIT\n",
+			input:    req("240.1.2.1", 24, "240.1.2.7"),
+			expected: "*nat\n-D POSTROUTING -j SWIFT-POSTROUTING\n-I POSTROUTING 1 -j SWIFT-POSTROUTING\n-F SWIFT-POSTROUTING\n" + snatRules("240.1.2.0/24") + "COMMIT\n",
 		},
 		{
-			// test after migration has already completed
+			// test after migration has already completed, the rules as iptables-save prints them are kept
 			name: "after migration from old SWIFT",
-			input: &cns.CreateNetworkContainerRequest{
-				NetworkContainerid: ncID,
-				IPConfiguration: cns.IPConfiguration{
-					IPSubnet: cns.IPSubnet{
-						IPAddress:    "240.1.2.1",
-						PrefixLength: 24,
-					},
-				},
-				SecondaryIPConfigs: map[string]cns.SecondaryIPConfig{
-					"abc": {
-						IPAddress: "240.1.2.7",
-					},
-				},
-				HostPrimaryIP: "10.0.0.4",
-			},
-			preExistingRules: []preExistingRule{
-				{
-					// rule at higher priority means nothing happens
-					table: iptables.Nat,
-					chain: iptables.Postrouting,
-					rule:  []string{"-j", "SWIFT-POSTROUTING"},
-				},
-				{
-					table: iptables.Nat,
-					chain: iptables.Postrouting,
-					rule:  []string{"-j", "SWIFT"},
-				},
-				{
-					table: iptables.Nat,
-					chain: SWIFTPOSTROUTING,
-					rule: []string{
-						"-m", "addrtype", "!", "--dst-type", "local", "-s", "240.1.2.0/24", "-d", networkutils.AzureDNS,
-						"-p", "udp", "--dport", strconv.Itoa(iptables.DNSPort), "-j", "SNAT", "--to", "10.0.0.4",
-					},
-				},
-				{
-					table: iptables.Nat,
-					chain: SWIFTPOSTROUTING,
-					rule: []string{
-						"-m", "addrtype", "!", "--dst-type", "local", "-s", "240.1.2.0/24", "-d", networkutils.AzureDNS,
-						"-p", "tcp", "--dport", strconv.Itoa(iptables.DNSPort), "-j", "SNAT", "--to", "10.0.0.4",
-					},
-				},
-				{
-					table: iptables.Nat,
-					chain: SWIFTPOSTROUTING,
-					rule: []string{
-						"-m", "addrtype", "!", "--dst-type", "local", "-s", "240.1.2.0/24", "-d", networkutils.AzureIMDS,
-						"-p", "tcp", "--dport", strconv.Itoa(iptables.HTTPPort), "-j", "SNAT", "--to", "10.0.0.4",
-					},
-				},
-				{
-					table: iptables.Nat,
-					chain: "SWIFT",
-					rule: []string{
-						"-m", "addrtype", "!", "--dst-type", "local", "-s", "240.1.2.0/24", "-d", networkutils.AzureDNS,
-						"-p", "udp", "--dport", strconv.Itoa(iptables.DNSPort), "-j", "SNAT", "--to", "192.1.2.1",
-					},
-				},
-			},
-			expectedChains: []chainExpectation{
-				{
-					table: iptables.Nat,
-					chain: SWIFTPOSTROUTING,
-					expected: []string{
-						"-N SWIFT-POSTROUTING",
-						"-A SWIFT-POSTROUTING -m addrtype ! --dst-type local -s 240.1.2.0/24 -d " + networkutils.AzureDNS + " -p udp --dport " + strconv.Itoa(iptables.DNSPort) + " -j SNAT --to 10.0.0.4",
-						"-A SWIFT-POSTROUTING -m addrtype ! --dst-type local -s 240.1.2.0/24 -d " + networkutils.AzureDNS + " -p tcp --dport " + strconv.Itoa(iptables.DNSPort) + " -j SNAT --to 10.0.0.4",
-						"-A SWIFT-POSTROUTING -m addrtype ! --dst-type local -s 240.1.2.0/24 -d " + networkutils.AzureIMDS + " -p tcp --dport " + strconv.Itoa(iptables.HTTPPort) + " -j SNAT --to 10.0.0.4",
-					},
-				},
-				{
-					table: iptables.Nat,
-					chain: iptables.Postrouting,
-					expected: []string{
-						"-P POSTROUTING ACCEPT",
-						"-A POSTROUTING -j SWIFT-POSTROUTING",
-						"-A POSTROUTING -j SWIFT",
-					},
-				},
-				{
-					// stale old rule can remain
-					table: iptables.Nat,
-					chain: "SWIFT",
-					expected: []string{
-						"-N SWIFT",
-						"-A SWIFT -m addrtype ! --dst-type local -s 240.1.2.0/24 -d " + networkutils.AzureDNS + " -p udp --dport " + strconv.Itoa(iptables.DNSPort) + " -j SNAT --to 192.1.2.1",
-					},
-				},
-			},
-			expectedClearChainCalls: 0,
+			snapshot: "*nat\n:POSTROUTING ACCEPT [0:0]\n:SWIFT - [0:0]\n:SWIFT-POSTROUTING - [0:0]\n" +
+				"-A POSTROUTING -j SWIFT-POSTROUTING\n" +
+				"-A POSTROUTING -j SWIFT\n" +
+				"-A SWIFT -s 240.1.2.0/24 -d 168.63.129.16/32 -p udp -m addrtype ! --dst-type LOCAL -m udp --dport 53 -j SNAT --to-source 192.1.2.1\n" +
+				"-A SWIFT-POSTROUTING -s 240.1.2.0/24 -d 168.63.129.16/32 -p udp -m addrtype ! --dst-type LOCAL -m udp --dport 53 -j SNAT --to-source 10.0.0.4\n" +
+				"-A SWIFT-POSTROUTING -s 240.1.2.0/24 -d 168.63.129.16/32 -p tcp -m addrtype ! --dst-type LOCAL -m tcp --dport 53 -j SNAT --to-source 10.0.0.4\n" +
+				"-A SWIFT-POSTROUTING -s 240.1.2.0/24 -d 169.254.169.254/32 -p tcp -m addrtype ! --dst-type LOCAL -m tcp --dport 80 -j SNAT --to-source 10.0.0.4\n" +
+				"COMMIT\n",
+			input: req("240.1.2.1", 24, "240.1.2.7"),
 		},
 		{
 			// in vnet scale, the primary nic ip becomes the node ip (diff address space from pod subnet)
-			name: "vnet scale",
-			input: &cns.CreateNetworkContainerRequest{
-				NetworkContainerid: ncID,
-				IPConfiguration: cns.IPConfiguration{
-					IPSubnet: cns.IPSubnet{
-						IPAddress:    "10.0.0.4",
-						PrefixLength: 28,
-					},
-				},
-				SecondaryIPConfigs: map[string]cns.SecondaryIPConfig{
-					"abc": {
-						IPAddress: "240.1.2.15",
-					},
-				},
-				HostPrimaryIP: "10.0.0.4",
-			},
-			expectedChains: []chainExpectation{
-				{
-					table: iptables.Nat,
-					chain: SWIFTPOSTROUTING,
-					expected: []string{
-						"-N SWIFT-POSTROUTING",
-						"-A SWIFT-POSTROUTING -m addrtype ! --dst-type local -s 240.1.2.0/28 -d " + networkutils.AzureDNS + " -p udp --dport " + strconv.Itoa(iptables.DNSPort) + " -j SNAT --to 10.0.0.4",
-						"-A SWIFT-POSTROUTING -m addrtype ! --dst-type local -s 240.1.2.0/28 -d " + networkutils.AzureDNS + " -p tcp --dport " + strconv.Itoa(iptables.DNSPort) + " -j SNAT --to 10.0.0.4",
-						"-A SWIFT-POSTROUTING -m addrtype ! --dst-type local -s 240.1.2.0/28 -d " + networkutils.AzureIMDS + " -p tcp --dport " + strconv.Itoa(iptables.HTTPPort) + " -j SNAT --to 10.0.0.4",
-					},
-				},
-				{
-					table: iptables.Nat,
-					chain: iptables.Postrouting,
-					expected: []string{
-						"-P POSTROUTING ACCEPT",
-						"-A POSTROUTING -j SWIFT-POSTROUTING",
-					},
-				},
-			},
-			expectedClearChainCalls: 1,
+			name:     "vnet scale",
+			snapshot: "*nat\n:POSTROUTING ACCEPT [0:0]\nCOMMIT\n",
+			input:    req("10.0.0.4", 28, "240.1.2.15"),
+			expected: "*nat\n:SWIFT-POSTROUTING - [0:0]\n-A POSTROUTING -j SWIFT-POSTROUTING\n" + snatRules("240.1.2.0/28") + "COMMIT\n",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			var restored []string
+			pl := platform.NewMockExecClient(false)
+			pl.SetExecRawCommand(func(cmd string) (string, error) {
+				if cmd == "iptables-save" {
+					return tt.snapshot, nil
+				}
+				if strings.Contains(cmd, " -C ") {
+					// rules missing from the snapshot are missing from the ruleset
+					return "", platform.ErrMockExec
+				}
+				// keep the restore input between the heredoc delimiters
+				_, input, _ := strings.Cut(cmd, "\n")
+				restored = append(restored, strings.TrimSuffix(input, "AZURE_IPTABLES_RESTORE_EOF"))
+				return "", nil
+			})
+
 			service := getTestService(cns.KubernetesCRD)
-			ipt := fakes.NewIPTablesMock()
 			iptl := &fakes.IPTablesLegacyMock{}
 			service.iptables = &FakeIPTablesProvider{
-				iptables:       ipt,
+				iptables:       iptables.NewClientWithExecClient(pl),
 				iptablesLegacy: iptl,
 			}
 
-			// setup pre-existing rules
-			if len(tt.preExistingRules) > 0 {
-				for _, preRule := range tt.preExistingRules {
-					chainExists, _ := ipt.ChainExists(preRule.table, preRule.chain)
-
-					if !chainExists {
-						err := ipt.NewChain(preRule.table, preRule.chain)
-						if err != nil {
-							t.Fatal("failed to setup pre-existing rule chain:", err)
-						}
-					}
-
-					err := ipt.Append(preRule.table, preRule.chain, preRule.rule...)
-					if err != nil {
-						t.Fatal("failed to setup pre-existing rule:", err)
-					}
-				}
-			}
-
 			resp, msg := service.programSNATRules(tt.input)
 			if resp != types.Success {
 				t.Fatal("failed to program snat rules", msg)
 			}
 
-			// verify chain contents using List
-			for _, chainExp := range tt.expectedChains {
-				actualRules, err := ipt.List(chainExp.table, chainExp.chain)
-				if err != nil {
-					t.Fatal("failed to list rules for chain", chainExp.chain, ":", err)
-				}
-
-				if len(actualRules) != len(chainExp.expected) {
-					t.Fatalf("chain %s rule count mismatch: got %d, expected %d\nActual: %v\nExpected: %v",
-						chainExp.chain, len(actualRules), len(chainExp.expected), actualRules, chainExp.expected)
-				}
-
-				for i, expectedRule := range chainExp.expected {
-					if actualRules[i] != expectedRule {
-						t.Fatalf("chain %s rule %d mismatch:\nActual:   %s\nExpected: %s",
-							chainExp.chain, i, actualRules[i], expectedRule)
-					}
-				}
+			var expected []string
+			if tt.expected != "" {
+				expected = []string{tt.expected}
 			}
-
-			// verify ClearChain was called the expected number of times
-			actualClearChainCalls := ipt.ClearChainCallCount()
-			if actualClearChainCalls != tt.expectedClearChainCalls {
-				t.Fatalf("ClearChain call count mismatch: got %d, expected %d", actualClearChainCalls, tt.expectedClearChainCalls)
+			if !reflect.DeepEqual(restored, expected) {
+				t.Fatalf("iptables-restore input mismatch:\nActual:   %q\nExpected: %q", restored, expected)
 			}
 
 			// verify we delete legacy swift postrouting jump
@@ -379,3 +155,28 @@ func TestAddSNATRules(t *testing.T) {
 		})
 	}
 }
+
+func TestSnatPodSubnet(t *testing.T) {
+	req := &cns.CreateNetworkContainerRequest{
+		IPConfiguration: cns.IPConfiguration{
+			IPSubnet: cns.IPSubnet{PrefixLength: 24},
+		},
+		SecondaryIPConfigs: map[string]cns.SecondaryIPConfig{
+			"abc": {IPAddress: "fd00::5"},
+		},
+	}
+
+	podSubnet, err := snatPodSubnet(req)
+	if err != nil || podSubnet != nil {
+		t.Fatalf("expected no pod subnet for ipv6 only NC, got %v, %v", podSubnet, err)
+	}
+
+	req.SecondaryIPConfigs["def"] = cns.SecondaryIPConfig{IPAddress: "10.240.1.7"}
+	podSubnet, err = snatPodSubnet(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if podSubnet.String() != "10.240.1.0/24" {
+		t.Fatalf("expected pod subnet 10.240.1.0/24, got %s", podSubnet.String())
+	}
+}
@@ -33,6 +33,14 @@ func (service *HTTPRestService) programSNATRules(req *cns.CreateNetworkContainer
 	return types.Success, ""
 }
 
+// no-op for windows
+func (service *HTTPRestService) deleteSNATRules(_ *cns.CreateNetworkContainerRequest) {}
+
+// MigrateHostRules is a no-op for windows
+func (service *HTTPRestService) MigrateHostRules() error {
+	return nil
+}
+
 // setVFForAccelnetNICs is used in SWIFTV2 mode to set VF on accelnet nics
 func (service *HTTPRestService) setVFForAccelnetNICs() error {
 	// supply the primary MAC address to HNS api
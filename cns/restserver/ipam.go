@@ -17,6 +17,7 @@ import (
 	"github.com/Azure/azure-container-networking/cns/logger"
 	"github.com/Azure/azure-container-networking/cns/types"
 	"github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/errcode"
 	"github.com/Azure/azure-container-networking/store"
 	"github.com/pkg/errors"
 	"golang.org/x/exp/maps"
@@ -73,12 +74,14 @@ func (service *HTTPRestService) requestIPConfigHandlerHelper(ctx context.Context
 
 	// record a pod requesting an IP
 	service.podsPendingIPAssignment.Push(podInfo.Key())
+	service.ipRequestTraces.Add(ctx)
 	podIPInfo, err := requestIPConfigsHelper(service, ipconfigsRequest) //nolint:contextcheck // appease linter for revert PR
 	if err != nil {
 		return &cns.IPConfigsResponse{
 			Response: cns.Response{
 				ReturnCode: types.FailedToAllocateIPConfig,
 				Message:    fmt.Sprintf("AllocateIPConfig failed: %v, IP config request is %v", err, ipconfigsRequest),
+				Error:      errcode.From(err),
 			},
 			PodIPInfo: podIPInfo,
 		}, err
@@ -144,6 +147,7 @@ func (service *HTTPRestService) requestIPConfigHandlerHelperStandalone(ctx conte
 			Response: cns.Response{
 				ReturnCode: types.FailedToAllocateIPConfig,
 				Message:    fmt.Sprintf("AllocateIPConfig failed due to not getting NC Response from statefile, IP config request is %+v", ipconfigsRequest),
+				Error:      errcode.Wrap(ErrGetAllNCResponseEmpty, errcode.NCNotProgrammed),
 			},
 		}, ErrGetAllNCResponseEmpty
 	}
@@ -245,6 +249,7 @@ func (service *HTTPRestService) RequestIPConfigHandler(w http.ResponseWriter, r
 		InfraContainerID:    ipconfigRequest.InfraContainerID,
 		OrchestratorContext: ipconfigRequest.OrchestratorContext,
 		Ifname:              ipconfigRequest.Ifname,
+		Owner:               ipconfigRequest.Owner,
 	}
 	if ipconfigRequest.DesiredIPAddress != "" {
 		ipconfigsRequest.DesiredIPAddresses = []string{
@@ -252,7 +257,7 @@ func (service *HTTPRestService) RequestIPConfigHandler(w http.ResponseWriter, r
 		}
 	}
 
-	ipConfigsResp, errResp := service.requestIPConfigHandlerHelper(r.Context(), ipconfigsRequest) //nolint:contextcheck // appease linter
+	ipConfigsResp, errResp := traceIPConfigsHandler(requestIPConfigsSpan, service.requestIPConfigHandlerHelper)(r.Context(), ipconfigsRequest) //nolint:contextcheck // appease linter
 	if errResp != nil {
 		// As this API is expected to return IPConfigResponse, generate it from the IPConfigsResponse returned above
 		reserveResp := &cns.IPConfigResponse{
@@ -305,17 +310,21 @@ func (service *HTTPRestService) RequestIPConfigsHandler(w http.ResponseWriter, r
 	if service.IPConfigsHandlerMiddleware != nil {
 		// Wrap the default datapath handlers with the middleware depending on middleware type
 		var wrappedHandler cns.IPConfigsHandlerFunc
+		// the middleware and the handlers it wraps are traced in child spans of the request
 		switch service.IPConfigsHandlerMiddleware.Type() {
 		case cns.K8sSWIFTV2:
-			wrappedHandler = service.IPConfigsHandlerMiddleware.IPConfigsRequestHandlerWrapper(service.requestIPConfigHandlerHelper, service.ReleaseIPConfigHandlerHelper)
+			wrappedHandler = service.IPConfigsHandlerMiddleware.IPConfigsRequestHandlerWrapper(
+				traceIPConfigsHandler(requestIPConfigsSpan, service.requestIPConfigHandlerHelper),
+				traceIPConfigsHandler(releaseIPConfigsSpan, service.ReleaseIPConfigHandlerHelper))
 		// this middleware is used for standalone swiftv2 secenario where a different helper is invoked as the PodInfo is read from cns state
 		case cns.StandaloneSWIFTV2:
-			wrappedHandler = service.IPConfigsHandlerMiddleware.IPConfigsRequestHandlerWrapper(service.requestIPConfigHandlerHelperStandalone, nil)
+			wrappedHandler = service.IPConfigsHandlerMiddleware.IPConfigsRequestHandlerWrapper(
+				traceIPConfigsHandler(requestIPConfigsSpan, service.requestIPConfigHandlerHelperStandalone), nil)
 		}
 
-		ipConfigsResp, err = wrappedHandler(r.Context(), ipconfigsRequest)
+		ipConfigsResp, err = traceIPConfigsHandler(ipConfigsMiddlewareSpan, wrappedHandler)(r.Context(), ipconfigsRequest)
 	} else {
-		ipConfigsResp, err = service.requestIPConfigHandlerHelper(r.Context(), ipconfigsRequest) // nolint:contextcheck // appease linter
+		ipConfigsResp, err = traceIPConfigsHandler(requestIPConfigsSpan, service.requestIPConfigHandlerHelper)(r.Context(), ipconfigsRequest) // nolint:contextcheck // appease linter
 	}
 
 	if err != nil {
@@ -403,6 +412,7 @@ func (service *HTTPRestService) ReleaseIPConfigHandlerHelper(ctx context.Context
 			},
 		}, fmt.Errorf("failed to validate ip config request") //nolint:goerr113 // return error
 	}
+	service.ipRequestTraces.Add(ctx)
 	// Check if http rest service managed endpoint state is set
 	if service.Options[common.OptManageEndpointState] == true {
 		if err := service.removeEndpointState(podInfo); err != nil {
@@ -421,6 +431,7 @@ func (service *HTTPRestService) ReleaseIPConfigHandlerHelper(ctx context.Context
 			Response: cns.Response{
 				ReturnCode: types.UnexpectedError,
 				Message:    err.Error(),
+				Error:      errcode.From(err),
 			},
 		}, fmt.Errorf("ReleaseIPConfigHandlerHelper releaseIPConfigs failed : %v, release IP config info %+v", returnMessage, ipconfigsRequest) //nolint:goerr113 // return error
 	}
@@ -476,7 +487,7 @@ func (service *HTTPRestService) ReleaseIPConfigHandler(w http.ResponseWriter, r
 		Ifname:              ipconfigRequest.Ifname,
 	}
 
-	resp, err := service.ReleaseIPConfigHandlerHelper(r.Context(), ipconfigsRequest)
+	resp, err := traceIPConfigsHandler(releaseIPConfigsSpan, service.ReleaseIPConfigHandlerHelper)(r.Context(), ipconfigsRequest)
 	if err != nil {
 		w.Header().Set(cnsReturnCode, resp.Response.ReturnCode.String())
 		err = common.Encode(w, &resp)
@@ -507,7 +518,7 @@ func (service *HTTPRestService) ReleaseIPConfigsHandler(w http.ResponseWriter, r
 		return
 	}
 
-	resp, err := service.ReleaseIPConfigHandlerHelper(r.Context(), ipconfigsRequest)
+	resp, err := traceIPConfigsHandler(releaseIPConfigsSpan, service.ReleaseIPConfigHandlerHelper)(r.Context(), ipconfigsRequest)
 	if err != nil {
 		w.Header().Set(cnsReturnCode, resp.Response.ReturnCode.String())
 		err = common.Encode(w, &resp)
@@ -777,6 +788,40 @@ func (service *HTTPRestService) GetPendingReleaseIPConfigs() []cns.IPConfigurati
 	return filter.MatchAnyIPConfigState(service.PodIPConfigState, filter.StatePendingRelease)
 }
 
+// PodIPsProgrammed reports whether CNS assigned IPs to the pod, and whether each of them is backed by an NC version which
+// NMAgent reports as programmed.
+func (service *HTTPRestService) PodIPsProgrammed(podName, podNamespace string) (assigned, programmed bool) {
+	service.RLock()
+	defer service.RUnlock()
+	programmed = true
+	for _, ipConfig := range service.PodIPConfigState { //nolint:gocritic // ignore copy
+		if ipConfig.GetState() != types.Assigned || ipConfig.PodInfo == nil ||
+			ipConfig.PodInfo.Name() != podName || ipConfig.PodInfo.Namespace() != podNamespace {
+			continue
+		}
+		assigned = true
+		programmed = programmed && service.isIPProgrammedUntransacted(&ipConfig)
+	}
+	return assigned, assigned && programmed
+}
+
+// isIPProgrammedUntransacted reports whether NMAgent programmed the NC version which added the IP, does not take a lock.
+func (service *HTTPRestService) isIPProgrammedUntransacted(ipConfig *cns.IPConfigurationStatus) bool {
+	ncStatus, ok := service.state.ContainerStatus[ipConfig.NCID]
+	if !ok {
+		return false
+	}
+	if ncStatus.VfpUpdateComplete {
+		return true
+	}
+	hostNCVersion, err := strconv.Atoi(ncStatus.HostVersion)
+	if err != nil || hostNCVersion < 0 {
+		return false
+	}
+	secondaryIPConfig, ok := ncStatus.CreateNetworkContainerRequest.SecondaryIPConfigs[ipConfig.ID]
+	return ok && secondaryIPConfig.NCVersion <= hostNCVersion
+}
+
 // assignIPConfig assigns the the ipconfig to the passed Pod, sets the state as Assigned, does not take a lock.
 func (service *HTTPRestService) assignIPConfig(ipconfig cns.IPConfigurationStatus, podInfo cns.PodInfo) error { //nolint:gocritic // ignore hugeparam
 	ipconfig, err := service.updateIPConfigState(ipconfig.ID, types.Assigned, podInfo)
@@ -818,9 +863,8 @@ func (service *HTTPRestService) releaseIPConfigs(podInfo cns.PodInfo) error {
 			if ipconfig, isExist := service.PodIPConfigState[ipID]; isExist {
 				ipsToBeReleased = append(ipsToBeReleased, ipconfig)
 			} else {
-				//nolint:goerr113 // return error
-				return fmt.Errorf("[releaseIPConfigs] Failed to get ipconfig %+v and pod info is %+v. Pod to IPID exists, but IPID to IPConfig doesn't exist, CNS State potentially corrupt",
-					ipconfig.IPAddress, podInfo)
+				return errcode.New(errcode.StateStoreCorrupt, fmt.Sprintf("[releaseIPConfigs] Failed to get ipconfig %+v and pod info is %+v. Pod to IPID exists, but IPID to IPConfig doesn't exist, CNS State potentially corrupt",
+					ipconfig.IPAddress, podInfo))
 			}
 		} else {
 			logger.Errorf("[releaseIPConfigs] releaseIPConfigs could not find ipID at index %d for pod [%+v]", i, podInfo)
@@ -894,7 +938,7 @@ func (service *HTTPRestService) GetExistingIPConfig(podInfo cns.PodInfo) ([]cns.
 			} else {
 				errMsg := fmt.Sprintf("Failed to get existing ipconfig for pod %+v. Pod to IPID exists, but IPID to IPConfig doesn't exist, CNS State potentially corrupt", podInfo)
 				logger.Errorf(errMsg)
-				return podIPInfo, false, errors.New(errMsg)
+				return podIPInfo, false, errcode.New(errcode.StateStoreCorrupt, errMsg)
 			}
 		}
 	}
@@ -912,7 +956,7 @@ func (service *HTTPRestService) AssignDesiredIPConfigs(podInfo cns.PodInfo, desi
 	numOfNCs := len(service.state.ContainerStatus)
 	// checks to make sure we have NCs before trying to get IPs
 	if numOfNCs == 0 {
-		return nil, ErrNoNCs
+		return nil, errcode.Wrap(ErrNoNCs, errcode.NCNotProgrammed)
 	}
 	// Sets the number of desired IPs equal to the number of desired IPs passed in
 	numDesiredIPAddresses := len(desiredIPAddresses)
@@ -1012,7 +1056,7 @@ func (service *HTTPRestService) AssignAvailableIPConfigs(podInfo cns.PodInfo) ([
 	numOfNCs := len(service.state.ContainerStatus)
 	// if there are no NCs on the NNC there will be no IPs in the pool so return error
 	if numOfNCs == 0 {
-		return nil, ErrNoNCs
+		return nil, errcode.Wrap(ErrNoNCs, errcode.NCNotProgrammed)
 	}
 
 	// Get the number of distinct IP families (IPv4/IPv6) across all NC's and determine the number of IPs to assign based on IP families found
@@ -1062,8 +1106,9 @@ func (service *HTTPRestService) AssignAvailableIPConfigs(podInfo cns.PodInfo) ([
 				if _, found := ipsToAssign[generateAssignedIPKey(ncID, ipFamily)]; found {
 					continue
 				}
-				return podIPInfo, errors.Errorf("not enough IPs available of type %s for %s, waiting on Azure CNS to allocate more with NC Status: %s",
-					ipFamily, ncID, string(service.state.ContainerStatus[ncID].CreateNetworkContainerRequest.NCStatus))
+				ncStatus := string(service.state.ContainerStatus[ncID].CreateNetworkContainerRequest.NCStatus)
+				return podIPInfo, errcode.Wrap(errors.Errorf("not enough IPs available of type %s for %s, waiting on Azure CNS to allocate more with NC Status: %s",
+					ipFamily, ncID, ncStatus), errcode.IPPoolExhausted).WithDetail("nc", ncID).WithDetail("ncStatus", ncStatus)
 			}
 		}
 	}
@@ -1095,8 +1140,7 @@ func (service *HTTPRestService) AssignAvailableIPConfigs(podInfo cns.PodInfo) ([
 				logger.Errorf("[AssignAvailableIPConfigs] failed to mark IPConfig [%+v] back to Available. err: %v", ipState, err)
 			}
 		}
-		//nolint:goerr113 // return error
-		return podIPInfo, fmt.Errorf("not enough IPs available, waiting on Azure CNS to allocate more")
+		return podIPInfo, errcode.New(errcode.IPPoolExhausted, "not enough IPs available, waiting on Azure CNS to allocate more")
 	}
 
 	//nolint:staticcheck // SA1019: suppress deprecated logger.Printf usage. Todo: legacy logger usage is consistent in cns repo. Migrates when all logger usage is migrated
@@ -16,6 +16,7 @@ import (
 	"github.com/Azure/azure-container-networking/cns/middlewares"
 	"github.com/Azure/azure-container-networking/cns/middlewares/mock"
 	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/errcode"
 	nma "github.com/Azure/azure-container-networking/nmagent"
 	"github.com/Azure/azure-container-networking/store"
 	"github.com/pkg/errors"
@@ -1560,6 +1561,7 @@ func TestIPAMFailToRequestIPsWithNoNCsSpecificIP(t *testing.T) {
 		t.Fatalf("Expected error. Should not be able to request IPs when there are no NCs")
 	}
 	assert.ErrorIs(t, err, ErrNoNCs)
+	assert.True(t, errcode.Is(err, errcode.NCNotProgrammed))
 }
 
 func TestIPAMFailToRequestIPsWithNoNCsAnyIP(t *testing.T) {
@@ -1576,6 +1578,7 @@ func TestIPAMFailToRequestIPsWithNoNCsAnyIP(t *testing.T) {
 		t.Fatalf("Expected error. Should not be able to request IPs when there are no NCs")
 	}
 	assert.ErrorIs(t, err, ErrNoNCs)
+	assert.True(t, errcode.Is(err, errcode.NCNotProgrammed))
 }
 
 func TestIPAMReleaseOneIPWhenExpectedToHaveTwo(t *testing.T) {
@@ -2321,6 +2324,7 @@ func TestIPAMRequestIPConfigsProgrammingPendingFailure(t *testing.T) {
 	_, err = requestIPConfigsHelper(svc, req)
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "not enough IPs available")
+	assert.True(t, errcode.Is(err, errcode.IPPoolExhausted))
 
 	// Verify no IPs were assigned
 	assignedIPs := svc.GetAssignedIPConfigs()
@@ -2485,3 +2489,38 @@ func TestStatelessCNIStateFile(t *testing.T) {
 		})
 	}
 }
+
+func TestPodIPsProgrammed(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	createAndValidateNCRequest(t, map[string]cns.SecondaryIPConfig{
+		testIPID1: newSecondaryIPConfig(testIP1, -1),
+	}, testNCID, "-1")
+
+	assigned, programmed := svc.PodIPsProgrammed(testPod1Info.Name(), testPod1Info.Namespace())
+	require.False(t, assigned)
+	require.False(t, programmed)
+
+	_, err := svc.AssignAvailableIPConfigs(testPod1Info)
+	require.NoError(t, err)
+	// NMAgent hasn't programmed any version of the NC yet
+	assigned, programmed = svc.PodIPsProgrammed(testPod1Info.Name(), testPod1Info.Namespace())
+	require.True(t, assigned)
+	require.False(t, programmed)
+
+	ncStatus := svc.state.ContainerStatus[testNCID]
+	ncStatus.HostVersion = "0"
+	svc.state.ContainerStatus[testNCID] = ncStatus
+	_, programmed = svc.PodIPsProgrammed(testPod1Info.Name(), testPod1Info.Namespace())
+	require.True(t, programmed)
+
+	// the IP was added by an NC version which isn't programmed yet
+	ncStatus.CreateNetworkContainerRequest.SecondaryIPConfigs[testIPID1] = newSecondaryIPConfig(testIP1, 1)
+	svc.state.ContainerStatus[testNCID] = ncStatus
+	_, programmed = svc.PodIPsProgrammed(testPod1Info.Name(), testPod1Info.Namespace())
+	require.False(t, programmed)
+
+	ncStatus.VfpUpdateComplete = true
+	svc.state.ContainerStatus[testNCID] = ncStatus
+	_, programmed = svc.PodIPsProgrammed(testPod1Info.Name(), testPod1Info.Namespace())
+	require.True(t, programmed)
+}
@@ -0,0 +1,218 @@
+package restserver
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/lease"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	leaseAdopted  = "adopted"
+	leaseReleased = "released"
+	leaseConflict = "conflict"
+)
+
+// SyncLeases reconciles the offline IP leases with the IPAM state, then tops up the unconsumed leases to count.
+// The IPs of leases which CNI consumed while CNS was unreachable are assigned to the pods which consumed them, those of
+// released leases are freed, and those of unconsumed leases stay held by CNS. Consumed leases whose IPs couldn't all be
+// assigned stay in the cache, so that the next sync retries them.
+// After CNS starts it must sync before it serves IP requests, as it doesn't hold the IPs of the leases until then.
+func (service *HTTPRestService) SyncLeases(cache *lease.Cache, count int) error {
+	if count == 0 && !cache.Exists() {
+		return nil
+	}
+	defer service.publishIPStateMetrics()
+	err := cache.Update(func(leases []lease.Lease) ([]lease.Lease, error) {
+		unconsumed := make([]lease.Lease, 0, count)
+		pending := []lease.Lease{}
+		for i := range leases {
+			switch {
+			case leases[i].Consumer == nil:
+				if service.holdLease(&leases[i]) {
+					unconsumed = append(unconsumed, leases[i])
+				}
+			case leases[i].Consumer.Released:
+				service.releaseLease(&leases[i])
+			default:
+				if !service.adoptLease(&leases[i]) {
+					pending = append(pending, leases[i])
+				}
+			}
+		}
+
+		for len(unconsumed) < count {
+			l := lease.Lease{ID: uuid.NewString(), LeasedAt: time.Now()}
+			podIPInfo, err := service.AssignAvailableIPConfigs(l.PodInfo())
+			if err != nil {
+				logger.Printf("[SyncLeases] Leasing %d of %d IPs, no more are available: %v", len(unconsumed), count, err)
+				break
+			}
+			l.PodIPInfo = podIPInfo
+			unconsumed = append(unconsumed, l)
+		}
+		if len(unconsumed) > count {
+			unconsumed = unconsumed[:count]
+		}
+		ipLeaseCount.Set(float64(len(unconsumed)))
+		kept := append(unconsumed, pending...)
+		service.releaseUnleasedIPs(kept)
+		return kept, nil
+	})
+	return errors.Wrap(err, "failed to sync IP leases")
+}
+
+// holdLease assigns the IPs of the unconsumed lease to its placeholder pod and refreshes their PodIpInfo. If any of
+// its IPs is gone or assigned to a pod, the lease is dropped so that CNI can't hand out an IP twice.
+func (service *HTTPRestService) holdLease(l *lease.Lease) bool {
+	service.Lock()
+	defer service.Unlock()
+	podInfo := l.PodInfo()
+	ipConfigs := make([]cns.IPConfigurationStatus, 0, len(l.PodIPInfo))
+	for i := range l.PodIPInfo {
+		ipConfig, found := service.ipConfigByAddressUntransacted(l.PodIPInfo[i].PodIPConfig.IPAddress)
+		if !found || !(ipConfig.GetState() == types.Available || assignedTo(&ipConfig, podInfo)) {
+			logger.Errorf("[holdLease] Dropping lease %s, its IP %s is not available: %+v", l.ID, l.PodIPInfo[i].PodIPConfig.IPAddress, ipConfig)
+			ipLeaseReconciledCount.WithLabelValues(leaseConflict).Inc()
+			service.releaseIPConfigsUntransacted(podInfo)
+			return false
+		}
+		ipConfigs = append(ipConfigs, ipConfig)
+	}
+	for i := range ipConfigs {
+		if ipConfigs[i].GetState() == types.Available {
+			if err := service.assignIPConfig(ipConfigs[i], podInfo); err != nil {
+				logger.Errorf("[holdLease] Dropping lease %s, failed to assign its IP %s: %v", l.ID, ipConfigs[i].IPAddress, err)
+				service.releaseIPConfigsUntransacted(podInfo)
+				return false
+			}
+		}
+		if err := service.populateIPConfigInfoUntransacted(ipConfigs[i], &l.PodIPInfo[i]); err != nil {
+			logger.Errorf("[holdLease] Failed to refresh the IP config of lease %s: %v", l.ID, err)
+		}
+	}
+	return true
+}
+
+// adoptLease assigns the IPs of the consumed lease to the pod which consumed it. They may already be assigned to the
+// pod, as CNS assigns the IPs of the pods on the node when it starts. It returns false if an IP isn't known yet or
+// failed to be assigned, in which case the IPs which weren't adopted stay held for the lease. IPs which CNS assigned to
+// another pod can't be adopted and are left to it, but the lease isn't adopted either: the conflict is counted and
+// logged for both pods at every sync, until the pod which consumed the lease is deleted and CNI releases it.
+func (service *HTTPRestService) adoptLease(l *lease.Lease) bool {
+	service.Lock()
+	defer service.Unlock()
+	podInfo := l.Consumer.PodInfo()
+	leasePodInfo := l.PodInfo()
+	adopted := true
+	for i := range l.PodIPInfo {
+		ipConfig, found := service.ipConfigByAddressUntransacted(l.PodIPInfo[i].PodIPConfig.IPAddress)
+		switch {
+		case !found:
+			logger.Errorf("[adoptLease] IP %s of lease %s which pod %+v consumed is not known yet", l.PodIPInfo[i].PodIPConfig.IPAddress, l.ID, podInfo)
+			adopted = false
+		case assignedTo(&ipConfig, podInfo):
+		case ipConfig.GetState() == types.Available || assignedTo(&ipConfig, leasePodInfo):
+			if err := service.assignIPConfig(ipConfig, podInfo); err != nil {
+				logger.Errorf("[adoptLease] Failed to assign IP %s of lease %s to pod %+v: %v", ipConfig.IPAddress, l.ID, podInfo, err)
+				adopted = false
+			}
+		default:
+			owner := "no pod"
+			if ipConfig.PodInfo != nil {
+				owner = fmt.Sprintf("pod %s/%s", ipConfig.PodInfo.Namespace(), ipConfig.PodInfo.Name())
+			}
+			logger.Errorf("[adoptLease] Conflict: IP %s of lease %s which pod %s/%s consumed is %s for %s",
+				ipConfig.IPAddress, l.ID, podInfo.Namespace(), podInfo.Name(), ipConfig.GetState(), owner)
+			ipLeaseReconciledCount.WithLabelValues(leaseConflict).Inc()
+			adopted = false
+		}
+	}
+	if !adopted {
+		// the placeholder keeps only the IPs which are still held for the lease, so releasing it never frees the IPs
+		// which were adopted
+		held := []string{}
+		for _, ipID := range service.PodIPIDByPodInterfaceKey[leasePodInfo.Key()] {
+			if ipConfig, found := service.PodIPConfigState[ipID]; found && assignedTo(&ipConfig, leasePodInfo) {
+				held = append(held, ipID)
+			}
+		}
+		if len(held) == 0 {
+			delete(service.PodIPIDByPodInterfaceKey, leasePodInfo.Key())
+		} else {
+			service.PodIPIDByPodInterfaceKey[leasePodInfo.Key()] = held
+		}
+		logger.Printf("[adoptLease] Retrying to assign the IPs of lease %s to pod %+v at the next sync", l.ID, podInfo)
+		return false
+	}
+	delete(service.PodIPIDByPodInterfaceKey, leasePodInfo.Key())
+	logger.Printf("[adoptLease] Assigned the IPs of lease %s to pod %+v", l.ID, podInfo)
+	ipLeaseReconciledCount.WithLabelValues(leaseAdopted).Inc()
+	return true
+}
+
+// releaseLease frees the IPs of the lease which was released by CNI, as the pod which consumed it was deleted.
+func (service *HTTPRestService) releaseLease(l *lease.Lease) {
+	service.Lock()
+	defer service.Unlock()
+	podInfo := l.Consumer.PodInfo()
+	service.releaseIPConfigsUntransacted(l.PodInfo())
+	service.releaseIPConfigsUntransacted(podInfo)
+	// the IPs may be Assigned to the pod without being indexed by it yet
+	for i := range l.PodIPInfo {
+		if ipConfig, found := service.ipConfigByAddressUntransacted(l.PodIPInfo[i].PodIPConfig.IPAddress); found && assignedTo(&ipConfig, podInfo) {
+			_, _ = service.unassignIPConfig(ipConfig, podInfo)
+		}
+	}
+	logger.Printf("[releaseLease] Released the IPs of lease %s which pod %+v consumed", l.ID, podInfo)
+	ipLeaseReconciledCount.WithLabelValues(leaseReleased).Inc()
+}
+
+// releaseUnleasedIPs frees the IPs held by placeholder pods of leases which aren't in the cache anymore, e.g. because
+// the count was lowered or the file was removed.
+func (service *HTTPRestService) releaseUnleasedIPs(leases []lease.Lease) {
+	leased := make(map[string]struct{}, len(leases))
+	for i := range leases {
+		leased[leases[i].PodInfo().Key()] = struct{}{}
+	}
+	service.Lock()
+	defer service.Unlock()
+	for key, ipIDs := range service.PodIPIDByPodInterfaceKey {
+		if _, ok := leased[key]; ok || len(ipIDs) == 0 {
+			continue
+		}
+		if ipConfig, found := service.PodIPConfigState[ipIDs[0]]; found && lease.IsLease(ipConfig.PodInfo) {
+			logger.Printf("[releaseUnleasedIPs] Releasing the IPs of lease %s", ipConfig.PodInfo.InfraContainerID())
+			service.releaseIPConfigsUntransacted(ipConfig.PodInfo)
+		}
+	}
+}
+
+// releaseIPConfigsUntransacted sets the IPs assigned to the pod as Available, does not take a lock.
+func (service *HTTPRestService) releaseIPConfigsUntransacted(podInfo cns.PodInfo) {
+	for _, ipID := range service.PodIPIDByPodInterfaceKey[podInfo.Key()] {
+		if _, err := service.updateIPConfigState(ipID, types.Available, nil); err != nil {
+			logger.Errorf("[releaseIPConfigsUntransacted] Failed to release IP %s of pod %+v: %v", ipID, podInfo, err)
+		}
+	}
+	delete(service.PodIPIDByPodInterfaceKey, podInfo.Key())
+}
+
+// ipConfigByAddressUntransacted returns the IPConfigurationStatus of the IP address, does not take a lock.
+func (service *HTTPRestService) ipConfigByAddressUntransacted(ipAddress string) (cns.IPConfigurationStatus, bool) {
+	for _, ipConfig := range service.PodIPConfigState { //nolint:gocritic // ignore copy
+		if ipConfig.IPAddress == ipAddress {
+			return ipConfig, true
+		}
+	}
+	return cns.IPConfigurationStatus{}, false
+}
+
+func assignedTo(ipConfig *cns.IPConfigurationStatus, podInfo cns.PodInfo) bool {
+	return ipConfig.GetState() == types.Assigned && ipConfig.PodInfo != nil && ipConfig.PodInfo.Key() == podInfo.Key()
+}
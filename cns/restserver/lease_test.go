@@ -0,0 +1,194 @@
+package restserver
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/lease"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func leasedIPs(svc *HTTPRestService) []string {
+	ips := []string{}
+	for _, ipConfig := range svc.PodIPConfigState { //nolint:gocritic // ignore copy
+		if lease.IsLease(ipConfig.PodInfo) {
+			ips = append(ips, ipConfig.IPAddress)
+		}
+	}
+	return ips
+}
+
+func TestSyncLeases(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	createAndValidateNCRequest(t, map[string]cns.SecondaryIPConfig{
+		testIPID1: newSecondaryIPConfig(testIP1, -1),
+		testIPID2: newSecondaryIPConfig(testIP2, -1),
+		testIPID3: newSecondaryIPConfig(testIP3, -1),
+	}, testNCID, "-1")
+	cache := lease.New(filepath.Join(t.TempDir(), "ipleases.json"))
+
+	require.NoError(t, svc.SyncLeases(cache, 2))
+	require.Len(t, leasedIPs(svc), 2)
+
+	// CNI consumes a lease while CNS is down
+	consumed, err := cache.Consume(lease.Consumer{InfraContainerID: testPod1Info.InfraContainerID(), PodInterfaceID: testPod1Info.InterfaceID(), PodName: testPod1Info.Name(), PodNamespace: testPod1Info.Namespace()})
+	require.NoError(t, err)
+	ip := consumed.PodIPInfo[0].PodIPConfig.IPAddress
+
+	// CNS adopts it and tops the leases up with the last available IP
+	require.NoError(t, svc.SyncLeases(cache, 2))
+	podIPInfo, exists, err := svc.GetExistingIPConfig(testPod1Info)
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, ip, podIPInfo[0].PodIPConfig.IPAddress)
+	require.Len(t, leasedIPs(svc), 2)
+	require.NotContains(t, leasedIPs(svc), ip)
+
+	// a pod deleted before CNS adopted its lease gets its IPs released
+	consumed, err = cache.Consume(lease.Consumer{InfraContainerID: testPod2Info.InfraContainerID(), PodInterfaceID: testPod2Info.InterfaceID(), PodName: testPod2Info.Name(), PodNamespace: testPod2Info.Namespace()})
+	require.NoError(t, err)
+	released, err := cache.Release(testPod2Info.InfraContainerID())
+	require.NoError(t, err)
+	require.True(t, released)
+	require.NoError(t, svc.SyncLeases(cache, 1))
+	_, exists, err = svc.GetExistingIPConfig(testPod2Info)
+	require.NoError(t, err)
+	require.False(t, exists)
+	ipConfig, _ := svc.ipConfigByAddressUntransacted(consumed.PodIPInfo[0].PodIPConfig.IPAddress)
+	require.Equal(t, types.Available, ipConfig.GetState())
+	require.Len(t, leasedIPs(svc), 1)
+
+	// leases are released when they are disabled
+	require.NoError(t, svc.SyncLeases(cache, 0))
+	require.Empty(t, leasedIPs(svc))
+	_, err = cache.Consume(lease.Consumer{InfraContainerID: testPod3Info.InfraContainerID()})
+	require.ErrorIs(t, err, lease.ErrNoLeases)
+}
+
+func TestSyncLeasesAfterRestart(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	createAndValidateNCRequest(t, map[string]cns.SecondaryIPConfig{
+		testIPID1: newSecondaryIPConfig(testIP1, -1),
+		testIPID2: newSecondaryIPConfig(testIP2, -1),
+	}, testNCID, "-1")
+	cache := lease.New(filepath.Join(t.TempDir(), "ipleases.json"))
+	require.NoError(t, svc.SyncLeases(cache, 2))
+	leased := leasedIPs(svc)
+
+	// after a restart CNS assigned one of the leased IPs to a pod before it synced, so that lease is dropped
+	svc = getTestService(cns.KubernetesCRD)
+	createAndValidateNCRequest(t, map[string]cns.SecondaryIPConfig{
+		testIPID1: newSecondaryIPConfig(testIP1, -1),
+		testIPID2: newSecondaryIPConfig(testIP2, -1),
+	}, testNCID, "-1")
+	ipConfig, _ := svc.ipConfigByAddressUntransacted(leased[0])
+	require.NoError(t, svc.assignIPConfig(ipConfig, testPod1Info))
+
+	require.NoError(t, svc.SyncLeases(cache, 2))
+	require.Equal(t, leased[1:], leasedIPs(svc))
+	var leases []lease.Lease
+	require.NoError(t, cache.Update(func(l []lease.Lease) ([]lease.Lease, error) {
+		leases = l
+		return l, nil
+	}))
+	require.Len(t, leases, 1)
+	require.Equal(t, leased[1], leases[0].PodIPInfo[0].PodIPConfig.IPAddress)
+}
+
+func TestSyncLeasesRetriesAdoption(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	createAndValidateNCRequest(t, map[string]cns.SecondaryIPConfig{
+		testIPID1: newSecondaryIPConfig(testIP1, -1),
+	}, testNCID, "-1")
+	cache := lease.New(filepath.Join(t.TempDir(), "ipleases.json"))
+	require.NoError(t, svc.SyncLeases(cache, 1))
+	consumed, err := cache.Consume(lease.Consumer{InfraContainerID: testPod1Info.InfraContainerID(), PodInterfaceID: testPod1Info.InterfaceID(), PodName: testPod1Info.Name(), PodNamespace: testPod1Info.Namespace()})
+	require.NoError(t, err)
+	ip := consumed.PodIPInfo[0].PodIPConfig.IPAddress
+
+	// after a restart CNS doesn't know the IP of the consumed lease yet, so the lease is kept
+	svc = getTestService(cns.KubernetesCRD)
+	createAndValidateNCRequest(t, map[string]cns.SecondaryIPConfig{
+		testIPID2: newSecondaryIPConfig(testIP2, -1),
+	}, testNCID, "-1")
+	require.NoError(t, svc.SyncLeases(cache, 1))
+	_, exists, err := svc.GetExistingIPConfig(testPod1Info)
+	require.NoError(t, err)
+	require.False(t, exists)
+	require.Equal(t, []string{testIP2}, leasedIPs(svc))
+	var leases []lease.Lease
+	require.NoError(t, cache.Update(func(l []lease.Lease) ([]lease.Lease, error) {
+		leases = l
+		return l, nil
+	}))
+	require.Len(t, leases, 2)
+
+	// the next sync adopts it once the IP is known
+	svc = getTestService(cns.KubernetesCRD)
+	createAndValidateNCRequest(t, map[string]cns.SecondaryIPConfig{
+		testIPID1: newSecondaryIPConfig(testIP1, -1),
+		testIPID2: newSecondaryIPConfig(testIP2, -1),
+	}, testNCID, "-1")
+	require.NoError(t, svc.SyncLeases(cache, 1))
+	podIPInfo, exists, err := svc.GetExistingIPConfig(testPod1Info)
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, ip, podIPInfo[0].PodIPConfig.IPAddress)
+	require.NoError(t, cache.Update(func(l []lease.Lease) ([]lease.Lease, error) {
+		leases = l
+		return l, nil
+	}))
+	require.Len(t, leases, 1)
+	require.Equal(t, testIP2, leases[0].PodIPInfo[0].PodIPConfig.IPAddress)
+}
+
+func TestSyncLeasesKeepsConflictingLease(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	createAndValidateNCRequest(t, map[string]cns.SecondaryIPConfig{
+		testIPID1: newSecondaryIPConfig(testIP1, -1),
+	}, testNCID, "-1")
+	cache := lease.New(filepath.Join(t.TempDir(), "ipleases.json"))
+	require.NoError(t, svc.SyncLeases(cache, 1))
+	consumed, err := cache.Consume(lease.Consumer{InfraContainerID: testPod1Info.InfraContainerID(), PodInterfaceID: testPod1Info.InterfaceID(), PodName: testPod1Info.Name(), PodNamespace: testPod1Info.Namespace()})
+	require.NoError(t, err)
+	ip := consumed.PodIPInfo[0].PodIPConfig.IPAddress
+
+	// after a restart CNS assigned the IP of the consumed lease to another pod before it synced
+	svc = getTestService(cns.KubernetesCRD)
+	createAndValidateNCRequest(t, map[string]cns.SecondaryIPConfig{
+		testIPID1: newSecondaryIPConfig(testIP1, -1),
+	}, testNCID, "-1")
+	ipConfig, _ := svc.ipConfigByAddressUntransacted(ip)
+	require.NoError(t, svc.assignIPConfig(ipConfig, testPod2Info))
+
+	// the lease isn't adopted, the conflict is counted and the lease is kept for the next sync
+	conflicts := testutil.ToFloat64(ipLeaseReconciledCount.WithLabelValues(leaseConflict))
+	require.NoError(t, svc.SyncLeases(cache, 0))
+	require.Equal(t, conflicts+1, testutil.ToFloat64(ipLeaseReconciledCount.WithLabelValues(leaseConflict)))
+	_, exists, err := svc.GetExistingIPConfig(testPod1Info)
+	require.NoError(t, err)
+	require.False(t, exists)
+	var leases []lease.Lease
+	require.NoError(t, cache.Update(func(l []lease.Lease) ([]lease.Lease, error) {
+		leases = l
+		return l, nil
+	}))
+	require.Len(t, leases, 1)
+	require.Equal(t, ip, leases[0].PodIPInfo[0].PodIPConfig.IPAddress)
+
+	// once the pod which consumed the lease is deleted, the lease is released and the IP is left to the other pod
+	released, err := cache.Release(testPod1Info.InfraContainerID())
+	require.NoError(t, err)
+	require.True(t, released)
+	require.NoError(t, svc.SyncLeases(cache, 0))
+	ipConfig, _ = svc.ipConfigByAddressUntransacted(ip)
+	require.True(t, assignedTo(&ipConfig, testPod2Info))
+	require.NoError(t, cache.Update(func(l []lease.Lease) ([]lease.Lease, error) {
+		leases = l
+		return l, nil
+	}))
+	require.Empty(t, leases)
+}
@@ -103,6 +103,26 @@ var (
 		},
 		[]string{},
 	)
+	gcReleasedPodCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ipconfigs_gc_released_pods_total",
+			Help: "Count of Pods whose leaked IPs were released by CNI GC, by whether the release succeeded",
+		},
+		[]string{"ok"},
+	)
+	ipLeaseCount = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ip_leases_available",
+			Help: "Number of offline IP leases which CNI can consume while CNS is unreachable",
+		},
+	)
+	ipLeaseReconciledCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ip_leases_reconciled_total",
+			Help: "Count of reconciled offline IP leases, by result: adopted by the pod which consumed them, released, or conflict",
+		},
+		[]string{"result"},
+	)
 	pendingReleaseIPCount = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name:        "cx_pending_release_ips_v2",
@@ -126,6 +146,9 @@ func init() {
 		availableIPCount,
 		pendingProgrammingIPCount,
 		pendingReleaseIPCount,
+		gcReleasedPodCount,
+		ipLeaseCount,
+		ipLeaseReconciledCount,
 	)
 }
 
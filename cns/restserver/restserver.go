@@ -20,8 +20,10 @@ import (
 	"github.com/Azure/azure-container-networking/cns/types/bounded"
 	"github.com/Azure/azure-container-networking/cns/wireserver"
 	acn "github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/iptables"
 	nma "github.com/Azure/azure-container-networking/nmagent"
 	"github.com/Azure/azure-container-networking/store"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/pkg/errors"
 )
 
@@ -58,14 +60,7 @@ type imdsClient interface {
 }
 
 type iptablesClient interface {
-	ChainExists(table string, chain string) (bool, error)
-	NewChain(table string, chain string) error
-	Append(table string, chain string, rulespec ...string) error
-	Exists(table string, chain string, rulespec ...string) (bool, error)
-	Insert(table string, chain string, pos int, rulespec ...string) error
-	List(table string, chain string) ([]string, error)
-	ClearChain(table string, chain string) error
-	Delete(table, chain string, rulespec ...string) error
+	NewTransaction(version string) *iptables.Transaction
 }
 type iptablesLegacyClient interface {
 	Delete(table, chain string, rulespec ...string) error
@@ -92,6 +87,9 @@ type HTTPRestService struct {
 	store                    store.KeyValueStore
 	state                    *httpRestServiceState
 	podsPendingIPAssignment  *bounded.TimedSet
+	// ipRequestTraces holds the trace context of the IP requests and releases which the pool monitor has yet to
+	// scale the pool for
+	ipRequestTraces *tracing.Pending
 	sync.RWMutex
 	dncPartitionKey            string
 	EndpointState              map[string]*EndpointInfo // key : container id
@@ -247,6 +245,7 @@ func NewHTTPRestService(config *common.ServiceConfig, wscli interfaceGetter, wsp
 		routingTable:             routingTable,
 		state:                    serviceState,
 		podsPendingIPAssignment:  bounded.NewTimedSet(250), // nolint:gomnd // maxpods
+		ipRequestTraces:          tracing.NewPending(250),  // nolint:gomnd // maxpods
 		EndpointStateStore:       endpointStateStore,
 		EndpointState:            make(map[string]*EndpointInfo),
 		homeAzMonitor:            homeAzMonitor,
@@ -255,6 +254,12 @@ func NewHTTPRestService(config *common.ServiceConfig, wscli interfaceGetter, wsp
 	}, nil
 }
 
+// IPRequestTraces returns the trace context of the IP requests and releases which the pool monitor continues when
+// it scales the pool.
+func (service *HTTPRestService) IPRequestTraces() *tracing.Pending {
+	return service.ipRequestTraces
+}
+
 // Init starts the CNS listener.
 func (service *HTTPRestService) Init(config *common.ServiceConfig) error {
 	err := service.Initialize(config)
@@ -296,6 +301,7 @@ func (service *HTTPRestService) Init(config *common.ServiceConfig) error {
 	listener.AddHandler(cns.RequestIPConfigs, NewHandlerFuncWithHistogram(service.RequestIPConfigsHandler, HTTPRequestLatency))
 	listener.AddHandler(cns.ReleaseIPConfig, NewHandlerFuncWithHistogram(service.ReleaseIPConfigHandler, HTTPRequestLatency))
 	listener.AddHandler(cns.ReleaseIPConfigs, NewHandlerFuncWithHistogram(service.ReleaseIPConfigsHandler, HTTPRequestLatency))
+	listener.AddHandler(cns.GCIPConfigs, NewHandlerFuncWithHistogram(service.GCIPConfigsHandler, HTTPRequestLatency))
 	listener.AddHandler(cns.NmAgentSupportedApisPath, service.nmAgentSupportedApisHandler)
 	listener.AddHandler(cns.PathDebugIPAddresses, service.HandleDebugIPAddresses)
 	listener.AddHandler(cns.PathDebugPodContext, service.HandleDebugPodContext)
@@ -364,6 +370,13 @@ func (service *HTTPRestService) RegisterPProfEndpoints() {
 	}
 }
 
+// RegisterLogLevelsEndpoint registers the handler which changes the log levels of components at runtime.
+func (service *HTTPRestService) RegisterLogLevelsEndpoint(h http.Handler) {
+	if service.Listener != nil {
+		service.Listener.GetMux().Handle(cns.PathDebugLogLevels, h)
+	}
+}
+
 // Start starts the CNS listener.
 func (service *HTTPRestService) Start(config *common.ServiceConfig) error {
 	// Start the listener.
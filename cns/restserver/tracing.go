@@ -0,0 +1,35 @@
+package restserver
+
+import (
+	"context"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Spans of the IPConfigs handlers.
+const (
+	requestIPConfigsSpan    = "cns.requestIPConfigs"
+	releaseIPConfigsSpan    = "cns.releaseIPConfigs"
+	ipConfigsMiddlewareSpan = "cns.ipConfigsMiddleware"
+)
+
+// traceIPConfigsHandler runs the handler in a child span of the request. A nil handler stays nil, so that the
+// middleware can tell whether it was given one.
+func traceIPConfigsHandler(name string, handler cns.IPConfigsHandlerFunc) cns.IPConfigsHandlerFunc {
+	if handler == nil {
+		return nil
+	}
+	return func(ctx context.Context, req cns.IPConfigsRequest) (*cns.IPConfigsResponse, error) {
+		ctx, span := tracing.Start(ctx, name,
+			attribute.String("cns.pod_interface_id", req.PodInterfaceID),
+			attribute.String("cns.infra_container_id", req.InfraContainerID))
+		resp, err := handler(ctx, req)
+		if resp != nil {
+			span.SetAttributes(attribute.String("cns.return_code", resp.Response.ReturnCode.String()))
+		}
+		tracing.End(span, err)
+		return resp, err
+	}
+}
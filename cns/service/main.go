@@ -19,6 +19,7 @@ import (
 	"time"
 
 	"github.com/Azure/azure-container-networking/aitelemetry"
+	"github.com/Azure/azure-container-networking/aitelemetry/spool"
 	"github.com/Azure/azure-container-networking/cns"
 	cnsclient "github.com/Azure/azure-container-networking/cns/client"
 	cnscli "github.com/Azure/azure-container-networking/cns/cmd/cli"
@@ -39,6 +40,7 @@ import (
 	mtpncctrl "github.com/Azure/azure-container-networking/cns/kubecontroller/multitenantpodnetworkconfig"
 	nncctrl "github.com/Azure/azure-container-networking/cns/kubecontroller/nodenetworkconfig"
 	podctrl "github.com/Azure/azure-container-networking/cns/kubecontroller/pod"
+	"github.com/Azure/azure-container-networking/cns/lease"
 	"github.com/Azure/azure-container-networking/cns/logger"
 	loggerv2 "github.com/Azure/azure-container-networking/cns/logger/v2"
 	"github.com/Azure/azure-container-networking/cns/metric"
@@ -67,6 +69,7 @@ import (
 	localtls "github.com/Azure/azure-container-networking/server/tls"
 	"github.com/Azure/azure-container-networking/store"
 	"github.com/Azure/azure-container-networking/telemetry"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/avast/retry-go/v4"
 	"github.com/go-logr/zapr"
 	"github.com/google/go-cmp/cmp"
@@ -85,7 +88,6 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
-	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
 	ctrlmgr "sigs.k8s.io/controller-runtime/pkg/manager"
 	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics/server"
@@ -115,6 +117,8 @@ const (
 	defaultDevicePluginRetryInterval = 2 * time.Second
 	defaultNodeInfoCRDPollInterval   = 5 * time.Second
 	defaultDevicePluginMaxRetryCount = 5
+	ipLeaseSyncInterval              = 30 * time.Second
+	initialLeaseSyncAttempts         = 10
 	initialVnetNICCount              = 0
 	initialIBNICCount                = 0
 )
@@ -485,6 +489,11 @@ func startTelemetryService(ctx context.Context) {
 	//nolint:errcheck // best effort to cleanup leaked pipe/socket before start
 	tbtemp.Cleanup(telemetry.FdName)
 
+	// replay the reports which CNI spooled while the telemetry service wasn't running
+	if err := tb.EnableSpool(spool.Config{Dir: telemetry.CNISpoolDir}); err != nil {
+		logger.Errorf("Failed to enable the CNI telemetry spool: %v", err)
+	}
+
 	err = tb.StartServer()
 	logger.Printf("Telemetry service for CNI started")
 	if err != nil {
@@ -579,6 +588,9 @@ func main() {
 			RefreshTimeout:               ts.RefreshIntervalInSecs,
 			DisableMetadataRefreshThread: ts.DisableMetadataRefreshThread,
 			DebugMode:                    ts.DebugMode,
+			SpoolDir:                     ts.SpoolDir,
+			SpoolMaxSizeInBytes:          ts.SpoolMaxSizeInBytes,
+			OTLP:                         ts.OTLP,
 		}
 
 		if aiKey := cnsconfig.TelemetrySettings.AppInsightsInstrumentationKey; aiKey != "" {
@@ -587,6 +599,14 @@ func main() {
 			logger.InitAI(aiConfig, ts.DisableTrace, ts.DisableMetric, ts.DisableEvent)
 		}
 
+		if ts.OTLP != nil {
+			startOTLPMetricsBridge(rootCtx, ts.OTLP)
+		}
+
+		if ts.Tracing != nil {
+			startTracing(rootCtx, ts.Tracing)
+		}
+
 		if cnsconfig.TelemetrySettings.ConfigSnapshotIntervalInMins > 0 {
 			go metric.SendCNSConfigSnapshot(rootCtx, cnsconfig)
 		}
@@ -637,6 +657,9 @@ func main() {
 	if cnsconfig.Logger.AppInsights != nil {
 		cnsconfig.Logger.AppInsights.Fields = append(cnsconfig.Logger.AppInsights.Fields, aifields...)
 	}
+	if cnsconfig.Logger.OTLP != nil {
+		cnsconfig.Logger.OTLP.Fields = append(cnsconfig.Logger.OTLP.Fields, aifields...)
+	}
 
 	// build the zap logger
 	z, c, err := loggerv2.New(&cnsconfig.Logger)
@@ -654,38 +677,39 @@ func main() {
 		logger.Log = loggerv2.AsV1(z, c)
 	}
 
-	// start the healthz/readyz/metrics server
-	readyCh := make(chan any)
-	readyChecker := healthz.CheckHandler{
-		Checker: healthz.Checker(func(*http.Request) error {
-			select {
-			default:
-				return errors.New("not ready")
-			case <-readyCh:
-			}
-			return nil
-		}),
-	}
-
-	healthzHandler, err := healthserver.NewHealthzHandlerWithChecks(&healthserver.Config{PingAPIServer: cnsconfig.EnableAPIServerHealthPing})
-	if err != nil {
-		logger.Errorf("unable to initialize a healthz handler: %v", err)
-		return
-	}
-	go healthserver.Start(z, cnsconfig.MetricsBindAddress, healthzHandler, readyChecker)
-
 	nmaConfig, err := nmagent.NewConfig(cnsconfig.WireserverIP)
 	if err != nil {
 		logger.Errorf("[Azure CNS] Failed to produce NMAgent config from the supplied wireserver ip: %v", err)
 		return
 	}
 
+	nmaConfig.ClientPolicy = newNMAgentClientPolicy(cnsconfig.NMAgentSettings)
 	nmaClient, err := nmagent.NewClient(nmaConfig)
 	if err != nil {
 		logger.Errorf("[Azure CNS] Failed to start nmagent client due to error: %v", err)
 		return
 	}
 
+	// start the healthz/readyz/metrics server
+	readyCh := make(chan any)
+	readyChecker := healthserver.NewReadyzHandler(func(*http.Request) error {
+		select {
+		default:
+			return errors.New("not ready")
+		case <-readyCh:
+		}
+		return nil
+	}, nmaClient)
+
+	healthzHandler, err := healthserver.NewHealthzHandlerWithChecks(&healthserver.Config{
+		PingAPIServer: cnsconfig.EnableAPIServerHealthPing,
+	})
+	if err != nil {
+		logger.Errorf("unable to initialize a healthz handler: %v", err)
+		return
+	}
+	go healthserver.Start(z, cnsconfig.MetricsBindAddress, healthzHandler, readyChecker)
+
 	// copy ChannelMode from cnsconfig to HTTPRemoteRestService config
 	config.ChannelMode = cnsconfig.ChannelMode
 	if cnsconfig.ChannelMode == cns.Managed {
@@ -760,16 +784,16 @@ func main() {
 
 	wsProxy := wireserver.Proxy{
 		Host:       cnsconfig.WireserverIP,
-		HTTPClient: &http.Client{},
+		HTTPClient: &http.Client{Transport: tracing.NewTransport(http.DefaultTransport)},
 	}
 
 	wsclient := &wireserver.Client{
 		HostPort:   cnsconfig.WireserverIP,
-		HTTPClient: &http.Client{},
+		HTTPClient: &http.Client{Transport: tracing.NewTransport(http.DefaultTransport)},
 		Logger:     logger.Log,
 	}
 
-	imdsClient := imds.NewClient()
+	imdsClient := newIMDSClient(cnsconfig)
 	httpRemoteRestService, err := restserver.NewHTTPRestService(&config, wsclient, &wsProxy, &restserver.IPtablesProvider{}, nmaClient,
 		endpointStateStore, conflistGenerator, homeAzMonitor, imdsClient)
 	if err != nil {
@@ -786,8 +810,13 @@ func main() {
 	httpRemoteRestService.SetOption(acn.OptHttpConnectionTimeout, httpConnectionTimeout)
 	httpRemoteRestService.SetOption(acn.OptHttpResponseHeaderTimeout, httpResponseHeaderTimeout)
 	httpRemoteRestService.SetOption(acn.OptProgramSNATIPTables, cnsconfig.ProgramSNATIPTables)
+	httpRemoteRestService.SetOption(acn.OptHostRulesBackend, cnsconfig.HostRulesBackend)
 	httpRemoteRestService.SetOption(acn.OptManageEndpointState, cnsconfig.ManageEndpointState)
 
+	if err := httpRemoteRestService.MigrateHostRules(); err != nil {
+		logger.Errorf("Failed to migrate host rules to nftables, err:%v.\n", err)
+	}
+
 	// Create default ext network if commandline option is set
 	if len(strings.TrimSpace(createDefaultExtNetworkType)) > 0 {
 		if err := hnsclient.CreateDefaultExtNetwork(createDefaultExtNetworkType); err == nil {
@@ -1010,6 +1039,7 @@ func main() {
 		if cnsconfig.EnablePprof {
 			httpRemoteRestService.RegisterPProfEndpoints()
 		}
+		httpRemoteRestService.RegisterLogLevelsEndpoint(cnsconfig.Logger.Levels().Handler(cnsconfig.Logger.LevelsTokenFile))
 
 		err = httpRemoteRestService.Start(&config)
 		if err != nil {
@@ -1423,7 +1453,7 @@ func InitializeCRDState(ctx context.Context, z *zap.Logger, httpRestService cns.
 	if _, ok := node.Labels[configuration.LabelNodeSwiftV2]; ok {
 		cnsconfig.EnableSwiftV2 = true
 		cnsconfig.WatchPods = true
-		if nodeInfoErr := createOrUpdateNodeInfoCRD(ctx, kubeConfig, node); nodeInfoErr != nil {
+		if nodeInfoErr := createOrUpdateNodeInfoCRD(ctx, kubeConfig, node, newIMDSClient(cnsconfig)); nodeInfoErr != nil {
 			return errors.Wrap(nodeInfoErr, "error creating or updating nodeinfo crd")
 		}
 	}
@@ -1473,6 +1503,25 @@ func InitializeCRDState(ctx context.Context, z *zap.Logger, httpRestService cns.
 	}, retry.Context(ctx), retry.Delay(initCNSInitalDelay), retry.MaxDelay(time.Minute), retry.UntilSucceeded())
 	logger.Printf("reconciled initial CNS state after %d attempts", attempt)
 	hasNNCInitialized.Set(1)
+
+	// CNS doesn't hold the IPs of the offline leases until it synced them, so sync before serving IP requests.
+	// Leases which still can't be synced are removed, since CNS could assign their IPs to other pods while CNI consumes them.
+	leases := lease.New(lease.DefaultPath)
+	attempt = 0
+	err = retry.Do(func() error {
+		attempt++
+		syncErr := httpRestServiceImplementation.SyncLeases(leases, cnsconfig.IPLeaseCount)
+		if syncErr != nil {
+			logger.Errorf("failed to sync IP leases, attempt: %d err: %v", attempt, syncErr)
+		}
+		return syncErr
+	}, retry.Context(ctx), retry.Attempts(initialLeaseSyncAttempts), retry.Delay(time.Second), retry.MaxDelay(initCNSInitalDelay), retry.LastErrorOnly(true))
+	if err != nil {
+		logger.Errorf("Removing IP leases which failed to sync: %v", err)
+		if err = leases.Remove(); err != nil {
+			return errors.Wrap(err, "failed to remove IP leases which failed to sync")
+		}
+	}
 	scheme := kuberuntime.NewScheme()
 	if err := corev1.AddToScheme(scheme); err != nil { //nolint:govet // intentional shadow
 		return errors.Wrap(err, "failed to add corev1 to scheme")
@@ -1549,10 +1598,12 @@ func InitializeCRDState(ctx context.Context, z *zap.Logger, httpRestService cns.
 		pmv2 := ipampoolv2.NewMonitor(z, httpRestServiceImplementation, cachedscopedcli, ipDemandCh, nncCh, cssCh)
 		obs := metrics.NewLegacyMetricsObserver(httpRestService.GetPodIPConfigState, cachedscopedcli.Get, cssSrc)
 		pmv2.WithLegacyMetricsObserver(obs)
+		pmv2.WithTraces(httpRestServiceImplementation.IPRequestTraces())
 		poolMonitor = pmv2.AsV1(nncCh)
 	} else {
 		poolOpts := ipampool.Options{
 			RefreshDelay: poolIPAMRefreshRateInMilliseconds * time.Millisecond,
+			Traces:       httpRestServiceImplementation.IPRequestTraces(),
 		}
 		poolMonitor = ipampool.NewMonitor(httpRestServiceImplementation, cachedscopedcli, cssCh, &poolOpts)
 	}
@@ -1592,6 +1643,15 @@ func InitializeCRDState(ctx context.Context, z *zap.Logger, httpRestService cns.
 		}
 	}
 
+	if cnsconfig.EnableProgrammedReadinessGate {
+		// the programming state changes at most once per NC version sync
+		baseBackoff := time.Duration(cnsconfig.SyncHostNCVersionIntervalMs) * time.Millisecond
+		readinessGate := podctrl.NewReadinessGate(z, httpRestServiceImplementation, cnsconfig.EnableSwiftV2, baseBackoff)
+		if err := readinessGate.SetupWithManager(manager); err != nil {
+			return errors.Wrapf(err, "failed to setup pod readiness gate with manager")
+		}
+	}
+
 	if cnsconfig.EnableSwiftV2 {
 		if err := mtpncctrl.SetupWithManager(manager); err != nil {
 			return errors.Wrapf(err, "failed to setup mtpnc reconciler with manager")
@@ -1664,6 +1724,26 @@ func InitializeCRDState(ctx context.Context, z *zap.Logger, httpRestService cns.
 		}
 	}()
 	logger.Printf("Initialized SyncHostNCVersion loop.")
+
+	if cnsconfig.IPLeaseCount > 0 {
+		go func() {
+			logger.Printf("Starting SyncLeases loop.")
+			ticker := time.NewTicker(ipLeaseSyncInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if err := httpRestServiceImplementation.SyncLeases(leases, cnsconfig.IPLeaseCount); err != nil {
+						logger.Errorf("Failed to sync IP leases: %v", err)
+					}
+				case <-ctx.Done():
+					logger.Printf("Stopping SyncLeases loop.")
+					return
+				}
+			}
+		}()
+		logger.Printf("Initialized SyncLeases loop.")
+	}
 	return nil
 }
 
@@ -1696,10 +1776,36 @@ func getPodInfoByIPProvider(
 	return podInfoByIPProvider, nil
 }
 
+// newIMDSClient returns an IMDS client for the configured endpoint, or the default endpoint if it isn't configured.
+func newIMDSClient(cnsconfig *configuration.CNSConfig) *imds.Client {
+	if cnsconfig.IMDSEndpoint != "" {
+		return imds.NewClient(imds.Endpoint(cnsconfig.IMDSEndpoint))
+	}
+	return imds.NewClient()
+}
+
+// newNMAgentClientPolicy returns the policy of the NMAgent client from the configured settings, exporting breaker state and hedges as metrics.
+// Unset settings select the defaults of the client, and negative ones disable the breakers or the retry budget.
+func newNMAgentClientPolicy(settings configuration.NMAgentSettings) nmagent.ClientPolicy {
+	policy := nmagent.DefaultClientPolicy()
+	if settings.BreakerThreshold != 0 {
+		policy.BreakerThreshold = settings.BreakerThreshold
+	}
+	if settings.BreakerCooldownSecs > 0 {
+		policy.BreakerCooldown = time.Duration(settings.BreakerCooldownSecs) * time.Second
+	}
+	if settings.RetryBudget != 0 {
+		policy.RetryBudget = settings.RetryBudget
+	}
+	policy.HedgeDelay = time.Duration(settings.HedgeDelayMs) * time.Millisecond
+	policy.OnBreakerStateChange = healthserver.ObserveNMAgentBreaker
+	policy.OnHedge = healthserver.ObserveNMAgentHedge
+	return policy
+}
+
 // createOrUpdateNodeInfoCRD polls imds to learn the VM Unique ID and then creates or updates the NodeInfo CRD
 // with that vm unique ID
-func createOrUpdateNodeInfoCRD(ctx context.Context, restConfig *rest.Config, node *corev1.Node) error {
-	imdsCli := imds.NewClient()
+func createOrUpdateNodeInfoCRD(ctx context.Context, restConfig *rest.Config, node *corev1.Node, imdsCli *imds.Client) error {
 	vmUniqueID, err := imdsCli.GetVMUniqueID(ctx)
 	if err != nil {
 		return errors.Wrap(err, "error getting vm unique ID from imds")
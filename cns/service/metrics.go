@@ -1,6 +1,11 @@
 package main
 
 import (
+	"context"
+
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/otlp"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/prometheus/client_golang/prometheus"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
 )
@@ -51,3 +56,33 @@ func init() {
 		hasNNCInitialized,
 	)
 }
+
+// startOTLPMetricsBridge exports the CNS metrics registry to an OpenTelemetry collector until the context is done.
+func startOTLPMetricsBridge(ctx context.Context, cfg *otlp.Config) {
+	exporter, err := otlp.NewExporter(cfg, name)
+	if err != nil {
+		logger.Errorf("[Azure CNS] Failed to create the OTLP metrics exporter: %v", err)
+		return
+	}
+	go func() {
+		defer exporter.Close()
+		otlp.NewMetricsBridge(metrics.Registry, exporter).Run(ctx, func(err error) {
+			logger.Errorf("[Azure CNS] Failed to export metrics over OTLP: %v", err)
+		})
+	}()
+}
+
+// startTracing exports the spans of CNS to an OpenTelemetry collector until the context is done.
+func startTracing(ctx context.Context, cfg *tracing.Config) {
+	shutdown, err := tracing.InitFromConfig(cfg, name)
+	if err != nil {
+		logger.Errorf("[Azure CNS] Failed to initialize tracing: %v", err)
+		return
+	}
+	go func() {
+		<-ctx.Done()
+		if err := shutdown(context.Background()); err != nil {
+			logger.Errorf("[Azure CNS] Failed to export spans over OTLP: %v", err)
+		}
+	}()
+}
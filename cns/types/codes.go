@@ -1,5 +1,7 @@
 package types
 
+import "github.com/Azure/azure-container-networking/errcode"
+
 type ResponseCode int
 
 // ResponseCode definitions
@@ -132,3 +134,32 @@ func (c ResponseCode) String() string {
 		return "UnknownError"
 	}
 }
+
+// ErrorCode classifies the ResponseCode in the shared error taxonomy, for responses which don't carry an Error.
+//
+//nolint:gocyclo
+func (c ResponseCode) ErrorCode() errcode.Code {
+	switch c {
+	case Success:
+		return ""
+	case InvalidParameter, InvalidRequest, MalformedSubnet, UnspecifiedNetworkName, NetworkContainerNotSpecified,
+		DockerContainerNotSpecified, EmptyOrchestratorContext, InvalidPrimaryIPConfig, InvalidSecondaryIPConfig,
+		PrimaryCANotSame, StatusUnauthorized:
+		return errcode.InvalidRequest
+	case UnsupportedNetworkType, UnsupportedEnvironment, UnsupportedOrchestratorType, UnsupportedVerb,
+		UnsupportedNetworkContainerType, UnsupportedOrchestratorContext, UnsupportedNCVersion, UnsupportedAPI:
+		return errcode.Unsupported
+	case NotFound, UnknownContainerID, ReservationNotFound:
+		return errcode.NotFound
+	case InconsistentIPConfigState, NilEndpointStateStore:
+		return errcode.StateStoreCorrupt
+	case NetworkContainerVfpProgramPending:
+		return errcode.NCNotProgrammed
+	case UnreachableHost, CallToHostFailed, NmAgentInternalServerError, NmAgentSupportedApisError, NmAgentNCVersionListError:
+		return errcode.FabricUnreachable
+	case ConnectionError:
+		return errcode.CNSUnreachable
+	default:
+		return errcode.Unknown
+	}
+}
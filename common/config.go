@@ -89,6 +89,9 @@ const (
 	// Enable CNS to program SNAT iptables rules
 	OptProgramSNATIPTables = "program-snat-iptables"
 
+	// Backend used by CNS to program SNAT rules
+	OptHostRulesBackend = "host-rules-backend"
+
 	// Enable Telemetry service
 	OptTelemetryService      = "telemetry-service"
 	OptTelemetryServiceAlias = "ts"
@@ -12,6 +12,7 @@ import (
 	"os"
 
 	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/pkg/errors"
 )
 
@@ -128,7 +129,8 @@ func (l *Listener) AddEndpoint(endpoint string) {
 
 // AddHandler registers a protocol handler.
 func (l *Listener) AddHandler(path string, handler http.HandlerFunc) {
-	l.mux.HandleFunc(path, handler)
+	// continue the trace of the caller, if any
+	l.mux.Handle(path, tracing.Handler(path, handler))
 }
 
 // todo: Decode and Encode below should not be methods, just functions. They make no use of Listener fields.
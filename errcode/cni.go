@@ -0,0 +1,45 @@
+package errcode
+
+import (
+	"encoding/json"
+
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+)
+
+// cniCodes are the CNI error codes of permanent errors. They are in the range of plugin specific codes and, like
+// Codes, are never reused. Transient errors all have the CNI code to try again later.
+// https://www.cni.dev/docs/spec/#error
+var cniCodes = map[Code]uint{
+	InvalidRequest:    301,
+	NotFound:          302,
+	Unsupported:       303,
+	StateStoreCorrupt: 304,
+}
+
+// CNICode is the CNI error code of the Code.
+func (c Code) CNICode() uint {
+	if c.Transient() {
+		return cniTypes.ErrTryAgainLater
+	}
+	if code, ok := cniCodes[c]; ok {
+		return code
+	}
+	return cniTypes.ErrInternal
+}
+
+// CNIError translates err into a CNI error with the CNICode of its Code. The details are the Error as JSON, so that
+// the runtime and our telemetry can tell why it failed and whether it will be retried.
+func CNIError(err error) *cniTypes.Error {
+	e := From(err)
+	details, _ := json.Marshal(e)
+	return cniTypes.NewError(e.Code.CNICode(), err.Error(), string(details))
+}
+
+// FromCNI returns the Error in the details of a CNI error, or nil if it wasn't translated by CNIError.
+func FromCNI(cniErr *cniTypes.Error) *Error {
+	var e Error
+	if cniErr == nil || json.Unmarshal([]byte(cniErr.Details), &e) != nil || e.Code == "" {
+		return nil
+	}
+	return &e
+}
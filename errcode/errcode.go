@@ -0,0 +1,155 @@
+// Package errcode is the taxonomy of errors which cross component boundaries: CNS returns them in its responses, and
+// CNI and azure-ipam translate them into CNI errors. Each Code is stable and carries a Retry hint, so that runtimes,
+// kubelet events and alerts can tell transient failures, which resolve on their own, from permanent ones.
+package errcode
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Code identifies a class of errors. Codes are part of the API of CNS and CNI: they are never renamed or reused.
+type Code string
+
+const (
+	// Unknown is an error which isn't classified. It's retried, as most unclassified errors are transient.
+	Unknown Code = "Unknown"
+	// IPPoolExhausted means there is no free IP for the pod until the pool monitor scales the pool up.
+	IPPoolExhausted Code = "IPPoolExhausted"
+	// NCNotProgrammed means the network container of the pod isn't programmed on the node yet.
+	NCNotProgrammed Code = "NCNotProgrammed"
+	// FabricUnreachable means NMAgent, wireserver or IMDS can't be reached or failed.
+	FabricUnreachable Code = "FabricUnreachable"
+	// CNSUnreachable means CNS can't be reached, e.g. while it restarts.
+	CNSUnreachable Code = "CNSUnreachable"
+	// InvalidRequest means the request is malformed or inconsistent with the configuration.
+	InvalidRequest Code = "InvalidRequest"
+	// NotFound means the request refers to a pod, IP or network container which doesn't exist.
+	NotFound Code = "NotFound"
+	// Unsupported means the request isn't supported in this environment or by this version.
+	Unsupported Code = "Unsupported"
+	// StateStoreCorrupt means the state of CNS is inconsistent and requires intervention.
+	StateStoreCorrupt Code = "StateStoreCorrupt"
+)
+
+// Retry hints how a failed request should be retried.
+type Retry string
+
+const (
+	// RetryBackoff means the error is transient: the request should be retried with backoff.
+	RetryBackoff Retry = "Backoff"
+	// RetryNever means the error is permanent: retrying the same request fails the same way.
+	RetryNever Retry = "Never"
+)
+
+var retries = map[Code]Retry{
+	Unknown:           RetryBackoff,
+	IPPoolExhausted:   RetryBackoff,
+	NCNotProgrammed:   RetryBackoff,
+	FabricUnreachable: RetryBackoff,
+	CNSUnreachable:    RetryBackoff,
+	InvalidRequest:    RetryNever,
+	NotFound:          RetryNever,
+	Unsupported:       RetryNever,
+	StateStoreCorrupt: RetryNever,
+}
+
+// Retry is the retry hint of the Code. Codes which are unknown to this version are retried with backoff.
+func (c Code) Retry() Retry {
+	if r, ok := retries[c]; ok {
+		return r
+	}
+	return RetryBackoff
+}
+
+// Transient reports whether errors with the Code resolve on their own.
+func (c Code) Transient() bool {
+	return c.Retry() != RetryNever
+}
+
+// Error is an error with a Code. It's serialized as JSON in CNS responses and in the details of CNI errors.
+type Error struct {
+	Code    Code              `json:"code"`
+	Message string            `json:"message"`
+	Retry   Retry             `json:"retry"`
+	Details map[string]string `json:"details,omitempty"`
+	cause   error
+}
+
+// New returns an Error with the Code and its retry hint.
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message, Retry: code.Retry()}
+}
+
+// Wrap classifies err with the Code. The Error unwraps to err, so that errors.Is and errors.As still match it.
+func Wrap(err error, code Code) *Error {
+	if err == nil {
+		return nil
+	}
+	e := New(code, err.Error())
+	e.cause = err
+	return e
+}
+
+// WithDetail adds machine-readable context to the Error, e.g. the NC or the pod it's about.
+func (e *Error) WithDetail(key, value string) *Error {
+	if e.Details == nil {
+		e.Details = map[string]string{}
+	}
+	e.Details[key] = value
+	return e
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Coder is implemented by errors which are classified without being an Error, e.g. the errors of a client.
+type Coder interface {
+	ErrorCode() Code
+}
+
+// CodeOf returns the Code of the first Error in the chain of err, else of the first Coder, else Unknown.
+func CodeOf(err error) Code {
+	if err == nil {
+		return ""
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	var c Coder
+	if errors.As(err, &c) && c.ErrorCode() != "" {
+		return c.ErrorCode()
+	}
+	return Unknown
+}
+
+// From returns the first Error in the chain of err, or classifies err with its CodeOf.
+func From(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return Wrap(err, CodeOf(err))
+}
+
+// Classified reports whether the chain of err has an Error or a Coder, i.e. whether its Code is known rather than
+// Unknown by default.
+func Classified(err error) bool {
+	var e *Error
+	var c Coder
+	return errors.As(err, &e) || (errors.As(err, &c) && c.ErrorCode() != "")
+}
+
+// Is reports whether err is classified with the Code.
+func Is(err error, code Code) bool {
+	return CodeOf(err) == code
+}
@@ -0,0 +1,96 @@
+package errcode
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+var errPool = errors.New("not enough IPs available")
+
+type codedErr struct{ code Code }
+
+func (e *codedErr) Error() string   { return "coded" }
+func (e *codedErr) ErrorCode() Code { return e.code }
+
+func TestCodeOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Code
+	}{
+		{name: "nil", err: nil, want: ""},
+		{name: "unclassified", err: errPool, want: Unknown},
+		{name: "error", err: Wrap(errPool, IPPoolExhausted), want: IPPoolExhausted},
+		{name: "wrapped error", err: errors.Wrap(Wrap(errPool, IPPoolExhausted), "request failed"), want: IPPoolExhausted},
+		{name: "coder", err: fmt.Errorf("request failed: %w", &codedErr{code: CNSUnreachable}), want: CNSUnreachable},
+		{name: "error before coder", err: fmt.Errorf("%w", &wrapper{coder: &codedErr{code: Unknown}, err: New(NotFound, "no pod")}), want: NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, CodeOf(tt.err))
+		})
+	}
+}
+
+// wrapper is a Coder which wraps an Error.
+type wrapper struct {
+	coder *codedErr
+	err   error
+}
+
+func (w *wrapper) Error() string   { return w.err.Error() }
+func (w *wrapper) ErrorCode() Code { return w.coder.code }
+func (w *wrapper) Unwrap() error   { return w.err }
+
+func TestWrapKeepsCause(t *testing.T) {
+	err := Wrap(errPool, IPPoolExhausted)
+	require.ErrorIs(t, err, errPool)
+	require.Equal(t, RetryBackoff, err.Retry)
+	require.Nil(t, Wrap(nil, IPPoolExhausted))
+	require.True(t, Classified(err))
+	require.False(t, Classified(errPool))
+}
+
+func TestRetry(t *testing.T) {
+	for _, code := range []Code{Unknown, IPPoolExhausted, NCNotProgrammed, FabricUnreachable, CNSUnreachable, "FromANewerVersion"} {
+		require.True(t, code.Transient(), code)
+		require.Equal(t, cniTypes.ErrTryAgainLater, code.CNICode(), code)
+	}
+	for _, code := range []Code{InvalidRequest, NotFound, Unsupported, StateStoreCorrupt} {
+		require.False(t, code.Transient(), code)
+		require.Equal(t, RetryNever, code.Retry(), code)
+		require.GreaterOrEqual(t, code.CNICode(), uint(100), code)
+	}
+}
+
+func TestErrorRoundTrip(t *testing.T) {
+	want := New(IPPoolExhausted, "not enough IPs available").WithDetail("nc", "nc-1")
+	b, err := json.Marshal(want)
+	require.NoError(t, err)
+	var got Error
+	require.NoError(t, json.Unmarshal(b, &got))
+	require.Equal(t, *want, got)
+	require.JSONEq(t, `{"code":"IPPoolExhausted","message":"not enough IPs available","retry":"Backoff","details":{"nc":"nc-1"}}`, string(b))
+}
+
+func TestCNIError(t *testing.T) {
+	cniErr := CNIError(errors.Wrap(New(StateStoreCorrupt, "pod to IP ID exists"), "failed to request IP"))
+	require.Equal(t, uint(304), cniErr.Code)
+	require.Equal(t, "failed to request IP: StateStoreCorrupt: pod to IP ID exists", cniErr.Msg)
+	got := FromCNI(cniErr)
+	require.NotNil(t, got)
+	require.Equal(t, StateStoreCorrupt, got.Code)
+	require.Equal(t, RetryNever, got.Retry)
+
+	cniErr = CNIError(errPool)
+	require.Equal(t, cniTypes.ErrTryAgainLater, cniErr.Code)
+	require.Equal(t, Unknown, FromCNI(cniErr).Code)
+
+	require.Nil(t, FromCNI(cniTypes.NewError(cniTypes.ErrInternal, "failed", "not json")))
+	require.Nil(t, FromCNI(nil))
+}
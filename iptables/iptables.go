@@ -65,6 +65,8 @@ const (
 	iptables    = "iptables"
 	ip6tables   = "ip6tables"
 	lockTimeout = 60
+	// xtablesLock is the file lock iptables takes with -w
+	xtablesLock = "/run/xtables.lock"
 )
 
 const (
@@ -93,16 +95,32 @@ type IPTableEntry struct {
 
 type Client struct {
 	pl platform.ExecClient
+	// lockPath is the xtables lock which transactions hold from their snapshot to their restore. Without it, each
+	// command of a transaction waits for the lock on its own.
+	lockPath string
 }
 
 func NewClient() *Client {
 	return &Client{
-		pl: platform.NewExecClient(logger),
+		pl:       platform.NewExecClient(logger),
+		lockPath: xtablesLock,
+	}
+}
+
+// NewClientWithExecClient returns a Client which runs the iptables commands with the ExecClient, e.g. a mock.
+func NewClientWithExecClient(pl platform.ExecClient) *Client {
+	return &Client{
+		pl: pl,
 	}
 }
 
 // Run iptables command
 func (c *Client) RunCmd(version, params string) error {
+	return c.runCmd(version, params, !DisableIPTableLock)
+}
+
+// runCmd runs the iptables command, waiting for the xtables lock if wait is set.
+func (c *Client) runCmd(version, params string, wait bool) error {
 	var cmd string
 
 	iptCmd := iptables
@@ -110,7 +128,7 @@ func (c *Client) RunCmd(version, params string) error {
 		iptCmd = ip6tables
 	}
 
-	if DisableIPTableLock {
+	if !wait {
 		cmd = fmt.Sprintf("%s %s", iptCmd, params)
 	} else {
 		cmd = fmt.Sprintf("%s -w %d %s", iptCmd, lockTimeout, params)
@@ -156,8 +174,12 @@ func (c *Client) CreateChain(version, tableName, chainName string) error {
 
 // check if iptable rule alreay exists
 func (c *Client) RuleExists(version, tableName, chainName, match, target string) bool {
+	return c.ruleExists(version, tableName, chainName, match, target, !DisableIPTableLock)
+}
+
+func (c *Client) ruleExists(version, tableName, chainName, match, target string, wait bool) bool {
 	params := fmt.Sprintf("-t %s -C %s %s -j %s", tableName, chainName, match, target)
-	if err := c.RunCmd(version, params); err != nil {
+	if err := c.runCmd(version, params, wait); err != nil {
 		return false
 	}
 	return true
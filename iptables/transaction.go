@@ -0,0 +1,672 @@
+package iptables
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	iptablesSave     = "iptables-save"
+	ip6tablesSave    = "ip6tables-save"
+	iptablesRestore  = "iptables-restore"
+	ip6tablesRestore = "ip6tables-restore"
+	// restoreDelimiter terminates the heredoc used to feed iptables-restore through the shell
+	restoreDelimiter = "AZURE_IPTABLES_RESTORE_EOF"
+)
+
+var (
+	errTransactionCommitted = errors.New("iptables transaction already committed")
+	errIptablesSave         = errors.New("failed to read iptables snapshot")
+	errIptablesRestore      = errors.New("failed to apply iptables transaction")
+	errXtablesLock          = errors.New("failed to lock iptables for transaction")
+)
+
+type txOpKind int
+
+const (
+	txCreateChain txOpKind = iota
+	txInsertRule
+	txAppendRule
+	txDeleteRule
+	txDeleteChain
+	txInsertRuleBefore
+	txSyncChain
+)
+
+type txOp struct {
+	kind      txOpKind
+	tableName string
+	chainName string
+	match     string
+	target    string
+	rule      string
+	// before is the rule spec a txInsertRuleBefore rule must precede
+	before string
+	// rules are the rule specs of a txSyncChain chain
+	rules []string
+}
+
+// Rule is the match and target of a rule, as passed to InsertIptableRule.
+type Rule struct {
+	Match  string
+	Target string
+}
+
+// ChainRules are rules which a Transaction ensures at the beginning of a chain, which is created and
+// jumped to from the end of the parent chain if needed. They let the rules be computed before the
+// Transaction which applies them, e.g. in the endpoint options.
+type ChainRules struct {
+	Table  string
+	Parent string
+	Chain  string
+	Rules  []Rule
+}
+
+// Transaction accumulates chain and rule operations for a single ip version and applies
+// them with one iptables-restore --noflush call, in the order they were added. Operations
+// are diffed against a single iptables-save snapshot taken at commit time, so chains and
+// rules which already exist are skipped and rules which don't exist are not deleted. Rules
+// are compared to the snapshot in a canonical form; a rule which isn't found in a chain of
+// the snapshot is checked with iptables -C before it's added or skipped, so a spelling which
+// the canonical form doesn't cover costs an extra command instead of a duplicate rule.
+// The xtables lock is held from the snapshot to the restore, so that the chains and rules which other processes
+// change in between are neither flushed by the declaration of a chain nor fail the deletion of a rule.
+// A Transaction is not safe for concurrent use.
+type Transaction struct {
+	client    *Client
+	version   string
+	ops       []txOp
+	committed bool
+	// wait is set when the commands of the transaction wait for the xtables lock on their own
+	wait bool
+}
+
+// NewTransaction returns an empty transaction for the given ip version (V4 or V6)
+func (c *Client) NewTransaction(version string) *Transaction {
+	return &Transaction{
+		client:  c,
+		version: version,
+	}
+}
+
+// CreateChain creates the chain in the table if it does not already exist
+func (t *Transaction) CreateChain(tableName, chainName string) *Transaction {
+	t.ops = append(t.ops, txOp{kind: txCreateChain, tableName: tableName, chainName: chainName})
+	return t
+}
+
+// InsertIptableRule inserts the rule at the beginning of the chain if it does not already exist
+func (t *Transaction) InsertIptableRule(tableName, chainName, match, target string) *Transaction {
+	t.ops = append(t.ops, txOp{kind: txInsertRule, tableName: tableName, chainName: chainName, match: match, target: target, rule: ruleSpec(match, target)})
+	return t
+}
+
+// AppendIptableRule appends the rule at the end of the chain if it does not already exist
+func (t *Transaction) AppendIptableRule(tableName, chainName, match, target string) *Transaction {
+	t.ops = append(t.ops, txOp{kind: txAppendRule, tableName: tableName, chainName: chainName, match: match, target: target, rule: ruleSpec(match, target)})
+	return t
+}
+
+// DeleteIptableRule deletes the rule from the chain if it exists
+func (t *Transaction) DeleteIptableRule(tableName, chainName, match, target string) *Transaction {
+	t.ops = append(t.ops, txOp{kind: txDeleteRule, tableName: tableName, chainName: chainName, match: match, target: target, rule: ruleSpec(match, target)})
+	return t
+}
+
+// InsertIptableRuleBefore inserts the rule into the chain ahead of the rule spec before, e.g. "-j SWIFT", moving the
+// rule if it exists after it. If the chain has no rule before, the rule is appended if it does not already exist.
+func (t *Transaction) InsertIptableRuleBefore(tableName, chainName, match, target, before string) *Transaction {
+	t.ops = append(t.ops, txOp{kind: txInsertRuleBefore, tableName: tableName, chainName: chainName, match: match, target: target, rule: ruleSpec(match, target), before: before})
+	return t
+}
+
+// SyncChain creates the chain if it does not exist and replaces its rules with the rules, in order, unless it already
+// has exactly those rules.
+func (t *Transaction) SyncChain(tableName, chainName string, rules []Rule) *Transaction {
+	specs := make([]string, 0, len(rules))
+	for _, r := range rules {
+		specs = append(specs, ruleSpec(r.Match, r.Target))
+	}
+	t.ops = append(t.ops, txOp{kind: txSyncChain, tableName: tableName, chainName: chainName, rules: specs})
+	return t
+}
+
+// EnsureChainRules creates the chain of the rules and the jump to it from the end of the parent chain if they do
+// not exist, and inserts each rule which does not exist at the beginning of the chain.
+func (t *Transaction) EnsureChainRules(c ChainRules) *Transaction {
+	t.CreateChain(c.Table, c.Chain).AppendIptableRule(c.Table, c.Parent, "", c.Chain)
+	for _, r := range c.Rules {
+		t.InsertIptableRule(c.Table, c.Chain, r.Match, r.Target)
+	}
+	return t
+}
+
+// DeleteChain flushes and deletes the chain if it exists. Rules referencing the chain must be
+// deleted earlier in the same transaction.
+func (t *Transaction) DeleteChain(tableName, chainName string) *Transaction {
+	t.ops = append(t.ops, txOp{kind: txDeleteChain, tableName: tableName, chainName: chainName})
+	return t
+}
+
+// Commit snapshots the current ruleset, computes the operations still required and applies
+// them atomically. If the ruleset already satisfies the transaction, iptables-restore is not run.
+func (t *Transaction) Commit() error {
+	if t.committed {
+		return errTransactionCommitted
+	}
+	t.committed = true
+
+	if len(t.ops) == 0 {
+		return nil
+	}
+
+	saveCmd, restoreCmd := iptablesSave, iptablesRestore
+	if t.version == V6 {
+		saveCmd, restoreCmd = ip6tablesSave, ip6tablesRestore
+	}
+
+	t.wait = !DisableIPTableLock
+	if t.wait && t.client.lockPath != "" {
+		lock, err := lockXtables(t.client.lockPath, lockTimeout*time.Second)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errXtablesLock, err)
+		}
+		defer lock.Close()
+		// the commands run under the lock, waiting for it would time out
+		t.wait = false
+	}
+
+	out, err := t.client.pl.ExecuteRawCommand(saveCmd)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errIptablesSave, err)
+	}
+
+	input := t.restoreInput(parseSnapshot(out))
+	if input == "" {
+		logger.Info("iptables transaction is a no-op", zap.String("version", t.version), zap.Int("operations", len(t.ops)))
+		return nil
+	}
+
+	if t.wait {
+		restoreCmd = fmt.Sprintf("%s -w %d", restoreCmd, lockTimeout)
+	}
+	cmd := fmt.Sprintf("%s --noflush <<'%s'\n%s%s", restoreCmd, restoreDelimiter, input, restoreDelimiter)
+	if _, err := t.client.pl.ExecuteRawCommand(cmd); err != nil {
+		return fmt.Errorf("%w: %w", errIptablesRestore, err)
+	}
+
+	return nil
+}
+
+// restoreInput renders the iptables-restore input for the operations which are not already
+// satisfied by the snapshot, in the order they were added, so a chain is declared after it is
+// deleted and a rule which jumps to a chain must be added after the chain is created. The
+// snapshot is updated as operations are applied so that duplicate operations within the
+// transaction are only emitted once.
+func (t *Transaction) restoreInput(snap snapshot) string {
+	var tables []string
+	lines := map[string][]string{}
+
+	for _, op := range t.ops {
+		tbl := snap.table(op.tableName)
+		var line string
+
+		switch op.kind {
+		case txCreateChain:
+			if _, ok := tbl.chains[op.chainName]; ok {
+				continue
+			}
+			tbl.chains[op.chainName] = []string{}
+			line = fmt.Sprintf(":%s - [0:0]", op.chainName)
+		case txInsertRule:
+			key := normalizeRule(op.rule)
+			if tbl.ruleIndex(op.chainName, key) >= 0 || t.ruleExists(tbl, op) {
+				continue
+			}
+			tbl.insertRule(op.chainName, 0, key)
+			line = fmt.Sprintf("-I %s 1 %s", op.chainName, op.rule)
+		case txAppendRule:
+			key := normalizeRule(op.rule)
+			if tbl.ruleIndex(op.chainName, key) >= 0 || t.ruleExists(tbl, op) {
+				continue
+			}
+			tbl.appendRule(op.chainName, key)
+			line = fmt.Sprintf("-A %s %s", op.chainName, op.rule)
+		case txInsertRuleBefore:
+			line = tbl.insertRuleBefore(op, t.ruleExists)
+			if line == "" {
+				continue
+			}
+		case txDeleteRule:
+			key := normalizeRule(op.rule)
+			// the rule may only be in the chain under a spelling the canonical form doesn't cover
+			if !tbl.deleteRule(op.chainName, key) && !t.ruleExists(tbl, op) {
+				continue
+			}
+			tbl.forget(op.chainName, key)
+			line = fmt.Sprintf("-D %s %s", op.chainName, op.rule)
+		case txDeleteChain:
+			if _, ok := tbl.chains[op.chainName]; !ok {
+				continue
+			}
+			delete(tbl.chains, op.chainName)
+			delete(tbl.saved, op.chainName)
+			delete(tbl.unplaced, op.chainName)
+			line = fmt.Sprintf("-F %s\n-X %s", op.chainName, op.chainName)
+		case txSyncChain:
+			line = tbl.syncChain(op)
+			if line == "" {
+				continue
+			}
+		}
+
+		if _, ok := lines[op.tableName]; !ok {
+			tables = append(tables, op.tableName)
+		}
+		lines[op.tableName] = append(lines[op.tableName], line)
+	}
+
+	var sb strings.Builder
+	for _, tableName := range tables {
+		sb.WriteString("*" + tableName + "\n")
+		for _, line := range lines[tableName] {
+			sb.WriteString(line + "\n")
+		}
+		sb.WriteString("COMMIT\n")
+	}
+
+	return sb.String()
+}
+
+// ruleExists asks iptables whether the rule of the operation exists, when the chain existed in the snapshot but
+// the canonical form of the rule wasn't found in it. A rule which exists is recorded in the snapshot as unplaced, since
+// iptables -C doesn't tell where in the chain it is.
+func (t *Transaction) ruleExists(tbl *tableState, op txOp) bool {
+	if _, ok := tbl.saved[op.chainName]; !ok {
+		return false
+	}
+	key := normalizeRule(op.rule)
+	if exists, ok := tbl.unplaced[op.chainName][key]; ok {
+		return exists
+	}
+	exists := t.client.ruleExists(t.version, op.tableName, op.chainName, op.match, op.target, t.wait)
+	if _, ok := tbl.unplaced[op.chainName]; !ok {
+		tbl.unplaced[op.chainName] = map[string]bool{}
+	}
+	tbl.unplaced[op.chainName][key] = exists
+	return exists
+}
+
+func ruleSpec(match, target string) string {
+	return strings.TrimSpace(fmt.Sprintf("%s -j %s", strings.TrimSpace(match), target))
+}
+
+type tableState struct {
+	// chains maps a chain name to its normalized rules, in order
+	chains map[string][]string
+	// saved is the set of chains which existed in the iptables-save output and haven't been flushed since, whose rules
+	// may be checked with iptables -C
+	saved map[string]struct{}
+	// unplaced maps a chain name to the normalized rules which were checked with iptables -C, and whether they are in
+	// the chain at a position which isn't known
+	unplaced map[string]map[string]bool
+}
+
+// forget records that the rule was removed from the chain, so it isn't checked with iptables -C again.
+func (ts *tableState) forget(chainName, rule string) {
+	if _, ok := ts.unplaced[chainName]; !ok {
+		ts.unplaced[chainName] = map[string]bool{}
+	}
+	ts.unplaced[chainName][rule] = false
+}
+
+// ruleIndex returns the index of the first occurrence of the normalized rule in the chain, or -1.
+func (ts *tableState) ruleIndex(chainName, rule string) int {
+	return slices.Index(ts.chains[chainName], rule)
+}
+
+func (ts *tableState) appendRule(chainName, rule string) {
+	ts.chains[chainName] = append(ts.chains[chainName], rule)
+}
+
+func (ts *tableState) insertRule(chainName string, index int, rule string) {
+	ts.chains[chainName] = slices.Insert(ts.chains[chainName], index, rule)
+}
+
+// deleteRule removes the first occurrence of the normalized rule from the chain, like iptables -D, and reports whether
+// there was one.
+func (ts *tableState) deleteRule(chainName, rule string) bool {
+	i := ts.ruleIndex(chainName, rule)
+	if i < 0 {
+		return false
+	}
+	ts.chains[chainName] = slices.Delete(ts.chains[chainName], i, i+1)
+	return true
+}
+
+// insertRuleBefore applies the txInsertRuleBefore operation and returns its restore lines, or "" if the rule is
+// already in place.
+func (ts *tableState) insertRuleBefore(op txOp, exists func(*tableState, txOp) bool) string {
+	key := normalizeRule(op.rule)
+	current := ts.ruleIndex(op.chainName, key)
+	before := ts.ruleIndex(op.chainName, normalizeRule(op.before))
+	if current < 0 && exists(ts, op) {
+		// the rule is somewhere in the chain, so it is deleted and added again where it belongs
+		ts.forget(op.chainName, key)
+		lines := []string{fmt.Sprintf("-D %s %s", op.chainName, op.rule)}
+		if before < 0 {
+			ts.appendRule(op.chainName, key)
+			return strings.Join(append(lines, fmt.Sprintf("-A %s %s", op.chainName, op.rule)), "\n")
+		}
+		ts.insertRule(op.chainName, before, key)
+		return strings.Join(append(lines, fmt.Sprintf("-I %s %d %s", op.chainName, before+1, op.rule)), "\n")
+	}
+	switch {
+	case before < 0 && current >= 0, current >= 0 && current < before:
+		return ""
+	case before < 0:
+		ts.appendRule(op.chainName, key)
+		return fmt.Sprintf("-A %s %s", op.chainName, op.rule)
+	}
+	var lines []string
+	if current >= 0 {
+		// the rule is after before, so removing it doesn't move before
+		ts.deleteRule(op.chainName, key)
+		lines = append(lines, fmt.Sprintf("-D %s %s", op.chainName, op.rule))
+	}
+	ts.insertRule(op.chainName, before, key)
+	lines = append(lines, fmt.Sprintf("-I %s %d %s", op.chainName, before+1, op.rule))
+	return strings.Join(lines, "\n")
+}
+
+// syncChain applies the txSyncChain operation and returns its restore lines, or "" if the chain already has the rules.
+func (ts *tableState) syncChain(op txOp) string {
+	keys := make([]string, 0, len(op.rules))
+	for _, rule := range op.rules {
+		keys = append(keys, normalizeRule(rule))
+	}
+	existing, ok := ts.chains[op.chainName]
+	if ok && slices.Equal(existing, keys) {
+		return ""
+	}
+	var lines []string
+	switch {
+	case !ok:
+		lines = append(lines, fmt.Sprintf(":%s - [0:0]", op.chainName))
+	case len(existing) > 0:
+		lines = append(lines, fmt.Sprintf("-F %s", op.chainName))
+	}
+	for _, rule := range op.rules {
+		lines = append(lines, fmt.Sprintf("-A %s %s", op.chainName, rule))
+	}
+	ts.chains[op.chainName] = keys
+	delete(ts.saved, op.chainName)
+	delete(ts.unplaced, op.chainName)
+	return strings.Join(lines, "\n")
+}
+
+type snapshot map[string]*tableState
+
+func (s snapshot) table(tableName string) *tableState {
+	if _, ok := s[tableName]; !ok {
+		s[tableName] = &tableState{chains: map[string][]string{}, saved: map[string]struct{}{}, unplaced: map[string]map[string]bool{}}
+	}
+	return s[tableName]
+}
+
+// parseSnapshot parses iptables-save output. The format is shared by the legacy and nft
+// backends; comment lines (including the nft warning about legacy tables) are ignored.
+func parseSnapshot(out string) snapshot {
+	snap := snapshot{}
+	var current *tableState
+
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "", strings.HasPrefix(line, "#"), line == "COMMIT":
+			continue
+		case strings.HasPrefix(line, "*"):
+			current = snap.table(strings.TrimPrefix(line, "*"))
+		case current == nil:
+			continue
+		case strings.HasPrefix(line, ":"):
+			fields := strings.Fields(strings.TrimPrefix(line, ":"))
+			if len(fields) > 0 {
+				if _, ok := current.chains[fields[0]]; !ok {
+					current.chains[fields[0]] = []string{}
+				}
+				current.saved[fields[0]] = struct{}{}
+			}
+		case strings.HasPrefix(line, "-A "):
+			fields := strings.Fields(line)
+			if len(fields) > 2 {
+				current.appendRule(fields[1], normalizeRule(strings.Join(fields[2:], " ")))
+			}
+		}
+	}
+
+	return snap
+}
+
+// basicOptions are the options of the ip header match, which iptables-save prints first and in this order
+// regardless of where they appear in the rule.
+var basicOptions = []string{"-s", "-d", "-i", "-o", "-p", "-f"}
+
+// optionAliases maps the long options to the short ones iptables-save prints.
+var optionAliases = map[string]string{
+	"--source":        "-s",
+	"--src":           "-s",
+	"--destination":   "-d",
+	"--dst":           "-d",
+	"--in-interface":  "-i",
+	"--out-interface": "-o",
+	"--protocol":      "-p",
+	"--fragment":      "-f",
+	"--match":         "-m",
+	"--jump":          "-j",
+	"--goto":          "-g",
+	// the options of the tcp and udp matches
+	"--destination-port": "--dport",
+	"--source-port":      "--sport",
+}
+
+// normalizeRule rewrites a rule spec into a canonical form, so that rules built by callers can be compared to the
+// rules printed by iptables-save. Both sides are normalized, so the form only needs to be equal for equivalent
+// rules:
+//   - the ip header options are moved to the front in the order iptables-save prints them
+//   - the protocol match module which iptables loads implicitly ("-p tcp -m tcp") is dropped
+//   - addresses are printed as networks with a prefix length ("10.0.0.1" is "10.0.0.1/32")
+//   - address types, conntrack states and protocols are upper or lower cased, and state lists are sorted
+//   - the state match is written as the conntrack match
+//   - marks are printed in hex, and MARK --set-mark is written as the --set-xmark iptables-save prints
+//   - the abbreviated SNAT and DNAT "--to" options are expanded
+//   - quotes around option values are dropped
+func normalizeRule(rule string) string {
+	fields := splitRule(rule)
+	for i, f := range fields {
+		if alias, ok := optionAliases[f]; ok {
+			fields[i] = alias
+		}
+	}
+
+	proto := ""
+	for i := 0; i+1 < len(fields); i++ {
+		if fields[i] == "-p" {
+			proto = strings.ToLower(fields[i+1])
+		}
+	}
+
+	basic := map[string][]string{}
+	rest := make([]string, 0, len(fields))
+	target := ""
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		negate := f == "!" && i+1 < len(fields) && target == "" && isBasicOption(fields[i+1])
+		if negate || (target == "" && isBasicOption(f)) {
+			opt := []string{}
+			if negate {
+				opt = append(opt, "!")
+				i++
+				f = fields[i]
+			}
+			opt = append(opt, f)
+			if f != "-f" && i+1 < len(fields) {
+				opt = append(opt, canonicalValue(f, fields[i+1]))
+				i++
+			}
+			basic[f] = opt
+			continue
+		}
+		if f == "-m" && i+1 < len(fields) && strings.EqualFold(fields[i+1], proto) {
+			i++
+			continue
+		}
+		if f == "-j" && i+1 < len(fields) {
+			target = fields[i+1]
+		}
+		if i > 0 {
+			f = canonicalValue(fields[i-1], f)
+		}
+		if target != "" && f == "--to" {
+			switch target {
+			case "SNAT":
+				f = "--to-source"
+			case "DNAT":
+				f = "--to-destination"
+			}
+		}
+		switch {
+		case (target == "MARK" || target == "CONNMARK") && f == "--set-mark":
+			f = "--set-xmark"
+		// iptables-nft may print the state match as the conntrack match
+		case target == "" && f == "state" && i > 0 && fields[i-1] == "-m":
+			f = "conntrack"
+		case target == "" && f == "--state":
+			f = "--ctstate"
+		}
+		rest = append(rest, f)
+	}
+
+	out := make([]string, 0, len(fields))
+	for _, opt := range basicOptions {
+		out = append(out, basic[opt]...)
+	}
+	return strings.Join(append(out, rest...), " ")
+}
+
+func isBasicOption(f string) bool {
+	for _, opt := range basicOptions {
+		if f == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalValue returns the canonical form of the value of the option.
+func canonicalValue(option, value string) string {
+	switch option {
+	case "-s", "-d":
+		return withPrefixLength(value)
+	case "-p":
+		return strings.ToLower(value)
+	case "--src-type", "--dst-type":
+		return strings.ToUpper(value)
+	case "--state", "--ctstate":
+		states := strings.Split(strings.ToUpper(value), ",")
+		sort.Strings(states)
+		return strings.Join(states, ",")
+	case "--mark":
+		if mark, mask, ok := parseMark(value); ok {
+			if mask == 0xffffffff {
+				return fmt.Sprintf("0x%x", mark)
+			}
+			return fmt.Sprintf("0x%x/0x%x", mark, mask)
+		}
+	case "--set-mark":
+		// --set-mark zeroes the bits of the mask and ORs the mark, which is an XOR over the bits of both
+		if mark, mask, ok := parseMark(value); ok {
+			return fmt.Sprintf("0x%x/0x%x", mark, mask|mark)
+		}
+	case "--set-xmark":
+		if mark, mask, ok := parseMark(value); ok {
+			return fmt.Sprintf("0x%x/0x%x", mark, mask)
+		}
+	}
+	return value
+}
+
+// parseMark parses a mark with an optional mask, like "0x4000/0x4000" or "101". The mask defaults to all bits.
+func parseMark(value string) (mark, mask uint32, ok bool) {
+	markValue, maskValue, hasMask := strings.Cut(value, "/")
+	m, err := strconv.ParseUint(markValue, 0, 32)
+	if err != nil {
+		return 0, 0, false
+	}
+	mask = 0xffffffff
+	if hasMask {
+		k, err := strconv.ParseUint(maskValue, 0, 32)
+		if err != nil {
+			return 0, 0, false
+		}
+		mask = uint32(k)
+	}
+	return uint32(m), mask, true
+}
+
+// splitRule splits the rule into its fields. Quoted values, like comments, are a single field without the quotes.
+func splitRule(rule string) []string {
+	var (
+		fields []string
+		field  strings.Builder
+		quote  rune
+		inside bool
+	)
+	for _, r := range rule {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			field.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inside = true
+		case r == ' ' || r == '\t':
+			if inside || field.Len() > 0 {
+				fields = append(fields, field.String())
+				field.Reset()
+				inside = false
+			}
+		default:
+			field.WriteRune(r)
+			inside = true
+		}
+	}
+	if inside || field.Len() > 0 {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
+
+// withPrefixLength returns the address as a network with a prefix length, like iptables-save prints it.
+func withPrefixLength(addr string) string {
+	if _, ipNet, err := net.ParseCIDR(addr); err == nil {
+		return ipNet.String()
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return addr
+	}
+	if ip.To4() != nil {
+		return ip.String() + "/32"
+	}
+	return ip.String() + "/128"
+}
@@ -0,0 +1,46 @@
+package iptables
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestTransactionCommitHoldsXtablesLock(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), "xtables.lock")
+	mockPL := platform.NewMockExecClient(false)
+	client := &Client{
+		pl:       mockPL,
+		lockPath: lockPath,
+	}
+	// locked reports whether another process would have to wait for the xtables lock
+	locked := func() bool {
+		f, err := os.OpenFile(lockPath, os.O_RDONLY, 0)
+		require.NoError(t, err)
+		defer f.Close()
+		return unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB) != nil
+	}
+	var cmds []string
+	respond := snapshotResponder(testSnapshot, &cmds)
+	mockPL.SetExecRawCommand(func(cmd string) (string, error) {
+		require.True(t, locked(), "%s runs without the xtables lock", cmd)
+		return respond(cmd)
+	})
+
+	err := client.NewTransaction(V4).
+		InsertIptableRule(Nat, Swift, "-s 10.0.0.0/24 -d 168.63.129.16 -p tcp --dport 53", "SNAT --to-source 10.0.0.4").
+		Commit()
+	require.NoError(t, err)
+	// the commands run under the lock held by the transaction, so they don't wait for it
+	require.Equal(t, []string{
+		"iptables -t nat -C SWIFT -s 10.0.0.0/24 -d 168.63.129.16 -p tcp --dport 53 -j SNAT --to-source 10.0.0.4",
+		"iptables-restore --noflush <<'AZURE_IPTABLES_RESTORE_EOF'\n*nat\n" +
+			"-I SWIFT 1 -s 10.0.0.0/24 -d 168.63.129.16 -p tcp --dport 53 -j SNAT --to-source 10.0.0.4\n" +
+			"COMMIT\nAZURE_IPTABLES_RESTORE_EOF",
+	}, cmds)
+	require.False(t, locked(), "the xtables lock is released after the commit")
+}
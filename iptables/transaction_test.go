@@ -0,0 +1,449 @@
+package iptables
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/stretchr/testify/require"
+)
+
+const testSnapshot = `# Generated by iptables-save v1.8.7 on Mon Jan  1 00:00:00 2024
+*nat
+:PREROUTING ACCEPT [0:0]
+:POSTROUTING ACCEPT [0:0]
+:SWIFT - [0:0]
+-A POSTROUTING -j SWIFT
+-A SWIFT -s 10.0.0.0/24 -d 168.63.129.16/32 -p udp -m udp --dport 53 -j SNAT --to-source 10.0.0.4
+COMMIT
+*filter
+:INPUT ACCEPT [0:0]
+:AZURECNIINPUT - [0:0]
+-A INPUT -j AZURECNIINPUT
+-A AZURECNIINPUT -s 10.0.0.5/32 -p tcp -m tcp --dport 80 -j ACCEPT
+COMMIT
+`
+
+// snapshotResponder returns a raw command responder which answers iptables-save with the snapshot, fails iptables -C
+// unless the command is one of the checks, and records every other command
+func snapshotResponder(snap string, cmds *[]string, checks ...string) func(string) (string, error) {
+	return func(cmd string) (string, error) {
+		if cmd == iptablesSave || cmd == ip6tablesSave {
+			return snap, nil
+		}
+		*cmds = append(*cmds, cmd)
+		if strings.Contains(cmd, " -C ") {
+			for _, check := range checks {
+				if cmd == check {
+					return "", nil
+				}
+			}
+			return "", platform.ErrMockExec
+		}
+		return "", nil
+	}
+}
+
+func TestTransactionCommit(t *testing.T) {
+	mockPL := platform.NewMockExecClient(false)
+	client := &Client{
+		pl: mockPL,
+	}
+	var cmds []string
+	mockPL.SetExecRawCommand(snapshotResponder(testSnapshot, &cmds))
+
+	err := client.NewTransaction(V4).
+		CreateChain(Nat, Swift).
+		AppendIptableRule(Nat, Postrouting, "", Swift).
+		InsertIptableRule(Nat, Swift, "-s 10.0.0.0/24 -d 168.63.129.16 -p udp --dport 53", "SNAT --to-source 10.0.0.4").
+		InsertIptableRule(Nat, Swift, "-s 10.0.0.0/24 -d 168.63.129.16 -p tcp --dport 53", "SNAT --to-source 10.0.0.4").
+		CreateChain(Filter, CNIOutputChain).
+		InsertIptableRule(Filter, Output, "", CNIOutputChain).
+		InsertIptableRule(Filter, Output, "", CNIOutputChain).
+		DeleteIptableRule(Filter, CNIInputChain, "-s 10.0.0.5 -p tcp --dport 80", Accept).
+		DeleteIptableRule(Filter, CNIInputChain, "-s 10.0.0.6 -p tcp --dport 80", Accept).
+		Commit()
+	require.NoError(t, err)
+
+	expected := "iptables-restore -w 60 --noflush <<'AZURE_IPTABLES_RESTORE_EOF'\n" +
+		"*nat\n" +
+		"-I SWIFT 1 -s 10.0.0.0/24 -d 168.63.129.16 -p tcp --dport 53 -j SNAT --to-source 10.0.0.4\n" +
+		"COMMIT\n" +
+		"*filter\n" +
+		":AZURECNIOUTPUT - [0:0]\n" +
+		"-I OUTPUT 1 -j AZURECNIOUTPUT\n" +
+		"-D AZURECNIINPUT -s 10.0.0.5 -p tcp --dport 80 -j ACCEPT\n" +
+		"COMMIT\n" +
+		"AZURE_IPTABLES_RESTORE_EOF"
+	require.Equal(t, []string{
+		// the rules missing from chains in the snapshot are checked with iptables
+		"iptables -w 60 -t nat -C SWIFT -s 10.0.0.0/24 -d 168.63.129.16 -p tcp --dport 53 -j SNAT --to-source 10.0.0.4",
+		"iptables -w 60 -t filter -C AZURECNIINPUT -s 10.0.0.6 -p tcp --dport 80 -j ACCEPT",
+		expected,
+	}, cmds)
+
+	// an empty transaction does not snapshot the ruleset
+	require.NoError(t, client.NewTransaction(V4).Commit())
+	require.Len(t, cmds, 3)
+}
+
+func TestTransactionCommitNoop(t *testing.T) {
+	mockPL := platform.NewMockExecClient(false)
+	client := &Client{
+		pl: mockPL,
+	}
+	var cmds []string
+	mockPL.SetExecRawCommand(snapshotResponder(testSnapshot, &cmds))
+
+	tx := client.NewTransaction(V4).
+		CreateChain(Nat, Swift).
+		AppendIptableRule(Nat, Postrouting, "", Swift)
+	require.NoError(t, tx.Commit())
+	require.Empty(t, cmds)
+
+	require.ErrorIs(t, tx.Commit(), errTransactionCommitted)
+}
+
+func TestTransactionCommitV6NoLock(t *testing.T) {
+	DisableIPTableLock = true
+	defer func() { DisableIPTableLock = false }()
+
+	mockPL := platform.NewMockExecClient(false)
+	client := &Client{
+		pl: mockPL,
+	}
+	var cmds []string
+	mockPL.SetExecRawCommand(snapshotResponder("", &cmds))
+
+	err := client.NewTransaction(V6).
+		AppendIptableRule(Filter, Forward, "-d fd00::1", Drop).
+		Commit()
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"ip6tables-restore --noflush <<'AZURE_IPTABLES_RESTORE_EOF'\n*filter\n-A FORWARD -d fd00::1 -j DROP\nCOMMIT\nAZURE_IPTABLES_RESTORE_EOF",
+	}, cmds)
+}
+
+func TestTransactionCommitErrors(t *testing.T) {
+	mockPL := platform.NewMockExecClient(false)
+	client := &Client{
+		pl: mockPL,
+	}
+
+	mockPL.SetExecRawCommand(GenerateValidationFunc(t, []validationCase{
+		{cmd: "iptables-save", doErr: true},
+	}))
+	err := client.NewTransaction(V4).CreateChain(Filter, CNIInputChain).Commit()
+	require.ErrorIs(t, err, errIptablesSave)
+
+	mockPL.SetExecRawCommand(GenerateValidationFunc(t, []validationCase{
+		{cmd: "iptables-save", doErr: false},
+		{cmd: "iptables-restore -w 60 --noflush <<'AZURE_IPTABLES_RESTORE_EOF'\n*filter\n:AZURECNIINPUT - [0:0]\nCOMMIT\nAZURE_IPTABLES_RESTORE_EOF", doErr: true},
+	}))
+	err = client.NewTransaction(V4).CreateChain(Filter, CNIInputChain).Commit()
+	require.ErrorIs(t, err, errIptablesRestore)
+}
+
+func TestTransactionDeleteChain(t *testing.T) {
+	mockPL := platform.NewMockExecClient(false)
+	client := &Client{
+		pl: mockPL,
+	}
+	var cmds []string
+	mockPL.SetExecRawCommand(snapshotResponder(testSnapshot, &cmds))
+
+	err := client.NewTransaction(V4).
+		DeleteIptableRule(Nat, Postrouting, "", Swift).
+		DeleteChain(Nat, Swift).
+		DeleteChain(Nat, "SWIFT-POSTROUTING").
+		Commit()
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"iptables-restore -w 60 --noflush <<'AZURE_IPTABLES_RESTORE_EOF'\n*nat\n-D POSTROUTING -j SWIFT\n-F SWIFT\n-X SWIFT\nCOMMIT\nAZURE_IPTABLES_RESTORE_EOF",
+	}, cmds)
+}
+
+// TestTransactionRecreateChain checks that operations are applied in order, so a chain which is deleted and created
+// again in the same transaction ends up existing with its new rules.
+func TestTransactionRecreateChain(t *testing.T) {
+	mockPL := platform.NewMockExecClient(false)
+	client := &Client{
+		pl: mockPL,
+	}
+	var cmds []string
+	mockPL.SetExecRawCommand(snapshotResponder(testSnapshot, &cmds))
+
+	err := client.NewTransaction(V4).
+		DeleteIptableRule(Nat, Postrouting, "", Swift).
+		DeleteChain(Nat, Swift).
+		CreateChain(Nat, Swift).
+		AppendIptableRule(Nat, Postrouting, "", Swift).
+		InsertIptableRule(Nat, Swift, "-s 10.0.0.0/24 -d 168.63.129.16 -p udp --dport 53", "SNAT --to-source 10.0.0.5").
+		DeleteChain(Filter, CNIInputChain).
+		SyncChain(Filter, CNIInputChain, []Rule{{Match: "-s 10.0.0.5", Target: Accept}}).
+		Commit()
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"iptables-restore -w 60 --noflush <<'AZURE_IPTABLES_RESTORE_EOF'\n" +
+			"*nat\n-D POSTROUTING -j SWIFT\n-F SWIFT\n-X SWIFT\n:SWIFT - [0:0]\n-A POSTROUTING -j SWIFT\n" +
+			"-I SWIFT 1 -s 10.0.0.0/24 -d 168.63.129.16 -p udp --dport 53 -j SNAT --to-source 10.0.0.5\nCOMMIT\n" +
+			"*filter\n-F AZURECNIINPUT\n-X AZURECNIINPUT\n:AZURECNIINPUT - [0:0]\n-A AZURECNIINPUT -s 10.0.0.5 -j ACCEPT\nCOMMIT\n" +
+			"AZURE_IPTABLES_RESTORE_EOF",
+	}, cmds)
+}
+
+func TestNormalizeRule(t *testing.T) {
+	tests := []struct {
+		rule string
+		want string
+	}{
+		{"-p tcp --dport 80 -j ACCEPT", "-p tcp --dport 80 -j ACCEPT"},
+		{"-p tcp -m tcp --dport 80 -j ACCEPT", "-p tcp --dport 80 -j ACCEPT"},
+		{"  -s 10.0.0.1   -d 10.0.0.0/8 -j DROP", "-s 10.0.0.1/32 -d 10.0.0.0/8 -j DROP"},
+		{"--source fd00::1 --protocol udp -m udp -j DROP", "-s fd00::1/128 -p udp -j DROP"},
+		{"-m addrtype ! --dst-type local -j SWIFT", "-m addrtype ! --dst-type LOCAL -j SWIFT"},
+		{"-p UDP ! -s 10.0.0.5/24 -j DROP", "! -s 10.0.0.0/24 -p udp -j DROP"},
+		{"-m comment --comment \"azure cni\" -j ACCEPT", "-m comment --comment azure cni -j ACCEPT"},
+		{"-j SNAT --to 10.0.0.4", "-j SNAT --to-source 10.0.0.4"},
+		{"-j DNAT --to 10.0.0.4:80", "-j DNAT --to-destination 10.0.0.4:80"},
+		{"-m state --state ESTABLISHED,RELATED -j ACCEPT", "-m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT"},
+		{"-m state --state RELATED,ESTABLISHED -j ACCEPT", "-m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT"},
+		{"-m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT", "-m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT"},
+		{"-p tcp --destination-port 80 -j ACCEPT", "-p tcp --dport 80 -j ACCEPT"},
+		{"-j MARK --set-mark 0x0", "-j MARK --set-xmark 0x0/0xffffffff"},
+		{"-j MARK --set-mark 101", "-j MARK --set-xmark 0x65/0xffffffff"},
+		{"-j MARK --set-mark 0x4000/0x4000", "-j MARK --set-xmark 0x4000/0x4000"},
+		{"-j MARK --set-xmark 0x4000/0x0", "-j MARK --set-xmark 0x4000/0x0"},
+		{"-m mark --mark 16384 -j ACCEPT", "-m mark --mark 0x4000 -j ACCEPT"},
+		{"-m mark --mark 0x4000/0x4000 -j ACCEPT", "-m mark --mark 0x4000/0x4000 -j ACCEPT"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, normalizeRule(tt.rule), tt.rule)
+	}
+}
+
+// savedRules is iptables-save output of the rules programmed by CNI and CNS on a node, as iptables v1.8.7 prints them.
+const savedRules = `# Generated by iptables-save v1.8.7 on Tue Oct  6 10:12:43 2026
+*nat
+:PREROUTING ACCEPT [12:720]
+:INPUT ACCEPT [0:0]
+:OUTPUT ACCEPT [341:20460]
+:POSTROUTING ACCEPT [341:20460]
+:SWIFT - [0:0]
+:SWIFT-POSTROUTING - [0:0]
+-A PREROUTING -d 10.224.0.4/32 -p tcp -m tcp --dport 8080 -j DNAT --to-destination 10.244.1.5:80
+-A POSTROUTING -j SWIFT-POSTROUTING
+-A POSTROUTING -j SWIFT
+-A POSTROUTING -s 169.254.128.0/17 -o eth0 -j MASQUERADE
+-A POSTROUTING -s 169.254.0.0/16 -j MASQUERADE
+-A SWIFT -s 10.244.0.0/16 -d 168.63.129.16/32 -p udp -m addrtype ! --dst-type LOCAL -m udp --dport 53 -j SNAT --to-source 10.244.0.5
+-A SWIFT -s 10.244.0.0/16 -d 168.63.129.16/32 -p tcp -m addrtype ! --dst-type LOCAL -m tcp --dport 53 -j SNAT --to-source 10.244.0.5
+-A SWIFT -s 10.244.0.0/16 -d 169.254.169.254/32 -p tcp -m addrtype ! --dst-type LOCAL -m tcp --dport 80 -j SNAT --to-source 10.224.0.4
+-A SWIFT-POSTROUTING -s 240.1.2.0/24 -d 168.63.129.16/32 -p udp -m addrtype ! --dst-type LOCAL -m udp --dport 53 -j SNAT --to-source 10.0.0.4
+-A SWIFT-POSTROUTING -s 240.1.2.0/24 -d 168.63.129.16/32 -p tcp -m addrtype ! --dst-type LOCAL -m tcp --dport 53 -j SNAT --to-source 10.0.0.4
+-A SWIFT-POSTROUTING -s 240.1.2.0/24 -d 169.254.169.254/32 -p tcp -m addrtype ! --dst-type LOCAL -m tcp --dport 80 -j SNAT --to-source 10.0.0.4
+COMMIT
+# Completed on Tue Oct  6 10:12:43 2026
+# Generated by iptables-save v1.8.7 on Tue Oct  6 10:12:43 2026
+*mangle
+:PREROUTING ACCEPT [0:0]
+:POSTROUTING ACCEPT [0:0]
+-A PREROUTING -i vlan1 -j ACCEPT
+-A PREROUTING -j MARK --set-xmark 0x65/0xffffffff
+COMMIT
+# Completed on Tue Oct  6 10:12:43 2026
+# Generated by iptables-save v1.8.7 on Tue Oct  6 10:12:43 2026
+*filter
+:INPUT ACCEPT [5125:2563217]
+:FORWARD ACCEPT [0:0]
+:OUTPUT ACCEPT [4952:782142]
+:AZURECNIINPUT - [0:0]
+:AZURECNIOUTPUT - [0:0]
+-A INPUT -j AZURECNIINPUT
+-A FORWARD -d 168.63.129.16/32 -p tcp -m tcp --dport 80 -j DROP
+-A FORWARD -d 168.63.129.16/32 -i azSnatbr -j ACCEPT
+-A FORWARD -d 10.0.0.0/8 -i azSnatbr -j DROP
+-A FORWARD -j ACCEPT
+-A OUTPUT -j AZURECNIOUTPUT
+-A OUTPUT -d 10.0.0.0/8 -o azSnatbr -j DROP
+-A AZURECNIINPUT -i azSnatbr -m state --state RELATED,ESTABLISHED -j ACCEPT
+-A AZURECNIINPUT -s 169.254.128.4/32 -d 169.254.128.1/32 -j ACCEPT
+-A AZURECNIOUTPUT -o azSnatbr -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT
+-A AZURECNIOUTPUT -s 169.254.128.1/32 -d 169.254.128.4/32 -j ACCEPT
+COMMIT
+# Completed on Tue Oct  6 10:12:43 2026
+`
+
+// TestTransactionCommitSavedRules checks that the rules, as ACN callers build them, are found in real iptables-save
+// output, so that programming them again is a no-op.
+func TestTransactionCommitSavedRules(t *testing.T) {
+	mockPL := platform.NewMockExecClient(false)
+	client := &Client{
+		pl: mockPL,
+	}
+	var cmds []string
+	mockPL.SetExecRawCommand(snapshotResponder(savedRules, &cmds))
+
+	err := client.NewTransaction(V4).
+		CreateChain(Nat, Swift).
+		AppendIptableRule(Nat, Postrouting, "", Swift).
+		InsertIptableRule(Nat, Swift, " -m addrtype ! --dst-type local -s 10.244.0.0/16 -d 168.63.129.16 -p udp --dport 53", "SNAT --to 10.244.0.5").
+		InsertIptableRule(Nat, Swift, " -m addrtype ! --dst-type local -s 10.244.0.0/16 -d 168.63.129.16 -p tcp --dport 53", "SNAT --to 10.244.0.5").
+		InsertIptableRule(Nat, Swift, " -m addrtype ! --dst-type local -s 10.244.0.0/16 -d 169.254.169.254 -p tcp --dport 80", "SNAT --to 10.224.0.4").
+		InsertIptableRule(Nat, Postrouting, "-o eth0 -s 169.254.128.0/17", Masquerade).
+		InsertIptableRule(Nat, "PREROUTING", "-p tcp -d 10.224.0.4 --dport 8080", "DNAT --to-destination 10.244.1.5:80").
+		CreateChain(Filter, CNIInputChain).
+		InsertIptableRule(Filter, Input, "", CNIInputChain).
+		InsertIptableRule(Filter, CNIInputChain, " -i azSnatbr -m state --state ESTABLISHED,RELATED", Accept).
+		InsertIptableRule(Filter, CNIInputChain, "-s 169.254.128.4 -d 169.254.128.1", Accept).
+		InsertIptableRule(Filter, CNIOutputChain, "-s 169.254.128.1 -d 169.254.128.4", Accept).
+		InsertIptableRule(Filter, CNIOutputChain, " -o azSnatbr -m state --state ESTABLISHED,RELATED", Accept).
+		// network/snat
+		InsertIptableRule(Nat, Postrouting, "-s 169.254.0.0/16", Masquerade).
+		AppendIptableRule(Filter, Forward, "", Accept).
+		// networkutils
+		InsertIptableRule(Filter, Forward, "-d 168.63.129.16 -p tcp -m tcp --dport 80", Drop).
+		InsertIptableRule(Filter, Forward, "-i azSnatbr -d 168.63.129.16", Accept).
+		AppendIptableRule(Filter, Forward, "-i azSnatbr -d 10.0.0.0/8", Drop).
+		AppendIptableRule(Filter, Output, "-o azSnatbr -d 10.0.0.0/8", Drop).
+		// transparent vlan
+		InsertIptableRule(Mangle, Prerouting, "", "MARK --set-mark 101").
+		InsertIptableRule(Mangle, Prerouting, "-i vlan1", Accept).
+		// CNS
+		CreateChain(Nat, "SWIFT-POSTROUTING").
+		InsertIptableRuleBefore(Nat, Postrouting, "", "SWIFT-POSTROUTING", "-j SWIFT").
+		SyncChain(Nat, "SWIFT-POSTROUTING", []Rule{
+			{Match: "-m addrtype ! --dst-type local -s 240.1.2.0/24 -d 168.63.129.16 -p udp --dport 53", Target: "SNAT --to 10.0.0.4"},
+			{Match: "-m addrtype ! --dst-type local -s 240.1.2.0/24 -d 168.63.129.16 -p tcp --dport 53", Target: "SNAT --to 10.0.0.4"},
+			{Match: "-m addrtype ! --dst-type local -s 240.1.2.0/24 -d 169.254.169.254 -p tcp --dport 80", Target: "SNAT --to 10.0.0.4"},
+		}).
+		Commit()
+	require.NoError(t, err)
+	require.Empty(t, cmds)
+}
+
+// TestTransactionCommitRuleNotSaved checks that a rule which isn't in the snapshot is checked with iptables before it is
+// added, so that a spelling which the canonical form doesn't cover isn't added twice.
+func TestTransactionCommitRuleNotSaved(t *testing.T) {
+	const (
+		check      = "iptables -w 60 -t filter -C AZURECNIINPUT -p tcp -m multiport --dports 80,443 -j ACCEPT"
+		checkMove  = "iptables -w 60 -t nat -C POSTROUTING -m comment --comment swift -j SWIFT-POSTROUTING"
+		restoreAdd = "iptables-restore -w 60 --noflush <<'AZURE_IPTABLES_RESTORE_EOF'\n*filter\n" +
+			"-A AZURECNIINPUT -p tcp -m multiport --dports 80,443 -j ACCEPT\nCOMMIT\nAZURE_IPTABLES_RESTORE_EOF"
+	)
+	tx := func(client *Client) *Transaction {
+		return client.NewTransaction(V4).
+			AppendIptableRule(Filter, CNIInputChain, "-p tcp -m multiport --dports 80,443", Accept).
+			// the rule is found in the snapshot, so it is not checked
+			InsertIptableRuleBefore(Nat, Postrouting, "", "SWIFT-POSTROUTING", "-j SWIFT")
+	}
+
+	mockPL := platform.NewMockExecClient(false)
+	client := NewClientWithExecClient(mockPL)
+	var cmds []string
+	mockPL.SetExecRawCommand(snapshotResponder(savedRules, &cmds))
+	require.NoError(t, tx(client).Commit())
+	require.Equal(t, []string{check, restoreAdd}, cmds)
+
+	cmds = nil
+	mockPL.SetExecRawCommand(snapshotResponder(savedRules, &cmds, check))
+	require.NoError(t, tx(client).Commit())
+	require.Equal(t, []string{check}, cmds)
+
+	// a rule which is only found by iptables is deleted, and moved where it belongs
+	cmds = nil
+	mockPL.SetExecRawCommand(snapshotResponder(savedRules, &cmds, checkMove))
+	err := client.NewTransaction(V4).
+		DeleteIptableRule(Filter, CNIInputChain, "-p tcp -m multiport --dports 80,443", Accept).
+		InsertIptableRuleBefore(Nat, Postrouting, "-m comment --comment swift", "SWIFT-POSTROUTING", "-j SWIFT").
+		Commit()
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		check,
+		checkMove,
+		"iptables-restore -w 60 --noflush <<'AZURE_IPTABLES_RESTORE_EOF'\n*nat\n" +
+			"-D POSTROUTING -m comment --comment swift -j SWIFT-POSTROUTING\n" +
+			"-I POSTROUTING 2 -m comment --comment swift -j SWIFT-POSTROUTING\nCOMMIT\nAZURE_IPTABLES_RESTORE_EOF",
+	}, cmds)
+}
+
+func TestTransactionInsertIptableRuleBefore(t *testing.T) {
+	tests := []struct {
+		name     string
+		snapshot string
+		want     string
+	}{
+		{
+			name:     "rule after before is moved ahead of it",
+			snapshot: "*nat\n:POSTROUTING ACCEPT [0:0]\n-A POSTROUTING -s 10.0.0.0/8 -j MASQUERADE\n-A POSTROUTING -j SWIFT\n-A POSTROUTING -j SWIFT-POSTROUTING\nCOMMIT\n",
+			want:     "*nat\n-D POSTROUTING -j SWIFT-POSTROUTING\n-I POSTROUTING 2 -j SWIFT-POSTROUTING\nCOMMIT\n",
+		},
+		{
+			name:     "rule is inserted at the position of before",
+			snapshot: "*nat\n:POSTROUTING ACCEPT [0:0]\n-A POSTROUTING -s 10.0.0.0/8 -j MASQUERADE\n-A POSTROUTING -j SWIFT\nCOMMIT\n",
+			want:     "*nat\n-I POSTROUTING 2 -j SWIFT-POSTROUTING\nCOMMIT\n",
+		},
+		{
+			name:     "rule is appended without before",
+			snapshot: "*nat\n:POSTROUTING ACCEPT [0:0]\n-A POSTROUTING -s 10.0.0.0/8 -j MASQUERADE\nCOMMIT\n",
+			want:     "*nat\n-A POSTROUTING -j SWIFT-POSTROUTING\nCOMMIT\n",
+		},
+		{
+			name:     "rule ahead of before is kept",
+			snapshot: "*nat\n:POSTROUTING ACCEPT [0:0]\n-A POSTROUTING -j SWIFT-POSTROUTING\n-A POSTROUTING -j SWIFT\nCOMMIT\n",
+		},
+		{
+			name:     "rule without before is kept",
+			snapshot: "*nat\n:POSTROUTING ACCEPT [0:0]\n-A POSTROUTING -j SWIFT-POSTROUTING\nCOMMIT\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := NewClientWithExecClient(platform.NewMockExecClient(true)).NewTransaction(V4).
+				InsertIptableRuleBefore(Nat, Postrouting, "", "SWIFT-POSTROUTING", "-j SWIFT")
+			require.Equal(t, tt.want, tx.restoreInput(parseSnapshot(tt.snapshot)))
+		})
+	}
+}
+
+func TestTransactionSyncChain(t *testing.T) {
+	rules := []Rule{
+		{Match: "-s 10.0.0.0/24 -d 168.63.129.16 -p udp --dport 53", Target: "SNAT --to 10.0.0.4"},
+		{Match: "-s 10.0.0.0/24 -d 168.63.129.16 -p tcp --dport 53", Target: "SNAT --to 10.0.0.4"},
+	}
+	tests := []struct {
+		name     string
+		snapshot string
+		want     string
+	}{
+		{
+			name:     "missing chain is created",
+			snapshot: "*nat\n:POSTROUTING ACCEPT [0:0]\nCOMMIT\n",
+			want: "*nat\n:SWIFT-POSTROUTING - [0:0]\n" +
+				"-A SWIFT-POSTROUTING -s 10.0.0.0/24 -d 168.63.129.16 -p udp --dport 53 -j SNAT --to 10.0.0.4\n" +
+				"-A SWIFT-POSTROUTING -s 10.0.0.0/24 -d 168.63.129.16 -p tcp --dport 53 -j SNAT --to 10.0.0.4\nCOMMIT\n",
+		},
+		{
+			name: "chain with a stale rule is flushed",
+			snapshot: "*nat\n:SWIFT-POSTROUTING - [0:0]\n" +
+				"-A SWIFT-POSTROUTING -s 10.0.0.0/24 -d 168.63.129.16/32 -p udp -m udp --dport 53 -j SNAT --to-source 10.0.0.4\n" +
+				"-A SWIFT-POSTROUTING -s 10.0.0.0/24 -d 168.63.129.16/32 -p tcp -m tcp --dport 53 -j SNAT --to-source 10.0.0.5\nCOMMIT\n",
+			want: "*nat\n-F SWIFT-POSTROUTING\n" +
+				"-A SWIFT-POSTROUTING -s 10.0.0.0/24 -d 168.63.129.16 -p udp --dport 53 -j SNAT --to 10.0.0.4\n" +
+				"-A SWIFT-POSTROUTING -s 10.0.0.0/24 -d 168.63.129.16 -p tcp --dport 53 -j SNAT --to 10.0.0.4\nCOMMIT\n",
+		},
+		{
+			name: "chain with the rules is kept",
+			snapshot: "*nat\n:SWIFT-POSTROUTING - [0:0]\n" +
+				"-A SWIFT-POSTROUTING -s 10.0.0.0/24 -d 168.63.129.16/32 -p udp -m udp --dport 53 -j SNAT --to-source 10.0.0.4\n" +
+				"-A SWIFT-POSTROUTING -s 10.0.0.0/24 -d 168.63.129.16/32 -p tcp -m tcp --dport 53 -j SNAT --to-source 10.0.0.4\nCOMMIT\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := NewClientWithExecClient(platform.NewMockExecClient(true)).NewTransaction(V4).
+				SyncChain(Nat, "SWIFT-POSTROUTING", rules)
+			require.Equal(t, tt.want, tx.restoreInput(parseSnapshot(tt.snapshot)))
+		})
+	}
+}
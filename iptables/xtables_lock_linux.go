@@ -0,0 +1,34 @@
+package iptables
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const lockRetryInterval = 200 * time.Millisecond
+
+// lockXtables takes the xtables lock which iptables waits for with -w, retrying until the timeout. Closing the
+// returned file releases the lock.
+func lockXtables(path string, timeout time.Duration) (io.Closer, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0o600) //nolint:gomnd // the permissions iptables uses
+	if err != nil {
+		return nil, fmt.Errorf("failed to open xtables lock %s: %w", path, err)
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		err = unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, unix.EWOULDBLOCK) || time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("failed to take xtables lock %s: %w", path, err)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
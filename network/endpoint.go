@@ -48,6 +48,7 @@ type endpoint struct {
 	EnableMultitenancy       bool
 	AllowInboundFromHostToNC bool
 	AllowInboundFromNCToHost bool
+	HostRulesBackend         string `json:",omitempty"`
 	NetworkContainerID       string
 	NetworkNameSpace         string `json:",omitempty"`
 	ContainerID              string
@@ -84,6 +85,7 @@ type EndpointInfo struct {
 	EnableSnatForDns         bool
 	AllowInboundFromHostToNC bool
 	AllowInboundFromNCToHost bool
+	HostRulesBackend         string
 	NetworkContainerID       string
 	PODName                  string
 	PODNameSpace             string
@@ -316,6 +318,7 @@ func (ep *endpoint) getInfo() *EndpointInfo {
 		EnableMultiTenancy:       ep.EnableMultitenancy,
 		AllowInboundFromHostToNC: ep.AllowInboundFromHostToNC,
 		AllowInboundFromNCToHost: ep.AllowInboundFromNCToHost,
+		HostRulesBackend:         ep.HostRulesBackend,
 		IfName:                   ep.IfName,
 		ContainerID:              ep.ContainerID,
 		NetNsPath:                ep.NetworkNameSpace,
@@ -121,6 +121,7 @@ func (nw *network) newEndpointImpl(
 		EnableMultitenancy:       epInfo.EnableMultiTenancy,
 		AllowInboundFromHostToNC: epInfo.AllowInboundFromHostToNC,
 		AllowInboundFromNCToHost: epInfo.AllowInboundFromNCToHost,
+		HostRulesBackend:         epInfo.HostRulesBackend,
 		NetworkNameSpace:         epInfo.NetNsPath,
 		ContainerID:              epInfo.ContainerID,
 		PODName:                  epInfo.PODName,
@@ -163,6 +164,9 @@ func (nw *network) newEndpointImpl(
 					plc,
 					iptc)
 			}
+		} else if epInfo.Mode == opModeIPVlan {
+			logger.Info("IPVlan client")
+			epClient = NewIPVlanEndpointClient(nw.extIf, contIfName, nl, netioCli, plc)
 		} else if epInfo.Mode != opModeTransparent {
 			logger.Info("Bridge client")
 			epClient = NewLinuxBridgeEndpointClient(nw.extIf, hostIfName, contIfName, epInfo.Mode, nl, plc)
@@ -282,6 +286,8 @@ func (nw *network) deleteEndpointImpl(nl netlink.NetlinkInterface, plc platform.
 			} else {
 				epClient = NewOVSEndpointClient(nw, epInfo, ep.HostIfName, "", ep.VlanID, ep.LocalIP, nl, ovsctl.NewOvsctl(), plc, iptc)
 			}
+		} else if mode == opModeIPVlan {
+			epClient = NewIPVlanEndpointClient(nw.extIf, "", nl, nioc, plc)
 		} else if mode != opModeTransparent {
 			epClient = NewLinuxBridgeEndpointClient(nw.extIf, ep.HostIfName, "", mode, nl, plc)
 		} else {
@@ -338,6 +344,7 @@ func addRoutes(nl netlink.NetlinkInterface, netioshim netio.NetIOInterface, inte
 		nlRoute := &netlink.Route{
 			Family:    family,
 			Dst:       &route.Dst,
+			Src:       route.Src,
 			Gw:        route.Gw,
 			LinkIndex: ifIndex,
 			Priority:  route.Priority,
@@ -0,0 +1,290 @@
+package network
+
+import (
+	"net"
+
+	"github.com/Azure/azure-container-networking/netio"
+	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/network/networkutils"
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// ipvlanHostIfName is the host side ipvlan slave shared by all ipvlan endpoints on the master.
+// An ipvlan master cannot exchange traffic with its own slaves, so the host reaches pods through this
+// slave. It carries none of the host's addresses: in L3S mode the master hands the packets to a
+// slave's address to that slave, so host bound traffic would no longer enter on the master. Pods
+// reach the host's addresses through the host routing table instead. It does not use the azv prefix
+// of the host veths.
+const ipvlanHostIfName = "azipvl-host"
+
+var errorIPVlanEndpointClient = errors.New("IPVlanEndpointClient Error")
+
+func newErrorIPVlanEndpointClient(err error) error {
+	return errors.Wrapf(err, "%s", errorIPVlanEndpointClient)
+}
+
+// IPVlanEndpointClient creates an ipvlan L3S slave of the master NIC directly in the container netns.
+// Traffic to and from the pod is routed by the master's L3 stack, and L3S mode keeps it visible to
+// host netfilter. Host to pod traffic uses per-pod /32 routes via the shared host slave, sourced
+// from the host's address.
+type IPVlanEndpointClient struct {
+	hostPrimaryIfName string
+	hostIPAddresses   []*net.IPNet
+	containerIfName   string
+	// movedToContainerNS is set once the slave has left the host netns
+	movedToContainerNS bool
+	netlink            netlink.NetlinkInterface
+	netioshim          netio.NetIOInterface
+	plClient           platform.ExecClient
+	netUtilsClient     networkutils.NetworkUtils
+}
+
+func NewIPVlanEndpointClient(
+	extIf *externalInterface,
+	containerIfName string,
+	nl netlink.NetlinkInterface,
+	nioc netio.NetIOInterface,
+	plc platform.ExecClient,
+) *IPVlanEndpointClient {
+	return &IPVlanEndpointClient{
+		hostPrimaryIfName: extIf.Name,
+		hostIPAddresses:   extIf.IPAddresses,
+		containerIfName:   containerIfName,
+		netlink:           nl,
+		netioshim:         nioc,
+		plClient:          plc,
+		netUtilsClient:    networkutils.NewNetworkUtils(nl, plc),
+	}
+}
+
+func (client *IPVlanEndpointClient) AddEndpoints(_ *EndpointInfo) error {
+	// a stale slave left in the host netns by a failed ADD would block creating the new one
+	if _, err := client.netioshim.GetNetworkInterfaceByName(client.containerIfName); err == nil {
+		logger.Info("Deleting old ipvlan interface", zap.String("containerIfName", client.containerIfName))
+		if err = client.netlink.DeleteLink(client.containerIfName); err != nil {
+			return newErrorIPVlanEndpointClient(err)
+		}
+	}
+
+	primaryIf, err := client.netioshim.GetNetworkInterfaceByName(client.hostPrimaryIfName)
+	if err != nil {
+		return newErrorIPVlanEndpointClient(err)
+	}
+
+	logger.Info("Creating ipvlan l3s interface", zap.String("containerIfName", client.containerIfName),
+		zap.String("master", client.hostPrimaryIfName))
+	link := netlink.IPVlanLink{
+		LinkInfo: netlink.LinkInfo{
+			Type:        netlink.LINK_TYPE_IPVLAN,
+			Name:        client.containerIfName,
+			MTU:         uint(primaryIf.MTU),
+			ParentIndex: primaryIf.Index,
+		},
+		Mode: netlink.IPVLAN_MODE_L3S,
+	}
+	if err := client.netlink.AddLink(&link); err != nil {
+		return newErrorIPVlanEndpointClient(err)
+	}
+
+	if err := client.ensureHostInterface(primaryIf); err != nil {
+		return newErrorIPVlanEndpointClient(err)
+	}
+
+	return nil
+}
+
+// ensureHostInterface creates the host ipvlan slave on the master if it does not exist yet, and makes
+// sure it is up and carries none of the host's addresses, so that a slave left half configured by a
+// failed ADD, or given the host's addresses by an older version, is repaired.
+func (client *IPVlanEndpointClient) ensureHostInterface(primaryIf *net.Interface) error {
+	hostIf, err := client.netioshim.GetNetworkInterfaceByName(ipvlanHostIfName)
+	if err != nil {
+		logger.Info("Creating host ipvlan l3s interface", zap.String("hostIfName", ipvlanHostIfName),
+			zap.String("master", client.hostPrimaryIfName))
+		link := netlink.IPVlanLink{
+			LinkInfo: netlink.LinkInfo{
+				Type:        netlink.LINK_TYPE_IPVLAN,
+				Name:        ipvlanHostIfName,
+				MTU:         uint(primaryIf.MTU),
+				ParentIndex: primaryIf.Index,
+			},
+			Mode: netlink.IPVLAN_MODE_L3S,
+		}
+		if err = client.netlink.AddLink(&link); err != nil {
+			return errors.Wrap(err, "failed to create host ipvlan interface")
+		}
+
+		if err = client.configureHostInterface(nil, false); err != nil {
+			// don't leave a half configured slave behind for the next ADD
+			if delErr := client.netlink.DeleteLink(ipvlanHostIfName); delErr != nil {
+				logger.Error("Failed to delete host ipvlan interface", zap.Error(delErr))
+			}
+			return err
+		}
+		return nil
+	}
+
+	addrs, err := client.netioshim.GetNetworkInterfaceAddrs(hostIf)
+	if err != nil {
+		return errors.Wrap(err, "failed to get host ipvlan interface addresses")
+	}
+	return client.configureHostInterface(addrs, hostIf.Flags&net.FlagUp != 0)
+}
+
+// configureHostInterface removes the host's addresses from the host ipvlan slave and sets it up if it
+// is down.
+func (client *IPVlanEndpointClient) configureHostInterface(addrs []net.Addr, up bool) error {
+	for _, ipAddr := range client.hostIPAddresses {
+		if !hasAddress(addrs, ipAddr.IP) {
+			continue
+		}
+		hostIP := &net.IPNet{IP: ipAddr.IP, Mask: net.CIDRMask(ipv6Bits, ipv6Bits)}
+		if ipAddr.IP.To4() != nil {
+			hostIP.Mask = net.CIDRMask(ipv4Bits, ipv4Bits)
+		}
+		logger.Info("Removing host address from host ipvlan interface", zap.String("hostIfName", ipvlanHostIfName), zap.Stringer("address", hostIP))
+		if err := client.netlink.DeleteIPAddress(ipvlanHostIfName, hostIP.IP, hostIP); err != nil {
+			return errors.Wrapf(err, "failed to remove %s from host ipvlan interface", hostIP)
+		}
+	}
+
+	if up {
+		return nil
+	}
+	if err := client.netlink.SetLinkState(ipvlanHostIfName, true); err != nil {
+		return errors.Wrap(err, "failed to set host ipvlan interface up")
+	}
+
+	return nil
+}
+
+// hasAddress reports whether one of the interface addresses is the ip
+func hasAddress(addrs []net.Addr, ip net.IP) bool {
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// podRoutes returns the host routes to the pod's addresses via the host ipvlan slave, sourced from the
+// host's address of the same family since the slave has none
+// ip route add 10.0.0.4/32 dev azipvl-host src 10.0.0.1
+func (client *IPVlanEndpointClient) podRoutes(ipAddresses []net.IPNet) []RouteInfo {
+	routes := make([]RouteInfo, 0, len(ipAddresses))
+	for _, ipAddr := range ipAddresses {
+		isV4 := ipAddr.IP.To4() != nil
+		dst := net.IPNet{IP: ipAddr.IP, Mask: net.CIDRMask(ipv6Bits, ipv6Bits)}
+		if isV4 {
+			dst.Mask = net.CIDRMask(ipv4Bits, ipv4Bits)
+		}
+		route := RouteInfo{Dst: dst, Scope: netlink.RT_SCOPE_LINK}
+		for _, hostIP := range client.hostIPAddresses {
+			if (hostIP.IP.To4() != nil) == isV4 {
+				route.Src = hostIP.IP
+				break
+			}
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// AddEndpointRules adds the host routes to the pod's addresses via the host ipvlan slave
+func (client *IPVlanEndpointClient) AddEndpointRules(epInfo *EndpointInfo) error {
+	if err := addRoutes(client.netlink, client.netioshim, ipvlanHostIfName, client.podRoutes(epInfo.IPAddresses)); err != nil {
+		return newErrorIPVlanEndpointClient(err)
+	}
+
+	return nil
+}
+
+func (client *IPVlanEndpointClient) DeleteEndpointRules(_ *endpoint) {}
+
+func (client *IPVlanEndpointClient) MoveEndpointsToContainerNS(epInfo *EndpointInfo, nsID uintptr) error {
+	logger.Info("Setting link netns", zap.String("containerIfName", client.containerIfName), zap.String("NetNsPath", epInfo.NetNsPath))
+	if err := client.netlink.SetLinkNetNs(client.containerIfName, nsID); err != nil {
+		return newErrorIPVlanEndpointClient(err)
+	}
+	client.movedToContainerNS = true
+
+	return nil
+}
+
+func (client *IPVlanEndpointClient) SetupContainerInterfaces(epInfo *EndpointInfo) error {
+	if err := client.netUtilsClient.SetupContainerInterface(client.containerIfName, epInfo.IfName); err != nil {
+		return newErrorIPVlanEndpointClient(err)
+	}
+
+	client.containerIfName = epInfo.IfName
+
+	return nil
+}
+
+func (client *IPVlanEndpointClient) ConfigureContainerInterfacesAndRoutes(epInfo *EndpointInfo) error {
+	if err := client.netUtilsClient.AssignIPToInterface(client.containerIfName, epInfo.IPAddresses); err != nil {
+		return newErrorIPVlanEndpointClient(err)
+	}
+
+	if epInfo.SkipDefaultRoutes {
+		if err := addRoutes(client.netlink, client.netioshim, client.containerIfName, epInfo.Routes); err != nil {
+			return newErrorIPVlanEndpointClient(err)
+		}
+		return nil
+	}
+
+	// ipvlan slaves share the master's mac and neighbours, so the default route points at the device
+	// rather than a gateway
+	// ip route add default dev eth0
+	var routes []RouteInfo
+	hasV4, hasV6 := false, false
+	for _, ipAddr := range epInfo.IPAddresses {
+		if ipAddr.IP.To4() != nil && !hasV4 {
+			hasV4 = true
+			routes = append(routes, RouteInfo{
+				Dst:   net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, ipv4Bits)},
+				Scope: netlink.RT_SCOPE_LINK,
+			})
+		} else if ipAddr.IP.To4() == nil && !hasV6 {
+			hasV6 = true
+			routes = append(routes, RouteInfo{
+				Dst:   net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, ipv6Bits)},
+				Scope: netlink.RT_SCOPE_LINK,
+			})
+		}
+	}
+
+	if err := addRoutes(client.netlink, client.netioshim, client.containerIfName, routes); err != nil {
+		return newErrorIPVlanEndpointClient(err)
+	}
+
+	return nil
+}
+
+// DeleteEndpoints removes the host routes to the pod and the ipvlan slave if it never left the host
+// netns. Once moved, the slave is deleted together with the container netns.
+func (client *IPVlanEndpointClient) DeleteEndpoints(ep *endpoint) error {
+	if ep != nil {
+		if err := deleteRoutes(client.netlink, client.netioshim, ipvlanHostIfName, client.podRoutes(ep.IPAddresses)); err != nil {
+			logger.Error("Failed to delete host routes to the pod", zap.Error(err))
+		}
+	}
+
+	if client.containerIfName == "" || client.movedToContainerNS {
+		return nil
+	}
+
+	if _, err := client.netioshim.GetNetworkInterfaceByName(client.containerIfName); err != nil {
+		return nil
+	}
+
+	logger.Info("Deleting ipvlan interface", zap.String("containerIfName", client.containerIfName))
+	if err := client.netlink.DeleteLink(client.containerIfName); err != nil {
+		return newErrorIPVlanEndpointClient(err)
+	}
+
+	return nil
+}
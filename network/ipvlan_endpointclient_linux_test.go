@@ -0,0 +1,306 @@
+//go:build linux
+// +build linux
+
+package network
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/netio"
+	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/network/networkutils"
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingNetlink records the links and addresses changed through the mock netlink
+type recordingNetlink struct {
+	*netlink.MockNetlink
+	links     []netlink.Link
+	addresses map[string][]string
+	removed   map[string][]string
+	up        []string
+	deleted   []string
+	// setLinkStateErr fails SetLinkState
+	setLinkStateErr error
+}
+
+func newRecordingNetlink() *recordingNetlink {
+	return &recordingNetlink{MockNetlink: netlink.NewMockNetlink(false, ""), addresses: map[string][]string{}, removed: map[string][]string{}}
+}
+
+func (nl *recordingNetlink) AddLink(link netlink.Link) error {
+	nl.links = append(nl.links, link)
+	return nil
+}
+
+func (nl *recordingNetlink) DeleteLink(name string) error {
+	nl.deleted = append(nl.deleted, name)
+	return nil
+}
+
+func (nl *recordingNetlink) AddIPAddress(ifName string, _ net.IP, ipNet *net.IPNet) error {
+	nl.addresses[ifName] = append(nl.addresses[ifName], ipNet.String())
+	return nil
+}
+
+func (nl *recordingNetlink) DeleteIPAddress(ifName string, _ net.IP, ipNet *net.IPNet) error {
+	nl.removed[ifName] = append(nl.removed[ifName], ipNet.String())
+	return nil
+}
+
+func (nl *recordingNetlink) SetLinkState(ifName string, up bool) error {
+	if nl.setLinkStateErr != nil {
+		return nl.setLinkStateErr
+	}
+	if up {
+		nl.up = append(nl.up, ifName)
+	}
+	return nil
+}
+
+// addrsNetIO returns the addresses of every interface
+type addrsNetIO struct {
+	*netio.MockNetIO
+	addrs []net.Addr
+}
+
+func (nio *addrsNetIO) GetNetworkInterfaceAddrs(*net.Interface) ([]net.Addr, error) {
+	return nio.addrs, nil
+}
+
+func newTestIPVlanEndpointClient(nl netlink.NetlinkInterface, nio netio.NetIOInterface) *IPVlanEndpointClient {
+	plc := platform.NewMockExecClient(false)
+	return &IPVlanEndpointClient{
+		hostPrimaryIfName: "eth0",
+		hostIPAddresses: []*net.IPNet{
+			{IP: net.ParseIP("10.0.0.1"), Mask: net.CIDRMask(subnetv4Mask, ipv4Bits)},
+		},
+		containerIfName: "azvcontainer",
+		netlink:         nl,
+		netioshim:       nio,
+		plClient:        plc,
+		netUtilsClient:  networkutils.NewNetworkUtils(nl, plc),
+	}
+}
+
+func TestIPVlanAddEndpoints(t *testing.T) {
+	tests := []struct {
+		name       string
+		client     *IPVlanEndpointClient
+		wantErr    bool
+		wantErrMsg string
+	}{
+		{
+			name:    "Add endpoints",
+			client:  newTestIPVlanEndpointClient(netlink.NewMockNetlink(false, ""), netio.NewMockNetIO(false, 0)),
+			wantErr: false,
+		},
+		{
+			name:       "Add endpoints netlink fail",
+			client:     newTestIPVlanEndpointClient(netlink.NewMockNetlink(true, "netlink fail"), netio.NewMockNetIO(false, 0)),
+			wantErr:    true,
+			wantErrMsg: "IPVlanEndpointClient Error: " + netlink.ErrorMockNetlink.Error() + " : netlink fail",
+		},
+		{
+			name:    "Add endpoints no stale interface",
+			client:  newTestIPVlanEndpointClient(netlink.NewMockNetlink(false, ""), netio.NewMockNetIO(true, 1)),
+			wantErr: false,
+		},
+		{
+			name:       "Add endpoints get interface fail for primary interface",
+			client:     newTestIPVlanEndpointClient(netlink.NewMockNetlink(false, ""), netio.NewMockNetIO(true, 2)),
+			wantErr:    true,
+			wantErrMsg: "IPVlanEndpointClient Error: " + netio.ErrMockNetIOFail.Error() + ":eth0",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.client.AddEndpoints(&EndpointInfo{})
+			if tt.wantErr {
+				require.Error(t, err)
+				require.Contains(t, tt.wantErrMsg, err.Error(), "Expected:%v actual:%v", tt.wantErrMsg, err.Error())
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestIPVlanConfigureContainerInterfacesAndRoutes(t *testing.T) {
+	nl := netlink.NewMockNetlink(false, "")
+	var routes []string
+	nl.SetAddRouteValidationFn(func(r *netlink.Route) error {
+		routes = append(routes, r.Dst.String())
+		require.Equal(t, netlink.RT_SCOPE_LINK, r.Scope)
+		require.Nil(t, r.Gw)
+		return nil
+	})
+	client := newTestIPVlanEndpointClient(nl, netio.NewMockNetIO(false, 0))
+	client.containerIfName = "eth0"
+
+	err := client.ConfigureContainerInterfacesAndRoutes(&EndpointInfo{
+		IPAddresses: []net.IPNet{
+			{IP: net.ParseIP("10.0.0.4"), Mask: net.CIDRMask(subnetv4Mask, ipv4Bits)},
+			{IP: net.ParseIP("10.0.0.5"), Mask: net.CIDRMask(subnetv4Mask, ipv4Bits)},
+			{IP: net.ParseIP("fd00::4"), Mask: net.CIDRMask(subnetv6Mask, ipv6Bits)},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"0.0.0.0/0", "::/0"}, routes)
+}
+
+func TestIPVlanDeleteEndpoints(t *testing.T) {
+	// interface still in the host netns is deleted
+	client := newTestIPVlanEndpointClient(netlink.NewMockNetlink(true, "netlink fail"), netio.NewMockNetIO(false, 0))
+	require.Error(t, client.DeleteEndpoints(&endpoint{}))
+
+	// interface moved to the container netns is left to the netns teardown
+	client.movedToContainerNS = true
+	require.NoError(t, client.DeleteEndpoints(&endpoint{}))
+
+	// clients created on DEL have no container interface
+	client = newTestIPVlanEndpointClient(netlink.NewMockNetlink(true, "netlink fail"), netio.NewMockNetIO(false, 0))
+	client.containerIfName = ""
+	require.NoError(t, client.DeleteEndpoints(&endpoint{}))
+}
+
+func TestIPVlanAddEndpointsCreatesHostInterface(t *testing.T) {
+	nl := newRecordingNetlink()
+	nio := netio.NewMockNetIO(false, 0)
+	// only the master exists, neither a stale container interface nor the host slave
+	nio.SetGetInterfaceValidatonFn(func(name string) (*net.Interface, error) {
+		if name != "eth0" {
+			return nil, netio.ErrMockNetIOFail
+		}
+		return &net.Interface{Name: name, MTU: 1500, Index: 2}, nil
+	})
+	client := newTestIPVlanEndpointClient(nl, nio)
+
+	require.NoError(t, client.AddEndpoints(&EndpointInfo{}))
+	require.Len(t, nl.links, 2)
+	for i, name := range []string{"azvcontainer", ipvlanHostIfName} {
+		link, ok := nl.links[i].(*netlink.IPVlanLink)
+		require.True(t, ok)
+		require.Equal(t, name, link.Name)
+		require.Equal(t, 2, link.ParentIndex)
+		require.Equal(t, netlink.IPVLAN_MODE_L3S, link.Mode)
+	}
+	require.Empty(t, nl.addresses[ipvlanHostIfName])
+	require.Equal(t, []string{ipvlanHostIfName}, nl.up)
+
+	// the host slave is shared by all endpoints and created once
+	nl.links = nil
+	nl.up = nil
+	nio.SetGetInterfaceValidatonFn(func(name string) (*net.Interface, error) {
+		if name == "azvcontainer" {
+			return nil, netio.ErrMockNetIOFail
+		}
+		return &net.Interface{Name: name, MTU: 1500, Index: 2, Flags: net.FlagUp}, nil
+	})
+	require.NoError(t, client.AddEndpoints(&EndpointInfo{}))
+	require.Len(t, nl.links, 1)
+	require.Equal(t, "azvcontainer", nl.links[0].(*netlink.IPVlanLink).Name)
+	require.Empty(t, nl.up)
+}
+
+func TestIPVlanAddEndpointsRepairsHostInterface(t *testing.T) {
+	nl := newRecordingNetlink()
+	// the host slave was left down by a failed ADD, and given the host's address by an older version
+	nio := &addrsNetIO{
+		MockNetIO: netio.NewMockNetIO(false, 0),
+		addrs:     []net.Addr{&net.IPNet{IP: net.ParseIP("10.0.0.1"), Mask: net.CIDRMask(ipv4Bits, ipv4Bits)}},
+	}
+	nio.SetGetInterfaceValidatonFn(func(name string) (*net.Interface, error) {
+		if name == "azvcontainer" {
+			return nil, netio.ErrMockNetIOFail
+		}
+		return &net.Interface{Name: name, MTU: 1500, Index: 2}, nil
+	})
+	client := newTestIPVlanEndpointClient(nl, nio)
+
+	require.NoError(t, client.AddEndpoints(&EndpointInfo{}))
+	require.Len(t, nl.links, 1)
+	require.Empty(t, nl.addresses[ipvlanHostIfName])
+	require.Equal(t, []string{"10.0.0.1/32"}, nl.removed[ipvlanHostIfName])
+	require.Equal(t, []string{ipvlanHostIfName}, nl.up)
+}
+
+func TestIPVlanAddEndpointsDeletesHalfConfiguredHostInterface(t *testing.T) {
+	nl := newRecordingNetlink()
+	nl.setLinkStateErr = netlink.ErrorMockNetlink
+	nio := netio.NewMockNetIO(false, 0)
+	nio.SetGetInterfaceValidatonFn(func(name string) (*net.Interface, error) {
+		if name != "eth0" {
+			return nil, netio.ErrMockNetIOFail
+		}
+		return &net.Interface{Name: name, MTU: 1500, Index: 2}, nil
+	})
+	client := newTestIPVlanEndpointClient(nl, nio)
+
+	require.ErrorIs(t, client.AddEndpoints(&EndpointInfo{}), netlink.ErrorMockNetlink)
+	require.Equal(t, []string{ipvlanHostIfName}, nl.deleted)
+}
+
+func TestIPVlanPodRoutes(t *testing.T) {
+	ipAddresses := []net.IPNet{
+		{IP: net.ParseIP("10.0.0.4"), Mask: net.CIDRMask(subnetv4Mask, ipv4Bits)},
+		{IP: net.ParseIP("fd00::4"), Mask: net.CIDRMask(subnetv6Mask, ipv6Bits)},
+	}
+
+	nl := netlink.NewMockNetlink(false, "")
+	var added []string
+	nl.SetAddRouteValidationFn(func(r *netlink.Route) error {
+		require.Equal(t, 2, r.LinkIndex)
+		require.Equal(t, netlink.RT_SCOPE_LINK, r.Scope)
+		added = append(added, r.Dst.String()+" src "+r.Src.String())
+		return nil
+	})
+	var deleted []string
+	nl.SetDeleteRouteValidationFn(func(r *netlink.Route) error {
+		deleted = append(deleted, r.Dst.String())
+		return nil
+	})
+	client := newTestIPVlanEndpointClient(nl, netio.NewMockNetIO(false, 0))
+	client.hostIPAddresses = append(client.hostIPAddresses, &net.IPNet{IP: net.ParseIP("fd00::1"), Mask: net.CIDRMask(subnetv6Mask, ipv6Bits)})
+
+	// the host slave has no address, so the routes carry the host's address of the family as source
+	require.NoError(t, client.AddEndpointRules(&EndpointInfo{IPAddresses: ipAddresses}))
+	require.Equal(t, []string{"10.0.0.4/32 src 10.0.0.1", "fd00::4/128 src fd00::1"}, added)
+
+	// routes are removed on DEL even though the pod interface left with the container netns
+	client = newTestIPVlanEndpointClient(nl, netio.NewMockNetIO(false, 0))
+	client.containerIfName = ""
+	require.NoError(t, client.DeleteEndpoints(&endpoint{IPAddresses: ipAddresses}))
+	require.Equal(t, []string{"10.0.0.4/32", "fd00::4/128"}, deleted)
+}
+
+func TestIPVlanHostTrafficEntersOnMaster(t *testing.T) {
+	// in L3S mode the master hands packets to an address of a slave to that slave, so host bound traffic
+	// only keeps entering on the master while no slave carries one of the host's addresses
+	nl := newRecordingNetlink()
+	nio := &addrsNetIO{MockNetIO: netio.NewMockNetIO(false, 0)}
+	nio.SetGetInterfaceValidatonFn(func(name string) (*net.Interface, error) {
+		if name == "azvcontainer" {
+			return nil, netio.ErrMockNetIOFail
+		}
+		return &net.Interface{Name: name, MTU: 1500, Index: 2}, nil
+	})
+	client := newTestIPVlanEndpointClient(nl, nio)
+	epInfo := &EndpointInfo{IPAddresses: []net.IPNet{{IP: net.ParseIP("10.0.0.4"), Mask: net.CIDRMask(subnetv4Mask, ipv4Bits)}}}
+
+	require.NoError(t, client.AddEndpoints(epInfo))
+	require.NoError(t, client.AddEndpointRules(epInfo))
+	for ifName, addresses := range nl.addresses {
+		for _, hostIP := range client.hostIPAddresses {
+			for _, address := range addresses {
+				ip, _, err := net.ParseCIDR(address)
+				require.NoError(t, err)
+				require.False(t, ip.Equal(hostIP.IP), "host address %s is on %s", hostIP.IP, ifName)
+			}
+		}
+	}
+}
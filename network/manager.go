@@ -6,6 +6,7 @@ package network
 import (
 	"context"
 	"net"
+	"sort"
 	"sync"
 	"time"
 
@@ -19,6 +20,7 @@ import (
 	"github.com/Azure/azure-container-networking/netlink"
 	"github.com/Azure/azure-container-networking/platform"
 	"github.com/Azure/azure-container-networking/store"
+	"github.com/Azure/azure-container-networking/telemetry"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
@@ -31,6 +33,7 @@ const (
 	SNATIPKey            = "NCPrimaryIPKey"
 	RoutesKey            = "RoutesKey"
 	IPTablesKey          = "IPTablesKey"
+	NftablesSnatKey      = "NftablesSnatKey"
 	genericData          = "com.docker.network.generic"
 	ipv6AddressMask      = 128
 	cnsBaseURL           = "" // fallback to default http://localhost:10090
@@ -88,9 +91,13 @@ type networkManager struct {
 	nsClient           NamespaceClientInterface
 	iptablesClient     ipTablesClient
 	dhcpClient         dhcpClient
+	phaseTimer         PhaseTimer
 	sync.Mutex
 }
 
+// PhaseTimer starts timing the named phase of a CNI operation and returns a func which stops it
+type PhaseTimer func(phase string) func(err error)
+
 // NetworkManager API.
 type NetworkManager interface {
 	Initialize(config *common.PluginConfig, isRehydrationRequired bool) error
@@ -101,6 +108,8 @@ type NetworkManager interface {
 	CreateNetwork(nwInfo *EndpointInfo) error
 	DeleteNetwork(networkID string) error
 	GetNetworkInfo(networkID string) (EndpointInfo, error)
+	// GetNetworkIDs returns the sorted ids of the networks on all external interfaces
+	GetNetworkIDs() []string
 	// FindNetworkIDFromNetNs returns the network name that contains an endpoint created for this netNS, errNetworkNotFound if no network is found
 	FindNetworkIDFromNetNs(netNs string) (string, error)
 	GetNumEndpointsByContainerID(containerID string) int
@@ -122,6 +131,7 @@ type NetworkManager interface {
 	GetEndpointInfosFromContainerID(containerID string) []*EndpointInfo
 	GetEndpointState(networkID, containerID, netns string) ([]*EndpointInfo, error)
 	GetEndpointIDByNicType(containerID, ifName string, nicType cns.NICType) string
+	SetPhaseTimer(timer PhaseTimer)
 }
 
 // Creates a new network manager.
@@ -157,6 +167,18 @@ func (nm *networkManager) Initialize(config *common.PluginConfig, isRehydrationR
 	return err
 }
 
+// SetPhaseTimer sets the timer used to report how long endpoint setup and state saves take.
+func (nm *networkManager) SetPhaseTimer(timer PhaseTimer) {
+	nm.phaseTimer = timer
+}
+
+func (nm *networkManager) startPhase(phase string) func(err error) {
+	if nm.phaseTimer == nil {
+		return func(error) {}
+	}
+	return nm.phaseTimer(phase)
+}
+
 // Uninitialize cleans up network manager.
 func (nm *networkManager) Uninitialize() {
 }
@@ -288,7 +310,9 @@ func (nm *networkManager) save() error {
 	// Update time stamp.
 	nm.TimeStamp = time.Now()
 
+	stopPhase := nm.startPhase(telemetry.PhaseStateSave)
 	err := nm.store.Write(storeKey, nm)
+	stopPhase(err)
 	if err == nil {
 		logger.Info("Save succeeded")
 	} else {
@@ -347,6 +371,22 @@ func (nm *networkManager) DeleteNetwork(networkID string) error {
 	return nil
 }
 
+// GetNetworkIDs returns the sorted ids of the networks on all external interfaces.
+func (nm *networkManager) GetNetworkIDs() []string {
+	nm.Lock()
+	defer nm.Unlock()
+
+	var networkIDs []string
+	for _, extIf := range nm.ExternalInterfaces {
+		for networkID := range extIf.Networks {
+			networkIDs = append(networkIDs, networkID)
+		}
+	}
+	sort.Strings(networkIDs)
+
+	return networkIDs
+}
+
 // GetNetworkInfo returns information about the given network.
 func (nm *networkManager) GetNetworkInfo(networkID string) (EndpointInfo, error) {
 	nm.Lock()
@@ -504,7 +544,9 @@ func (nm *networkManager) DeleteEndpoint(networkID, endpointID string, epInfo *E
 		return err
 	}
 
+	stopPhase := nm.startPhase(telemetry.PhaseNetNS)
 	err = nw.deleteEndpoint(nm.netlink, nm.plClient, nm.netio, nm.nsClient, nm.iptablesClient, nm.dhcpClient, endpointID, mode)
+	stopPhase(err)
 	if err != nil {
 		return err
 	}
@@ -1,6 +1,8 @@
 package network
 
 import (
+	"sort"
+
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/common"
 )
@@ -132,6 +134,16 @@ func (nm *MockNetworkManager) GetNumberOfEndpoints(ifName string, networkID stri
 	return 0
 }
 
+// GetNetworkIDs mock
+func (nm *MockNetworkManager) GetNetworkIDs() []string {
+	networkIDs := make([]string, 0, len(nm.TestNetworkInfoMap))
+	for networkID := range nm.TestNetworkInfoMap {
+		networkIDs = append(networkIDs, networkID)
+	}
+	sort.Strings(networkIDs)
+	return networkIDs
+}
+
 func (nm *MockNetworkManager) FindNetworkIDFromNetNs(netNs string) (string, error) {
 	// based on the GetAllEndpoints func above, it seems that this mock is only intended to be used with
 	// one network, so just return the network here if it exists
@@ -221,3 +233,5 @@ func (nm *MockNetworkManager) GetEndpointIDByNicType(containerID, ifName string,
 	// For InfraNIC, use GetEndpointID() logic.
 	return nm.GetEndpointID(containerID, ifName)
 }
+
+func (nm *MockNetworkManager) SetPhaseTimer(PhaseTimer) {}
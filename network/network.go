@@ -11,6 +11,7 @@ import (
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/network/policy"
 	"github.com/Azure/azure-container-networking/platform"
+	"github.com/Azure/azure-container-networking/telemetry"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
@@ -21,6 +22,7 @@ const (
 	opModeTunnel          = "tunnel"
 	opModeTransparent     = "transparent"
 	opModeTransparentVlan = "transparent-vlan"
+	opModeIPVlan          = "ipvlan"
 	opModeDefault         = opModeTunnel
 )
 
@@ -337,7 +339,9 @@ func (nm *networkManager) EndpointCreate(cnsclient apipaClient, epInfos []*Endpo
 				return err
 			}
 		}
+		stopPhase := nm.startPhase(telemetry.PhaseNetNS)
 		ep, err := nm.createEndpoint(cnsclient, epInfo.NetworkID, epInfo)
+		stopPhase(err)
 		if err != nil {
 			return err
 		}
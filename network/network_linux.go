@@ -14,6 +14,7 @@ import (
 	"github.com/Azure/azure-container-networking/netio"
 	"github.com/Azure/azure-container-networking/netlink"
 	"github.com/Azure/azure-container-networking/network/networkutils"
+	"github.com/Azure/azure-container-networking/nftables"
 	"github.com/Azure/azure-container-networking/ovsctl"
 	"github.com/Azure/azure-container-networking/platform"
 	"github.com/pkg/errors"
@@ -91,6 +92,9 @@ func (nm *networkManager) newNetworkImpl(nwInfo *EndpointInfo, extIf *externalIn
 				return nil, fmt.Errorf("Ipv6 forwarding failed: %w", err)
 			}
 		}
+	case opModeIPVlan:
+		logger.Info("IPVlan mode")
+		ifName = extIf.Name
 	case opModeTransparentVlan:
 		logger.Info("Transparent vlan mode")
 		ifName = extIf.Name
@@ -137,13 +141,21 @@ func (nm *networkManager) handleCommonOptions(ifName string, nwInfo *EndpointInf
 		}
 	}
 
-	if iptcmds, exists := nwInfo.Options[IPTablesKey]; exists {
-		err = nm.addToIptables(iptcmds.([]iptables.IPTableEntry))
+	if chainRules, exists := nwInfo.Options[IPTablesKey]; exists {
+		err = nm.addToIptables(chainRules.(iptables.ChainRules))
 		if err != nil {
 			return err
 		}
 	}
 
+	if snatEndpoint, exists := nwInfo.Options[NftablesSnatKey]; exists {
+		logger.Info("Adding nftables snat endpoint", zap.Any("endpoint", snatEndpoint))
+		err = nftables.NewClient().AddSnatEndpoint(snatEndpoint.(nftables.SnatEndpoint))
+		if err != nil {
+			return errors.Wrap(err, "failed to add nftables snat endpoint")
+		}
+	}
+
 	return nil
 }
 
@@ -159,6 +171,12 @@ func (nm *networkManager) deleteNetworkImpl(nw *network, _ cns.NICType) error {
 
 	// Disconnect the interface if this was the last network using it.
 	if len(nw.extIf.Networks) == 1 {
+		if nw.Mode == opModeIPVlan {
+			logger.Info("Deleting host ipvlan interface", zap.String("hostIfName", ipvlanHostIfName))
+			if err := nm.netlink.DeleteLink(ipvlanHostIfName); err != nil {
+				logger.Error("Failed to delete host ipvlan interface", zap.Error(err))
+			}
+		}
 		nm.disconnectExternalInterface(nw.extIf, networkClient)
 	}
 
@@ -613,7 +631,10 @@ func (nm *networkManager) connectExternalInterface(extIf *externalInterface, nwI
 
 		// unmark packet if set by kube-proxy to skip kube-postrouting rule and processed
 		// by cni snat rule
-		if err = nm.iptablesClient.InsertIptableRule(iptables.V6, iptables.Mangle, iptables.Postrouting, "", "MARK --set-mark 0x0"); err != nil {
+		err = nm.iptablesClient.NewTransaction(iptables.V6).
+			InsertIptableRule(iptables.Mangle, iptables.Postrouting, "", "MARK --set-mark 0x0").
+			Commit()
+		if err != nil {
 			logger.Error("Adding Iptable mangle rule failed", zap.Error(err))
 			return err
 		}
@@ -651,15 +672,13 @@ func (nm *networkManager) disconnectExternalInterface(extIf *externalInterface,
 	logger.Info("Disconnected interface", zap.String("Name", extIf.Name))
 }
 
-func (nm *networkManager) addToIptables(cmds []iptables.IPTableEntry) error {
-	logger.Info("Adding additional iptable rules...")
-	for _, cmd := range cmds {
-		err := nm.iptablesClient.RunCmd(cmd.Version, cmd.Params)
-		if err != nil {
-			return err
-		}
-		logger.Info("Successfully run iptables rule", zap.Any("cmd", cmd))
+func (nm *networkManager) addToIptables(chainRules iptables.ChainRules) error {
+	logger.Info("Adding additional iptable rules...", zap.Any("chainRules", chainRules))
+	err := nm.iptablesClient.NewTransaction(iptables.V4).EnsureChainRules(chainRules).Commit()
+	if err != nil {
+		return errors.Wrap(err, "failed to add additional iptable rules")
 	}
+	logger.Info("Successfully added iptables rules", zap.String("chain", chainRules.Chain))
 	return nil
 }
 
@@ -706,6 +725,14 @@ func (nm *networkManager) addIpv6SnatRule(extIf *externalInterface, nwInfo *Endp
 			continue
 		}
 		logger.Info("Adding ipv6 snat rule")
+		if nwInfo.HostRulesBackend == nftables.BackendNftables {
+			if err := nftables.NewClient().AddSubnetSnat(ipv6SubnetPrefix, ipAddr.IP); err != nil {
+				return fmt.Errorf("adding nftables snat rule failed:%w", err)
+			}
+			ipv6SnatRuleSet = true
+			continue
+		}
+
 		matchSrcPrefix := fmt.Sprintf("-s %s", ipv6SubnetPrefix.String())
 		nu := networkutils.NewNetworkUtils(nm.netlink, nm.plClient)
 		if err := nu.AddSnatRule(nm.iptablesClient, matchSrcPrefix, ipAddr.IP); err != nil {
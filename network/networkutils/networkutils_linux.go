@@ -41,9 +41,7 @@ const (
 var logger = log.CNILogger.With(zap.String("component", "net-utils"))
 
 type ipTablesClient interface {
-	InsertIptableRule(version, tableName, chainName, match, target string) error
-	AppendIptableRule(version, tableName, chainName, match, target string) error
-	DeleteIptableRule(version, tableName, chainName, match, target string) error
+	NewTransaction(version string) *iptables.Transaction
 }
 
 var errorNetworkUtils = errors.New("NetworkUtils Error")
@@ -132,8 +130,7 @@ func (nu NetworkUtils) AssignIPToInterface(interfaceName string, ipAddresses []n
 	return nil
 }
 
-func (nu NetworkUtils) addOrDeleteFilterRule(iptablesClient ipTablesClient, bridgeName, action, ipAddress, chainName, target string) error {
-	var err error
+func (nu NetworkUtils) addOrDeleteFilterRule(tx *iptables.Transaction, bridgeName, action, ipAddress, chainName, target string) {
 	option := "i"
 
 	if chainName == iptables.Output {
@@ -144,14 +141,12 @@ func (nu NetworkUtils) addOrDeleteFilterRule(iptablesClient ipTablesClient, brid
 
 	switch action {
 	case iptables.Insert:
-		err = iptablesClient.InsertIptableRule(iptables.V4, iptables.Filter, chainName, matchCondition, target)
+		tx.InsertIptableRule(iptables.Filter, chainName, matchCondition, target)
 	case iptables.Append:
-		err = iptablesClient.AppendIptableRule(iptables.V4, iptables.Filter, chainName, matchCondition, target)
+		tx.AppendIptableRule(iptables.Filter, chainName, matchCondition, target)
 	case iptables.Delete:
-		err = iptablesClient.DeleteIptableRule(iptables.V4, iptables.Filter, chainName, matchCondition, target)
+		tx.DeleteIptableRule(iptables.Filter, chainName, matchCondition, target)
 	}
-
-	return err
 }
 
 func (nu NetworkUtils) AllowIPAddresses(iptablesClient ipTablesClient, bridgeName string, skipAddresses []string, action string) error {
@@ -160,52 +155,40 @@ func (nu NetworkUtils) AllowIPAddresses(iptablesClient ipTablesClient, bridgeNam
 
 	logger.Info("Addresses to allow", zap.Any("skipAddresses", skipAddresses))
 
+	tx := iptablesClient.NewTransaction(iptables.V4)
 	for _, address := range skipAddresses {
-		if err := nu.addOrDeleteFilterRule(iptablesClient, bridgeName, action, address, chains[0], target[0]); err != nil {
-			return err
-		}
-
-		if err := nu.addOrDeleteFilterRule(iptablesClient, bridgeName, action, address, chains[1], target[0]); err != nil {
-			return err
-		}
-
-		if err := nu.addOrDeleteFilterRule(iptablesClient, bridgeName, action, address, chains[2], target[0]); err != nil {
-			return err
+		for _, chain := range chains {
+			nu.addOrDeleteFilterRule(tx, bridgeName, action, address, chain, target[0])
 		}
-
 	}
 
-	return nil
+	return errors.Wrap(tx.Commit(), "failed to allow ip addresses")
 }
 
 func (nu NetworkUtils) BlockEgressTrafficFromContainer(iptablesClient ipTablesClient, version, ipAddress, protocol string, port int) error {
 	// iptables -t filter -I FORWARD -j DROP -d <ip> -p <protocol> -m <protocol> --dport <port>
 	dropTraffic := fmt.Sprintf("-d %s -p %s -m %s --dport %d", ipAddress, protocol, protocol, port)
-	return errors.Wrap(iptablesClient.InsertIptableRule(version, iptables.Filter, iptables.Forward, dropTraffic, iptables.Drop), "iptables block traffic failed")
+	err := iptablesClient.NewTransaction(version).
+		InsertIptableRule(iptables.Filter, iptables.Forward, dropTraffic, iptables.Drop).
+		Commit()
+	return errors.Wrap(err, "iptables block traffic failed")
 }
 
 func (nu NetworkUtils) BlockIPAddresses(iptablesClient ipTablesClient, bridgeName, action string) error {
-	privateIPAddresses := getPrivateIPSpace()
+	privateIPAddresses := PrivateIPSpace()
 	chains := getFilterChains()
 	target := getFilterchainTarget()
 
 	logger.Info("Addresses to block", zap.Any("privateIPAddresses", privateIPAddresses))
 
+	tx := iptablesClient.NewTransaction(iptables.V4)
 	for _, ipAddress := range privateIPAddresses {
-		if err := nu.addOrDeleteFilterRule(iptablesClient, bridgeName, action, ipAddress, chains[0], target[1]); err != nil {
-			return err
-		}
-
-		if err := nu.addOrDeleteFilterRule(iptablesClient, bridgeName, action, ipAddress, chains[1], target[1]); err != nil {
-			return err
-		}
-
-		if err := nu.addOrDeleteFilterRule(iptablesClient, bridgeName, action, ipAddress, chains[2], target[1]); err != nil {
-			return err
+		for _, chain := range chains {
+			nu.addOrDeleteFilterRule(tx, bridgeName, action, ipAddress, chain, target[1])
 		}
 	}
 
-	return nil
+	return errors.Wrap(tx.Commit(), "failed to block ip addresses")
 }
 
 func (nu NetworkUtils) EnableIPV4Forwarding() error {
@@ -249,7 +232,10 @@ func (nu NetworkUtils) AddSnatRule(iptablesClient ipTablesClient, match string,
 	}
 
 	target := fmt.Sprintf("SNAT --to %s", ip.String())
-	return errors.Wrap(iptablesClient.InsertIptableRule(version, iptables.Nat, iptables.Postrouting, match, target), "failed to add snat rule")
+	err := iptablesClient.NewTransaction(version).
+		InsertIptableRule(iptables.Nat, iptables.Postrouting, match, target).
+		Commit()
+	return errors.Wrap(err, "failed to add snat rule")
 }
 
 func (nu NetworkUtils) DisableRAForInterface(ifName string) error {
@@ -275,7 +261,8 @@ func (nu NetworkUtils) SetProxyArp(ifName string) error {
 	return errors.Wrapf(err, "failed to set proxy arp for interface %v", ifName)
 }
 
-func getPrivateIPSpace() []string {
+// PrivateIPSpace returns the private and link local ranges blocked through the snat bridge
+func PrivateIPSpace() []string {
 	privateIPAddresses := []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16"}
 	return privateIPAddresses
 }
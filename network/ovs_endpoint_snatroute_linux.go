@@ -30,6 +30,7 @@ func (client *OVSEndpointClient) NewSnatClient(snatBridgeIP, localIP string, epI
 			client.hostPrimaryMac,
 			epInfo.EndpointDNS.Servers,
 			false,
+			epInfo.HostRulesBackend,
 			client.netlink,
 			client.plClient,
 			client.iptablesClient,
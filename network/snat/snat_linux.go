@@ -14,6 +14,7 @@ import (
 	"github.com/Azure/azure-container-networking/netio"
 	"github.com/Azure/azure-container-networking/netlink"
 	"github.com/Azure/azure-container-networking/network/networkutils"
+	"github.com/Azure/azure-container-networking/nftables"
 	"github.com/Azure/azure-container-networking/platform"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
@@ -33,10 +34,16 @@ const (
 var logger = log.CNILogger.With(zap.String("component", "net"))
 
 type ipTablesClient interface {
-	InsertIptableRule(version, tableName, chainName, match, target string) error
-	AppendIptableRule(version, tableName, chainName, match, target string) error
-	DeleteIptableRule(version, tableName, chainName, match, target string) error
-	CreateChain(version, tableName, chainName string) error
+	NewTransaction(version string) *iptables.Transaction
+}
+
+// nftablesClient programs the snat bridge rules when the nftables host rules backend is selected
+type nftablesClient interface {
+	AddSnatBridge(bridge nftables.SnatBridge) error
+	AllowHostToNC(hostIP, ncIP net.IP) error
+	DeleteHostToNC(hostIP, ncIP net.IP) error
+	AllowNCToHost(ncIP, hostIP net.IP) error
+	DeleteNCToHost(ncIP, hostIP net.IP) error
 }
 
 var errorSnatClient = errors.New("SnatClient Error")
@@ -56,6 +63,7 @@ type Client struct {
 	netlink                netlink.NetlinkInterface
 	plClient               platform.ExecClient
 	ipTablesClient         ipTablesClient
+	nftablesClient         nftablesClient
 	netioClient            netio.NetIOInterface
 }
 
@@ -66,6 +74,7 @@ func NewSnatClient(hostIfName string,
 	hostPrimaryMac string,
 	skipAddressesFromBlock []string,
 	enableProxyArpOnBridge bool,
+	hostRulesBackend string,
 	nl netlink.NetlinkInterface,
 	plClient platform.ExecClient,
 	iptc ipTablesClient,
@@ -85,6 +94,9 @@ func NewSnatClient(hostIfName string,
 	}
 
 	snatClient.SkipAddressesFromBlock = append(snatClient.SkipAddressesFromBlock, skipAddressesFromBlock...)
+	if hostRulesBackend == nftables.BackendNftables {
+		snatClient.nftablesClient = nftables.NewClient()
+	}
 
 	logger.Info("Initialize new snat client", zap.Any("snatClient", snatClient))
 	return snatClient
@@ -134,6 +146,10 @@ func (client *Client) CreateSnatEndpoint() error {
 
 // AllowIPAddressesOnSnatBridge adds iptables rules  that allows only specific Private IPs via linux bridge
 func (client *Client) AllowIPAddressesOnSnatBridge() error {
+	if client.nftablesClient != nil {
+		return client.addSnatBridgeNftables(parseSubnets(client.SkipAddressesFromBlock), nil)
+	}
+
 	nu := networkutils.NewNetworkUtils(client.netlink, client.plClient)
 	if err := nu.AllowIPAddresses(client.ipTablesClient, SnatBridgeName, client.SkipAddressesFromBlock, iptables.Insert); err != nil {
 		logger.Error("AllowIPAddresses failed with", zap.Error(err))
@@ -145,6 +161,10 @@ func (client *Client) AllowIPAddressesOnSnatBridge() error {
 
 // BlockIPAddressesOnSnatBridge adds iptables rules  that blocks all private IPs flowing via linux bridge
 func (client *Client) BlockIPAddressesOnSnatBridge() error {
+	if client.nftablesClient != nil {
+		return client.addSnatBridgeNftables(nil, parseSubnets(networkutils.PrivateIPSpace()))
+	}
+
 	nu := networkutils.NewNetworkUtils(client.netlink, client.plClient)
 	if err := nu.BlockIPAddresses(client.ipTablesClient, SnatBridgeName, iptables.Append); err != nil {
 		logger.Error("AllowIPAddresses failed with", zap.Error(err))
@@ -177,6 +197,50 @@ func (client *Client) SetupSnatContainerInterface() error {
 	return nil
 }
 
+// addSnatBridgeNftables programs the snat bridge masquerade and the allowed and blocked destinations
+// through the bridge into the azure-cni nftables table
+func (client *Client) addSnatBridgeNftables(allowed, blocked []net.IPNet) error {
+	_, bridgeSubnet, err := net.ParseCIDR(client.SnatBridgeIP)
+	if err != nil {
+		return newErrorSnatClient(err.Error())
+	}
+
+	err = client.nftablesClient.AddSnatBridge(nftables.SnatBridge{
+		Name:    SnatBridgeName,
+		Subnet:  *bridgeSubnet,
+		Allowed: allowed,
+		Blocked: blocked,
+	})
+	if err != nil {
+		logger.Error("Programming snat bridge nftables rules failed with", zap.Error(err))
+		return newErrorSnatClient(err.Error())
+	}
+
+	return nil
+}
+
+// parseSubnets parses addresses given as ips or cidrs, skipping invalid ones
+func parseSubnets(addresses []string) []net.IPNet {
+	subnets := make([]net.IPNet, 0, len(addresses))
+	for _, address := range addresses {
+		if _, subnet, err := net.ParseCIDR(address); err == nil {
+			subnets = append(subnets, *subnet)
+			continue
+		}
+		ip := net.ParseIP(address)
+		if ip == nil {
+			logger.Info("Skipping invalid address", zap.String("address", address))
+			continue
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		subnets = append(subnets, net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return subnets
+}
+
 func getNCLocalAndGatewayIP(client *Client) (brIP, contIP net.IP) {
 	bridgeIP, _, _ := net.ParseCIDR(client.SnatBridgeIP)
 	containerIP, _, _ := net.ParseCIDR(client.localIP)
@@ -187,43 +251,25 @@ func getNCLocalAndGatewayIP(client *Client) (brIP, contIP net.IP) {
 func (client *Client) AllowInboundFromHostToNC() error {
 	bridgeIP, containerIP := getNCLocalAndGatewayIP(client)
 
-	// Create CNI Output chain
-	if err := client.ipTablesClient.CreateChain(iptables.V4, iptables.Filter, iptables.CNIOutputChain); err != nil {
-		logger.Error("AllowInboundFromHostToNC: Creating failed with", zap.Any("CNIOutputChain", iptables.CNIOutputChain), zap.Error(err))
-		return newErrorSnatClient(err.Error())
-	}
-
-	// Forward traffic from Ouptut chain to CNI Output chain
-	if err := client.ipTablesClient.InsertIptableRule(iptables.V4, iptables.Filter, iptables.Output, "", iptables.CNIOutputChain); err != nil {
-		logger.Error("AllowInboundFromHostToNC: Creating failed with", zap.Any("CNIOutputChain", iptables.CNIOutputChain), zap.Error(err))
-		return newErrorSnatClient(err.Error())
-	}
-
-	// Allow connection from Host to NC
-	matchCondition := fmt.Sprintf("-s %s -d %s", bridgeIP.String(), containerIP.String())
-	err := client.ipTablesClient.InsertIptableRule(iptables.V4, iptables.Filter, iptables.CNIOutputChain, matchCondition, iptables.Accept)
-	if err != nil {
-		logger.Error("AllowInboundFromHostToNC: Inserting output rule failed with ", zap.Error(err))
-		return newErrorSnatClient(err.Error())
-	}
-
-	// Create cniinput chain
-	if err = client.ipTablesClient.CreateChain(iptables.V4, iptables.Filter, iptables.CNIInputChain); err != nil {
-		logger.Error("AllowInboundFromHostToNC: Creating failed with", zap.Any("CNIOutputChain", iptables.CNIOutputChain), zap.Error(err))
-		return newErrorSnatClient(err.Error())
-	}
-
-	// Forward from Input to cniinput chain
-	if err = client.ipTablesClient.InsertIptableRule(iptables.V4, iptables.Filter, iptables.Input, "", iptables.CNIInputChain); err != nil {
-		logger.Error("AllowInboundFromHostToNC: Inserting forward rule to failed with", zap.Any("CNIOutputChain", iptables.CNIOutputChain), zap.Error(err))
-		return newErrorSnatClient(err.Error())
+	var err error
+	if client.nftablesClient != nil {
+		// the azure-cni table accepts established traffic through the snat bridge ahead of its blocks
+		err = client.nftablesClient.AllowHostToNC(bridgeIP, containerIP)
+	} else {
+		// Allow connection from Host to NC, and accept packets from NC only if established connection. The chains and
+		// rules are programmed in one transaction.
+		err = client.ipTablesClient.NewTransaction(iptables.V4).
+			CreateChain(iptables.Filter, iptables.CNIOutputChain).
+			InsertIptableRule(iptables.Filter, iptables.Output, "", iptables.CNIOutputChain).
+			InsertIptableRule(iptables.Filter, iptables.CNIOutputChain, fmt.Sprintf("-s %s -d %s", bridgeIP.String(), containerIP.String()), iptables.Accept).
+			CreateChain(iptables.Filter, iptables.CNIInputChain).
+			InsertIptableRule(iptables.Filter, iptables.Input, "", iptables.CNIInputChain).
+			InsertIptableRule(iptables.Filter, iptables.CNIInputChain,
+				fmt.Sprintf(" -i %s -m state --state %s,%s", SnatBridgeName, iptables.Established, iptables.Related), iptables.Accept).
+			Commit()
 	}
-
-	// Accept packets from NC only if established connection
-	matchCondition = fmt.Sprintf(" -i %s -m state --state %s,%s", SnatBridgeName, iptables.Established, iptables.Related)
-	err = client.ipTablesClient.InsertIptableRule(iptables.V4, iptables.Filter, iptables.CNIInputChain, matchCondition, iptables.Accept)
 	if err != nil {
-		logger.Error("AllowInboundFromHostToNC: Inserting input rule failed with", zap.Error(err))
+		logger.Error("AllowInboundFromHostToNC: Programming iptables rules failed with", zap.Error(err))
 		return newErrorSnatClient(err.Error())
 	}
 
@@ -256,8 +302,15 @@ func (client *Client) DeleteInboundFromHostToNC() error {
 	bridgeIP, containerIP := getNCLocalAndGatewayIP(client)
 
 	// Delete allow connection from Host to NC
-	matchCondition := fmt.Sprintf("-s %s -d %s", bridgeIP.String(), containerIP.String())
-	err := client.ipTablesClient.DeleteIptableRule(iptables.V4, iptables.Filter, iptables.CNIOutputChain, matchCondition, iptables.Accept)
+	var err error
+	if client.nftablesClient != nil {
+		err = client.nftablesClient.DeleteHostToNC(bridgeIP, containerIP)
+	} else {
+		matchCondition := fmt.Sprintf("-s %s -d %s", bridgeIP.String(), containerIP.String())
+		err = client.ipTablesClient.NewTransaction(iptables.V4).
+			DeleteIptableRule(iptables.Filter, iptables.CNIOutputChain, matchCondition, iptables.Accept).
+			Commit()
+	}
 	if err != nil {
 		logger.Error("DeleteInboundFromHostToNC: Error removing output rule", zap.Error(err))
 	}
@@ -283,47 +336,25 @@ func (client *Client) DeleteInboundFromHostToNC() error {
 func (client *Client) AllowInboundFromNCToHost() error {
 	bridgeIP, containerIP := getNCLocalAndGatewayIP(client)
 
-	// Create CNI Input chain
-	if err := client.ipTablesClient.CreateChain(iptables.V4, iptables.Filter, iptables.CNIInputChain); err != nil {
-		logger.Error("AllowInboundFromHostToNC: Creating failed with", zap.String("CNIInputChain", iptables.CNIInputChain),
-			zap.Error(err))
-		return err
-	}
-
-	// Forward traffic from Input to cniinput chain
-	if err := client.ipTablesClient.InsertIptableRule(iptables.V4, iptables.Filter, iptables.Input, "", iptables.CNIInputChain); err != nil {
-		logger.Error("AllowInboundFromHostToNC: Inserting forward rule to failed with", zap.String("CNIInputChain", iptables.CNIInputChain),
-			zap.Error(err))
-		return err
-	}
-
-	// Allow NC to Host connection
-	matchCondition := fmt.Sprintf("-s %s -d %s", containerIP.String(), bridgeIP.String())
-	err := client.ipTablesClient.InsertIptableRule(iptables.V4, iptables.Filter, iptables.CNIInputChain, matchCondition, iptables.Accept)
-	if err != nil {
-		logger.Error("AllowInboundFromHostToNC: Inserting output rule failed with", zap.Error(err))
-		return err
-	}
-
-	// Create CNI output chain
-	if err = client.ipTablesClient.CreateChain(iptables.V4, iptables.Filter, iptables.CNIOutputChain); err != nil {
-		logger.Error("AllowInboundFromHostToNC: Creating failed with", zap.String("CNIInputChain", iptables.CNIInputChain),
-			zap.Error(err))
-		return err
-	}
-
-	// Forward traffic from Output to CNI Output chain
-	if err = client.ipTablesClient.InsertIptableRule(iptables.V4, iptables.Filter, iptables.Output, "", iptables.CNIOutputChain); err != nil {
-		logger.Error("AllowInboundFromHostToNC: Inserting forward rule to failed with", zap.String("CNIInputChain", iptables.CNIInputChain),
-			zap.Error(err))
-		return err
+	var err error
+	if client.nftablesClient != nil {
+		// the azure-cni table accepts established traffic through the snat bridge ahead of its blocks
+		err = client.nftablesClient.AllowNCToHost(containerIP, bridgeIP)
+	} else {
+		// Allow NC to Host connection, and accept packets from Host only if established connection. The chains and rules
+		// are programmed in one transaction.
+		err = client.ipTablesClient.NewTransaction(iptables.V4).
+			CreateChain(iptables.Filter, iptables.CNIInputChain).
+			InsertIptableRule(iptables.Filter, iptables.Input, "", iptables.CNIInputChain).
+			InsertIptableRule(iptables.Filter, iptables.CNIInputChain, fmt.Sprintf("-s %s -d %s", containerIP.String(), bridgeIP.String()), iptables.Accept).
+			CreateChain(iptables.Filter, iptables.CNIOutputChain).
+			InsertIptableRule(iptables.Filter, iptables.Output, "", iptables.CNIOutputChain).
+			InsertIptableRule(iptables.Filter, iptables.CNIOutputChain,
+				fmt.Sprintf(" -o %s -m state --state %s,%s", SnatBridgeName, iptables.Established, iptables.Related), iptables.Accept).
+			Commit()
 	}
-
-	// Accept packets from Host only if established connection
-	matchCondition = fmt.Sprintf(" -o %s -m state --state %s,%s", SnatBridgeName, iptables.Established, iptables.Related)
-	err = client.ipTablesClient.InsertIptableRule(iptables.V4, iptables.Filter, iptables.CNIOutputChain, matchCondition, iptables.Accept)
 	if err != nil {
-		logger.Error("AllowInboundFromHostToNC: Inserting input rule failed with", zap.Error(err))
+		logger.Error("AllowInboundFromNCToHost: Programming iptables rules failed with", zap.Error(err))
 		return err
 	}
 
@@ -354,8 +385,15 @@ func (client *Client) DeleteInboundFromNCToHost() error {
 	bridgeIP, containerIP := getNCLocalAndGatewayIP(client)
 
 	// Delete allow NC to Host connection
-	matchCondition := fmt.Sprintf("-s %s -d %s", containerIP.String(), bridgeIP.String())
-	err := client.ipTablesClient.DeleteIptableRule(iptables.V4, iptables.Filter, iptables.CNIInputChain, matchCondition, iptables.Accept)
+	var err error
+	if client.nftablesClient != nil {
+		err = client.nftablesClient.DeleteNCToHost(containerIP, bridgeIP)
+	} else {
+		matchCondition := fmt.Sprintf("-s %s -d %s", containerIP.String(), bridgeIP.String())
+		err = client.ipTablesClient.NewTransaction(iptables.V4).
+			DeleteIptableRule(iptables.Filter, iptables.CNIInputChain, matchCondition, iptables.Accept).
+			Commit()
+	}
 	if err != nil {
 		logger.Error("DeleteInboundFromNCToHost: Error removing output rule", zap.Error(err))
 	}
@@ -473,10 +511,16 @@ func (client *Client) createSnatBridge(snatBridgeIP, hostPrimaryMac string) erro
 
 // This function adds iptable rules that will snat all traffic that has source ip in apipa range and coming via linux bridge
 func (client *Client) addMasqueradeRule(snatBridgeIPWithPrefix string) error {
+	if client.nftablesClient != nil {
+		return client.addSnatBridgeNftables(nil, nil)
+	}
+
 	_, ipNet, _ := net.ParseCIDR(snatBridgeIPWithPrefix)
 	matchCondition := fmt.Sprintf("-s %s", ipNet.String())
-	return errors.Wrap(client.ipTablesClient.InsertIptableRule(iptables.V4, iptables.Nat, iptables.Postrouting, matchCondition, iptables.Masquerade),
-		"failed to add masquerade rule")
+	err := client.ipTablesClient.NewTransaction(iptables.V4).
+		InsertIptableRule(iptables.Nat, iptables.Postrouting, matchCondition, iptables.Masquerade).
+		Commit()
+	return errors.Wrap(err, "failed to add masquerade rule")
 }
 
 // Drop all vlan traffic on linux bridge
@@ -507,8 +551,12 @@ func (client *Client) EnableIPForwarding() error {
 		return errors.Wrap(err, "enable ipforwarding command failed")
 	}
 
-	// Append a rule in forward chain to allow forwarding from bridge
-	if err := client.ipTablesClient.AppendIptableRule(iptables.V4, iptables.Filter, iptables.Forward, "", iptables.Accept); err != nil {
+	// Append a rule in forward chain to allow forwarding from bridge. This stays in iptables with the nftables
+	// backend: an accept in the azure-cni table does not override the policy of the iptables FORWARD chain.
+	err = client.ipTablesClient.NewTransaction(iptables.V4).
+		AppendIptableRule(iptables.Filter, iptables.Forward, "", iptables.Accept).
+		Commit()
+	if err != nil {
 		return errors.Wrap(err, "appending forward chain rule to allow traffic from snat bridge failed")
 	}
 
@@ -1,30 +1,58 @@
 package snat
 
 import (
+	"net"
 	"os"
 	"testing"
 
+	"github.com/Azure/azure-container-networking/iptables"
 	"github.com/Azure/azure-container-networking/netio"
 	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/nftables"
+	"github.com/Azure/azure-container-networking/platform"
 )
 
 var anyInterface = "dummy"
 
 type mockIPTablesClient struct{}
 
-func (c mockIPTablesClient) InsertIptableRule(_, _, _, _, _ string) error {
+func (c mockIPTablesClient) NewTransaction(version string) *iptables.Transaction {
+	return iptables.NewClientWithExecClient(platform.NewMockExecClient(false)).NewTransaction(version)
+}
+
+// mockNftablesClient records the snat bridge and host to NC rules programmed through it
+type mockNftablesClient struct {
+	bridges  []nftables.SnatBridge
+	hostToNC map[string]bool
+	ncToHost map[string]bool
+}
+
+func newMockNftablesClient() *mockNftablesClient {
+	return &mockNftablesClient{hostToNC: map[string]bool{}, ncToHost: map[string]bool{}}
+}
+
+func (c *mockNftablesClient) AddSnatBridge(bridge nftables.SnatBridge) error {
+	c.bridges = append(c.bridges, bridge)
+	return nil
+}
+
+func (c *mockNftablesClient) AllowHostToNC(hostIP, ncIP net.IP) error {
+	c.hostToNC[hostIP.String()+"-"+ncIP.String()] = true
 	return nil
 }
 
-func (c mockIPTablesClient) AppendIptableRule(_, _, _, _, _ string) error {
+func (c *mockNftablesClient) DeleteHostToNC(hostIP, ncIP net.IP) error {
+	delete(c.hostToNC, hostIP.String()+"-"+ncIP.String())
 	return nil
 }
 
-func (c mockIPTablesClient) DeleteIptableRule(_, _, _, _, _ string) error {
+func (c *mockNftablesClient) AllowNCToHost(ncIP, hostIP net.IP) error {
+	c.ncToHost[ncIP.String()+"-"+hostIP.String()] = true
 	return nil
 }
 
-func (c mockIPTablesClient) CreateChain(_, _, _ string) error {
+func (c *mockNftablesClient) DeleteNCToHost(ncIP, hostIP net.IP) error {
+	delete(c.ncToHost, ncIP.String()+"-"+hostIP.String())
 	return nil
 }
 
@@ -144,3 +172,55 @@ func TestAllowInboundFromNCToHost(t *testing.T) {
 		t.Errorf("Expected error when interface not found in allow nc to host but got nil")
 	}
 }
+
+func TestSnatBridgeNftables(t *testing.T) {
+	nl := netlink.NewMockNetlink(false, "")
+	nio := netio.NewMockNetIO(false, 0)
+	nftc := newMockNftablesClient()
+	client := GetTestClient(nl, &mockIPTablesClient{}, nio)
+	client.nftablesClient = nftc
+	client.SkipAddressesFromBlock = []string{"168.63.129.16", "10.1.0.0/16", "invalid"}
+
+	if err := client.AllowIPAddressesOnSnatBridge(); err != nil {
+		t.Fatalf("Error allowing ip addresses: %v", err)
+	}
+	if err := client.BlockIPAddressesOnSnatBridge(); err != nil {
+		t.Fatalf("Error blocking ip addresses: %v", err)
+	}
+	if len(nftc.bridges) != 2 {
+		t.Fatalf("Expected 2 snat bridge updates, got %d", len(nftc.bridges))
+	}
+	allowed := nftc.bridges[0]
+	if allowed.Name != SnatBridgeName || allowed.Subnet.String() != "169.254.0.0/16" {
+		t.Errorf("Unexpected snat bridge %+v", allowed)
+	}
+	if len(allowed.Allowed) != 2 || allowed.Allowed[0].String() != "168.63.129.16/32" || allowed.Allowed[1].String() != "10.1.0.0/16" {
+		t.Errorf("Unexpected allowed addresses %v", allowed.Allowed)
+	}
+	if len(nftc.bridges[1].Blocked) != 4 {
+		t.Errorf("Expected the private ip space to be blocked, got %v", nftc.bridges[1].Blocked)
+	}
+
+	if err := nl.AddLink(&netlink.DummyLink{LinkInfo: netlink.LinkInfo{Type: netlink.LINK_TYPE_DUMMY, Name: anyInterface}}); err != nil {
+		t.Fatalf("Error adding dummy interface %v", err)
+	}
+	if err := client.AllowInboundFromHostToNC(); err != nil {
+		t.Fatalf("Error adding inbound rule: %v", err)
+	}
+	if err := client.AllowInboundFromNCToHost(); err != nil {
+		t.Fatalf("Error adding inbound rule: %v", err)
+	}
+	if !nftc.hostToNC["169.254.0.1-169.254.0.4"] || !nftc.ncToHost["169.254.0.4-169.254.0.1"] {
+		t.Errorf("Expected host to NC pairs to be allowed, got %v %v", nftc.hostToNC, nftc.ncToHost)
+	}
+
+	if err := client.DeleteInboundFromHostToNC(); err != nil {
+		t.Fatalf("Error removing inbound rule: %v", err)
+	}
+	if err := client.DeleteInboundFromNCToHost(); err != nil {
+		t.Fatalf("Error removing inbound rule: %v", err)
+	}
+	if len(nftc.hostToNC) != 0 || len(nftc.ncToHost) != 0 {
+		t.Errorf("Expected host to NC pairs to be removed, got %v %v", nftc.hostToNC, nftc.ncToHost)
+	}
+}
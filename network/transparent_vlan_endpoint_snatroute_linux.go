@@ -18,6 +18,7 @@ func (client *TransparentVlanEndpointClient) NewSnatClient(snatBridgeIP, localIP
 			client.hostPrimaryMac.String(),
 			epInfo.EndpointDNS.Servers,
 			true,
+			epInfo.HostRulesBackend,
 			client.netlink,
 			client.plClient,
 			client.iptablesClient,
@@ -432,13 +432,14 @@ func (client *TransparentVlanEndpointClient) AddEndpointRules(epInfo *EndpointIn
 func (client *TransparentVlanEndpointClient) AddVnetRules(epInfo *EndpointInfo) error {
 	// iptables -t mangle -I PREROUTING -j MARK --set-mark <TUNNELING MARK>
 	markOption := fmt.Sprintf("MARK --set-mark %d", tunnelingMark)
-	if err := client.iptablesClient.InsertIptableRule(iptables.V4, "mangle", "PREROUTING", "", markOption); err != nil {
-		return errors.Wrap(err, "unable to insert iptables rule mark all packets not entering on vlan interface")
-	}
 	// iptables -t mangle -I PREROUTING -j ACCEPT -i <VLAN IF>
 	match := fmt.Sprintf("-i %s", client.vlanIfName)
-	if err := client.iptablesClient.InsertIptableRule(iptables.V4, "mangle", "PREROUTING", match, "ACCEPT"); err != nil {
-		return errors.Wrap(err, "unable to insert iptables rule accept all incoming from vlan interface")
+	err := client.iptablesClient.NewTransaction(iptables.V4).
+		InsertIptableRule(iptables.Mangle, iptables.Prerouting, "", markOption).
+		InsertIptableRule(iptables.Mangle, iptables.Prerouting, match, iptables.Accept).
+		Commit()
+	if err != nil {
+		return errors.Wrap(err, "unable to insert iptables rules to mark all packets not entering on vlan interface")
 	}
 	// Blocks wireserver traffic from customer vnet nic
 	if err := client.netUtilsClient.BlockEgressTrafficFromContainer(client.iptablesClient, iptables.V4, networkutils.AzureDNS, iptables.TCP, iptables.HTTPPort); err != nil {
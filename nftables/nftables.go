@@ -0,0 +1,90 @@
+package nftables
+
+// This package programs ACN's host rules into dedicated azure-cni nftables tables over netlink.
+// Every change made through this package is queued on a single connection and submitted to the
+// kernel as one netlink batch, so the tables, chains and per-endpoint set and map elements are
+// always updated atomically.
+
+import (
+	"errors"
+	"net"
+
+	"github.com/Azure/azure-container-networking/cni/log"
+	"go.uber.org/zap"
+)
+
+var logger = log.CNILogger.With(zap.String("component", "cni-nftables"))
+
+var (
+	errApplyRuleset     = errors.New("failed to apply nftables ruleset")
+	errInvalidEndpoint  = errors.New("invalid snat endpoint")
+	errInvalidOwner     = errors.New("invalid snat endpoint owner")
+	errMigrateFromIPT   = errors.New("failed to remove iptables rules")
+	errUnsupportedIPVer = errors.New("only ipv4 snat endpoints are supported")
+)
+
+// Backend names used to select how host rules are programmed
+const (
+	BackendIptables = "iptables"
+	BackendNftables = "nftables"
+)
+
+// Owner identifies the component which programmed a SNAT endpoint
+type Owner string
+
+// CNS and CNI keep their DNS and IMDS SNAT endpoints in separate maps. The CNS maps are looked up
+// first, so CNS takes precedence for a subnet programmed by both, as the SWIFT-POSTROUTING chain
+// did ahead of the CNI SWIFT chain with the iptables backend.
+const (
+	OwnerCNS Owner = "cns"
+	OwnerCNI Owner = "cni"
+)
+
+// azure-cni table layout. The table exists in the ip family for all rules and in the ip6 family
+// for the subnet SNAT only.
+const (
+	Table       = "azure-cni"
+	Postrouting = "postrouting"
+	Input       = "input"
+	Output      = "output"
+	Forward     = "forward"
+	// DNSSnatMap and IMDSSnatMap map pod subnets to the ip their DNS and IMDS traffic is SNATed to
+	DNSSnatMap     = "dns-snat"
+	IMDSSnatMap    = "imds-snat"
+	CNSDNSSnatMap  = "cns-dns-snat"
+	CNSIMDSSnatMap = "cns-imds-snat"
+	// SubnetSnatMap maps pod subnets to the ip all of their traffic leaving the node is SNATed to
+	SubnetSnatMap = "subnet-snat"
+	// MasqueradeSet holds the subnets masqueraded behind the host, such as the snat bridge subnet
+	MasqueradeSet = "masquerade"
+	// SnatBridgeSet holds the names of the snat bridges the filter chains apply to
+	SnatBridgeSet = "snat-bridges"
+	// SnatBridgeAllowSet and SnatBridgeBlockSet hold the destinations allowed and blocked via the snat bridges
+	SnatBridgeAllowSet = "snat-bridge-allow"
+	SnatBridgeBlockSet = "snat-bridge-block"
+	// HostToNCSet and NCToHostSet hold the (source, destination) pairs allowed between the host and NCs
+	HostToNCSet = "host-to-nc"
+	NCToHostSet = "nc-to-host"
+	// postroutingPriority runs ahead of the iptables nat chains (srcnat) so that the first SNAT
+	// decision is made by this table
+	postroutingPriority = 100 - 10
+	// filterPriority runs ahead of the iptables filter chains
+	filterPriority = 0 - 10
+)
+
+// SnatEndpoint describes the SNAT applied to DNS and IMDS traffic from a pod subnet
+type SnatEndpoint struct {
+	Owner      Owner
+	Subnet     net.IPNet
+	DNSSnatIP  net.IP
+	IMDSSnatIP net.IP
+}
+
+// SnatBridge describes a linux bridge whose traffic is masqueraded behind the host. Traffic
+// through the bridge to the blocked destinations is dropped unless the destination is allowed.
+type SnatBridge struct {
+	Name    string
+	Subnet  net.IPNet
+	Allowed []net.IPNet
+	Blocked []net.IPNet
+}
@@ -0,0 +1,620 @@
+package nftables
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+
+	"github.com/Azure/azure-container-networking/iptables"
+	"github.com/Azure/azure-container-networking/network/networkutils"
+	nft "github.com/google/nftables"
+	"github.com/google/nftables/binaryutil"
+	"github.com/google/nftables/expr"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+// swiftPostrouting is the chain CNS used for DNS and IMDS SNAT rules with the iptables backend
+const swiftPostrouting = "SWIFT-POSTROUTING"
+
+// conn is the subset of the nftables netlink connection used by the client. Changes are queued
+// until Flush sends them to the kernel as a single batch.
+type conn interface {
+	AddTable(t *nft.Table) *nft.Table
+	AddChain(c *nft.Chain) *nft.Chain
+	FlushChain(c *nft.Chain)
+	AddRule(r *nft.Rule) *nft.Rule
+	AddSet(s *nft.Set, vals []nft.SetElement) error
+	SetAddElements(s *nft.Set, vals []nft.SetElement) error
+	SetDeleteElements(s *nft.Set, vals []nft.SetElement) error
+	GetSetElements(s *nft.Set) ([]nft.SetElement, error)
+	Flush() error
+}
+
+type Client struct {
+	newConn func() (conn, error)
+}
+
+func NewClient() *Client {
+	return &Client{
+		newConn: func() (conn, error) {
+			c, err := nft.New()
+			if err != nil {
+				return nil, fmt.Errorf("failed to open nftables connection: %w", err)
+			}
+			return c, nil
+		},
+	}
+}
+
+// snatMaps returns the DNS and IMDS SNAT maps of the owner
+func snatMaps(owner Owner) (dnsMap, imdsMap string, err error) {
+	switch owner {
+	case OwnerCNS:
+		return CNSDNSSnatMap, CNSIMDSSnatMap, nil
+	case OwnerCNI:
+		return DNSSnatMap, IMDSSnatMap, nil
+	default:
+		return "", "", fmt.Errorf("%w: %q", errInvalidOwner, owner)
+	}
+}
+
+// family describes the azure-cni table of one address family
+type family struct {
+	table       *nft.Table
+	natFamily   uint32
+	addrType    nft.SetDatatype
+	saddrOffset uint32
+	daddrOffset uint32
+}
+
+var (
+	ipv4 = family{
+		table:       &nft.Table{Family: nft.TableFamilyIPv4, Name: Table},
+		natFamily:   unix.NFPROTO_IPV4,
+		addrType:    nft.TypeIPAddr,
+		saddrOffset: 12,
+		daddrOffset: 16,
+	}
+	ipv6 = family{
+		table:       &nft.Table{Family: nft.TableFamilyIPv6, Name: Table},
+		natFamily:   unix.NFPROTO_IPV6,
+		addrType:    nft.TypeIP6Addr,
+		saddrOffset: 8,
+		daddrOffset: 24,
+	}
+)
+
+func familyOf(ip net.IP) family {
+	if ip.To4() != nil {
+		return ipv4
+	}
+	return ipv6
+}
+
+// addr returns the ip in the byte length of the family
+func (f family) addr(ip net.IP) []byte {
+	if f.addrType.Bytes == net.IPv4len {
+		return ip.To4()
+	}
+	return ip.To16()
+}
+
+// set returns the definition of the named set or map of the family
+func (f family) set(name string) *nft.Set {
+	addrMap := &nft.Set{Table: f.table, Name: name, IsMap: true, Interval: true, KeyType: f.addrType, DataType: f.addrType}
+	addrSet := &nft.Set{Table: f.table, Name: name, Interval: true, KeyType: f.addrType}
+	switch name {
+	case DNSSnatMap, IMDSSnatMap, CNSDNSSnatMap, CNSIMDSSnatMap, SubnetSnatMap:
+		return addrMap
+	case SnatBridgeSet:
+		return &nft.Set{Table: f.table, Name: name, KeyType: nft.TypeIFName}
+	case HostToNCSet, NCToHostSet:
+		return &nft.Set{Table: f.table, Name: name, Concatenation: true, KeyType: nft.MustConcatSetType(f.addrType, f.addrType)}
+	default:
+		return addrSet
+	}
+}
+
+// setNames returns the sets and maps of the family's table
+func (f family) setNames() []string {
+	if f.table.Family == nft.TableFamilyIPv6 {
+		return []string{SubnetSnatMap}
+	}
+	return []string{
+		CNSDNSSnatMap, CNSIMDSSnatMap, DNSSnatMap, IMDSSnatMap, SubnetSnatMap, MasqueradeSet,
+		SnatBridgeSet, SnatBridgeAllowSet, SnatBridgeBlockSet, HostToNCSet, NCToHostSet,
+	}
+}
+
+// chainSpec describes a base chain of the azure-cni table and its rules
+type chainSpec struct {
+	name     string
+	typ      nft.ChainType
+	hook     *nft.ChainHook
+	priority nft.ChainPriority
+	rules    [][]expr.Any
+}
+
+// batch queues changes to the azure-cni tables on a single connection
+type batch struct {
+	conn conn
+	sets map[string]*nft.Set
+}
+
+func (c *Client) newBatch() (*batch, error) {
+	cn, err := c.newConn()
+	if err != nil {
+		return nil, err
+	}
+	return &batch{conn: cn, sets: map[string]*nft.Set{}}, nil
+}
+
+// setOf returns the named set of the family, reusing the definition queued in this batch so
+// that rules and elements refer to the same set id
+func (b *batch) setOf(f family, name string) *nft.Set {
+	key := fmt.Sprintf("%d/%s", f.table.Family, name)
+	if s, ok := b.sets[key]; ok {
+		return s
+	}
+	s := f.set(name)
+	b.sets[key] = s
+	return s
+}
+
+func (b *batch) flush() error {
+	if err := b.conn.Flush(); err != nil {
+		return fmt.Errorf("%w: %w", errApplyRuleset, err)
+	}
+	return nil
+}
+
+// ensureTable queues the creation of the family's azure-cni table and sets, and resets its chains
+// to the expected rules. Set and map elements are preserved.
+func (b *batch) ensureTable(f family) error {
+	b.conn.AddTable(f.table)
+	for _, name := range f.setNames() {
+		if err := b.conn.AddSet(b.setOf(f, name), nil); err != nil {
+			return fmt.Errorf("%w: failed to add set %s: %w", errApplyRuleset, name, err)
+		}
+	}
+
+	chains := []chainSpec{
+		{Postrouting, nft.ChainTypeNAT, nft.ChainHookPostrouting, postroutingPriority, b.postroutingRules(f)},
+	}
+	if f.table.Family == nft.TableFamilyIPv4 {
+		chains = append(chains,
+			chainSpec{Input, nft.ChainTypeFilter, nft.ChainHookInput, filterPriority, b.filterRules(f, expr.MetaKeyIIFNAME, NCToHostSet)},
+			chainSpec{Output, nft.ChainTypeFilter, nft.ChainHookOutput, filterPriority, b.filterRules(f, expr.MetaKeyOIFNAME, HostToNCSet)},
+			chainSpec{Forward, nft.ChainTypeFilter, nft.ChainHookForward, filterPriority, b.filterRules(f, expr.MetaKeyIIFNAME, "")},
+		)
+	}
+
+	policy := nft.ChainPolicyAccept
+	for _, ch := range chains {
+		chain := b.conn.AddChain(&nft.Chain{
+			Name:     ch.name,
+			Table:    f.table,
+			Type:     ch.typ,
+			Hooknum:  ch.hook,
+			Priority: nft.ChainPriorityRef(ch.priority),
+			Policy:   &policy,
+		})
+		b.conn.FlushChain(chain)
+		for _, exprs := range ch.rules {
+			b.conn.AddRule(&nft.Rule{Table: f.table, Chain: chain, Exprs: exprs})
+		}
+	}
+
+	return nil
+}
+
+// postroutingRules masquerades and SNATs by subnet first, then skips local destinations and SNATs
+// DNS and IMDS traffic, looking up the CNS maps ahead of the CNI maps
+func (b *batch) postroutingRules(f family) [][]expr.Any {
+	snatVia := func(mapName string) []expr.Any {
+		return []expr.Any{
+			loadAddr(f, f.saddrOffset, 1),
+			&expr.Lookup{SourceRegister: 1, DestRegister: 1, IsDestRegSet: true, SetName: mapName, SetID: b.setOf(f, mapName).ID},
+			&expr.NAT{Type: expr.NATTypeSourceNAT, Family: f.natFamily, RegAddrMin: 1},
+		}
+	}
+
+	rules := [][]expr.Any{snatVia(SubnetSnatMap)}
+	if f.table.Family == nft.TableFamilyIPv6 {
+		return rules
+	}
+
+	rules = append([][]expr.Any{{
+		loadAddr(f, f.saddrOffset, 1),
+		b.lookup(f, 1, MasqueradeSet),
+		&expr.Masq{},
+	}}, rules...)
+
+	rules = append(rules, []expr.Any{
+		&expr.Fib{Register: 1, FlagDADDR: true, ResultADDRTYPE: true},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binaryutil.NativeEndian.PutUint32(unix.RTN_LOCAL)},
+		&expr.Verdict{Kind: expr.VerdictReturn},
+	})
+
+	service := func(ip string, proto byte, port uint16, mapName string) []expr.Any {
+		return append([]expr.Any{
+			loadAddr(f, f.daddrOffset, 1),
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: f.addr(net.ParseIP(ip))},
+			&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{proto}},
+			&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseTransportHeader, Offset: 2, Len: 2},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binaryutil.BigEndian.PutUint16(port)},
+		}, snatVia(mapName)...)
+	}
+	for _, dnsMap := range []string{CNSDNSSnatMap, DNSSnatMap} {
+		rules = append(rules,
+			service(networkutils.AzureDNS, unix.IPPROTO_UDP, iptables.DNSPort, dnsMap),
+			service(networkutils.AzureDNS, unix.IPPROTO_TCP, iptables.DNSPort, dnsMap))
+	}
+	for _, imdsMap := range []string{CNSIMDSSnatMap, IMDSSnatMap} {
+		rules = append(rules, service(networkutils.AzureIMDS, unix.IPPROTO_TCP, iptables.HTTPPort, imdsMap))
+	}
+
+	return rules
+}
+
+// filterRules accepts established traffic of the snat bridges and the allowed host to NC pairs,
+// then drops blocked destinations through the snat bridges unless they are allowed
+func (b *batch) filterRules(f family, ifKey expr.MetaKey, pairSet string) [][]expr.Any {
+	onBridge := []expr.Any{
+		&expr.Meta{Key: ifKey, Register: 1},
+		b.lookup(f, 1, SnatBridgeSet),
+	}
+	toSet := func(setName string, verdict expr.VerdictKind) []expr.Any {
+		return append(append([]expr.Any{}, onBridge...),
+			loadAddr(f, f.daddrOffset, 1),
+			b.lookup(f, 1, setName),
+			&expr.Verdict{Kind: verdict})
+	}
+
+	var rules [][]expr.Any
+	if pairSet != "" {
+		established := binaryutil.NativeEndian.PutUint32(expr.CtStateBitESTABLISHED | expr.CtStateBitRELATED)
+		rules = append(rules,
+			append(append([]expr.Any{}, onBridge...),
+				&expr.Ct{Register: 1, Key: expr.CtKeySTATE},
+				&expr.Bitwise{SourceRegister: 1, DestRegister: 1, Len: 4, Mask: established, Xor: make([]byte, 4)},
+				&expr.Cmp{Op: expr.CmpOpNeq, Register: 1, Data: make([]byte, 4)},
+				&expr.Verdict{Kind: expr.VerdictAccept}),
+			[]expr.Any{
+				loadAddr(f, f.saddrOffset, 1),
+				loadAddr(f, f.daddrOffset, 9),
+				b.lookup(f, 1, pairSet),
+				&expr.Verdict{Kind: expr.VerdictAccept},
+			})
+	}
+
+	return append(rules, toSet(SnatBridgeAllowSet, expr.VerdictAccept), toSet(SnatBridgeBlockSet, expr.VerdictDrop))
+}
+
+func (b *batch) lookup(f family, reg uint32, setName string) *expr.Lookup {
+	return &expr.Lookup{SourceRegister: reg, SetName: setName, SetID: b.setOf(f, setName).ID}
+}
+
+func loadAddr(f family, offset, reg uint32) *expr.Payload {
+	return &expr.Payload{DestRegister: reg, Base: expr.PayloadBaseNetworkHeader, Offset: offset, Len: f.addrType.Bytes}
+}
+
+// elements returns the current elements of the named set. A missing table or set is treated as empty.
+func (b *batch) elements(f family, setName string) []nft.SetElement {
+	elems, err := b.conn.GetSetElements(b.setOf(f, setName))
+	if err != nil {
+		logger.Info("Could not list nftables set", zap.String("set", setName), zap.Error(err))
+		return nil
+	}
+	return elems
+}
+
+// replaceInterval queues the subnet to be mapped to val, or added to the set if val is nil,
+// replacing its current value. It returns false if the element is already up to date.
+func (b *batch) replaceInterval(f family, setName string, subnet net.IPNet, val []byte) (bool, error) {
+	elems := intervalElements(f, subnet, val)
+	s := b.setOf(f, setName)
+	for _, current := range b.elements(f, setName) {
+		if current.IntervalEnd || !bytes.Equal(current.Key, elems[0].Key) {
+			continue
+		}
+		if bytes.Equal(current.Val, val) {
+			return false, nil
+		}
+		if err := b.conn.SetDeleteElements(s, elems); err != nil {
+			return false, fmt.Errorf("%w: %w", errApplyRuleset, err)
+		}
+		break
+	}
+
+	if err := b.conn.SetAddElements(s, elems); err != nil {
+		return false, fmt.Errorf("%w: %w", errApplyRuleset, err)
+	}
+	return true, nil
+}
+
+// deleteInterval queues the removal of the subnet from the set if present
+func (b *batch) deleteInterval(f family, setName string, subnet net.IPNet) (bool, error) {
+	elems := intervalElements(f, subnet, nil)
+	for _, current := range b.elements(f, setName) {
+		if current.IntervalEnd || !bytes.Equal(current.Key, elems[0].Key) {
+			continue
+		}
+		if err := b.conn.SetDeleteElements(b.setOf(f, setName), elems); err != nil {
+			return false, fmt.Errorf("%w: %w", errApplyRuleset, err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// intervalElements returns the start and end elements of the subnet. The end element is omitted
+// when the subnet ends at the last address of the family.
+func intervalElements(f family, subnet net.IPNet, val []byte) []nft.SetElement {
+	ones, _ := subnet.Mask.Size()
+	start := f.addr(subnet.IP.Mask(subnet.Mask))
+	mask := net.CIDRMask(ones, len(start)*8)
+
+	// the end element is the first address past the subnet
+	end := make([]byte, len(start))
+	for i := range start {
+		end[i] = start[i] | ^mask[i]
+	}
+	for i := len(end) - 1; i >= 0; i-- {
+		end[i]++
+		if end[i] != 0 {
+			break
+		}
+	}
+
+	elems := []nft.SetElement{{Key: start, Val: val}}
+	if !bytes.Equal(end, make([]byte, len(end))) {
+		elems = append(elems, nft.SetElement{Key: end, IntervalEnd: true})
+	}
+	return elems
+}
+
+// EnsureTable creates the azure-cni tables with their sets, maps and chains
+func (c *Client) EnsureTable() error {
+	b, err := c.newBatch()
+	if err != nil {
+		return err
+	}
+	for _, f := range []family{ipv4, ipv6} {
+		if err := b.ensureTable(f); err != nil {
+			return err
+		}
+	}
+	return b.flush()
+}
+
+// AddSnatEndpoint ensures the azure-cni table exists and maps the endpoint subnet to its DNS and
+// IMDS SNAT ips in the maps of the endpoint owner. Existing entries for the subnet are replaced
+// in the same batch.
+func (c *Client) AddSnatEndpoint(ep SnatEndpoint) error {
+	if ep.Subnet.IP.To4() == nil || ep.DNSSnatIP.To4() == nil || ep.IMDSSnatIP.To4() == nil {
+		return fmt.Errorf("%w: %w", errInvalidEndpoint, errUnsupportedIPVer)
+	}
+	dnsMap, imdsMap, err := snatMaps(ep.Owner)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errInvalidEndpoint, err)
+	}
+
+	b, err := c.newBatch()
+	if err != nil {
+		return err
+	}
+	if err := b.ensureTable(ipv4); err != nil {
+		return err
+	}
+	for _, elem := range []struct {
+		mapName string
+		value   net.IP
+	}{
+		{dnsMap, ep.DNSSnatIP},
+		{imdsMap, ep.IMDSSnatIP},
+	} {
+		if _, err := b.replaceInterval(ipv4, elem.mapName, ep.Subnet, ipv4.addr(elem.value)); err != nil {
+			return err
+		}
+	}
+
+	return b.flush()
+}
+
+// DeleteSnatEndpoint removes the subnet from the SNAT maps of the owner if present
+func (c *Client) DeleteSnatEndpoint(owner Owner, subnet net.IPNet) error {
+	if subnet.IP.To4() == nil {
+		return fmt.Errorf("%w: %w", errInvalidEndpoint, errUnsupportedIPVer)
+	}
+	dnsMap, imdsMap, err := snatMaps(owner)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errInvalidEndpoint, err)
+	}
+
+	b, err := c.newBatch()
+	if err != nil {
+		return err
+	}
+	changed := false
+	for _, mapName := range []string{dnsMap, imdsMap} {
+		deleted, err := b.deleteInterval(ipv4, mapName, subnet)
+		if err != nil {
+			return err
+		}
+		changed = changed || deleted
+	}
+	if !changed {
+		return nil
+	}
+
+	return b.flush()
+}
+
+// AddSubnetSnat SNATs all traffic from the subnet leaving the node to snatIP. It replaces
+// networkutils.AddSnatRule for the nftables backend.
+func (c *Client) AddSubnetSnat(subnet net.IPNet, snatIP net.IP) error {
+	f := familyOf(subnet.IP)
+	if familyOf(snatIP).table.Family != f.table.Family {
+		return fmt.Errorf("%w: subnet %s and snat ip %s are of different families", errInvalidEndpoint, subnet.String(), snatIP.String())
+	}
+
+	b, err := c.newBatch()
+	if err != nil {
+		return err
+	}
+	if err := b.ensureTable(f); err != nil {
+		return err
+	}
+	if _, err := b.replaceInterval(f, SubnetSnatMap, subnet, f.addr(snatIP)); err != nil {
+		return err
+	}
+
+	return b.flush()
+}
+
+// AddSnatBridge masquerades the bridge subnet and drops traffic through the bridge to the blocked
+// destinations unless allowed. It replaces the snat bridge iptables rules for the nftables backend.
+func (c *Client) AddSnatBridge(bridge SnatBridge) error {
+	if bridge.Subnet.IP.To4() == nil {
+		return fmt.Errorf("%w: %w", errInvalidEndpoint, errUnsupportedIPVer)
+	}
+
+	b, err := c.newBatch()
+	if err != nil {
+		return err
+	}
+	if err := b.ensureTable(ipv4); err != nil {
+		return err
+	}
+
+	if !containsElement(b.elements(ipv4, SnatBridgeSet), ifname(bridge.Name)) {
+		if err := b.conn.SetAddElements(b.setOf(ipv4, SnatBridgeSet), []nft.SetElement{{Key: ifname(bridge.Name)}}); err != nil {
+			return fmt.Errorf("%w: %w", errApplyRuleset, err)
+		}
+	}
+	for _, elems := range []struct {
+		setName string
+		subnets []net.IPNet
+	}{
+		{MasqueradeSet, []net.IPNet{bridge.Subnet}},
+		{SnatBridgeAllowSet, bridge.Allowed},
+		{SnatBridgeBlockSet, bridge.Blocked},
+	} {
+		current := b.elements(ipv4, elems.setName)
+		for _, subnet := range elems.subnets {
+			if subnet.IP.To4() == nil {
+				continue
+			}
+			// skip subnets already in the set, including duplicates in the request
+			if containsElement(current, intervalElements(ipv4, subnet, nil)[0].Key) {
+				continue
+			}
+			added := intervalElements(ipv4, subnet, nil)
+			if err := b.conn.SetAddElements(b.setOf(ipv4, elems.setName), added); err != nil {
+				return fmt.Errorf("%w: %w", errApplyRuleset, err)
+			}
+			current = append(current, added...)
+		}
+	}
+
+	return b.flush()
+}
+
+// AllowHostToNC accepts traffic from the host ip to the NC ip ahead of the snat bridge blocks
+func (c *Client) AllowHostToNC(hostIP, ncIP net.IP) error {
+	return c.updatePair(HostToNCSet, hostIP, ncIP, true)
+}
+
+// DeleteHostToNC removes the pair accepted by AllowHostToNC
+func (c *Client) DeleteHostToNC(hostIP, ncIP net.IP) error {
+	return c.updatePair(HostToNCSet, hostIP, ncIP, false)
+}
+
+// AllowNCToHost accepts traffic from the NC ip to the host ip ahead of the snat bridge blocks
+func (c *Client) AllowNCToHost(ncIP, hostIP net.IP) error {
+	return c.updatePair(NCToHostSet, ncIP, hostIP, true)
+}
+
+// DeleteNCToHost removes the pair accepted by AllowNCToHost
+func (c *Client) DeleteNCToHost(ncIP, hostIP net.IP) error {
+	return c.updatePair(NCToHostSet, ncIP, hostIP, false)
+}
+
+func (c *Client) updatePair(setName string, src, dst net.IP, add bool) error {
+	if src.To4() == nil || dst.To4() == nil {
+		return fmt.Errorf("%w: %w", errInvalidEndpoint, errUnsupportedIPVer)
+	}
+
+	b, err := c.newBatch()
+	if err != nil {
+		return err
+	}
+	key := append(append([]byte{}, src.To4()...), dst.To4()...)
+	exists := containsElement(b.elements(ipv4, setName), key)
+
+	switch {
+	case add && !exists:
+		if err := b.ensureTable(ipv4); err != nil {
+			return err
+		}
+		err = b.conn.SetAddElements(b.setOf(ipv4, setName), []nft.SetElement{{Key: key}})
+	case !add && exists:
+		err = b.conn.SetDeleteElements(b.setOf(ipv4, setName), []nft.SetElement{{Key: key}})
+	default:
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", errApplyRuleset, err)
+	}
+
+	return b.flush()
+}
+
+// containsElement reports whether a set holds an element with the key, ignoring interval ends
+func containsElement(elems []nft.SetElement, key []byte) bool {
+	for _, elem := range elems {
+		if !elem.IntervalEnd && bytes.Equal(elem.Key, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// ifname returns the key of an interface name in an ifname set
+func ifname(name string) []byte {
+	b := make([]byte, nft.TypeIFName.Bytes)
+	copy(b, name)
+	return b
+}
+
+// MigrateFromIptables removes, in a single transaction, the iptables rules which the nftables
+// backend replaces: the DNS and IMDS SNAT chains programmed by CNI (SWIFT) and CNS
+// (SWIFT-POSTROUTING), the host to NC chains and the private ip blocks of the snat bridge. It is
+// meant to run once when the node switches backends. Per-endpoint snat bridge allow rules, the
+// snat bridge masquerade rule and ipv6 SNAT rules are left in place: they only accept or SNAT
+// traffic the azure-cni table already handles first.
+func MigrateFromIptables(iptc *iptables.Client, snatBridgeName string) error {
+	tx := iptc.NewTransaction(iptables.V4).
+		DeleteIptableRule(iptables.Nat, iptables.Postrouting, "", iptables.Swift).
+		DeleteIptableRule(iptables.Nat, iptables.Postrouting, "", swiftPostrouting).
+		DeleteChain(iptables.Nat, iptables.Swift).
+		DeleteChain(iptables.Nat, swiftPostrouting).
+		DeleteIptableRule(iptables.Filter, iptables.Input, "", iptables.CNIInputChain).
+		DeleteIptableRule(iptables.Filter, iptables.Output, "", iptables.CNIOutputChain).
+		DeleteChain(iptables.Filter, iptables.CNIInputChain).
+		DeleteChain(iptables.Filter, iptables.CNIOutputChain)
+
+	for _, address := range networkutils.PrivateIPSpace() {
+		tx = tx.DeleteIptableRule(iptables.Filter, iptables.Forward, fmt.Sprintf("-i %s -d %s", snatBridgeName, address), iptables.Drop).
+			DeleteIptableRule(iptables.Filter, iptables.Input, fmt.Sprintf("-i %s -d %s", snatBridgeName, address), iptables.Drop).
+			DeleteIptableRule(iptables.Filter, iptables.Output, fmt.Sprintf("-o %s -d %s", snatBridgeName, address), iptables.Drop)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %w", errMigrateFromIPT, err)
+	}
+	return nil
+}
@@ -0,0 +1,388 @@
+package nftables
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/iptables"
+	"github.com/Azure/azure-container-networking/platform"
+	nft "github.com/google/nftables"
+	"github.com/google/nftables/expr"
+	"github.com/stretchr/testify/require"
+)
+
+var errNoSuchSet = errors.New("no such set")
+
+// fakeConn applies changes to an in-memory ruleset and counts the batches flushed
+type fakeConn struct {
+	tables  []string
+	chains  map[string][]*nft.Rule
+	sets    map[string][]nft.SetElement
+	flushes int
+	err     error
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{chains: map[string][]*nft.Rule{}, sets: map[string][]nft.SetElement{}}
+}
+
+func tableKey(t *nft.Table, name string) string {
+	if t.Family == nft.TableFamilyIPv6 {
+		return "ip6 " + t.Name + " " + name
+	}
+	return "ip " + t.Name + " " + name
+}
+
+func (c *fakeConn) AddTable(t *nft.Table) *nft.Table {
+	c.tables = append(c.tables, tableKey(t, ""))
+	return t
+}
+
+func (c *fakeConn) AddChain(ch *nft.Chain) *nft.Chain {
+	key := tableKey(ch.Table, ch.Name)
+	if _, ok := c.chains[key]; !ok {
+		c.chains[key] = nil
+	}
+	return ch
+}
+
+func (c *fakeConn) FlushChain(ch *nft.Chain) {
+	c.chains[tableKey(ch.Table, ch.Name)] = nil
+}
+
+func (c *fakeConn) AddRule(r *nft.Rule) *nft.Rule {
+	key := tableKey(r.Table, r.Chain.Name)
+	c.chains[key] = append(c.chains[key], r)
+	return r
+}
+
+func (c *fakeConn) AddSet(s *nft.Set, _ []nft.SetElement) error {
+	s.ID = uint32(len(c.sets) + 1)
+	key := tableKey(s.Table, s.Name)
+	if _, ok := c.sets[key]; !ok {
+		c.sets[key] = nil
+	}
+	return nil
+}
+
+func (c *fakeConn) SetAddElements(s *nft.Set, vals []nft.SetElement) error {
+	key := tableKey(s.Table, s.Name)
+	if _, ok := c.sets[key]; !ok {
+		return errNoSuchSet
+	}
+	c.sets[key] = append(c.sets[key], vals...)
+	return nil
+}
+
+// SetDeleteElements fails like the kernel if an element is missing
+func (c *fakeConn) SetDeleteElements(s *nft.Set, vals []nft.SetElement) error {
+	key := tableKey(s.Table, s.Name)
+	for _, val := range vals {
+		found := false
+		for i, elem := range c.sets[key] {
+			if elem.IntervalEnd == val.IntervalEnd && bytes.Equal(elem.Key, val.Key) {
+				c.sets[key] = append(c.sets[key][:i], c.sets[key][i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errNoSuchSet
+		}
+	}
+	return nil
+}
+
+func (c *fakeConn) GetSetElements(s *nft.Set) ([]nft.SetElement, error) {
+	elems, ok := c.sets[tableKey(s.Table, s.Name)]
+	if !ok {
+		return nil, errNoSuchSet
+	}
+	return append([]nft.SetElement{}, elems...), nil
+}
+
+func (c *fakeConn) Flush() error {
+	c.flushes++
+	return c.err
+}
+
+func newFakeClient(c *fakeConn) *Client {
+	return &Client{newConn: func() (conn, error) { return c, nil }}
+}
+
+func mustParseCIDR(t *testing.T, cidr string) net.IPNet {
+	t.Helper()
+	_, ipNet, err := net.ParseCIDR(cidr)
+	require.NoError(t, err)
+	return *ipNet
+}
+
+// lookups returns the sets looked up by each rule of the chain
+func lookups(rules []*nft.Rule) []string {
+	var sets []string
+	for _, r := range rules {
+		for _, e := range r.Exprs {
+			if l, ok := e.(*expr.Lookup); ok {
+				sets = append(sets, l.SetName)
+			}
+		}
+	}
+	return sets
+}
+
+func TestEnsureTable(t *testing.T) {
+	c := newFakeConn()
+	require.NoError(t, newFakeClient(c).EnsureTable())
+	require.Equal(t, 1, c.flushes)
+	require.Equal(t, []string{"ip azure-cni ", "ip6 azure-cni "}, c.tables)
+	require.Len(t, c.sets, len(ipv4.setNames())+len(ipv6.setNames()))
+
+	require.Equal(t, []string{
+		MasqueradeSet, SubnetSnatMap,
+		CNSDNSSnatMap, CNSDNSSnatMap, DNSSnatMap, DNSSnatMap, CNSIMDSSnatMap, IMDSSnatMap,
+	}, lookups(c.chains["ip azure-cni postrouting"]), "CNS maps must be looked up ahead of CNI maps")
+	require.Equal(t, []string{SnatBridgeSet, NCToHostSet, SnatBridgeSet, SnatBridgeAllowSet, SnatBridgeSet, SnatBridgeBlockSet},
+		lookups(c.chains["ip azure-cni input"]))
+	require.Equal(t, []string{SnatBridgeSet, HostToNCSet, SnatBridgeSet, SnatBridgeAllowSet, SnatBridgeSet, SnatBridgeBlockSet},
+		lookups(c.chains["ip azure-cni output"]))
+	require.Equal(t, []string{SnatBridgeSet, SnatBridgeAllowSet, SnatBridgeSet, SnatBridgeBlockSet},
+		lookups(c.chains["ip azure-cni forward"]))
+	require.Equal(t, []string{SubnetSnatMap}, lookups(c.chains["ip6 azure-cni postrouting"]))
+
+	// rebuilding the table does not duplicate rules
+	require.NoError(t, newFakeClient(c).EnsureTable())
+	require.Len(t, c.chains["ip azure-cni postrouting"], 9)
+}
+
+func TestAddSnatEndpoint(t *testing.T) {
+	c := newFakeConn()
+	client := newFakeClient(c)
+	subnet := mustParseCIDR(t, "10.0.1.0/24")
+
+	require.NoError(t, client.AddSnatEndpoint(SnatEndpoint{
+		Owner:      OwnerCNI,
+		Subnet:     subnet,
+		DNSSnatIP:  net.ParseIP("10.0.1.20"),
+		IMDSSnatIP: net.ParseIP("10.0.0.3"),
+	}))
+	require.NoError(t, client.AddSnatEndpoint(SnatEndpoint{
+		Owner:      OwnerCNS,
+		Subnet:     subnet,
+		DNSSnatIP:  net.ParseIP("10.0.0.3"),
+		IMDSSnatIP: net.ParseIP("10.0.0.3"),
+	}))
+
+	// the owners write to separate maps
+	require.Equal(t, []nft.SetElement{
+		{Key: []byte{10, 0, 1, 0}, Val: []byte{10, 0, 1, 20}},
+		{Key: []byte{10, 0, 2, 0}, IntervalEnd: true},
+	}, c.sets["ip azure-cni dns-snat"])
+	require.Equal(t, []nft.SetElement{
+		{Key: []byte{10, 0, 1, 0}, Val: []byte{10, 0, 0, 3}},
+		{Key: []byte{10, 0, 2, 0}, IntervalEnd: true},
+	}, c.sets["ip azure-cni cns-dns-snat"])
+
+	// an updated snat ip replaces the element
+	require.NoError(t, client.AddSnatEndpoint(SnatEndpoint{
+		Owner:      OwnerCNI,
+		Subnet:     subnet,
+		DNSSnatIP:  net.ParseIP("10.0.1.21"),
+		IMDSSnatIP: net.ParseIP("10.0.0.3"),
+	}))
+	require.Equal(t, []nft.SetElement{
+		{Key: []byte{10, 0, 1, 0}, Val: []byte{10, 0, 1, 21}},
+		{Key: []byte{10, 0, 2, 0}, IntervalEnd: true},
+	}, c.sets["ip azure-cni dns-snat"])
+	require.Len(t, c.sets["ip azure-cni imds-snat"], 2)
+	require.Equal(t, 3, c.flushes)
+}
+
+func TestAddSnatEndpointErrors(t *testing.T) {
+	c := newFakeConn()
+	client := newFakeClient(c)
+
+	err := client.AddSnatEndpoint(SnatEndpoint{
+		Owner:      OwnerCNI,
+		Subnet:     mustParseCIDR(t, "fd00::/64"),
+		DNSSnatIP:  net.ParseIP("fd00::1"),
+		IMDSSnatIP: net.ParseIP("fd00::1"),
+	})
+	require.ErrorIs(t, err, errInvalidEndpoint)
+
+	err = client.AddSnatEndpoint(SnatEndpoint{
+		Subnet:     mustParseCIDR(t, "10.0.1.0/24"),
+		DNSSnatIP:  net.ParseIP("10.0.1.20"),
+		IMDSSnatIP: net.ParseIP("10.0.0.3"),
+	})
+	require.ErrorIs(t, err, errInvalidOwner)
+
+	c.err = errNoSuchSet
+	err = client.AddSnatEndpoint(SnatEndpoint{
+		Owner:      OwnerCNS,
+		Subnet:     mustParseCIDR(t, "10.0.1.0/24"),
+		DNSSnatIP:  net.ParseIP("10.0.1.20"),
+		IMDSSnatIP: net.ParseIP("10.0.0.3"),
+	})
+	require.ErrorIs(t, err, errApplyRuleset)
+}
+
+func TestDeleteSnatEndpoint(t *testing.T) {
+	c := newFakeConn()
+	client := newFakeClient(c)
+	for _, cidr := range []string{"10.0.1.0/24", "10.0.2.0/24"} {
+		require.NoError(t, client.AddSnatEndpoint(SnatEndpoint{
+			Owner:      OwnerCNS,
+			Subnet:     mustParseCIDR(t, cidr),
+			DNSSnatIP:  net.ParseIP("10.0.0.3"),
+			IMDSSnatIP: net.ParseIP("10.0.0.3"),
+		}))
+	}
+	flushes := c.flushes
+
+	require.NoError(t, client.DeleteSnatEndpoint(OwnerCNS, mustParseCIDR(t, "10.0.1.0/24")))
+	require.Equal(t, flushes+1, c.flushes)
+	for _, mapName := range []string{"ip azure-cni cns-dns-snat", "ip azure-cni cns-imds-snat"} {
+		require.Equal(t, []nft.SetElement{
+			{Key: []byte{10, 0, 2, 0}, Val: []byte{10, 0, 0, 3}},
+			{Key: []byte{10, 0, 3, 0}, IntervalEnd: true},
+		}, c.sets[mapName])
+	}
+
+	// nothing to delete, in the CNI maps or for an unknown subnet
+	require.NoError(t, client.DeleteSnatEndpoint(OwnerCNI, mustParseCIDR(t, "10.0.2.0/24")))
+	require.NoError(t, client.DeleteSnatEndpoint(OwnerCNS, mustParseCIDR(t, "10.0.9.0/24")))
+	require.Equal(t, flushes+1, c.flushes)
+}
+
+func TestAddSubnetSnat(t *testing.T) {
+	c := newFakeConn()
+	client := newFakeClient(c)
+
+	require.NoError(t, client.AddSubnetSnat(mustParseCIDR(t, "fd00:1::/64"), net.ParseIP("fd00::4")))
+	elems := c.sets["ip6 azure-cni subnet-snat"]
+	require.Len(t, elems, 2)
+	require.Equal(t, []byte(net.ParseIP("fd00:1::")), elems[0].Key)
+	require.Equal(t, []byte(net.ParseIP("fd00::4")), elems[0].Val)
+	require.Equal(t, []byte(net.ParseIP("fd00:1:0:1::")), elems[1].Key)
+	require.True(t, elems[1].IntervalEnd)
+
+	// the same snat is not programmed twice
+	require.NoError(t, client.AddSubnetSnat(mustParseCIDR(t, "fd00:1::/64"), net.ParseIP("fd00::4")))
+	require.Len(t, c.sets["ip6 azure-cni subnet-snat"], 2)
+
+	require.ErrorIs(t, client.AddSubnetSnat(mustParseCIDR(t, "fd00:1::/64"), net.ParseIP("10.0.0.4")), errInvalidEndpoint)
+}
+
+func TestAddSnatBridge(t *testing.T) {
+	c := newFakeConn()
+	client := newFakeClient(c)
+	bridge := SnatBridge{
+		Name:    "azSnatbr",
+		Subnet:  mustParseCIDR(t, "169.254.128.0/17"),
+		Allowed: []net.IPNet{mustParseCIDR(t, "168.63.129.16/32"), mustParseCIDR(t, "168.63.129.16/32")},
+		Blocked: []net.IPNet{mustParseCIDR(t, "10.0.0.0/8"), mustParseCIDR(t, "169.254.0.0/16")},
+	}
+
+	require.NoError(t, client.AddSnatBridge(bridge))
+	require.NoError(t, client.AddSnatBridge(bridge))
+
+	require.Equal(t, []nft.SetElement{{Key: ifname("azSnatbr")}}, c.sets["ip azure-cni snat-bridges"])
+	require.Equal(t, []nft.SetElement{
+		{Key: []byte{169, 254, 128, 0}},
+		{Key: []byte{169, 255, 0, 0}, IntervalEnd: true},
+	}, c.sets["ip azure-cni masquerade"])
+	require.Equal(t, []nft.SetElement{
+		{Key: []byte{168, 63, 129, 16}},
+		{Key: []byte{168, 63, 129, 17}, IntervalEnd: true},
+	}, c.sets["ip azure-cni snat-bridge-allow"])
+	require.Len(t, c.sets["ip azure-cni snat-bridge-block"], 4)
+}
+
+func TestHostNCPairs(t *testing.T) {
+	c := newFakeConn()
+	client := newFakeClient(c)
+	hostIP, ncIP := net.ParseIP("169.254.128.1"), net.ParseIP("169.254.128.10")
+
+	require.NoError(t, client.AllowHostToNC(hostIP, ncIP))
+	require.NoError(t, client.AllowHostToNC(hostIP, ncIP))
+	require.NoError(t, client.AllowNCToHost(ncIP, hostIP))
+	require.Equal(t, []nft.SetElement{{Key: []byte{169, 254, 128, 1, 169, 254, 128, 10}}}, c.sets["ip azure-cni host-to-nc"])
+	require.Equal(t, []nft.SetElement{{Key: []byte{169, 254, 128, 10, 169, 254, 128, 1}}}, c.sets["ip azure-cni nc-to-host"])
+
+	require.NoError(t, client.DeleteHostToNC(hostIP, ncIP))
+	require.NoError(t, client.DeleteHostToNC(hostIP, ncIP))
+	require.NoError(t, client.DeleteNCToHost(ncIP, hostIP))
+	require.Empty(t, c.sets["ip azure-cni host-to-nc"])
+	require.Empty(t, c.sets["ip azure-cni nc-to-host"])
+}
+
+func TestIntervalElements(t *testing.T) {
+	tests := []struct {
+		subnet string
+		want   []nft.SetElement
+	}{
+		{"10.0.1.5/32", []nft.SetElement{{Key: []byte{10, 0, 1, 5}}, {Key: []byte{10, 0, 1, 6}, IntervalEnd: true}}},
+		{"10.0.1.7/24", []nft.SetElement{{Key: []byte{10, 0, 1, 0}}, {Key: []byte{10, 0, 2, 0}, IntervalEnd: true}}},
+		{"10.255.255.0/24", []nft.SetElement{{Key: []byte{10, 255, 255, 0}}, {Key: []byte{11, 0, 0, 0}, IntervalEnd: true}}},
+		{"255.255.255.0/24", []nft.SetElement{{Key: []byte{255, 255, 255, 0}}}},
+		{"0.0.0.0/0", []nft.SetElement{{Key: []byte{0, 0, 0, 0}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.subnet, func(t *testing.T) {
+			require.Equal(t, tt.want, intervalElements(ipv4, mustParseCIDR(t, tt.subnet), nil))
+		})
+	}
+}
+
+const testIptablesSave = `*nat
+:POSTROUTING ACCEPT [0:0]
+:SWIFT - [0:0]
+:SWIFT-POSTROUTING - [0:0]
+-A POSTROUTING -j SWIFT-POSTROUTING
+-A POSTROUTING -j SWIFT
+-A SWIFT -s 10.0.1.0/24 -d 168.63.129.16/32 -p udp -m udp --dport 53 -j SNAT --to-source 10.0.1.20
+-A SWIFT-POSTROUTING -s 10.0.1.0/24 -d 168.63.129.16/32 -p udp -m udp --dport 53 -j SNAT --to-source 10.0.0.3
+COMMIT
+*filter
+:INPUT ACCEPT [0:0]
+:FORWARD ACCEPT [0:0]
+:OUTPUT ACCEPT [0:0]
+-A FORWARD -i azSnatbr -d 10.0.0.0/8 -j DROP
+-A FORWARD -j ACCEPT
+-A OUTPUT -o azSnatbr -d 169.254.0.0/16 -j DROP
+COMMIT
+`
+
+func TestMigrateFromIptables(t *testing.T) {
+	mockPL := platform.NewMockExecClient(false)
+	var restores []string
+	mockPL.SetExecRawCommand(func(cmd string) (string, error) {
+		if strings.HasPrefix(cmd, "iptables-save") {
+			return testIptablesSave, nil
+		}
+		if strings.Contains(cmd, " -C ") {
+			return "", platform.ErrMockExec
+		}
+		restores = append(restores, cmd)
+		return "", nil
+	})
+
+	require.NoError(t, MigrateFromIptables(iptables.NewClientWithExecClient(mockPL), "azSnatbr"))
+	require.Len(t, restores, 1)
+	for _, line := range []string{
+		"-D POSTROUTING -j SWIFT\n",
+		"-D POSTROUTING -j SWIFT-POSTROUTING\n",
+		"-F SWIFT\n-X SWIFT\n",
+		"-F SWIFT-POSTROUTING\n-X SWIFT-POSTROUTING\n",
+		"-D FORWARD -i azSnatbr -d 10.0.0.0/8 -j DROP\n",
+		"-D OUTPUT -o azSnatbr -d 169.254.0.0/16 -j DROP\n",
+	} {
+		require.Contains(t, restores[0], line)
+	}
+	require.NotContains(t, restores[0], "-D FORWARD -j ACCEPT")
+	require.NotContains(t, restores[0], "-D INPUT")
+	require.NotContains(t, restores[0], "AZURECNI")
+}
@@ -9,9 +9,11 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/Azure/azure-container-networking/nmagent/internal"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/pkg/errors"
 )
 
@@ -21,18 +23,31 @@ func NewClient(c Config) (*Client, error) {
 		return nil, errors.Wrap(err, "validating config")
 	}
 
+	policy := c.ClientPolicy.withDefaults()
+	var budget *internal.RetryBudget
+	if policy.RetryBudget > 0 {
+		budget = internal.NewRetryBudget(policy.RetryBudget, policy.RetryTokenRatio)
+	}
+
 	client := &Client{
-		httpClient: &http.Client{
-			Transport: &internal.WireserverTransport{
-				Transport: http.DefaultTransport,
-			},
-		},
 		host:      c.Host,
 		port:      c.Port,
 		enableTLS: c.UseTLS,
 		retrier: internal.Retrier{
 			// nolint:gomnd // the base parameter is explained in the function
 			Cooldown: internal.Exponential(1*time.Second, 2),
+			Budget:   budget,
+		},
+		policy: policy,
+	}
+	client.httpClient = &http.Client{
+		Transport: &internal.HedgingTransport{
+			Transport: &internal.WireserverTransport{
+				// every attempt is traced, so hedged and retried requests show up as separate spans
+				Transport: tracing.NewTransport(http.DefaultTransport),
+			},
+			Delay:   policy.HedgeDelay,
+			OnHedge: client.onHedge,
 		},
 	}
 
@@ -51,6 +66,24 @@ type Client struct {
 	retrier interface {
 		Do(context.Context, func() error) error
 	}
+
+	policy     ClientPolicy
+	breakersMu sync.Mutex
+	breakers   map[string]*internal.Breaker
+}
+
+// BreakerStates returns the state of the circuit breaker of every endpoint
+// which has been called, keyed by endpoint. Endpoints are named after the
+// methods of the Client, e.g. "GetNCVersionList".
+func (c *Client) BreakerStates() map[string]BreakerState {
+	c.breakersMu.Lock()
+	defer c.breakersMu.Unlock()
+
+	states := make(map[string]BreakerState, len(c.breakers))
+	for endpoint, breaker := range c.breakers {
+		states[endpoint] = breakerState(breaker.State())
+	}
+	return states
 }
 
 // JoinNetwork joins a node to a customer's virtual network.
@@ -61,7 +94,7 @@ func (c *Client) JoinNetwork(ctx context.Context, jnr JoinNetworkRequest) error
 	}
 
 	err = c.retrier.Do(ctx, func() error {
-		resp, err := c.httpClient.Do(req) // nolint:govet // the shadow is intentional
+		resp, err := c.do("JoinNetwork", req) // nolint:govet // the shadow is intentional
 		if err != nil {
 			return errors.Wrap(err, "executing request")
 		}
@@ -83,7 +116,7 @@ func (c *Client) DeleteNetwork(ctx context.Context, dnr DeleteNetworkRequest) er
 		return errors.Wrap(err, "building request")
 	}
 
-	resp, err := c.httpClient.Do(req) // nolint:govet // the shadow is intentional
+	resp, err := c.do("DeleteNetwork", req) // nolint:govet // the shadow is intentional
 	if err != nil {
 		return errors.Wrap(err, "submitting request")
 	}
@@ -106,7 +139,7 @@ func (c *Client) GetNetworkConfiguration(ctx context.Context, gncr GetNetworkCon
 	}
 
 	err = c.retrier.Do(ctx, func() error {
-		resp, err := c.httpClient.Do(req) // nolint:govet // the shadow is intentional
+		resp, err := c.do("GetNetworkConfiguration", req) // nolint:govet // the shadow is intentional
 		if err != nil {
 			return errors.Wrap(err, "executing http request to")
 		}
@@ -144,7 +177,7 @@ func (c *Client) GetNCVersion(ctx context.Context, ncvr NCVersionRequest) (NCVer
 		return NCVersion{}, errors.Wrap(err, "building request")
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do("GetNCVersion", req)
 	if err != nil {
 		return NCVersion{}, errors.Wrap(err, "submitting request")
 	}
@@ -171,7 +204,7 @@ func (c *Client) PutNetworkContainer(ctx context.Context, pncr *PutNetworkContai
 		return errors.Wrap(err, "building request")
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do("PutNetworkContainer", req)
 	if err != nil {
 		return errors.Wrap(err, "submitting request")
 	}
@@ -192,7 +225,7 @@ func (c *Client) SupportedAPIs(ctx context.Context) ([]string, error) {
 		return nil, errors.Wrap(err, "building request")
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do("SupportedAPIs", req)
 	if err != nil {
 		return nil, errors.Wrap(err, "submitting request")
 	}
@@ -218,7 +251,7 @@ func (c *Client) DeleteNetworkContainer(ctx context.Context, dcr DeleteContainer
 		return errors.Wrap(err, "building request")
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do("DeleteNetworkContainer", req)
 	if err != nil {
 		return errors.Wrap(err, "submitting request")
 	}
@@ -237,7 +270,7 @@ func (c *Client) GetNCVersionList(ctx context.Context) (NCVersionList, error) {
 		return NCVersionList{}, errors.Wrap(err, "building request")
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do("GetNCVersionList", req)
 	if err != nil {
 		return NCVersionList{}, errors.Wrap(err, "submitting request")
 	}
@@ -265,7 +298,7 @@ func (c *Client) GetHomeAz(ctx context.Context) (AzResponse, error) {
 		return homeAzResponse, errors.Wrap(err, "building request")
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do("GetHomeAz", req)
 	if err != nil {
 		return homeAzResponse, errors.Wrap(err, "submitting request")
 	}
@@ -292,7 +325,7 @@ func (c *Client) GetInterfaceIPInfo(ctx context.Context) (Interfaces, error) {
 		return out, errors.Wrap(err, "building request")
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do("GetInterfaceIPInfo", req)
 	if err != nil {
 		return out, errors.Wrap(err, "submitting request")
 	}
@@ -314,6 +347,75 @@ func (c *Client) GetInterfaceIPInfo(ctx context.Context) (Interfaces, error) {
 	return out, nil
 }
 
+// endpointKey is the context key of the endpoint which a request is made to.
+type endpointKey struct{}
+
+// do executes a request to an endpoint through the endpoint's circuit breaker.
+// Server errors and transport failures count against the breaker, while errors
+// which NMAgent returns deliberately, such as a 404 for an unknown NC, don't.
+func (c *Client) do(endpoint string, req *http.Request) (*http.Response, error) {
+	breaker := c.breaker(endpoint)
+	if breaker != nil {
+		if err := breaker.Allow(); err != nil {
+			return nil, errors.Wrapf(err, "calling %s", endpoint)
+		}
+	}
+
+	ctx := req.Context()
+	resp, err := c.httpClient.Do(req.WithContext(context.WithValue(ctx, endpointKey{}, endpoint)))
+	if breaker == nil {
+		return resp, err // nolint:wrapcheck // callers wrap this error
+	}
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// the caller gave up, which says nothing about NMAgent
+		breaker.Abandon()
+	case err != nil, resp.StatusCode >= http.StatusInternalServerError:
+		breaker.Failure()
+	default:
+		breaker.Success()
+	}
+	return resp, err // nolint:wrapcheck // callers wrap this error
+}
+
+// breaker returns the circuit breaker of an endpoint, creating it on first
+// use, or nil if breakers are disabled.
+func (c *Client) breaker(endpoint string) *internal.Breaker {
+	if c.policy.BreakerThreshold <= 0 {
+		return nil
+	}
+
+	c.breakersMu.Lock()
+	defer c.breakersMu.Unlock()
+
+	if breaker, ok := c.breakers[endpoint]; ok {
+		return breaker
+	}
+	if c.breakers == nil {
+		c.breakers = make(map[string]*internal.Breaker)
+	}
+	breaker := &internal.Breaker{
+		Threshold: c.policy.BreakerThreshold,
+		Cooldown:  c.policy.BreakerCooldown,
+	}
+	if onChange := c.policy.OnBreakerStateChange; onChange != nil {
+		breaker.OnStateChange = func(state internal.BreakerState) {
+			onChange(endpoint, breakerState(state))
+		}
+	}
+	c.breakers[endpoint] = breaker
+	return breaker
+}
+
+func (c *Client) onHedge(req *http.Request) {
+	if c.policy.OnHedge == nil {
+		return
+	}
+	if endpoint, ok := req.Context().Value(endpointKey{}).(string); ok {
+		c.policy.OnHedge(endpoint)
+	}
+}
+
 func die(code int, headers http.Header, body io.ReadCloser, path string) error {
 	// nolint:errcheck // make a best effort to return whatever information we can
 	// returning an error here without the code and source would
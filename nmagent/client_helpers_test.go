@@ -9,16 +9,36 @@ import (
 // NewTestClient is a factory function available in tests only for creating
 // NMAgent clients with a mock transport
 func NewTestClient(transport http.RoundTripper) *Client {
-	return &Client{
-		httpClient: &http.Client{
-			Transport: &internal.WireserverTransport{
-				Transport: transport,
-			},
-		},
+	// tests retry as often as they like, so the zero policy disables the retry budget
+	return NewTestClientWithPolicy(transport, ClientPolicy{})
+}
+
+// NewTestClientWithPolicy creates an NMAgent client with a mock transport
+// which applies the provided policy
+func NewTestClientWithPolicy(transport http.RoundTripper, policy ClientPolicy) *Client {
+	policy = policy.withDefaults()
+	var budget *internal.RetryBudget
+	if policy.RetryBudget > 0 {
+		budget = internal.NewRetryBudget(policy.RetryBudget, policy.RetryTokenRatio)
+	}
+
+	c := &Client{
 		host: "localhost",
 		port: 12345,
 		retrier: internal.Retrier{
 			Cooldown: internal.AsFastAsPossible(),
+			Budget:   budget,
+		},
+		policy: policy,
+	}
+	c.httpClient = &http.Client{
+		Transport: &internal.HedgingTransport{
+			Transport: &internal.WireserverTransport{
+				Transport: transport,
+			},
+			Delay:   policy.HedgeDelay,
+			OnHedge: c.onHedge,
 		},
 	}
+	return c
 }
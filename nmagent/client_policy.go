@@ -0,0 +1,100 @@
+package nmagent
+
+import (
+	"time"
+
+	"github.com/Azure/azure-container-networking/nmagent/internal"
+)
+
+// ErrBreakerOpen is returned, wrapped, by calls to an endpoint whose circuit
+// breaker is open. The call is rejected without contacting NMAgent.
+const ErrBreakerOpen = internal.ErrBreakerOpen
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 10 * time.Second
+	defaultRetryBudget      = 10
+	defaultRetryTokenRatio  = 0.1
+)
+
+// BreakerState is the state of the circuit breaker of an NMAgent endpoint.
+type BreakerState string
+
+const (
+	// BreakerClosed means the endpoint is healthy and calls go through.
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen means the endpoint has failed repeatedly and calls are
+	// rejected until its cooldown has elapsed.
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen means the cooldown has elapsed and the next call will
+	// probe whether the endpoint has recovered.
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// ClientPolicy governs how a Client behaves when NMAgent is unhealthy, e.g. during
+// a host agent upgrade. Every endpoint of the Client has its own circuit
+// breaker, which trips after consecutive server errors or transport failures
+// and rejects calls until NMAgent has had time to recover. Retries of all
+// calls are drawn from a single, shared retry budget so that independent
+// callers can't multiply the load on NMAgent. The zero value disables the
+// breakers, the retry budget and hedging, so that a Client retries as it
+// always has unless a policy such as DefaultClientPolicy is provided.
+type ClientPolicy struct {
+	// BreakerThreshold is the number of consecutive failures of an endpoint
+	// which opens its breaker. Zero or a negative value disables the breakers.
+	BreakerThreshold int
+	// BreakerCooldown is how long a breaker stays open before a probe call is
+	// let through. Zero selects the default.
+	BreakerCooldown time.Duration
+	// RetryBudget is the number of tokens in the shared retry budget. Every
+	// failed attempt takes a token, and retries are only made while more than
+	// half of the budget remains. Zero or a negative value disables the budget.
+	RetryBudget float64
+	// RetryTokenRatio is the fraction of a token which every successful
+	// attempt returns to the budget. Zero selects the default.
+	RetryTokenRatio float64
+	// HedgeDelay is how long an idempotent GET waits for a response before a
+	// second, hedged request is sent. Zero disables hedging.
+	HedgeDelay time.Duration
+
+	// OnBreakerStateChange, if set, is called whenever the breaker of an
+	// endpoint changes state, e.g. to export it as a metric. It must not block.
+	OnBreakerStateChange func(endpoint string, state BreakerState)
+	// OnHedge, if set, is called whenever a hedged request is sent to an
+	// endpoint.
+	OnHedge func(endpoint string)
+}
+
+// DefaultClientPolicy returns a policy which enables the breakers and the
+// retry budget with their recommended settings. Hedging stays disabled.
+func DefaultClientPolicy() ClientPolicy {
+	return ClientPolicy{
+		BreakerThreshold: defaultBreakerThreshold,
+		BreakerCooldown:  defaultBreakerCooldown,
+		RetryBudget:      defaultRetryBudget,
+		RetryTokenRatio:  defaultRetryTokenRatio,
+	}
+}
+
+// withDefaults returns the policy with the unset settings of its enabled
+// features replaced by defaults. Disabled features stay disabled.
+func (p ClientPolicy) withDefaults() ClientPolicy {
+	if p.BreakerThreshold > 0 && p.BreakerCooldown == 0 {
+		p.BreakerCooldown = defaultBreakerCooldown
+	}
+	if p.RetryBudget > 0 && p.RetryTokenRatio == 0 {
+		p.RetryTokenRatio = defaultRetryTokenRatio
+	}
+	return p
+}
+
+func breakerState(s internal.BreakerState) BreakerState {
+	switch s {
+	case internal.BreakerOpen:
+		return BreakerOpen
+	case internal.BreakerHalfOpen:
+		return BreakerHalfOpen
+	default:
+		return BreakerClosed
+	}
+}
@@ -0,0 +1,152 @@
+package nmagent_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/nmagent"
+)
+
+func TestClientPolicyBreaker(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	status := http.StatusInternalServerError
+	calls := 0
+	var changes []nmagent.BreakerState
+	client := nmagent.NewTestClientWithPolicy(&TestTripper{
+		RoundTripF: func(_ *http.Request) (*http.Response, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls++
+			rr := httptest.NewRecorder()
+			_, _ = fmt.Fprintf(rr, `{"httpStatusCode":"%d","containers":[]}`, status)
+			rr.WriteHeader(http.StatusOK)
+			return rr.Result(), nil
+		},
+	}, nmagent.ClientPolicy{
+		BreakerThreshold: 3,
+		BreakerCooldown:  time.Hour,
+		OnBreakerStateChange: func(endpoint string, state nmagent.BreakerState) {
+			if endpoint == "GetNCVersionList" {
+				changes = append(changes, state)
+			}
+		},
+	})
+
+	ctx, cancel := testContext(t)
+	defer cancel()
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.GetNCVersionList(ctx); err == nil {
+			t.Fatal("expected an error from a failing NMAgent")
+		}
+	}
+
+	// the breaker is now open and calls don't reach NMAgent
+	_, err := client.GetNCVersionList(ctx)
+	if !errors.Is(err, nmagent.ErrBreakerOpen) {
+		t.Fatal("expected the breaker to reject the call: err:", err)
+	}
+	if calls != 3 {
+		t.Error("unexpected number of calls to NMAgent: got:", calls, "exp:", 3)
+	}
+	if got := client.BreakerStates()["GetNCVersionList"]; got != nmagent.BreakerOpen {
+		t.Error("unexpected breaker state: got:", got, "exp:", nmagent.BreakerOpen)
+	}
+	if len(changes) != 1 || changes[0] != nmagent.BreakerOpen {
+		t.Error("unexpected breaker state changes: got:", changes)
+	}
+
+	// other endpoints have their own breakers, and errors which NMAgent returns
+	// deliberately don't count as failures
+	mu.Lock()
+	status = http.StatusNotFound
+	mu.Unlock()
+	for i := 0; i < 5; i++ {
+		_, err := client.GetHomeAz(ctx)
+		if errors.Is(err, nmagent.ErrBreakerOpen) {
+			t.Fatal("unexpected open breaker for GetHomeAz")
+		}
+	}
+	if got := client.BreakerStates()["GetHomeAz"]; got != nmagent.BreakerClosed {
+		t.Error("unexpected breaker state: got:", got, "exp:", nmagent.BreakerClosed)
+	}
+}
+
+func TestClientPolicyDisabledBreaker(t *testing.T) {
+	t.Parallel()
+
+	client := nmagent.NewTestClientWithPolicy(&TestTripper{
+		RoundTripF: func(_ *http.Request) (*http.Response, error) {
+			rr := httptest.NewRecorder()
+			_, _ = rr.WriteString(`{"httpStatusCode":"500"}`)
+			return rr.Result(), nil
+		},
+	}, nmagent.ClientPolicy{}) // the zero policy disables the breakers
+
+	ctx, cancel := testContext(t)
+	defer cancel()
+
+	for i := 0; i < 10; i++ {
+		if _, err := client.GetNCVersionList(ctx); errors.Is(err, nmagent.ErrBreakerOpen) {
+			t.Fatal("unexpected open breaker with breakers disabled")
+		}
+	}
+	if states := client.BreakerStates(); len(states) != 0 {
+		t.Error("unexpected breakers:", states)
+	}
+}
+
+func TestClientPolicyHedge(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	attempts := 0
+	var hedged []string
+	client := nmagent.NewTestClientWithPolicy(&TestTripper{
+		RoundTripF: func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			attempts++
+			first := attempts == 1
+			mu.Unlock()
+			if first {
+				// the first attempt hangs until it's canceled
+				<-req.Context().Done()
+				return nil, req.Context().Err()
+			}
+			rr := httptest.NewRecorder()
+			_, _ = rr.WriteString(`{"httpStatusCode":"200","homeAz":1,"apiVersion":2}`)
+			return rr.Result(), nil
+		},
+	}, nmagent.ClientPolicy{
+		HedgeDelay: 10 * time.Millisecond,
+		OnHedge: func(endpoint string) {
+			mu.Lock()
+			defer mu.Unlock()
+			hedged = append(hedged, endpoint)
+		},
+	})
+
+	ctx, cancel := testContext(t)
+	defer cancel()
+
+	got, err := client.GetHomeAz(ctx)
+	if err != nil {
+		t.Fatal("unexpected error: err:", err)
+	}
+	if got.HomeAz != 1 {
+		t.Error("unexpected home AZ: got:", got.HomeAz, "exp:", 1)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(hedged) != 1 || hedged[0] != "GetHomeAz" {
+		t.Error("unexpected hedged endpoints: got:", hedged)
+	}
+}
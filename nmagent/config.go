@@ -21,7 +21,8 @@ type Config struct {
 	/////////////////////
 	// Optional Config //
 	/////////////////////
-	UseTLS bool // forces all connections to use TLS
+	UseTLS       bool         // forces all connections to use TLS
+	ClientPolicy ClientPolicy // governs retries, circuit breaking, and hedging
 }
 
 // Validate reports whether this configuration is a valid configuration for a
@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	ErrBreakerOpen = Error("circuit breaker is open")
+)
+
+// BreakerState is the state of a Breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets all calls through.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects all calls until its cooldown has elapsed.
+	BreakerOpen
+	// BreakerHalfOpen lets a single probe call through to decide whether to
+	// close or re-open.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Breaker is a circuit breaker which opens after a number of consecutive
+// failures and rejects calls until a cooldown has elapsed. After the cooldown,
+// a single probe call is let through: it closes the breaker if it succeeds and
+// re-opens it if it fails.
+type Breaker struct {
+	Threshold int           // consecutive failures which open the breaker
+	Cooldown  time.Duration // how long the breaker stays open before probing
+
+	// OnStateChange, if set, is called with the new state whenever the state
+	// changes. It is called with the breaker's lock held, so it must not call
+	// back into the breaker.
+	OnStateChange func(BreakerState)
+
+	// Now is the clock of the breaker. It defaults to time.Now.
+	Now func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// Allow reports whether a call may proceed. It returns ErrBreakerOpen while
+// the breaker is open, or half-open with a probe already in flight. Every
+// allowed call must be followed by exactly one of Success, Failure, or Abandon.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.Cooldown {
+			return ErrBreakerOpen
+		}
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrBreakerOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Success records a successful call, which closes the breaker.
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	b.setState(BreakerClosed)
+}
+
+// Failure records a failed call. It opens the breaker once the threshold of
+// consecutive failures is reached, or immediately if the call was a probe.
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.Threshold {
+		b.probing = false
+		b.openedAt = b.now()
+		b.setState(BreakerOpen)
+	}
+}
+
+// Abandon records a call whose outcome says nothing about the health of the
+// remote end, such as one canceled by its caller. It only releases the probe
+// of a half-open breaker so that another call may probe.
+func (b *Breaker) Abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// State returns the current state of the breaker. An open breaker whose
+// cooldown has elapsed is reported as half-open, since the next call will
+// probe.
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.Cooldown {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+func (b *Breaker) setState(state BreakerState) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	if b.OnStateChange != nil {
+		b.OnStateChange(state)
+	}
+}
+
+func (b *Breaker) now() time.Time {
+	if b.Now != nil {
+		return b.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	var changes []BreakerState
+	b := &Breaker{
+		Threshold:     3,
+		Cooldown:      10 * time.Second,
+		Now:           func() time.Time { return now },
+		OnStateChange: func(s BreakerState) { changes = append(changes, s) },
+	}
+
+	// failures below the threshold, interrupted by a success, keep it closed
+	for i := 0; i < 2; i++ {
+		if err := b.Allow(); err != nil {
+			t.Fatal("unexpected error: err:", err)
+		}
+		b.Failure()
+	}
+	b.Success()
+	if got := b.State(); got != BreakerClosed {
+		t.Fatal("unexpected state: got:", got, "exp:", BreakerClosed)
+	}
+
+	for i := 0; i < 3; i++ {
+		b.Failure()
+	}
+	if got := b.State(); got != BreakerOpen {
+		t.Fatal("unexpected state: got:", got, "exp:", BreakerOpen)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrBreakerOpen) {
+		t.Fatal("expected open breaker to reject the call: err:", err)
+	}
+
+	// after the cooldown a single probe is let through, and its failure re-opens the breaker
+	now = now.Add(10 * time.Second)
+	if got := b.State(); got != BreakerHalfOpen {
+		t.Fatal("unexpected state: got:", got, "exp:", BreakerHalfOpen)
+	}
+	if err := b.Allow(); err != nil {
+		t.Fatal("expected the probe to be allowed: err:", err)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrBreakerOpen) {
+		t.Fatal("expected a second probe to be rejected: err:", err)
+	}
+	b.Failure()
+	if err := b.Allow(); !errors.Is(err, ErrBreakerOpen) {
+		t.Fatal("expected failed probe to re-open the breaker: err:", err)
+	}
+
+	// an abandoned probe lets another call probe, and a successful probe closes the breaker
+	now = now.Add(10 * time.Second)
+	if err := b.Allow(); err != nil {
+		t.Fatal("expected the probe to be allowed: err:", err)
+	}
+	b.Abandon()
+	if err := b.Allow(); err != nil {
+		t.Fatal("expected another probe after abandoning the first: err:", err)
+	}
+	b.Success()
+	if got := b.State(); got != BreakerClosed {
+		t.Fatal("unexpected state: got:", got, "exp:", BreakerClosed)
+	}
+
+	exp := []BreakerState{BreakerOpen, BreakerHalfOpen, BreakerOpen, BreakerHalfOpen, BreakerClosed}
+	if len(changes) != len(exp) {
+		t.Fatal("unexpected state changes: got:", changes, "exp:", exp)
+	}
+	for i := range exp {
+		if changes[i] != exp[i] {
+			t.Error("unexpected state change: got:", changes[i], "exp:", exp[i])
+		}
+	}
+}
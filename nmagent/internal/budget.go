@@ -0,0 +1,53 @@
+package internal
+
+import "sync"
+
+const (
+	ErrRetryBudgetExhausted = Error("retry budget exhausted")
+)
+
+// RetryBudget is a token bucket shared by Retriers which throttles retries
+// when most calls are failing. Every failed attempt takes a token and every
+// successful one returns a fraction of a token. Retries are only permitted
+// while more than half of the tokens remain, so a remote end which keeps
+// failing sees at most one attempt per call instead of a retry storm.
+type RetryBudget struct {
+	mu        sync.Mutex
+	maxTokens float64
+	ratio     float64
+	tokens    float64
+}
+
+// NewRetryBudget creates a full RetryBudget holding maxTokens tokens, where
+// each success returns ratio tokens.
+func NewRetryBudget(maxTokens, ratio float64) *RetryBudget {
+	return &RetryBudget{
+		maxTokens: maxTokens,
+		ratio:     ratio,
+		tokens:    maxTokens,
+	}
+}
+
+// Success returns tokens to the budget after a successful attempt.
+func (b *RetryBudget) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens += b.ratio
+	if b.tokens > b.maxTokens {
+		b.tokens = b.maxTokens
+	}
+}
+
+// Failure takes a token from the budget after a failed attempt and reports
+// whether the attempt may be retried.
+func (b *RetryBudget) Failure() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens--
+	if b.tokens < 0 {
+		b.tokens = 0
+	}
+	return b.tokens > b.maxTokens/2 //nolint:gomnd // retries are permitted above half the budget
+}
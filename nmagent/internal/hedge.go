@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+var _ http.RoundTripper = &HedgingTransport{}
+
+// HedgingTransport is an http.RoundTripper which hedges GET requests: if the
+// first attempt hasn't produced a response after Delay, a second, identical
+// attempt is sent and whichever responds first wins. The loser is canceled.
+// Only GETs are hedged since they are idempotent and have no body. A Delay of
+// zero disables hedging.
+type HedgingTransport struct {
+	Transport http.RoundTripper
+	Delay     time.Duration
+
+	// OnHedge, if set, is called whenever a hedged attempt is sent.
+	OnHedge func(*http.Request)
+}
+
+type hedgeResult struct {
+	attempt int
+	resp    *http.Response
+	err     error
+}
+
+// RoundTrip executes the request, hedging it if it's a GET.
+func (h *HedgingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if h.Delay <= 0 || req.Method != http.MethodGet {
+		return h.Transport.RoundTrip(req) // nolint:wrapcheck // the transport is transparent
+	}
+
+	// the channel is buffered for both attempts so that the loser never blocks
+	results := make(chan hedgeResult, 2) //nolint:gomnd // the original and the hedge
+	var cancels []context.CancelFunc
+	send := func() {
+		ctx, cancel := context.WithCancel(req.Context())
+		attempt := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			resp, err := h.Transport.RoundTrip(req.Clone(ctx))
+			results <- hedgeResult{attempt: attempt, resp: resp, err: err}
+		}()
+	}
+	// cancelOthers cancels every attempt but the winner and drains their results
+	cancelOthers := func(winner, inflight int) {
+		for i, cancel := range cancels {
+			if i != winner {
+				cancel()
+			}
+		}
+		go discard(results, inflight)
+	}
+
+	send()
+	inflight := 1
+	timer := time.NewTimer(h.Delay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			if h.OnHedge != nil {
+				h.OnHedge(req)
+			}
+			send()
+			inflight++
+		case res := <-results:
+			inflight--
+			if res.err != nil {
+				cancels[res.attempt]()
+				if inflight > 0 {
+					// the other attempt may still succeed
+					continue
+				}
+				return nil, res.err
+			}
+			cancelOthers(res.attempt, inflight)
+			// the winner's context has to outlive the round trip until its
+			// body has been read, so it is canceled when the body is closed
+			res.resp.Body = &cancelBody{ReadCloser: res.resp.Body, cancel: cancels[res.attempt]}
+			return res.resp, nil
+		case <-req.Context().Done():
+			cancelOthers(-1, inflight)
+			return nil, req.Context().Err() // nolint:wrapcheck // no meaningful information can be added to this error
+		}
+	}
+}
+
+// discard waits for the remaining attempts and closes their responses.
+func discard(results <-chan hedgeResult, remaining int) {
+	for i := 0; i < remaining; i++ {
+		if res := <-results; res.resp != nil {
+			res.resp.Body.Close()
+		}
+	}
+}
+
+// cancelBody cancels the context of its request once it's closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelBody) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close() // nolint:wrapcheck // the body is transparent
+}
@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestHedgingTransport(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		expBody   string
+		expHedged bool
+	}{
+		{
+			"slow GET is hedged",
+			http.MethodGet,
+			"second",
+			true,
+		},
+		{
+			"POST is never hedged",
+			http.MethodPost,
+			"first",
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var attempts int32
+			firstCanceled := make(chan struct{})
+			var hedged int32
+			transport := &HedgingTransport{
+				Delay: 10 * time.Millisecond,
+				Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					rr := httptest.NewRecorder()
+					if atomic.AddInt32(&attempts, 1) == 1 {
+						// the first attempt is slow, unless it isn't hedged
+						select {
+						case <-req.Context().Done():
+							close(firstCanceled)
+							return nil, req.Context().Err()
+						case <-time.After(100 * time.Millisecond):
+						}
+						rr.WriteString("first")
+						return rr.Result(), nil
+					}
+					rr.WriteString("second")
+					return rr.Result(), nil
+				}),
+				OnHedge: func(*http.Request) { atomic.AddInt32(&hedged, 1) },
+			}
+
+			var body io.Reader
+			if test.method == http.MethodPost {
+				body = strings.NewReader("{}")
+			}
+			req := httptest.NewRequest(test.method, "http://localhost/", body)
+			resp, err := transport.RoundTrip(req)
+			if err != nil {
+				t.Fatal("unexpected error: err:", err)
+			}
+			got, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatal("unexpected error reading body: err:", err)
+			}
+
+			if string(got) != test.expBody {
+				t.Error("unexpected body: got:", string(got), "exp:", test.expBody)
+			}
+			if (atomic.LoadInt32(&hedged) == 1) != test.expHedged {
+				t.Error("unexpected hedging: hedged:", atomic.LoadInt32(&hedged), "exp hedged:", test.expHedged)
+			}
+			if test.expHedged {
+				select {
+				case <-firstCanceled:
+				case <-time.After(time.Second):
+					t.Error("expected the losing attempt to be canceled")
+				}
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package internal
 import (
 	"context"
 	"errors"
+	"fmt"
 	"math"
 	"time"
 
@@ -25,9 +26,11 @@ type TemporaryError interface {
 }
 
 // Retrier is a construct for attempting some operation multiple times with a
-// configurable backoff strategy.
+// configurable backoff strategy. An optional Budget, which may be shared
+// between Retriers, limits retries across all of their calls.
 type Retrier struct {
 	Cooldown CooldownFactory
+	Budget   *RetryBudget
 }
 
 // Do repeatedly invokes the provided run function while the context remains
@@ -47,6 +50,9 @@ func (r Retrier) Do(ctx context.Context, run func() error) error {
 			// check to see if it's temporary.
 			var tempErr TemporaryError
 			if ok := errors.As(err, &tempErr); ok && tempErr.Temporary() {
+				if r.Budget != nil && !r.Budget.Failure() {
+					return fmt.Errorf("%w: %w", ErrRetryBudgetExhausted, err)
+				}
 				delay, err := cooldown() // nolint:govet // the shadow is intentional
 				if err != nil {
 					return pkgerrors.Wrap(err, "sleeping during retry")
@@ -58,6 +64,9 @@ func (r Retrier) Do(ctx context.Context, run func() error) error {
 			// since it's not temporary, it can't be retried, so...
 			return err
 		}
+		if r.Budget != nil {
+			r.Budget.Success()
+		}
 		return nil
 	}
 }
@@ -162,3 +162,55 @@ func TestMax(t *testing.T) {
 		t.Errorf("expected an error after %d invocations but received none", exp+1)
 	}
 }
+
+func TestRetryBudget(t *testing.T) {
+	budget := NewRetryBudget(4, 1)
+	ctx := context.Background()
+
+	rt := Retrier{
+		Cooldown: AsFastAsPossible(),
+		Budget:   budget,
+	}
+
+	// a remote end which never recovers exhausts half of the budget, and then
+	// every call is attempted only once
+	got := 0
+	err := rt.Do(ctx, func() error {
+		got++
+		return TestError{}
+	})
+	if !errors.As(err, &TestError{}) {
+		t.Fatal("expected the last error to be returned: err:", err)
+	}
+	if !errors.Is(err, ErrRetryBudgetExhausted) {
+		t.Fatal("expected the exhausted budget to be reported: err:", err)
+	}
+	if exp := 2; got != exp {
+		t.Fatal("unexpected number of invocations: got:", got, "exp:", exp)
+	}
+
+	got = 0
+	_ = rt.Do(ctx, func() error {
+		got++
+		return TestError{}
+	})
+	if exp := 1; got != exp {
+		t.Fatal("unexpected number of invocations with an exhausted budget: got:", got, "exp:", exp)
+	}
+
+	// successes refill the budget
+	for i := 0; i < 4; i++ {
+		_ = rt.Do(ctx, func() error { return nil })
+	}
+	got = 0
+	_ = rt.Do(ctx, func() error {
+		got++
+		if got < 2 {
+			return TestError{}
+		}
+		return nil
+	})
+	if exp := 2; got != exp {
+		t.Fatal("unexpected number of invocations after refilling the budget: got:", got, "exp:", exp)
+	}
+}
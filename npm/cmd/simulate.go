@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Azure/azure-container-networking/npm/pkg/simulator"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	errManifestsNotSpecified = errors.New("at least one manifest file or directory must be specified")
+	errQueryNotSpecified     = errors.New("must specify either a queries file or both a source and a destination")
+	errUnexpectedVerdict     = errors.New("some flows didn't have the expected verdict")
+)
+
+func newSimulateCmd() *cobra.Command {
+	simulateCmd := &cobra.Command{
+		Use:   "simulate",
+		Short: "Evaluate flows offline against NetworkPolicies in Kubernetes manifests or a cluster snapshot",
+		Long: `Evaluate flows offline against NetworkPolicies in Kubernetes manifests or a cluster snapshot.
+Policies are translated with NPM's translation pipeline and evaluated like NPM's Linux dataplane.
+Results are printed as JSON. If a flow has an expected verdict which doesn't match, the command fails.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manifests, _ := cmd.Flags().GetStringSlice("manifests")
+			if len(manifests) == 0 {
+				return errManifestsNotSpecified
+			}
+			queries, err := simulateQueries(cmd)
+			if err != nil {
+				return err
+			}
+
+			s := simulator.NewSimulator()
+			if err := s.LoadPaths(manifests...); err != nil {
+				return fmt.Errorf("%w", err)
+			}
+
+			results := make([]*simulator.Result, 0, len(queries))
+			unexpected := false
+			for i := range queries {
+				result, err := s.Simulate(&queries[i])
+				if err != nil {
+					return fmt.Errorf("failed to simulate flow from %s to %s: %w", queries[i].Src, queries[i].Dst, err)
+				}
+				unexpected = unexpected || result.Unexpected
+				results = append(results, result)
+			}
+
+			output, err := json.MarshalIndent(results, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal results: %w", err)
+			}
+			fmt.Println(string(output))
+
+			if unexpected {
+				return errUnexpectedVerdict
+			}
+			return nil
+		},
+	}
+
+	simulateCmd.Flags().StringSliceP("manifests", "m", nil, "Set the manifest files or directories, e.g. the output of kubectl get namespaces,pods,networkpolicies -A -o yaml")
+	simulateCmd.Flags().StringP("queries", "q", "", "Set the YAML or JSON file with a list of flows (src, dst, port, protocol, expect)")
+	simulateCmd.Flags().StringP("src", "s", "", "Set the source as namespace/name of a pod or workload, or an IP address")
+	simulateCmd.Flags().StringP("dst", "d", "", "Set the destination as namespace/name of a pod or workload, or an IP address")
+	simulateCmd.Flags().Int32P("port", "p", 0, "Set the destination port")
+	simulateCmd.Flags().String("protocol", "TCP", "Set the protocol: TCP, UDP or SCTP")
+	simulateCmd.Flags().String("expect", "", "Set the expected verdict: allowed or denied")
+
+	return simulateCmd
+}
+
+// simulateQueries returns the flows from the queries file or the flags.
+func simulateQueries(cmd *cobra.Command) ([]simulator.Query, error) {
+	queriesFile, _ := cmd.Flags().GetString("queries")
+	src, _ := cmd.Flags().GetString("src")
+	dst, _ := cmd.Flags().GetString("dst")
+
+	if queriesFile != "" {
+		if src != "" || dst != "" {
+			return nil, errQueryNotSpecified
+		}
+		b, err := os.ReadFile(queriesFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read queries file: %w", err)
+		}
+		var queries []simulator.Query
+		if err := yaml.Unmarshal(b, &queries); err != nil {
+			return nil, fmt.Errorf("failed to parse queries file: %w", err)
+		}
+		return queries, nil
+	}
+
+	if src == "" || dst == "" {
+		return nil, errQueryNotSpecified
+	}
+	port, _ := cmd.Flags().GetInt32("port")
+	protocol, _ := cmd.Flags().GetString("protocol")
+	expect, _ := cmd.Flags().GetString("expect")
+	return []simulator.Query{{Src: src, Dst: dst, Port: port, Protocol: protocol, Expect: expect}}, nil
+}
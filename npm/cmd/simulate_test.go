@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+const (
+	simulateCmdString    = "simulate"
+	simulateManifestsDir = "../pkg/simulator/testdata"
+	simulateQueriesFile  = "../pkg/simulator/testdata/queries.yaml"
+)
+
+func TestSimulateCmd(t *testing.T) {
+	baseArgs := []string{simulateCmdString, "-m", simulateManifestsDir}
+
+	tests := []*testCases{
+		{
+			name:    "no manifests",
+			args:    []string{simulateCmdString, srcFlag, "shop/frontend", dstFlag, "shop/backend"},
+			wantErr: true,
+		},
+		{
+			name:    "no query",
+			args:    baseArgs,
+			wantErr: true,
+		},
+		{
+			name:    "no dst",
+			args:    concatArgs(baseArgs, srcFlag, "shop/frontend"),
+			wantErr: true,
+		},
+		{
+			name:    "queries file and flags",
+			args:    concatArgs(baseArgs, "-q", simulateQueriesFile, srcFlag, "shop/frontend"),
+			wantErr: true,
+		},
+		{
+			name:    "unknown pod",
+			args:    concatArgs(baseArgs, srcFlag, "shop/missing", dstFlag, "shop/backend"),
+			wantErr: true,
+		},
+		{
+			name:    "flow without expectation",
+			args:    concatArgs(baseArgs, srcFlag, "shop/frontend", dstFlag, "shop/backend", "-p", "80"),
+			wantErr: false,
+		},
+		{
+			name:    "flow with expected verdict",
+			args:    concatArgs(baseArgs, srcFlag, "shop/frontend", dstFlag, "shop/backend", "-p", "8080", "--expect", "allowed"),
+			wantErr: false,
+		},
+		{
+			name:    "flow with unexpected verdict",
+			args:    concatArgs(baseArgs, srcFlag, "shop/frontend", dstFlag, "shop/backend", "-p", "80", "--expect", "allowed"),
+			wantErr: true,
+		},
+		{
+			name:    "queries file",
+			args:    concatArgs(baseArgs, "-q", simulateQueriesFile),
+			wantErr: false,
+		},
+	}
+
+	testCommand(t, tests)
+}
@@ -3,8 +3,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
+	"net/netip"
 	"time"
 
 	"github.com/Azure/azure-container-networking/common"
@@ -13,16 +15,24 @@ import (
 	npmconfig "github.com/Azure/azure-container-networking/npm/config"
 	restserver "github.com/Azure/azure-container-networking/npm/http/server"
 	"github.com/Azure/azure-container-networking/npm/metrics"
+	policyv1alpha1 "github.com/Azure/azure-container-networking/npm/pkg/apis/policy/v1alpha1"
 	"github.com/Azure/azure-container-networking/npm/pkg/dataplane"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/bpf"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/fqdn"
 	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
 	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/verdictlog"
 	"github.com/Azure/azure-container-networking/npm/pkg/models"
 	"github.com/Azure/azure-container-networking/npm/util"
+	"github.com/Azure/azure-container-networking/otlp"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
 	k8sversion "k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -143,10 +153,19 @@ func start(config npmconfig.Config, flags npmconfig.Flags) error {
 	if err != nil {
 		klog.Infof("CreateTelemetryHandle failed with error %v. AITelemetry is not initialized.", err)
 	}
+	startOTLPExport(config)
 
 	var dp dataplane.GenericDataplane
 	stopChannel := wait.NeverStop
-	if config.Toggles.EnableV2NPM {
+	if config.Toggles.EnableV2NPM && config.Toggles.EnableBPFDataplane && !util.IsWindowsDP() {
+		program, err := bpf.LoadProgram()
+		if err != nil {
+			metrics.SendErrorLogAndMetric(util.NpmID, "error: failed to load BPF program with error %v", err)
+			return fmt.Errorf("failed to load BPF program with error %w", err)
+		}
+		klog.Info("enforcing NetworkPolicies with the BPF program")
+		dp = bpf.NewDataplane(models.GetNodeName(), program.Maps(), program)
+	} else if config.Toggles.EnableV2NPM {
 		// update the dataplane config
 		npmV2DataplaneCfg.EnableNPMLite = config.Toggles.EnableNPMLite
 
@@ -189,6 +208,11 @@ func start(config npmconfig.Config, flags npmconfig.Flags) error {
 		} else {
 			npmV2DataplaneCfg.IPSetMode = ipsets.ApplyAllIPSets
 		}
+		npmV2DataplaneCfg.EnableIPv6 = config.Toggles.EnableIPv6
+
+		if config.Toggles.EnableVerdictLogging && !util.IsWindowsDP() {
+			npmV2DataplaneCfg.PolicyManagerCfg.VerdictLog = verdictLogCfg(config)
+		}
 
 		var nodeIP string
 		if util.IsWindowsDP() {
@@ -201,17 +225,35 @@ func start(config npmconfig.Config, flags npmconfig.Flags) error {
 		}
 		npmV2DataplaneCfg.NodeIP = nodeIP
 
-		dp, err = dataplane.NewDataPlane(models.GetNodeName(), common.NewIOShim(), npmV2DataplaneCfg, stopChannel)
+		v2Dataplane, err := dataplane.NewDataPlane(models.GetNodeName(), common.NewIOShim(), npmV2DataplaneCfg, stopChannel)
 		if err != nil {
 			metrics.SendErrorLogAndMetric(util.NpmID, "error: failed to create dataplane with error %v", err)
 			return fmt.Errorf("failed to create dataplane with error %w", err)
 		}
-		dp.RunPeriodicTasks()
+		v2Dataplane.RunPeriodicTasks()
+		dp = v2Dataplane
+
+		if npmV2DataplaneCfg.PolicyManagerCfg.VerdictLog != nil {
+			startVerdictLogCollector(npmV2DataplaneCfg.PolicyManagerCfg.VerdictLog, v2Dataplane, stopChannel)
+		}
+
+		if config.Toggles.EnableFQDNEgress && !util.IsWindowsDP() {
+			dp = startFQDNEgress(fqdnEgressCfg(config, npmV2DataplaneCfg.EnableIPv6), dp, stopChannel)
+		}
 	}
 
 	k8sServerVersion := k8sServerVersion(clientset)
 	npMgr := npm.NewNetworkPolicyManager(config, factory, podFactory, dp, exec.New(), version, k8sServerVersion)
 
+	if config.Toggles.EnableV2NPM && config.Toggles.EnableAdminNetworkPolicy && !util.IsWindowsDP() && adminNetworkPolicyAPIsInstalled(clientset.Discovery()) {
+		dynamicClient, err := dynamic.NewForConfig(k8sConfig)
+		if err != nil {
+			return fmt.Errorf("failed to generate dynamic client with cluster config: %w", err)
+		}
+		klog.Infof("enforcing AdminNetworkPolicies and BaselineAdminNetworkPolicies")
+		npMgr.EnableAdminNetworkPolicies(dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, resyncPeriod))
+	}
+
 	go restserver.NPMRestServerListenAndServe(config, npMgr)
 
 	metrics.SendLog(util.NpmID, "starting NPM", metrics.PrintLog)
@@ -223,6 +265,95 @@ func start(config npmconfig.Config, flags npmconfig.Flags) error {
 	select {}
 }
 
+// startVerdictLogCollector collects the packets logged by the dataplane's NFLOG rules in the background
+func startVerdictLogCollector(cfg *policies.VerdictLogCfg, dp *dataplane.DataPlane, stopCh <-chan struct{}) {
+	collector := verdictlog.NewCollector(cfg, dp)
+	go func() {
+		if err := collector.Run(stopCh); err != nil {
+			metrics.SendErrorLogAndMetric(util.NpmID, "error: verdict log collector stopped with error %v", err)
+		}
+	}()
+}
+
+// verdictLogCfg fills in defaults for the verdict logging config
+func verdictLogCfg(config npmconfig.Config) *policies.VerdictLogCfg {
+	cfg := &policies.VerdictLogCfg{
+		NflogGroup:         uint16(npmconfig.DefaultConfig.VerdictLog.NflogGroup),
+		RateLimitPerSecond: npmconfig.DefaultConfig.VerdictLog.RateLimitPerSecond,
+	}
+	if config.VerdictLog.NflogGroup > 0 {
+		cfg.NflogGroup = uint16(config.VerdictLog.NflogGroup)
+	}
+	if config.VerdictLog.RateLimitPerSecond > 0 {
+		cfg.RateLimitPerSecond = config.VerdictLog.RateLimitPerSecond
+	}
+	return cfg
+}
+
+// fqdnEgressCfg fills in defaults for the FQDN egress config
+func fqdnEgressCfg(config npmconfig.Config, ipv6 bool) *fqdn.Cfg {
+	cfg := &fqdn.Cfg{
+		QueueNum: uint16(npmconfig.DefaultConfig.FQDNEgress.QueueNum),
+		MinTTL:   time.Duration(npmconfig.DefaultConfig.FQDNEgress.MinTTLSeconds) * time.Second,
+		IPv6:     ipv6,
+	}
+	if config.FQDNEgress.QueueNum > 0 {
+		cfg.QueueNum = uint16(config.FQDNEgress.QueueNum)
+	}
+	if config.FQDNEgress.MinTTLSeconds > 0 {
+		cfg.MinTTL = time.Duration(config.FQDNEgress.MinTTLSeconds) * time.Second
+	}
+	dnsServers := config.FQDNEgress.DNSServers
+	if len(dnsServers) == 0 {
+		dnsServers = npmconfig.DefaultConfig.FQDNEgress.DNSServers
+	}
+	for _, server := range dnsServers {
+		addr, err := netip.ParseAddr(server)
+		if err != nil {
+			klog.Errorf("ignoring invalid FQDN egress DNS server %s: %v", server, err)
+			continue
+		}
+		cfg.DNSServers = append(cfg.DNSServers, addr)
+	}
+	return cfg
+}
+
+// otlpCfg fills in defaults for the OTLP export config
+func otlpCfg(config npmconfig.Config) *otlp.Config {
+	cfg := &otlp.Config{
+		Endpoint: config.OTLP.Endpoint,
+		Protocol: config.OTLP.Protocol,
+		Insecure: config.OTLP.Insecure,
+		Headers:  config.OTLP.Headers,
+	}
+	cfg.MetricsInterval.Duration = time.Duration(npmconfig.DefaultConfig.OTLP.MetricsIntervalInSeconds) * time.Second
+	if config.OTLP.MetricsIntervalInSeconds > 0 {
+		cfg.MetricsInterval.Duration = time.Duration(config.OTLP.MetricsIntervalInSeconds) * time.Second
+	}
+	return cfg
+}
+
+// startOTLPExport exports the metrics to an OpenTelemetry collector if it's enabled.
+func startOTLPExport(config npmconfig.Config) {
+	if !config.Toggles.EnableOTLPExport {
+		return
+	}
+	if err := metrics.StartOTLPExport(context.Background(), otlpCfg(config)); err != nil {
+		metrics.SendErrorLogAndMetric(util.NpmID, "error: failed to start OTLP export with error %v", err)
+	}
+}
+
+// startFQDNEgress snoops DNS responses for the FQDN egress annotation, and returns the dataplane which policies must be added to.
+func startFQDNEgress(cfg *fqdn.Cfg, dp dataplane.GenericDataplane, stopCh <-chan struct{}) dataplane.GenericDataplane {
+	manager := fqdn.NewManager(cfg, dp)
+	go func() {
+		if err := manager.Run(stopCh); err != nil {
+			metrics.SendErrorLogAndMetric(util.NpmID, "error: FQDN egress stopped with error %v", err)
+		}
+	}()
+	return manager
+}
+
 func initLogging() error {
 	log.SetName("azure-npm")
 	log.SetLevel(log.LevelInfo)
@@ -250,3 +381,26 @@ func k8sServerVersion(kubeclientset kubernetes.Interface) *k8sversion.Info {
 	}
 	return serverVersion
 }
+
+// adminNetworkPolicyAPIsInstalled returns true if the API server serves both the AdminNetworkPolicy and
+// BaselineAdminNetworkPolicy CRDs. Their informers would never sync otherwise, which blocks NPM from starting.
+func adminNetworkPolicyAPIsInstalled(client discovery.DiscoveryInterface) bool {
+	groupVersion := policyv1alpha1.AdminNetworkPolicyResource.GroupVersion().String()
+	resources, err := client.ServerResourcesForGroupVersion(groupVersion)
+	if err != nil {
+		metrics.SendLog(util.NpmID, fmt.Sprintf("Warning: not enforcing AdminNetworkPolicies, failed to discover %s: %s", groupVersion, err.Error()), metrics.PrintLog)
+		return false
+	}
+
+	found := map[string]bool{}
+	for i := range resources.APIResources {
+		found[resources.APIResources[i].Name] = true
+	}
+	for _, resource := range []string{policyv1alpha1.AdminNetworkPolicyResource.Resource, policyv1alpha1.BaselineAdminNetworkPolicyResource.Resource} {
+		if !found[resource] {
+			metrics.SendLog(util.NpmID, fmt.Sprintf("Warning: not enforcing AdminNetworkPolicies, %s %s is not installed", groupVersion, resource), metrics.PrintLog)
+			return false
+		}
+	}
+	return true
+}
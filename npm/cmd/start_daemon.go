@@ -66,17 +66,28 @@ func startDaemon(config npmconfig.Config) error {
 
 	var dp dataplane.GenericDataplane
 
-	dp, err = dataplane.NewDataPlane(models.GetNodeName(), common.NewIOShim(), npmV2DataplaneCfg, wait.NeverStop)
+	if config.Toggles.EnableVerdictLogging && !util.IsWindowsDP() {
+		npmV2DataplaneCfg.PolicyManagerCfg.VerdictLog = verdictLogCfg(config)
+	}
+
+	v2Dataplane, err := dataplane.NewDataPlane(models.GetNodeName(), common.NewIOShim(), npmV2DataplaneCfg, wait.NeverStop)
 	if err != nil {
 		klog.Errorf("failed to create dataplane: %v", err)
 		return fmt.Errorf("failed to create dataplane with error %w", err)
 	}
 
-	dp.RunPeriodicTasks()
+	v2Dataplane.RunPeriodicTasks()
+	dp = v2Dataplane
+	if npmV2DataplaneCfg.PolicyManagerCfg.VerdictLog != nil {
+		startVerdictLogCollector(npmV2DataplaneCfg.PolicyManagerCfg.VerdictLog, v2Dataplane, wait.NeverStop)
+	}
+	if config.Toggles.EnableFQDNEgress && !util.IsWindowsDP() {
+		dp = startFQDNEgress(fqdnEgressCfg(config, npmV2DataplaneCfg.EnableIPv6), dp, wait.NeverStop)
+	}
 	// TODO Daemon should implement cache encoder
 	go restserver.NPMRestServerListenAndServe(config, nil)
 
-	client, err := transport.NewEventsClient(ctx, pod, node, addr)
+	client, err := transport.NewEventsClient(ctx, pod, node, addr, daemonTLSFiles(config))
 	if err != nil {
 		klog.Errorf("failed to create dataplane events client with error %v", err)
 		return fmt.Errorf("failed to create dataplane events client: %w", err)
@@ -88,6 +99,11 @@ func startDaemon(config npmconfig.Config) error {
 		return fmt.Errorf("failed to create goalstate processor: %w", err)
 	}
 
+	if config.Toggles.EnableNetworkPolicyStatus {
+		klog.Infof("reporting network policy status to the controlplane")
+		gsp.EnableStatusReporting(client)
+	}
+
 	n, err := daemon.NewNetworkPolicyDaemon(ctx, config, dp, gsp, client, version)
 	if err != nil {
 		klog.Errorf("failed to create dataplane : %v", err)
@@ -102,6 +118,7 @@ func startDaemon(config npmconfig.Config) error {
 	if err != nil {
 		klog.Infof("CreateTelemetryHandle failed with error %v. AITelemetry is not initialized.", err)
 	}
+	startOTLPExport(config)
 
 	err = n.Start(config, wait.NeverStop)
 	if err != nil {
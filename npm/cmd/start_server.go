@@ -11,16 +11,23 @@ import (
 	"github.com/Azure/azure-container-networking/npm/controller"
 	restserver "github.com/Azure/azure-container-networking/npm/http/server"
 	"github.com/Azure/azure-container-networking/npm/metrics"
+	"github.com/Azure/azure-container-networking/npm/pkg/controlplane/policystatus"
 	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/dpshim"
 	"github.com/Azure/azure-container-networking/npm/pkg/transport"
 	"github.com/Azure/azure-container-networking/npm/util"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog"
 )
 
@@ -105,7 +112,17 @@ func startControlplane(config npmconfig.Config, flags npmconfig.Flags) error {
 		return fmt.Errorf("failed to create dataplane with error: %w", err)
 	}
 
-	mgr := transport.NewEventsServer(context.Background(), config.Transport.Port, dp)
+	if config.Toggles.EnableGoalStateFiltering {
+		klog.Infof("sending each daemon only the goal state for its node")
+		dp.EnableNodeFiltering()
+	}
+
+	var authorizer *transport.NodeAuthorizer
+	if config.Toggles.EnableTransportNodeAuthorization {
+		klog.Infof("requiring daemon client certificates bound to their node")
+		authorizer = transport.NewNodeAuthorizer(factory.Core().V1().Pods().Lister())
+	}
+	mgr := transport.NewEventsServer(context.Background(), config.Transport.Port, controllerTLSFiles(config), authorizer, dp)
 
 	npMgr, err := controller.NewNetworkPolicyServer(config, factory, mgr, dp, version, k8sServerVersion)
 	if err != nil {
@@ -113,6 +130,27 @@ func startControlplane(config npmconfig.Config, flags npmconfig.Flags) error {
 		return fmt.Errorf("failed to create NPM controlplane manager: %w", err)
 	}
 
+	if config.Toggles.EnableNetworkPolicyStatus {
+		dynamicClient, err := dynamic.NewForConfig(k8sConfig)
+		if err != nil {
+			return fmt.Errorf("failed to generate dynamic client with cluster config: %w", err)
+		}
+		broadcaster := record.NewBroadcaster()
+		broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+		recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "azure-npm"})
+		klog.Infof("publishing network policy status")
+		npMgr.EnablePolicyStatus(policystatus.NewTracker(recorder, policystatus.NewDynamicSummaryWriter(dynamicClient)))
+	}
+
+	if config.Toggles.EnableAdminNetworkPolicy && adminNetworkPolicyAPIsInstalled(clientset.Discovery()) {
+		dynamicClient, err := dynamic.NewForConfig(k8sConfig)
+		if err != nil {
+			return fmt.Errorf("failed to generate dynamic client with cluster config: %w", err)
+		}
+		klog.Infof("enforcing AdminNetworkPolicies and BaselineAdminNetworkPolicies")
+		npMgr.EnableAdminNetworkPolicies(dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, resyncPeriod))
+	}
+
 	logLevel := config.LogLevel
 	if logLevel == "" {
 		logLevel = npmconfig.DefaultConfig.LogLevel
@@ -121,6 +159,7 @@ func startControlplane(config npmconfig.Config, flags npmconfig.Flags) error {
 	if err != nil {
 		klog.Infof("CreateTelemetryHandle failed with error %v. AITelemetry is not initialized.", err)
 	}
+	startOTLPExport(config)
 
 	go restserver.NPMRestServerListenAndServe(config, npMgr)
 
@@ -128,3 +167,38 @@ func startControlplane(config npmconfig.Config, flags npmconfig.Flags) error {
 
 	return npMgr.Start(config, wait.NeverStop) //nolint:wrapcheck // unnecessary to wrap error
 }
+
+// controllerTLSFiles fills in the default files of the controller for the transport to the daemons.
+// The CA of client certificates is only needed to authorize nodes.
+func controllerTLSFiles(config npmconfig.Config) transport.TLSFiles {
+	defaults := npmconfig.DefaultConfig.Transport
+	files := transport.TLSFiles{
+		CertFile: valueOrDefault(config.Transport.CertFile, defaults.CertFile),
+		KeyFile:  valueOrDefault(config.Transport.KeyFile, defaults.KeyFile),
+	}
+	if config.Toggles.EnableTransportNodeAuthorization {
+		files.CAFile = valueOrDefault(config.Transport.CAFile, defaults.CAFile)
+	}
+	return files
+}
+
+// daemonTLSFiles fills in the default files of the daemon for the transport to the controller.
+// Daemons only present their own certificate when the controller authorizes nodes.
+func daemonTLSFiles(config npmconfig.Config) transport.TLSFiles {
+	defaults := npmconfig.DefaultConfig.Transport
+	if !config.Toggles.EnableTransportNodeAuthorization {
+		return transport.TLSFiles{CAFile: valueOrDefault(config.Transport.CAFile, defaults.CAFile)}
+	}
+	return transport.TLSFiles{
+		CertFile: valueOrDefault(config.Transport.DaemonCertFile, defaults.DaemonCertFile),
+		KeyFile:  valueOrDefault(config.Transport.DaemonKeyFile, defaults.DaemonKeyFile),
+		CAFile:   valueOrDefault(config.Transport.DaemonCAFile, defaults.DaemonCAFile),
+	}
+}
+
+func valueOrDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
@@ -5,6 +5,9 @@ import (
 
 	"github.com/Azure/azure-container-networking/log"
 	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 func TestInitLogging(t *testing.T) {
@@ -13,3 +16,45 @@ func TestInitLogging(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, expectedLogPath, log.GetLogDirectory())
 }
+
+func TestAdminNetworkPolicyAPIsInstalled(t *testing.T) {
+	tests := []struct {
+		name      string
+		resources []*metav1.APIResourceList
+		want      bool
+	}{
+		{
+			name: "no policy.networking.k8s.io group",
+			want: false,
+		},
+		{
+			name: "only AdminNetworkPolicy installed",
+			resources: []*metav1.APIResourceList{
+				{
+					GroupVersion: "policy.networking.k8s.io/v1alpha1",
+					APIResources: []metav1.APIResource{{Name: "adminnetworkpolicies"}},
+				},
+			},
+			want: false,
+		},
+		{
+			name: "both CRDs installed",
+			resources: []*metav1.APIResourceList{
+				{
+					GroupVersion: "policy.networking.k8s.io/v1alpha1",
+					APIResources: []metav1.APIResource{{Name: "adminnetworkpolicies"}, {Name: "baselineadminnetworkpolicies"}},
+				},
+			},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			client.Discovery().(*fakediscovery.FakeDiscovery).Resources = tt.resources
+			require.Equal(t, tt.want, adminNetworkPolicyAPIsInstalled(client.Discovery()))
+		})
+	}
+}
@@ -12,6 +12,18 @@ const (
 	defaultListeningPort        = 10091
 	defaultGrpcPort             = 10092
 	defaultGrpcServicePort      = 9002
+	defaultTransportCertFile    = "/usr/local/npm/tls.crt"
+	defaultTransportKeyFile     = "/usr/local/npm/tls.key"
+	defaultTransportCAFile      = "/usr/local/npm/ca.crt"
+	defaultDaemonCertFile       = "/usr/local/npm-daemon/tls.crt"
+	defaultDaemonKeyFile        = "/usr/local/npm-daemon/tls.key"
+	defaultDaemonCAFile         = "/usr/local/npm-daemon/ca.crt"
+	defaultVerdictLogNflogGroup = 100
+	defaultVerdictLogRateLimit  = 10
+	defaultFQDNEgressQueueNum   = 100
+	defaultFQDNEgressMinTTL     = 60
+	defaultFQDNEgressDNSServer  = "10.0.0.10" // the kube-dns service IP of AKS
+	defaultOTLPMetricsInterval  = 60
 	// ConfigEnvPath is what's used by viper to load config path
 	ConfigEnvPath = "NPM_CONFIG"
 
@@ -30,6 +42,13 @@ var DefaultConfig = Config{
 		Address:     "0.0.0.0",
 		Port:        defaultGrpcPort,
 		ServicePort: defaultGrpcServicePort,
+		CertFile:    defaultTransportCertFile,
+		KeyFile:     defaultTransportKeyFile,
+		CAFile:      defaultTransportCAFile,
+
+		DaemonCertFile: defaultDaemonCertFile,
+		DaemonKeyFile:  defaultDaemonKeyFile,
+		DaemonCAFile:   defaultDaemonCAFile,
 	},
 
 	WindowsNetworkName:          util.AzureNetworkName,
@@ -40,6 +59,21 @@ var DefaultConfig = Config{
 	MaxPendingNetPols:            defaultMaxPendingNetPols,
 	NetPolInvervalInMilliseconds: defaultNetPolInterval,
 
+	VerdictLog: VerdictLogConfig{
+		NflogGroup:         defaultVerdictLogNflogGroup,
+		RateLimitPerSecond: defaultVerdictLogRateLimit,
+	},
+
+	FQDNEgress: FQDNEgressConfig{
+		QueueNum:      defaultFQDNEgressQueueNum,
+		MinTTLSeconds: defaultFQDNEgressMinTTL,
+		DNSServers:    []string{defaultFQDNEgressDNSServer},
+	},
+
+	OTLP: OTLPConfig{
+		MetricsIntervalInSeconds: defaultOTLPMetricsInterval,
+	},
+
 	Toggles: Toggles{
 		EnablePrometheusMetrics: true,
 		EnablePprof:             true,
@@ -52,6 +86,24 @@ var DefaultConfig = Config{
 		// NetPolInBackground is currently used in Linux to apply NetPol controller Add events in the background
 		NetPolInBackground: true,
 		EnableNPMLite:      false,
+		// EnableIPv6 is currently used in Linux to enforce NetPols on IPv6 traffic via inet6 ipsets and ip6tables
+		EnableIPv6: false,
+		// EnableAdminNetworkPolicy is currently used in Linux to enforce AdminNetworkPolicies and BaselineAdminNetworkPolicies
+		EnableAdminNetworkPolicy: false,
+		// EnableVerdictLogging is currently used in Linux to log the packets matching each ACL via NFLOG
+		EnableVerdictLogging: false,
+		// EnableNetworkPolicyStatus is currently used by the controlplane to publish NetPol status as Events and a PolicyStatusSummary
+		EnableNetworkPolicyStatus: false,
+		// EnableGoalStateFiltering is currently used by the controlplane to send each daemon only the goal state for its node
+		EnableGoalStateFiltering: false,
+		// EnableBPFDataplane is currently used in Linux to enforce NetPols with tc BPF programs instead of iptables and ipsets
+		EnableBPFDataplane: false,
+		// EnableTransportNodeAuthorization is currently used by the controlplane and daemon to require daemon client certificates bound to their node
+		EnableTransportNodeAuthorization: false,
+		// EnableFQDNEgress is currently used in Linux to allow egress to the names of the FQDN egress annotation by snooping DNS responses via NFQUEUE
+		EnableFQDNEgress: false,
+		// EnableOTLPExport exports the node and cluster metrics to an OpenTelemetry collector alongside the Prometheus endpoint
+		EnableOTLPExport: false,
 	},
 
 	// Setting LogLevel to "info" by default. Set to "debug" to get application insight logs (creates a listener that outputs diagnosticMessageWriter logs).
@@ -65,6 +117,51 @@ type GrpcServerConfig struct {
 	Port int `json:"Port,omitempty"`
 	// ServicePort is the service port for the client to connect to the gRPC server
 	ServicePort int `json:"ServicePort,omitempty"`
+	// CertFile and KeyFile are the certificate which the controller serves
+	CertFile string `json:"CertFile,omitempty"`
+	KeyFile  string `json:"KeyFile,omitempty"`
+	// CAFile verifies client certificates in the controller if Toggles.EnableTransportNodeAuthorization is true.
+	// Otherwise, the daemon verifies the controller with it.
+	CAFile string `json:"CAFile,omitempty"`
+	// DaemonCertFile and DaemonKeyFile are the client certificate of the daemon if Toggles.EnableTransportNodeAuthorization is true.
+	// It must be bound to the node, e.g. issued to the daemon pod by the cert-manager CSI driver.
+	DaemonCertFile string `json:"DaemonCertFile,omitempty"`
+	DaemonKeyFile  string `json:"DaemonKeyFile,omitempty"`
+	// DaemonCAFile verifies the controller in the daemon if Toggles.EnableTransportNodeAuthorization is true
+	DaemonCAFile string `json:"DaemonCAFile,omitempty"`
+}
+
+// VerdictLogConfig applies for Linux only when Toggles.EnableVerdictLogging is true
+type VerdictLogConfig struct {
+	// NflogGroup is the NFLOG group which NPM's iptables rules log packets to
+	NflogGroup int `json:"NflogGroup,omitempty"`
+	// RateLimitPerSecond is the maximum number of packets logged per second by each ACL
+	RateLimitPerSecond int `json:"RateLimitPerSecond,omitempty"`
+}
+
+// FQDNEgressConfig applies for Linux only when Toggles.EnableFQDNEgress is true
+type FQDNEgressConfig struct {
+	// QueueNum is the NFQUEUE which DNS responses are sent to
+	QueueNum int `json:"QueueNum,omitempty"`
+	// MinTTLSeconds is the minimum time which resolved IPs stay allowed, since clients often cache names longer than their TTL
+	MinTTLSeconds int `json:"MinTTLSeconds,omitempty"`
+	// DNSServers are the IPs of the cluster DNS service and of any other resolvers which pods query directly.
+	// Only their responses are snooped, so pods can't allow IPs for themselves with forged responses.
+	DNSServers []string `json:"DNSServers,omitempty"`
+}
+
+// OTLPConfig applies when Toggles.EnableOTLPExport is true
+type OTLPConfig struct {
+	// Endpoint is the host:port of the OpenTelemetry collector, or its URL for OTLP/HTTP. It defaults to the local collector.
+	Endpoint string `json:"Endpoint,omitempty"`
+	// Protocol is either "grpc" or "http/protobuf". It defaults to "grpc".
+	Protocol string `json:"Protocol,omitempty"`
+	// Insecure disables TLS to the collector
+	Insecure bool `json:"Insecure,omitempty"`
+	// Headers are sent with every export, e.g. for authentication
+	Headers map[string]string `json:"Headers,omitempty"`
+	// MetricsIntervalInSeconds is how often the metrics are exported
+	MetricsIntervalInSeconds int `json:"MetricsIntervalInSeconds,omitempty"`
 }
 
 type Config struct {
@@ -81,11 +178,14 @@ type Config struct {
 	// MaxBatchedACLsPerPod is the maximum number of ACLs that can be added to a Pod at once in Windows.
 	// The zero value is valid.
 	// A NetworkPolicy's ACLs are always in the same batch, and there will be at least one NetworkPolicy per batch.
-	MaxBatchedACLsPerPod         int     `json:"MaxBatchedACLsPerPod,omitempty"`
-	MaxPendingNetPols            int     `json:"MaxPendingNetPols,omitempty"`
-	NetPolInvervalInMilliseconds int     `json:"NetPolInvervalInMilliseconds,omitempty"`
-	Toggles                      Toggles `json:"Toggles,omitempty"`
-	LogLevel                     string  `json:"LogLevel,omitempty"`
+	MaxBatchedACLsPerPod         int              `json:"MaxBatchedACLsPerPod,omitempty"`
+	MaxPendingNetPols            int              `json:"MaxPendingNetPols,omitempty"`
+	NetPolInvervalInMilliseconds int              `json:"NetPolInvervalInMilliseconds,omitempty"`
+	VerdictLog                   VerdictLogConfig `json:"VerdictLog,omitempty"`
+	FQDNEgress                   FQDNEgressConfig `json:"FQDNEgress,omitempty"`
+	OTLP                         OTLPConfig       `json:"OTLP,omitempty"`
+	Toggles                      Toggles          `json:"Toggles,omitempty"`
+	LogLevel                     string           `json:"LogLevel,omitempty"`
 }
 
 type Toggles struct {
@@ -100,6 +200,24 @@ type Toggles struct {
 	// NetPolInBackground
 	NetPolInBackground bool
 	EnableNPMLite      bool
+	// EnableIPv6 applies for Linux only
+	EnableIPv6 bool
+	// EnableAdminNetworkPolicy applies for Linux only. It is ignored with a warning if the policy.networking.k8s.io CRDs are not installed
+	EnableAdminNetworkPolicy bool
+	// EnableVerdictLogging applies for Linux only. It also enables the audit only annotation on NetworkPolicies
+	EnableVerdictLogging bool
+	// EnableNetworkPolicyStatus applies for the controlplane and daemon only and requires the npm.azure.com PolicyStatusSummary CRD to be installed
+	EnableNetworkPolicyStatus bool
+	// EnableGoalStateFiltering applies for the controlplane only
+	EnableGoalStateFiltering bool
+	// EnableBPFDataplane applies for Linux only. IPv6, verdict logging, and audit only NetworkPolicies are not supported with it
+	EnableBPFDataplane bool
+	// EnableTransportNodeAuthorization applies for the controlplane and daemon only. Daemons need the Transport.DaemonCertFile bound to their node
+	EnableTransportNodeAuthorization bool
+	// EnableFQDNEgress applies for Linux only and not with the BPF dataplane. It enables the FQDN egress annotation on NetworkPolicies
+	EnableFQDNEgress bool
+	// EnableOTLPExport applies for the controlplane, daemon and NPM, which export the metrics of their registries
+	EnableOTLPExport bool
 }
 
 type Flags struct {
@@ -9,11 +9,13 @@ import (
 	npmconfig "github.com/Azure/azure-container-networking/npm/config"
 	"github.com/Azure/azure-container-networking/npm/pkg/controlplane/controllers/common"
 	controllersv2 "github.com/Azure/azure-container-networking/npm/pkg/controlplane/controllers/v2"
+	"github.com/Azure/azure-container-networking/npm/pkg/controlplane/policystatus"
 	"github.com/Azure/azure-container-networking/npm/pkg/dataplane"
 	"github.com/Azure/azure-container-networking/npm/pkg/models"
 	"github.com/Azure/azure-container-networking/npm/pkg/transport"
 	"github.com/pkg/errors"
 	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog"
@@ -36,6 +38,11 @@ type NetworkPolicyServer struct {
 
 	// Azure-specific variables
 	models.AzureConfig
+
+	// statusTracker is nil unless policy status reporting is enabled
+	statusTracker *policystatus.Tracker
+
+	dp dataplane.GenericDataplane
 }
 
 var (
@@ -74,6 +81,7 @@ func NewNetworkPolicyServer(
 	n := &NetworkPolicyServer{
 		config: config,
 		tm:     mgr,
+		dp:     dp,
 		Informers: models.Informers{
 			InformerFactory: informerFactory,
 			PodInformer:     informerFactory.Core().V1().Pods(),
@@ -96,6 +104,19 @@ func NewNetworkPolicyServer(
 	return n, nil
 }
 
+// EnableAdminNetworkPolicies creates the v2 controller for AdminNetworkPolicies and BaselineAdminNetworkPolicies.
+// It must be called before Start.
+func (n *NetworkPolicyServer) EnableAdminNetworkPolicies(dynamicFactory dynamicinformer.DynamicSharedInformerFactory) {
+	n.DynamicInformerFactory = dynamicFactory
+	n.AdminNetPolControllerV2 = controllersv2.NewAdminNetworkPolicyController(dynamicFactory, n.dp)
+}
+
+// EnablePolicyStatus publishes the translation errors of network policies and the programming status reported by the daemons.
+func (n *NetworkPolicyServer) EnablePolicyStatus(tracker *policystatus.Tracker) {
+	n.statusTracker = tracker
+	n.NetPolControllerV2.EnableStatusReporting(tracker)
+}
+
 func (n *NetworkPolicyServer) MarshalJSON() ([]byte, error) {
 	m := map[models.CacheKey]json.RawMessage{}
 
@@ -151,10 +172,24 @@ func (n *NetworkPolicyServer) Start(config npmconfig.Config, stopCh <-chan struc
 		return fmt.Errorf("NetworkPolicy informer error: %w", models.ErrInformerSyncFailure)
 	}
 
+	if n.AdminNetPolControllerV2 != nil {
+		n.DynamicInformerFactory.Start(stopCh)
+		if !cache.WaitForCacheSync(stopCh, n.AdminNetPolControllerV2.HasSynced) {
+			return fmt.Errorf("AdminNetworkPolicy informer error: %w", models.ErrInformerSyncFailure)
+		}
+	}
+
 	// start v2 NPM controllers after synced
 	go n.PodControllerV2.Run(stopCh)
 	go n.NamespaceControllerV2.Run(stopCh)
 	go n.NetPolControllerV2.Run(stopCh)
+	if n.AdminNetPolControllerV2 != nil {
+		go n.AdminNetPolControllerV2.Run(stopCh)
+	}
+
+	if n.statusTracker != nil {
+		go n.statusTracker.Run(stopCh, n.tm.PolicyStatusChannel(), n.tm.NodeGoneChannel())
+	}
 
 	// start the transport layer (gRPC) server
 	// We block the main thread here until the server is stopped.
@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-container-networking/npm/util"
+	"github.com/Azure/azure-container-networking/otlp"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog"
+)
+
+// StartOTLPExport exports the node and cluster metrics to an OpenTelemetry collector until the context is done.
+func StartOTLPExport(ctx context.Context, cfg *otlp.Config) error {
+	if !haveInitialized {
+		klog.Infof("in StartOTLPExport, metrics weren't initialized. Initializing now")
+		InitializeAll()
+	}
+	exporter, err := otlp.NewExporter(cfg, util.AzureNpmFlag)
+	if err != nil {
+		return fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+	bridge := otlp.NewMetricsBridge(prometheus.Gatherers{nodeRegistry, clusterRegistry}, exporter)
+	go func() {
+		defer exporter.Close()
+		bridge.Run(ctx, func(err error) {
+			klog.Errorf("failed to export metrics over OTLP: %v", err)
+		})
+	}()
+	return nil
+}
@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/otlp"
+	"github.com/Azure/azure-container-networking/otlp/otlptest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartOTLPExport(t *testing.T) {
+	InitializeAll()
+	ResetNumPolicies()
+	IncNumPolicies()
+
+	r := otlptest.NewReceiver(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg := &otlp.Config{Endpoint: r.GRPCEndpoint, Insecure: true}
+	cfg.MetricsInterval.Duration = 10 * time.Millisecond
+	require.NoError(t, StartOTLPExport(ctx, cfg))
+
+	require.Eventually(t, func() bool {
+		for _, m := range r.Metrics() {
+			if m.GetName() == "npm_num_policies" {
+				return m.GetGauge().GetDataPoints()[0].GetAsDouble() == 1
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -125,6 +125,16 @@ var (
 	itpablesRestoreLatency  *prometheus.HistogramVec
 	iptablesDeleteLatency   prometheus.Histogram
 	iptablesRestoreFailures *prometheus.CounterVec
+
+	// policyVerdicts is only updated when verdict logging is enabled
+	policyVerdicts       *prometheus.CounterVec
+	policyVerdictsLabels = []string{namespaceLabel, directionLabel, verdictLabel}
+)
+
+const (
+	namespaceLabel = "namespace"
+	directionLabel = "direction"
+	verdictLabel   = "verdict"
 )
 
 type RegistryType string
@@ -196,6 +206,7 @@ func InitializeAll() {
 		register(itpablesRestoreLatency, "iptables_restore_latency_seconds", NodeMetrics)
 		register(iptablesDeleteLatency, "iptables_delete_latency_seconds", NodeMetrics)
 		register(iptablesRestoreFailures, "iptables_restore_failure_total", NodeMetrics)
+		register(policyVerdicts, "policy_verdicts_total", NodeMetrics)
 	}
 
 	log.Logf("Finished initializing all Prometheus metrics")
@@ -354,6 +365,16 @@ func InitializeLinuxMetrics() {
 		},
 		[]string{operationLabel},
 	)
+
+	policyVerdicts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "policy_verdicts_total",
+			Subsystem: linuxPrefix,
+			Help:      "Number of packets logged by verdict logging by namespace, direction and verdict label. Logging is rate limited per rule",
+		},
+		policyVerdictsLabels,
+	)
 }
 
 // GetHandler returns the HTTP handler for the metrics endpoint
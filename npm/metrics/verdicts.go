@@ -0,0 +1,22 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// IncPolicyVerdicts counts a packet logged by verdict logging.
+func IncPolicyVerdicts(namespace, direction, verdict string) {
+	policyVerdicts.With(policyVerdictLabels(namespace, direction, verdict)).Inc()
+}
+
+func TotalPolicyVerdicts(namespace, direction, verdict string) (int, error) {
+	return counterValue(policyVerdicts.With(policyVerdictLabels(namespace, direction, verdict)))
+}
+
+func policyVerdictLabels(namespace, direction, verdict string) prometheus.Labels {
+	return prometheus.Labels{
+		namespaceLabel: namespace,
+		directionLabel: direction,
+		verdictLabel:   verdict,
+	}
+}
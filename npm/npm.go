@@ -17,6 +17,7 @@ import (
 	"github.com/Azure/azure-container-networking/npm/util"
 	"github.com/pkg/errors"
 	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog"
@@ -106,6 +107,13 @@ func NewNetworkPolicyManager(config npmconfig.Config,
 	return npMgr
 }
 
+// EnableAdminNetworkPolicies creates the v2 controller for AdminNetworkPolicies and BaselineAdminNetworkPolicies.
+// It must be called before Start, and only for the v2 Linux dataplane.
+func (npMgr *NetworkPolicyManager) EnableAdminNetworkPolicies(dynamicFactory dynamicinformer.DynamicSharedInformerFactory) {
+	npMgr.DynamicInformerFactory = dynamicFactory
+	npMgr.AdminNetPolControllerV2 = controllersv2.NewAdminNetworkPolicyController(dynamicFactory, npMgr.Dataplane)
+}
+
 // Dear Time Traveler:
 // This is the server end of the debug dragons den. Several of these properties of the
 // npMgr struct have overridden methods which override the MarshalJson, just as this one
@@ -210,9 +218,19 @@ func (npMgr *NetworkPolicyManager) Start(config npmconfig.Config, stopCh <-chan
 		return fmt.Errorf("NetworkPolicy informer error: %w", models.ErrInformerSyncFailure)
 	}
 
+	if npMgr.AdminNetPolControllerV2 != nil {
+		npMgr.DynamicInformerFactory.Start(stopCh)
+		if !cache.WaitForCacheSync(stopCh, npMgr.AdminNetPolControllerV2.HasSynced) {
+			return fmt.Errorf("AdminNetworkPolicy informer error: %w", models.ErrInformerSyncFailure)
+		}
+	}
+
 	// start v2 NPM controllers after synced
 	if config.Toggles.EnableV2NPM {
 		go npMgr.NetPolControllerV2.Run(stopCh)
+		if npMgr.AdminNetPolControllerV2 != nil {
+			go npMgr.AdminNetPolControllerV2.Run(stopCh)
+		}
 
 		if util.IsWindowsDP() && config.Toggles.ApplyInBackground {
 			klog.Infof("optimizing NPM bootup by letting NetPol controller process changes first. waiting %v before starting pod and namespace controllers", waitDurationAfterStartingNetPolController)
@@ -0,0 +1,59 @@
+// Package v1alpha1 contains the npm.azure.com/v1alpha1 API, which NPM uses to publish its own state.
+// NPM writes these objects through the dynamic client, so there is no generated clientset.
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// GroupName is the API group of NPM's CRDs.
+const GroupName = "npm.azure.com"
+
+// PolicyStatusSummaryName is the name of the PolicyStatusSummary written by the NPM controlplane.
+const PolicyStatusSummaryName = "azure-npm"
+
+var (
+	// SchemeGroupVersion is the group version of this API.
+	SchemeGroupVersion = schema.GroupVersion{Group: GroupName, Version: "v1alpha1"}
+	// PolicyStatusSummaryResource is the resource of the cluster-scoped PolicyStatusSummary CRD.
+	PolicyStatusSummaryResource = SchemeGroupVersion.WithResource("policystatussummaries")
+)
+
+// PolicyStatusSummary aggregates the programming status of NetworkPolicies across the nodes of the cluster.
+type PolicyStatusSummary struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Status PolicyStatusSummaryStatus `json:"status,omitempty"`
+}
+
+// PolicyStatusSummaryStatus is the aggregated status reported by the NPM daemons.
+type PolicyStatusSummaryStatus struct {
+	// LastUpdateTime is when the summary was written.
+	LastUpdateTime metav1.Time `json:"lastUpdateTime"`
+	// ReportingNodes is the number of nodes whose daemon has reported status.
+	ReportingNodes int `json:"reportingNodes"`
+	// TotalPolicies is the number of policies known to the controlplane or reported by a daemon.
+	TotalPolicies int `json:"totalPolicies"`
+	// FailedPolicies is the number of policies which failed translation or failed to program on a node.
+	FailedPolicies int `json:"failedPolicies"`
+	// Policies lists the failed policies. The list is truncated for large clusters.
+	Policies []PolicyStatus `json:"policies,omitempty"`
+}
+
+// PolicyStatus is the status of a single policy.
+type PolicyStatus struct {
+	// Name is the policy key, e.g. namespace/name for a NetworkPolicy.
+	Name string `json:"name"`
+	// TranslationError is set if the controlplane can't translate the policy, so no node enforces it.
+	TranslationError string `json:"translationError,omitempty"`
+	// ProgrammedNodes is the number of nodes which have programmed the policy.
+	ProgrammedNodes int `json:"programmedNodes"`
+	// FailedNodes is the number of nodes which failed to program the policy.
+	FailedNodes int `json:"failedNodes"`
+	// FailedNodeNames lists some of the failed nodes.
+	FailedNodeNames []string `json:"failedNodeNames,omitempty"`
+	// Error is the error from one of the failed nodes.
+	Error string `json:"error,omitempty"`
+}
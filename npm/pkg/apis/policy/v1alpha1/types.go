@@ -0,0 +1,163 @@
+// Package v1alpha1 mirrors the subset of the policy.networking.k8s.io/v1alpha1 API
+// (AdminNetworkPolicy and BaselineAdminNetworkPolicy) that NPM translates.
+// NPM reads these CRDs through the dynamic client and converts them into these types,
+// so the fields and JSON tags must match the upstream API.
+// See https://network-policy-api.sigs.k8s.io/reference/spec/ for the full API.
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// GroupName is the API group of AdminNetworkPolicy and BaselineAdminNetworkPolicy.
+const GroupName = "policy.networking.k8s.io"
+
+var (
+	// AdminNetworkPolicyResource is the resource of the cluster-scoped AdminNetworkPolicy CRD.
+	AdminNetworkPolicyResource = schema.GroupVersionResource{Group: GroupName, Version: "v1alpha1", Resource: "adminnetworkpolicies"}
+	// BaselineAdminNetworkPolicyResource is the resource of the cluster-scoped BaselineAdminNetworkPolicy CRD.
+	BaselineAdminNetworkPolicyResource = schema.GroupVersionResource{Group: GroupName, Version: "v1alpha1", Resource: "baselineadminnetworkpolicies"}
+)
+
+// AdminNetworkPolicy is evaluated before NetworkPolicies, and namespace owners cannot override it.
+type AdminNetworkPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec AdminNetworkPolicySpec `json:"spec"`
+}
+
+// AdminNetworkPolicySpec defines the desired state of AdminNetworkPolicy.
+type AdminNetworkPolicySpec struct {
+	// Priority is a value from 0 to 1000. Policies with lower values have higher precedence.
+	Priority int32 `json:"priority"`
+	// Subject defines the pods which the policy applies to.
+	Subject AdminNetworkPolicySubject `json:"subject"`
+	// Ingress rules are evaluated in order. The first matching rule decides the flow.
+	Ingress []AdminNetworkPolicyIngressRule `json:"ingress,omitempty"`
+	// Egress rules are evaluated in order. The first matching rule decides the flow.
+	Egress []AdminNetworkPolicyEgressRule `json:"egress,omitempty"`
+}
+
+// AdminNetworkPolicyRuleAction is the action of an AdminNetworkPolicy rule.
+type AdminNetworkPolicyRuleAction string
+
+const (
+	// AdminNetworkPolicyRuleActionAllow allows the flow without evaluating NetworkPolicies.
+	AdminNetworkPolicyRuleActionAllow AdminNetworkPolicyRuleAction = "Allow"
+	// AdminNetworkPolicyRuleActionDeny drops the flow without evaluating NetworkPolicies.
+	AdminNetworkPolicyRuleActionDeny AdminNetworkPolicyRuleAction = "Deny"
+	// AdminNetworkPolicyRuleActionPass skips lower priority AdminNetworkPolicies and lets NetworkPolicies decide the flow.
+	AdminNetworkPolicyRuleActionPass AdminNetworkPolicyRuleAction = "Pass"
+)
+
+// AdminNetworkPolicyIngressRule matches flows from peers to the subject.
+type AdminNetworkPolicyIngressRule struct {
+	Name   string                          `json:"name,omitempty"`
+	Action AdminNetworkPolicyRuleAction    `json:"action"`
+	From   []AdminNetworkPolicyIngressPeer `json:"from"`
+	Ports  *[]AdminNetworkPolicyPort       `json:"ports,omitempty"`
+}
+
+// AdminNetworkPolicyEgressRule matches flows from the subject to peers.
+type AdminNetworkPolicyEgressRule struct {
+	Name   string                         `json:"name,omitempty"`
+	Action AdminNetworkPolicyRuleAction   `json:"action"`
+	To     []AdminNetworkPolicyEgressPeer `json:"to"`
+	Ports  *[]AdminNetworkPolicyPort      `json:"ports,omitempty"`
+}
+
+// BaselineAdminNetworkPolicy only applies to flows that no AdminNetworkPolicy or NetworkPolicy decided.
+// Only a single BaselineAdminNetworkPolicy named "default" may exist in a cluster.
+type BaselineAdminNetworkPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec BaselineAdminNetworkPolicySpec `json:"spec"`
+}
+
+// BaselineAdminNetworkPolicySpec defines the desired state of BaselineAdminNetworkPolicy.
+type BaselineAdminNetworkPolicySpec struct {
+	Subject AdminNetworkPolicySubject               `json:"subject"`
+	Ingress []BaselineAdminNetworkPolicyIngressRule `json:"ingress,omitempty"`
+	Egress  []BaselineAdminNetworkPolicyEgressRule  `json:"egress,omitempty"`
+}
+
+// BaselineAdminNetworkPolicyRuleAction is the action of a BaselineAdminNetworkPolicy rule.
+type BaselineAdminNetworkPolicyRuleAction string
+
+const (
+	BaselineAdminNetworkPolicyRuleActionAllow BaselineAdminNetworkPolicyRuleAction = "Allow"
+	BaselineAdminNetworkPolicyRuleActionDeny  BaselineAdminNetworkPolicyRuleAction = "Deny"
+)
+
+// BaselineAdminNetworkPolicyIngressRule matches flows from peers to the subject.
+type BaselineAdminNetworkPolicyIngressRule struct {
+	Name   string                               `json:"name,omitempty"`
+	Action BaselineAdminNetworkPolicyRuleAction `json:"action"`
+	From   []AdminNetworkPolicyIngressPeer      `json:"from"`
+	Ports  *[]AdminNetworkPolicyPort            `json:"ports,omitempty"`
+}
+
+// BaselineAdminNetworkPolicyEgressRule matches flows from the subject to peers.
+type BaselineAdminNetworkPolicyEgressRule struct {
+	Name   string                               `json:"name,omitempty"`
+	Action BaselineAdminNetworkPolicyRuleAction `json:"action"`
+	To     []AdminNetworkPolicyEgressPeer       `json:"to"`
+	Ports  *[]AdminNetworkPolicyPort            `json:"ports,omitempty"`
+}
+
+// AdminNetworkPolicySubject selects pods. Exactly one field must be set.
+type AdminNetworkPolicySubject struct {
+	// Namespaces selects all pods in the matching namespaces.
+	Namespaces *metav1.LabelSelector `json:"namespaces,omitempty"`
+	// Pods selects matching pods in matching namespaces.
+	Pods *NamespacedPod `json:"pods,omitempty"`
+}
+
+// NamespacedPod selects pods by namespace and pod labels.
+type NamespacedPod struct {
+	NamespaceSelector metav1.LabelSelector `json:"namespaceSelector"`
+	PodSelector       metav1.LabelSelector `json:"podSelector"`
+}
+
+// AdminNetworkPolicyIngressPeer selects the sources of ingress flows. Exactly one field must be set.
+type AdminNetworkPolicyIngressPeer struct {
+	Namespaces *metav1.LabelSelector `json:"namespaces,omitempty"`
+	Pods       *NamespacedPod        `json:"pods,omitempty"`
+}
+
+// AdminNetworkPolicyEgressPeer selects the destinations of egress flows. Exactly one field must be set.
+type AdminNetworkPolicyEgressPeer struct {
+	Namespaces *metav1.LabelSelector `json:"namespaces,omitempty"`
+	Pods       *NamespacedPod        `json:"pods,omitempty"`
+	// Nodes selects the host network addresses of matching nodes. NPM doesn't support this peer.
+	Nodes *metav1.LabelSelector `json:"nodes,omitempty"`
+	// Networks are CIDRs, such as "10.0.0.0/8" or "fd00::/8".
+	Networks []CIDR `json:"networks,omitempty"`
+}
+
+// CIDR is an IPv4 or IPv6 CIDR.
+type CIDR string
+
+// AdminNetworkPolicyPort selects destination ports. Exactly one field must be set.
+type AdminNetworkPolicyPort struct {
+	PortNumber *Port      `json:"portNumber,omitempty"`
+	NamedPort  *string    `json:"namedPort,omitempty"`
+	PortRange  *PortRange `json:"portRange,omitempty"`
+}
+
+// Port is a single port for a protocol.
+type Port struct {
+	Protocol corev1.Protocol `json:"protocol"`
+	Port     int32           `json:"port"`
+}
+
+// PortRange is an inclusive range of ports for a protocol.
+type PortRange struct {
+	Protocol corev1.Protocol `json:"protocol,omitempty"`
+	Start    int32           `json:"start"`
+	End      int32           `json:"end"`
+}
@@ -67,7 +67,7 @@ func (c *Cache) GetPod(input *Input) (*NpmPod, error) {
 		return nil, ErrInvalidInput
 	case IPADDRS:
 		for _, pod := range c.PodMap {
-			if pod.PodIP == input.Content {
+			if pod.PodIP == input.Content || (pod.PodIPv6 != "" && pod.PodIPv6 == input.Content) {
 				return pod, nil
 			}
 		}
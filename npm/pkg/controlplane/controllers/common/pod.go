@@ -3,14 +3,17 @@ package common
 import (
 	"reflect"
 
+	"github.com/Azure/azure-container-networking/npm/util"
 	corev1 "k8s.io/api/core/v1"
 	k8slabels "k8s.io/apimachinery/pkg/labels"
 )
 
 type NpmPod struct {
-	Name           string
-	Namespace      string
-	PodIP          string
+	Name      string
+	Namespace string
+	PodIP     string
+	// PodIPv6 is the IPv6 address of a dual-stack pod, or empty if the pod has none
+	PodIPv6        string `json:",omitempty"`
 	Labels         map[string]string
 	ContainerPorts []corev1.ContainerPort
 	Phase          corev1.PodPhase
@@ -36,6 +39,7 @@ func NewNpmPod(podObj *corev1.Pod) *NpmPod {
 		Name:           podObj.ObjectMeta.Name,
 		Namespace:      podObj.ObjectMeta.Namespace,
 		PodIP:          podObj.Status.PodIP,
+		PodIPv6:        GetPodIPv6(podObj),
 		Labels:         make(map[string]string),
 		ContainerPorts: []corev1.ContainerPort{},
 		Phase:          podObj.Status.Phase,
@@ -76,12 +80,23 @@ func (n *NpmPod) NoUpdate(podObj *corev1.Pod) bool {
 		n.Name == podObj.ObjectMeta.Name &&
 		n.Phase == podObj.Status.Phase &&
 		n.PodIP == podObj.Status.PodIP &&
+		n.PodIPv6 == GetPodIPv6(podObj) &&
 		k8slabels.Equals(n.Labels, podObj.ObjectMeta.Labels) &&
 		// TODO(jungukcho) to avoid using DeepEqual for ContainerPorts,
 		// it needs a precise sorting. Will optimize it later if needed.
 		reflect.DeepEqual(n.ContainerPorts, GetContainerPortList(podObj))
 }
 
+// GetPodIPv6 returns the first IPv6 address in the pod's status, or the empty string for single-stack IPv4 pods.
+func GetPodIPv6(podObj *corev1.Pod) string {
+	for _, podIP := range podObj.Status.PodIPs {
+		if util.IsIPV6(podIP.IP) {
+			return podIP.IP
+		}
+	}
+	return ""
+}
+
 func GetContainerPortList(podObj *corev1.Pod) []corev1.ContainerPort {
 	portList := []corev1.ContainerPort{}
 	for _, container := range podObj.Spec.Containers { //nolint:gocritic // intentionally copying full struct :(
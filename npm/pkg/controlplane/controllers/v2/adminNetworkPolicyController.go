@@ -0,0 +1,247 @@
+// Copyright 2018 Microsoft. All rights reserved.
+// MIT License
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-container-networking/npm/metrics"
+	policyv1alpha1 "github.com/Azure/azure-container-networking/npm/pkg/apis/policy/v1alpha1"
+	"github.com/Azure/azure-container-networking/npm/pkg/controlplane/translation"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
+	"github.com/Azure/azure-container-networking/npm/util"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog"
+)
+
+const (
+	adminNetworkPolicyKind         = "AdminNetworkPolicy"
+	baselineAdminNetworkPolicyKind = "BaselineAdminNetworkPolicy"
+)
+
+var errAdminNetPolKeyFormat = errors.New("invalid admin network policy key format")
+
+// AdminNetworkPolicyController programs the cluster-scoped AdminNetworkPolicy and BaselineAdminNetworkPolicy CRDs.
+// The policy.networking.k8s.io CRDs have no typed clientset in NPM, so they are watched through the dynamic client.
+type AdminNetworkPolicyController struct {
+	sync.RWMutex
+	anpInformer  informers.GenericInformer
+	banpInformer informers.GenericInformer
+	workqueue    workqueue.RateLimitingInterface
+	// rawSpecMap holds the lastly applied *AdminNetworkPolicySpec or *BaselineAdminNetworkPolicySpec.
+	// Key is <kind>/<policyname>, which is also the PolicyKey of the translated NPMNetworkPolicy.
+	rawSpecMap map[string]interface{}
+	dp         dataplane.GenericDataplane
+}
+
+func NewAdminNetworkPolicyController(dynamicFactory dynamicinformer.DynamicSharedInformerFactory, dp dataplane.GenericDataplane) *AdminNetworkPolicyController {
+	c := &AdminNetworkPolicyController{
+		anpInformer:  dynamicFactory.ForResource(policyv1alpha1.AdminNetworkPolicyResource),
+		banpInformer: dynamicFactory.ForResource(policyv1alpha1.BaselineAdminNetworkPolicyResource),
+		workqueue:    workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "AdminNetworkPolicy"),
+		rawSpecMap:   make(map[string]interface{}),
+		dp:           dp,
+	}
+
+	c.anpInformer.Informer().AddEventHandler(c.eventHandler(adminNetworkPolicyKind))
+	c.banpInformer.Informer().AddEventHandler(c.eventHandler(baselineAdminNetworkPolicyKind))
+	return c
+}
+
+// HasSynced returns true once both informers have synced.
+func (c *AdminNetworkPolicyController) HasSynced() bool {
+	return c.anpInformer.Informer().HasSynced() && c.banpInformer.Informer().HasSynced()
+}
+
+func (c *AdminNetworkPolicyController) LengthOfRawSpecMap() int {
+	c.RLock()
+	defer c.RUnlock()
+	return len(c.rawSpecMap)
+}
+
+func (c *AdminNetworkPolicyController) eventHandler(kind string) cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			c.enqueue(kind, obj)
+		},
+		UpdateFunc: func(old, newObj interface{}) {
+			oldPol, okOld := old.(*unstructured.Unstructured)
+			newPol, okNew := newObj.(*unstructured.Unstructured)
+			if okOld && okNew && oldPol.GetResourceVersion() == newPol.GetResourceVersion() {
+				// Periodic resync will send update events for all known policies.
+				return
+			}
+			c.enqueue(kind, newObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			// DeleteFunc gets an object of type DeletedFinalStateUnknown if the watch missed the delete event.
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			c.enqueue(kind, obj)
+		},
+	}
+}
+
+func (c *AdminNetworkPolicyController) enqueue(kind string, obj interface{}) {
+	pol, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		metrics.SendErrorLogAndMetric(util.NetpolID, "[%s EVENT] Received unexpected object type: %v", kind, obj)
+		return
+	}
+	c.workqueue.Add(kind + "/" + pol.GetName())
+}
+
+func (c *AdminNetworkPolicyController) Run(stopCh <-chan struct{}) {
+	defer utilruntime.HandleCrash()
+	defer c.workqueue.ShutDown()
+
+	go wait.Until(c.runWorker, time.Second, stopCh)
+	<-stopCh
+}
+
+func (c *AdminNetworkPolicyController) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *AdminNetworkPolicyController) processNextWorkItem() bool {
+	obj, shutdown := c.workqueue.Get()
+	if shutdown {
+		return false
+	}
+
+	err := func(obj interface{}) error {
+		defer c.workqueue.Done(obj)
+		key, ok := obj.(string)
+		if !ok {
+			c.workqueue.Forget(obj)
+			utilruntime.HandleError(fmt.Errorf("expected string in workqueue but got %#v, err %w", obj, errWorkqueueFormatting))
+			return nil
+		}
+		if err := c.syncAdminNetPol(key); err != nil {
+			// Put the item back on the workqueue to handle any transient errors.
+			c.workqueue.AddRateLimited(key)
+			return fmt.Errorf("error syncing '%s': %w, requeuing", key, err)
+		}
+		c.workqueue.Forget(obj)
+		return nil
+	}(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		metrics.SendErrorLogAndMetric(util.NetpolID, "syncAdminNetPol error due to %v", err)
+	}
+	return true
+}
+
+// syncAdminNetPol compares the actual state with the desired, and attempts to converge the two.
+func (c *AdminNetworkPolicyController) syncAdminNetPol(key string) error {
+	kind, name, found := strings.Cut(key, "/")
+	if !found {
+		utilruntime.HandleError(fmt.Errorf("invalid resource key: %s err: %w", key, errAdminNetPolKeyFormat))
+		return nil //nolint HandleError  is used instead of returning error to caller
+	}
+
+	var informer informers.GenericInformer
+	switch kind {
+	case adminNetworkPolicyKind:
+		informer = c.anpInformer
+	case baselineAdminNetworkPolicyKind:
+		informer = c.banpInformer
+	default:
+		utilruntime.HandleError(fmt.Errorf("invalid resource key: %s err: %w", key, errAdminNetPolKeyFormat))
+		return nil //nolint HandleError  is used instead of returning error to caller
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	obj, err := informer.Lister().Get(name)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			klog.Infof("%s is not found, may be it is deleted", key)
+			return c.cleanUpAdminNetworkPolicy(key)
+		}
+		return err
+	}
+
+	pol, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		utilruntime.HandleError(fmt.Errorf("unexpected object type for %s: %T", key, obj))
+		return nil //nolint HandleError  is used instead of returning error to caller
+	}
+	if pol.GetDeletionTimestamp() != nil {
+		return c.cleanUpAdminNetworkPolicy(key)
+	}
+
+	spec, npmNetPol, err := translateUnstructured(kind, pol)
+	if err != nil {
+		klog.Errorf("Failed to translate %s: %s", key, err.Error())
+		// Returning nil to prevent re-queuing since this is not a transient error.
+		return nil
+	}
+
+	cachedSpec, policyExisted := c.rawSpecMap[key]
+	if policyExisted && reflect.DeepEqual(cachedSpec, spec) {
+		return nil
+	}
+
+	// DP update policy call will delete old rules if this policy already exists in kernel
+	if err := c.dp.UpdatePolicy(npmNetPol); err != nil {
+		return fmt.Errorf("[syncAdminNetPol] Error: failed to update translated NPMNetworkPolicy into Dataplane due to %w", err)
+	}
+
+	if !policyExisted {
+		metrics.IncNumPolicies()
+	}
+	c.rawSpecMap[key] = spec
+	return nil
+}
+
+// translateUnstructured converts the dynamic client's object into the typed policy and translates it.
+func translateUnstructured(kind string, pol *unstructured.Unstructured) (interface{}, *policies.NPMNetworkPolicy, error) {
+	if kind == adminNetworkPolicyKind {
+		anp := &policyv1alpha1.AdminNetworkPolicy{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(pol.UnstructuredContent(), anp); err != nil {
+			return nil, nil, fmt.Errorf("failed to convert %s: %w", kind, err)
+		}
+		npmNetPol, err := translation.TranslateAdminNetworkPolicy(anp)
+		return &anp.Spec, npmNetPol, err
+	}
+
+	banp := &policyv1alpha1.BaselineAdminNetworkPolicy{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(pol.UnstructuredContent(), banp); err != nil {
+		return nil, nil, fmt.Errorf("failed to convert %s: %w", kind, err)
+	}
+	npmNetPol, err := translation.TranslateBaselineAdminNetworkPolicy(banp)
+	return &banp.Spec, npmNetPol, err
+}
+
+// cleanUpAdminNetworkPolicy removes the policy from the dataplane if it was applied.
+func (c *AdminNetworkPolicyController) cleanUpAdminNetworkPolicy(key string) error {
+	if _, ok := c.rawSpecMap[key]; !ok {
+		return nil
+	}
+
+	if err := c.dp.RemovePolicy(key); err != nil {
+		return fmt.Errorf("[cleanUpAdminNetworkPolicy] Error: failed to remove policy due to %w", err)
+	}
+
+	delete(c.rawSpecMap, key)
+	metrics.DecNumPolicies()
+	return nil
+}
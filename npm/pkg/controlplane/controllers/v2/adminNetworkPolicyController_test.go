@@ -0,0 +1,116 @@
+// Copyright 2018 Microsoft. All rights reserved.
+// MIT License
+package controllers
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-container-networking/npm/metrics"
+	policyv1alpha1 "github.com/Azure/azure-container-networking/npm/pkg/apis/policy/v1alpha1"
+	dpmocks "github.com/Azure/azure-container-networking/npm/pkg/dataplane/mocks"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
+	"github.com/Azure/azure-container-networking/npm/util"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newAdminNetPolController(t *testing.T, dp *dpmocks.MockGenericDataplane) *AdminNetworkPolicyController {
+	t.Helper()
+	gvrToListKind := map[schema.GroupVersionResource]string{
+		policyv1alpha1.AdminNetworkPolicyResource:         "AdminNetworkPolicyList",
+		policyv1alpha1.BaselineAdminNetworkPolicyResource: "BaselineAdminNetworkPolicyList",
+	}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), gvrToListKind)
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, noResyncPeriodFunc())
+	metrics.ReinitializeAll()
+	// Do not start informer to avoid unnecessary event triggers
+	return NewAdminNetworkPolicyController(factory, dp)
+}
+
+func toUnstructured(t *testing.T, obj interface{}) *unstructured.Unstructured {
+	t.Helper()
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	require.NoError(t, err)
+	return &unstructured.Unstructured{Object: content}
+}
+
+func TestSyncAdminNetworkPolicy(t *testing.T) {
+	if util.IsWindowsDP() {
+		t.Skip("AdminNetworkPolicies are only supported on Linux")
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	dp := dpmocks.NewMockGenericDataplane(ctrl)
+	c := newAdminNetPolController(t, dp)
+
+	anp := toUnstructured(t, &policyv1alpha1.AdminNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "guardrail", ResourceVersion: "1"},
+		Spec: policyv1alpha1.AdminNetworkPolicySpec{
+			Priority: 5,
+			Subject:  policyv1alpha1.AdminNetworkPolicySubject{Namespaces: &metav1.LabelSelector{}},
+			Ingress: []policyv1alpha1.AdminNetworkPolicyIngressRule{
+				{
+					Action: policyv1alpha1.AdminNetworkPolicyRuleActionDeny,
+					From:   []policyv1alpha1.AdminNetworkPolicyIngressPeer{{Namespaces: &metav1.LabelSelector{}}},
+				},
+			},
+		},
+	})
+	banp := toUnstructured(t, &policyv1alpha1.BaselineAdminNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", ResourceVersion: "1"},
+		Spec: policyv1alpha1.BaselineAdminNetworkPolicySpec{
+			Subject: policyv1alpha1.AdminNetworkPolicySubject{Namespaces: &metav1.LabelSelector{}},
+		},
+	})
+	require.NoError(t, c.anpInformer.Informer().GetIndexer().Add(anp))
+	require.NoError(t, c.banpInformer.Informer().GetIndexer().Add(banp))
+
+	dp.EXPECT().UpdatePolicy(gomock.Any()).DoAndReturn(func(netPol *policies.NPMNetworkPolicy) error {
+		require.Equal(t, "AdminNetworkPolicy/guardrail", netPol.PolicyKey)
+		require.Equal(t, policies.AdminTier, netPol.Tier)
+		require.Equal(t, int32(5), netPol.Priority)
+		return nil
+	}).Times(1)
+	require.NoError(t, c.syncAdminNetPol("AdminNetworkPolicy/guardrail"))
+
+	dp.EXPECT().UpdatePolicy(gomock.Any()).DoAndReturn(func(netPol *policies.NPMNetworkPolicy) error {
+		require.Equal(t, "BaselineAdminNetworkPolicy/default", netPol.PolicyKey)
+		require.Equal(t, policies.BaselineTier, netPol.Tier)
+		return nil
+	}).Times(1)
+	require.NoError(t, c.syncAdminNetPol("BaselineAdminNetworkPolicy/default"))
+	require.Equal(t, 2, c.LengthOfRawSpecMap())
+
+	// an unchanged spec isn't reapplied
+	require.NoError(t, c.syncAdminNetPol("AdminNetworkPolicy/guardrail"))
+
+	require.NoError(t, c.anpInformer.Informer().GetIndexer().Delete(anp))
+	dp.EXPECT().RemovePolicy("AdminNetworkPolicy/guardrail").Return(nil).Times(1)
+	require.NoError(t, c.syncAdminNetPol("AdminNetworkPolicy/guardrail"))
+	require.Equal(t, 1, c.LengthOfRawSpecMap())
+
+	// keys of unknown kinds are dropped
+	require.NoError(t, c.syncAdminNetPol("NetworkPolicy/guardrail"))
+}
+
+func TestSyncAdminNetworkPolicyTranslationFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	dp := dpmocks.NewMockGenericDataplane(ctrl)
+	c := newAdminNetPolController(t, dp)
+
+	// a subject must set exactly one field, so this policy can't be translated and isn't requeued
+	anp := toUnstructured(t, &policyv1alpha1.AdminNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "invalid"},
+	})
+	require.NoError(t, c.anpInformer.Informer().GetIndexer().Add(anp))
+	require.NoError(t, c.syncAdminNetPol("AdminNetworkPolicy/invalid"))
+	require.Equal(t, 0, c.LengthOfRawSpecMap())
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/Azure/azure-container-networking/npm/metrics"
+	"github.com/Azure/azure-container-networking/npm/pkg/controlplane/policystatus"
 	"github.com/Azure/azure-container-networking/npm/pkg/controlplane/translation"
 	"github.com/Azure/azure-container-networking/npm/pkg/dataplane"
 	"github.com/Azure/azure-container-networking/npm/util"
@@ -31,11 +32,17 @@ var (
 
 type NetworkPolicyController struct {
 	sync.RWMutex
-	netPolLister  netpollister.NetworkPolicyLister
-	workqueue     workqueue.RateLimitingInterface
-	rawNpSpecMap  map[string]*networkingv1.NetworkPolicySpec // Key is <nsname>/<policyname>
+	netPolLister netpollister.NetworkPolicyLister
+	workqueue    workqueue.RateLimitingInterface
+	rawNpSpecMap map[string]*networkingv1.NetworkPolicySpec // Key is <nsname>/<policyname>
+	// auditOnlyNetPols holds the keys of applied network policies with the audit only annotation
+	auditOnlyNetPols map[string]struct{}
+	// fqdnEgress holds the FQDN egress annotation of applied network policies which have it
+	fqdnEgress    map[string]string
 	dp            dataplane.GenericDataplane
 	npmLiteToggle bool
+	// statusTracker is nil unless policy status reporting is enabled
+	statusTracker *policystatus.Tracker
 }
 
 func (c *NetworkPolicyController) GetCache() map[string]*networkingv1.NetworkPolicySpec {
@@ -46,11 +53,13 @@ func (c *NetworkPolicyController) GetCache() map[string]*networkingv1.NetworkPol
 
 func NewNetworkPolicyController(npInformer networkinginformers.NetworkPolicyInformer, dp dataplane.GenericDataplane, npmLiteToggle bool) *NetworkPolicyController {
 	netPolController := &NetworkPolicyController{
-		netPolLister:  npInformer.Lister(),
-		workqueue:     workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "NetworkPolicy"),
-		rawNpSpecMap:  make(map[string]*networkingv1.NetworkPolicySpec),
-		dp:            dp,
-		npmLiteToggle: npmLiteToggle,
+		netPolLister:     npInformer.Lister(),
+		workqueue:        workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "NetworkPolicy"),
+		rawNpSpecMap:     make(map[string]*networkingv1.NetworkPolicySpec),
+		auditOnlyNetPols: make(map[string]struct{}),
+		fqdnEgress:       make(map[string]string),
+		dp:               dp,
+		npmLiteToggle:    npmLiteToggle,
 	}
 
 	npInformer.Informer().AddEventHandler(
@@ -63,6 +72,11 @@ func NewNetworkPolicyController(npInformer networkinginformers.NetworkPolicyInfo
 	return netPolController
 }
 
+// EnableStatusReporting records the translation result of every network policy in the tracker.
+func (c *NetworkPolicyController) EnableStatusReporting(tracker *policystatus.Tracker) {
+	c.statusTracker = tracker
+}
+
 func (c *NetworkPolicyController) LengthOfRawNpMap() int {
 	return len(c.rawNpSpecMap)
 }
@@ -266,7 +280,10 @@ func (c *NetworkPolicyController) syncNetPol(key string) error {
 		// netPolController does not need to reconcile this update.
 		// In this updateNetworkPolicy event,
 		// newNetPol was updated with states which netPolController does not need to reconcile.
-		if reflect.DeepEqual(cachedNetPolSpecObj, &netPolObj.Spec) {
+		// The audit only and FQDN egress annotations change the translated policy too.
+		_, cachedAuditOnly := c.auditOnlyNetPols[key]
+		if reflect.DeepEqual(cachedNetPolSpecObj, &netPolObj.Spec) && cachedAuditOnly == translation.IsAuditOnly(netPolObj) &&
+			c.fqdnEgress[key] == netPolObj.Annotations[util.NPMFQDNEgressAnnotation] {
 			return nil
 		}
 	}
@@ -290,6 +307,9 @@ func (c *NetworkPolicyController) syncAddAndUpdateNetPol(netPolObj *networkingv1
 
 	// install translated rules into kernel
 	npmNetPolObj, err := translation.TranslatePolicy(netPolObj, c.npmLiteToggle)
+	if c.statusTracker != nil {
+		c.statusTracker.PolicyTranslated(netPolObj, err)
+	}
 	if err != nil {
 		if isUnsupportedWindowsTranslationErr(err) {
 			klog.Warningf("NetworkPolicy %s in namespace %s is not translated because it has unsupported translated features of Windows: %s",
@@ -330,11 +350,26 @@ func (c *NetworkPolicyController) syncAddAndUpdateNetPol(netPolObj *networkingv1
 	}
 
 	c.rawNpSpecMap[netpolKey] = &netPolObj.Spec
+	if npmNetPolObj.AuditOnly {
+		c.auditOnlyNetPols[netpolKey] = struct{}{}
+	} else {
+		delete(c.auditOnlyNetPols, netpolKey)
+	}
+	if fqdnEgress, ok := netPolObj.Annotations[util.NPMFQDNEgressAnnotation]; ok {
+		c.fqdnEgress[netpolKey] = fqdnEgress
+	} else {
+		delete(c.fqdnEgress, netpolKey)
+	}
 	return operationKind, nil
 }
 
 // DeleteNetworkPolicy handles deleting network policy based on netPolKey.
 func (c *NetworkPolicyController) cleanUpNetworkPolicy(netPolKey string) error {
+	if c.statusTracker != nil {
+		// a policy which failed translation isn't cached
+		c.statusTracker.PolicyDeleted(netPolKey)
+	}
+
 	_, cachedNetPolObjExists := c.rawNpSpecMap[netPolKey]
 	// if there is no applied network policy with the netPolKey, do not need to clean up process.
 	if !cachedNetPolObjExists {
@@ -348,6 +383,8 @@ func (c *NetworkPolicyController) cleanUpNetworkPolicy(netPolKey string) error {
 
 	// Success to clean up ipset and iptables operations in kernel and delete the cached network policy from RawNpMap
 	delete(c.rawNpSpecMap, netPolKey)
+	delete(c.auditOnlyNetPols, netPolKey)
+	delete(c.fqdnEgress, netPolKey)
 	metrics.DecNumPolicies()
 	return nil
 }
@@ -11,6 +11,7 @@ import (
 	"github.com/Azure/azure-container-networking/npm/metrics/promutil"
 	"github.com/Azure/azure-container-networking/npm/pkg/dataplane"
 	dpmocks "github.com/Azure/azure-container-networking/npm/pkg/dataplane/mocks"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
 	"github.com/Azure/azure-container-networking/npm/util"
 	gomock "github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
@@ -618,3 +619,97 @@ func TestLabelUpdateNetworkPolicy(t *testing.T) {
 
 	checkNetPolTestResult("TestUpdateNetPol", f, testCases)
 }
+
+func TestAuditOnlyAnnotationUpdateNetworkPolicy(t *testing.T) {
+	oldNetPolObj := createNetPol()
+
+	f := newNetPolFixture(t)
+	f.netPolLister = append(f.netPolLister, oldNetPolObj)
+	f.kubeobjects = append(f.kubeobjects, oldNetPolObj)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dp := dpmocks.NewMockGenericDataplane(ctrl)
+	f.newNetPolController(stopCh, dp, false)
+
+	// only the annotation changes, but the policy must be reapplied in audit mode
+	newNetPolObj := oldNetPolObj.DeepCopy()
+	newNetPolObj.Annotations = map[string]string{util.NPMAuditOnlyAnnotation: "true"}
+	// oldNetPolObj.ResourceVersion value is "0"
+	newRV, _ := strconv.Atoi(oldNetPolObj.ResourceVersion)
+	newNetPolObj.ResourceVersion = fmt.Sprintf("%d", newRV+1)
+
+	var testCases []expectedNetPolValues
+
+	if util.IsWindowsDP() {
+		dp.EXPECT().UpdatePolicy(gomock.Any()).Times(0)
+
+		testCases = []expectedNetPolValues{
+			{0, 0, netPolPromVals{0, 0, 0, 0}},
+		}
+	} else {
+		gomock.InOrder(
+			dp.EXPECT().UpdatePolicy(gomock.Any()).Return(nil),
+			dp.EXPECT().UpdatePolicy(gomock.Any()).DoAndReturn(func(netPol *policies.NPMNetworkPolicy) error {
+				require.True(t, netPol.AuditOnly)
+				return nil
+			}),
+		)
+
+		testCases = []expectedNetPolValues{
+			{1, 0, netPolPromVals{1, 1, 1, 0}},
+		}
+	}
+	updateNetPol(t, f, oldNetPolObj, newNetPolObj)
+
+	checkNetPolTestResult("TestAuditOnlyAnnotationUpdateNetworkPolicy", f, testCases)
+}
+
+func TestFQDNEgressAnnotationUpdateNetworkPolicy(t *testing.T) {
+	oldNetPolObj := createNetPol()
+
+	f := newNetPolFixture(t)
+	f.netPolLister = append(f.netPolLister, oldNetPolObj)
+	f.kubeobjects = append(f.kubeobjects, oldNetPolObj)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dp := dpmocks.NewMockGenericDataplane(ctrl)
+	f.newNetPolController(stopCh, dp, false)
+
+	// only the annotation changes, but the policy must be reapplied with the FQDN patterns
+	newNetPolObj := oldNetPolObj.DeepCopy()
+	newNetPolObj.Annotations = map[string]string{util.NPMFQDNEgressAnnotation: "api.contoso.com"}
+	// oldNetPolObj.ResourceVersion value is "0"
+	newRV, _ := strconv.Atoi(oldNetPolObj.ResourceVersion)
+	newNetPolObj.ResourceVersion = fmt.Sprintf("%d", newRV+1)
+
+	var testCases []expectedNetPolValues
+
+	if util.IsWindowsDP() {
+		dp.EXPECT().UpdatePolicy(gomock.Any()).Times(0)
+
+		testCases = []expectedNetPolValues{
+			{0, 0, netPolPromVals{0, 0, 0, 0}},
+		}
+	} else {
+		gomock.InOrder(
+			dp.EXPECT().UpdatePolicy(gomock.Any()).Return(nil),
+			dp.EXPECT().UpdatePolicy(gomock.Any()).DoAndReturn(func(netPol *policies.NPMNetworkPolicy) error {
+				require.Equal(t, []string{"api.contoso.com"}, netPol.FQDNPatterns)
+				return nil
+			}),
+		)
+
+		testCases = []expectedNetPolValues{
+			{1, 0, netPolPromVals{1, 1, 1, 0}},
+		}
+	}
+	updateNetPol(t, f, oldNetPolObj, newNetPolObj)
+
+	checkNetPolTestResult("TestFQDNEgressAnnotationUpdateNetworkPolicy", f, testCases)
+}
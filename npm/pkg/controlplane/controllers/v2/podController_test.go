@@ -381,6 +381,58 @@ func TestAddPod(t *testing.T) {
 	checkNpmPodWithInput("TestAddPod", f, podObj)
 }
 
+func TestAddDualStackPod(t *testing.T) {
+	labels := map[string]string{
+		"app": "test-pod",
+	}
+	podObj := createPod("test-pod", "test-namespace", "0", "1.2.3.4", labels, NonHostNetwork, corev1.PodRunning)
+	podObj.Status.PodIPs = []corev1.PodIP{{IP: "1.2.3.4"}, {IP: "2001:db8::4"}}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dp := dpmocks.NewMockGenericDataplane(ctrl)
+	f := newFixture(t, dp)
+	f.podLister = append(f.podLister, podObj)
+	f.kubeobjects = append(f.kubeobjects, podObj)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	f.newPodController(stopCh)
+
+	mockIPSets := []*ipsets.IPSetMetadata{
+		ipsets.NewIPSetMetadata("test-namespace", ipsets.Namespace),
+		ipsets.NewIPSetMetadata("app", ipsets.KeyLabelOfPod),
+		ipsets.NewIPSetMetadata("app:test-pod", ipsets.KeyValueLabelOfPod),
+	}
+	podMetadata1 := dataplane.NewPodMetadata("test-namespace/test-pod", "1.2.3.4", "")
+	podMetadata1.PodIPv6 = "2001:db8::4"
+
+	dp.EXPECT().AddToLists([]*ipsets.IPSetMetadata{kubeAllNamespaces}, mockIPSets[:1]).Return(nil).Times(1)
+	dp.EXPECT().AddToSets(mockIPSets[:1], podMetadata1).Return(nil).Times(1)
+	dp.EXPECT().AddToSets(mockIPSets[1:], podMetadata1).Return(nil).Times(1)
+	if !util.IsWindowsDP() {
+		namedPortMetadata := dataplane.NewPodMetadata("test-namespace/test-pod", "1.2.3.4,8080", "")
+		namedPortMetadata.PodIPv6 = "2001:db8::4,8080"
+		dp.EXPECT().
+			AddToSets(
+				[]*ipsets.IPSetMetadata{ipsets.NewIPSetMetadata("app:test-pod", ipsets.NamedPorts)},
+				namedPortMetadata,
+			).
+			Return(nil).Times(1)
+	}
+	dp.EXPECT().ApplyDataPlane().Return(nil).Times(1)
+
+	addPod(t, f, podObj)
+	testCases := []expectedValues{
+		{1, 1, 0, podPromVals{1, 1, 0, 0, 0, 0, 0}},
+	}
+	// sleep in case rate limiter adds back to workqueue
+	time.Sleep(sleepDurationForRateLimiter)
+	checkPodTestResult("TestAddDualStackPod", f, testCases)
+	checkNpmPodWithInput("TestAddDualStackPod", f, podObj)
+	require.Equal(t, "2001:db8::4", f.podController.podMap["test-namespace/test-pod"].PodIPv6)
+}
+
 func TestAddHostNetworkPod(t *testing.T) {
 	labels := map[string]string{
 		"app": "test-pod",
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"sort"
+	"time"
 
 	cp "github.com/Azure/azure-container-networking/npm/pkg/controlplane"
 	"github.com/Azure/azure-container-networking/npm/pkg/dataplane"
@@ -11,11 +13,25 @@ import (
 	"github.com/Azure/azure-container-networking/npm/pkg/protos"
 	"github.com/Azure/azure-container-networking/npm/util"
 	npmerrors "github.com/Azure/azure-container-networking/npm/util/errors"
+	"google.golang.org/grpc"
 	"k8s.io/klog"
 )
 
+const (
+	reportStatusTimeout = 10 * time.Second
+	// reportStatusInterval is how often the status is reported even if it didn't change,
+	// so that the controller can forget nodes which stop reporting
+	reportStatusInterval = 5 * time.Minute
+)
+
 var ErrPodOrNodeNameNil = fmt.Errorf("both pod and node name must be set")
 
+// StatusReporter reports the programming status of policies to the controller.
+// It is implemented by the DataplaneEvents gRPC client.
+type StatusReporter interface {
+	ReportStatus(ctx context.Context, in *protos.PolicyStatusReport, opts ...grpc.CallOption) (*protos.PolicyStatusAck, error)
+}
+
 type GoalStateProcessor struct {
 	ctx            context.Context
 	cancel         context.CancelFunc
@@ -24,6 +40,15 @@ type GoalStateProcessor struct {
 	dp             dataplane.GenericDataplane
 	inputChannel   chan *protos.Events
 	backoffChannel chan *protos.Events
+
+	statusReporter StatusReporter
+	// policyStatus maps policy keys to the error from programming them, or "" if programmed
+	policyStatus map[string]string
+	// updatedPolicies are the policies updated while processing the current event
+	updatedPolicies []string
+	statusChanged   bool
+	// resendStatus ticks every reportStatusInterval while status reporting is enabled
+	resendStatus <-chan time.Time
 }
 
 func NewGoalStateProcessor(
@@ -46,9 +71,16 @@ func NewGoalStateProcessor(
 		dp:             dp,
 		inputChannel:   inputChan,
 		backoffChannel: make(chan *protos.Events),
+		policyStatus:   make(map[string]string),
 	}, nil
 }
 
+// EnableStatusReporting makes the GoalStateProcessor report the programming status of its policies
+// after a hydration event, whenever the status of a policy changes, and every reportStatusInterval.
+func (gsp *GoalStateProcessor) EnableStatusReporting(reporter StatusReporter) {
+	gsp.statusReporter = reporter
+}
+
 // Start kicks off the GoalStateProcessor
 func (gsp *GoalStateProcessor) Start(stopCh <-chan struct{}) {
 	klog.Infof("Starting GoalStateProcessor for node %s", gsp.nodeID)
@@ -64,6 +96,11 @@ func (gsp *GoalStateProcessor) Stop() {
 func (gsp *GoalStateProcessor) run(stopCh <-chan struct{}) {
 	klog.Infof("Starting dataplane for node %s", gsp.nodeID)
 
+	if gsp.statusReporter != nil {
+		ticker := time.NewTicker(reportStatusInterval)
+		defer ticker.Stop()
+		gsp.resendStatus = ticker.C
+	}
 	for gsp.processNext(stopCh) {
 	}
 }
@@ -84,6 +121,9 @@ func (gsp *GoalStateProcessor) processNext(stopCh <-chan struct{}) bool {
 		klog.Infof("Received backoff event %s", backoffEvents)
 		gsp.process(backoffEvents)
 		return true
+	case <-gsp.resendStatus:
+		gsp.reportStatus()
+		return true
 
 	case <-gsp.ctx.Done():
 		klog.Infof("GoalStateProcessor for node %s received context Done", gsp.nodeID)
@@ -96,11 +136,19 @@ func (gsp *GoalStateProcessor) processNext(stopCh <-chan struct{}) bool {
 
 func (gsp *GoalStateProcessor) process(inputEvent *protos.Events) {
 	klog.Infof("Processing event")
+	gsp.updatedPolicies = gsp.updatedPolicies[:0]
 	// apply dataplane after syncing
 	defer func() {
 		dperr := gsp.dp.ApplyDataPlane()
 		if dperr != nil {
 			klog.Errorf("Apply Dataplane failed with %v", dperr)
+			// the policies updated by this event may not be programmed
+			for _, policyKey := range gsp.updatedPolicies {
+				gsp.setPolicyStatus(policyKey, dperr)
+			}
+		}
+		if gsp.statusChanged || inputEvent.GetEventType() == protos.Events_Hydration {
+			gsp.reportStatus()
 		}
 	}()
 
@@ -386,10 +434,12 @@ func (gsp *GoalStateProcessor) processPolicyApplyEvent(goalState *protos.GoalSta
 		klog.Infof("Netpol: %v", netpol)
 
 		err = gsp.dp.UpdatePolicy(netpol)
+		gsp.setPolicyStatus(netpol.PolicyKey, err)
 		if err != nil {
 			klog.Errorf("Error applying policy %s to dataplane with error: %s", netpol.PolicyKey, err.Error())
 			return nil, npmerrors.SimpleErrorWrapper("failed update policy event", err)
 		}
+		gsp.updatedPolicies = append(gsp.updatedPolicies, netpol.PolicyKey)
 		appendedPolicies[netpol.PolicyKey] = struct{}{}
 	}
 	return appendedPolicies, nil
@@ -409,10 +459,59 @@ func (gsp *GoalStateProcessor) processPolicyRemoveEvent(netpolNames []string) er
 			klog.Errorf("Error removing policy %s from dataplane with error: %s", netpolName, err.Error())
 			return npmerrors.SimpleErrorWrapper("failed remove policy event", err)
 		}
+		if _, ok := gsp.policyStatus[netpolName]; ok {
+			delete(gsp.policyStatus, netpolName)
+			gsp.statusChanged = true
+		}
 	}
 	return nil
 }
 
+// setPolicyStatus records the result of programming a policy.
+func (gsp *GoalStateProcessor) setPolicyStatus(policyKey string, err error) {
+	status := ""
+	if err != nil {
+		status = err.Error()
+	}
+	if previous, ok := gsp.policyStatus[policyKey]; ok && previous == status {
+		return
+	}
+	gsp.policyStatus[policyKey] = status
+	gsp.statusChanged = true
+}
+
+// reportStatus sends the status of every policy to the controller.
+// On failure, the status is sent again after the next event.
+func (gsp *GoalStateProcessor) reportStatus() {
+	if gsp.statusReporter == nil {
+		return
+	}
+
+	report := &protos.PolicyStatusReport{
+		PodName:  gsp.podName,
+		NodeName: gsp.nodeID,
+		Policies: make([]*protos.PolicyStatus, 0, len(gsp.policyStatus)),
+	}
+	for policyKey, status := range gsp.policyStatus {
+		report.Policies = append(report.Policies, &protos.PolicyStatus{
+			PolicyKey:  policyKey,
+			Programmed: status == "",
+			Error:      status,
+		})
+	}
+	sort.Slice(report.Policies, func(i, j int) bool {
+		return report.Policies[i].PolicyKey < report.Policies[j].PolicyKey
+	})
+
+	ctx, cancel := context.WithTimeout(gsp.ctx, reportStatusTimeout)
+	defer cancel()
+	if _, err := gsp.statusReporter.ReportStatus(ctx, report); err != nil {
+		klog.Errorf("Failed to report policy status for node %s: %v", gsp.nodeID, err)
+		return
+	}
+	gsp.statusChanged = false
+}
+
 func validatePayload(payload map[string]*protos.GoalState) bool {
 	for _, v := range payload {
 		if len(v.GetData()) != 0 {
@@ -2,6 +2,7 @@ package goalstateprocessor
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -13,6 +14,7 @@ import (
 	"github.com/Azure/azure-container-networking/npm/pkg/protos"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
 	"k8s.io/apimachinery/pkg/util/wait"
 )
 
@@ -107,6 +109,79 @@ func TestPolicyApplyEvent(t *testing.T) {
 	gsp.processNext(wait.NeverStop)
 }
 
+type fakeStatusReporter struct {
+	reports []*protos.PolicyStatusReport
+}
+
+func (f *fakeStatusReporter) ReportStatus(_ context.Context, in *protos.PolicyStatusReport, _ ...grpc.CallOption) (*protos.PolicyStatusAck, error) {
+	f.reports = append(f.reports, in)
+	return &protos.PolicyStatusAck{}, nil
+}
+
+func TestPolicyStatusReporting(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dp := dpmocks.NewMockGenericDataplane(ctrl)
+	gomock.InOrder(
+		dp.EXPECT().UpdatePolicy(gomock.Any()).Return(errors.New("failed to program ACL")),
+		dp.EXPECT().UpdatePolicy(gomock.Any()).Return(nil),
+		dp.EXPECT().UpdatePolicy(gomock.Any()).Return(nil),
+	)
+	dp.EXPECT().RemovePolicy(testNetPol.PolicyKey).Return(nil)
+	dp.EXPECT().ApplyDataPlane().Times(4)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	gsp, _ := NewGoalStateProcessor(ctx, "node1", "pod1", nil, dp)
+	reporter := &fakeStatusReporter{}
+	gsp.EnableStatusReporting(reporter)
+
+	policyPayload, err := controlplane.EncodeNPMNetworkPolicies([]*policies.NPMNetworkPolicy{testNetPol})
+	assert.NoError(t, err)
+	applyEvent := &protos.Events{
+		EventType: protos.Events_GoalState,
+		Payload: map[string]*protos.GoalState{
+			controlplane.PolicyApply: {Data: policyPayload.Bytes()},
+		},
+	}
+
+	gsp.process(applyEvent)
+	assert.Len(t, reporter.reports, 1)
+	assert.Equal(t, "pod1", reporter.reports[0].GetPodName())
+	assert.Equal(t, "node1", reporter.reports[0].GetNodeName())
+	assert.Len(t, reporter.reports[0].GetPolicies(), 1)
+	assert.False(t, reporter.reports[0].GetPolicies()[0].GetProgrammed())
+	assert.Equal(t, "failed to program ACL", reporter.reports[0].GetPolicies()[0].GetError())
+
+	gsp.process(applyEvent)
+	assert.Len(t, reporter.reports, 2)
+	assert.True(t, reporter.reports[1].GetPolicies()[0].GetProgrammed())
+
+	// unchanged status isn't reported again
+	gsp.process(applyEvent)
+	assert.Len(t, reporter.reports, 2)
+
+	removePayload, err := controlplane.EncodeStrings([]string{testNetPol.PolicyKey})
+	assert.NoError(t, err)
+	gsp.process(&protos.Events{
+		EventType: protos.Events_GoalState,
+		Payload: map[string]*protos.GoalState{
+			controlplane.PolicyRemove: {Data: removePayload.Bytes()},
+		},
+	})
+	assert.Len(t, reporter.reports, 3)
+	assert.Empty(t, reporter.reports[2].GetPolicies())
+
+	// the status is sent again periodically even if it didn't change
+	resend := make(chan time.Time, 1)
+	gsp.resendStatus = resend
+	resend <- time.Now()
+	assert.True(t, gsp.processNext(nil))
+	assert.Len(t, reporter.reports, 4)
+	assert.Empty(t, reporter.reports[3].GetPolicies())
+}
+
 func TestIPSetsApply(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -0,0 +1,64 @@
+package policystatus
+
+import (
+	"context"
+	"fmt"
+
+	npmv1alpha1 "github.com/Azure/azure-container-networking/npm/pkg/apis/npm/v1alpha1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+)
+
+// DynamicSummaryWriter writes the PolicyStatusSummary with the dynamic client.
+type DynamicSummaryWriter struct {
+	client dynamic.Interface
+}
+
+// NewDynamicSummaryWriter creates a DynamicSummaryWriter.
+// The npm.azure.com PolicyStatusSummary CRD must be installed.
+func NewDynamicSummaryWriter(client dynamic.Interface) *DynamicSummaryWriter {
+	return &DynamicSummaryWriter{client: client}
+}
+
+// WriteSummary creates or updates the PolicyStatusSummary.
+func (w *DynamicSummaryWriter) WriteSummary(ctx context.Context, status *npmv1alpha1.PolicyStatusSummaryStatus) error {
+	resource := w.client.Resource(npmv1alpha1.PolicyStatusSummaryResource)
+
+	summary := &npmv1alpha1.PolicyStatusSummary{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: npmv1alpha1.SchemeGroupVersion.String(),
+			Kind:       "PolicyStatusSummary",
+		},
+		ObjectMeta: metav1.ObjectMeta{Name: npmv1alpha1.PolicyStatusSummaryName},
+		Status:     *status,
+	}
+
+	existing, err := resource.Get(ctx, npmv1alpha1.PolicyStatusSummaryName, metav1.GetOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get PolicyStatusSummary: %w", err)
+	}
+	exists := err == nil
+	if exists {
+		summary.ResourceVersion = existing.GetResourceVersion()
+	}
+
+	object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(summary)
+	if err != nil {
+		return fmt.Errorf("failed to convert PolicyStatusSummary: %w", err)
+	}
+	obj := &unstructured.Unstructured{Object: object}
+
+	if !exists {
+		if _, err := resource.Create(ctx, obj, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create PolicyStatusSummary: %w", err)
+		}
+		return nil
+	}
+	if _, err := resource.Update(ctx, obj, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update PolicyStatusSummary: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,345 @@
+// Package policystatus publishes the programming status of NetworkPolicies.
+// The controlplane records translation errors, and the daemons report whether each policy is programmed on their node.
+// Namespace owners see Events on their NetworkPolicies, and cluster admins see a cluster-scoped PolicyStatusSummary.
+package policystatus
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	npmv1alpha1 "github.com/Azure/azure-container-networking/npm/pkg/apis/npm/v1alpha1"
+	"github.com/Azure/azure-container-networking/npm/pkg/protos"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+)
+
+const (
+	// ReasonTranslationFailed is the reason of the Warning event for a policy which NPM can't translate.
+	ReasonTranslationFailed = "TranslationFailed"
+	// ReasonProgrammingFailed is the reason of the Warning event for a policy which a node failed to program.
+	ReasonProgrammingFailed = "ProgrammingFailed"
+	// ReasonProgrammed is the reason of the Normal event for a policy which recovered from a failure.
+	ReasonProgrammed = "Programmed"
+
+	defaultFlushInterval = 30 * time.Second
+	writeSummaryTimeout  = 10 * time.Second
+	// staleNodeTTL is how long the status of a node is kept without a report.
+	// Daemons report at least every 5 minutes, so a node is only forgotten after missing a few reports.
+	staleNodeTTL = 15 * time.Minute
+	// maxSummaryPolicies and maxFailedNodeNames bound the size of the PolicyStatusSummary
+	maxSummaryPolicies = 100
+	maxFailedNodeNames = 10
+)
+
+// SummaryWriter persists the PolicyStatusSummary.
+type SummaryWriter interface {
+	WriteSummary(ctx context.Context, status *npmv1alpha1.PolicyStatusSummaryStatus) error
+}
+
+// Tracker aggregates policy status from the controlplane and the daemons.
+type Tracker struct {
+	sync.Mutex
+	recorder record.EventRecorder
+	writer   SummaryWriter
+
+	// refs are the NetworkPolicies which events are recorded on, keyed by policy key
+	refs map[string]*corev1.ObjectReference
+	// translationErrors are the policies which failed translation
+	translationErrors map[string]string
+	// nodes maps node names to the status reported by the node's daemon
+	nodes map[string]*nodeStatus
+	// failing holds the policies which had a failure when the last event was recorded, to detect recovery
+	failing map[string]struct{}
+	dirty   bool
+
+	flushInterval time.Duration
+}
+
+// nodeStatus is the last report of a node.
+type nodeStatus struct {
+	// policies maps policy keys to the programming error, or "" if the policy is programmed
+	policies   map[string]string
+	lastReport time.Time
+}
+
+// NewTracker creates a Tracker. The writer may be nil to only record events.
+func NewTracker(recorder record.EventRecorder, writer SummaryWriter) *Tracker {
+	return &Tracker{
+		recorder:          recorder,
+		writer:            writer,
+		refs:              make(map[string]*corev1.ObjectReference),
+		translationErrors: make(map[string]string),
+		nodes:             make(map[string]*nodeStatus),
+		failing:           make(map[string]struct{}),
+		flushInterval:     defaultFlushInterval,
+	}
+}
+
+// PolicyTranslated records the result of translating a NetworkPolicy. A nil error clears a previous failure.
+func (t *Tracker) PolicyTranslated(netPol *networkingv1.NetworkPolicy, err error) {
+	key := netPol.Namespace + "/" + netPol.Name
+	ref := &corev1.ObjectReference{
+		Kind:            "NetworkPolicy",
+		APIVersion:      networkingv1.SchemeGroupVersion.String(),
+		Namespace:       netPol.Namespace,
+		Name:            netPol.Name,
+		UID:             netPol.UID,
+		ResourceVersion: netPol.ResourceVersion,
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	t.refs[key] = ref
+	t.dirty = true
+
+	if err == nil {
+		delete(t.translationErrors, key)
+		t.updateFailing(key)
+		return
+	}
+
+	msg := err.Error()
+	if previous, ok := t.translationErrors[key]; ok && previous == msg {
+		return
+	}
+	t.translationErrors[key] = msg
+	t.failing[key] = struct{}{}
+	t.recorder.Eventf(ref, corev1.EventTypeWarning, ReasonTranslationFailed, "NetworkPolicy is not enforced on any node: %s", msg)
+}
+
+// PolicyDeleted forgets a NetworkPolicy.
+func (t *Tracker) PolicyDeleted(key string) {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.refs, key)
+	delete(t.translationErrors, key)
+	delete(t.failing, key)
+	for _, status := range t.nodes {
+		delete(status.policies, key)
+	}
+	t.dirty = true
+}
+
+// HandleReport replaces the status of the reporting node.
+func (t *Tracker) HandleReport(report *protos.PolicyStatusReport) {
+	node := report.GetNodeName()
+	if node == "" {
+		klog.Warningf("Ignoring policy status report without a node name from %s", report.GetPodName())
+		return
+	}
+
+	status := make(map[string]string, len(report.GetPolicies()))
+	for _, p := range report.GetPolicies() {
+		if p.GetProgrammed() {
+			status[p.GetPolicyKey()] = ""
+		} else {
+			status[p.GetPolicyKey()] = p.GetError()
+		}
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	var previous map[string]string
+	if previousStatus, ok := t.nodes[node]; ok {
+		previous = previousStatus.policies
+	}
+	t.nodes[node] = &nodeStatus{policies: status, lastReport: time.Now()}
+	t.dirty = true
+
+	for key, msg := range status {
+		if msg != "" && previous[key] != msg {
+			if ref, ok := t.refs[key]; ok {
+				t.recorder.Eventf(ref, corev1.EventTypeWarning, ReasonProgrammingFailed, "NetworkPolicy failed to program on node %s: %s", node, msg)
+			}
+		}
+		t.updateFailing(key)
+	}
+	for key := range previous {
+		if _, ok := status[key]; !ok {
+			t.updateFailing(key)
+		}
+	}
+}
+
+// NodeGone forgets the status of a node whose daemons all disconnected.
+func (t *Tracker) NodeGone(node string) {
+	t.Lock()
+	defer t.Unlock()
+	t.forgetNode(node)
+}
+
+// pruneStaleNodes forgets the nodes which haven't reported within staleNodeTTL, e.g. deleted nodes.
+func (t *Tracker) pruneStaleNodes(now time.Time) {
+	t.Lock()
+	defer t.Unlock()
+	for node, status := range t.nodes {
+		if now.Sub(status.lastReport) > staleNodeTTL {
+			klog.Infof("Forgetting policy status of node %s since it last reported at %s", node, status.lastReport)
+			t.forgetNode(node)
+		}
+	}
+}
+
+// forgetNode must be called with the lock held.
+func (t *Tracker) forgetNode(node string) {
+	status, ok := t.nodes[node]
+	if !ok {
+		return
+	}
+	delete(t.nodes, node)
+	t.dirty = true
+	for key := range status.policies {
+		t.updateFailing(key)
+	}
+}
+
+// updateFailing records a Normal event when a failing policy no longer has any failure.
+// It must be called with the lock held.
+func (t *Tracker) updateFailing(key string) {
+	failing := t.hasFailure(key)
+	_, wasFailing := t.failing[key]
+	switch {
+	case failing && !wasFailing:
+		t.failing[key] = struct{}{}
+	case !failing && wasFailing:
+		delete(t.failing, key)
+		if ref, ok := t.refs[key]; ok {
+			t.recorder.Event(ref, corev1.EventTypeNormal, ReasonProgrammed, "NetworkPolicy is no longer failing")
+		}
+	}
+}
+
+func (t *Tracker) hasFailure(key string) bool {
+	if _, ok := t.translationErrors[key]; ok {
+		return true
+	}
+	for _, status := range t.nodes {
+		if msg, ok := status.policies[key]; ok && msg != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Summary returns the aggregated status of all policies.
+func (t *Tracker) Summary() *npmv1alpha1.PolicyStatusSummaryStatus {
+	t.Lock()
+	defer t.Unlock()
+	return t.summary()
+}
+
+func (t *Tracker) summary() *npmv1alpha1.PolicyStatusSummaryStatus {
+	policies := make(map[string]*npmv1alpha1.PolicyStatus, len(t.refs))
+	get := func(key string) *npmv1alpha1.PolicyStatus {
+		p, ok := policies[key]
+		if !ok {
+			p = &npmv1alpha1.PolicyStatus{Name: key}
+			policies[key] = p
+		}
+		return p
+	}
+
+	for key := range t.refs {
+		get(key)
+	}
+	for key, msg := range t.translationErrors {
+		get(key).TranslationError = msg
+	}
+
+	nodeNames := make([]string, 0, len(t.nodes))
+	for node := range t.nodes {
+		nodeNames = append(nodeNames, node)
+	}
+	sort.Strings(nodeNames)
+	for _, node := range nodeNames {
+		for key, msg := range t.nodes[node].policies {
+			p := get(key)
+			if msg == "" {
+				p.ProgrammedNodes++
+				continue
+			}
+			p.FailedNodes++
+			if len(p.FailedNodeNames) < maxFailedNodeNames {
+				p.FailedNodeNames = append(p.FailedNodeNames, node)
+			}
+			if p.Error == "" {
+				p.Error = msg
+			}
+		}
+	}
+
+	summary := &npmv1alpha1.PolicyStatusSummaryStatus{
+		LastUpdateTime: metav1.Now(),
+		ReportingNodes: len(t.nodes),
+		TotalPolicies:  len(policies),
+	}
+	failed := make([]npmv1alpha1.PolicyStatus, 0)
+	for _, p := range policies {
+		if p.TranslationError != "" || p.FailedNodes > 0 {
+			failed = append(failed, *p)
+		}
+	}
+	sort.Slice(failed, func(i, j int) bool {
+		return failed[i].Name < failed[j].Name
+	})
+	summary.FailedPolicies = len(failed)
+	if len(failed) > maxSummaryPolicies {
+		failed = failed[:maxSummaryPolicies]
+	}
+	summary.Policies = failed
+	return summary
+}
+
+// Run handles reports from the daemons and the nodes whose daemons disconnected,
+// and periodically prunes stale nodes and writes the PolicyStatusSummary until stopCh is closed.
+func (t *Tracker) Run(stopCh <-chan struct{}, reports <-chan *protos.PolicyStatusReport, nodesGone <-chan string) {
+	ticker := time.NewTicker(t.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case report := <-reports:
+			t.HandleReport(report)
+		case node := <-nodesGone:
+			t.NodeGone(node)
+		case <-ticker.C:
+			t.pruneStaleNodes(time.Now())
+			if err := t.flush(); err != nil {
+				klog.Errorf("Failed to write policy status summary: %v", err)
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// flush writes the summary if anything changed since the last successful write.
+func (t *Tracker) flush() error {
+	if t.writer == nil {
+		return nil
+	}
+
+	t.Lock()
+	if !t.dirty {
+		t.Unlock()
+		return nil
+	}
+	summary := t.summary()
+	t.dirty = false
+	t.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), writeSummaryTimeout)
+	defer cancel()
+	if err := t.writer.WriteSummary(ctx, summary); err != nil {
+		t.Lock()
+		t.dirty = true
+		t.Unlock()
+		return fmt.Errorf("failed to write summary: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package policystatus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	npmv1alpha1 "github.com/Azure/azure-container-networking/npm/pkg/apis/npm/v1alpha1"
+	"github.com/Azure/azure-container-networking/npm/pkg/protos"
+	"github.com/stretchr/testify/require"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+type fakeSummaryWriter struct {
+	summaries []*npmv1alpha1.PolicyStatusSummaryStatus
+	err       error
+}
+
+func (w *fakeSummaryWriter) WriteSummary(_ context.Context, status *npmv1alpha1.PolicyStatusSummaryStatus) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.summaries = append(w.summaries, status)
+	return nil
+}
+
+func netPol(namespace, name string) *networkingv1.NetworkPolicy {
+	return &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, UID: types.UID("uid-" + name)}}
+}
+
+func report(node string, policies ...*protos.PolicyStatus) *protos.PolicyStatusReport {
+	return &protos.PolicyStatusReport{PodName: "npm-" + node, NodeName: node, Policies: policies}
+}
+
+func requireEvents(t *testing.T, recorder *record.FakeRecorder, expected ...string) {
+	t.Helper()
+	for _, event := range expected {
+		select {
+		case actual := <-recorder.Events:
+			require.Equal(t, event, actual)
+		default:
+			require.Failf(t, "missing event", "expected %q", event)
+		}
+	}
+	select {
+	case actual := <-recorder.Events:
+		require.Failf(t, "unexpected event", "got %q", actual)
+	default:
+	}
+}
+
+func TestTranslationFailure(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	tracker := NewTracker(recorder, nil)
+
+	tracker.PolicyTranslated(netPol("x", "named-port"), errors.New("named ports are unsupported"))
+	requireEvents(t, recorder, "Warning TranslationFailed NetworkPolicy is not enforced on any node: named ports are unsupported")
+
+	// the same error isn't recorded again on resync
+	tracker.PolicyTranslated(netPol("x", "named-port"), errors.New("named ports are unsupported"))
+	requireEvents(t, recorder)
+
+	summary := tracker.Summary()
+	require.Equal(t, 1, summary.TotalPolicies)
+	require.Equal(t, 1, summary.FailedPolicies)
+	require.Equal(t, []npmv1alpha1.PolicyStatus{{Name: "x/named-port", TranslationError: "named ports are unsupported"}}, summary.Policies)
+
+	tracker.PolicyTranslated(netPol("x", "named-port"), nil)
+	requireEvents(t, recorder, "Normal Programmed NetworkPolicy is no longer failing")
+	require.Equal(t, 0, tracker.Summary().FailedPolicies)
+
+	tracker.PolicyDeleted("x/named-port")
+	require.Equal(t, 0, tracker.Summary().TotalPolicies)
+}
+
+func TestNodeReports(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	tracker := NewTracker(recorder, nil)
+	tracker.PolicyTranslated(netPol("x", "a"), nil)
+	tracker.PolicyTranslated(netPol("x", "b"), nil)
+
+	tracker.HandleReport(report("node1",
+		&protos.PolicyStatus{PolicyKey: "x/a", Programmed: true},
+		&protos.PolicyStatus{PolicyKey: "x/b", Error: "iptables-restore failed"},
+	))
+	tracker.HandleReport(report("node2",
+		&protos.PolicyStatus{PolicyKey: "x/a", Programmed: true},
+		&protos.PolicyStatus{PolicyKey: "x/b", Programmed: true},
+	))
+	requireEvents(t, recorder, "Warning ProgrammingFailed NetworkPolicy failed to program on node node1: iptables-restore failed")
+
+	summary := tracker.Summary()
+	require.Equal(t, 2, summary.ReportingNodes)
+	require.Equal(t, 2, summary.TotalPolicies)
+	require.Equal(t, 1, summary.FailedPolicies)
+	require.Equal(t, []npmv1alpha1.PolicyStatus{{
+		Name:            "x/b",
+		ProgrammedNodes: 1,
+		FailedNodes:     1,
+		FailedNodeNames: []string{"node1"},
+		Error:           "iptables-restore failed",
+	}}, summary.Policies)
+
+	// a report replaces the node's previous report
+	tracker.HandleReport(report("node1", &protos.PolicyStatus{PolicyKey: "x/a", Programmed: true}))
+	requireEvents(t, recorder, "Normal Programmed NetworkPolicy is no longer failing")
+	require.Equal(t, 0, tracker.Summary().FailedPolicies)
+
+	tracker.HandleReport(report(""))
+	require.Equal(t, 2, tracker.Summary().ReportingNodes)
+}
+
+func TestForgetNodes(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	tracker := NewTracker(recorder, nil)
+	tracker.PolicyTranslated(netPol("x", "a"), nil)
+	tracker.HandleReport(report("node1", &protos.PolicyStatus{PolicyKey: "x/a", Error: "iptables-restore failed"}))
+	tracker.HandleReport(report("node2", &protos.PolicyStatus{PolicyKey: "x/a", Programmed: true}))
+	requireEvents(t, recorder, "Warning ProgrammingFailed NetworkPolicy failed to program on node node1: iptables-restore failed")
+
+	// the failure goes away with the node whose daemons disconnected
+	tracker.NodeGone("node1")
+	requireEvents(t, recorder, "Normal Programmed NetworkPolicy is no longer failing")
+	summary := tracker.Summary()
+	require.Equal(t, 1, summary.ReportingNodes)
+	require.Equal(t, 0, summary.FailedPolicies)
+	tracker.NodeGone("node1")
+
+	// nodes which stop reporting are pruned
+	tracker.pruneStaleNodes(time.Now())
+	require.Equal(t, 1, tracker.Summary().ReportingNodes)
+	tracker.pruneStaleNodes(time.Now().Add(staleNodeTTL + time.Minute))
+	require.Equal(t, 0, tracker.Summary().ReportingNodes)
+	requireEvents(t, recorder)
+}
+
+func TestPolicyDeletedForgetsNodeStatus(t *testing.T) {
+	tracker := NewTracker(record.NewFakeRecorder(10), nil)
+	tracker.PolicyTranslated(netPol("x", "a"), nil)
+	tracker.HandleReport(report("node1", &protos.PolicyStatus{PolicyKey: "x/a", Error: "iptables-restore failed"}))
+	require.Equal(t, 1, tracker.Summary().FailedPolicies)
+
+	tracker.PolicyDeleted("x/a")
+	summary := tracker.Summary()
+	require.Equal(t, 0, summary.TotalPolicies)
+	require.Equal(t, 0, summary.FailedPolicies)
+	require.Empty(t, tracker.nodes["node1"].policies)
+}
+
+func TestFlush(t *testing.T) {
+	writer := &fakeSummaryWriter{err: errors.New("conflict")}
+	tracker := NewTracker(record.NewFakeRecorder(10), writer)
+	tracker.PolicyTranslated(netPol("x", "a"), nil)
+
+	require.Error(t, tracker.flush())
+	writer.err = nil
+	require.NoError(t, tracker.flush())
+	require.Len(t, writer.summaries, 1)
+
+	// nothing changed
+	require.NoError(t, tracker.flush())
+	require.Len(t, writer.summaries, 1)
+}
+
+func TestDynamicSummaryWriter(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	writer := NewDynamicSummaryWriter(client)
+	ctx := context.Background()
+
+	require.NoError(t, writer.WriteSummary(ctx, &npmv1alpha1.PolicyStatusSummaryStatus{TotalPolicies: 1}))
+	require.NoError(t, writer.WriteSummary(ctx, &npmv1alpha1.PolicyStatusSummaryStatus{TotalPolicies: 2}))
+
+	obj, err := client.Resource(npmv1alpha1.PolicyStatusSummaryResource).Get(ctx, npmv1alpha1.PolicyStatusSummaryName, metav1.GetOptions{})
+	require.NoError(t, err)
+	summary := &npmv1alpha1.PolicyStatusSummary{}
+	require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, summary))
+	require.Equal(t, 2, summary.Status.TotalPolicies)
+}
@@ -0,0 +1,328 @@
+package translation
+
+import (
+	"errors"
+	"fmt"
+
+	policyv1alpha1 "github.com/Azure/azure-container-networking/npm/pkg/apis/policy/v1alpha1"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
+	"github.com/Azure/azure-container-networking/npm/util"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var (
+	// ErrUnsupportedAdminNetworkPolicy is returned when AdminNetworkPolicy or BaselineAdminNetworkPolicy translation is used in windows.
+	ErrUnsupportedAdminNetworkPolicy = errors.New("unsupported AdminNetworkPolicy translation features used on windows")
+	// ErrUnsupportedNodesPeer is returned when an AdminNetworkPolicy egress peer selects nodes.
+	ErrUnsupportedNodesPeer = errors.New("unsupported nodes peer in AdminNetworkPolicy")
+	// ErrUnsupportedSubjectSelector is returned when a subject's namespace selector can't be expressed as a single set of ipsets.
+	ErrUnsupportedSubjectSelector = errors.New("unsupported AdminNetworkPolicy subject namespace selector with multiple values in a matchExpression")
+	// ErrInvalidAdminPeer is returned when an AdminNetworkPolicy peer or subject doesn't set exactly one field.
+	ErrInvalidAdminPeer   = errors.New("AdminNetworkPolicy peer or subject must set exactly one field")
+	errUnknownAdminAction = errors.New("unknown AdminNetworkPolicy rule action")
+)
+
+// adminPeer unifies the ingress and egress peers of AdminNetworkPolicy and BaselineAdminNetworkPolicy rules.
+type adminPeer struct {
+	namespaces *metav1.LabelSelector
+	pods       *policyv1alpha1.NamespacedPod
+	nodes      *metav1.LabelSelector
+	networks   []policyv1alpha1.CIDR
+}
+
+// TranslateAdminNetworkPolicy translates an AdminNetworkPolicy object to an NPMNetworkPolicy object in the AdminTier.
+func TranslateAdminNetworkPolicy(anp *policyv1alpha1.AdminNetworkPolicy) (*policies.NPMNetworkPolicy, error) {
+	if util.IsWindowsDP() {
+		return nil, ErrUnsupportedAdminNetworkPolicy
+	}
+
+	npmNetPol := policies.NewAdminNPMNetworkPolicy(anp.Name, policies.AdminTier, anp.Spec.Priority)
+	if err := adminSubject(npmNetPol, &anp.Spec.Subject); err != nil {
+		return nil, err
+	}
+
+	for i := range anp.Spec.Ingress {
+		rule := &anp.Spec.Ingress[i]
+		verdict, err := adminVerdict(string(rule.Action))
+		if err != nil {
+			return nil, err
+		}
+		if err := translateAdminRule(npmNetPol, anp.Name, policies.Ingress, policies.SrcMatch, verdict, i, rule.Ports, ingressAdminPeers(rule.From)); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range anp.Spec.Egress {
+		rule := &anp.Spec.Egress[i]
+		verdict, err := adminVerdict(string(rule.Action))
+		if err != nil {
+			return nil, err
+		}
+		if err := translateAdminRule(npmNetPol, anp.Name, policies.Egress, policies.DstMatch, verdict, i, rule.Ports, egressAdminPeers(rule.To)); err != nil {
+			return nil, err
+		}
+	}
+	return npmNetPol, nil
+}
+
+// TranslateBaselineAdminNetworkPolicy translates a BaselineAdminNetworkPolicy object to an NPMNetworkPolicy object in the BaselineTier.
+func TranslateBaselineAdminNetworkPolicy(banp *policyv1alpha1.BaselineAdminNetworkPolicy) (*policies.NPMNetworkPolicy, error) {
+	if util.IsWindowsDP() {
+		return nil, ErrUnsupportedAdminNetworkPolicy
+	}
+
+	npmNetPol := policies.NewAdminNPMNetworkPolicy(banp.Name, policies.BaselineTier, 0)
+	if err := adminSubject(npmNetPol, &banp.Spec.Subject); err != nil {
+		return nil, err
+	}
+
+	for i := range banp.Spec.Ingress {
+		rule := &banp.Spec.Ingress[i]
+		verdict, err := baselineVerdict(rule.Action)
+		if err != nil {
+			return nil, err
+		}
+		if err := translateAdminRule(npmNetPol, banp.Name, policies.Ingress, policies.SrcMatch, verdict, i, rule.Ports, ingressAdminPeers(rule.From)); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range banp.Spec.Egress {
+		rule := &banp.Spec.Egress[i]
+		verdict, err := baselineVerdict(rule.Action)
+		if err != nil {
+			return nil, err
+		}
+		if err := translateAdminRule(npmNetPol, banp.Name, policies.Egress, policies.DstMatch, verdict, i, rule.Ports, egressAdminPeers(rule.To)); err != nil {
+			return nil, err
+		}
+	}
+	return npmNetPol, nil
+}
+
+func adminVerdict(action string) (policies.Verdict, error) {
+	switch policyv1alpha1.AdminNetworkPolicyRuleAction(action) {
+	case policyv1alpha1.AdminNetworkPolicyRuleActionAllow:
+		return policies.Allowed, nil
+	case policyv1alpha1.AdminNetworkPolicyRuleActionDeny:
+		return policies.Dropped, nil
+	case policyv1alpha1.AdminNetworkPolicyRuleActionPass:
+		return policies.Passed, nil
+	default:
+		return "", fmt.Errorf("%w: %s", errUnknownAdminAction, action)
+	}
+}
+
+// baselineVerdict is like adminVerdict except BaselineAdminNetworkPolicies can't pass flows.
+func baselineVerdict(action policyv1alpha1.BaselineAdminNetworkPolicyRuleAction) (policies.Verdict, error) {
+	switch action {
+	case policyv1alpha1.BaselineAdminNetworkPolicyRuleActionAllow:
+		return policies.Allowed, nil
+	case policyv1alpha1.BaselineAdminNetworkPolicyRuleActionDeny:
+		return policies.Dropped, nil
+	default:
+		return "", fmt.Errorf("%w: %s", errUnknownAdminAction, action)
+	}
+}
+
+func ingressAdminPeers(from []policyv1alpha1.AdminNetworkPolicyIngressPeer) []adminPeer {
+	peers := make([]adminPeer, 0, len(from))
+	for i := range from {
+		peers = append(peers, adminPeer{namespaces: from[i].Namespaces, pods: from[i].Pods})
+	}
+	return peers
+}
+
+func egressAdminPeers(to []policyv1alpha1.AdminNetworkPolicyEgressPeer) []adminPeer {
+	peers := make([]adminPeer, 0, len(to))
+	for i := range to {
+		peers = append(peers, adminPeer{namespaces: to[i].Namespaces, pods: to[i].Pods, nodes: to[i].Nodes, networks: to[i].Networks})
+	}
+	return peers
+}
+
+// adminSubject translates the subject of an AdminNetworkPolicy or BaselineAdminNetworkPolicy into the pod selector ipsets of npmNetPol.
+// Unlike a NetworkPolicy's podSelector, the subject isn't limited to a single namespace.
+func adminSubject(npmNetPol *policies.NPMNetworkPolicy, subject *policyv1alpha1.AdminNetworkPolicySubject) error {
+	var nsSelector *metav1.LabelSelector
+	switch {
+	case subject.Namespaces != nil && subject.Pods == nil:
+		nsSelector = subject.Namespaces
+	case subject.Pods != nil && subject.Namespaces == nil:
+		psResult, err := podSelector(npmNetPol.PolicyKey, policies.EitherMatch, &subject.Pods.PodSelector)
+		if err != nil {
+			return err
+		}
+		npmNetPol.PodSelectorIPSets = psResult.psSets
+		npmNetPol.ChildPodSelectorIPSets = psResult.childPSSets
+		npmNetPol.PodSelectorList = psResult.psList
+		nsSelector = &subject.Pods.NamespaceSelector
+	default:
+		return fmt.Errorf("subject of %s: %w", npmNetPol.PolicyKey, ErrInvalidAdminPeer)
+	}
+
+	// a jump to the policy chain can only AND ipsets, so the OR of a flattened namespace selector can't be expressed
+	flattenNSSelector, err := flattenNameSpaceSelector(nsSelector)
+	if err != nil {
+		return err
+	}
+	if len(flattenNSSelector) != 1 {
+		return fmt.Errorf("subject of %s: %w", npmNetPol.PolicyKey, ErrUnsupportedSubjectSelector)
+	}
+	nsSelectorIPSets, nsSelectorList := nameSpaceSelector(policies.EitherMatch, &flattenNSSelector[0])
+	npmNetPol.PodSelectorIPSets = append(npmNetPol.PodSelectorIPSets, nsSelectorIPSets...)
+	npmNetPol.PodSelectorList = append(npmNetPol.PodSelectorList, nsSelectorList...)
+	return nil
+}
+
+// translateAdminRule translates a rule of an AdminNetworkPolicy or BaselineAdminNetworkPolicy.
+// Rules are translated into ACLs in order, and the first ACL matching a flow decides the flow.
+// There is no default drop ACL since flows that no rule matches are decided by the next tier.
+func translateAdminRule(npmNetPol *policies.NPMNetworkPolicy,
+	policyName string,
+	direction policies.Direction,
+	matchType policies.MatchType,
+	verdict policies.Verdict,
+	ruleIndex int,
+	adminPorts *[]policyv1alpha1.AdminNetworkPolicyPort,
+	peers []adminPeer,
+) error {
+	ports := netPolPorts(adminPorts)
+	for peerIdx := range peers {
+		peer := &peers[peerIdx]
+		switch {
+		case peer.nodes != nil:
+			return fmt.Errorf("rule %d of %s: %w", ruleIndex, npmNetPol.PolicyKey, ErrUnsupportedNodesPeer)
+
+		case len(peer.networks) > 0:
+			networksIPSet, err := networksIPSet(policyName, npmNetPol.Namespace, direction, ruleIndex, peerIdx, peer.networks)
+			if err != nil {
+				return err
+			}
+			npmNetPol.RuleIPSets = append(npmNetPol.RuleIPSets, networksIPSet)
+			setInfo := policies.NewSetInfo(networksIPSet.Metadata.Name, ipsets.CIDRBlocks, included, matchType)
+			if err := adminPeerAndPortRule(npmNetPol, direction, verdict, ports, []policies.SetInfo{setInfo}); err != nil {
+				return err
+			}
+
+		case peer.namespaces != nil && peer.pods == nil:
+			if err := adminNamespacesRule(npmNetPol, direction, matchType, verdict, ports, peer.namespaces, nil); err != nil {
+				return err
+			}
+
+		case peer.pods != nil && peer.namespaces == nil:
+			psResult, err := podSelector(npmNetPol.PolicyKey, matchType, &peer.pods.PodSelector)
+			if err != nil {
+				return err
+			}
+			npmNetPol.RuleIPSets = append(npmNetPol.RuleIPSets, psResult.psSets...)
+			npmNetPol.RuleIPSets = append(npmNetPol.RuleIPSets, psResult.childPSSets...)
+			if err := adminNamespacesRule(npmNetPol, direction, matchType, verdict, ports, &peer.pods.NamespaceSelector, psResult.psList); err != nil {
+				return err
+			}
+
+		default:
+			return fmt.Errorf("rule %d of %s: %w", ruleIndex, npmNetPol.PolicyKey, ErrInvalidAdminPeer)
+		}
+	}
+	return nil
+}
+
+// adminNamespacesRule adds ACLs for pods in the namespaces selected by nsSelector, which also match podSetInfos if any.
+func adminNamespacesRule(npmNetPol *policies.NPMNetworkPolicy,
+	direction policies.Direction,
+	matchType policies.MatchType,
+	verdict policies.Verdict,
+	ports []networkingv1.NetworkPolicyPort,
+	nsSelector *metav1.LabelSelector,
+	podSetInfos []policies.SetInfo,
+) error {
+	// Before translating NamespaceSelector, flattenNameSpaceSelector function call should be called
+	// to handle multiple values in matchExpressions spec.
+	flattenNSSelector, err := flattenNameSpaceSelector(nsSelector)
+	if err != nil {
+		return err
+	}
+
+	for i := range flattenNSSelector {
+		nsSelectorIPSets, nsSelectorList := nameSpaceSelector(matchType, &flattenNSSelector[i])
+		npmNetPol.RuleIPSets = append(npmNetPol.RuleIPSets, nsSelectorIPSets...)
+		nsSelectorList = append(nsSelectorList, podSetInfos...)
+		if err := adminPeerAndPortRule(npmNetPol, direction, verdict, ports, nsSelectorList); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// adminPeerAndPortRule is like peerAndPortRule except the ACLs have the verdict of the rule.
+func adminPeerAndPortRule(npmNetPol *policies.NPMNetworkPolicy, direction policies.Direction, verdict policies.Verdict,
+	ports []networkingv1.NetworkPolicyPort, setInfo []policies.SetInfo,
+) error {
+	if len(ports) == 0 {
+		acl := policies.NewACLPolicy(verdict, direction)
+		acl.AddSetInfo(setInfo)
+		npmNetPol.ACLs = append(npmNetPol.ACLs, acl)
+		return nil
+	}
+
+	for i := range ports {
+		portKind, err := portType(ports[i])
+		if err != nil {
+			return err
+		}
+
+		acl := policies.NewACLPolicy(verdict, direction)
+		acl.AddSetInfo(setInfo)
+		npmNetPol.RuleIPSets = portRule(npmNetPol.RuleIPSets, acl, &ports[i], portKind)
+		npmNetPol.ACLs = append(npmNetPol.ACLs, acl)
+	}
+	return nil
+}
+
+// netPolPorts converts AdminNetworkPolicy ports to NetworkPolicy ports so that they are translated the same way.
+func netPolPorts(adminPorts *[]policyv1alpha1.AdminNetworkPolicyPort) []networkingv1.NetworkPolicyPort {
+	if adminPorts == nil {
+		return nil
+	}
+
+	ports := make([]networkingv1.NetworkPolicyPort, 0, len(*adminPorts))
+	for _, adminPort := range *adminPorts {
+		switch {
+		case adminPort.PortNumber != nil:
+			protocol := adminPort.PortNumber.Protocol
+			port := intstr.FromInt32(adminPort.PortNumber.Port)
+			ports = append(ports, networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &port})
+		case adminPort.NamedPort != nil:
+			port := intstr.FromString(*adminPort.NamedPort)
+			ports = append(ports, networkingv1.NetworkPolicyPort{Port: &port})
+		case adminPort.PortRange != nil:
+			protocol := adminPort.PortRange.Protocol
+			port := intstr.FromInt32(adminPort.PortRange.Start)
+			endPort := adminPort.PortRange.End
+			ports = append(ports, networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &port, EndPort: &endPort})
+		}
+	}
+	return ports
+}
+
+// networksIPSet returns a CIDR ipset holding all networks of an egress peer.
+func networksIPSet(policyName, ns string, direction policies.Direction, ruleIndex, peerIndex int, networks []policyv1alpha1.CIDR) (*ipsets.TranslatedIPSet, error) {
+	members := make([]string, 0, len(networks))
+	for _, network := range networks {
+		cidr := string(network)
+		if !util.IsIPV4(cidr) && !util.IsIPV6(cidr) {
+			return nil, ErrUnsupportedIPAddress
+		}
+		if splitCIDRs, ok := splitAllCIDRs[cidr]; ok {
+			members = append(members, splitCIDRs...)
+			continue
+		}
+		members = append(members, cidr)
+	}
+	setName := ipBlockSetName(policyName, ns, direction, ruleIndex, peerIndex)
+	return ipsets.NewTranslatedIPSet(setName, ipsets.CIDRBlocks, members...), nil
+}
@@ -0,0 +1,222 @@
+package translation
+
+import (
+	"testing"
+
+	policyv1alpha1 "github.com/Azure/azure-container-networking/npm/pkg/apis/policy/v1alpha1"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
+	"github.com/Azure/azure-container-networking/npm/util"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTranslateAdminNetworkPolicy(t *testing.T) {
+	tcp := v1.ProtocolTCP
+	tests := []struct {
+		name    string
+		anp     *policyv1alpha1.AdminNetworkPolicy
+		want    *policies.NPMNetworkPolicy
+		wantErr error
+	}{
+		{
+			name: "namespace subject with deny, pass and allow rules",
+			anp: &policyv1alpha1.AdminNetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "guardrail"},
+				Spec: policyv1alpha1.AdminNetworkPolicySpec{
+					Priority: 10,
+					Subject: policyv1alpha1.AdminNetworkPolicySubject{
+						Namespaces: &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "a"}},
+					},
+					Ingress: []policyv1alpha1.AdminNetworkPolicyIngressRule{
+						{
+							Action: policyv1alpha1.AdminNetworkPolicyRuleActionDeny,
+							From: []policyv1alpha1.AdminNetworkPolicyIngressPeer{
+								{Namespaces: &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "b"}}},
+							},
+						},
+						{
+							Action: policyv1alpha1.AdminNetworkPolicyRuleActionPass,
+							From: []policyv1alpha1.AdminNetworkPolicyIngressPeer{
+								{
+									Pods: &policyv1alpha1.NamespacedPod{
+										PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+									},
+								},
+							},
+						},
+					},
+					Egress: []policyv1alpha1.AdminNetworkPolicyEgressRule{
+						{
+							Action: policyv1alpha1.AdminNetworkPolicyRuleActionAllow,
+							To: []policyv1alpha1.AdminNetworkPolicyEgressPeer{
+								{Networks: []policyv1alpha1.CIDR{"10.0.0.0/8"}},
+							},
+							Ports: &[]policyv1alpha1.AdminNetworkPolicyPort{
+								{PortNumber: &policyv1alpha1.Port{Protocol: tcp, Port: 443}},
+							},
+						},
+					},
+				},
+			},
+			want: &policies.NPMNetworkPolicy{
+				Namespace: "AdminNetworkPolicy",
+				PolicyKey: "AdminNetworkPolicy/guardrail",
+				Tier:      policies.AdminTier,
+				Priority:  10,
+				PodSelectorIPSets: []*ipsets.TranslatedIPSet{
+					ipsets.NewTranslatedIPSet("tenant:a", ipsets.KeyValueLabelOfNamespace),
+				},
+				PodSelectorList: []policies.SetInfo{
+					policies.NewSetInfo("tenant:a", ipsets.KeyValueLabelOfNamespace, included, policies.EitherMatch),
+				},
+				RuleIPSets: []*ipsets.TranslatedIPSet{
+					ipsets.NewTranslatedIPSet("tenant:b", ipsets.KeyValueLabelOfNamespace),
+					ipsets.NewTranslatedIPSet("app:web", ipsets.KeyValueLabelOfPod),
+					ipsets.NewTranslatedIPSet(util.KubeAllNamespacesFlag, ipsets.KeyLabelOfNamespace),
+					ipsets.NewTranslatedIPSet("guardrail-in-ns-AdminNetworkPolicy-0-0OUT", ipsets.CIDRBlocks, "10.0.0.0/8"),
+				},
+				ACLs: []*policies.ACLPolicy{
+					{
+						Target:    policies.Dropped,
+						Direction: policies.Ingress,
+						SrcList: []policies.SetInfo{
+							policies.NewSetInfo("tenant:b", ipsets.KeyValueLabelOfNamespace, included, policies.SrcMatch),
+						},
+					},
+					{
+						Target:    policies.Passed,
+						Direction: policies.Ingress,
+						SrcList: []policies.SetInfo{
+							policies.NewSetInfo(util.KubeAllNamespacesFlag, ipsets.KeyLabelOfNamespace, included, policies.SrcMatch),
+							policies.NewSetInfo("app:web", ipsets.KeyValueLabelOfPod, included, policies.SrcMatch),
+						},
+					},
+					{
+						Target:    policies.Allowed,
+						Direction: policies.Egress,
+						DstList: []policies.SetInfo{
+							policies.NewSetInfo("guardrail-in-ns-AdminNetworkPolicy-0-0OUT", ipsets.CIDRBlocks, included, policies.DstMatch),
+						},
+						DstPorts: policies.Ports{Port: 443, EndPort: 0},
+						Protocol: "TCP",
+					},
+				},
+			},
+		},
+		{
+			name: "nodes peer",
+			anp: &policyv1alpha1.AdminNetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "nodes"},
+				Spec: policyv1alpha1.AdminNetworkPolicySpec{
+					Subject: policyv1alpha1.AdminNetworkPolicySubject{Namespaces: &metav1.LabelSelector{}},
+					Egress: []policyv1alpha1.AdminNetworkPolicyEgressRule{
+						{
+							Action: policyv1alpha1.AdminNetworkPolicyRuleActionDeny,
+							To:     []policyv1alpha1.AdminNetworkPolicyEgressPeer{{Nodes: &metav1.LabelSelector{}}},
+						},
+					},
+				},
+			},
+			wantErr: ErrUnsupportedNodesPeer,
+		},
+		{
+			name: "subject namespace selector with multiple values",
+			anp: &policyv1alpha1.AdminNetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "multi"},
+				Spec: policyv1alpha1.AdminNetworkPolicySpec{
+					Subject: policyv1alpha1.AdminNetworkPolicySubject{
+						Namespaces: &metav1.LabelSelector{
+							MatchExpressions: []metav1.LabelSelectorRequirement{
+								{Key: "tenant", Operator: metav1.LabelSelectorOpIn, Values: []string{"a", "b"}},
+							},
+						},
+					},
+				},
+			},
+			wantErr: ErrUnsupportedSubjectSelector,
+		},
+		{
+			name: "subject without fields",
+			anp: &policyv1alpha1.AdminNetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "empty"},
+			},
+			wantErr: ErrInvalidAdminPeer,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TranslateAdminNetworkPolicy(tt.anp)
+			if util.IsWindowsDP() {
+				require.ErrorIs(t, err, ErrUnsupportedAdminNetworkPolicy)
+				return
+			}
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTranslateBaselineAdminNetworkPolicy(t *testing.T) {
+	banp := &policyv1alpha1.BaselineAdminNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "default"},
+		Spec: policyv1alpha1.BaselineAdminNetworkPolicySpec{
+			Subject: policyv1alpha1.AdminNetworkPolicySubject{
+				Pods: &policyv1alpha1.NamespacedPod{
+					NamespaceSelector: metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "a"}},
+					PodSelector:       metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+				},
+			},
+			Ingress: []policyv1alpha1.BaselineAdminNetworkPolicyIngressRule{
+				{
+					Action: policyv1alpha1.BaselineAdminNetworkPolicyRuleActionDeny,
+					From: []policyv1alpha1.AdminNetworkPolicyIngressPeer{
+						{Namespaces: &metav1.LabelSelector{}},
+					},
+				},
+			},
+		},
+	}
+
+	got, err := TranslateBaselineAdminNetworkPolicy(banp)
+	if util.IsWindowsDP() {
+		require.ErrorIs(t, err, ErrUnsupportedAdminNetworkPolicy)
+		return
+	}
+	require.NoError(t, err)
+
+	want := &policies.NPMNetworkPolicy{
+		Namespace: "BaselineAdminNetworkPolicy",
+		PolicyKey: "BaselineAdminNetworkPolicy/default",
+		Tier:      policies.BaselineTier,
+		PodSelectorIPSets: []*ipsets.TranslatedIPSet{
+			ipsets.NewTranslatedIPSet("app:db", ipsets.KeyValueLabelOfPod),
+			ipsets.NewTranslatedIPSet("tenant:a", ipsets.KeyValueLabelOfNamespace),
+		},
+		ChildPodSelectorIPSets: []*ipsets.TranslatedIPSet{},
+		PodSelectorList: []policies.SetInfo{
+			policies.NewSetInfo("app:db", ipsets.KeyValueLabelOfPod, included, policies.EitherMatch),
+			policies.NewSetInfo("tenant:a", ipsets.KeyValueLabelOfNamespace, included, policies.EitherMatch),
+		},
+		RuleIPSets: []*ipsets.TranslatedIPSet{
+			ipsets.NewTranslatedIPSet(util.KubeAllNamespacesFlag, ipsets.KeyLabelOfNamespace),
+		},
+		ACLs: []*policies.ACLPolicy{
+			{
+				Target:    policies.Dropped,
+				Direction: policies.Ingress,
+				SrcList: []policies.SetInfo{
+					policies.NewSetInfo(util.KubeAllNamespacesFlag, ipsets.KeyLabelOfNamespace, included, policies.SrcMatch),
+				},
+			},
+		},
+	}
+	require.Equal(t, want, got)
+}
@@ -3,6 +3,7 @@ package translation
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
 	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
@@ -36,6 +37,14 @@ var (
 	ErrUnsupportedIPAddress = errors.New("unsupported IP address")
 	// ErrUnsupportedNonCIDR is returned when non-CIDR blocks are passed in with NPM Lite enabled. NPM Lite allows deny-all and allow-all policies
 	ErrUnsupportedNonCIDR = errors.New("Non-CIDR blocks, named ports, and ingress/egress namespace/pod selectors are not supported when NPM Lite is enabled, allowing only CIDR-based policies")
+	// ErrInvalidFQDNPattern is returned when the FQDN egress annotation has a name which isn't a domain name or a wildcard of one
+	ErrInvalidFQDNPattern = errors.New("invalid FQDN egress pattern")
+
+	// splitAllCIDRs maps the CIDRs matching all addresses of a family to their halves, since ipset doesn't allow a /0
+	splitAllCIDRs = map[string][]string{
+		"0.0.0.0/0": {"0.0.0.0/1", "128.0.0.0/1"},
+		"::/0":      {"::/1", "8000::/1"},
+	}
 )
 
 type podSelectorResult struct {
@@ -51,6 +60,12 @@ const (
 	namedPortType        netpolPortType = "namedport"
 	included             bool           = true
 	ipBlocksetNameFormat                = "%s-in-ns-%s-%d-%d%s"
+	fqdnSetNameFormat                   = "%s-in-ns-%s-fqdn"
+
+	// fqdnWildcardPrefix matches any subdomain of the rest of the pattern
+	fqdnWildcardPrefix  = "*."
+	maxDomainNameLength = 253
+	maxLabelLength      = 63
 )
 
 // portType returns type of ports (e.g., numeric port or namedPort) given NetworkPolicyPort object.
@@ -181,17 +196,16 @@ func ipBlockIPSet(policyName, ns string, direction policies.Direction, ipBlockSe
 
 	var members []string
 	indexOfMembers := 0
-	// Ipset doesn't allow 0.0.0.0/0 to be added.
+	// Ipset doesn't allow 0.0.0.0/0 (or ::/0) to be added.
 	// A solution is split 0.0.0.0/0 in half which convert to 0.0.0.0/1 and 128.0.0.0/1.
 	// splitCIDRSet is used to handle case where IPBlock has "0.0.0.0/0" in CIDR and "0.0.0.0/1" or "128.0.0.0/1"  in Except.
 	// splitCIDRSet has two entries ("0.0.0.0/1" and "128.0.0.0/1") as key.
 	splitCIDRLen := 2
 	splitCIDRSet := make(map[string]int, splitCIDRLen)
-	if ipBlockRule.CIDR == "0.0.0.0/0" {
+	if splitCIDRs, ok := splitAllCIDRs[ipBlockRule.CIDR]; ok {
 		// two cidrs (0.0.0.0/1 and 128.0.0.0/1) for 0.0.0.0/0 + except.
 		members = make([]string, lenOfDeDupExcepts+splitCIDRLen)
 		// in case of "0.0.0.0/0", "0.0.0.0/1" or "0.0.0.0/1 nomatch" comes eariler than "128.0.0.0/1" or "128.0.0.0/1 nomatch".
-		splitCIDRs := []string{"0.0.0.0/1", "128.0.0.0/1"}
 		for _, cidr := range splitCIDRs {
 			members[indexOfMembers] = cidr
 			splitCIDRSet[cidr] = indexOfMembers
@@ -230,7 +244,8 @@ func ipBlockRule(policyName, ns string, direction policies.Direction, matchType
 		return nil, policies.SetInfo{}, nil
 	}
 
-	if !util.IsIPV4(ipBlockRule.CIDR) {
+	// IPv6 is only supported in Linux, where each set has an inet6 counterpart.
+	if !util.IsIPV4(ipBlockRule.CIDR) && (util.IsWindowsDP() || !util.IsIPV6(ipBlockRule.CIDR)) {
 		return nil, policies.SetInfo{}, ErrUnsupportedIPAddress
 	}
 
@@ -622,6 +637,7 @@ func egressPolicy(npmNetPol *policies.NPMNetworkPolicy, netPolName string, egres
 
 	// #2. If egress is nil (in yaml file, it is specified with '[]'), it means "Deny all" - it does not allow sending traffic to others.
 	if egress == nil {
+		fqdnRule(npmNetPol, netPolName)
 		// Except for allow all traffic case in #1, the rest of them should have default drop rules.
 		dropACL := defaultDropACL(policies.Egress)
 		npmNetPol.ACLs = append(npmNetPol.ACLs, dropACL)
@@ -636,6 +652,7 @@ func egressPolicy(npmNetPol *policies.NPMNetworkPolicy, netPolName string, egres
 			return err
 		}
 	}
+	fqdnRule(npmNetPol, netPolName)
 
 	// #3. Except for allow all traffic case in #1, the rest of them should have default drop rules.
 	// Add drop ACL to drop the rest of traffic which is not specified in Egress Spec.
@@ -644,6 +661,69 @@ func egressPolicy(npmNetPol *policies.NPMNetworkPolicy, netPolName string, egres
 	return nil
 }
 
+// fqdnRule allows egress to the IPs resolved for the FQDN patterns of the policy.
+// The set starts empty, and the fqdn package adds IPs from DNS responses to it.
+func fqdnRule(npmNetPol *policies.NPMNetworkPolicy, netPolName string) {
+	if len(npmNetPol.FQDNPatterns) == 0 {
+		return
+	}
+	fqdnIPSet := ipsets.NewTranslatedIPSet(fmt.Sprintf(fqdnSetNameFormat, netPolName, npmNetPol.Namespace), ipsets.FQDN)
+	npmNetPol.RuleIPSets = append(npmNetPol.RuleIPSets, fqdnIPSet)
+	fqdnACL := policies.NewACLPolicy(policies.Allowed, policies.Egress)
+	fqdnACL.AddSetInfo([]policies.SetInfo{policies.NewSetInfo(fqdnIPSet.Metadata.Name, ipsets.FQDN, included, policies.DstMatch)})
+	npmNetPol.ACLs = append(npmNetPol.ACLs, fqdnACL)
+}
+
+// FQDNPatterns returns the normalized domain names of the FQDN egress annotation: lowercase and without a trailing dot.
+// A name prefixed with "*." matches every subdomain of the rest of the name, but not the rest itself.
+func FQDNPatterns(npObj *networkingv1.NetworkPolicy) ([]string, error) {
+	value, ok := npObj.Annotations[util.NPMFQDNEgressAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	patterns := make([]string, 0)
+	seen := make(map[string]struct{})
+	for _, pattern := range strings.Split(value, ",") {
+		pattern = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(pattern)), ".")
+		if pattern == "" {
+			continue
+		}
+		if !isDomainName(strings.TrimPrefix(pattern, fqdnWildcardPrefix)) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidFQDNPattern, pattern)
+		}
+		if _, ok := seen[pattern]; ok {
+			continue
+		}
+		seen[pattern] = struct{}{}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// isDomainName returns true if name is a lowercase domain name of letters, digits and hyphens.
+func isDomainName(name string) bool {
+	if name == "" || len(name) > maxDomainNameLength {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > maxLabelLength || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// IsAuditOnly returns true if the NetworkPolicy has the annotation to log instead of dropping flows.
+func IsAuditOnly(npObj *networkingv1.NetworkPolicy) bool {
+	return npObj.Annotations[util.NPMAuditOnlyAnnotation] == "true"
+}
+
 // TranslatePolicy translates networkpolicy object to NPMNetworkPolicy object
 // and returns the NPMNetworkPolicy object.
 func TranslatePolicy(npObj *networkingv1.NetworkPolicy, npmLiteToggle bool) (*policies.NPMNetworkPolicy, error) {
@@ -659,6 +739,11 @@ func TranslatePolicy(npObj *networkingv1.NetworkPolicy, npmLiteToggle bool) (*po
 	npmNetPol.PodSelectorIPSets = psResult.psSets
 	npmNetPol.ChildPodSelectorIPSets = psResult.childPSSets
 	npmNetPol.PodSelectorList = psResult.psList
+	npmNetPol.AuditOnly = IsAuditOnly(npObj)
+	npmNetPol.FQDNPatterns, err = FQDNPatterns(npObj)
+	if err != nil {
+		return nil, err
+	}
 
 	// Each NetworkPolicy includes a policyTypes list which may include either Ingress, Egress, or both.
 	// If no policyTypes are specified on a NetworkPolicy then by default Ingress will always be set
@@ -466,6 +466,24 @@ func TestIPBlockIPSet(t *testing.T) {
 			translatedIPSet: ipsets.NewTranslatedIPSet("test-in-ns-default-0-0IN", ipsets.CIDRBlocks, []string{"0.0.0.0/1 nomatch", "128.0.0.0/1 nomatch"}...),
 			skipWindows:     true,
 		},
+		{
+			name:        "cidr : ::/0",
+			ipBlockInfo: createIPBlockInfo("test", defaultNS, policies.Ingress, policies.SrcMatch, 0, 0),
+			ipBlockRule: &networkingv1.IPBlock{
+				CIDR: "::/0",
+			},
+			translatedIPSet: ipsets.NewTranslatedIPSet("test-in-ns-default-0-0IN", ipsets.CIDRBlocks, []string{"::/1", "8000::/1"}...),
+		},
+		{
+			name:        "cidr: ::/0 and except: 8000::/1",
+			ipBlockInfo: createIPBlockInfo("test", defaultNS, policies.Ingress, policies.SrcMatch, 0, 0),
+			ipBlockRule: &networkingv1.IPBlock{
+				CIDR:   "::/0",
+				Except: []string{"8000::/1"},
+			},
+			translatedIPSet: ipsets.NewTranslatedIPSet("test-in-ns-default-0-0IN", ipsets.CIDRBlocks, []string{"::/1", "8000::/1 nomatch"}...),
+			skipWindows:     true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -541,11 +559,23 @@ func TestIPBlockRule(t *testing.T) {
 			setInfo:         policies.NewSetInfo("test-network-policy-in-ns-default-0-0IN", ipsets.CIDRBlocks, included, policies.SrcMatch),
 			skipWindows:     true,
 		},
+		{
+			name:        "ipv6 cidr and one element in except",
+			ipBlockInfo: createIPBlockInfo("test", defaultNS, policies.Ingress, policies.SrcMatch, 0, 0),
+			ipBlockRule: &networkingv1.IPBlock{
+				CIDR:   "2002::1234:abcd:ffff:c0a8:101/64",
+				Except: []string{"2002::1234:abcd:ffff:0:0/96"},
+			},
+			translatedIPSet: ipsets.NewTranslatedIPSet("test-in-ns-default-0-0IN", ipsets.CIDRBlocks,
+				[]string{"2002::1234:abcd:ffff:c0a8:101/64", "2002::1234:abcd:ffff:0:0/96 nomatch"}...),
+			setInfo:     policies.NewSetInfo("test-in-ns-default-0-0IN", ipsets.CIDRBlocks, included, policies.SrcMatch),
+			skipWindows: true,
+		},
 		{
 			name:        "invalid ipv6",
 			ipBlockInfo: createIPBlockInfo("test", defaultNS, policies.Ingress, policies.SrcMatch, 0, 0),
 			ipBlockRule: &networkingv1.IPBlock{
-				CIDR: "2002::1234:abcd:ffff:c0a8:101/64",
+				CIDR: "2002::/129",
 			},
 			translatedIPSet: nil,
 			setInfo:         policies.SetInfo{},
@@ -3182,3 +3212,51 @@ func TestCheckForNamedPortType(t *testing.T) {
 		})
 	}
 }
+
+func TestFQDNEgress(t *testing.T) {
+	udp := v1.ProtocolUDP
+	port53 := intstr.FromInt(53)
+	netPolObj := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "saas",
+			Namespace:   defaultNS,
+			Annotations: map[string]string{util.NPMFQDNEgressAnnotation: " API.contoso.com., *.blob.core.windows.net,api.contoso.com,"},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+			Egress: []networkingv1.NetworkPolicyEgressRule{
+				{Ports: []networkingv1.NetworkPolicyPort{{Protocol: &udp, Port: &port53}}},
+			},
+		},
+	}
+
+	npmNetPol, err := TranslatePolicy(netPolObj, false)
+	require.NoError(t, err)
+	require.Equal(t, []string{"api.contoso.com", "*.blob.core.windows.net"}, npmNetPol.FQDNPatterns)
+	require.Equal(t, []*ipsets.TranslatedIPSet{ipsets.NewTranslatedIPSet("saas-in-ns-default-fqdn", ipsets.FQDN)}, npmNetPol.RuleIPSets)
+	require.Equal(t, ipsets.NewIPSetMetadata("saas-in-ns-default-fqdn", ipsets.FQDN), npmNetPol.FQDNSet())
+
+	fqdnACL := policies.NewACLPolicy(policies.Allowed, policies.Egress)
+	fqdnACL.AddSetInfo([]policies.SetInfo{policies.NewSetInfo("saas-in-ns-default-fqdn", ipsets.FQDN, included, policies.DstMatch)})
+	require.Len(t, npmNetPol.ACLs, 3)
+	require.Equal(t, fqdnACL, npmNetPol.ACLs[1])
+	require.Equal(t, defaultDropACL(policies.Egress), npmNetPol.ACLs[2])
+
+	// the names are allowed by deny all egress policies too
+	netPolObj.Spec.Egress = nil
+	npmNetPol, err = TranslatePolicy(netPolObj, false)
+	require.NoError(t, err)
+	require.Equal(t, []*policies.ACLPolicy{fqdnACL, defaultDropACL(policies.Egress)}, npmNetPol.ACLs)
+
+	// ingress policies don't restrict egress
+	netPolObj.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}
+	npmNetPol, err = TranslatePolicy(netPolObj, false)
+	require.NoError(t, err)
+	require.Nil(t, npmNetPol.FQDNSet())
+
+	for _, invalid := range []string{"*", "*.*.contoso.com", "api_contoso.com", "-api.contoso.com", "api..contoso.com", strings.Repeat("a", 64) + ".com"} {
+		netPolObj.Annotations[util.NPMFQDNEgressAnnotation] = invalid
+		_, err = TranslatePolicy(netPolObj, false)
+		require.ErrorIs(t, err, ErrInvalidFQDNPattern, invalid)
+	}
+}
@@ -0,0 +1,364 @@
+package bpf
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
+	"github.com/Azure/azure-container-networking/npm/util"
+)
+
+var (
+	errTooManyPeers = errors.New("ACL matches too many sets")
+	errTooManyRules = errors.New("pod has too many rules")
+)
+
+// MapContents holds the entries of every map.
+// The compiler puts every rule into slot 0, and syncMaps moves the rules of each endpoint into its slot.
+type MapContents struct {
+	SetMembers       map[SetMemberKey]uint8
+	CIDRMembers      map[CIDRKey]uint8
+	NamedPortMembers map[NamedPortKey]uint8
+	Endpoints        map[EndpointKey]EndpointInfo
+	Rules            map[RuleKey]Rule
+}
+
+func newMapContents() *MapContents {
+	return &MapContents{
+		SetMembers:       make(map[SetMemberKey]uint8),
+		CIDRMembers:      make(map[CIDRKey]uint8),
+		NamedPortMembers: make(map[NamedPortKey]uint8),
+		Endpoints:        make(map[EndpointKey]EndpointInfo),
+		Rules:            make(map[RuleKey]Rule),
+	}
+}
+
+// idAllocator hands out stable IDs so that unrelated changes don't rewrite map entries.
+type idAllocator struct {
+	ids  map[string]uint32
+	next uint32
+	free []uint32
+}
+
+func newIDAllocator() *idAllocator {
+	// ID 0 is never allocated so that zeroed map entries don't match a set
+	return &idAllocator{ids: make(map[string]uint32), next: 1}
+}
+
+func (a *idAllocator) get(name string) uint32 {
+	if id, ok := a.ids[name]; ok {
+		return id
+	}
+	var id uint32
+	if n := len(a.free); n > 0 {
+		id = a.free[n-1]
+		a.free = a.free[:n-1]
+	} else {
+		id = a.next
+		a.next++
+	}
+	a.ids[name] = id
+	return id
+}
+
+// releaseUnused frees the IDs of names which aren't in use.
+func (a *idAllocator) releaseUnused(inUse func(name string) bool) {
+	for name, id := range a.ids {
+		if !inUse(name) {
+			delete(a.ids, name)
+			a.free = append(a.free, id)
+		}
+	}
+}
+
+// compiler translates the cached IPSets and policies into map contents.
+type compiler struct {
+	setIDs    *idAllocator
+	policyIDs *idAllocator
+}
+
+func newCompiler() *compiler {
+	return &compiler{setIDs: newIDAllocator(), policyIDs: newIDAllocator()}
+}
+
+// compile returns the map contents for the sets, the policies, and the IPs of local pods.
+func (c *compiler) compile(sets map[string]*ipsets.IPSet, netPols map[string]*policies.NPMNetworkPolicy, localIPs []string) (*MapContents, error) {
+	c.setIDs.releaseUnused(func(name string) bool {
+		_, ok := sets[name]
+		return ok
+	})
+	c.policyIDs.releaseUnused(func(key string) bool {
+		_, ok := netPols[key]
+		return ok
+	})
+
+	contents := newMapContents()
+	for _, set := range sets {
+		c.addMembers(contents, set)
+	}
+
+	ordered := orderPolicies(netPols)
+	for _, localIP := range localIPs {
+		ip, ok := toIP4(net.ParseIP(localIP))
+		if !ok {
+			continue
+		}
+		if err := c.addEndpoint(contents, ip, ordered); err != nil {
+			return nil, fmt.Errorf("failed to compile rules for pod %s: %w", localIP, err)
+		}
+	}
+	return contents, nil
+}
+
+func (c *compiler) addMembers(contents *MapContents, set *ipsets.IPSet) {
+	setID := c.setIDs.get(set.Name)
+	if set.Kind == ipsets.ListSet {
+		// lists are flattened so that the program needs a single lookup
+		for _, member := range set.MemberIPSets {
+			for entry := range member.IPPodKey {
+				if ip, ok := toIP4(net.ParseIP(entry)); ok {
+					contents.SetMembers[SetMemberKey{SetID: setID, IP: ip}] = 1
+				}
+			}
+		}
+		return
+	}
+
+	for entry := range set.IPPodKey {
+		switch set.Type {
+		case ipsets.CIDRBlocks:
+			if key, match, ok := parseCIDRMember(setID, entry); ok {
+				contents.CIDRMembers[key] = match
+			}
+		case ipsets.NamedPorts:
+			if key, ok := parseNamedPortMember(setID, entry); ok {
+				contents.NamedPortMembers[key] = 1
+			}
+		default:
+			if ip, ok := toIP4(net.ParseIP(entry)); ok {
+				contents.SetMembers[SetMemberKey{SetID: setID, IP: ip}] = 1
+			}
+		}
+	}
+}
+
+// parseCIDRMember parses "cidr" or "cidr nomatch". The value is 0 for nomatch entries.
+func parseCIDRMember(setID uint32, entry string) (CIDRKey, uint8, bool) {
+	cidr, option, _ := strings.Cut(entry, " ")
+	if !strings.Contains(cidr, "/") {
+		cidr += "/32"
+	}
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return CIDRKey{}, 0, false
+	}
+	ip, ok := toIP4(ipNet.IP)
+	if !ok {
+		return CIDRKey{}, 0, false
+	}
+	prefixLen, _ := ipNet.Mask.Size()
+	match := uint8(1)
+	if option == util.IpsetNomatch {
+		match = 0
+	}
+	return newCIDRKey(setID, ip, prefixLen), match, true
+}
+
+// parseNamedPortMember parses "ip,protocol:port" or "ip,port", where the protocol defaults to TCP like in ipset.
+func parseNamedPortMember(setID uint32, entry string) (NamedPortKey, bool) {
+	ipString, portString, ok := strings.Cut(entry, ",")
+	if !ok {
+		return NamedPortKey{}, false
+	}
+	ip, ok := toIP4(net.ParseIP(ipString))
+	if !ok {
+		return NamedPortKey{}, false
+	}
+	protocol := protocolTCP
+	if protocolString, port, hasProtocol := strings.Cut(portString, ":"); hasProtocol {
+		protocol, ok = toProtocol(policies.Protocol(strings.ToUpper(protocolString)))
+		if !ok {
+			return NamedPortKey{}, false
+		}
+		portString = port
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return NamedPortKey{}, false
+	}
+	return NamedPortKey{SetID: setID, IP: ip, Port: uint16(port), Protocol: protocol}, true
+}
+
+func toProtocol(protocol policies.Protocol) (uint8, bool) {
+	switch protocol {
+	case policies.TCP:
+		return protocolTCP, true
+	case policies.UDP:
+		return protocolUDP, true
+	case policies.SCTP:
+		return protocolSCTP, true
+	case policies.UnspecifiedProtocol, "":
+		return protocolAny, true
+	default:
+		return 0, false
+	}
+}
+
+// orderPolicies sorts policies in the order the program evaluates them.
+// AdminTier policies are sorted by priority, and policies within a tier by key.
+// Audit only policies are left out since they must not drop traffic.
+func orderPolicies(netPols map[string]*policies.NPMNetworkPolicy) []*policies.NPMNetworkPolicy {
+	ordered := make([]*policies.NPMNetworkPolicy, 0, len(netPols))
+	for _, netPol := range netPols {
+		if netPol.AuditOnly && netPol.Tier == policies.NetworkPolicyTier {
+			continue
+		}
+		ordered = append(ordered, netPol)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		ti, tj := toTier(ordered[i].Tier), toTier(ordered[j].Tier)
+		if ti != tj {
+			return ti < tj
+		}
+		if ordered[i].Priority != ordered[j].Priority {
+			return ordered[i].Priority < ordered[j].Priority
+		}
+		return ordered[i].PolicyKey < ordered[j].PolicyKey
+	})
+	return ordered
+}
+
+func toTier(tier policies.PolicyTier) uint8 {
+	switch tier {
+	case policies.AdminTier:
+		return tierAdmin
+	case policies.BaselineTier:
+		return tierBaseline
+	default:
+		return tierNetworkPolicy
+	}
+}
+
+func toTarget(target policies.Verdict) uint8 {
+	switch target {
+	case policies.Dropped:
+		return targetDeny
+	case policies.Passed:
+		return targetPass
+	default:
+		return targetAllow
+	}
+}
+
+// addEndpoint adds the rules of every policy which selects the pod.
+func (c *compiler) addEndpoint(contents *MapContents, ip ip4, ordered []*policies.NPMNetworkPolicy) error {
+	var info EndpointInfo
+	for _, netPol := range ordered {
+		if !c.selects(contents, netPol, ip) {
+			continue
+		}
+		for _, direction := range []uint8{directionIngress, directionEgress} {
+			hasDirection := false
+			for _, acl := range netPol.ACLs {
+				if !aclHasDirection(acl, direction) {
+					continue
+				}
+				hasDirection = true
+				rule, err := c.toRule(netPol, acl)
+				if err != nil {
+					return fmt.Errorf("policy %s: %w", netPol.PolicyKey, err)
+				}
+				index := info.RuleCount[direction]
+				if index >= MaxRulesPerDirection {
+					return errTooManyRules
+				}
+				contents.Rules[RuleKey{IP: ip, Index: index, Direction: direction}] = rule
+				info.RuleCount[direction]++
+			}
+			if hasDirection && netPol.Tier == policies.NetworkPolicyTier {
+				info.Isolated[direction] = 1
+			}
+		}
+	}
+
+	if info.RuleCount[directionIngress] > 0 || info.RuleCount[directionEgress] > 0 {
+		contents.Endpoints[EndpointKey{IP: ip}] = info
+	}
+	return nil
+}
+
+func aclHasDirection(acl *policies.ACLPolicy, direction uint8) bool {
+	if acl.Direction == policies.Both {
+		return true
+	}
+	if direction == directionIngress {
+		return acl.Direction == policies.Ingress
+	}
+	return acl.Direction == policies.Egress
+}
+
+// selects returns true if the pod is a member of every set of the policy's pod selector.
+func (c *compiler) selects(contents *MapContents, netPol *policies.NPMNetworkPolicy, ip ip4) bool {
+	for i := range netPol.PodSelectorList {
+		setInfo := &netPol.PodSelectorList[i]
+		peer := c.toPeer(setInfo)
+		if contents.isMember(&peer, ip, ip, 0, protocolAny) != setInfo.Included {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *compiler) toRule(netPol *policies.NPMNetworkPolicy, acl *policies.ACLPolicy) (Rule, error) {
+	protocol, ok := toProtocol(acl.Protocol)
+	if !ok {
+		return Rule{}, fmt.Errorf("unknown protocol %s", acl.Protocol)
+	}
+	rule := Rule{
+		PolicyID:  c.policyIDs.get(netPol.PolicyKey),
+		PortStart: uint16(acl.DstPorts.Port),
+		PortEnd:   uint16(acl.DstPorts.EndPort),
+		Tier:      toTier(netPol.Tier),
+		Target:    toTarget(acl.Target),
+		Protocol:  protocol,
+	}
+	if rule.PortEnd < rule.PortStart {
+		rule.PortEnd = rule.PortStart
+	}
+
+	setInfos := append(append([]policies.SetInfo{}, acl.SrcList...), acl.DstList...)
+	if len(setInfos) > MaxPeers {
+		return Rule{}, errTooManyPeers
+	}
+	for i := range setInfos {
+		rule.Peers[i] = c.toPeer(&setInfos[i])
+	}
+	rule.PeerCount = uint8(len(setInfos))
+	return rule, nil
+}
+
+func (c *compiler) toPeer(setInfo *policies.SetInfo) Peer {
+	peer := Peer{
+		SetID: c.setIDs.get(setInfo.IPSet.GetPrefixName()),
+		Kind:  peerKindHash,
+		Match: peerMatchDst,
+	}
+	if setInfo.Included {
+		peer.Included = 1
+	}
+	if setInfo.MatchType == policies.SrcMatch {
+		peer.Match = peerMatchSrc
+	}
+	switch {
+	case setInfo.MatchType == policies.DstDstMatch:
+		peer.Kind = peerKindNamedPort
+	case setInfo.IPSet.Type == ipsets.CIDRBlocks:
+		peer.Kind = peerKindCIDR
+	}
+	return peer
+}
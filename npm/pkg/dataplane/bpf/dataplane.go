@@ -0,0 +1,357 @@
+package bpf
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
+	"github.com/Azure/azure-container-networking/npm/util"
+	"k8s.io/klog"
+)
+
+var errNotHashSet = errors.New("not a hash set")
+
+// Attacher attaches the program to the host interfaces of local pods.
+type Attacher interface {
+	// Sync attaches the program to the interfaces of the pods and detaches it from every other interface.
+	Sync(podIPs []string) error
+}
+
+// Dataplane implements dataplane.GenericDataplane with BPF maps.
+// The rules only match IPv4, so the IPv6 traffic of a pod is dropped in the directions which NetworkPolicies isolate it in.
+type Dataplane struct {
+	sync.Mutex
+	nodeName string
+	// sets are keyed by prefixed name
+	sets     map[string]*ipsets.IPSet
+	policies map[string]*policies.NPMNetworkPolicy
+	// localPods maps the IPs of pods on this node to their pod keys
+	localPods map[string]string
+
+	compiler *compiler
+	maps     *Maps
+	applied  *MapContents
+	attacher Attacher
+	// generation is the policy generation in the generation map. Flows allowed in older generations are evaluated again.
+	generation uint32
+}
+
+var _ dataplane.GenericDataplane = &Dataplane{}
+
+// NewDataplane creates a Dataplane which writes to the maps and attaches the program with the attacher.
+// The maps must be empty.
+func NewDataplane(nodeName string, maps *Maps, attacher Attacher) *Dataplane {
+	return &Dataplane{
+		nodeName:  nodeName,
+		sets:      make(map[string]*ipsets.IPSet),
+		policies:  make(map[string]*policies.NPMNetworkPolicy),
+		localPods: make(map[string]string),
+		compiler:  newCompiler(),
+		maps:      maps,
+		applied:   newMapContents(),
+		attacher:  attacher,
+	}
+}
+
+// BootupDataplane is a no-op since the maps are created empty.
+func (dp *Dataplane) BootupDataplane() error {
+	return nil
+}
+
+// FinishBootupPhase is a no-op since there is no bootup phase.
+func (dp *Dataplane) FinishBootupPhase() {}
+
+// RunPeriodicTasks is a no-op since there is nothing to reconcile.
+func (dp *Dataplane) RunPeriodicTasks() {}
+
+func (dp *Dataplane) GetAllIPSets() map[string]string {
+	dp.Lock()
+	defer dp.Unlock()
+	setMap := make(map[string]string, len(dp.sets))
+	for _, set := range dp.sets {
+		setMap[set.HashedName] = set.Name
+	}
+	return setMap
+}
+
+func (dp *Dataplane) GetIPSet(setName string) *ipsets.IPSet {
+	dp.Lock()
+	defer dp.Unlock()
+	return dp.sets[setName]
+}
+
+func (dp *Dataplane) CreateIPSets(setMetadatas []*ipsets.IPSetMetadata) {
+	dp.Lock()
+	defer dp.Unlock()
+	for _, setMetadata := range setMetadatas {
+		dp.createSet(setMetadata)
+	}
+}
+
+func (dp *Dataplane) createSet(setMetadata *ipsets.IPSetMetadata) *ipsets.IPSet {
+	prefixedName := setMetadata.GetPrefixName()
+	if set, ok := dp.sets[prefixedName]; ok {
+		return set
+	}
+	set := ipsets.NewIPSet(setMetadata)
+	dp.sets[prefixedName] = set
+	return set
+}
+
+func (dp *Dataplane) DeleteIPSet(setMetadata *ipsets.IPSetMetadata, deleteOption util.DeleteOption) {
+	dp.Lock()
+	defer dp.Unlock()
+	dp.deleteSet(setMetadata.GetPrefixName(), deleteOption == util.ForceDelete)
+}
+
+// deleteSet deletes the set unless a policy or list refers to it. Unless forced, the set must also be empty.
+func (dp *Dataplane) deleteSet(prefixedName string, force bool) {
+	set, ok := dp.sets[prefixedName]
+	if !ok || len(set.SelectorReference) > 0 || len(set.NetPolReference) > 0 {
+		return
+	}
+	if !force && (len(set.IPPodKey) > 0 || len(set.MemberIPSets) > 0) {
+		return
+	}
+	for _, list := range dp.sets {
+		if _, ok := list.MemberIPSets[prefixedName]; ok {
+			return
+		}
+	}
+	delete(dp.sets, prefixedName)
+}
+
+func (dp *Dataplane) AddToSets(setMetadatas []*ipsets.IPSetMetadata, podMetadata *dataplane.PodMetadata) error {
+	dp.Lock()
+	defer dp.Unlock()
+	for _, setMetadata := range setMetadatas {
+		if err := dp.addToSet(setMetadata, podMetadata.PodIP, podMetadata.PodKey); err != nil {
+			return err
+		}
+	}
+	if podMetadata.NodeName == dp.nodeName && net.ParseIP(podMetadata.PodIP) != nil {
+		dp.localPods[podMetadata.PodIP] = podMetadata.PodKey
+	}
+	return nil
+}
+
+func (dp *Dataplane) addToSet(setMetadata *ipsets.IPSetMetadata, member, podKey string) error {
+	if setMetadata.GetSetKind() != ipsets.HashSet {
+		return fmt.Errorf("failed to add %s to set %s: %w", member, setMetadata.GetPrefixName(), errNotHashSet)
+	}
+	set := dp.createSet(setMetadata)
+	set.IPPodKey[member] = podKey
+	return nil
+}
+
+func (dp *Dataplane) RemoveFromSets(setMetadatas []*ipsets.IPSetMetadata, podMetadata *dataplane.PodMetadata) error {
+	dp.Lock()
+	defer dp.Unlock()
+	for _, setMetadata := range setMetadatas {
+		set, ok := dp.sets[setMetadata.GetPrefixName()]
+		if !ok {
+			continue
+		}
+		if set.Kind != ipsets.HashSet {
+			return fmt.Errorf("failed to remove %s from set %s: %w", podMetadata.PodIP, set.Name, errNotHashSet)
+		}
+		// in case the IP belongs to a new pod, the call is stale
+		if cachedPodKey, ok := set.IPPodKey[podMetadata.PodIP]; ok && cachedPodKey == podMetadata.PodKey {
+			delete(set.IPPodKey, podMetadata.PodIP)
+			// every pod is in its namespace's set until it is deleted or its IP changes
+			if set.Type == ipsets.Namespace && dp.localPods[podMetadata.PodIP] == podMetadata.PodKey {
+				delete(dp.localPods, podMetadata.PodIP)
+			}
+		}
+	}
+	return nil
+}
+
+func (dp *Dataplane) AddToLists(listMetadatas, setMetadatas []*ipsets.IPSetMetadata) error {
+	dp.Lock()
+	defer dp.Unlock()
+	for _, listMetadata := range listMetadatas {
+		if listMetadata.GetSetKind() != ipsets.ListSet {
+			return fmt.Errorf("failed to add to list %s: %w", listMetadata.GetPrefixName(), ipsets.ErrIPSetInvalidKind)
+		}
+		list := dp.createSet(listMetadata)
+		for _, setMetadata := range setMetadatas {
+			if setMetadata.GetSetKind() != ipsets.HashSet {
+				return fmt.Errorf("failed to add %s to list %s: %w", setMetadata.GetPrefixName(), list.Name, errNotHashSet)
+			}
+			member := dp.createSet(setMetadata)
+			list.MemberIPSets[member.Name] = member
+		}
+	}
+	return nil
+}
+
+func (dp *Dataplane) RemoveFromList(listMetadata *ipsets.IPSetMetadata, setMetadatas []*ipsets.IPSetMetadata) error {
+	dp.Lock()
+	defer dp.Unlock()
+	list, ok := dp.sets[listMetadata.GetPrefixName()]
+	if !ok {
+		return nil
+	}
+	for _, setMetadata := range setMetadatas {
+		delete(list.MemberIPSets, setMetadata.GetPrefixName())
+	}
+	return nil
+}
+
+// ApplyDataPlane compiles the sets and policies, writes the map entries which changed,
+// increments the policy generation, and attaches the program to the pods with rules.
+func (dp *Dataplane) ApplyDataPlane() error {
+	dp.Lock()
+	defer dp.Unlock()
+	return dp.apply()
+}
+
+func (dp *Dataplane) apply() error {
+	localIPs := make([]string, 0, len(dp.localPods))
+	for ip := range dp.localPods {
+		localIPs = append(localIPs, ip)
+	}
+	sort.Strings(localIPs)
+
+	desired, err := dp.compiler.compile(dp.sets, dp.policies, localIPs)
+	if err != nil {
+		return fmt.Errorf("[BPFDataPlane] failed to compile policies: %w", err)
+	}
+	syncErr := syncMaps(dp.maps, dp.applied, desired)
+	// a failed sync may have written some entries, so the generation is incremented either way
+	dp.generation++
+	if err := dp.maps.Generation.Put(generationKey, dp.generation); err != nil {
+		return fmt.Errorf("[BPFDataPlane] failed to update policy generation: %w", err)
+	}
+	if syncErr != nil {
+		return fmt.Errorf("[BPFDataPlane] failed to sync maps: %w", syncErr)
+	}
+
+	endpointIPs := make([]string, 0, len(desired.Endpoints))
+	for key := range desired.Endpoints {
+		endpointIPs = append(endpointIPs, key.IP.String())
+	}
+	sort.Strings(endpointIPs)
+	if err := dp.attacher.Sync(endpointIPs); err != nil {
+		return fmt.Errorf("[BPFDataPlane] failed to attach programs: %w", err)
+	}
+	return nil
+}
+
+// GetAllPolicies returns the keys of all policies.
+func (dp *Dataplane) GetAllPolicies() []string {
+	dp.Lock()
+	defer dp.Unlock()
+	keys := make([]string, 0, len(dp.policies))
+	for key := range dp.policies {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (dp *Dataplane) AddPolicy(netPol *policies.NPMNetworkPolicy) error {
+	policies.NormalizePolicy(netPol)
+	if err := policies.ValidatePolicy(netPol); err != nil {
+		return fmt.Errorf("[BPFDataPlane] invalid policy %s: %w", netPol.PolicyKey, err)
+	}
+
+	dp.Lock()
+	defer dp.Unlock()
+	if err := dp.addSetReferences(netPol.AllPodSelectorIPSets(), netPol.PolicyKey, ipsets.SelectorType); err != nil {
+		return err
+	}
+	if err := dp.addSetReferences(netPol.RuleIPSets, netPol.PolicyKey, ipsets.NetPolType); err != nil {
+		return err
+	}
+	dp.policies[netPol.PolicyKey] = netPol
+	return dp.apply()
+}
+
+func (dp *Dataplane) addSetReferences(sets []*ipsets.TranslatedIPSet, policyKey string, referenceType ipsets.ReferenceType) error {
+	for _, translatedSet := range sets {
+		set := dp.createSet(translatedSet.Metadata)
+		if referenceType == ipsets.SelectorType {
+			set.SelectorReference[policyKey] = struct{}{}
+		} else {
+			set.NetPolReference[policyKey] = struct{}{}
+		}
+
+		switch {
+		case set.Type == ipsets.CIDRBlocks:
+			for _, member := range translatedSet.Members {
+				if err := dp.addToSet(translatedSet.Metadata, member, ""); err != nil {
+					return err
+				}
+			}
+		case set.Kind == ipsets.ListSet:
+			for _, memberMetadata := range ipsets.GetMembersOfTranslatedSets(translatedSet.Members) {
+				member := dp.createSet(memberMetadata)
+				set.MemberIPSets[member.Name] = member
+			}
+		}
+	}
+	return nil
+}
+
+func (dp *Dataplane) RemovePolicy(policyKey string) error {
+	dp.Lock()
+	defer dp.Unlock()
+	netPol, ok := dp.policies[policyKey]
+	if !ok {
+		klog.Infof("[BPFDataPlane] Policy %s is not found. Might been deleted already", policyKey)
+		return nil
+	}
+	delete(dp.policies, policyKey)
+	dp.removeSetReferences(netPol.RuleIPSets, policyKey, ipsets.NetPolType)
+	dp.removeSetReferences(netPol.AllPodSelectorIPSets(), policyKey, ipsets.SelectorType)
+	return dp.apply()
+}
+
+func (dp *Dataplane) removeSetReferences(sets []*ipsets.TranslatedIPSet, policyKey string, referenceType ipsets.ReferenceType) {
+	for _, translatedSet := range sets {
+		set, ok := dp.sets[translatedSet.Metadata.GetPrefixName()]
+		if !ok {
+			continue
+		}
+		if referenceType == ipsets.SelectorType {
+			delete(set.SelectorReference, policyKey)
+		} else {
+			delete(set.NetPolReference, policyKey)
+		}
+		if len(set.SelectorReference) > 0 || len(set.NetPolReference) > 0 {
+			continue
+		}
+
+		// members from the translation are owned by the policy
+		switch {
+		case set.Type == ipsets.CIDRBlocks:
+			for _, member := range translatedSet.Members {
+				delete(set.IPPodKey, member)
+			}
+		case set.Kind == ipsets.ListSet:
+			for _, memberMetadata := range ipsets.GetMembersOfTranslatedSets(translatedSet.Members) {
+				delete(set.MemberIPSets, memberMetadata.GetPrefixName())
+			}
+		}
+		dp.deleteSet(set.Name, false)
+	}
+}
+
+func (dp *Dataplane) UpdatePolicy(netPol *policies.NPMNetworkPolicy) error {
+	dp.Lock()
+	_, exists := dp.policies[netPol.PolicyKey]
+	dp.Unlock()
+	if exists {
+		if err := dp.RemovePolicy(netPol.PolicyKey); err != nil {
+			return fmt.Errorf("[BPFDataPlane] error while updating policy: %w", err)
+		}
+	}
+	return dp.AddPolicy(netPol)
+}
@@ -0,0 +1,444 @@
+package bpf
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/npm/pkg/controlplane/translation"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const nodeName = "node1"
+
+type fakeMap struct {
+	entries map[interface{}]interface{}
+	puts    int
+	// onChange is called after every write
+	onChange func()
+}
+
+func newFakeMap() *fakeMap {
+	return &fakeMap{entries: make(map[interface{}]interface{})}
+}
+
+func (m *fakeMap) Put(key, value interface{}) error {
+	m.entries[key] = value
+	m.puts++
+	if m.onChange != nil {
+		m.onChange()
+	}
+	return nil
+}
+
+func (m *fakeMap) Delete(key interface{}) error {
+	delete(m.entries, key)
+	if m.onChange != nil {
+		m.onChange()
+	}
+	return nil
+}
+
+type fakeAttacher struct {
+	podIPs []string
+}
+
+func (a *fakeAttacher) Sync(podIPs []string) error {
+	a.podIPs = podIPs
+	return nil
+}
+
+type fakeMaps struct {
+	setMembers, cidrMembers, namedPortMembers, endpoints, rules, generation *fakeMap
+}
+
+func newTestDataplane() (*Dataplane, *fakeMaps, *fakeAttacher) {
+	fm := &fakeMaps{
+		setMembers:       newFakeMap(),
+		cidrMembers:      newFakeMap(),
+		namedPortMembers: newFakeMap(),
+		endpoints:        newFakeMap(),
+		rules:            newFakeMap(),
+		generation:       newFakeMap(),
+	}
+	maps := &Maps{
+		SetMembers:       fm.setMembers,
+		CIDRMembers:      fm.cidrMembers,
+		NamedPortMembers: fm.namedPortMembers,
+		Endpoints:        fm.endpoints,
+		Rules:            fm.rules,
+		Generation:       fm.generation,
+	}
+	attacher := &fakeAttacher{}
+	return NewDataplane(nodeName, maps, attacher), fm, attacher
+}
+
+func (fm *fakeMaps) puts() int {
+	return fm.setMembers.puts + fm.cidrMembers.puts + fm.namedPortMembers.puts + fm.endpoints.puts + fm.rules.puts
+}
+
+func addPod(t *testing.T, dp *Dataplane, namespace, name, ip, node string, labels map[string]string) {
+	t.Helper()
+	setMetadatas := []*ipsets.IPSetMetadata{ipsets.NewIPSetMetadata(namespace, ipsets.Namespace)}
+	for key, value := range labels {
+		setMetadatas = append(setMetadatas,
+			ipsets.NewIPSetMetadata(key, ipsets.KeyLabelOfPod),
+			ipsets.NewIPSetMetadata(key+":"+value, ipsets.KeyValueLabelOfPod),
+		)
+	}
+	podMetadata := dataplane.NewPodMetadata(namespace+"/"+name, ip, node)
+	require.NoError(t, dp.AddToSets(setMetadatas, podMetadata))
+}
+
+func addNetPol(t *testing.T, dp *Dataplane, netPol *networkingv1.NetworkPolicy) {
+	t.Helper()
+	npmNetPol, err := translation.TranslatePolicy(netPol, false)
+	require.NoError(t, err)
+	require.NoError(t, dp.AddPolicy(npmNetPol))
+}
+
+func tcpPacket(src, dst string, port uint16) *Packet {
+	return &Packet{Src: net.ParseIP(src), Dst: net.ParseIP(dst), Protocol: protocolTCP, Port: port}
+}
+
+func udpPacket(src string, srcPort uint16, dst string, port uint16) *Packet {
+	return &Packet{Src: net.ParseIP(src), SrcPort: srcPort, Dst: net.ParseIP(dst), Port: port, Protocol: protocolUDP}
+}
+
+func tcpSegment(src string, srcPort uint16, dst string, port uint16, flags uint8) *Packet {
+	return &Packet{Src: net.ParseIP(src), SrcPort: srcPort, Dst: net.ParseIP(dst), Port: port, Protocol: protocolTCP, TCPFlags: flags}
+}
+
+func udpFragment(src, dst string, port, id uint16, later, more bool) *Packet {
+	p := &Packet{Src: net.ParseIP(src), Dst: net.ParseIP(dst), Protocol: protocolUDP, ID: id, LaterFragment: later, MoreFragments: more}
+	// only the first fragment has the ports
+	if !later {
+		p.SrcPort, p.Port = 40000, port
+	}
+	return p
+}
+
+func ipv6Packet(srcPod, dstPod string) *Packet {
+	return &Packet{
+		Src: net.ParseIP("fd00::1"), Dst: net.ParseIP("fd00::2"), Protocol: protocolTCP, Port: 80,
+		SrcPod: net.ParseIP(srcPod), DstPod: net.ParseIP(dstPod),
+	}
+}
+
+// send filters the packet at the host veth of the source pod and then at the one of the destination pod, which share the flows.
+func send(dp *Dataplane, ft *flowTable, p *Packet, now uint64) bool {
+	return dp.applied.filter(ft, p, directionEgress, now) && dp.applied.filter(ft, p, directionIngress, now)
+}
+
+func backendIngressPolicy() *networkingv1.NetworkPolicy {
+	tcp := corev1.ProtocolTCP
+	port := intstr.FromInt(8080)
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "backend-ingress", Namespace: "shop"},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "backend"}},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				From:  []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "frontend"}}}},
+				Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &port}},
+			}},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		},
+	}
+}
+
+func frontendEgressPolicy() *networkingv1.NetworkPolicy {
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "frontend-egress", Namespace: "shop"},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "frontend"}},
+			Egress: []networkingv1.NetworkPolicyEgressRule{
+				{To: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}}},
+				{To: []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "8.8.0.0/16", Except: []string{"8.8.8.0/24"}}}}},
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+		},
+	}
+}
+
+func setUpShop(t *testing.T) (*Dataplane, *fakeMaps, *fakeAttacher) {
+	dp, fm, attacher := newTestDataplane()
+	addPod(t, dp, "shop", "frontend", "10.0.0.1", nodeName, map[string]string{"app": "frontend"})
+	addPod(t, dp, "shop", "backend", "10.0.0.2", nodeName, map[string]string{"app": "backend"})
+	addPod(t, dp, "shop", "remote-frontend", "10.0.1.1", "node2", map[string]string{"app": "frontend"})
+	addPod(t, dp, "other", "client", "10.0.0.3", nodeName, map[string]string{"app": "frontend"})
+	require.NoError(t, dp.ApplyDataPlane())
+	addNetPol(t, dp, backendIngressPolicy())
+	addNetPol(t, dp, frontendEgressPolicy())
+	return dp, fm, attacher
+}
+
+func TestNetworkPolicyVerdicts(t *testing.T) {
+	dp, _, attacher := setUpShop(t)
+	require.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, attacher.podIPs)
+
+	tests := []struct {
+		name    string
+		packet  *Packet
+		allowed bool
+	}{
+		{"frontend to backend on allowed port", tcpPacket("10.0.0.1", "10.0.0.2", 8080), true},
+		{"frontend to backend on other port", tcpPacket("10.0.0.1", "10.0.0.2", 80), false},
+		{"remote frontend to backend", tcpPacket("10.0.1.1", "10.0.0.2", 8080), true},
+		{"frontend in other namespace to backend", tcpPacket("10.0.0.3", "10.0.0.2", 8080), false},
+		{"UDP to backend", &Packet{Src: net.ParseIP("10.0.0.1"), Dst: net.ParseIP("10.0.0.2"), Protocol: protocolUDP, Port: 8080}, false},
+		{"frontend to CIDR", tcpPacket("10.0.0.1", "8.8.4.4", 53), true},
+		{"frontend to CIDR exception", tcpPacket("10.0.0.1", "8.8.8.8", 53), false},
+		{"frontend to other namespace", tcpPacket("10.0.0.1", "10.0.0.3", 80), false},
+		{"unselected pod to anywhere", tcpPacket("10.0.0.3", "1.1.1.1", 443), true},
+		{"IPv6 to isolated backend", ipv6Packet("10.0.0.3", "10.0.0.2"), false},
+		{"IPv6 from isolated frontend", ipv6Packet("10.0.0.1", "10.0.0.3"), false},
+		{"IPv6 from backend to unselected pod", ipv6Packet("10.0.0.2", "10.0.0.3"), true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.allowed, dp.applied.Allowed(tt.packet))
+		})
+	}
+}
+
+func TestApplyWritesChangedEntries(t *testing.T) {
+	dp, fm, attacher := setUpShop(t)
+	require.Equal(t, len(dp.applied.Rules), len(fm.rules.entries))
+	require.Equal(t, len(dp.applied.Endpoints), len(fm.endpoints.entries))
+	require.Equal(t, len(dp.applied.CIDRMembers), len(fm.cidrMembers.entries))
+
+	puts := fm.puts()
+	require.NoError(t, dp.ApplyDataPlane())
+	require.Equal(t, puts, fm.puts(), "unchanged contents must not be written again")
+
+	// a new frontend only adds members
+	addPod(t, dp, "shop", "frontend2", "10.0.0.4", "node2", map[string]string{"app": "frontend"})
+	require.NoError(t, dp.ApplyDataPlane())
+	require.Equal(t, puts+3, fm.puts())
+	require.True(t, dp.applied.Allowed(tcpPacket("10.0.0.4", "10.0.0.2", 8080)))
+
+	require.NoError(t, dp.RemovePolicy("shop/backend-ingress"))
+	require.Equal(t, []string{"10.0.0.1"}, attacher.podIPs)
+	require.True(t, dp.applied.Allowed(tcpPacket("10.0.0.3", "10.0.0.2", 8080)))
+
+	require.NoError(t, dp.RemovePolicy("shop/frontend-egress"))
+	require.Empty(t, attacher.podIPs)
+	require.Empty(t, fm.rules.entries)
+	require.Empty(t, fm.endpoints.entries)
+	require.Empty(t, fm.cidrMembers.entries)
+	require.Empty(t, dp.GetAllPolicies())
+}
+
+func TestRulesSwitchSlots(t *testing.T) {
+	dp, fm, _ := setUpShop(t)
+	backend := EndpointKey{IP: ip4{10, 0, 0, 2}}
+
+	// readable returns the rules which the program reads for the backend, in slot 0
+	readable := func() map[RuleKey]interface{} {
+		info := fm.endpoints.entries[backend].(EndpointInfo)
+		rules := make(map[RuleKey]interface{})
+		for direction, count := range info.RuleCount {
+			for i := uint16(0); i < count; i++ {
+				key := RuleKey{IP: backend.IP, Index: i, Direction: uint8(direction), Slot: info.Slot}
+				rule := fm.rules.entries[key]
+				key.Slot = 0
+				rules[key] = rule
+			}
+		}
+		return rules
+	}
+	oldSlot := fm.endpoints.entries[backend].(EndpointInfo).Slot
+	oldRules := readable()
+	var seen []map[RuleKey]interface{}
+	onChange := func() {
+		seen = append(seen, readable())
+	}
+	fm.rules.onChange, fm.endpoints.onChange = onChange, onChange
+
+	udp := corev1.ProtocolUDP
+	port := intstr.FromInt(5353)
+	addNetPol(t, dp, &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "backend-mdns", Namespace: "shop"},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "backend"}},
+			Ingress:     []networkingv1.NetworkPolicyIngressRule{{Ports: []networkingv1.NetworkPolicyPort{{Protocol: &udp, Port: &port}}}},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		},
+	})
+	newRules := readable()
+	require.NotEqual(t, oldRules, newRules)
+	require.NotEmpty(t, seen)
+	for _, rules := range seen {
+		if !reflect.DeepEqual(rules, oldRules) {
+			require.Equal(t, newRules, rules, "the program must read either the old or the new rules")
+		}
+	}
+
+	info := fm.endpoints.entries[backend].(EndpointInfo)
+	require.Equal(t, oldSlot^1, info.Slot)
+	for key := range fm.rules.entries {
+		if ruleKey := key.(RuleKey); ruleKey.IP == backend.IP {
+			require.NotEqual(t, oldSlot, ruleKey.Slot, "the old rules are deleted")
+		}
+	}
+	require.Equal(t, len(dp.applied.Rules), len(fm.rules.entries))
+
+	// unchanged rules stay in their slot
+	require.NoError(t, dp.ApplyDataPlane())
+	require.Equal(t, info.Slot, fm.endpoints.entries[backend].(EndpointInfo).Slot)
+}
+
+func TestRemovedPodIsNotEnforced(t *testing.T) {
+	dp, _, attacher := setUpShop(t)
+	podMetadata := dataplane.NewPodMetadata("shop/backend", "10.0.0.2", nodeName)
+	setMetadatas := []*ipsets.IPSetMetadata{
+		ipsets.NewIPSetMetadata("shop", ipsets.Namespace),
+		ipsets.NewIPSetMetadata("app", ipsets.KeyLabelOfPod),
+		ipsets.NewIPSetMetadata("app:backend", ipsets.KeyValueLabelOfPod),
+	}
+	require.NoError(t, dp.RemoveFromSets(setMetadatas, podMetadata))
+	require.NoError(t, dp.ApplyDataPlane())
+	require.Equal(t, []string{"10.0.0.1"}, attacher.podIPs)
+	require.True(t, dp.applied.Allowed(tcpPacket("10.0.0.3", "10.0.0.2", 8080)))
+}
+
+func TestAdminTiers(t *testing.T) {
+	dp, _, _ := setUpShop(t)
+
+	frontend := policies.NewSetInfo("app:frontend", ipsets.KeyValueLabelOfPod, true, policies.SrcMatch)
+	shop := policies.NewSetInfo("shop", ipsets.Namespace, true, policies.SrcMatch)
+
+	// the admin tier denies what the NetworkPolicy allows
+	anp := policies.NewNPMNetworkPolicy("deny-frontend", "")
+	anp.Tier = policies.AdminTier
+	anp.PodSelectorList = []policies.SetInfo{policies.NewSetInfo("app:backend", ipsets.KeyValueLabelOfPod, true, policies.EitherMatch)}
+	deny := policies.NewACLPolicy(policies.Dropped, policies.Ingress)
+	deny.SrcList = []policies.SetInfo{frontend}
+	anp.ACLs = []*policies.ACLPolicy{deny}
+	require.NoError(t, dp.AddPolicy(anp))
+	require.False(t, dp.applied.Allowed(tcpPacket("10.0.0.1", "10.0.0.2", 8080)))
+
+	// a higher priority pass defers to the NetworkPolicy
+	pass := policies.NewNPMNetworkPolicy("pass-shop", "")
+	pass.Tier = policies.AdminTier
+	pass.PodSelectorList = anp.PodSelectorList
+	passACL := policies.NewACLPolicy(policies.Passed, policies.Ingress)
+	passACL.SrcList = []policies.SetInfo{shop}
+	pass.ACLs = []*policies.ACLPolicy{passACL}
+	anp.Priority = 10
+	require.NoError(t, dp.UpdatePolicy(anp))
+	require.NoError(t, dp.AddPolicy(pass))
+	require.True(t, dp.applied.Allowed(tcpPacket("10.0.0.1", "10.0.0.2", 8080)))
+
+	// the baseline tier applies to pods which NetworkPolicies don't isolate
+	banp := policies.NewNPMNetworkPolicy("default", "")
+	banp.Tier = policies.BaselineTier
+	banp.PodSelectorList = []policies.SetInfo{policies.NewSetInfo("shop", ipsets.Namespace, true, policies.EitherMatch)}
+	baselineDeny := policies.NewACLPolicy(policies.Dropped, policies.Egress)
+	banp.ACLs = []*policies.ACLPolicy{baselineDeny}
+	require.NoError(t, dp.AddPolicy(banp))
+	require.False(t, dp.applied.Allowed(tcpPacket("10.0.0.2", "1.1.1.1", 443)))
+	require.True(t, dp.applied.Allowed(tcpPacket("10.0.0.1", "10.0.0.2", 8080)), "frontend egress is isolated")
+}
+
+func TestFlowTracking(t *testing.T) {
+	dp, fm, _ := setUpShop(t)
+	require.Equal(t, dp.generation, fm.generation.entries[generationKey])
+	ft := newFlowTable(dp.generation)
+	now := uint64(1000)
+
+	// backend's ingress is isolated, so only replies of its own requests reach it from the client
+	require.True(t, send(dp, ft, tcpSegment("10.0.0.2", 40000, "10.0.0.3", 53, tcpSYN), now))
+	require.False(t, send(dp, ft, tcpSegment("10.0.0.3", 53, "10.0.0.2", 40000, tcpSYN), now), "a SYN is never a reply")
+	require.True(t, send(dp, ft, tcpSegment("10.0.0.3", 53, "10.0.0.2", 40000, tcpSYN|tcpACK), now))
+	require.True(t, send(dp, ft, tcpSegment("10.0.0.3", 53, "10.0.0.2", 40000, tcpACK), now))
+	require.False(t, send(dp, ft, tcpSegment("10.0.0.3", 53, "10.0.0.2", 40001, tcpACK), now), "unsolicited reply")
+	require.True(t, send(dp, ft, tcpSegment("10.0.0.3", 53, "10.0.0.2", 40000, tcpRST), now))
+	require.False(t, send(dp, ft, tcpSegment("10.0.0.3", 53, "10.0.0.2", 40000, tcpACK), now), "RST closes the flow")
+
+	// unanswered flows expire
+	require.True(t, send(dp, ft, udpPacket("10.0.0.2", 40002, "10.0.0.3", 53), now))
+	require.False(t, send(dp, ft, udpPacket("10.0.0.3", 53, "10.0.0.2", 40002), now+flowNewTimeout+1))
+	require.True(t, send(dp, ft, udpPacket("10.0.0.2", 40003, "10.0.0.3", 53), now))
+	require.True(t, send(dp, ft, udpPacket("10.0.0.3", 53, "10.0.0.2", 40003), now+1))
+
+	// flows of older generations are evaluated again
+	require.NoError(t, dp.ApplyDataPlane())
+	require.Equal(t, dp.generation, fm.generation.entries[generationKey])
+	ft.generation = dp.generation
+	require.True(t, send(dp, ft, udpPacket("10.0.0.3", 53, "10.0.0.2", 40003), now+2), "the rules still allow the request")
+
+	addNetPol(t, dp, &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "backend-deny-egress", Namespace: "shop"},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "backend"}},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+		},
+	})
+	ft.generation = dp.generation
+	require.False(t, send(dp, ft, udpPacket("10.0.0.3", 53, "10.0.0.2", 40003), now+3), "the rules deny the request now")
+	require.NotContains(t, ft.flows, FlowKey{Src: ip4{10, 0, 0, 2}, Dst: ip4{10, 0, 0, 3}, SrcPort: 40003, DstPort: 53, Protocol: protocolUDP, Direction: directionEgress})
+}
+
+func TestFragments(t *testing.T) {
+	dp, _, _ := setUpShop(t)
+	udp := corev1.ProtocolUDP
+	port := intstr.FromInt(5353)
+	addNetPol(t, dp, &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "backend-mdns", Namespace: "shop"},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "backend"}},
+			Ingress:     []networkingv1.NetworkPolicyIngressRule{{Ports: []networkingv1.NetworkPolicyPort{{Protocol: &udp, Port: &port}}}},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		},
+	})
+	ft := newFlowTable(dp.generation)
+	now := uint64(1000)
+
+	// the first fragment decides for the rest of the datagram
+	require.True(t, send(dp, ft, udpFragment("10.0.0.1", "10.0.0.2", 5353, 7, false, true), now))
+	require.True(t, send(dp, ft, udpFragment("10.0.0.1", "10.0.0.2", 0, 7, true, true), now+1))
+	require.True(t, send(dp, ft, udpFragment("10.0.0.1", "10.0.0.2", 0, 7, true, false), now+2))
+	require.False(t, send(dp, ft, udpFragment("10.0.0.1", "10.0.0.2", 0, 7, true, false), now+3), "the last fragment ends the datagram")
+
+	require.False(t, send(dp, ft, udpFragment("10.0.0.1", "10.0.0.2", 0, 8, true, false), now), "the first fragment was not seen")
+	require.False(t, send(dp, ft, udpFragment("10.0.0.1", "10.0.0.2", 9999, 9, false, true), now))
+	require.False(t, send(dp, ft, udpFragment("10.0.0.1", "10.0.0.2", 0, 9, true, false), now+1), "the first fragment was dropped")
+
+	require.True(t, send(dp, ft, udpFragment("10.0.0.1", "10.0.0.2", 5353, 10, false, true), now))
+	require.False(t, send(dp, ft, udpFragment("10.0.0.1", "10.0.0.2", 0, 10, true, false), now+fragmentTimeout+1), "the datagram expired")
+}
+
+func TestParseMembers(t *testing.T) {
+	key, match, ok := parseCIDRMember(1, "10.0.0.0/8 nomatch")
+	require.True(t, ok)
+	require.Equal(t, uint8(0), match)
+	require.Equal(t, newCIDRKey(1, ip4{10, 0, 0, 0}, 8), key)
+
+	key, match, ok = parseCIDRMember(1, "10.0.0.1")
+	require.True(t, ok)
+	require.Equal(t, uint8(1), match)
+	require.Equal(t, uint32(cidrSetIDBits+32), key.PrefixLen)
+
+	_, _, ok = parseCIDRMember(1, "fd00::/64")
+	require.False(t, ok)
+
+	namedPort, ok := parseNamedPortMember(2, "10.0.0.1,UDP:53")
+	require.True(t, ok)
+	require.Equal(t, NamedPortKey{SetID: 2, IP: ip4{10, 0, 0, 1}, Port: 53, Protocol: protocolUDP}, namedPort)
+
+	namedPort, ok = parseNamedPortMember(2, "10.0.0.1,8080")
+	require.True(t, ok)
+	require.Equal(t, protocolTCP, namedPort.Protocol)
+
+	_, ok = parseNamedPortMember(2, "10.0.0.1")
+	require.False(t, ok)
+}
@@ -0,0 +1,137 @@
+package bpf
+
+import (
+	"fmt"
+)
+
+// Map is a BPF map. Keys and values are the structs in types.go.
+type Map interface {
+	Put(key, value interface{}) error
+	Delete(key interface{}) error
+}
+
+// Maps are the maps of the program.
+type Maps struct {
+	SetMembers       Map
+	CIDRMembers      Map
+	NamedPortMembers Map
+	Endpoints        Map
+	Rules            Map
+	// Generation holds the policy generation at generationKey
+	Generation Map
+}
+
+// syncMaps writes the difference between the applied and the desired contents.
+// The applied contents are updated after every successful write, so a failed sync is resumed by the next one.
+// Members and rules are written before the endpoints which use them, and removed after.
+// An endpoint whose rules changed gets them in the slot which the program doesn't read, and switches to it with one update.
+func syncMaps(maps *Maps, applied, desired *MapContents) error {
+	endpoints, rules := assignSlots(applied, desired)
+	if err := putChanged(maps.SetMembers, applied.SetMembers, desired.SetMembers); err != nil {
+		return fmt.Errorf("failed to update set members: %w", err)
+	}
+	if err := putChanged(maps.CIDRMembers, applied.CIDRMembers, desired.CIDRMembers); err != nil {
+		return fmt.Errorf("failed to update CIDR members: %w", err)
+	}
+	if err := putChanged(maps.NamedPortMembers, applied.NamedPortMembers, desired.NamedPortMembers); err != nil {
+		return fmt.Errorf("failed to update named port members: %w", err)
+	}
+	if err := putChanged(maps.Rules, applied.Rules, rules); err != nil {
+		return fmt.Errorf("failed to update rules: %w", err)
+	}
+	if err := putChanged(maps.Endpoints, applied.Endpoints, endpoints); err != nil {
+		return fmt.Errorf("failed to update endpoints: %w", err)
+	}
+
+	if err := deleteStale(maps.Endpoints, applied.Endpoints, endpoints); err != nil {
+		return fmt.Errorf("failed to delete endpoints: %w", err)
+	}
+	if err := deleteStale(maps.Rules, applied.Rules, rules); err != nil {
+		return fmt.Errorf("failed to delete rules: %w", err)
+	}
+	if err := deleteStale(maps.NamedPortMembers, applied.NamedPortMembers, desired.NamedPortMembers); err != nil {
+		return fmt.Errorf("failed to delete named port members: %w", err)
+	}
+	if err := deleteStale(maps.CIDRMembers, applied.CIDRMembers, desired.CIDRMembers); err != nil {
+		return fmt.Errorf("failed to delete CIDR members: %w", err)
+	}
+	if err := deleteStale(maps.SetMembers, applied.SetMembers, desired.SetMembers); err != nil {
+		return fmt.Errorf("failed to delete set members: %w", err)
+	}
+	return nil
+}
+
+// assignSlots returns the desired endpoints and rules in the slots which they are written into.
+// An endpoint keeps its slot while its rules are unchanged, and a new endpoint starts in slot 0.
+func assignSlots(applied, desired *MapContents) (map[EndpointKey]EndpointInfo, map[RuleKey]Rule) {
+	appliedRules := rulesByEndpoint(applied.Rules)
+	desiredRules := rulesByEndpoint(desired.Rules)
+	endpoints := make(map[EndpointKey]EndpointInfo, len(desired.Endpoints))
+	rules := make(map[RuleKey]Rule, len(desired.Rules))
+	for key, info := range desired.Endpoints {
+		current, ok := applied.Endpoints[key]
+		info.Slot = current.Slot
+		if ok && !sameRules(appliedRules[key.IP], desiredRules[key.IP], current.Slot) {
+			info.Slot = current.Slot ^ 1
+		}
+		endpoints[key] = info
+		for ruleKey, rule := range desiredRules[key.IP] {
+			ruleKey.Slot = info.Slot
+			rules[ruleKey] = rule
+		}
+	}
+	return endpoints, rules
+}
+
+func rulesByEndpoint(rules map[RuleKey]Rule) map[ip4]map[RuleKey]Rule {
+	byEndpoint := make(map[ip4]map[RuleKey]Rule)
+	for key, rule := range rules {
+		if byEndpoint[key.IP] == nil {
+			byEndpoint[key.IP] = make(map[RuleKey]Rule)
+		}
+		byEndpoint[key.IP][key] = rule
+	}
+	return byEndpoint
+}
+
+// sameRules returns true if the applied rules of an endpoint in the slot are the desired rules, which are in slot 0.
+func sameRules(applied, desired map[RuleKey]Rule, slot uint8) bool {
+	count := 0
+	for key, rule := range applied {
+		if key.Slot != slot {
+			continue
+		}
+		count++
+		key.Slot = 0
+		if desiredRule, ok := desired[key]; !ok || desiredRule != rule {
+			return false
+		}
+	}
+	return count == len(desired)
+}
+
+func putChanged[K, V comparable](m Map, applied, desired map[K]V) error {
+	for key, value := range desired {
+		if current, ok := applied[key]; ok && current == value {
+			continue
+		}
+		if err := m.Put(key, value); err != nil {
+			return fmt.Errorf("failed to put %+v: %w", key, err)
+		}
+		applied[key] = value
+	}
+	return nil
+}
+
+func deleteStale[K, V comparable](m Map, applied, desired map[K]V) error {
+	for key := range applied {
+		if _, ok := desired[key]; ok {
+			continue
+		}
+		if err := m.Delete(key); err != nil {
+			return fmt.Errorf("failed to delete %+v: %w", key, err)
+		}
+		delete(applied, key)
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package bpf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+
+	"github.com/Azure/azure-container-networking/bpf-prog/npm-policy/pkg/npmpolicy"
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"github.com/cilium/ebpf/rlimit"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+	"k8s.io/klog"
+)
+
+const (
+	interfaceLinksCount = 2
+
+	// names and priority of the tc filters on kernels without tcx
+	fromPodFilterName = "npm_from_pod"
+	toPodFilterName   = "npm_to_pod"
+	tcFilterPriority  = 1
+)
+
+var errNoHostVeth = errors.New("no host veth")
+
+// Program is the npm_policy.bpf.c program which bpf2go compiled into npmpolicy. It implements Attacher.
+// Nothing is pinned, so the maps and links go away with the NPM process and a restarted NPM starts from empty maps.
+// Kernels before 6.6 have no tcx, so the programs are attached as tc filters on a clsact qdisc instead.
+// Those outlive the process, so LoadProgram removes the filters of a previous NPM.
+type Program struct {
+	objs *npmpolicy.NpmPolicyObjects
+	tcx  bool
+	// links are keyed by the index of the pod's host interface
+	links map[int][interfaceLinksCount]io.Closer
+}
+
+var _ Attacher = &Program{}
+
+// LoadProgram loads the program which is embedded in the NPM binary.
+func LoadProgram() (*Program, error) {
+	if err := rlimit.RemoveMemlock(); err != nil {
+		return nil, fmt.Errorf("failed to remove memlock rlimit: %w", err)
+	}
+	objs := &npmpolicy.NpmPolicyObjects{}
+	if err := npmpolicy.LoadNpmPolicyObjects(objs, nil); err != nil {
+		return nil, fmt.Errorf("failed to load BPF objects: %w", err)
+	}
+
+	tcx := tcxSupported(objs.NpmFromPod)
+	if !tcx {
+		klog.Info("[BPFDataPlane] the kernel doesn't support tcx, so the programs are attached as tc filters")
+		if err := removeTCFilters(); err != nil {
+			objs.Close()
+			return nil, err
+		}
+	}
+	return &Program{
+		objs:  objs,
+		tcx:   tcx,
+		links: make(map[int][interfaceLinksCount]io.Closer),
+	}, nil
+}
+
+// tcxSupported attaches the program to an interface which doesn't exist.
+// The kernel only reports the missing interface if it supports tcx.
+func tcxSupported(prog *ebpf.Program) bool {
+	l, err := link.AttachTCX(link.TCXOptions{
+		Interface: math.MaxInt32,
+		Program:   prog,
+		Attach:    ebpf.AttachTCXIngress,
+	})
+	if err == nil {
+		l.Close()
+		return true
+	}
+	return !errors.Is(err, ebpf.ErrNotSupported)
+}
+
+// removeTCFilters removes the filters which a previous NPM left on the host veths, since they still run its program and maps.
+func removeTCFilters() error {
+	links, err := netlink.LinkList()
+	if err != nil {
+		return fmt.Errorf("failed to list interfaces: %w", err)
+	}
+	for _, l := range links {
+		if l.Type() != "veth" {
+			continue
+		}
+		for _, parent := range []uint32{netlink.HANDLE_MIN_INGRESS, netlink.HANDLE_MIN_EGRESS} {
+			filters, err := netlink.FilterList(l, parent)
+			if err != nil {
+				return fmt.Errorf("failed to list filters of interface %s: %w", l.Attrs().Name, err)
+			}
+			for _, filter := range filters {
+				bpfFilter, ok := filter.(*netlink.BpfFilter)
+				if !ok || (bpfFilter.Name != fromPodFilterName && bpfFilter.Name != toPodFilterName) {
+					continue
+				}
+				if err := netlink.FilterDel(bpfFilter); err != nil {
+					return fmt.Errorf("failed to remove filter %s of interface %s: %w", bpfFilter.Name, l.Attrs().Name, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Maps returns the maps of the program.
+func (p *Program) Maps() *Maps {
+	return &Maps{
+		SetMembers:       &bpfMap{p.objs.SetMembers},
+		CIDRMembers:      &bpfMap{p.objs.CidrMembers},
+		NamedPortMembers: &bpfMap{p.objs.NamedPortMembers},
+		Endpoints:        &bpfMap{p.objs.Endpoints},
+		Rules:            &bpfMap{p.objs.Rules},
+		Generation:       &bpfMap{p.objs.Generation},
+	}
+}
+
+// Sync attaches the programs to the host veth of each pod IP,
+// and detaches them from the interfaces of pods which no longer have rules.
+// npm_from_pod is attached to tcx ingress since packets from the pod enter the host there, and npm_to_pod to tcx egress.
+// The interfaces map points each interface at its pod's endpoint, which IPv6 packets are filtered by.
+func (p *Program) Sync(podIPs []string) error {
+	desired := make(map[int]struct{}, len(podIPs))
+	var errs []error
+	for _, podIP := range podIPs {
+		ifIndex, err := hostInterfaceIndex(podIP)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		desired[ifIndex] = struct{}{}
+		endpoint, _ := toIP4(net.ParseIP(podIP))
+		if err := p.objs.Interfaces.Put(uint32(ifIndex), EndpointKey{IP: endpoint}); err != nil {
+			errs = append(errs, fmt.Errorf("failed to map interface %d to pod %s: %w", ifIndex, podIP, err))
+			continue
+		}
+		if _, ok := p.links[ifIndex]; ok {
+			continue
+		}
+		links, err := p.attach(ifIndex)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to attach to interface of pod %s: %w", podIP, err))
+			continue
+		}
+		p.links[ifIndex] = links
+		klog.Infof("[BPFDataPlane] attached programs to interface %d of pod %s", ifIndex, podIP)
+	}
+
+	for ifIndex, links := range p.links {
+		if _, ok := desired[ifIndex]; ok {
+			continue
+		}
+		for _, l := range links {
+			// the interface is gone if the pod was deleted, which detaches the link already
+			if err := l.Close(); err != nil {
+				klog.Warningf("[BPFDataPlane] failed to detach program from interface %d: %v", ifIndex, err)
+			}
+		}
+		if err := p.objs.Interfaces.Delete(uint32(ifIndex)); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			klog.Warningf("[BPFDataPlane] failed to unmap interface %d: %v", ifIndex, err)
+		}
+		delete(p.links, ifIndex)
+	}
+	return errors.Join(errs...)
+}
+
+func (p *Program) attach(ifIndex int) ([interfaceLinksCount]io.Closer, error) {
+	if !p.tcx {
+		return p.attachTC(ifIndex)
+	}
+
+	var links [interfaceLinksCount]io.Closer
+	fromPod, err := link.AttachTCX(link.TCXOptions{
+		Interface: ifIndex,
+		Program:   p.objs.NpmFromPod,
+		Attach:    ebpf.AttachTCXIngress,
+	})
+	if err != nil {
+		return links, fmt.Errorf("failed to attach npm_from_pod: %w", err)
+	}
+	toPod, err := link.AttachTCX(link.TCXOptions{
+		Interface: ifIndex,
+		Program:   p.objs.NpmToPod,
+		Attach:    ebpf.AttachTCXEgress,
+	})
+	if err != nil {
+		fromPod.Close()
+		return links, fmt.Errorf("failed to attach npm_to_pod: %w", err)
+	}
+	links[0], links[1] = fromPod, toPod
+	return links, nil
+}
+
+// attachTC attaches the programs as direct action filters on the clsact qdisc of the interface.
+func (p *Program) attachTC(ifIndex int) ([interfaceLinksCount]io.Closer, error) {
+	var links [interfaceLinksCount]io.Closer
+	qdisc := &netlink.Clsact{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: ifIndex,
+			Handle:    netlink.MakeHandle(0xffff, 0),
+			Parent:    netlink.HANDLE_CLSACT,
+		},
+	}
+	if err := netlink.QdiscReplace(qdisc); err != nil {
+		return links, fmt.Errorf("failed to add clsact qdisc: %w", err)
+	}
+
+	fromPod, err := replaceTCFilter(ifIndex, netlink.HANDLE_MIN_INGRESS, p.objs.NpmFromPod, fromPodFilterName)
+	if err != nil {
+		return links, err
+	}
+	toPod, err := replaceTCFilter(ifIndex, netlink.HANDLE_MIN_EGRESS, p.objs.NpmToPod, toPodFilterName)
+	if err != nil {
+		fromPod.Close()
+		return links, err
+	}
+	links[0], links[1] = fromPod, toPod
+	return links, nil
+}
+
+func replaceTCFilter(ifIndex int, parent uint32, prog *ebpf.Program, name string) (*tcFilter, error) {
+	filter := &netlink.BpfFilter{
+		FilterAttrs: netlink.FilterAttrs{
+			LinkIndex: ifIndex,
+			Parent:    parent,
+			Handle:    1,
+			Protocol:  unix.ETH_P_ALL,
+			Priority:  tcFilterPriority,
+		},
+		Fd:           prog.FD(),
+		Name:         name,
+		DirectAction: true,
+	}
+	if err := netlink.FilterReplace(filter); err != nil {
+		return nil, fmt.Errorf("failed to attach %s: %w", name, err)
+	}
+	return &tcFilter{filter: filter}, nil
+}
+
+// tcFilter detaches a program which is attached as a tc filter.
+type tcFilter struct {
+	filter *netlink.BpfFilter
+}
+
+func (f *tcFilter) Close() error {
+	// the filter is gone with the interface
+	if err := netlink.FilterDel(f.filter); err != nil && !errors.Is(err, unix.ENODEV) && !errors.Is(err, unix.ENOENT) {
+		return fmt.Errorf("failed to remove filter %s: %w", f.filter.Name, err)
+	}
+	return nil
+}
+
+// hostInterfaceIndex returns the index of the host veth of a local pod.
+// The route to the pod is the veth in transparent mode. In bridge mode it is the bridge,
+// so the veth is the bridge port which the bridge learned the MAC of the pod's neighbor entry on.
+// A pod has no neighbor entry until it exchanged traffic with the host, so the next apply retries it.
+func hostInterfaceIndex(podIP string) (int, error) {
+	ip := net.ParseIP(podIP)
+	if ip == nil {
+		return 0, fmt.Errorf("invalid pod IP %s", podIP)
+	}
+	routes, err := netlink.RouteGet(ip)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get route to pod %s: %w", podIP, err)
+	}
+	if len(routes) == 0 || routes[0].LinkIndex == 0 {
+		return 0, fmt.Errorf("no route to pod %s", podIP)
+	}
+	routeLink, err := netlink.LinkByIndex(routes[0].LinkIndex)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get interface %d of route to pod %s: %w", routes[0].LinkIndex, podIP, err)
+	}
+
+	switch routeLink.Type() {
+	case "veth":
+		return routeLink.Attrs().Index, nil
+	case "bridge":
+		return bridgePortIndex(routeLink.Attrs().Index, ip)
+	default:
+		return 0, fmt.Errorf("route to pod %s uses %s interface %s: %w", podIP, routeLink.Type(), routeLink.Attrs().Name, errNoHostVeth)
+	}
+}
+
+func bridgePortIndex(bridgeIndex int, ip net.IP) (int, error) {
+	neighs, err := netlink.NeighList(bridgeIndex, netlink.FAMILY_V4)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list neighbors of bridge %d: %w", bridgeIndex, err)
+	}
+	var mac net.HardwareAddr
+	for i := range neighs {
+		if neighs[i].IP.Equal(ip) && len(neighs[i].HardwareAddr) > 0 {
+			mac = neighs[i].HardwareAddr
+			break
+		}
+	}
+	if mac == nil {
+		return 0, fmt.Errorf("pod %s has no neighbor entry on bridge %d: %w", ip, bridgeIndex, errNoHostVeth)
+	}
+
+	fdb, err := netlink.NeighList(0, unix.AF_BRIDGE)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list bridge forwarding entries: %w", err)
+	}
+	for i := range fdb {
+		if fdb[i].MasterIndex != bridgeIndex || !bytes.Equal(fdb[i].HardwareAddr, mac) {
+			continue
+		}
+		port, err := netlink.LinkByIndex(fdb[i].LinkIndex)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get bridge port %d: %w", fdb[i].LinkIndex, err)
+		}
+		if port.Type() == "veth" {
+			return port.Attrs().Index, nil
+		}
+	}
+	return 0, fmt.Errorf("bridge %d has not learned the port of pod %s with MAC %s: %w", bridgeIndex, ip, mac, errNoHostVeth)
+}
+
+// Close detaches the programs and unloads them.
+func (p *Program) Close() error {
+	var errs []error
+	for ifIndex, links := range p.links {
+		for _, l := range links {
+			if err := l.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("failed to detach program from interface %d: %w", ifIndex, err))
+			}
+		}
+		delete(p.links, ifIndex)
+	}
+	if err := p.objs.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to unload BPF objects: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// bpfMap adapts ebpf.Map to Map.
+type bpfMap struct {
+	m *ebpf.Map
+}
+
+func (b *bpfMap) Put(key, value interface{}) error {
+	return b.m.Put(key, value) //nolint:wrapcheck // wrapped by syncMaps
+}
+
+func (b *bpfMap) Delete(key interface{}) error {
+	if err := b.m.Delete(key); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+		return err //nolint:wrapcheck // wrapped by syncMaps
+	}
+	return nil
+}
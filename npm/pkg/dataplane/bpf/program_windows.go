@@ -0,0 +1,26 @@
+package bpf
+
+import "errors"
+
+var errUnsupportedOS = errors.New("the BPF dataplane is only supported on Linux")
+
+// Program is not supported on Windows.
+type Program struct{}
+
+var _ Attacher = &Program{}
+
+func LoadProgram() (*Program, error) {
+	return nil, errUnsupportedOS
+}
+
+func (p *Program) Maps() *Maps {
+	return &Maps{}
+}
+
+func (p *Program) Sync(_ []string) error {
+	return errUnsupportedOS
+}
+
+func (p *Program) Close() error {
+	return nil
+}
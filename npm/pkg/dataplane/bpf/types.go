@@ -0,0 +1,214 @@
+// Package bpf is an NPM dataplane for Linux which enforces policies with tc BPF programs on the host side of pod veths.
+// IPSets and NPMNetworkPolicies are compiled into BPF maps in user space:
+// set membership goes into hash maps, CIDR blocks into an LPM trie, and each local pod gets an ordered list of rules.
+// The program in bpf-prog/npm-policy walks the rules of the pod, so an apply only writes the map entries which changed.
+package bpf
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+)
+
+// The layouts below must match bpf-prog/npm-policy/bpf/include/npm_policy.h.
+const (
+	// MaxPeers is the maximum number of sets which a rule can match on.
+	MaxPeers = 8
+	// MaxRulesPerDirection is the maximum number of rules of a pod in one direction.
+	MaxRulesPerDirection = 256
+
+	// the direction index of endpoint and rule keys
+	directionIngress uint8 = 0
+	directionEgress  uint8 = 1
+)
+
+// Tier values of a rule. Rules of a pod are ordered by tier.
+const (
+	tierAdmin         uint8 = 0
+	tierNetworkPolicy uint8 = 1
+	tierBaseline      uint8 = 2
+)
+
+// Target values of a rule.
+const (
+	targetAllow uint8 = 0
+	targetDeny  uint8 = 1
+	targetPass  uint8 = 2
+)
+
+// Kind values of a peer decide which map holds the set's members.
+const (
+	peerKindHash      uint8 = 0
+	peerKindCIDR      uint8 = 1
+	peerKindNamedPort uint8 = 2
+)
+
+// Match values of a peer decide which address of the packet is looked up.
+const (
+	peerMatchSrc uint8 = 0
+	peerMatchDst uint8 = 1
+)
+
+// Protocol values of a rule, matching the IP protocol numbers.
+const (
+	protocolAny  uint8 = 0
+	protocolTCP  uint8 = 6
+	protocolUDP  uint8 = 17
+	protocolSCTP uint8 = 132
+)
+
+// State values of a flow.
+const (
+	flowNew         uint8 = 0
+	flowEstablished uint8 = 1
+	flowClosing     uint8 = 2
+)
+
+// Idle timeouts of flows by state, in nanoseconds. Established TCP flows use the conntrack default.
+const (
+	flowNewTimeout            = uint64(60 * time.Second)
+	flowEstablishedTimeout    = uint64(120 * time.Second)
+	flowTCPEstablishedTimeout = uint64(5 * 24 * time.Hour)
+	flowClosingTimeout        = uint64(120 * time.Second)
+)
+
+// fragmentTimeout is how long the first fragment of a datagram lets the others through, in nanoseconds.
+const fragmentTimeout = uint64(30 * time.Second)
+
+// TCP flags which the program tracks flows with.
+const (
+	tcpFIN uint8 = 0x01
+	tcpSYN uint8 = 0x02
+	tcpRST uint8 = 0x04
+	tcpACK uint8 = 0x10
+)
+
+// ip4 is an IPv4 address in network byte order.
+type ip4 [4]byte
+
+func toIP4(ip net.IP) (ip4, bool) {
+	var addr ip4
+	v4 := ip.To4()
+	if v4 == nil {
+		return addr, false
+	}
+	copy(addr[:], v4)
+	return addr, true
+}
+
+func (ip ip4) String() string {
+	return net.IP(ip[:]).String()
+}
+
+// SetMemberKey is the key of the set_members hash map, which holds the IPs of hash and list sets.
+type SetMemberKey struct {
+	SetID uint32
+	IP    ip4
+}
+
+// CIDRKey is the key of the cidr_members LPM trie. The prefix length covers the set ID and the address.
+type CIDRKey struct {
+	PrefixLen uint32
+	SetID     [4]byte
+	IP        ip4
+}
+
+// cidrSetIDBits is added to the prefix length of a CIDR so that lookups never match another set
+const cidrSetIDBits = 32
+
+func newCIDRKey(setID uint32, ip ip4, prefixLen int) CIDRKey {
+	key := CIDRKey{PrefixLen: uint32(cidrSetIDBits + prefixLen), IP: ip}
+	binary.BigEndian.PutUint32(key.SetID[:], setID)
+	return key
+}
+
+// NamedPortKey is the key of the named_port_members hash map.
+type NamedPortKey struct {
+	SetID    uint32
+	IP       ip4
+	Port     uint16
+	Protocol uint8
+	_        uint8
+}
+
+// EndpointKey is the key of the endpoints hash map, which holds the local pods with rules.
+type EndpointKey struct {
+	IP ip4
+}
+
+// EndpointInfo is the value of the endpoints hash map. The arrays are indexed by direction.
+type EndpointInfo struct {
+	RuleCount [2]uint16
+	// Isolated is 1 if a NetworkPolicy selects the pod in the direction
+	Isolated [2]uint8
+	// Slot is the slot of the pod's rules. Changed rules are written into the other slot before the pod switches to it.
+	Slot uint8
+	_    uint8
+}
+
+// RuleKey is the key of the rules hash map.
+type RuleKey struct {
+	IP        ip4
+	Index     uint16
+	Direction uint8
+	Slot      uint8
+}
+
+// Peer is a set which a rule matches on.
+type Peer struct {
+	SetID    uint32
+	Kind     uint8
+	Match    uint8
+	Included uint8
+	_        uint8
+}
+
+// Rule is the value of the rules hash map. It is an ACL of a policy which selects the pod.
+type Rule struct {
+	// PolicyID groups the rules of a policy. Within a policy, the first matching rule decides.
+	PolicyID  uint32
+	PortStart uint16
+	PortEnd   uint16
+	Tier      uint8
+	Target    uint8
+	Protocol  uint8
+	PeerCount uint8
+	Peers     [MaxPeers]Peer
+}
+
+// FlowKey is the key of the flows LRU map. It identifies an allowed flow in the direction it was evaluated in.
+type FlowKey struct {
+	Src       ip4
+	Dst       ip4
+	SrcPort   uint16
+	DstPort   uint16
+	Protocol  uint8
+	Direction uint8
+	_         [2]uint8
+}
+
+// FlowValue is the value of the flows LRU map.
+// Generation is the policy generation which allowed the flow. The Dataplane increments it on every apply, so older flows are evaluated again.
+type FlowValue struct {
+	LastSeenNs uint64
+	Generation uint32
+	State      uint8
+	_          [3]uint8
+}
+
+// FragmentKey is the key of the fragments LRU map. It identifies a datagram whose first fragment was allowed in the direction.
+type FragmentKey struct {
+	Src       ip4
+	Dst       ip4
+	ID        uint16
+	Protocol  uint8
+	Direction uint8
+}
+
+// FragmentValue is the value of the fragments LRU map.
+type FragmentValue struct {
+	LastSeenNs uint64
+}
+
+// generationKey is the only key of the generation array map.
+const generationKey uint32 = 0
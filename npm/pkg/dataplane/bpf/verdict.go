@@ -0,0 +1,282 @@
+package bpf
+
+import (
+	"net"
+)
+
+// Packet is the part of a packet which the program matches on.
+type Packet struct {
+	Src      net.IP
+	Dst      net.IP
+	Protocol uint8
+	// Port is the destination port
+	Port     uint16
+	SrcPort  uint16
+	TCPFlags uint8
+	// ID, LaterFragment, and MoreFragments are the IP ID and fragment flags of fragments
+	ID            uint16
+	LaterFragment bool
+	MoreFragments bool
+	// SrcPod and DstPod are the IPv4 addresses of the pods whose host interfaces an IPv6 packet leaves and enters,
+	// which the program finds the pods' endpoints by
+	SrcPod net.IP
+	DstPod net.IP
+}
+
+// Allowed mirrors the program: the egress rules of the source pod and the ingress rules of the destination pod
+// must both allow the packet. It lets the map contents be tested without loading the program.
+func (m *MapContents) Allowed(p *Packet) bool {
+	src, srcOK := toIP4(p.Src)
+	dst, dstOK := toIP4(p.Dst)
+	if !srcOK || !dstOK {
+		return m.allowedIPv6(p.SrcPod, directionEgress) && m.allowedIPv6(p.DstPod, directionIngress)
+	}
+	return m.allowed(src, directionEgress, src, dst, p.Protocol, p.Port) &&
+		m.allowed(dst, directionIngress, src, dst, p.Protocol, p.Port)
+}
+
+// allowed is the verdict of npm_evaluate() in npm_policy.bpf.c for the endpoint in one direction.
+func (m *MapContents) allowed(endpoint ip4, direction uint8, src, dst ip4, protocol uint8, port uint16) bool {
+	info, ok := m.Endpoints[EndpointKey{IP: endpoint}]
+	if !ok {
+		return true
+	}
+
+	isolated := info.Isolated[direction] != 0
+	passed := false
+	skipPolicy := uint32(0)
+	for i := uint16(0); i < info.RuleCount[direction]; i++ {
+		rule, ok := m.Rules[RuleKey{IP: endpoint, Index: i, Direction: direction, Slot: info.Slot}]
+		if !ok {
+			continue
+		}
+		if rule.Tier == tierAdmin && passed {
+			continue
+		}
+		if rule.Tier == tierBaseline && isolated {
+			// NetworkPolicies decided the flow
+			break
+		}
+		if rule.PolicyID == skipPolicy || !m.matches(&rule, src, dst, protocol, port) {
+			continue
+		}
+
+		switch rule.Tier {
+		case tierAdmin, tierBaseline:
+			switch rule.Target {
+			case targetAllow:
+				return true
+			case targetDeny:
+				return false
+			default:
+				passed = true
+			}
+		default:
+			// NetworkPolicies are additive, but the first matching rule decides the policy's verdict
+			if rule.Target == targetAllow {
+				return true
+			}
+			skipPolicy = rule.PolicyID
+		}
+	}
+	return !isolated
+}
+
+// allowedIPv6 is the verdict of filter_ipv6() in npm_policy.bpf.c for the pod in one direction.
+func (m *MapContents) allowedIPv6(pod net.IP, direction uint8) bool {
+	endpoint, ok := toIP4(pod)
+	if !ok {
+		return true
+	}
+	info, ok := m.Endpoints[EndpointKey{IP: endpoint}]
+	return !ok || info.Isolated[direction] == 0
+}
+
+func (m *MapContents) matches(rule *Rule, src, dst ip4, protocol uint8, port uint16) bool {
+	if rule.Protocol != protocolAny && rule.Protocol != protocol {
+		return false
+	}
+	if rule.PortStart != 0 && (port < rule.PortStart || port > rule.PortEnd) {
+		return false
+	}
+	for i := uint8(0); i < rule.PeerCount && i < MaxPeers; i++ {
+		peer := &rule.Peers[i]
+		if m.isMember(peer, src, dst, port, protocol) != (peer.Included != 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *MapContents) isMember(peer *Peer, src, dst ip4, port uint16, protocol uint8) bool {
+	ip := dst
+	if peer.Match == peerMatchSrc {
+		ip = src
+	}
+	switch peer.Kind {
+	case peerKindCIDR:
+		return m.inCIDRs(peer.SetID, ip)
+	case peerKindNamedPort:
+		_, ok := m.NamedPortMembers[NamedPortKey{SetID: peer.SetID, IP: dst, Port: port, Protocol: protocol}]
+		return ok
+	default:
+		_, ok := m.SetMembers[SetMemberKey{SetID: peer.SetID, IP: ip}]
+		return ok
+	}
+}
+
+// inCIDRs emulates the LPM trie lookup, where the longest prefix decides and nomatch entries have the value 0.
+func (m *MapContents) inCIDRs(setID uint32, ip ip4) bool {
+	for prefixLen := 32; prefixLen >= 0; prefixLen-- {
+		mask := net.CIDRMask(prefixLen, 32)
+		var masked ip4
+		for i := range masked {
+			masked[i] = ip[i] & mask[i]
+		}
+		if match, ok := m.CIDRMembers[newCIDRKey(setID, masked, prefixLen)]; ok {
+			return match == 1
+		}
+	}
+	return false
+}
+
+// flowTable mirrors the flows, fragments, and generation maps of the program.
+type flowTable struct {
+	generation uint32
+	flows      map[FlowKey]FlowValue
+	fragments  map[FragmentKey]FragmentValue
+}
+
+func newFlowTable(generation uint32) *flowTable {
+	return &flowTable{
+		generation: generation,
+		flows:      make(map[FlowKey]FlowValue),
+		fragments:  make(map[FragmentKey]FragmentValue),
+	}
+}
+
+// filter is the verdict of npm_filter() in npm_policy.bpf.c for the packet at the tc hook of the direction,
+// at now nanoseconds. It updates the flows and fragments like the program.
+func (m *MapContents) filter(ft *flowTable, p *Packet, direction uint8, now uint64) bool {
+	src, srcOK := toIP4(p.Src)
+	dst, dstOK := toIP4(p.Dst)
+	if !srcOK || !dstOK {
+		if direction == directionIngress {
+			return m.allowedIPv6(p.DstPod, direction)
+		}
+		return m.allowedIPv6(p.SrcPod, direction)
+	}
+
+	frag := FragmentKey{Src: src, Dst: dst, ID: p.ID, Protocol: p.Protocol, Direction: direction}
+	if p.LaterFragment {
+		if value, ok := ft.fragments[frag]; ok && now-value.LastSeenNs <= fragmentTimeout {
+			if p.MoreFragments {
+				ft.fragments[frag] = FragmentValue{LastSeenNs: now}
+			} else {
+				delete(ft.fragments, frag)
+			}
+			return true
+		}
+		endpoint := src
+		if direction == directionIngress {
+			endpoint = dst
+		}
+		return m.allowed(endpoint, direction, src, dst, p.Protocol, 0)
+	}
+
+	allowed := m.filterFlow(ft, p, src, dst, direction, now)
+	if allowed && p.MoreFragments {
+		ft.fragments[frag] = FragmentValue{LastSeenNs: now}
+	}
+	return allowed
+}
+
+// filterFlow mirrors filter_flow().
+func (m *MapContents) filterFlow(ft *flowTable, p *Packet, src, dst ip4, direction uint8, now uint64) bool {
+	tcp := p.Protocol == protocolTCP
+	syn := tcp && p.TCPFlags&(tcpSYN|tcpACK) == tcpSYN
+	flow := FlowKey{Src: src, Dst: dst, SrcPort: p.SrcPort, DstPort: p.Port, Protocol: p.Protocol, Direction: direction}
+
+	state := flowNew
+	if tcp && !syn {
+		state = flowEstablished
+	}
+	if !syn {
+		if value, ok := ft.flows[flow]; ok && flowLive(value, p.Protocol, now) {
+			if value.Generation == ft.generation {
+				ft.track(flow, value, p, false, now)
+				return true
+			}
+			state = value.State
+		}
+
+		replyDirection := directionIngress
+		if direction == directionIngress {
+			replyDirection = directionEgress
+		}
+		reply := FlowKey{Src: dst, Dst: src, SrcPort: p.Port, DstPort: p.SrcPort, Protocol: p.Protocol, Direction: replyDirection}
+		if value, ok := ft.flows[reply]; ok && flowLive(value, p.Protocol, now) {
+			if value.Generation == ft.generation {
+				ft.track(reply, value, p, true, now)
+				return true
+			}
+			// the request went from dst to src
+			requestEndpoint := dst
+			if replyDirection == directionIngress {
+				requestEndpoint = src
+			}
+			if m.allowed(requestEndpoint, replyDirection, dst, src, p.Protocol, p.SrcPort) {
+				value.Generation = ft.generation
+				ft.track(reply, value, p, true, now)
+				return true
+			}
+			delete(ft.flows, reply)
+		}
+	}
+
+	endpoint := src
+	if direction == directionIngress {
+		endpoint = dst
+	}
+	if !m.allowed(endpoint, direction, src, dst, p.Protocol, p.Port) {
+		delete(ft.flows, flow)
+		return false
+	}
+	if p.TCPFlags&tcpRST != 0 {
+		delete(ft.flows, flow)
+		return true
+	}
+	if p.TCPFlags&tcpFIN != 0 {
+		state = flowClosing
+	}
+	ft.flows[flow] = FlowValue{LastSeenNs: now, Generation: ft.generation, State: state}
+	return true
+}
+
+func flowLive(value FlowValue, protocol uint8, now uint64) bool {
+	timeout := flowEstablishedTimeout
+	switch {
+	case value.State == flowNew:
+		timeout = flowNewTimeout
+	case value.State == flowClosing:
+		timeout = flowClosingTimeout
+	case protocol == protocolTCP:
+		timeout = flowTCPEstablishedTimeout
+	}
+	return now-value.LastSeenNs <= timeout
+}
+
+// track mirrors track_flow().
+func (ft *flowTable) track(key FlowKey, value FlowValue, p *Packet, reply bool, now uint64) {
+	value.LastSeenNs = now
+	switch {
+	case p.TCPFlags&tcpRST != 0:
+		delete(ft.flows, key)
+		return
+	case p.TCPFlags&tcpFIN != 0:
+		value.State = flowClosing
+	case reply && value.State == flowNew:
+		value.State = flowEstablished
+	}
+	ft.flows[key] = value
+}
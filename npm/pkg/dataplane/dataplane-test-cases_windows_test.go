@@ -24,7 +24,6 @@ const (
 
 const (
 	testNodeIP = "6.7.8.9"
-	thisNode   = "this-node"
 	otherNode  = "other-node"
 
 	ip1 = "10.0.0.1"
@@ -45,10 +44,9 @@ var (
 
 	// emptySet is a member of a list if enabled in the dp Config
 	// in Windows, this Config option is actually forced to be enabled in NewDataPlane()
-	emptySet      = ipsets.NewIPSetMetadata("emptyhashset", ipsets.EmptyHashSet)
-	allNamespaces = ipsets.NewIPSetMetadata("all-namespaces", ipsets.KeyLabelOfNamespace)
-	nsXSet        = ipsets.NewIPSetMetadata("x", ipsets.Namespace)
-	nsYSet        = ipsets.NewIPSetMetadata("y", ipsets.Namespace)
+	emptySet = ipsets.NewIPSetMetadata("emptyhashset", ipsets.EmptyHashSet)
+	nsXSet   = ipsets.NewIPSetMetadata("x", ipsets.Namespace)
+	nsYSet   = ipsets.NewIPSetMetadata("y", ipsets.Namespace)
 
 	nsK1Set   = ipsets.NewIPSetMetadata("k1", ipsets.KeyLabelOfNamespace)
 	nsK1V1Set = ipsets.NewIPSetMetadata("k1:v1", ipsets.KeyValueLabelOfNamespace)
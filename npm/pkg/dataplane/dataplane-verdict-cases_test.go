@@ -0,0 +1,380 @@
+package dataplane
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// thisNode is the node which the DataPlane runs on
+const thisNode = "this-node"
+
+// verdict scenario pods. Every pod is on this node so that both OSes program its policies.
+const (
+	podXAIP = "10.0.0.1"
+	podXBIP = "10.0.0.2"
+	podYCIP = "10.0.0.3"
+
+	// externalIP is outside of the cluster
+	externalIP = "20.0.0.1"
+
+	tcp = "TCP"
+	udp = "UDP"
+)
+
+// VerdictTestCase runs actions against a DataPlane and checks the verdict of the node's dataplane for some flows,
+// so that the same scenario can run on every OS no matter how the OS programs policies.
+type VerdictTestCase struct {
+	Description string
+	Steps       []*VerdictStep
+}
+
+// VerdictStep runs its actions, applies the DataPlane, and then checks its flows.
+type VerdictStep struct {
+	Actions []*Action
+	Flows   []*Flow
+}
+
+// Flow is the first packet of a connection and whether it should be allowed.
+type Flow struct {
+	SrcIP    string
+	DstIP    string
+	Protocol string
+	DstPort  int
+	Allowed  bool
+}
+
+func allowedFlow(srcIP, dstIP, protocol string, dstPort int) *Flow {
+	return &Flow{SrcIP: srcIP, DstIP: dstIP, Protocol: protocol, DstPort: dstPort, Allowed: true}
+}
+
+func droppedFlow(srcIP, dstIP, protocol string, dstPort int) *Flow {
+	return &Flow{SrcIP: srcIP, DstIP: dstIP, Protocol: protocol, DstPort: dstPort, Allowed: false}
+}
+
+// verdictHarness is implemented per OS in dataplane_verdicts_<os>_test.go.
+// Its methods are:
+//   - run(t, action) to run an action, including any OS-specific setup for the action (e.g. creating an HNS endpoint)
+//   - allowed(t, flow) to get the verdict of the OS's dataplane for the flow
+//   - stop() to stop the DataPlane
+var _ interface {
+	run(t *testing.T, a *Action)
+	allowed(t *testing.T, f *Flow) bool
+	stop()
+} = (*verdictHarness)(nil)
+
+func TestVerdicts(t *testing.T) {
+	for i, tt := range verdictTestCases() {
+		i := i
+		tt := tt
+		t.Run(tt.Description, func(t *testing.T) {
+			t.Logf("beginning test #%d. Description: [%s]", i, tt.Description)
+
+			h := newVerdictHarness(t)
+			defer h.stop()
+
+			for j, step := range tt.Steps {
+				for _, a := range step.Actions {
+					h.run(t, a)
+				}
+				// the controllers apply the DataPlane after every event
+				h.run(t, ApplyDP())
+
+				for _, f := range step.Flows {
+					require.Equal(t, f.Allowed, h.allowed(t, f), "step %d: unexpected verdict for %s %s -> %s:%d", j, f.Protocol, f.SrcIP, f.DstIP, f.DstPort)
+				}
+			}
+		})
+	}
+}
+
+// verdictPods creates namespaces x and y, pods x/a and x/b with labels app=a and app=b, and pod y/c with label app=c.
+func verdictPods() []*Action {
+	return []*Action{
+		CreateNamespace("x", map[string]string{"ns": "x"}),
+		CreateNamespace("y", map[string]string{"ns": "y"}),
+		CreatePod("x", "a", podXAIP, thisNode, map[string]string{"app": "a"}),
+		CreatePod("x", "b", podXBIP, thisNode, map[string]string{"app": "b"}),
+		CreatePod("y", "c", podYCIP, thisNode, map[string]string{"app": "c"}),
+	}
+}
+
+func verdictPolicy(name string, podLabels map[string]string, ingress []networkingv1.NetworkPolicyIngressRule, egress []networkingv1.NetworkPolicyEgressRule) *networkingv1.NetworkPolicy {
+	policyTypes := []networkingv1.PolicyType{}
+	if ingress != nil {
+		policyTypes = append(policyTypes, networkingv1.PolicyTypeIngress)
+	}
+	if egress != nil {
+		policyTypes = append(policyTypes, networkingv1.PolicyTypeEgress)
+	}
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "x",
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: podLabels},
+			Ingress:     ingress,
+			Egress:      egress,
+			PolicyTypes: policyTypes,
+		},
+	}
+}
+
+func policyPorts(protocol corev1.Protocol, port int) []networkingv1.NetworkPolicyPort {
+	p := intstr.FromInt(port)
+	return []networkingv1.NetworkPolicyPort{{Protocol: &protocol, Port: &p}}
+}
+
+// policyDenyIngressToA selects x/a and allows no ingress
+func policyDenyIngressToA() *networkingv1.NetworkPolicy {
+	return verdictPolicy("deny-ingress-a", map[string]string{"app": "a"}, []networkingv1.NetworkPolicyIngressRule{}, nil)
+}
+
+// policyAllowBToAOnTCP80 allows ingress to x/a from pods in x with app=b on TCP 80
+func policyAllowBToAOnTCP80() *networkingv1.NetworkPolicy {
+	return verdictPolicy("allow-b-to-a", map[string]string{"app": "a"}, []networkingv1.NetworkPolicyIngressRule{
+		{
+			From: []networkingv1.NetworkPolicyPeer{
+				{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "b"}}},
+			},
+			Ports: policyPorts(corev1.ProtocolTCP, 80),
+		},
+	}, nil)
+}
+
+// policyAllowNsYToA allows ingress to x/a from every pod in namespaces labeled ns=y
+func policyAllowNsYToA() *networkingv1.NetworkPolicy {
+	return verdictPolicy("allow-ns-y-to-a", map[string]string{"app": "a"}, []networkingv1.NetworkPolicyIngressRule{
+		{
+			From: []networkingv1.NetworkPolicyPeer{
+				{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"ns": "y"}}},
+			},
+		},
+	}, nil)
+}
+
+// policyAllowExternalToA allows ingress to x/a from externalIP
+func policyAllowExternalToA() *networkingv1.NetworkPolicy {
+	return verdictPolicy("allow-external-to-a", map[string]string{"app": "a"}, []networkingv1.NetworkPolicyIngressRule{
+		{
+			From: []networkingv1.NetworkPolicyPeer{
+				{IPBlock: &networkingv1.IPBlock{CIDR: externalIP + "/32"}},
+			},
+		},
+	}, nil)
+}
+
+// policyAllowEgressFromAToBOnUDP53 allows egress from x/a to pods in x with app=b on UDP 53
+func policyAllowEgressFromAToBOnUDP53() *networkingv1.NetworkPolicy {
+	return verdictPolicy("allow-a-to-b", map[string]string{"app": "a"}, nil, []networkingv1.NetworkPolicyEgressRule{
+		{
+			To: []networkingv1.NetworkPolicyPeer{
+				{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "b"}}},
+			},
+			Ports: policyPorts(corev1.ProtocolUDP, 53),
+		},
+	})
+}
+
+func verdictTestCases() []*VerdictTestCase {
+	return []*VerdictTestCase{
+		{
+			Description: "no policies allows everything",
+			Steps: []*VerdictStep{
+				{
+					Actions: verdictPods(),
+					Flows: []*Flow{
+						allowedFlow(podXBIP, podXAIP, tcp, 80),
+						allowedFlow(podYCIP, podXAIP, udp, 53),
+						allowedFlow(podXAIP, podYCIP, tcp, 443),
+						allowedFlow(externalIP, podXAIP, tcp, 80),
+					},
+				},
+			},
+		},
+		{
+			Description: "deny-all ingress only drops flows to the selected pod",
+			Steps: []*VerdictStep{
+				{
+					Actions: append(verdictPods(), UpdatePolicy(policyDenyIngressToA())),
+					Flows: []*Flow{
+						droppedFlow(podXBIP, podXAIP, tcp, 80),
+						droppedFlow(podYCIP, podXAIP, udp, 53),
+						droppedFlow(externalIP, podXAIP, tcp, 80),
+						allowedFlow(podXAIP, podXBIP, tcp, 80),
+						allowedFlow(podYCIP, podXBIP, tcp, 80),
+					},
+				},
+			},
+		},
+		{
+			Description: "ingress from a pod selector on a port",
+			Steps: []*VerdictStep{
+				{
+					Actions: append(verdictPods(), UpdatePolicy(policyAllowBToAOnTCP80())),
+					Flows: []*Flow{
+						allowedFlow(podXBIP, podXAIP, tcp, 80),
+						droppedFlow(podXBIP, podXAIP, tcp, 81),
+						droppedFlow(podXBIP, podXAIP, udp, 80),
+						// the pod selector only selects pods in the policy's namespace
+						droppedFlow(podYCIP, podXAIP, tcp, 80),
+						allowedFlow(podXAIP, podXBIP, tcp, 81),
+					},
+				},
+			},
+		},
+		{
+			Description: "ingress from a namespace selector",
+			Steps: []*VerdictStep{
+				{
+					Actions: append(verdictPods(), UpdatePolicy(policyAllowNsYToA())),
+					Flows: []*Flow{
+						allowedFlow(podYCIP, podXAIP, tcp, 80),
+						allowedFlow(podYCIP, podXAIP, udp, 53),
+						droppedFlow(podXBIP, podXAIP, tcp, 80),
+					},
+				},
+			},
+		},
+		{
+			Description: "ingress from an ipBlock",
+			Steps: []*VerdictStep{
+				{
+					Actions: append(verdictPods(), UpdatePolicy(policyAllowExternalToA())),
+					Flows: []*Flow{
+						allowedFlow(externalIP, podXAIP, tcp, 80),
+						droppedFlow("20.0.0.2", podXAIP, tcp, 80),
+						droppedFlow(podXBIP, podXAIP, tcp, 80),
+					},
+				},
+			},
+		},
+		{
+			Description: "egress to a pod selector on a port",
+			Steps: []*VerdictStep{
+				{
+					Actions: append(verdictPods(), UpdatePolicy(policyAllowEgressFromAToBOnUDP53())),
+					Flows: []*Flow{
+						allowedFlow(podXAIP, podXBIP, udp, 53),
+						droppedFlow(podXAIP, podXBIP, tcp, 53),
+						droppedFlow(podXAIP, podYCIP, udp, 53),
+						droppedFlow(podXAIP, externalIP, udp, 53),
+						// egress rules don't affect ingress to the selected pod
+						allowedFlow(podXBIP, podXAIP, tcp, 80),
+					},
+				},
+			},
+		},
+		{
+			Description: "policies are a union of allowed flows",
+			Steps: []*VerdictStep{
+				{
+					Actions: append(verdictPods(),
+						UpdatePolicy(policyDenyIngressToA()),
+						UpdatePolicy(policyAllowBToAOnTCP80()),
+						UpdatePolicy(policyAllowNsYToA()),
+					),
+					Flows: []*Flow{
+						allowedFlow(podXBIP, podXAIP, tcp, 80),
+						droppedFlow(podXBIP, podXAIP, tcp, 81),
+						allowedFlow(podYCIP, podXAIP, tcp, 81),
+						droppedFlow(externalIP, podXAIP, tcp, 80),
+					},
+				},
+			},
+		},
+		{
+			Description: "relabeling pods changes verdicts",
+			Steps: []*VerdictStep{
+				{
+					Actions: append(verdictPods(), UpdatePolicy(policyAllowBToAOnTCP80())),
+					Flows: []*Flow{
+						allowedFlow(podXBIP, podXAIP, tcp, 80),
+					},
+				},
+				{
+					// x/b no longer matches the rule's pod selector
+					Actions: []*Action{
+						UpdatePodLabels("x", "b", podXBIP, thisNode, map[string]string{"app": "b"}, map[string]string{"app": "other"}),
+					},
+					Flows: []*Flow{
+						droppedFlow(podXBIP, podXAIP, tcp, 80),
+					},
+				},
+				{
+					// x/a is no longer selected by the policy
+					Actions: []*Action{
+						UpdatePodLabels("x", "a", podXAIP, thisNode, map[string]string{"app": "a"}, map[string]string{"app": "other"}),
+					},
+					Flows: []*Flow{
+						allowedFlow(podXBIP, podXAIP, tcp, 80),
+						allowedFlow(podYCIP, podXAIP, tcp, 81),
+					},
+				},
+			},
+		},
+		{
+			Description: "deleting a policy restores connectivity",
+			Steps: []*VerdictStep{
+				{
+					Actions: append(verdictPods(), UpdatePolicy(policyDenyIngressToA())),
+					Flows: []*Flow{
+						droppedFlow(podXBIP, podXAIP, tcp, 80),
+					},
+				},
+				{
+					Actions: []*Action{
+						DeletePolicyByObject(policyDenyIngressToA()),
+					},
+					Flows: []*Flow{
+						allowedFlow(podXBIP, podXAIP, tcp, 80),
+						allowedFlow(externalIP, podXAIP, tcp, 80),
+					},
+				},
+			},
+		},
+		{
+			Description: "updating a policy replaces its rules",
+			Steps: []*VerdictStep{
+				{
+					Actions: append(verdictPods(), UpdatePolicy(policyAllowBToAOnTCP80())),
+					Flows: []*Flow{
+						allowedFlow(podXBIP, podXAIP, tcp, 80),
+						droppedFlow(podYCIP, podXAIP, tcp, 80),
+					},
+				},
+				{
+					Actions: []*Action{
+						// same name as policyAllowBToAOnTCP80
+						UpdatePolicy(verdictPolicy("allow-b-to-a", map[string]string{"app": "a"}, policyAllowNsYToA().Spec.Ingress, nil)),
+					},
+					Flows: []*Flow{
+						droppedFlow(podXBIP, podXAIP, tcp, 80),
+						allowedFlow(podYCIP, podXAIP, tcp, 80),
+					},
+				},
+			},
+		},
+		{
+			Description: "deleting a pod's labels removes it from rules",
+			Steps: []*VerdictStep{
+				{
+					Actions: append(verdictPods(),
+						UpdatePolicy(policyAllowNsYToA()),
+						DeletePod("y", "c", podYCIP, map[string]string{"app": "c"}),
+						// a new pod reuses the IP in a namespace which isn't allowed
+						CreatePod("x", "d", podYCIP, thisNode, map[string]string{"app": "d"}),
+					),
+					Flows: []*Flow{
+						droppedFlow(podYCIP, podXAIP, tcp, 80),
+					},
+				},
+			},
+		},
+	}
+}
@@ -60,9 +60,11 @@ type DataPlane struct {
 	applyInBackground  bool
 	netPolInBackground bool
 	policyMgr          *policies.PolicyManager
-	ipsetMgr           *ipsets.IPSetManager
-	networkID          string
-	nodeName           string
+	// policyMgrV6 programs ip6tables and is only set in Linux when IPv6 is enabled
+	policyMgrV6 *policies.PolicyManager
+	ipsetMgr    *ipsets.IPSetManager
+	networkID   string
+	nodeName    string
 	// endpointCache stores all endpoints of the network (including off-node)
 	// Key is PodIP
 	endpointCache              *endpointCache
@@ -83,6 +85,10 @@ func NewDataPlane(nodeName string, ioShim *common.IOShim, cfg *Config, stopChann
 	if util.IsWindowsDP() {
 		klog.Infof("[DataPlane] enabling AddEmptySetToLists for Windows")
 		cfg.IPSetManagerCfg.AddEmptySetToLists = true
+		if cfg.IPSetManagerCfg.EnableIPv6 {
+			klog.Infof("[DataPlane] disabling IPv6 since it is not supported in Windows")
+			cfg.IPSetManagerCfg.EnableIPv6 = false
+		}
 	}
 
 	dp := &DataPlane{
@@ -103,6 +109,13 @@ func NewDataPlane(nodeName string, ioShim *common.IOShim, cfg *Config, stopChann
 		stopChannel: stopChannel,
 	}
 
+	if cfg.IPSetManagerCfg.EnableIPv6 {
+		klog.Infof("[DataPlane] enabling IPv6 policies")
+		ipv6PolicyCfg := *cfg.PolicyManagerCfg
+		ipv6PolicyCfg.IPv6 = true
+		dp.policyMgrV6 = policies.NewPolicyManager(ioShim, &ipv6PolicyCfg)
+	}
+
 	// do not let Linux apply in background
 	dp.applyInBackground = cfg.ApplyInBackground && util.IsWindowsDP()
 	if dp.applyInBackground {
@@ -174,6 +187,9 @@ func (dp *DataPlane) RunPeriodicTasks() {
 				// in Windows, does nothing
 				// in Linux, locks policy manager but can be interrupted
 				dp.policyMgr.Reconcile()
+				if dp.policyMgrV6 != nil {
+					dp.policyMgrV6.Reconcile()
+				}
 			}
 		}
 	}()
@@ -256,6 +272,12 @@ func (dp *DataPlane) AddToSets(setNames []*ipsets.IPSetMetadata, podMetadata *Po
 		return fmt.Errorf("[DataPlane] error while adding to set: %w", err)
 	}
 
+	if dp.EnableIPv6 && podMetadata.PodIPv6 != "" {
+		if err := dp.ipsetMgr.AddToSets(setNames, podMetadata.PodIPv6, podMetadata.PodKey); err != nil {
+			return fmt.Errorf("[DataPlane] error while adding IPv6 address to set: %w", err)
+		}
+	}
+
 	if dp.shouldUpdatePod() && podMetadata.NodeName == dp.nodeName {
 		// TODO: Refactor non-error/warning klogs with Zap and set the following logs to "debug" level
 		// klog.Infof("[DataPlane] Updating Sets to Add for pod key %s", podMetadata.PodKey)
@@ -279,6 +301,12 @@ func (dp *DataPlane) RemoveFromSets(setNames []*ipsets.IPSetMetadata, podMetadat
 		return fmt.Errorf("[DataPlane] error while removing from set: %w", err)
 	}
 
+	if dp.EnableIPv6 && podMetadata.PodIPv6 != "" {
+		if err := dp.ipsetMgr.RemoveFromSets(setNames, podMetadata.PodIPv6, podMetadata.PodKey); err != nil {
+			return fmt.Errorf("[DataPlane] error while removing IPv6 address from set: %w", err)
+		}
+	}
+
 	if dp.shouldUpdatePod() && podMetadata.NodeName == dp.nodeName {
 		// TODO: Refactor non-error/warning klogs with Zap and set the following logs to "debug" level
 		// klog.Infof("[DataPlane] Updating Sets to Remove for pod key %s", podMetadata.PodKey)
@@ -589,6 +617,13 @@ func (dp *DataPlane) addPolicies(netPols []*policies.NPMNetworkPolicy) error {
 		return fmt.Errorf("[DataPlane] [%s] error while adding policies: %w", contextAddNetPolBootup, err)
 	}
 
+	if dp.policyMgrV6 != nil {
+		err = dp.policyMgrV6.AddPolicies(netPols, endpointList)
+		if err != nil {
+			return fmt.Errorf("[DataPlane] [%s] error while adding IPv6 policies: %w", contextAddNetPolBootup, err)
+		}
+	}
+
 	return nil
 }
 
@@ -626,6 +661,13 @@ func (dp *DataPlane) RemovePolicy(policyKey string) error {
 		return fmt.Errorf("[DataPlane] error while removing policy: %w", err)
 	}
 
+	if dp.policyMgrV6 != nil {
+		err = dp.policyMgrV6.RemovePolicy(policy.PolicyKey)
+		if err != nil {
+			return fmt.Errorf("[DataPlane] error while removing IPv6 policy: %w", err)
+		}
+	}
+
 	if dp.shouldUpdatePod() {
 
 		dp.endpointCache.Lock()
@@ -700,6 +742,17 @@ func (dp *DataPlane) GetAllIPSets() map[string]string {
 	return dp.ipsetMgr.GetAllIPSets()
 }
 
+// GetPolicyByHash returns the policy whose key has the hash. The verdict log collector uses it to resolve NFLOG prefixes.
+func (dp *DataPlane) GetPolicyByHash(policyHash string) (*policies.NPMNetworkPolicy, bool) {
+	return dp.policyMgr.GetPolicyByHash(policyHash)
+}
+
+// GetPolicyByVerdictLogID returns the NetworkPolicy whose verdict log ID is in the mark of the packets it drops.
+// The verdict log collector uses it to resolve the packets logged by the final drop rules.
+func (dp *DataPlane) GetPolicyByVerdictLogID(id uint32) (*policies.NPMNetworkPolicy, bool) {
+	return dp.policyMgr.GetPolicyByVerdictLogID(id)
+}
+
 // GetAllPolicies is deprecated and only used in the goalstateprocessor, which is deprecated
 func (dp *DataPlane) GetAllPolicies() []string {
 	return nil
@@ -727,6 +780,9 @@ func (dp *DataPlane) createIPSetsAndReferences(sets []*ipsets.TranslatedIPSet, n
 			// ipblock can have either cidr (CIDR in IPBlock) or "cidr + " " (space) + nomatch" (Except in IPBlock)
 			// (TODO) need to revise it for windows
 			for _, ipblock := range set.Members {
+				if dp.skipIPBlockMember(ipblock) {
+					continue
+				}
 				err := dp.ipsetMgr.AddToSets([]*ipsets.IPSetMetadata{set.Metadata}, ipblock, "")
 				if err != nil {
 					return npmerrors.Errorf(npmErrorString, false, fmt.Sprintf("[DataPlane] failed to AddToSet in addIPSetReferences with err: %s", err.Error()))
@@ -769,6 +825,9 @@ func (dp *DataPlane) deleteIPSetsAndReferences(sets []*ipsets.TranslatedIPSet, n
 			// ipblock can have either cidr (CIDR in IPBlock) or "cidr + " " (space) + nomatch" (Except in IPBlock)
 			// (TODO) need to revise it for windows
 			for _, ipblock := range set.Members {
+				if dp.skipIPBlockMember(ipblock) {
+					continue
+				}
 				err := dp.ipsetMgr.RemoveFromSets([]*ipsets.IPSetMetadata{set.Metadata}, ipblock, "")
 				if err != nil {
 					return npmerrors.Errorf(npmErrorString, false, fmt.Sprintf("[DataPlane] failed to RemoveFromSet in deleteIPSetReferences with err: %s", err.Error()))
@@ -790,6 +849,12 @@ func (dp *DataPlane) deleteIPSetsAndReferences(sets []*ipsets.TranslatedIPSet, n
 	return nil
 }
 
+// skipIPBlockMember returns true for IPv6 ipBlock members when IPv6 is disabled.
+// Linux translates IPv6 ipBlocks, but there are no inet6 sets to hold them unless IPv6 is enabled.
+func (dp *DataPlane) skipIPBlockMember(member string) bool {
+	return !dp.EnableIPv6 && util.IsIPV6(strings.Split(member, " ")[0])
+}
+
 func (dp *DataPlane) setRemovePolicyFailure(failed bool) {
 	if util.IsWindowsDP() {
 		return
@@ -24,6 +24,12 @@ func (dp *DataPlane) bootupDataPlane() error {
 	if err := dp.policyMgr.Bootup(nil); err != nil {
 		return npmerrors.ErrorWrapper(npmerrors.BootupDataplane, false, "failed to reset policy dataplane", err)
 	}
+	// must boot up after the IPv4 PolicyManager, which detects the iptables version
+	if dp.policyMgrV6 != nil {
+		if err := dp.policyMgrV6.Bootup(nil); err != nil {
+			return npmerrors.ErrorWrapper(npmerrors.BootupDataplane, false, "failed to reset IPv6 policy dataplane", err)
+		}
+	}
 	if err := dp.ipsetMgr.ResetIPSets(); err != nil {
 		return npmerrors.ErrorWrapper(npmerrors.BootupDataplane, false, "failed to reset ipsets dataplane", err)
 	}
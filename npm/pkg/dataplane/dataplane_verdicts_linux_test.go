@@ -0,0 +1,38 @@
+package dataplane
+
+import (
+	"testing"
+
+	dptestutils "github.com/Azure/azure-container-networking/npm/pkg/dataplane/testutils"
+	"github.com/stretchr/testify/require"
+)
+
+// verdictHarness runs a DataPlane against a fake kernel and asks the kernel for verdicts.
+type verdictHarness struct {
+	kernel *dptestutils.FakeKernel
+	dp     *DataPlane
+	stopCh chan struct{}
+}
+
+func newVerdictHarness(t *testing.T) *verdictHarness {
+	kernel := dptestutils.NewFakeKernel()
+	stopCh := make(chan struct{}, 1)
+	dp, err := NewDataPlane(thisNode, kernel.IOShim(), dpCfg, stopCh)
+	require.NoError(t, err, "failed to initialize dp")
+	require.NotNil(t, dp, "failed to initialize dp (nil)")
+	return &verdictHarness{kernel: kernel, dp: dp, stopCh: stopCh}
+}
+
+func (h *verdictHarness) run(t *testing.T, a *Action) {
+	require.NoError(t, a.DPAction.Do(h.dp), "failed to run action %+v", a.DPAction)
+}
+
+func (h *verdictHarness) allowed(t *testing.T, f *Flow) bool {
+	allowed, err := h.kernel.Allowed(f.SrcIP, f.DstIP, f.Protocol, f.DstPort)
+	require.NoError(t, err, "failed to evaluate flow %+v", f)
+	return allowed
+}
+
+func (h *verdictHarness) stop() {
+	h.stopCh <- struct{}{}
+}
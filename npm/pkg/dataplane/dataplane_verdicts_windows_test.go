@@ -0,0 +1,218 @@
+package dataplane
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/network/hnswrapper"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
+	dptestutils "github.com/Azure/azure-container-networking/npm/pkg/dataplane/testutils"
+	"github.com/Microsoft/hcsshim/hcn"
+	"github.com/stretchr/testify/require"
+)
+
+var verdictProtocolNumbers = map[string]string{
+	tcp:    "6",
+	udp:    "17",
+	"SCTP": "132",
+}
+
+// verdictHarness runs a DataPlane against fake HNS and evaluates the ACLs of the source and destination endpoints.
+// Since every pod is on this node, the harness creates an endpoint for each pod created on this node,
+// and it deletes the endpoint of a deleted pod.
+type verdictHarness struct {
+	hns    *hnswrapper.Hnsv2wrapperFake
+	dp     *DataPlane
+	stopCh chan struct{}
+	// endpoints maps a pod IP to its endpoint ID
+	endpoints map[string]string
+}
+
+func newVerdictHarness(t *testing.T) *verdictHarness {
+	hns := ipsets.GetHNSFake(t, defaultWindowsDPCfg.NetworkName)
+	stopCh := make(chan struct{}, 1)
+	dp, err := NewDataPlane(thisNode, common.NewMockIOShimWithFakeHNS(hns), defaultWindowsDPCfg, stopCh)
+	require.NoError(t, err, "failed to initialize dp")
+	require.NotNil(t, dp, "failed to initialize dp (nil)")
+	return &verdictHarness{hns: hns, dp: dp, stopCh: stopCh, endpoints: make(map[string]string)}
+}
+
+func (h *verdictHarness) run(t *testing.T, a *Action) {
+	if a.HNSAction != nil {
+		require.NoError(t, a.HNSAction.Do(h.hns), "failed to run action %+v", a.HNSAction)
+		return
+	}
+
+	if create, ok := a.DPAction.(*PodCreateAction); ok && create.Pod.NodeName == thisNode {
+		// a new pod may reuse the IP of a deleted pod
+		h.deleteEndpoint(t, create.Pod.PodIP)
+		epID := strings.ReplaceAll(create.Pod.PodKey, "/", "-")
+		_, err := h.hns.CreateEndpoint(dptestutils.Endpoint(epID, create.Pod.PodIP))
+		require.NoError(t, err, "failed to create endpoint for pod %s", create.Pod.PodKey)
+		h.endpoints[create.Pod.PodIP] = epID
+	}
+
+	require.NoError(t, a.DPAction.Do(h.dp), "failed to run action %+v", a.DPAction)
+
+	if del, ok := a.DPAction.(*PodDeleteAction); ok {
+		h.deleteEndpoint(t, del.Pod.PodIP)
+	}
+}
+
+func (h *verdictHarness) deleteEndpoint(t *testing.T, ip string) {
+	epID, ok := h.endpoints[ip]
+	if !ok {
+		return
+	}
+	require.NoError(t, DeleteEndpoint(epID).HNSAction.Do(h.hns), "failed to delete endpoint %s", epID)
+	delete(h.endpoints, ip)
+}
+
+// allowed is true if the Out ACLs of the source endpoint and the In ACLs of the destination endpoint allow the flow.
+// IPs without an endpoint on this node have no ACLs.
+func (h *verdictHarness) allowed(t *testing.T, f *Flow) bool {
+	protocol, ok := verdictProtocolNumbers[f.Protocol]
+	require.True(t, ok, "unsupported protocol %s", f.Protocol)
+
+	endpoints := h.hns.Cache.GetEndpoints()
+	if epID, ok := h.endpoints[f.SrcIP]; ok && !h.aclsAllow(t, endpoints[epID].Policies, hcn.DirectionTypeOut, f, protocol) {
+		return false
+	}
+	if epID, ok := h.endpoints[f.DstIP]; ok && !h.aclsAllow(t, endpoints[epID].Policies, hcn.DirectionTypeIn, f, protocol) {
+		return false
+	}
+	return true
+}
+
+// aclsAllow evaluates ACLs in order of priority. The first matching ACL wins and the default is to allow.
+// At equal priorities, Block ACLs win.
+func (h *verdictHarness) aclsAllow(t *testing.T, acls []*hnswrapper.FakeEndpointPolicy, direction hcn.DirectionType, f *Flow, protocol string) bool {
+	sorted := make([]*hnswrapper.FakeEndpointPolicy, 0, len(acls))
+	for _, acl := range acls {
+		if acl.Direction == direction {
+			sorted = append(sorted, acl)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Priority != sorted[j].Priority {
+			return sorted[i].Priority < sorted[j].Priority
+		}
+		return sorted[i].Action == hcn.ActionTypeBlock && sorted[j].Action != hcn.ActionTypeBlock
+	})
+
+	for _, acl := range sorted {
+		if h.aclMatches(t, acl, f, protocol) {
+			return acl.Action == hcn.ActionTypeAllow
+		}
+	}
+	return true
+}
+
+func (h *verdictHarness) aclMatches(t *testing.T, acl *hnswrapper.FakeEndpointPolicy, f *Flow, protocol string) bool {
+	if acl.Protocols != "" && acl.Protocols != protocol {
+		return false
+	}
+
+	// see the mapping of HNS fields in policies.NPMACLPolSettings
+	dstPorts, srcPorts := acl.LocalPorts, acl.RemotePorts
+	if acl.Direction == hcn.DirectionTypeOut {
+		dstPorts, srcPorts = acl.RemotePorts, acl.LocalPorts
+	}
+	if srcPorts != "" {
+		// the source port is ephemeral
+		return false
+	}
+	if dstPorts != "" && !containsPort(t, dstPorts, f.DstPort) {
+		return false
+	}
+
+	if isDirectIPList(acl.RemoteAddresses) {
+		// direct IPs are the source for ingress and the destination for egress
+		peerIP := f.SrcIP
+		if acl.Direction == hcn.DirectionTypeOut {
+			peerIP = f.DstIP
+		}
+		return h.inAll(t, acl.RemoteAddresses, peerIP)
+	}
+	return h.inAll(t, acl.LocalAddresses, f.SrcIP) && h.inAll(t, acl.RemoteAddresses, f.DstIP)
+}
+
+// inAll is true if the IP is in every set or CIDR in the comma-separated list.
+// Multiple sets intersect like the set matches of a single iptables rule.
+func (h *verdictHarness) inAll(t *testing.T, addresses, ip string) bool {
+	if addresses == "" {
+		return true
+	}
+	for _, address := range strings.Split(addresses, ",") {
+		if isDirectIPList(address) {
+			if !cidrContains(t, address, ip) {
+				return false
+			}
+			continue
+		}
+		if !h.inSet(t, address, ip, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *verdictHarness) inSet(t *testing.T, setID, ip string, depth int) bool {
+	require.Less(t, depth, 2, "SetPolicies can only be nested once")
+	setPolicy := h.hns.Cache.SetPolicy(setID)
+	require.NotNil(t, setPolicy, "ACL references a SetPolicy which doesn't exist: %s", setID)
+	if setPolicy.Values == "" {
+		return false
+	}
+	for _, member := range strings.Split(setPolicy.Values, ",") {
+		switch setPolicy.Type {
+		case hcn.SetPolicyTypeNestedIpSet:
+			if h.inSet(t, member, ip, depth+1) {
+				return true
+			}
+		case hcn.SetPolicyTypeIpSet:
+			if cidrContains(t, member, ip) {
+				return true
+			}
+		default:
+			require.FailNow(t, fmt.Sprintf("unknown SetPolicy type %s for set %s", setPolicy.Type, setID))
+		}
+	}
+	return false
+}
+
+// isDirectIPList is true if the addresses are IPs or CIDRs instead of SetPolicy IDs.
+func isDirectIPList(addresses string) bool {
+	first, _, _ := strings.Cut(addresses, ",")
+	first, _, _ = strings.Cut(first, "/")
+	return net.ParseIP(first) != nil
+}
+
+func cidrContains(t *testing.T, cidr, ip string) bool {
+	if !strings.Contains(cidr, "/") {
+		return cidr == ip
+	}
+	_, ipNet, err := net.ParseCIDR(cidr)
+	require.NoError(t, err, "invalid CIDR %s", cidr)
+	return ipNet.Contains(net.ParseIP(ip))
+}
+
+func containsPort(t *testing.T, ports string, port int) bool {
+	for _, p := range strings.Split(ports, ",") {
+		n, err := strconv.Atoi(p)
+		require.NoError(t, err, "invalid port %s", p)
+		if n == port {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *verdictHarness) stop() {
+	h.stopCh <- struct{}{}
+}
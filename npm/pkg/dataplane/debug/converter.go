@@ -237,12 +237,24 @@ func (c *Converter) GetProtobufRulesFromIptableFile(
 
 // GetProtobufRulesFromIptable returns a list of protobuf rules from node.
 func (c *Converter) GetProtobufRulesFromIptable(tableName string) (map[*pb.RuleResponse]struct{}, error) {
+	return c.getProtobufRulesFromNode(tableName, parse.Iptables)
+}
+
+// GetProtobufRulesFromIp6table returns a list of protobuf rules from the node's ip6tables.
+func (c *Converter) GetProtobufRulesFromIp6table(tableName string) (map[*pb.RuleResponse]struct{}, error) {
+	return c.getProtobufRulesFromNode(tableName, parse.Ip6tables)
+}
+
+func (c *Converter) getProtobufRulesFromNode(
+	tableName string,
+	parseTable func(tableName string) (*NPMIPtable.Table, error),
+) (map[*pb.RuleResponse]struct{}, error) {
 	err := c.InitConverter()
 	if err != nil {
 		return nil, fmt.Errorf("error occurred during getting protobuf rules from iptables : %w", err)
 	}
 
-	ipTable, err := parse.Iptables(tableName)
+	ipTable, err := parseTable(tableName)
 	if err != nil {
 		return nil, fmt.Errorf("error occurred during parsing iptables : %w", err)
 	}
@@ -434,6 +446,10 @@ func (c *Converter) getSetTypeV2(name string) (pb.SetType, ipsets.SetKind) {
 	case strings.HasPrefix(name, util.NestedLabelPrefix):
 		settype = pb.SetType_NESTEDLABELOFPOD
 		setmetadata.Type = ipsets.NestedLabelOfPod
+	case strings.HasPrefix(name, util.FQDNPrefix):
+		// FQDN sets hold IPs like CIDR sets, and the debug protos have no FQDN type
+		settype = pb.SetType_CIDRBLOCKS
+		setmetadata.Type = ipsets.FQDN
 	default:
 		log.Printf("set [%s] unknown settype", name)
 		settype = pb.SetType_UNKNOWN
@@ -506,6 +522,8 @@ func (c *Converter) populateSetInfo(setInfo *pb.RuleResponse_SetInfo, values []s
 	ipsetHashedName := values[0]
 	ipsetOrigin := values[1]
 	setInfo.HashedSetName = ipsetHashedName
+	// inet6 sets share the name of the set they are paired with
+	ipsetHashedName = ipsets.IPv4SetName(ipsetHashedName)
 
 	if c.EnableV2NPM {
 		setInfo.Name = c.SetMap[ipsetHashedName]
@@ -89,7 +89,13 @@ func PrettyPrintTuples(tuples []*TupleAndRule, srcList map[string]*pb.RuleRespon
 // returns a list of hit rules between the source and the destination in
 // JSON format and a list of tuples from those rules.
 func (c *Converter) GetNetworkTuple(src, dst *common.Input, config *npmconfig.Config) ([][]byte, []*TupleAndRule, map[string]*pb.RuleResponse_SetInfo, map[string]*pb.RuleResponse_SetInfo, error) { //nolint: gocritic,lll
-	allRules, err := c.GetProtobufRulesFromIptable("filter")
+	var allRules map[*pb.RuleResponse]struct{}
+	var err error
+	if isIPv6Input(src) || isIPv6Input(dst) {
+		allRules, err = c.GetProtobufRulesFromIp6table("filter")
+	} else {
+		allRules, err = c.GetProtobufRulesFromIptable("filter")
+	}
 	if err != nil {
 		return nil, nil, nil, nil, fmt.Errorf("error occurred during get network tuple : %w", err)
 	}
@@ -432,14 +438,14 @@ func matchCIDRBLOCKS(pod *common.NpmPod, setInfo *pb.RuleResponse_SetInfo) bool
 		entrySplitted := strings.Split(entry, " ")
 		if len(entrySplitted) > 1 { // nomatch condition. i.e [172.17.1.0/24 nomatch]
 			_, ipnet, _ := net.ParseCIDR(strings.TrimSpace(entrySplitted[0]))
-			podIP := net.ParseIP(pod.PodIP)
+			podIP := podIPForCIDR(pod, ipnet)
 			if ipnet.Contains(podIP) {
 				matched = false
 				break
 			}
 		} else {
 			_, ipnet, _ := net.ParseCIDR(strings.TrimSpace(entrySplitted[0]))
-			podIP := net.ParseIP(pod.PodIP)
+			podIP := podIPForCIDR(pod, ipnet)
 			if ipnet.Contains(podIP) {
 				matched = true
 			}
@@ -449,6 +455,19 @@ func matchCIDRBLOCKS(pod *common.NpmPod, setInfo *pb.RuleResponse_SetInfo) bool
 	return matched
 }
 
+// podIPForCIDR returns the pod IP of the same family as the CIDR.
+func podIPForCIDR(pod *common.NpmPod, ipnet *net.IPNet) net.IP {
+	if ipnet != nil && ipnet.IP.To4() == nil {
+		return net.ParseIP(pod.PodIPv6)
+	}
+	return net.ParseIP(pod.PodIP)
+}
+
+// isIPv6Input returns true if the input is an IPv6 address, in which case rules are read from ip6tables.
+func isIPv6Input(input *common.Input) bool {
+	return input.Type == common.IPADDRS && util.IsIPV6(input.Content)
+}
+
 func processKeyValueLabelOfNameSpace(kv string) (string, string) {
 	str := strings.TrimPrefix(kv, util.NamespacePrefix)
 	ret := strings.Split(str, ":")
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	common "github.com/Azure/azure-container-networking/npm/pkg/controlplane/controllers/common"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/pb"
 	"github.com/Azure/azure-container-networking/npm/util"
 	"github.com/stretchr/testify/require"
 )
@@ -149,3 +150,30 @@ func TestGetNetworkTuple(t *testing.T) {
 		})
 	}
 }
+
+func TestMatchCIDRBlocksDualStack(t *testing.T) {
+	pod := &common.NpmPod{PodIP: "10.0.0.5", PodIPv6: "2001:db8::5"}
+	tests := map[string]struct {
+		contents []string
+		expected bool
+	}{
+		"ipv4 cidr":             {contents: []string{"10.0.0.0/24"}, expected: true},
+		"ipv6 cidr":             {contents: []string{"2001:db8::/64"}, expected: true},
+		"ipv6 cidr with except": {contents: []string{"2001:db8::/64", "2001:db8::/120 nomatch"}, expected: false},
+		"other ipv6 cidr":       {contents: []string{"2001:db9::/64"}, expected: false},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			setInfo := &pb.RuleResponse_SetInfo{Contents: test.contents}
+			require.Equal(t, test.expected, matchCIDRBLOCKS(pod, setInfo))
+		})
+	}
+}
+
+func TestIsIPv6Input(t *testing.T) {
+	require.True(t, isIPv6Input(&common.Input{Content: "2001:db8::5", Type: common.IPADDRS}))
+	require.False(t, isIPv6Input(&common.Input{Content: "10.0.0.5", Type: common.IPADDRS}))
+	require.False(t, isIPv6Input(&common.Input{Content: "x/a", Type: common.NSPODNAME}))
+}
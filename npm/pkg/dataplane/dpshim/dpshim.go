@@ -25,22 +25,27 @@ var ErrChannelUnset = errors.New("channel must be set")
 // to have a common interface for both.
 
 type DPShim struct {
-	OutChannel  chan *protos.Events
-	stopChannel <-chan struct{}
-	setCache    map[string]*controlplane.ControllerIPSets
-	policyCache map[string]*policies.NPMNetworkPolicy
-	dirtyCache  *dirtyCache
-	mu          *sync.Mutex
+	OutChannel chan *protos.Events
+	// NodeOutChannel has the events for each node when node filtering is enabled
+	NodeOutChannel chan *NodeEvents
+	stopChannel    <-chan struct{}
+	setCache       map[string]*controlplane.ControllerIPSets
+	policyCache    map[string]*policies.NPMNetworkPolicy
+	dirtyCache     *dirtyCache
+	// nodes is nil unless node filtering is enabled
+	nodes map[string]*nodeState
+	mu    *sync.Mutex
 }
 
 func NewDPSim(stopChannel <-chan struct{}) (*DPShim, error) {
 	return &DPShim{
-		OutChannel:  make(chan *protos.Events),
-		setCache:    make(map[string]*controlplane.ControllerIPSets),
-		policyCache: make(map[string]*policies.NPMNetworkPolicy),
-		stopChannel: stopChannel,
-		dirtyCache:  newDirtyCache(),
-		mu:          &sync.Mutex{},
+		OutChannel:     make(chan *protos.Events),
+		NodeOutChannel: make(chan *NodeEvents),
+		setCache:       make(map[string]*controlplane.ControllerIPSets),
+		policyCache:    make(map[string]*policies.NPMNetworkPolicy),
+		stopChannel:    stopChannel,
+		dirtyCache:     newDirtyCache(),
+		mu:             &sync.Mutex{},
 	}, nil
 }
 
@@ -406,6 +411,10 @@ func (dp *DPShim) ApplyDataPlane() error {
 
 	dp.dirtyCache.printContents()
 
+	if dp.nodeFilteringEnabled() {
+		return dp.applyNodeEvents()
+	}
+
 	goalStates := make(map[string]*protos.GoalState)
 
 	toApplySets, err := dp.processIPSetsApply()
@@ -456,6 +465,25 @@ func (dp *DPShim) ApplyDataPlane() error {
 	return nil
 }
 
+func (dp *DPShim) applyNodeEvents() error {
+	events, err := dp.nodeEvents()
+	if err != nil {
+		return err
+	}
+	dp.dirtyCache.clearCache()
+	if len(events) == 0 {
+		klog.Info("ApplyDataPlane: No changes to apply to any node")
+		return nil
+	}
+
+	go func() {
+		for _, event := range events {
+			dp.NodeOutChannel <- event
+		}
+	}()
+	return nil
+}
+
 func (dp *DPShim) GetAllIPSets() map[string]string {
 	return nil
 }
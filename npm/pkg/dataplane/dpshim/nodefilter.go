@@ -0,0 +1,323 @@
+package dpshim
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Azure/azure-container-networking/npm/pkg/controlplane"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
+	"github.com/Azure/azure-container-networking/npm/pkg/protos"
+	npmerrors "github.com/Azure/azure-container-networking/npm/util/errors"
+	"k8s.io/klog"
+)
+
+// NodeEvents are events for the daemons of one node.
+type NodeEvents struct {
+	NodeName string
+	Events   *protos.Events
+}
+
+// nodeState is the goal state which was last sent to the daemons of a node.
+type nodeState struct {
+	sets     map[string]struct{}
+	policies map[string]struct{}
+}
+
+func newNodeState() *nodeState {
+	return &nodeState{
+		sets:     make(map[string]struct{}),
+		policies: make(map[string]struct{}),
+	}
+}
+
+// EnableNodeFiltering makes the DPShim send each node only the policies which select pods on the node,
+// and the sets which those policies use. Events are sent on NodeOutChannel instead of OutChannel.
+func (dp *DPShim) EnableNodeFiltering() {
+	dp.lock()
+	defer dp.unlock()
+	dp.nodes = make(map[string]*nodeState)
+}
+
+func (dp *DPShim) nodeFilteringEnabled() bool {
+	return dp.nodes != nil
+}
+
+// HydrateNode returns the hydration event for a daemon on the node.
+// With node filtering, the node's goal state is tracked until ForgetNode so that later events only carry its changes.
+func (dp *DPShim) HydrateNode(nodeName string) (*protos.Events, error) {
+	if !dp.nodeFilteringEnabled() {
+		return dp.HydrateClients()
+	}
+
+	dp.lock()
+	defer dp.unlock()
+
+	selectedNodes := dp.selectedNodesOfPolicies()
+	state := newNodeState()
+	state.sets, state.policies = dp.nodeGoalState(nodeName, selectedNodes)
+	dp.nodes[nodeName] = state
+
+	if len(state.sets) == 0 && len(state.policies) == 0 {
+		klog.Infof("HydrateNode: No objects to hydrate daemon client on node %s", nodeName)
+		return nil, nil
+	}
+
+	goalStates := make(map[string]*protos.GoalState)
+	if err := dp.addSetsApply(goalStates, sortedKeys(state.sets)); err != nil {
+		return nil, err
+	}
+	if err := dp.addPoliciesApply(goalStates, sortedKeys(state.policies)); err != nil {
+		return nil, err
+	}
+	return &protos.Events{
+		EventType: protos.Events_Hydration,
+		Payload:   goalStates,
+	}, nil
+}
+
+// ForgetNode stops tracking the goal state of a node once none of its daemons are connected.
+func (dp *DPShim) ForgetNode(nodeName string) {
+	dp.lock()
+	defer dp.unlock()
+	if dp.nodeFilteringEnabled() {
+		delete(dp.nodes, nodeName)
+	}
+}
+
+// nodeEvents returns the changes to the goal state of every tracked node, and records them as sent.
+// Sets and policies are sent if they are new to the node or were modified, and removed once they are no longer relevant.
+func (dp *DPShim) nodeEvents() ([]*NodeEvents, error) {
+	selectedNodes := dp.selectedNodesOfPolicies()
+	nodeNames := make([]string, 0, len(dp.nodes))
+	for nodeName := range dp.nodes {
+		nodeNames = append(nodeNames, nodeName)
+	}
+	sort.Strings(nodeNames)
+
+	events := make([]*NodeEvents, 0, len(nodeNames))
+	for _, nodeName := range nodeNames {
+		state := dp.nodes[nodeName]
+		sets, netPols := dp.nodeGoalState(nodeName, selectedNodes)
+
+		goalStates := make(map[string]*protos.GoalState)
+		if err := dp.addSetsApply(goalStates, changed(sets, state.sets, dp.dirtyCache.toAddorUpdateSets)); err != nil {
+			return nil, err
+		}
+		if err := addRemove(goalStates, controlplane.IpsetRemove, removed(sets, state.sets)); err != nil {
+			return nil, err
+		}
+		if err := dp.addPoliciesApply(goalStates, changed(netPols, state.policies, dp.dirtyCache.toAddorUpdatePolicies)); err != nil {
+			return nil, err
+		}
+		if err := addRemove(goalStates, controlplane.PolicyRemove, removed(netPols, state.policies)); err != nil {
+			return nil, err
+		}
+
+		state.sets, state.policies = sets, netPols
+		if len(goalStates) == 0 {
+			continue
+		}
+		events = append(events, &NodeEvents{
+			NodeName: nodeName,
+			Events: &protos.Events{
+				EventType: protos.Events_GoalState,
+				Payload:   goalStates,
+			},
+		})
+	}
+	return events, nil
+}
+
+// nodeGoalState returns the sets and policies which a node needs.
+// selectedNodes maps policy keys to the nodes with selected pods, where nil means every node.
+func (dp *DPShim) nodeGoalState(nodeName string, selectedNodes map[string]map[string]struct{}) (sets, netPols map[string]struct{}) {
+	sets = make(map[string]struct{})
+	netPols = make(map[string]struct{})
+	for policyKey, netPol := range dp.policyCache {
+		if nodes := selectedNodes[policyKey]; nodes != nil {
+			if _, ok := nodes[nodeName]; !ok {
+				continue
+			}
+		}
+		netPols[policyKey] = struct{}{}
+
+		for _, translatedSets := range [][]*ipsets.TranslatedIPSet{netPol.PodSelectorIPSets, netPol.RuleIPSets} {
+			for _, translatedSet := range translatedSets {
+				setName := translatedSet.Metadata.GetPrefixName()
+				set, ok := dp.setCache[setName]
+				if !ok {
+					continue
+				}
+				sets[setName] = struct{}{}
+				for memberName := range set.MemberIPSets {
+					if _, ok := dp.setCache[memberName]; ok {
+						sets[memberName] = struct{}{}
+					}
+				}
+			}
+		}
+	}
+	return sets, netPols
+}
+
+// selectedNodesOfPolicies returns the nodes with pods which each policy selects.
+func (dp *DPShim) selectedNodesOfPolicies() map[string]map[string]struct{} {
+	selectedNodes := make(map[string]map[string]struct{}, len(dp.policyCache))
+	for policyKey, netPol := range dp.policyCache {
+		selectedNodes[policyKey] = dp.selectedNodes(netPol)
+	}
+	return selectedNodes
+}
+
+// selectedNodes returns the nodes of the pods in every included set and no excluded set of the pod selector.
+// It returns nil, meaning every node, if the selector has no included set or a selected pod has no node.
+func (dp *DPShim) selectedNodes(netPol *policies.NPMNetworkPolicy) map[string]struct{} {
+	var included, excluded []map[string]string
+	for i := range netPol.PodSelectorList {
+		setInfo := &netPol.PodSelectorList[i]
+		members := dp.memberNodes(setInfo.IPSet.GetPrefixName())
+		if setInfo.Included {
+			included = append(included, members)
+		} else {
+			excluded = append(excluded, members)
+		}
+	}
+	if len(included) == 0 {
+		return nil
+	}
+
+	nodes := make(map[string]struct{})
+	for ip, nodeName := range included[0] {
+		if !inAll(ip, included[1:]) || inAny(ip, excluded) {
+			continue
+		}
+		if nodeName == "" {
+			return nil
+		}
+		nodes[nodeName] = struct{}{}
+	}
+	return nodes
+}
+
+// memberNodes maps the IPs in a set, or in the members of a list, to the nodes of their pods.
+func (dp *DPShim) memberNodes(setName string) map[string]string {
+	members := make(map[string]string)
+	set, ok := dp.setCache[setName]
+	if !ok {
+		return members
+	}
+	sets := []*controlplane.ControllerIPSets{set}
+	for memberName := range set.MemberIPSets {
+		if member, ok := dp.setCache[memberName]; ok {
+			sets = append(sets, member)
+		}
+	}
+	for _, s := range sets {
+		for ip, podMetadata := range s.IPPodMetadata {
+			if podMetadata == nil {
+				members[ip] = ""
+				continue
+			}
+			members[ip] = podMetadata.NodeName
+		}
+	}
+	return members
+}
+
+func inAll(ip string, sets []map[string]string) bool {
+	for _, set := range sets {
+		if _, ok := set[ip]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func inAny(ip string, sets []map[string]string) bool {
+	for _, set := range sets {
+		if _, ok := set[ip]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// changed returns the desired names which weren't sent or are dirty.
+func changed(desired, sent, dirty map[string]struct{}) []string {
+	names := make([]string, 0)
+	for name := range desired {
+		_, wasSent := sent[name]
+		_, isDirty := dirty[name]
+		if !wasSent || isDirty {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// removed returns the sent names which are no longer desired.
+func removed(desired, sent map[string]struct{}) []string {
+	names := make([]string, 0)
+	for name := range sent {
+		if _, ok := desired[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (dp *DPShim) addSetsApply(goalStates map[string]*protos.GoalState, setNames []string) error {
+	if len(setNames) == 0 {
+		return nil
+	}
+	toApplySets := make([]*controlplane.ControllerIPSets, 0, len(setNames))
+	for _, setName := range setNames {
+		toApplySets = append(toApplySets, dp.setCache[setName])
+	}
+	payload, err := controlplane.EncodeControllerIPSets(toApplySets)
+	if err != nil {
+		return npmerrors.ErrorWrapper(npmerrors.AppendIPSet, false, "addSetsApply: failed to encode sets", err)
+	}
+	goalStates[controlplane.IpsetApply] = getGoalStateFromBuffer(payload)
+	return nil
+}
+
+func (dp *DPShim) addPoliciesApply(goalStates map[string]*protos.GoalState, policyKeys []string) error {
+	if len(policyKeys) == 0 {
+		return nil
+	}
+	toApplyPolicies := make([]*policies.NPMNetworkPolicy, 0, len(policyKeys))
+	for _, policyKey := range policyKeys {
+		toApplyPolicies = append(toApplyPolicies, dp.policyCache[policyKey])
+	}
+	payload, err := controlplane.EncodeNPMNetworkPolicies(toApplyPolicies)
+	if err != nil {
+		return npmerrors.ErrorWrapper(npmerrors.AddPolicy, false, "addPoliciesApply: failed to encode policies", err)
+	}
+	goalStates[controlplane.PolicyApply] = getGoalStateFromBuffer(payload)
+	return nil
+}
+
+func addRemove(goalStates map[string]*protos.GoalState, key string, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	payload, err := controlplane.EncodeStrings(names)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+	goalStates[key] = getGoalStateFromBuffer(payload)
+	return nil
+}
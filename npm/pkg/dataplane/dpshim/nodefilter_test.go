@@ -0,0 +1,168 @@
+package dpshim
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/npm/pkg/controlplane"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
+	"github.com/Azure/azure-container-networking/npm/pkg/protos"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	filterNSSet   = ipsets.NewIPSetMetadata("shop", ipsets.Namespace)
+	filterWebSet  = ipsets.NewIPSetMetadata("app:web", ipsets.KeyValueLabelOfPod)
+	filterDBSet   = ipsets.NewIPSetMetadata("app:db", ipsets.KeyValueLabelOfPod)
+	filterCIDRSet = ipsets.NewIPSetMetadata("web-egress-cidr", ipsets.CIDRBlocks)
+)
+
+func filterPolicy(name string, selector *ipsets.IPSetMetadata, ruleSets ...*ipsets.IPSetMetadata) *policies.NPMNetworkPolicy {
+	netPol := policies.NewNPMNetworkPolicy(name, "shop")
+	netPol.PodSelectorIPSets = []*ipsets.TranslatedIPSet{{Metadata: filterNSSet}, {Metadata: selector}}
+	netPol.PodSelectorList = []policies.SetInfo{
+		{IPSet: filterNSSet, Included: true, MatchType: policies.EitherMatch},
+		{IPSet: selector, Included: true, MatchType: policies.EitherMatch},
+	}
+	for _, set := range ruleSets {
+		netPol.RuleIPSets = append(netPol.RuleIPSets, &ipsets.TranslatedIPSet{Metadata: set})
+	}
+	netPol.ACLs = []*policies.ACLPolicy{policies.NewACLPolicy(policies.Dropped, policies.Ingress)}
+	return netPol
+}
+
+func addFilterPod(t *testing.T, dp *DPShim, podKey, ip, nodeName string, labelSet *ipsets.IPSetMetadata) {
+	t.Helper()
+	podMetadata := dataplane.NewPodMetadata(podKey, ip, nodeName)
+	require.NoError(t, dp.AddToSets([]*ipsets.IPSetMetadata{filterNSSet, labelSet}, podMetadata))
+}
+
+// goalStateNames decodes the names of the sets and policies in each goal state.
+func goalStateNames(t *testing.T, event *protos.Events) map[string][]string {
+	t.Helper()
+	names := make(map[string][]string)
+	for key, goalState := range event.GetPayload() {
+		payload := bytes.NewBuffer(goalState.GetData())
+		switch key {
+		case controlplane.IpsetApply:
+			sets, err := controlplane.DecodeControllerIPSets(payload)
+			require.NoError(t, err)
+			for _, set := range sets {
+				names[key] = append(names[key], set.GetPrefixName())
+			}
+		case controlplane.PolicyApply:
+			netPols, err := controlplane.DecodeNPMNetworkPolicies(payload)
+			require.NoError(t, err)
+			for _, netPol := range netPols {
+				names[key] = append(names[key], netPol.PolicyKey)
+			}
+		default:
+			decoded, err := controlplane.DecodeStrings(payload)
+			require.NoError(t, err)
+			names[key] = decoded
+		}
+	}
+	for key := range names {
+		sort.Strings(names[key])
+	}
+	return names
+}
+
+func receiveNodeEvents(t *testing.T, dp *DPShim, count int) map[string]map[string][]string {
+	t.Helper()
+	events := make(map[string]map[string][]string)
+	for i := 0; i < count; i++ {
+		select {
+		case event := <-dp.NodeOutChannel:
+			require.Equal(t, protos.Events_GoalState, event.Events.GetEventType())
+			events[event.NodeName] = goalStateNames(t, event.Events)
+		case <-time.After(time.Second):
+			require.FailNow(t, "timed out waiting for node events")
+		}
+	}
+	select {
+	case event := <-dp.NodeOutChannel:
+		require.FailNow(t, "unexpected node event", "%+v", event)
+	case <-time.After(sleepAfterChanSent):
+	}
+	return events
+}
+
+func setUpFilteredShim(t *testing.T) *DPShim {
+	dp, err := NewDPSim(nil)
+	require.NoError(t, err)
+	dp.EnableNodeFiltering()
+
+	addFilterPod(t, dp, "shop/web", "10.0.0.1", "node1", filterWebSet)
+	addFilterPod(t, dp, "shop/db", "10.0.0.2", "node2", filterDBSet)
+	require.NoError(t, dp.AddToSets([]*ipsets.IPSetMetadata{filterCIDRSet}, dataplane.NewPodMetadata("", "8.8.8.8/32", "")))
+
+	require.NoError(t, dp.AddPolicy(filterPolicy("web", filterWebSet, filterDBSet, filterCIDRSet)))
+	require.NoError(t, dp.AddPolicy(filterPolicy("db", filterDBSet)))
+	return dp
+}
+
+func TestHydrateNodeSendsOnlyRelevantState(t *testing.T) {
+	dp := setUpFilteredShim(t)
+
+	event, err := dp.HydrateNode("node1")
+	require.NoError(t, err)
+	require.Equal(t, protos.Events_Hydration, event.GetEventType())
+	require.Equal(t, map[string][]string{
+		controlplane.IpsetApply:  {"cidr-web-egress-cidr", "ns-shop", "podlabel-app:db", "podlabel-app:web"},
+		controlplane.PolicyApply: {"shop/web"},
+	}, goalStateNames(t, event))
+
+	event, err = dp.HydrateNode("node2")
+	require.NoError(t, err)
+	require.Equal(t, map[string][]string{
+		controlplane.IpsetApply:  {"ns-shop", "podlabel-app:db"},
+		controlplane.PolicyApply: {"shop/db"},
+	}, goalStateNames(t, event))
+
+	// nodes without selected pods get nothing
+	event, err = dp.HydrateNode("node3")
+	require.NoError(t, err)
+	require.Nil(t, event)
+}
+
+func TestNodeEventsFollowPodPlacement(t *testing.T) {
+	dp := setUpFilteredShim(t)
+	for _, nodeName := range []string{"node1", "node2", "node3"} {
+		_, err := dp.HydrateNode(nodeName)
+		require.NoError(t, err)
+	}
+
+	// a web pod on node2 brings the web policy and its sets to node2, and updates the sets on node1
+	addFilterPod(t, dp, "shop/web2", "10.0.0.3", "node2", filterWebSet)
+	require.NoError(t, dp.ApplyDataPlane())
+	events := receiveNodeEvents(t, dp, 2)
+	require.Equal(t, map[string][]string{
+		controlplane.IpsetApply: {"ns-shop", "podlabel-app:web"},
+	}, events["node1"])
+	require.Equal(t, map[string][]string{
+		controlplane.IpsetApply:  {"cidr-web-egress-cidr", "ns-shop", "podlabel-app:web"},
+		controlplane.PolicyApply: {"shop/web"},
+	}, events["node2"])
+
+	// without web pods on node1, the policy and the sets only it used are removed
+	require.NoError(t, dp.RemoveFromSets([]*ipsets.IPSetMetadata{filterNSSet, filterWebSet}, dataplane.NewPodMetadata("shop/web", "10.0.0.1", "node1")))
+	require.NoError(t, dp.ApplyDataPlane())
+	events = receiveNodeEvents(t, dp, 2)
+	require.Equal(t, map[string][]string{
+		controlplane.IpsetRemove:  {"cidr-web-egress-cidr", "ns-shop", "podlabel-app:db", "podlabel-app:web"},
+		controlplane.PolicyRemove: {"shop/web"},
+	}, events["node1"])
+	require.Equal(t, map[string][]string{
+		controlplane.IpsetApply: {"ns-shop", "podlabel-app:web"},
+	}, events["node2"])
+
+	// forgotten nodes get no events
+	dp.ForgetNode("node2")
+	require.NoError(t, dp.RemovePolicy("shop/db"))
+	receiveNodeEvents(t, dp, 0)
+}
@@ -0,0 +1,465 @@
+// Package fqdn allows egress to the domain names of the FQDN egress annotation on NetworkPolicies.
+// DNS responses to pods are snooped, and the IPs resolved for matching names are added to the FQDN set of each policy until their TTL expires.
+// Only responses from the configured DNS servers which answer an outstanding query are trusted.
+// DNS over TCP isn't snooped, so names whose responses are truncated over UDP are only allowed for the records which fit in the truncated response.
+package fqdn
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
+	"golang.org/x/net/dns/dnsmessage"
+	"k8s.io/klog"
+	utilexec "k8s.io/utils/exec"
+)
+
+const (
+	wildcardPrefix = "*."
+	// expiryInterval is how often expired IPs are removed from the sets
+	expiryInterval = 10 * time.Second
+	// queryTimeout is how long a query waits for its response, which is longer than the timeout of common resolvers
+	queryTimeout = 10 * time.Second
+	// maxOutstandingQueries bounds the memory of queries which are never answered
+	maxOutstandingQueries = 1 << 16
+)
+
+var ErrUnsupportedOS = errors.New("FQDN egress is only supported on Linux")
+
+// Cfg configures DNS snooping.
+type Cfg struct {
+	// QueueNum is the NFQUEUE which DNS responses are sent to
+	QueueNum uint16
+	// MinTTL is the minimum time which resolved IPs stay in the sets
+	MinTTL time.Duration
+	// IPv6 must match the dataplane. AAAA records are ignored unless it is set.
+	IPv6 bool
+	// DNSServers are the original destinations of the queries which are snooped, i.e. the cluster DNS service and any upstream resolvers
+	DNSServers []netip.Addr
+}
+
+// Manager wraps a dataplane to learn the FQDN patterns and sets of the policies added to it.
+// Answers to any pod populate the set of every policy with a matching pattern.
+// Only the pods selected by a policy may reach the IPs in its set, so answers to other pods don't widen their egress.
+type Manager struct {
+	dataplane.GenericDataplane
+	cfg  *Cfg
+	exec utilexec.Interface
+	now  func() time.Time
+
+	sync.Mutex
+	policies map[string]*fqdnPolicy
+
+	queriesLock sync.Mutex
+	// queries maps outstanding queries to when they time out
+	queries map[dnsQuery]time.Time
+}
+
+// dnsQuery identifies a query by its ID and the addresses which its response is exchanged between.
+type dnsQuery struct {
+	id     uint16
+	client netip.AddrPort
+	server netip.AddrPort
+}
+
+type fqdnPolicy struct {
+	set      *ipsets.IPSetMetadata
+	patterns []string
+	// ips maps the IPs in the set to the name they were resolved for
+	ips map[string]*resolvedIP
+}
+
+type resolvedIP struct {
+	name   string
+	expiry time.Time
+}
+
+// answer is an A or AAAA record of a DNS response.
+type answer struct {
+	ip  string
+	ttl time.Duration
+}
+
+func NewManager(cfg *Cfg, dp dataplane.GenericDataplane) *Manager {
+	return &Manager{
+		GenericDataplane: dp,
+		cfg:              cfg,
+		exec:             utilexec.New(),
+		now:              time.Now,
+		policies:         make(map[string]*fqdnPolicy),
+		queries:          make(map[dnsQuery]time.Time),
+	}
+}
+
+func (m *Manager) AddPolicy(netPol *policies.NPMNetworkPolicy) error {
+	if err := m.GenericDataplane.AddPolicy(netPol); err != nil {
+		return err //nolint:wrapcheck // the dataplane error is returned as is
+	}
+	return m.track(netPol)
+}
+
+func (m *Manager) UpdatePolicy(netPol *policies.NPMNetworkPolicy) error {
+	if err := m.GenericDataplane.UpdatePolicy(netPol); err != nil {
+		return err //nolint:wrapcheck // the dataplane error is returned as is
+	}
+	return m.track(netPol)
+}
+
+// RemovePolicy empties the policy's FQDN set so that the dataplane deletes the set with the policy.
+func (m *Manager) RemovePolicy(policyKey string) error {
+	m.Lock()
+	if p, ok := m.policies[policyKey]; ok {
+		if err := m.removeIPs(p, p.ips); err != nil {
+			m.Unlock()
+			return err
+		}
+		delete(m.policies, policyKey)
+	}
+	m.Unlock()
+	return m.GenericDataplane.RemovePolicy(policyKey) //nolint:wrapcheck // the dataplane error is returned as is
+}
+
+// track starts or stops tracking the FQDN patterns of a policy.
+// IPs resolved for names which no longer match are removed.
+func (m *Manager) track(netPol *policies.NPMNetworkPolicy) error {
+	changed, err := m.trackPatterns(netPol)
+	if err != nil || !changed {
+		return err
+	}
+	return m.apply()
+}
+
+// trackPatterns updates the patterns of a policy, and returns true if IPs were removed from its set.
+func (m *Manager) trackPatterns(netPol *policies.NPMNetworkPolicy) (bool, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	set := netPol.FQDNSet()
+	p, ok := m.policies[netPol.PolicyKey]
+	if ok && (set == nil || set.GetPrefixName() != p.set.GetPrefixName()) {
+		if err := m.removeIPs(p, p.ips); err != nil {
+			return false, err
+		}
+		delete(m.policies, netPol.PolicyKey)
+		ok = false
+	}
+	if set == nil {
+		return false, nil
+	}
+	if !ok {
+		p = &fqdnPolicy{set: set, ips: make(map[string]*resolvedIP)}
+		m.policies[netPol.PolicyKey] = p
+	}
+	p.patterns = netPol.FQDNPatterns
+
+	stale := make(map[string]*resolvedIP)
+	for ip, resolved := range p.ips {
+		if !p.matches(resolved.name) {
+			stale[ip] = resolved
+		}
+	}
+	if len(stale) == 0 {
+		return false, nil
+	}
+	if err := m.removeIPs(p, stale); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// handlePacket handles a queued DNS query or response.
+// It returns true if the packet is a response which added IPs to the sets, so it must be held until they are applied.
+func (m *Manager) handlePacket(packet []byte) bool {
+	dns, err := parseDNSPacket(packet)
+	if err != nil {
+		return false
+	}
+	var parser dnsmessage.Parser
+	header, err := parser.Start(dns.payload)
+	if err != nil {
+		return false
+	}
+	if !header.Response {
+		m.addQuery(dnsQuery{id: header.ID, client: dns.src, server: dns.dst})
+		return false
+	}
+	if !m.removeQuery(dnsQuery{id: header.ID, client: dns.dst, server: dns.src}) {
+		// responses which don't answer a query may be forged by pods to allow egress to any IP
+		return false
+	}
+	changed, err := m.handleResponse(dns.payload)
+	if err != nil {
+		klog.Warningf("[fqdn] failed to handle DNS response: %s", err.Error())
+	}
+	return changed
+}
+
+// addQuery records an outstanding query unless too many are outstanding, in which case its response is ignored.
+func (m *Manager) addQuery(query dnsQuery) {
+	m.queriesLock.Lock()
+	defer m.queriesLock.Unlock()
+	if len(m.queries) >= maxOutstandingQueries {
+		return
+	}
+	m.queries[query] = m.now().Add(queryTimeout)
+}
+
+// removeQuery returns true if the query was outstanding, so that each query is answered at most once.
+func (m *Manager) removeQuery(query dnsQuery) bool {
+	m.queriesLock.Lock()
+	defer m.queriesLock.Unlock()
+	timeout, ok := m.queries[query]
+	if !ok {
+		return false
+	}
+	delete(m.queries, query)
+	return m.now().Before(timeout)
+}
+
+// expireQueries forgets the queries which were never answered.
+func (m *Manager) expireQueries() {
+	m.queriesLock.Lock()
+	defer m.queriesLock.Unlock()
+	now := m.now()
+	for query, timeout := range m.queries {
+		if !now.Before(timeout) {
+			delete(m.queries, query)
+		}
+	}
+}
+
+// handleResponse adds the IPs of a DNS response to the sets of the policies with a pattern matching the question or an alias.
+// It returns true if any IPs were added, which are allowed once the dataplane is applied.
+func (m *Manager) handleResponse(msg []byte) (bool, error) {
+	names, answers, err := parseResponse(msg)
+	if err != nil {
+		return false, err
+	}
+	answers = m.supportedAnswers(answers)
+	if len(answers) == 0 {
+		return false, nil
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	now := m.now()
+	changed := false
+	for _, p := range m.policies {
+		name, ok := p.matchingName(names)
+		if !ok {
+			continue
+		}
+		for _, a := range answers {
+			ttl := a.ttl
+			if ttl < m.cfg.MinTTL {
+				ttl = m.cfg.MinTTL
+			}
+			expiry := now.Add(ttl)
+			if resolved, ok := p.ips[a.ip]; ok {
+				if expiry.After(resolved.expiry) {
+					resolved.expiry = expiry
+				}
+				continue
+			}
+			if err := m.GenericDataplane.AddToSets([]*ipsets.IPSetMetadata{p.set}, dataplane.NewPodMetadata("", a.ip, "")); err != nil {
+				return changed, fmt.Errorf("failed to add %s resolved for %s to set %s: %w", a.ip, name, p.set.GetPrefixName(), err)
+			}
+			p.ips[a.ip] = &resolvedIP{name: name, expiry: expiry}
+			changed = true
+			klog.Infof("[fqdn] allowing %s resolved for %s in set %s", a.ip, name, p.set.GetPrefixName())
+		}
+	}
+	return changed, nil
+}
+
+// releaseHeld applies the sets before releasing the responses which added IPs to them, so that pods can connect as soon as the IPs are resolved.
+// Other packets aren't held while the dataplane is applied, and responses held meanwhile are released together after the next apply.
+func (m *Manager) releaseHeld(held <-chan uint32, release func(id uint32), stopCh <-chan struct{}) {
+	for {
+		var ids []uint32
+		select {
+		case <-stopCh:
+			return
+		case id := <-held:
+			ids = append(ids, id)
+		}
+	drain:
+		for {
+			select {
+			case id := <-held:
+				ids = append(ids, id)
+			default:
+				break drain
+			}
+		}
+
+		if err := m.apply(); err != nil {
+			klog.Errorf("[fqdn] failed to apply resolved IPs: %s", err.Error())
+		}
+		for _, id := range ids {
+			release(id)
+		}
+	}
+}
+
+// expire removes IPs whose TTL has passed and forgets queries which were never answered.
+func (m *Manager) expire() error {
+	m.expireQueries()
+	changed, err := m.removeExpired()
+	if err != nil || !changed {
+		return err
+	}
+	return m.apply()
+}
+
+// removeExpired removes IPs whose TTL has passed from the sets, and returns true if any were removed.
+func (m *Manager) removeExpired() (bool, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	now := m.now()
+	changed := false
+	for _, p := range m.policies {
+		expired := make(map[string]*resolvedIP)
+		for ip, resolved := range p.ips {
+			if !now.Before(resolved.expiry) {
+				expired[ip] = resolved
+			}
+		}
+		if len(expired) == 0 {
+			continue
+		}
+		if err := m.removeIPs(p, expired); err != nil {
+			return changed, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+func (m *Manager) removeIPs(p *fqdnPolicy, ips map[string]*resolvedIP) error {
+	for ip, resolved := range ips {
+		if err := m.GenericDataplane.RemoveFromSets([]*ipsets.IPSetMetadata{p.set}, dataplane.NewPodMetadata("", ip, "")); err != nil {
+			return fmt.Errorf("failed to remove %s resolved for %s from set %s: %w", ip, resolved.name, p.set.GetPrefixName(), err)
+		}
+		delete(p.ips, ip)
+	}
+	return nil
+}
+
+func (m *Manager) apply() error {
+	if err := m.GenericDataplane.ApplyDataPlane(); err != nil {
+		return fmt.Errorf("failed to apply FQDN sets: %w", err)
+	}
+	return nil
+}
+
+// matchingName returns the first name matching a pattern of the policy.
+func (p *fqdnPolicy) matchingName(names []string) (string, bool) {
+	for _, name := range names {
+		if p.matches(name) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func (p *fqdnPolicy) matches(name string) bool {
+	for _, pattern := range p.patterns {
+		if match(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns true if the name equals the pattern, or if the pattern is a wildcard and the name is a subdomain of the rest of it.
+// Both are expected to be lowercase without a trailing dot.
+func match(pattern, name string) bool {
+	if domain, ok := strings.CutPrefix(pattern, wildcardPrefix); ok {
+		return strings.HasSuffix(name, "."+domain)
+	}
+	return name == pattern
+}
+
+// supportedAnswers drops AAAA records unless IPv6 is enabled, since the sets can't hold IPv6 addresses otherwise.
+func (m *Manager) supportedAnswers(answers []answer) []answer {
+	if m.cfg.IPv6 {
+		return answers
+	}
+	ipv4Answers := make([]answer, 0, len(answers))
+	for _, a := range answers {
+		if addr, err := netip.ParseAddr(a.ip); err == nil && addr.Is4() {
+			ipv4Answers = append(ipv4Answers, a)
+		}
+	}
+	return ipv4Answers
+}
+
+// parseResponse returns the question names and aliases of a successful DNS response, and its A and AAAA records.
+func parseResponse(msg []byte) ([]string, []answer, error) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(msg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse DNS header: %w", err)
+	}
+	if !header.Response || header.RCode != dnsmessage.RCodeSuccess {
+		return nil, nil, nil
+	}
+	questions, err := parser.AllQuestions()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse DNS questions: %w", err)
+	}
+
+	names := make([]string, 0, len(questions))
+	for i := range questions {
+		names = append(names, normalize(questions[i].Name))
+	}
+	answers := make([]answer, 0)
+	for {
+		resourceHeader, err := parser.AnswerHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse DNS answer: %w", err)
+		}
+		ttl := time.Duration(resourceHeader.TTL) * time.Second
+		switch resourceHeader.Type {
+		case dnsmessage.TypeA:
+			resource, err := parser.AResource()
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to parse A record: %w", err)
+			}
+			answers = append(answers, answer{ip: netip.AddrFrom4(resource.A).String(), ttl: ttl})
+		case dnsmessage.TypeAAAA:
+			resource, err := parser.AAAAResource()
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to parse AAAA record: %w", err)
+			}
+			answers = append(answers, answer{ip: netip.AddrFrom16(resource.AAAA).String(), ttl: ttl})
+		case dnsmessage.TypeCNAME:
+			resource, err := parser.CNAMEResource()
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to parse CNAME record: %w", err)
+			}
+			names = append(names, normalize(resourceHeader.Name), normalize(resource.CNAME))
+		default:
+			if err := parser.SkipAnswer(); err != nil {
+				return nil, nil, fmt.Errorf("failed to skip DNS answer: %w", err)
+			}
+		}
+	}
+	return names, answers, nil
+}
+
+func normalize(name dnsmessage.Name) string {
+	return strings.TrimSuffix(strings.ToLower(name.String()), ".")
+}
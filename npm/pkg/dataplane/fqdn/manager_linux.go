@@ -0,0 +1,228 @@
+package fqdn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/Azure/azure-container-networking/npm/util"
+	"golang.org/x/sys/unix"
+	"k8s.io/klog"
+)
+
+const (
+	receiveBufferSize = 1 << 17
+	dnsPort           = "53"
+	// heldResponses is how many responses may wait for an apply before further ones are released without waiting
+	heldResponses = 1024
+)
+
+// Run sends DNS queries and responses to the NFQUEUE and adds the resolved IPs to the sets until stopCh is closed.
+// Queries are released immediately. Responses which add IPs are released once the IPs are applied, so pods can connect as soon as they are resolved.
+// The rules bypass the queue when nothing is bound to it, so DNS keeps working if NPM stops.
+func (m *Manager) Run(stopCh <-chan struct{}) error {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_NETFILTER)
+	if err != nil {
+		return fmt.Errorf("failed to create netfilter netlink socket: %w", err)
+	}
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		unix.Close(fd)
+		return fmt.Errorf("failed to bind netfilter netlink socket: %w", err)
+	}
+
+	// kernels before 3.8 require binding NFQUEUE to each address family before binding to a queue
+	requests := [][]byte{
+		nfqueueMessage(unix.AF_INET, 0, cmdAttr(nfqnlCfgCmdPFBind, unix.AF_INET)),
+		nfqueueMessage(unix.AF_INET6, 0, cmdAttr(nfqnlCfgCmdPFBind, unix.AF_INET6)),
+		nfqueueMessage(unix.AF_UNSPEC, m.cfg.QueueNum, cmdAttr(nfqnlCfgCmdBind, unix.AF_UNSPEC)),
+		nfqueueMessage(unix.AF_UNSPEC, m.cfg.QueueNum, copyModeAttr()),
+		nfqueueMessage(unix.AF_UNSPEC, m.cfg.QueueNum, failOpenAttrs()...),
+	}
+	for i, request := range requests {
+		if err := sendConfig(fd, uint32(i+1), request); err != nil {
+			unix.Close(fd)
+			return fmt.Errorf("failed to bind to NFQUEUE %d: %w", m.cfg.QueueNum, err)
+		}
+	}
+	if err := m.installRules(); err != nil {
+		unix.Close(fd)
+		return err
+	}
+	klog.Infof("[fqdn] snooping DNS responses of %v from NFQUEUE %d", m.cfg.DNSServers, m.cfg.QueueNum)
+
+	held := make(chan uint32, heldResponses)
+	go m.releaseHeld(held, func(id uint32) {
+		if err := m.accept(fd, id); err != nil {
+			klog.Errorf("[fqdn] failed to release DNS response %d: %s", id, err.Error())
+		}
+	}, stopCh)
+
+	var stopped atomic.Bool
+	go func() {
+		ticker := time.NewTicker(expiryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				stopped.Store(true)
+				// unblocks Recvfrom
+				unix.Close(fd)
+				return
+			case <-ticker.C:
+				if err := m.expire(); err != nil {
+					klog.Errorf("[fqdn] failed to remove expired IPs: %s", err.Error())
+				}
+			}
+		}
+	}()
+
+	buf := make([]byte, receiveBufferSize)
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			if stopped.Load() {
+				return nil
+			}
+			if errors.Is(err, unix.ENOBUFS) || errors.Is(err, unix.EINTR) {
+				// the kernel dropped queued packets because the socket buffer was full
+				continue
+			}
+			return fmt.Errorf("failed to receive from NFQUEUE %d: %w", m.cfg.QueueNum, err)
+		}
+
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			klog.Warningf("[fqdn] failed to parse netlink messages: %s", err.Error())
+			continue
+		}
+		for _, msg := range msgs {
+			if msg.Header.Type != nfqueueMessageType(nfqnlMsgPacket) {
+				continue
+			}
+			id, packet, err := parseNfqueuePacket(msg.Data)
+			if err != nil {
+				klog.Warningf("[fqdn] failed to parse NFQUEUE packet: %s", err.Error())
+				continue
+			}
+			if m.handlePacket(packet) {
+				select {
+				case held <- id:
+					continue
+				default:
+				}
+			}
+			if err := m.accept(fd, id); err != nil {
+				klog.Errorf("[fqdn] failed to release DNS packet %d: %s", id, err.Error())
+			}
+		}
+	}
+}
+
+// accept sends the verdict which releases a queued packet.
+func (m *Manager) accept(fd int, id uint32) error {
+	data := nfqueueMessage(unix.AF_UNSPEC, m.cfg.QueueNum, acceptAttr(id))
+	msg := make([]byte, unix.SizeofNlMsghdr, unix.SizeofNlMsghdr+len(data))
+	binary.NativeEndian.PutUint32(msg[0:4], uint32(unix.SizeofNlMsghdr+len(data)))
+	binary.NativeEndian.PutUint16(msg[4:6], nfqueueMessageType(nfqnlMsgVerdict))
+	binary.NativeEndian.PutUint16(msg[6:8], unix.NLM_F_REQUEST)
+	msg = append(msg, data...)
+	if err := unix.Sendto(fd, msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return fmt.Errorf("failed to send verdict: %w", err)
+	}
+	return nil
+}
+
+// installRules sends DNS queries to the configured servers and their responses to the queue.
+// Both are matched by the original destination of their connection, since they are seen after the service IP is translated to a DNS pod.
+// Queries and responses of pods are forwarded, or received and sent by host network resolvers. Those of host network clients are sent and received.
+// Only UDP is queued. DNS over TCP, which resolvers fall back to for truncated responses, isn't snooped.
+func (m *Manager) installRules() error {
+	binaries := map[string]bool{util.Iptables: false}
+	if m.cfg.IPv6 {
+		binaries[strings.Replace(util.Iptables, "iptables", "ip6tables", 1)] = true
+	}
+
+	for iptablesCmd, ipv6 := range binaries {
+		// the chain is flushed if it exists, so a changed queue number replaces the old rule
+		if err := m.iptables(iptablesCmd, util.IptablesFlushFlag, util.IptablesAzureFQDNChain); err != nil {
+			if err := m.iptables(iptablesCmd, util.IptablesChainCreationFlag, util.IptablesAzureFQDNChain); err != nil {
+				return err
+			}
+		}
+		for _, server := range m.cfg.DNSServers {
+			if server.Is6() != ipv6 {
+				continue
+			}
+			for _, portFlag := range []string{util.IptablesDstPortFlag, util.IptablesSrcPortFlag} {
+				queueRule := []string{
+					util.IptablesAzureFQDNChain,
+					util.IptablesProtFlag, "udp", portFlag, dnsPort,
+					util.IptablesModuleFlag, util.IptablesCtstateModuleFlag, util.IptablesCtOrigDstFlag, server.String(),
+					util.IptablesJumpFlag, util.IptablesNfqueue,
+					util.IptablesQueueNumFlag, strconv.Itoa(int(m.cfg.QueueNum)), util.IptablesQueueBypassFlag,
+				}
+				if err := m.iptables(iptablesCmd, util.IptablesAppendFlag, queueRule...); err != nil {
+					return err
+				}
+			}
+		}
+		for _, chain := range []string{util.IptablesForwardChain, util.IptablesInputChain, util.IptablesOutputChain} {
+			jump := []string{chain, util.IptablesJumpFlag, util.IptablesAzureFQDNChain}
+			if m.iptables(iptablesCmd, util.IptablesCheckFlag, jump...) == nil {
+				continue
+			}
+			if err := m.iptables(iptablesCmd, util.IptablesInsertionFlag, append([]string{chain, "1"}, jump[1:]...)...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Manager) iptables(iptablesCmd, operationFlag string, args ...string) error {
+	allArgs := append([]string{util.IptablesWaitFlag, util.IptablesDefaultWaitTime, operationFlag}, args...)
+	output, err := m.exec.Command(iptablesCmd, allArgs...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to run iptables command [%s %s] Stderr: [%s]: %w", iptablesCmd, strings.Join(allArgs, " "), strings.TrimSpace(string(output)), err)
+	}
+	return nil
+}
+
+// sendConfig sends an NFQNL_MSG_CONFIG message and waits for the kernel to acknowledge it.
+func sendConfig(fd int, seq uint32, data []byte) error {
+	msg := make([]byte, unix.SizeofNlMsghdr, unix.SizeofNlMsghdr+len(data))
+	binary.NativeEndian.PutUint32(msg[0:4], uint32(unix.SizeofNlMsghdr+len(data)))
+	binary.NativeEndian.PutUint16(msg[4:6], nfqueueMessageType(nfqnlMsgConfig))
+	binary.NativeEndian.PutUint16(msg[6:8], unix.NLM_F_REQUEST|unix.NLM_F_ACK)
+	binary.NativeEndian.PutUint32(msg[8:12], seq)
+	msg = append(msg, data...)
+
+	if err := unix.Sendto(fd, msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return fmt.Errorf("failed to send config: %w", err)
+	}
+
+	buf := make([]byte, unix.Getpagesize())
+	n, _, err := unix.Recvfrom(fd, buf, 0)
+	if err != nil {
+		return fmt.Errorf("failed to receive ack: %w", err)
+	}
+	replies, err := syscall.ParseNetlinkMessage(buf[:n])
+	if err != nil {
+		return fmt.Errorf("failed to parse ack: %w", err)
+	}
+	for _, reply := range replies {
+		if reply.Header.Type != unix.NLMSG_ERROR || reply.Header.Seq != seq || len(reply.Data) < 4 {
+			continue
+		}
+		if errno := -int32(binary.NativeEndian.Uint32(reply.Data[0:4])); errno != 0 {
+			return fmt.Errorf("kernel rejected config: %w", syscall.Errno(errno))
+		}
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+package fqdn
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeDataplane holds the members of sets and counts applies.
+type fakeDataplane struct {
+	dataplane.GenericDataplane
+	policies map[string]*policies.NPMNetworkPolicy
+	members  map[string]map[string]struct{}
+	applies  int
+}
+
+func newFakeDataplane() *fakeDataplane {
+	return &fakeDataplane{
+		policies: make(map[string]*policies.NPMNetworkPolicy),
+		members:  make(map[string]map[string]struct{}),
+	}
+}
+
+func (f *fakeDataplane) AddPolicy(netPol *policies.NPMNetworkPolicy) error {
+	f.policies[netPol.PolicyKey] = netPol
+	return nil
+}
+
+func (f *fakeDataplane) UpdatePolicy(netPol *policies.NPMNetworkPolicy) error {
+	return f.AddPolicy(netPol)
+}
+
+func (f *fakeDataplane) RemovePolicy(policyKey string) error {
+	delete(f.policies, policyKey)
+	return nil
+}
+
+func (f *fakeDataplane) AddToSets(sets []*ipsets.IPSetMetadata, podMetadata *dataplane.PodMetadata) error {
+	for _, set := range sets {
+		name := set.GetPrefixName()
+		if f.members[name] == nil {
+			f.members[name] = make(map[string]struct{})
+		}
+		f.members[name][podMetadata.PodIP] = struct{}{}
+	}
+	return nil
+}
+
+func (f *fakeDataplane) RemoveFromSets(sets []*ipsets.IPSetMetadata, podMetadata *dataplane.PodMetadata) error {
+	for _, set := range sets {
+		delete(f.members[set.GetPrefixName()], podMetadata.PodIP)
+	}
+	return nil
+}
+
+func (f *fakeDataplane) ApplyDataPlane() error {
+	f.applies++
+	return nil
+}
+
+func (f *fakeDataplane) setMembers(setName string) []string {
+	members := make([]string, 0)
+	for ip := range f.members[setName] {
+		members = append(members, ip)
+	}
+	sort.Strings(members)
+	return members
+}
+
+type record struct {
+	cname string
+	ip    string
+	ttl   uint32
+}
+
+var (
+	podAddr    = netip.MustParseAddrPort("10.0.0.1:40000")
+	serverAddr = netip.MustParseAddrPort("10.0.0.10:53")
+)
+
+// fakeResolver answers queries with the records of each name, wrapped in the UDP and IP headers of packets between a pod and the DNS server.
+type fakeResolver struct {
+	t       *testing.T
+	records map[string][]record
+	lastID  uint16
+}
+
+// resolve sends a query for the name and its response through the manager, and applies the sets if the response is held like Run does.
+func (r *fakeResolver) resolve(m *Manager, name string) {
+	r.t.Helper()
+	r.lastID++
+	require.False(r.t, m.handlePacket(ipv4UDPPacket(podAddr, serverAddr, r.query(r.lastID, name))))
+	if m.handlePacket(ipv4UDPPacket(serverAddr, podAddr, r.response(r.lastID, name))) {
+		require.NoError(r.t, m.apply())
+	}
+}
+
+func (r *fakeResolver) query(id uint16, name string) []byte {
+	r.t.Helper()
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	require.NoError(r.t, builder.StartQuestions())
+	require.NoError(r.t, builder.Question(dnsmessage.Question{
+		Name:  dnsmessage.MustNewName(name + "."),
+		Type:  dnsmessage.TypeA,
+		Class: dnsmessage.ClassINET,
+	}))
+	msg, err := builder.Finish()
+	require.NoError(r.t, err)
+	return msg
+}
+
+func (r *fakeResolver) response(id uint16, name string) []byte {
+	r.t.Helper()
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, Response: true, RCode: dnsmessage.RCodeSuccess})
+	require.NoError(r.t, builder.StartQuestions())
+	require.NoError(r.t, builder.Question(dnsmessage.Question{
+		Name:  dnsmessage.MustNewName(name + "."),
+		Type:  dnsmessage.TypeA,
+		Class: dnsmessage.ClassINET,
+	}))
+	require.NoError(r.t, builder.StartAnswers())
+
+	owner := name
+	for _, rec := range r.records[name] {
+		header := dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(owner + "."), Class: dnsmessage.ClassINET, TTL: rec.ttl}
+		switch {
+		case rec.cname != "":
+			require.NoError(r.t, builder.CNAMEResource(header, dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName(rec.cname + ".")}))
+			owner = rec.cname
+		case strings.Contains(rec.ip, ":"):
+			require.NoError(r.t, builder.AAAAResource(header, dnsmessage.AAAAResource{AAAA: netip.MustParseAddr(rec.ip).As16()}))
+		default:
+			require.NoError(r.t, builder.AResource(header, dnsmessage.AResource{A: netip.MustParseAddr(rec.ip).As4()}))
+		}
+	}
+	msg, err := builder.Finish()
+	require.NoError(r.t, err)
+	return msg
+}
+
+func ipv4UDPPacket(src, dst netip.AddrPort, payload []byte) []byte {
+	packet := make([]byte, ipv4HeaderMinLength+udpHeaderLength, ipv4HeaderMinLength+udpHeaderLength+len(payload))
+	packet[0] = 0x45
+	packet[9] = protocolUDP
+	srcIP, dstIP := src.Addr().As4(), dst.Addr().As4()
+	copy(packet[12:16], srcIP[:])
+	copy(packet[16:20], dstIP[:])
+	binary.BigEndian.PutUint16(packet[20:22], src.Port())
+	binary.BigEndian.PutUint16(packet[22:24], dst.Port())
+	binary.BigEndian.PutUint16(packet[24:26], uint16(udpHeaderLength+len(payload)))
+	return append(packet, payload...)
+}
+
+func newFQDNPolicy(name string, patterns ...string) *policies.NPMNetworkPolicy {
+	netPol := policies.NewNPMNetworkPolicy(name, "shop")
+	netPol.FQDNPatterns = patterns
+	netPol.RuleIPSets = []*ipsets.TranslatedIPSet{ipsets.NewTranslatedIPSet(name+"-in-ns-shop-fqdn", ipsets.FQDN)}
+	return netPol
+}
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func setUpManager(t *testing.T, ipv6 bool) (*Manager, *fakeDataplane, *fakeResolver, *testClock) {
+	dp := newFakeDataplane()
+	m := NewManager(&Cfg{QueueNum: 100, MinTTL: time.Minute, IPv6: ipv6}, dp)
+	clock := &testClock{now: time.Unix(1000, 0)}
+	m.now = clock.Now
+	resolver := &fakeResolver{
+		t: t,
+		records: map[string][]record{
+			"api.contoso.com":          {{ip: "20.1.1.1", ttl: 300}, {ip: "20.1.1.2", ttl: 300}},
+			"store.blob.windows.net":   {{cname: "blob.edge.windows.net", ttl: 300}, {ip: "52.1.1.1", ttl: 30}},
+			"other.example.com":        {{ip: "1.1.1.1", ttl: 300}},
+			"dualstack.contoso.com":    {{ip: "20.1.1.3", ttl: 300}, {ip: "2001:db8::1", ttl: 300}},
+			"cdn.api.contoso.com":      {{ip: "20.1.1.4", ttl: 300}},
+			"rotating.api.contoso.com": {{ip: "20.1.1.5", ttl: 5}},
+		},
+	}
+	return m, dp, resolver, clock
+}
+
+func TestResolvedIPsPopulateMatchingPolicies(t *testing.T) {
+	m, dp, resolver, _ := setUpManager(t, false)
+	require.NoError(t, m.AddPolicy(newFQDNPolicy("api", "api.contoso.com")))
+	require.NoError(t, m.AddPolicy(newFQDNPolicy("blob", "*.windows.net", "dualstack.contoso.com")))
+	require.NoError(t, m.AddPolicy(policies.NewNPMNetworkPolicy("plain", "shop")))
+
+	resolver.resolve(m, "api.contoso.com")
+	require.Equal(t, []string{"20.1.1.1", "20.1.1.2"}, dp.setMembers("fqdn-api-in-ns-shop-fqdn"))
+	require.Empty(t, dp.setMembers("fqdn-blob-in-ns-shop-fqdn"))
+	require.Equal(t, 1, dp.applies)
+
+	// the alias of the question matches the wildcard
+	resolver.resolve(m, "store.blob.windows.net")
+	require.Equal(t, []string{"52.1.1.1"}, dp.setMembers("fqdn-blob-in-ns-shop-fqdn"))
+
+	// AAAA records are ignored without IPv6
+	resolver.resolve(m, "dualstack.contoso.com")
+	require.Equal(t, []string{"20.1.1.3", "52.1.1.1"}, dp.setMembers("fqdn-blob-in-ns-shop-fqdn"))
+
+	// exact patterns don't match subdomains, and known IPs aren't applied again
+	applies := dp.applies
+	resolver.resolve(m, "other.example.com")
+	resolver.resolve(m, "cdn.api.contoso.com")
+	resolver.resolve(m, "api.contoso.com")
+	require.Equal(t, applies, dp.applies)
+	require.Equal(t, []string{"20.1.1.1", "20.1.1.2"}, dp.setMembers("fqdn-api-in-ns-shop-fqdn"))
+}
+
+func TestResolvedIPsExpire(t *testing.T) {
+	m, dp, resolver, clock := setUpManager(t, true)
+	require.NoError(t, m.AddPolicy(newFQDNPolicy("api", "*.api.contoso.com", "dualstack.contoso.com")))
+
+	resolver.resolve(m, "rotating.api.contoso.com")
+	resolver.resolve(m, "dualstack.contoso.com")
+	require.Equal(t, []string{"20.1.1.3", "20.1.1.5", "2001:db8::1"}, dp.setMembers("fqdn-api-in-ns-shop-fqdn"))
+
+	// the TTL of 5 seconds is raised to the minimum of a minute
+	clock.now = clock.now.Add(59 * time.Second)
+	require.NoError(t, m.expire())
+	require.Len(t, dp.setMembers("fqdn-api-in-ns-shop-fqdn"), 3)
+
+	clock.now = clock.now.Add(time.Second)
+	require.NoError(t, m.expire())
+	require.Equal(t, []string{"20.1.1.3", "2001:db8::1"}, dp.setMembers("fqdn-api-in-ns-shop-fqdn"))
+
+	// a new answer extends the expiry
+	clock.now = clock.now.Add(200 * time.Second)
+	resolver.resolve(m, "dualstack.contoso.com")
+	clock.now = clock.now.Add(200 * time.Second)
+	require.NoError(t, m.expire())
+	require.Equal(t, []string{"20.1.1.3", "2001:db8::1"}, dp.setMembers("fqdn-api-in-ns-shop-fqdn"))
+}
+
+func TestPolicyChangesRemoveResolvedIPs(t *testing.T) {
+	m, dp, resolver, _ := setUpManager(t, false)
+	require.NoError(t, m.AddPolicy(newFQDNPolicy("api", "api.contoso.com", "*.windows.net")))
+	resolver.resolve(m, "api.contoso.com")
+	resolver.resolve(m, "store.blob.windows.net")
+	require.Equal(t, []string{"20.1.1.1", "20.1.1.2", "52.1.1.1"}, dp.setMembers("fqdn-api-in-ns-shop-fqdn"))
+
+	// IPs of names which no longer match are removed
+	require.NoError(t, m.UpdatePolicy(newFQDNPolicy("api", "api.contoso.com")))
+	require.Equal(t, []string{"20.1.1.1", "20.1.1.2"}, dp.setMembers("fqdn-api-in-ns-shop-fqdn"))
+
+	// the set is emptied before the dataplane removes the policy
+	require.NoError(t, m.RemovePolicy("shop/api"))
+	require.Empty(t, dp.setMembers("fqdn-api-in-ns-shop-fqdn"))
+	require.NotContains(t, dp.policies, "shop/api")
+
+	resolver.resolve(m, "api.contoso.com")
+	require.Empty(t, dp.setMembers("fqdn-api-in-ns-shop-fqdn"))
+}
+
+func TestResponsesMustAnswerQueries(t *testing.T) {
+	m, dp, resolver, clock := setUpManager(t, false)
+	require.NoError(t, m.AddPolicy(newFQDNPolicy("api", "api.contoso.com")))
+
+	// a response without a query is ignored
+	require.False(t, m.handlePacket(ipv4UDPPacket(serverAddr, podAddr, resolver.response(1, "api.contoso.com"))))
+
+	query := ipv4UDPPacket(podAddr, serverAddr, resolver.query(2, "api.contoso.com"))
+	require.False(t, m.handlePacket(query))
+	// the ID, the server and the client port must match the query
+	require.False(t, m.handlePacket(ipv4UDPPacket(serverAddr, podAddr, resolver.response(3, "api.contoso.com"))))
+	otherServer := netip.MustParseAddrPort("10.0.0.2:53")
+	require.False(t, m.handlePacket(ipv4UDPPacket(otherServer, podAddr, resolver.response(2, "api.contoso.com"))))
+	otherPort := netip.AddrPortFrom(podAddr.Addr(), podAddr.Port()+1)
+	require.False(t, m.handlePacket(ipv4UDPPacket(serverAddr, otherPort, resolver.response(2, "api.contoso.com"))))
+	require.Empty(t, dp.setMembers("fqdn-api-in-ns-shop-fqdn"))
+
+	// the query is answered once
+	require.True(t, m.handlePacket(ipv4UDPPacket(serverAddr, podAddr, resolver.response(2, "api.contoso.com"))))
+	require.Equal(t, []string{"20.1.1.1", "20.1.1.2"}, dp.setMembers("fqdn-api-in-ns-shop-fqdn"))
+	require.NoError(t, m.RemovePolicy("shop/api"))
+	require.NoError(t, m.AddPolicy(newFQDNPolicy("api", "api.contoso.com")))
+	require.False(t, m.handlePacket(ipv4UDPPacket(serverAddr, podAddr, resolver.response(2, "api.contoso.com"))))
+
+	// queries which aren't answered in time are forgotten
+	require.False(t, m.handlePacket(query))
+	clock.now = clock.now.Add(queryTimeout)
+	require.NoError(t, m.expire())
+	require.Empty(t, m.queries)
+	require.False(t, m.handlePacket(ipv4UDPPacket(serverAddr, podAddr, resolver.response(2, "api.contoso.com"))))
+	require.Empty(t, dp.setMembers("fqdn-api-in-ns-shop-fqdn"))
+}
+
+func TestHeldResponsesAreReleasedAfterApply(t *testing.T) {
+	m, dp, _, _ := setUpManager(t, false)
+	held := make(chan uint32, 2)
+	// released holds the ID of each released response and the number of applies before it
+	released := make(chan [2]int, 2)
+	stopCh := make(chan struct{})
+	held <- 1
+	held <- 2
+	go m.releaseHeld(held, func(id uint32) {
+		released <- [2]int{int(id), dp.applies}
+	}, stopCh)
+	require.Equal(t, [2]int{1, 1}, <-released)
+	require.Equal(t, [2]int{2, 1}, <-released)
+	close(stopCh)
+}
+
+func TestParseDNSPacketRejectsOtherPackets(t *testing.T) {
+	packet := ipv4UDPPacket(serverAddr, podAddr, []byte("dns"))
+	dns, err := parseDNSPacket(packet)
+	require.NoError(t, err)
+	require.Equal(t, []byte("dns"), dns.payload)
+	require.Equal(t, serverAddr, dns.src)
+	require.Equal(t, podAddr, dns.dst)
+
+	fragment := append([]byte(nil), packet...)
+	binary.BigEndian.PutUint16(fragment[6:8], 0x2000)
+	_, err = parseDNSPacket(fragment)
+	require.ErrorIs(t, err, errNotDNSPacket)
+
+	tcp := append([]byte(nil), packet...)
+	tcp[9] = 6
+	_, err = parseDNSPacket(tcp)
+	require.ErrorIs(t, err, errNotDNSPacket)
+
+	_, err = parseDNSPacket(packet[:ipv4HeaderMinLength+4])
+	require.ErrorIs(t, err, errNotDNSPacket)
+}
+
+func TestParseNfqueuePacket(t *testing.T) {
+	header := make([]byte, packetHdrLength)
+	binary.BigEndian.PutUint32(header[0:4], 42)
+	data := nfqueueMessage(2, 100, nlattr(nfqaPacketHdr, header), nlattr(nfqaPayload, []byte{0x45, 1, 2}))
+
+	id, payload, err := parseNfqueuePacket(data)
+	require.NoError(t, err)
+	require.Equal(t, uint32(42), id)
+	require.Equal(t, []byte{0x45, 1, 2}, payload)
+
+	_, _, err = parseNfqueuePacket(nfqueueMessage(2, 100, nlattr(nfqaPayload, []byte{0x45})))
+	require.ErrorIs(t, err, errMalformedAttribute)
+}
@@ -0,0 +1,6 @@
+package fqdn
+
+// Run returns an error since Windows has no NFQUEUE to snoop DNS responses with.
+func (m *Manager) Run(_ <-chan struct{}) error {
+	return ErrUnsupportedOS
+}
@@ -0,0 +1,144 @@
+package fqdn
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// nfnetlink_queue constants from include/uapi/linux/netfilter/nfnetlink_queue.h
+const (
+	nfnlSubsysQueue = 3
+
+	nfqnlMsgPacket  = 0
+	nfqnlMsgVerdict = 1
+	nfqnlMsgConfig  = 2
+
+	nfqaPacketHdr  = 1
+	nfqaVerdictHdr = 2
+	nfqaPayload    = 10
+
+	nfqaCfgCmd    = 1
+	nfqaCfgParams = 2
+	nfqaCfgMask   = 4
+	nfqaCfgFlags  = 5
+
+	nfqnlCfgCmdBind   = 1
+	nfqnlCfgCmdPFBind = 3
+
+	nfqnlCopyPacket = 2
+	// nfqaCfgFFailOpen accepts packets instead of dropping them when the queue is full
+	nfqaCfgFFailOpen = 1
+
+	nfAccept = 1
+
+	// nfgenmsgLength is the length of the nfnetlink header following the netlink header
+	nfgenmsgLength  = 4
+	nlattrHeaderLen = 4
+	// nlaTypeMask strips the nested and byte order flags from the attribute type
+	nlaTypeMask = 0x3fff
+	// packetHdrLength is the length of struct nfqnl_msg_packet_hdr
+	packetHdrLength = 7
+
+	// copyRange covers DNS responses up to the maximum UDP payload
+	copyRange = 0xffff
+)
+
+var errMalformedAttribute = errors.New("malformed netlink attribute")
+
+// nfqueueMessageType is the netlink message type of NFQUEUE messages.
+func nfqueueMessageType(msgType uint16) uint16 {
+	return nfnlSubsysQueue<<8 | msgType
+}
+
+// parseNfqueuePacket returns the packet ID and payload attributes of an NFQNL_MSG_PACKET message following its netlink header.
+func parseNfqueuePacket(data []byte) (id uint32, payload []byte, err error) {
+	if len(data) < nfgenmsgLength {
+		return 0, nil, errMalformedAttribute
+	}
+	hasID := false
+	attrs := data[nfgenmsgLength:]
+	for len(attrs) >= nlattrHeaderLen {
+		attrLen := int(binary.NativeEndian.Uint16(attrs[0:2]))
+		attrType := binary.NativeEndian.Uint16(attrs[2:4]) & nlaTypeMask
+		if attrLen < nlattrHeaderLen || attrLen > len(attrs) {
+			return 0, nil, errMalformedAttribute
+		}
+
+		value := attrs[nlattrHeaderLen:attrLen]
+		switch attrType {
+		case nfqaPacketHdr:
+			if len(value) < packetHdrLength {
+				return 0, nil, errMalformedAttribute
+			}
+			id = binary.BigEndian.Uint32(value[0:4])
+			hasID = true
+		case nfqaPayload:
+			payload = value
+		}
+
+		alignedLen := nlaAlign(attrLen)
+		if alignedLen > len(attrs) {
+			break
+		}
+		attrs = attrs[alignedLen:]
+	}
+	if !hasID {
+		return 0, nil, errMalformedAttribute
+	}
+	return id, payload, nil
+}
+
+// nfqueueMessage returns an NFQUEUE message for the queue without its netlink header.
+func nfqueueMessage(family uint8, queueNum uint16, attrs ...[]byte) []byte {
+	msg := make([]byte, nfgenmsgLength)
+	msg[0] = family
+	// version is NFNETLINK_V0 and the resource ID is the queue number in network byte order
+	binary.BigEndian.PutUint16(msg[2:4], queueNum)
+	for _, attr := range attrs {
+		msg = append(msg, attr...)
+	}
+	return msg
+}
+
+func cmdAttr(cmd uint8, family uint16) []byte {
+	// struct nfqnl_msg_config_cmd { __u8 command; __u8 _pad; __be16 pf; }
+	value := make([]byte, 4)
+	value[0] = cmd
+	binary.BigEndian.PutUint16(value[2:4], family)
+	return nlattr(nfqaCfgCmd, value)
+}
+
+func copyModeAttr() []byte {
+	// struct nfqnl_msg_config_params { __be32 copy_range; __u8 copy_mode; } __attribute__ ((packed))
+	value := make([]byte, 5)
+	binary.BigEndian.PutUint32(value[0:4], copyRange)
+	value[4] = nfqnlCopyPacket
+	return nlattr(nfqaCfgParams, value)
+}
+
+func failOpenAttrs() [][]byte {
+	value := make([]byte, 4)
+	binary.BigEndian.PutUint32(value, nfqaCfgFFailOpen)
+	return [][]byte{nlattr(nfqaCfgFlags, value), nlattr(nfqaCfgMask, value)}
+}
+
+func acceptAttr(id uint32) []byte {
+	// struct nfqnl_msg_verdict_hdr { __be32 verdict; __be32 id; }
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint32(value[0:4], nfAccept)
+	binary.BigEndian.PutUint32(value[4:8], id)
+	return nlattr(nfqaVerdictHdr, value)
+}
+
+func nlattr(attrType uint16, value []byte) []byte {
+	attrLen := nlattrHeaderLen + len(value)
+	attr := make([]byte, nlaAlign(attrLen))
+	binary.NativeEndian.PutUint16(attr[0:2], uint16(attrLen))
+	binary.NativeEndian.PutUint16(attr[2:4], attrType)
+	copy(attr[nlattrHeaderLen:], value)
+	return attr
+}
+
+func nlaAlign(length int) int {
+	return (length + 3) &^ 3
+}
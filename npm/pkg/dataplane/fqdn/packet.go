@@ -0,0 +1,70 @@
+package fqdn
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/netip"
+)
+
+const (
+	ipv4HeaderMinLength = 20
+	ipv6HeaderLength    = 40
+	udpHeaderLength     = 8
+
+	protocolUDP = 17
+	// ipv4FragmentMask covers the more fragments flag and the fragment offset
+	ipv4FragmentMask = 0x3fff
+)
+
+var errNotDNSPacket = errors.New("packet isn't an unfragmented UDP packet")
+
+// dnsPacket is a DNS query or response over UDP.
+type dnsPacket struct {
+	src     netip.AddrPort
+	dst     netip.AddrPort
+	payload []byte
+}
+
+// parseDNSPacket returns the addresses and UDP payload of a packet starting at its network header.
+// Fragments and IPv6 packets with extension headers are rejected, so large responses over UDP aren't snooped.
+func parseDNSPacket(packet []byte) (*dnsPacket, error) {
+	if len(packet) == 0 {
+		return nil, errNotDNSPacket
+	}
+
+	var srcIP, dstIP netip.Addr
+	var transport []byte
+	switch packet[0] >> 4 {
+	case 4:
+		headerLength := int(packet[0]&0x0f) * 4
+		if len(packet) < ipv4HeaderMinLength || len(packet) < headerLength || packet[9] != protocolUDP ||
+			binary.BigEndian.Uint16(packet[6:8])&ipv4FragmentMask != 0 {
+			return nil, errNotDNSPacket
+		}
+		srcIP = netip.AddrFrom4([4]byte(packet[12:16]))
+		dstIP = netip.AddrFrom4([4]byte(packet[16:20]))
+		transport = packet[headerLength:]
+	case 6:
+		if len(packet) < ipv6HeaderLength || packet[6] != protocolUDP {
+			return nil, errNotDNSPacket
+		}
+		srcIP = netip.AddrFrom16([16]byte(packet[8:24]))
+		dstIP = netip.AddrFrom16([16]byte(packet[24:40]))
+		transport = packet[ipv6HeaderLength:]
+	default:
+		return nil, errNotDNSPacket
+	}
+
+	if len(transport) < udpHeaderLength {
+		return nil, errNotDNSPacket
+	}
+	udpLength := int(binary.BigEndian.Uint16(transport[4:6]))
+	if udpLength < udpHeaderLength || udpLength > len(transport) {
+		return nil, errNotDNSPacket
+	}
+	return &dnsPacket{
+		src:     netip.AddrPortFrom(srcIP, binary.BigEndian.Uint16(transport[0:2])),
+		dst:     netip.AddrPortFrom(dstIP, binary.BigEndian.Uint16(transport[2:4])),
+		payload: transport[udpHeaderLength:udpLength],
+	}, nil
+}
@@ -3,6 +3,7 @@ package ipsets
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/Azure/azure-container-networking/log"
 	"github.com/Azure/azure-container-networking/npm/metrics"
@@ -23,6 +24,9 @@ const (
 	HashSet SetKind = "set"
 	// UnknownKind is returned when kind is unknown
 	UnknownKind SetKind = "unknown"
+
+	// ipv6SetSuffix is appended to the hashed name of a set for its inet6 counterpart
+	ipv6SetSuffix = "-6"
 )
 
 // NewIPSetMetadata is used for controllers to send in skeleton ipsets to DP
@@ -42,6 +46,27 @@ func (setMetadata *IPSetMetadata) GetHashedName() string {
 	return util.GetHashedName(prefixedName)
 }
 
+// GetIPv6HashedName returns the name of the set's inet6 counterpart in the kernel.
+func (setMetadata *IPSetMetadata) GetIPv6HashedName() string {
+	hashedName := setMetadata.GetHashedName()
+	if hashedName == Unknown {
+		return Unknown
+	}
+	return IPv6SetName(hashedName)
+}
+
+// IPv6SetName returns the name of the inet6 counterpart of a kernel set.
+// In Linux, a set only holds members of a single family, so when IPv6 is enabled each set is paired with an inet6 set.
+func IPv6SetName(hashedName string) string {
+	return hashedName + ipv6SetSuffix
+}
+
+// IPv4SetName returns the name of the set that an inet6 kernel set is paired with.
+// Names of other sets are returned unchanged.
+func IPv4SetName(hashedName string) string {
+	return strings.TrimSuffix(hashedName, ipv6SetSuffix)
+}
+
 // TODO join with colon instead of dash for easier readability?
 func (setMetadata *IPSetMetadata) GetPrefixName() string {
 	switch setMetadata.Type {
@@ -63,6 +88,8 @@ func (setMetadata *IPSetMetadata) GetPrefixName() string {
 		return fmt.Sprintf("%s%s", util.NestedLabelPrefix, setMetadata.Name)
 	case EmptyHashSet:
 		return fmt.Sprintf("%s%s", util.EmptySetPrefix, setMetadata.Name)
+	case FQDN:
+		return fmt.Sprintf("%s%s", util.FQDNPrefix, setMetadata.Name)
 	case UnknownType: // adding this to appease golint
 		metrics.SendErrorLogAndMetric(util.UtilID, "experienced unknown type in set metadata: %+v", setMetadata)
 		return Unknown
@@ -90,6 +117,8 @@ func (setType SetType) getSetKind() SetKind {
 		return HashSet
 	case EmptyHashSet:
 		return HashSet
+	case FQDN:
+		return HashSet
 	case KeyLabelOfNamespace:
 		return ListSet
 	case KeyValueLabelOfNamespace:
@@ -164,6 +193,8 @@ const (
 	CIDRBlocks SetType = 8
 	// EmptyHashSet is a set meant to have no members
 	EmptyHashSet SetType = 9
+	// FQDN holds the IPs which DNS responses resolved for the domain names of a policy
+	FQDN SetType = 10
 
 	// Unknown const for unknown string
 	Unknown string = "unknown"
@@ -181,6 +212,7 @@ var (
 		NestedLabelOfPod:         "NestedLabelOfPod",
 		CIDRBlocks:               "CIDRBlocks",
 		EmptyHashSet:             "EmptySet",
+		FQDN:                     "FQDN",
 	}
 	// ErrIPSetInvalidKind is returned when IPSet kind is invalid
 	ErrIPSetInvalidKind = errors.New("invalid IPSet Kind")
@@ -65,6 +65,8 @@ type IPSetManagerCfg struct {
 	// This is necessary for HNS (Windows); otherwise, an allow ACL with a list condition
 	// allows all IPs if the list has no members.
 	AddEmptySetToLists bool
+	// EnableIPv6 only affects Linux. When true, every set has an inet6 counterpart which holds the IPv6 members.
+	EnableIPv6 bool
 }
 
 func NewIPSetManager(iMgrCfg *IPSetManagerCfg, ioShim *common.IOShim) *IPSetManager {
@@ -244,7 +246,7 @@ func (iMgr *IPSetManager) AddToSets(addToSets []*IPSetMetadata, ip, podKey strin
 		return nil
 	}
 
-	if !validateIPSetMemberIP(ip) {
+	if !validateIPSetMemberIP(ip, iMgr.iMgrCfg.EnableIPv6) {
 		msg := fmt.Sprintf("error: failed to add to sets: invalid ip %s", ip)
 		metrics.SendErrorLogAndMetric(util.IpsmID, "%s", msg)
 		return npmerrors.Errorf(npmerrors.AppendIPSet, true, msg)
@@ -280,7 +282,7 @@ func (iMgr *IPSetManager) RemoveFromSets(removeFromSets []*IPSetMetadata, ip, po
 		return nil
 	}
 
-	if !validateIPSetMemberIP(ip) {
+	if !validateIPSetMemberIP(ip, iMgr.iMgrCfg.EnableIPv6) {
 		msg := fmt.Sprintf("error: failed to add to sets: invalid ip %s", ip)
 		metrics.SendErrorLogAndMetric(util.IpsmID, "%s", msg)
 		return npmerrors.Errorf(npmerrors.AppendIPSet, true, msg)
@@ -592,8 +594,9 @@ func (iMgr *IPSetManager) clearDirtyCache() {
 	iMgr.dirtyCache.reset()
 }
 
-// validateIPSetMemberIP helps valid if a member added to an HashSet has valid IP or CIDR
-func validateIPSetMemberIP(ip string) bool {
+// validateIPSetMemberIP helps valid if a member added to an HashSet has valid IP or CIDR.
+// IPv6 members are only valid if allowIPv6 is true.
+func validateIPSetMemberIP(ip string, allowIPv6 bool) bool {
 	// possible formats
 	// 192.168.0.1
 	// 192.168.0.1,tcp:25227
@@ -605,5 +608,5 @@ func validateIPSetMemberIP(ip string) bool {
 	ipDetails := strings.Split(ip, ",")
 	ipField := strings.Split(ipDetails[0], " ")
 
-	return util.IsIPV4(ipField[0])
+	return util.IsIPV4(ipField[0]) || (allowIPv6 && util.IsIPV6(ipField[0]))
 }
@@ -18,7 +18,7 @@ const (
 	ipsetFlushAndDestroyString = "ipset flush && ipset destroy"
 
 	azureNPMPrefix        = "azure-npm-"
-	azureNPMRegex         = "azure-npm-\\d+"
+	azureNPMRegex         = "azure-npm-\\d+(-6)?"
 	positiveRefsRegex     = "References: [1-9]"
 	referenceGrepLookBack = "5"
 	maxLinesToPrint       = 10
@@ -39,6 +39,8 @@ const (
 	ipsetIPPortHashFlag = "hash:ip,port"
 	ipsetMaxelemName    = "maxelem"
 	ipsetMaxelemNum     = "4294967295"
+	ipsetFamilyName     = "family"
+	ipsetFamilyInet6    = "inet6"
 
 	// constants for parsing ipset save
 	createStringWithSpace = "create "
@@ -731,6 +733,9 @@ func (iMgr *IPSetManager) flushSetForApply(creator *ioutil.FileCreator, prefixed
 	sectionID := sectionID(destroySectionPrefix, prefixedName)
 	hashedName := util.GetHashedName(prefixedName)
 	creator.AddLine(sectionID, errorHandlers, ipsetFlushFlag, hashedName) // flush set
+	if iMgr.iMgrCfg.EnableIPv6 {
+		creator.AddLine(ipv6SectionID(sectionID), errorHandlers, ipsetFlushFlag, IPv6SetName(hashedName))
+	}
 }
 
 func (iMgr *IPSetManager) destroySetForApply(creator *ioutil.FileCreator, prefixedName string) {
@@ -754,6 +759,9 @@ func (iMgr *IPSetManager) destroySetForApply(creator *ioutil.FileCreator, prefix
 	sectionID := sectionID(destroySectionPrefix, prefixedName)
 	hashedName := util.GetHashedName(prefixedName)
 	creator.AddLine(sectionID, errorHandlers, ipsetDestroyFlag, hashedName) // destroy set
+	if iMgr.iMgrCfg.EnableIPv6 {
+		creator.AddLine(ipv6SectionID(sectionID), errorHandlers, ipsetDestroyFlag, IPv6SetName(hashedName))
+	}
 }
 
 func (iMgr *IPSetManager) createSetForApply(creator *ioutil.FileCreator, set *IPSet) {
@@ -790,6 +798,18 @@ func (iMgr *IPSetManager) createSetForApply(creator *ioutil.FileCreator, set *IP
 	}
 	sectionID := sectionID(addOrUpdateSectionPrefix, prefixedName)
 	creator.AddLine(sectionID, errorHandlers, specs...) // create set
+
+	if iMgr.iMgrCfg.EnableIPv6 {
+		// the inet6 counterpart has its own section so that a failure for one family doesn't abort the other
+		ipv6Specs := []string{ipsetCreateFlag, IPv6SetName(set.HashedName), ipsetExistFlag, methodFlag}
+		if set.Kind == HashSet {
+			ipv6Specs = append(ipv6Specs, ipsetFamilyName, ipsetFamilyInet6)
+		}
+		if set.Type == CIDRBlocks {
+			ipv6Specs = append(ipv6Specs, ipsetMaxelemName, ipsetMaxelemNum)
+		}
+		creator.AddLine(ipv6SectionID(sectionID), errorHandlers, ipv6Specs...)
+	}
 }
 
 func (iMgr *IPSetManager) deleteMemberForApply(creator *ioutil.FileCreator, set *IPSet, sectionID, member string) {
@@ -813,7 +833,16 @@ func (iMgr *IPSetManager) deleteMemberForApply(creator *ioutil.FileCreator, set
 		member = splitMember[0]
 	}
 
-	creator.AddLine(sectionID, errorHandlers, ipsetDeleteFlag, set.HashedName, member) // delete member
+	if set.Kind == ListSet {
+		creator.AddLine(sectionID, errorHandlers, ipsetDeleteFlag, set.HashedName, member) // delete member
+		if iMgr.iMgrCfg.EnableIPv6 {
+			creator.AddLine(ipv6SectionID(sectionID), errorHandlers, ipsetDeleteFlag, IPv6SetName(set.HashedName), IPv6SetName(member))
+		}
+		return
+	}
+
+	hashedName, sectionID := memberSetAndSection(set, sectionID, member)
+	creator.AddLine(sectionID, errorHandlers, ipsetDeleteFlag, hashedName, member) // delete member
 }
 
 func (iMgr *IPSetManager) addMemberForApply(creator *ioutil.FileCreator, set *IPSet, sectionID, member string) {
@@ -847,13 +876,37 @@ func (iMgr *IPSetManager) addMemberForApply(creator *ioutil.FileCreator, set *IP
 			},
 		}
 	}
-	creator.AddLine(sectionID, errorHandlers, ipsetAddFlag, set.HashedName, member) // add member
+	if set.Kind == ListSet {
+		creator.AddLine(sectionID, errorHandlers, ipsetAddFlag, set.HashedName, member) // add member
+		if iMgr.iMgrCfg.EnableIPv6 {
+			creator.AddLine(ipv6SectionID(sectionID), errorHandlers, ipsetAddFlag, IPv6SetName(set.HashedName), IPv6SetName(member))
+		}
+		return
+	}
+
+	hashedName, sectionID := memberSetAndSection(set, sectionID, member)
+	creator.AddLine(sectionID, errorHandlers, ipsetAddFlag, hashedName, member) // add member
+}
+
+// memberSetAndSection returns the kernel set and restore file section for a member of a hash set.
+// IPv6 members belong to the set's inet6 counterpart. Members are only IPv6 if EnableIPv6 is true (see validateIPSetMemberIP).
+func memberSetAndSection(set *IPSet, sectionID, member string) (hashedName, memberSectionID string) {
+	// possible formats are the same as in validateIPSetMemberIP
+	ip := strings.Split(strings.Split(member, ",")[0], space)[0]
+	if util.IsIPV6(ip) {
+		return IPv6SetName(set.HashedName), ipv6SectionID(sectionID)
+	}
+	return set.HashedName, sectionID
 }
 
 func sectionID(prefix, prefixedName string) string {
 	return fmt.Sprintf("%s-%s", prefix, prefixedName)
 }
 
+func ipv6SectionID(sectionID string) string {
+	return sectionID + ipv6SetSuffix
+}
+
 func readByteLinesToMap(output []byte) map[string]struct{} {
 	readIndex := 0
 	var line []byte
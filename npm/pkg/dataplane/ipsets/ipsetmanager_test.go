@@ -1561,12 +1561,27 @@ func TestValidateIPSetMemberIP(t *testing.T) {
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			got := validateIPSetMemberIP(tt.ipblock)
+			got := validateIPSetMemberIP(tt.ipblock, false)
 			require.Equal(t, tt.want, got)
 		})
 	}
 }
 
+func TestValidateIPSetMemberIPWithIPv6(t *testing.T) {
+	for member, want := range map[string]bool{
+		"1.1.1.1":             true,
+		"fd00::1":             true,
+		"fd00::/64":           true,
+		"fd00::/64 nomatch":   true,
+		"fd00::1,tcp:25227":   true,
+		"fd00::/129":          false,
+		"::ffff:1.1.1.1":      false,
+		"fd00::1,tcp:invalid": true, // only the ip is validated
+	} {
+		require.Equal(t, want, validateIPSetMemberIP(member, true), member)
+	}
+}
+
 func assertExpectedInfo(t *testing.T, iMgr *IPSetManager, info *expectedInfo) {
 	// 1. assert cache contents
 	// 1.1. make sure the main cache is equal, including members and references
@@ -189,8 +189,11 @@ func (pMgr *PolicyManager) bootup(_ []string) error {
 	klog.Infof("booting up iptables Azure chains")
 
 	// 0.1. Detect iptables version
-	if err := pMgr.detectIptablesVersion(); err != nil {
-		return npmerrors.SimpleErrorWrapper("failed to detect iptables version", err)
+	// The IPv6 PolicyManager boots up after the IPv4 one and uses the same version of ip6tables.
+	if !pMgr.IPv6 {
+		if err := pMgr.detectIptablesVersion(); err != nil {
+			return npmerrors.SimpleErrorWrapper("failed to detect iptables version", err)
+		}
 	}
 
 	// Stop reconciling so we don't contend for iptables, and so we don't update the staleChains at the same time as reconcile()
@@ -221,7 +224,7 @@ func (pMgr *PolicyManager) bootupAfterDetectAndCleanup() error {
 			deprecatedErrCode, deprecatedErr.Error())
 	}
 
-	currentChains, err := ioutil.AllCurrentAzureChains(pMgr.ioShim.Exec, util.IptablesDefaultWaitTime)
+	currentChains, err := ioutil.AllCurrentAzureChainsWithCommand(pMgr.ioShim.Exec, pMgr.forFamily(util.Iptables), util.IptablesDefaultWaitTime)
 	if err != nil {
 		return npmerrors.SimpleErrorWrapper("failed to get current chains for bootup", err)
 	}
@@ -230,7 +233,7 @@ func (pMgr *PolicyManager) bootupAfterDetectAndCleanup() error {
 
 	// 2. cleanup old NPM chains, and configure base chains and their rules.
 	creator := pMgr.creatorForBootup(currentChains)
-	if err := restore(creator); err != nil {
+	if err := pMgr.restore(creator); err != nil {
 		return npmerrors.SimpleErrorWrapper("failed to run iptables-restore for bootup", err)
 	}
 
@@ -340,7 +343,7 @@ func (pMgr *PolicyManager) cleanupOtherIptables() error {
 	}
 
 	// 2. get current chains
-	currentChains, err := ioutil.AllCurrentAzureChains(pMgr.ioShim.Exec, util.IptablesDefaultWaitTime)
+	currentChains, err := ioutil.AllCurrentAzureChainsWithCommand(pMgr.ioShim.Exec, pMgr.forFamily(util.Iptables), util.IptablesDefaultWaitTime)
 	if err != nil {
 		return npmerrors.SimpleErrorWrapper("[cleanup] failed to get current chains for bootup", err)
 	}
@@ -368,7 +371,7 @@ func (pMgr *PolicyManager) cleanupOtherIptables() error {
 	}
 
 	creator := pMgr.creatorForCleanup(chains)
-	if err := restore(creator); err != nil {
+	if err := pMgr.restore(creator); err != nil {
 		msg := "[cleanup] failed to flush all chains with error: %s"
 		klog.Infof(msg, err.Error())
 		metrics.SendErrorLogAndMetric(util.IptmID, msg, err.Error())
@@ -520,9 +523,10 @@ func (pMgr *PolicyManager) ignoreErrorsAndRunIPTablesCommand(ignored []*exitErro
 	allArgs := []string{util.IptablesWaitFlag, util.IptablesDefaultWaitTime, operationFlag}
 	allArgs = append(allArgs, args...)
 
-	klog.Infof("executing iptables command [%s] with args %v", util.Iptables, allArgs)
+	iptablesCmd := pMgr.forFamily(util.Iptables)
+	klog.Infof("executing iptables command [%s] with args %v", iptablesCmd, allArgs)
 
-	command := pMgr.ioShim.Exec.Command(util.Iptables, allArgs...)
+	command := pMgr.ioShim.Exec.Command(iptablesCmd, allArgs...)
 	output, err := command.CombinedOutput()
 
 	var exitError utilexec.ExitError
@@ -532,14 +536,14 @@ func (pMgr *PolicyManager) ignoreErrorsAndRunIPTablesCommand(ignored []*exitErro
 		outputString := strings.TrimSuffix(string(output), "\n")
 		for _, info := range ignored {
 			if errCode == info.exitCode && strings.Contains(outputString, info.stdErr) {
-				klog.Infof("%s. not able to run iptables command [%s %s]. exit code: %d, output: %s", info.messageToLog, util.Iptables, allArgsString, errCode, outputString)
+				klog.Infof("%s. not able to run iptables command [%s %s]. exit code: %d, output: %s", info.messageToLog, iptablesCmd, allArgsString, errCode, outputString)
 				return errCode, nil
 			}
 		}
 		if errCode > 0 {
-			metrics.SendErrorLogAndMetric(util.IptmID, "error: There was an error running command: [%s %s] Stderr: [%v, %s]", util.Iptables, allArgsString, exitError, outputString)
+			metrics.SendErrorLogAndMetric(util.IptmID, "error: There was an error running command: [%s %s] Stderr: [%v, %s]", iptablesCmd, allArgsString, exitError, outputString)
 		}
-		return errCode, fmt.Errorf("failed to run iptables command [%s %s] Stderr: [%s]. err: [%w]", util.Iptables, allArgsString, outputString, exitError)
+		return errCode, fmt.Errorf("failed to run iptables command [%s %s] Stderr: [%s]. err: [%w]", iptablesCmd, allArgsString, outputString, exitError)
 	}
 	return 0, nil
 }
@@ -566,10 +570,9 @@ func (pMgr *PolicyManager) creatorForBootup(currentChains map[string]struct{}) *
 	}
 
 	// add AZURE-NPM-INGRESS chain rules
-	ingressDropSpecs := []string{util.IptablesAppendFlag, util.IptablesAzureIngressChain, util.IptablesJumpFlag, util.IptablesDrop}
-	ingressDropSpecs = append(ingressDropSpecs, onMarkSpecs(util.IptablesAzureIngressDropMarkHex)...)
-	ingressDropSpecs = append(ingressDropSpecs, commentSpecs(fmt.Sprintf("DROP-ON-INGRESS-DROP-MARK-%s", util.IptablesAzureIngressDropMarkHex))...)
-	creator.AddLine("", nil, ingressDropSpecs...)
+	for _, specs := range pMgr.dropBaseRules(Ingress) {
+		creator.AddLine("", nil, specs...)
+	}
 
 	// add AZURE-NPM-INGRESS-ALLOW-MARK chain
 	markIngressAllowSpecs := []string{util.IptablesAppendFlag, util.IptablesAzureIngressAllowMarkChain}
@@ -579,10 +582,9 @@ func (pMgr *PolicyManager) creatorForBootup(currentChains map[string]struct{}) *
 	creator.AddLine("", nil, util.IptablesAppendFlag, util.IptablesAzureIngressAllowMarkChain, util.IptablesJumpFlag, util.IptablesAzureEgressChain)
 
 	// add AZURE-NPM-EGRESS chain rules
-	egressDropSpecs := []string{util.IptablesAppendFlag, util.IptablesAzureEgressChain, util.IptablesJumpFlag, util.IptablesDrop}
-	egressDropSpecs = append(egressDropSpecs, onMarkSpecs(util.IptablesAzureEgressDropMarkHex)...)
-	egressDropSpecs = append(egressDropSpecs, commentSpecs(fmt.Sprintf("DROP-ON-EGRESS-DROP-MARK-%s", util.IptablesAzureEgressDropMarkHex))...)
-	creator.AddLine("", nil, egressDropSpecs...)
+	for _, specs := range pMgr.dropBaseRules(Egress) {
+		creator.AddLine("", nil, specs...)
+	}
 
 	jumpOnIngressMatchSpecs := []string{util.IptablesAppendFlag, util.IptablesAzureEgressChain, util.IptablesJumpFlag, util.IptablesAzureAcceptChain}
 	jumpOnIngressMatchSpecs = append(jumpOnIngressMatchSpecs, onMarkSpecs(util.IptablesAzureIngressAllowMarkHex)...)
@@ -595,6 +597,39 @@ func (pMgr *PolicyManager) creatorForBootup(currentChains map[string]struct{}) *
 	return creator
 }
 
+// dropBaseRules returns the base rules of AZURE-NPM-INGRESS or AZURE-NPM-EGRESS which drop flows on the drop mark
+// and, when verdict logging is enabled, log the flows finally dropped or audited by NetworkPolicies.
+// The jumps to BaselineAdminNetworkPolicy chains go behind these rules.
+func (pMgr *PolicyManager) dropBaseRules(direction Direction) [][]string {
+	chain, dropMark, auditMark := util.IptablesAzureIngressChain, util.IptablesAzureIngressDropMarkHex, util.IptablesAzureIngressAuditMarkHex
+	comment := fmt.Sprintf("DROP-ON-INGRESS-DROP-MARK-%s", dropMark)
+	if direction == Egress {
+		chain, dropMark, auditMark = util.IptablesAzureEgressChain, util.IptablesAzureEgressDropMarkHex, util.IptablesAzureEgressAuditMarkHex
+		comment = fmt.Sprintf("DROP-ON-EGRESS-DROP-MARK-%s", dropMark)
+	}
+
+	dropSpecs := []string{util.IptablesAppendFlag, chain, util.IptablesJumpFlag, util.IptablesDrop}
+	dropSpecs = append(dropSpecs, onMarkSpecs(dropMark)...)
+	dropSpecs = append(dropSpecs, commentSpecs(comment)...)
+	if pMgr.VerdictLog == nil {
+		return [][]string{dropSpecs}
+	}
+
+	return [][]string{
+		pMgr.finalVerdictLogSpecs(chain, LoggedDrop, direction, dropMark),
+		dropSpecs,
+		pMgr.finalVerdictLogSpecs(chain, LoggedAudit, direction, auditMark),
+	}
+}
+
+// finalVerdictLogSpecs logs the flows finally dropped, or audited, by NetworkPolicies.
+// The NetworkPolicy's verdict log ID is carried in the packet mark.
+func (pMgr *PolicyManager) finalVerdictLogSpecs(chain string, verdict LoggedVerdict, direction Direction, mark string) []string {
+	specs := []string{util.IptablesAppendFlag, chain}
+	specs = append(specs, nflogSpecs(pMgr.VerdictLog, finalRuleVerdictLogPrefix(verdict, direction))...)
+	return append(specs, onMarkSpecs(mark)...)
+}
+
 // add/reposition the jump from FORWARD chain to AZURE-NPM chain to be in the correct position based on config:
 // option 1) jump to AZURE-NPM chain should be the first rule
 // option 2) jump to AZURE-NPM chain should be after the jump to KUBE-SERVICES chain
@@ -672,7 +707,7 @@ func (pMgr *PolicyManager) positionAzureChainJumpRule() error {
 // returns 0 if the chain does not exist
 // this function has a direct comparison in NPM v1 iptables manager (iptm.go)
 func (pMgr *PolicyManager) chainLineNumber(chain string) (int, error) {
-	listForwardEntriesCommand := pMgr.ioShim.Exec.Command(util.Iptables, listForwardEntriesArgs...)
+	listForwardEntriesCommand := pMgr.ioShim.Exec.Command(pMgr.forFamily(util.Iptables), listForwardEntriesArgs...)
 	grepCommand := pMgr.ioShim.Exec.Command(ioutil.Grep, chain)
 	searchResults, gotMatches, err := ioutil.PipeCommandToGrep(listForwardEntriesCommand, grepCommand)
 	if err != nil {
@@ -703,3 +738,13 @@ func onMarkSpecs(mark string) []string {
 		mark,
 	}
 }
+
+func notOnMarkSpecs(mark string) []string {
+	return []string{
+		util.IptablesModuleFlag,
+		util.IptablesMarkVerb,
+		util.IptablesNotFlag,
+		util.IptablesMarkFlag,
+		mark,
+	}
+}
@@ -313,6 +313,38 @@ func TestCreatorForBootup(t *testing.T) {
 	}
 }
 
+func TestCreatorForBootupWithVerdictLogging(t *testing.T) {
+	ioshim := common.NewMockIOShim(nil)
+	defer ioshim.VerifyCalls(t, nil)
+	cfg := *ipsetConfig
+	cfg.VerdictLog = &VerdictLogCfg{NflogGroup: 100, RateLimitPerSecond: 5}
+	pMgr := NewPolicyManager(ioshim, &cfg)
+	creator := pMgr.creatorForBootup(stringsToMap([]string{}))
+	actualLines := strings.Split(creator.ToString(), "\n")
+	nflog := "-j NFLOG --nflog-group 100 --nflog-prefix %s -m limit --limit 5/second --limit-burst 5"
+	expectedLines := []string{
+		"*filter",
+		":AZURE-NPM - -",
+		":AZURE-NPM-INGRESS - -",
+		":AZURE-NPM-INGRESS-ALLOW-MARK - -",
+		":AZURE-NPM-EGRESS - -",
+		":AZURE-NPM-ACCEPT - -",
+		"-A AZURE-NPM-INGRESS " + fmt.Sprintf(nflog, "npm:DROP:IN") + " -m mark --mark 0x400/0x400",
+		"-A AZURE-NPM-INGRESS -j DROP -m mark --mark 0x400/0x400 -m comment --comment DROP-ON-INGRESS-DROP-MARK-0x400/0x400",
+		"-A AZURE-NPM-INGRESS " + fmt.Sprintf(nflog, "npm:AUDIT:IN") + " -m mark --mark 0x40/0x40",
+		"-A AZURE-NPM-INGRESS-ALLOW-MARK -j MARK --set-mark 0x200/0x200 -m comment --comment SET-INGRESS-ALLOW-MARK-0x200/0x200",
+		"-A AZURE-NPM-INGRESS-ALLOW-MARK -j AZURE-NPM-EGRESS",
+		"-A AZURE-NPM-EGRESS " + fmt.Sprintf(nflog, "npm:DROP:OUT") + " -m mark --mark 0x800/0x800",
+		"-A AZURE-NPM-EGRESS -j DROP -m mark --mark 0x800/0x800 -m comment --comment DROP-ON-EGRESS-DROP-MARK-0x800/0x800",
+		"-A AZURE-NPM-EGRESS " + fmt.Sprintf(nflog, "npm:AUDIT:OUT") + " -m mark --mark 0x20/0x20",
+		"-A AZURE-NPM-EGRESS -j AZURE-NPM-ACCEPT -m mark --mark 0x200/0x200 -m comment --comment ACCEPT-ON-INGRESS-ALLOW-MARK-0x200/0x200",
+		"-A AZURE-NPM-ACCEPT -j ACCEPT",
+		"COMMIT",
+		"",
+	}
+	dptestutils.AssertEqualLines(t, expectedLines, actualLines)
+}
+
 func sortFlushes(lines []string) []string {
 	result := make([]string, len(lines))
 	copy(result, lines)
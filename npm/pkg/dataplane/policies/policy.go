@@ -29,6 +29,15 @@ type NPMNetworkPolicy struct {
 	// and not from pod selector IPSets, including children of a NestedLabelOfPod ipset
 	RuleIPSets []*ipsets.TranslatedIPSet
 	ACLs       []*ACLPolicy
+	// Tier decides where the policy is evaluated relative to NetworkPolicies. The zero value is the NetworkPolicy tier.
+	Tier PolicyTier
+	// Priority is only used in the AdminTier. Policies with lower values are evaluated first.
+	Priority int32
+	// AuditOnly is only used in Linux. When verdict logging is enabled, dropped flows are logged instead of dropped.
+	AuditOnly bool
+	// FQDNPatterns are the domain names of the FQDN egress annotation.
+	// The IPs which DNS responses resolve for matching names are added to the FQDN set in RuleIPSets.
+	FQDNPatterns []string
 	// podIP is key and endpoint ID as value
 	// Will be populated by dataplane and policy manager
 	PodEndpoints map[string]string
@@ -42,6 +51,18 @@ func NewNPMNetworkPolicy(netPolName, netPolNamespace string) *NPMNetworkPolicy {
 	}
 }
 
+// NewAdminNPMNetworkPolicy creates an NPMNetworkPolicy for a cluster-scoped AdminNetworkPolicy or BaselineAdminNetworkPolicy.
+func NewAdminNPMNetworkPolicy(name string, tier PolicyTier, priority int32) *NPMNetworkPolicy {
+	kind := tier.kind()
+	return &NPMNetworkPolicy{
+		Namespace:   kind,
+		PolicyKey:   fmt.Sprintf("%s/%s", kind, name),
+		ACLPolicyID: aclPolicyID(kind, name),
+		Tier:        tier,
+		Priority:    priority,
+	}
+}
+
 func (netPol *NPMNetworkPolicy) HasCIDRRules() bool {
 	for _, set := range netPol.RuleIPSets {
 		if set.Metadata.Type == ipsets.CIDRBlocks {
@@ -51,6 +72,16 @@ func (netPol *NPMNetworkPolicy) HasCIDRRules() bool {
 	return false
 }
 
+// FQDNSet returns the set which holds the resolved IPs of FQDNPatterns, or nil if the policy has no FQDN egress rule.
+func (netPol *NPMNetworkPolicy) FQDNSet() *ipsets.IPSetMetadata {
+	for _, set := range netPol.RuleIPSets {
+		if set.Metadata.Type == ipsets.FQDN {
+			return set.Metadata
+		}
+	}
+	return nil
+}
+
 func (netPol *NPMNetworkPolicy) AllPodSelectorIPSets() []*ipsets.TranslatedIPSet {
 	return append(netPol.PodSelectorIPSets, netPol.ChildPodSelectorIPSets...)
 }
@@ -145,10 +176,19 @@ func NormalizePolicy(networkPolicy *NPMNetworkPolicy) {
 }
 
 func ValidatePolicy(networkPolicy *NPMNetworkPolicy) error {
+	if !networkPolicy.Tier.isKnown() {
+		return npmerrors.SimpleError(fmt.Sprintf("NetPol %s has unknown tier [%s]", networkPolicy.PolicyKey, networkPolicy.Tier))
+	}
+	if util.IsWindowsDP() && networkPolicy.Tier != NetworkPolicyTier {
+		return npmerrors.SimpleError(fmt.Sprintf("NetPol %s has unsupported tier [%s] on Windows", networkPolicy.PolicyKey, networkPolicy.Tier))
+	}
 	for _, aclPolicy := range networkPolicy.ACLs {
 		if !aclPolicy.hasKnownTarget() {
 			return npmerrors.SimpleError(fmt.Sprintf("ACL policy for NetPol %s has unknown target [%s]", networkPolicy.PolicyKey, aclPolicy.Target))
 		}
+		if aclPolicy.Target == Passed && networkPolicy.Tier != AdminTier {
+			return npmerrors.SimpleError(fmt.Sprintf("ACL policy for NetPol %s has target [%s] outside of the %s tier", networkPolicy.PolicyKey, Passed, AdminTier))
+		}
 		if !aclPolicy.hasKnownDirection() {
 			return npmerrors.SimpleError(fmt.Sprintf("ACL policy for NetPol %s has unknown direction [%s]", networkPolicy.PolicyKey, aclPolicy.Direction))
 		}
@@ -237,7 +277,7 @@ func (aclPolicy *ACLPolicy) hasKnownProtocol() bool {
 }
 
 func (aclPolicy *ACLPolicy) hasKnownTarget() bool {
-	return aclPolicy.Target == Allowed || aclPolicy.Target == Dropped
+	return aclPolicy.Target == Allowed || aclPolicy.Target == Dropped || aclPolicy.Target == Passed
 }
 
 func (aclPolicy *ACLPolicy) satisifiesPortAndProtocolConstraints() bool {
@@ -345,8 +385,40 @@ const (
 	Allowed Verdict = "ALLOW"
 	// Dropped is denying a flow
 	Dropped Verdict = "DROP"
+	// Passed skips the remaining policies in the AdminTier so that NetworkPolicies decide the flow
+	Passed Verdict = "PASS"
+)
+
+// PolicyTier orders groups of policies.
+// AdminTier policies are evaluated before NetworkPolicies, which are evaluated before BaselineTier policies.
+type PolicyTier string
+
+const (
+	// NetworkPolicyTier holds namespaced NetworkPolicies
+	NetworkPolicyTier PolicyTier = ""
+	// AdminTier holds AdminNetworkPolicies, which namespace owners cannot override
+	AdminTier PolicyTier = "Admin"
+	// BaselineTier holds BaselineAdminNetworkPolicies, which only apply to traffic that no NetworkPolicy decided
+	BaselineTier PolicyTier = "Baseline"
 )
 
+func (tier PolicyTier) isKnown() bool {
+	return tier == NetworkPolicyTier || tier == AdminTier || tier == BaselineTier
+}
+
+// kind is used in place of a namespace in the key of cluster-scoped policies.
+// Namespace names are lowercase, so the key can't collide with a NetworkPolicy's key.
+func (tier PolicyTier) kind() string {
+	switch tier {
+	case AdminTier:
+		return "AdminNetworkPolicy"
+	case BaselineTier:
+		return "BaselineAdminNetworkPolicy"
+	default:
+		return ""
+	}
+}
+
 // Protocol can be TCP, UDP, SCTP, or unspecified since they are currently supported in networkpolicy.
 // Protocol value is case-sensitive (Capital now).
 // TODO: Need to remove this dependency on case-sensitivity.
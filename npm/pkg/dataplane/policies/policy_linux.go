@@ -72,6 +72,10 @@ func (networkPolicy *NPMNetworkPolicy) commentForJump(direction UniqueDirection)
 	if len(networkPolicy.PodSelectorList) > 0 {
 		podSelectorComment = commentForInfos(networkPolicy.PodSelectorList)
 	}
+	if networkPolicy.Tier != NetworkPolicyTier {
+		// cluster-scoped policies select pods across namespaces
+		return fmt.Sprintf("%s-POLICY-%s-%s-%s", prefix, networkPolicy.PolicyKey, toFrom, podSelectorComment)
+	}
 	return fmt.Sprintf("%s-POLICY-%s-%s-%s-IN-ns-%s", prefix, networkPolicy.PolicyKey, toFrom, podSelectorComment, networkPolicy.Namespace)
 }
 
@@ -91,13 +95,16 @@ func (info SetInfo) comment() string {
 	return "!" + name
 }
 
-func (info SetInfo) matchSetSpecs(matchString string) []string {
+func (info SetInfo) matchSetSpecs(matchString string, ipv6 bool) []string {
 	specs := make([]string, 0, maxLengthForMatchSetSpecs)
 	specs = append(specs, util.IptablesModuleFlag, util.IptablesSetModuleFlag)
 	if !info.Included {
 		specs = append(specs, util.IptablesNotFlag)
 	}
 	hashedSetName := info.IPSet.GetHashedName()
+	if ipv6 {
+		hashedSetName = info.IPSet.GetIPv6HashedName()
+	}
 	specs = append(specs, util.IptablesMatchSetFlag, hashedSetName, matchString)
 	return specs
 }
@@ -128,9 +135,12 @@ func (aclPolicy *ACLPolicy) comment() string {
 	}
 
 	builder := strings.Builder{}
-	if aclPolicy.Target == Allowed {
+	switch aclPolicy.Target {
+	case Allowed:
 		builder.WriteString("ALLOW")
-	} else {
+	case Passed:
+		builder.WriteString("PASS")
+	default:
 		builder.WriteString("DROP")
 	}
 
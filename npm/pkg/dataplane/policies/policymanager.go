@@ -39,11 +39,18 @@ type PolicyManagerCfg struct {
 	// The zero value is valid.
 	// A NetworkPolicy's ACLs are always in the same batch, and there will be at least one NetworkPolicy per batch.
 	MaxBatchedACLsPerPod int
+	// IPv6 only affects Linux. When true, the PolicyManager programs ip6tables and matches on the inet6 counterpart of each ipset.
+	IPv6 bool
+	// VerdictLog only affects Linux. When set, the PolicyManager sends the packets matching each ACL, and the packets
+	// finally dropped by NetworkPolicies, to an NFLOG group.
+	VerdictLog *VerdictLogCfg
 }
 
 type PolicyMap struct {
 	sync.RWMutex
 	cache map[string]*NPMNetworkPolicy
+	// verdictLogIDs is only used in Linux when verdict logging is enabled
+	verdictLogIDs *verdictLogIDs
 }
 
 type reconcileManager struct {
@@ -68,7 +75,8 @@ type PolicyManager struct {
 func NewPolicyManager(ioShim *common.IOShim, cfg *PolicyManagerCfg) *PolicyManager {
 	return &PolicyManager{
 		policyMap: &PolicyMap{
-			cache: make(map[string]*NPMNetworkPolicy),
+			cache:         make(map[string]*NPMNetworkPolicy),
+			verdictLogIDs: newVerdictLogIDs(),
 		},
 		ioShim:      ioShim,
 		staleChains: newStaleChains(),
@@ -126,6 +134,32 @@ func (pMgr *PolicyManager) GetPolicy(policyKey string) (*NPMNetworkPolicy, bool)
 	return policy, ok
 }
 
+// GetPolicyByHash returns the policy whose key has the hash, which is how Linux chain names and verdict log prefixes identify a policy.
+func (pMgr *PolicyManager) GetPolicyByHash(policyHash string) (*NPMNetworkPolicy, bool) {
+	pMgr.policyMap.RLock()
+	defer pMgr.policyMap.RUnlock()
+
+	for policyKey, policy := range pMgr.policyMap.cache {
+		if util.Hash(policyKey) == policyHash {
+			return policy, true
+		}
+	}
+	return nil, false
+}
+
+// GetPolicyByVerdictLogID returns the NetworkPolicy whose verdict log ID is set in the mark of the packets it drops.
+func (pMgr *PolicyManager) GetPolicyByVerdictLogID(id uint32) (*NPMNetworkPolicy, bool) {
+	pMgr.policyMap.RLock()
+	defer pMgr.policyMap.RUnlock()
+
+	policyKey, ok := pMgr.policyMap.verdictLogIDs.keys[id]
+	if !ok {
+		return nil, false
+	}
+	policy, ok := pMgr.policyMap.cache[policyKey]
+	return policy, ok
+}
+
 func (pMgr *PolicyManager) AddPolicies(policies []*NPMNetworkPolicy, endpointList map[string]string) error {
 	nonEmptyPolicies := make([]*NPMNetworkPolicy, 0, len(policies))
 	for _, policy := range policies {
@@ -160,6 +194,11 @@ func (pMgr *PolicyManager) AddPolicies(policies []*NPMNetworkPolicy, endpointLis
 		// In Windows, Prometheus metrics may be off at this point since we don't know how many endpoints had rules applied successfully.
 		msg := fmt.Sprintf("failed to add policy: %s", err.Error())
 		metrics.SendErrorLogAndMetric(util.IptmID, "error: %s", msg)
+		for _, policy := range nonEmptyPolicies {
+			if _, ok := pMgr.policyMap.cache[policy.PolicyKey]; !ok {
+				pMgr.policyMap.verdictLogIDs.release(policy.PolicyKey)
+			}
+		}
 		return npmerrors.Errorf(npmerrors.AddPolicy, false, msg)
 	}
 
@@ -220,6 +259,7 @@ func (pMgr *PolicyManager) RemovePolicy(policyKey string) error {
 
 	// remove policy from cache
 	delete(pMgr.policyMap.cache, policyKey)
+	pMgr.policyMap.verdictLogIDs.release(policyKey)
 	return nil
 }
 
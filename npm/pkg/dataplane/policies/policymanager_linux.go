@@ -4,6 +4,8 @@ package policies
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/Azure/azure-container-networking/npm/metrics"
 	"github.com/Azure/azure-container-networking/npm/util"
@@ -51,7 +53,7 @@ func (pMgr *PolicyManager) addPolicies(networkPolicies []*NPMNetworkPolicy, _ ma
 	defer pMgr.reconcileManager.forceUnlock()
 
 	timer := metrics.StartNewTimer()
-	err := restore(creator)
+	err := pMgr.restore(creator)
 	metrics.RecordIPTablesRestoreLatency(timer, metrics.CreateOp)
 	if err != nil {
 		metrics.IncIPTablesRestoreFailures(metrics.CreateOp)
@@ -82,7 +84,7 @@ func (pMgr *PolicyManager) removePolicy(networkPolicy *NPMNetworkPolicy, _ map[s
 
 	// 2. Flush the policy chains and deactivate NPM (if necessary).
 	timer := metrics.StartNewTimer()
-	restoreErr := restore(creator)
+	restoreErr := pMgr.restore(creator)
 	metrics.RecordIPTablesRestoreLatency(timer, metrics.DeleteOp)
 	if restoreErr != nil {
 		metrics.IncIPTablesRestoreFailures(metrics.DeleteOp)
@@ -96,8 +98,8 @@ func (pMgr *PolicyManager) removePolicy(networkPolicy *NPMNetworkPolicy, _ map[s
 	return nil
 }
 
-func restore(creator *ioutil.FileCreator) error {
-	err := creator.RunCommandWithFile(util.IptablesRestore, util.IptablesWaitFlag, util.IptablesDefaultWaitTime, util.IptablesRestoreTableFlag, util.IptablesFilterTable, util.IptablesRestoreNoFlushFlag)
+func (pMgr *PolicyManager) restore(creator *ioutil.FileCreator) error {
+	err := creator.RunCommandWithFile(pMgr.forFamily(util.IptablesRestore), util.IptablesWaitFlag, util.IptablesDefaultWaitTime, util.IptablesRestoreTableFlag, util.IptablesFilterTable, util.IptablesRestoreNoFlushFlag)
 	if err != nil {
 		return fmt.Errorf("failed to restore iptables file. err: %w", err)
 	}
@@ -171,11 +173,11 @@ func (pMgr *PolicyManager) deleteJumpRule(policy *NPMNetworkPolicy, direction Un
 	var baseChainName string
 	var chainName string
 	if direction == forIngress {
-		specs = ingressJumpSpecs(policy)
+		specs = ingressJumpSpecs(policy, pMgr.IPv6)
 		baseChainName = util.IptablesAzureIngressChain
 		chainName = policy.ingressChainName()
 	} else {
-		specs = egressJumpSpecs(policy)
+		specs = egressJumpSpecs(policy, pMgr.IPv6)
 		baseChainName = util.IptablesAzureEgressChain
 		chainName = policy.egressChainName()
 	}
@@ -193,18 +195,26 @@ func (pMgr *PolicyManager) deleteJumpRule(policy *NPMNetworkPolicy, direction Un
 	return nil
 }
 
-func ingressJumpSpecs(networkPolicy *NPMNetworkPolicy) []string {
+func ingressJumpSpecs(networkPolicy *NPMNetworkPolicy, ipv6 bool) []string {
 	chainName := networkPolicy.ingressChainName()
 	specs := []string{util.IptablesJumpFlag, chainName}
-	specs = append(specs, matchSetSpecsForNetworkPolicy(networkPolicy, DstMatch)...)
+	specs = append(specs, matchSetSpecsForNetworkPolicy(networkPolicy, DstMatch, ipv6)...)
+	if networkPolicy.Tier == AdminTier {
+		// skip the policy if a higher priority AdminNetworkPolicy passed the flow
+		specs = append(specs, notOnMarkSpecs(util.IptablesAzureIngressPassMarkHex)...)
+	}
 	specs = append(specs, commentSpecs(networkPolicy.commentForJumpToIngress())...)
 	return specs
 }
 
-func egressJumpSpecs(networkPolicy *NPMNetworkPolicy) []string {
+func egressJumpSpecs(networkPolicy *NPMNetworkPolicy, ipv6 bool) []string {
 	chainName := networkPolicy.egressChainName()
 	specs := []string{util.IptablesJumpFlag, chainName}
-	specs = append(specs, matchSetSpecsForNetworkPolicy(networkPolicy, SrcMatch)...)
+	specs = append(specs, matchSetSpecsForNetworkPolicy(networkPolicy, SrcMatch, ipv6)...)
+	if networkPolicy.Tier == AdminTier {
+		// skip the policy if a higher priority AdminNetworkPolicy passed the flow
+		specs = append(specs, notOnMarkSpecs(util.IptablesAzureEgressPassMarkHex)...)
+	}
 	specs = append(specs, commentSpecs(networkPolicy.commentForJumpToEgress())...)
 	return specs
 }
@@ -221,64 +231,241 @@ func (pMgr *PolicyManager) creatorForNewNetworkPolicies(policyChains []string, n
 	}
 
 	// 2. Add all rules for the network policies
-	ingressJumpLineNumber := 1
-	egressJumpLineNumber := 1
+	ingressJumps := newJumpPositions(util.IptablesAzureIngressChain, len(pMgr.dropBaseRules(Ingress)), pMgr.cachedPolicies(forIngress))
+	egressJumps := newJumpPositions(util.IptablesAzureEgressChain, len(pMgr.dropBaseRules(Egress)), pMgr.cachedPolicies(forEgress))
 	for _, networkPolicy := range networkPolicies {
 		// 2.1 add all rules for the policy chain(s)
-		writeNetworkPolicyRules(creator, networkPolicy)
+		var verdictLogID uint32
+		if pMgr.VerdictLog != nil && networkPolicy.Tier == NetworkPolicyTier {
+			verdictLogID = pMgr.policyMap.verdictLogIDs.allocate(networkPolicy.PolicyKey)
+		}
+		writeNetworkPolicyRules(creator, networkPolicy, pMgr.IPv6, pMgr.VerdictLog, verdictLogID)
 
 		// 2.2 add jump rule(s) to the policy chain(s)
 		hasIngress, hasEgress := networkPolicy.hasIngressAndEgress()
 		if hasIngress {
-			ingressJumpSpecs := insertSpecs(util.IptablesAzureIngressChain, ingressJumpLineNumber, ingressJumpSpecs(networkPolicy))
+			ingressJumpSpecs := ingressJumps.addJumpSpecs(networkPolicy, ingressJumpSpecs(networkPolicy, pMgr.IPv6))
 			creator.AddLine("", nil, ingressJumpSpecs...) // TODO error handler
-			ingressJumpLineNumber++
 		}
 		if hasEgress {
-			egressJumpSpecs := insertSpecs(util.IptablesAzureEgressChain, egressJumpLineNumber, egressJumpSpecs(networkPolicy))
+			egressJumpSpecs := egressJumps.addJumpSpecs(networkPolicy, egressJumpSpecs(networkPolicy, pMgr.IPv6))
 			creator.AddLine("", nil, egressJumpSpecs...) // TODO error handler
-			egressJumpLineNumber++
 		}
 	}
 	creator.AddLine("", nil, util.IptablesRestoreCommit)
 	return creator
 }
 
+// jumpPositions decides where jumps to policy chains go in the AZURE-NPM-INGRESS or AZURE-NPM-EGRESS chain.
+// The chain is laid out as follows:
+//  1. jumps to AdminNetworkPolicy chains, ordered by priority
+//  2. jumps to NetworkPolicy chains
+//  3. the base rules dropping on the drop mark, with the final verdict log rules around it when verdict logging is on
+//  4. jumps to BaselineAdminNetworkPolicy chains
+//  5. in AZURE-NPM-EGRESS, the base rule accepting on the ingress allow mark
+type jumpPositions struct {
+	baseChain string
+	// numDropRules counts the base rules which drop on the drop mark, as written by creatorForBootup
+	numDropRules int
+	// adminPolicies have a jump in the base chain, including ones added earlier in the same iptables-restore file
+	adminPolicies []*NPMNetworkPolicy
+	// numNetPolJumps counts jumps to NetworkPolicy chains in the base chain
+	numNetPolJumps int
+	// numNewNetPolJumps counts jumps to NetworkPolicy chains added so far in the iptables-restore file
+	numNewNetPolJumps int
+	// numBaselineJumps counts jumps to BaselineAdminNetworkPolicy chains in the base chain
+	numBaselineJumps int
+}
+
+func newJumpPositions(baseChain string, numDropRules int, cachedPolicies []*NPMNetworkPolicy) *jumpPositions {
+	positions := &jumpPositions{baseChain: baseChain, numDropRules: numDropRules}
+	for _, policy := range cachedPolicies {
+		positions.track(policy)
+	}
+	return positions
+}
+
+func (positions *jumpPositions) track(policy *NPMNetworkPolicy) {
+	switch policy.Tier {
+	case AdminTier:
+		positions.adminPolicies = append(positions.adminPolicies, policy)
+	case BaselineTier:
+		positions.numBaselineJumps++
+	default:
+		positions.numNetPolJumps++
+	}
+}
+
+// addJumpSpecs returns the iptables-restore line which adds the jump specs for the policy at the right position.
+func (positions *jumpPositions) addJumpSpecs(policy *NPMNetworkPolicy, jumpSpecs []string) []string {
+	var lineSpecs []string
+	switch policy.Tier {
+	case AdminTier:
+		lineNumber := 1
+		for _, other := range positions.adminPolicies {
+			if other.evaluatedBefore(policy) {
+				lineNumber++
+			}
+		}
+		lineSpecs = insertSpecs(positions.baseChain, lineNumber, jumpSpecs)
+	case BaselineTier:
+		if positions.baseChain == util.IptablesAzureEgressChain {
+			// stay in front of the base rule accepting on the ingress allow mark
+			lineNumber := len(positions.adminPolicies) + positions.numNetPolJumps + positions.numDropRules + positions.numBaselineJumps + 1
+			lineSpecs = insertSpecs(positions.baseChain, lineNumber, jumpSpecs)
+		} else {
+			lineSpecs = append([]string{util.IptablesAppendFlag, positions.baseChain}, jumpSpecs...)
+		}
+	default:
+		// NetworkPolicies have no order between each other, but keep the order of the file for readability
+		lineNumber := len(positions.adminPolicies) + positions.numNewNetPolJumps + 1
+		lineSpecs = insertSpecs(positions.baseChain, lineNumber, jumpSpecs)
+		positions.numNewNetPolJumps++
+	}
+	positions.track(policy)
+	return lineSpecs
+}
+
+// evaluatedBefore returns true if the AdminNetworkPolicy has precedence over the other.
+// Kubernetes leaves the order of policies with the same priority undefined, so ties are broken by key for determinism.
+func (networkPolicy *NPMNetworkPolicy) evaluatedBefore(other *NPMNetworkPolicy) bool {
+	if networkPolicy.Priority != other.Priority {
+		return networkPolicy.Priority < other.Priority
+	}
+	return networkPolicy.PolicyKey < other.PolicyKey
+}
+
+// cachedPolicies returns the policies in the cache which have a jump in the ingress or egress chain.
+// The caller must hold the policyMap lock.
+func (pMgr *PolicyManager) cachedPolicies(direction UniqueDirection) []*NPMNetworkPolicy {
+	result := make([]*NPMNetworkPolicy, 0, len(pMgr.policyMap.cache))
+	for _, policy := range pMgr.policyMap.cache {
+		hasIngress, hasEgress := policy.hasIngressAndEgress()
+		if (direction == forIngress && hasIngress) || (direction == forEgress && hasEgress) {
+			result = append(result, policy)
+		}
+	}
+	return result
+}
+
 // write rules for the policy chain(s)
-func writeNetworkPolicyRules(creator *ioutil.FileCreator, networkPolicy *NPMNetworkPolicy) {
-	for _, aclPolicy := range networkPolicy.ACLs {
+func writeNetworkPolicyRules(creator *ioutil.FileCreator, networkPolicy *NPMNetworkPolicy, ipv6 bool, verdictLog *VerdictLogCfg, verdictLogID uint32) {
+	// audit mode only makes sense if the flows that would be dropped are logged
+	auditOnly := networkPolicy.AuditOnly && networkPolicy.Tier == NetworkPolicyTier && verdictLog != nil
+	for i, aclPolicy := range networkPolicy.ACLs {
 		var chainName string
-		var actionSpecs []string
+		direction := Ingress
 		if aclPolicy.hasIngress() {
 			chainName = networkPolicy.ingressChainName()
-			if aclPolicy.Target == Allowed {
-				actionSpecs = []string{util.IptablesJumpFlag, util.IptablesAzureIngressAllowMarkChain}
-			} else {
-				actionSpecs = setMarkSpecs(util.IptablesAzureIngressDropMarkHex)
-			}
 		} else {
 			chainName = networkPolicy.egressChainName()
-			if aclPolicy.Target == Allowed {
-				actionSpecs = []string{util.IptablesJumpFlag, util.IptablesAzureAcceptChain}
-			} else {
-				actionSpecs = setMarkSpecs(util.IptablesAzureEgressDropMarkHex)
+			direction = Egress
+		}
+		ruleSpecs := iptablesRuleSpecs(aclPolicy, ipv6)
+
+		// flows dropped by NetworkPolicies are logged by the final drop rule, since another NetworkPolicy may still allow them
+		markedOnly := networkPolicy.Tier == NetworkPolicyTier && aclPolicy.Target == Dropped
+		if verdictLog != nil && !markedOnly {
+			prefix := VerdictLogPrefix{
+				Verdict:    aclPolicy.loggedVerdict(),
+				Direction:  direction,
+				PolicyHash: util.Hash(networkPolicy.PolicyKey),
+				ACLIndex:   i,
 			}
+			logLine := []string{"-A", chainName}
+			logLine = append(logLine, nflogSpecs(verdictLog, prefix)...)
+			logLine = append(logLine, ruleSpecs...)
+			creator.AddLine("", nil, logLine...)
+		}
+
+		dropMark := dropMark(aclPolicy, auditOnly)
+		if verdictLog != nil {
+			dropMark = markWithVerdictLogID(dropMark, verdictLogID)
 		}
+
 		line := []string{"-A", chainName}
-		line = append(line, actionSpecs...)
-		line = append(line, iptablesRuleSpecs(aclPolicy)...)
+		line = append(line, actionSpecs(networkPolicy.Tier, aclPolicy, dropMark)...)
+		line = append(line, ruleSpecs...)
 		creator.AddLine("", nil, line...) // TODO add error handler
+
+		if aclPolicy.Target == Passed {
+			// stop evaluating the AdminNetworkPolicy once the flow is passed
+			returnSpecs := []string{"-A", chainName, util.IptablesJumpFlag, util.IptablesReturn}
+			returnSpecs = append(returnSpecs, onMarkSpecs(passMark(aclPolicy))...)
+			creator.AddLine("", nil, returnSpecs...)
+		}
+	}
+}
+
+// dropMark returns the mark set by a NetworkPolicy's drop ACL.
+// Audit only policies set the audit mark instead, so the flow is logged but not dropped.
+func dropMark(aclPolicy *ACLPolicy, auditOnly bool) string {
+	switch {
+	case aclPolicy.hasIngress() && auditOnly:
+		return util.IptablesAzureIngressAuditMarkHex
+	case aclPolicy.hasIngress():
+		return util.IptablesAzureIngressDropMarkHex
+	case auditOnly:
+		return util.IptablesAzureEgressAuditMarkHex
+	default:
+		return util.IptablesAzureEgressDropMarkHex
+	}
+}
+
+// nflogSpecs sends rate limited packets to the verdict log collector.
+func nflogSpecs(verdictLog *VerdictLogCfg, prefix VerdictLogPrefix) []string {
+	return []string{
+		util.IptablesJumpFlag,
+		util.IptablesNflog,
+		util.IptablesNflogGroupFlag,
+		strconv.Itoa(int(verdictLog.NflogGroup)),
+		util.IptablesNflogPrefixFlag,
+		prefix.String(),
+		util.IptablesModuleFlag,
+		util.IptablesLimitModuleFlag,
+		util.IptablesLimitFlag,
+		fmt.Sprintf("%d/second", verdictLog.RateLimitPerSecond),
+		util.IptablesLimitBurstFlag,
+		strconv.Itoa(verdictLog.RateLimitPerSecond),
+	}
+}
+
+// actionSpecs returns the target of an ACL's rule.
+// NetworkPolicies only set the dropMark on dropped flows so that another NetworkPolicy can still allow them.
+// AdminNetworkPolicies and BaselineAdminNetworkPolicies have the final say, so they drop flows immediately.
+func actionSpecs(tier PolicyTier, aclPolicy *ACLPolicy, dropMark string) []string {
+	ingress := aclPolicy.hasIngress()
+	switch aclPolicy.Target {
+	case Allowed:
+		if ingress {
+			return []string{util.IptablesJumpFlag, util.IptablesAzureIngressAllowMarkChain}
+		}
+		return []string{util.IptablesJumpFlag, util.IptablesAzureAcceptChain}
+	case Passed:
+		return setMarkSpecs(passMark(aclPolicy))
+	default:
+		if tier != NetworkPolicyTier {
+			return []string{util.IptablesJumpFlag, util.IptablesDrop}
+		}
+		return setMarkSpecs(dropMark)
 	}
 }
 
-func iptablesRuleSpecs(aclPolicy *ACLPolicy) []string {
+func passMark(aclPolicy *ACLPolicy) string {
+	if aclPolicy.hasIngress() {
+		return util.IptablesAzureIngressPassMarkHex
+	}
+	return util.IptablesAzureEgressPassMarkHex
+}
+
+func iptablesRuleSpecs(aclPolicy *ACLPolicy, ipv6 bool) []string {
 	specs := make([]string, 0)
 	if aclPolicy.Protocol != UnspecifiedProtocol {
 		specs = append(specs, util.IptablesProtFlag, string(aclPolicy.Protocol))
 	}
 	specs = append(specs, dstPortSpecs(aclPolicy.DstPorts)...)
-	specs = append(specs, matchSetSpecsFromSetInfo(aclPolicy.SrcList)...)
-	specs = append(specs, matchSetSpecsFromSetInfo(aclPolicy.DstList)...)
+	specs = append(specs, matchSetSpecsFromSetInfo(aclPolicy.SrcList, ipv6)...)
+	specs = append(specs, matchSetSpecsFromSetInfo(aclPolicy.DstList, ipv6)...)
 	specs = append(specs, commentSpecs(aclPolicy.comment())...)
 	return specs
 }
@@ -290,20 +477,20 @@ func dstPortSpecs(portRange Ports) []string {
 	return []string{util.IptablesDstPortFlag, portRange.toIPTablesString()}
 }
 
-func matchSetSpecsForNetworkPolicy(networkPolicy *NPMNetworkPolicy, matchType MatchType) []string {
+func matchSetSpecsForNetworkPolicy(networkPolicy *NPMNetworkPolicy, matchType MatchType, ipv6 bool) []string {
 	specs := make([]string, 0, maxLengthForMatchSetSpecs*len(networkPolicy.PodSelectorList))
 	matchString := matchType.toIPTablesString()
 	for _, setInfo := range networkPolicy.PodSelectorList {
-		specs = append(specs, setInfo.matchSetSpecs(matchString)...)
+		specs = append(specs, setInfo.matchSetSpecs(matchString, ipv6)...)
 	}
 	return specs
 }
 
-func matchSetSpecsFromSetInfo(setInfoList []SetInfo) []string {
+func matchSetSpecsFromSetInfo(setInfoList []SetInfo, ipv6 bool) []string {
 	specs := make([]string, 0, maxLengthForMatchSetSpecs*len(setInfoList))
 	for _, setInfo := range setInfoList {
 		matchString := setInfo.MatchType.toIPTablesString()
-		specs = append(specs, setInfo.matchSetSpecs(matchString)...)
+		specs = append(specs, setInfo.matchSetSpecs(matchString, ipv6)...)
 	}
 	return specs
 }
@@ -332,6 +519,15 @@ func insertSpecs(chainName string, index int, specs []string) []string {
 	return append(insertSpecs, specs...)
 }
 
+// forFamily returns the ip6tables equivalent of an iptables binary (e.g. iptables-nft-restore -> ip6tables-nft-restore)
+// if this PolicyManager programs IPv6.
+func (pMgr *PolicyManager) forFamily(iptablesBinary string) string {
+	if !pMgr.IPv6 {
+		return iptablesBinary
+	}
+	return strings.Replace(iptablesBinary, "iptables", "ip6tables", 1)
+}
+
 func joinWithDash(prefix, item string) string {
 	return fmt.Sprintf("%s-%s", prefix, item)
 }
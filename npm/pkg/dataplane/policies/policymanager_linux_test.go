@@ -282,6 +282,49 @@ func TestCreatorForAddPolicies(t *testing.T) {
 	dptestutils.AssertEqualLines(t, expectedLines, actualLines)
 }
 
+func TestAddPoliciesIPv6(t *testing.T) {
+	calls := []testutils.TestCmd{
+		{Cmd: []string{"ip6tables-nft-restore", "-w", "60", "-T", "filter", "--noflush"}},
+	}
+	ioshim := common.NewMockIOShim(calls)
+	defer ioshim.VerifyCalls(t, calls)
+	cfg := *ipsetConfig
+	cfg.IPv6 = true
+	pMgr := NewPolicyManager(ioshim, &cfg)
+
+	policies := []*NPMNetworkPolicy{allTestNetworkPolicies[0]}
+	creator := pMgr.creatorForNewNetworkPolicies(chainNames(policies), policies)
+	actualLines := strings.Split(creator.ToString(), "\n")
+	v6 := func(rule string) string {
+		for _, set := range []*ipsets.IPSetMetadata{ipsets.TestCIDRSet.Metadata, ipsets.TestKeyPodSet.Metadata, ipsets.TestNamedportSet.Metadata} {
+			hashedName := set.GetHashedName()
+			rule = strings.ReplaceAll(rule, hashedName+" ", ipsets.IPv6SetName(hashedName)+" ")
+		}
+		return rule
+	}
+	expectedLines := []string{
+		"*filter",
+		fmt.Sprintf(":%s - -", bothDirectionsNetPolIngressChain),
+		fmt.Sprintf(":%s - -", bothDirectionsNetPolEgressChain),
+		"-F AZURE-NPM",
+		"-A AZURE-NPM -j AZURE-NPM-INGRESS",
+		"-A AZURE-NPM -j AZURE-NPM-EGRESS",
+		"-A AZURE-NPM -j AZURE-NPM-ACCEPT",
+		fmt.Sprintf("-A %s %s", bothDirectionsNetPolIngressChain, v6(ingressDropRule)),
+		fmt.Sprintf("-A %s %s", bothDirectionsNetPolIngressChain, v6(ingressAllowRule)),
+		fmt.Sprintf("-A %s %s", bothDirectionsNetPolEgressChain, v6(egressDropRule)),
+		fmt.Sprintf("-A %s %s", bothDirectionsNetPolEgressChain, v6(egressAllowRule)),
+		fmt.Sprintf("-I AZURE-NPM-INGRESS 1 %s", v6(ingressEgressNetPolIngressJump)),
+		fmt.Sprintf("-I AZURE-NPM-EGRESS 1 %s", v6(ingressEgressNetPolEgressJump)),
+		"COMMIT",
+		"",
+	}
+	dptestutils.AssertEqualLines(t, expectedLines, actualLines)
+	require.NotContains(t, creator.ToString(), ipsets.TestCIDRSet.HashedName+" ")
+
+	require.NoError(t, pMgr.AddPolicies(policies, nil))
+}
+
 func TestCreatorForRemovePolicies(t *testing.T) {
 	calls := []testutils.TestCmd{fakeIPTablesRestoreCommand}
 	ioshim := common.NewMockIOShim(calls)
@@ -435,3 +478,158 @@ func TestUpdatingStaleChains(t *testing.T) {
 	require.NoError(t, pMgr.AddPolicies([]*NPMNetworkPolicy{bothDirectionsNetPol}, nil))
 	assertStaleChainsContain(t, pMgr.staleChains, egressNetPolChain)
 }
+
+func TestCreatorForAddAdminPolicies(t *testing.T) {
+	calls := []testutils.TestCmd{fakeIPTablesRestoreCommand}
+	ioshim := common.NewMockIOShim(calls)
+	defer ioshim.VerifyCalls(t, calls)
+	pMgr := NewPolicyManager(ioshim, ipsetConfig)
+
+	// a NetworkPolicy in the cache has a jump at the top of each base chain
+	require.NoError(t, pMgr.AddPolicies([]*NPMNetworkPolicy{bothDirectionsNetPol}, nil))
+
+	lowPriorityANP := NewAdminNPMNetworkPolicy("low", AdminTier, 10)
+	lowPriorityANP.ACLs = []*ACLPolicy{
+		{
+			SrcList:   []SetInfo{{ipsets.TestCIDRSet.Metadata, true, SrcMatch}},
+			Target:    Passed,
+			Direction: Ingress,
+			Protocol:  UnspecifiedProtocol,
+		},
+	}
+	highPriorityANP := NewAdminNPMNetworkPolicy("high", AdminTier, 5)
+	highPriorityANP.ACLs = []*ACLPolicy{
+		{
+			SrcList:   []SetInfo{{ipsets.TestCIDRSet.Metadata, true, SrcMatch}},
+			Target:    Dropped,
+			Direction: Ingress,
+			Protocol:  UnspecifiedProtocol,
+		},
+	}
+	banp := NewAdminNPMNetworkPolicy("default", BaselineTier, 0)
+	banp.ACLs = []*ACLPolicy{egressAllowedACL, ingressDeniedACL}
+
+	policies := []*NPMNetworkPolicy{lowPriorityANP, highPriorityANP, banp}
+	creator := pMgr.creatorForNewNetworkPolicies(chainNames(policies), policies)
+	actualLines := strings.Split(creator.ToString(), "\n")
+	expectedLines := []string{
+		"*filter",
+		fmt.Sprintf(":%s - -", lowPriorityANP.ingressChainName()),
+		fmt.Sprintf(":%s - -", highPriorityANP.ingressChainName()),
+		fmt.Sprintf(":%s - -", banp.ingressChainName()),
+		fmt.Sprintf(":%s - -", banp.egressChainName()),
+		// low priority AdminNetworkPolicy passes flows to NetworkPolicies
+		fmt.Sprintf("-A %s -j MARK --set-mark %s -m set --match-set %s src -m comment --comment PASS-FROM-cidr-test-cidr-set",
+			lowPriorityANP.ingressChainName(), util.IptablesAzureIngressPassMarkHex, ipsets.TestCIDRSet.HashedName),
+		fmt.Sprintf("-A %s -j RETURN -m mark --mark %s", lowPriorityANP.ingressChainName(), util.IptablesAzureIngressPassMarkHex),
+		fmt.Sprintf("-I AZURE-NPM-INGRESS 1 -j %s -m mark ! --mark %s -m comment --comment INGRESS-POLICY-AdminNetworkPolicy/low-TO-all",
+			lowPriorityANP.ingressChainName(), util.IptablesAzureIngressPassMarkHex),
+		// high priority AdminNetworkPolicy is evaluated first and drops immediately
+		fmt.Sprintf("-A %s -j DROP -m set --match-set %s src -m comment --comment DROP-FROM-cidr-test-cidr-set",
+			highPriorityANP.ingressChainName(), ipsets.TestCIDRSet.HashedName),
+		fmt.Sprintf("-I AZURE-NPM-INGRESS 1 -j %s -m mark ! --mark %s -m comment --comment INGRESS-POLICY-AdminNetworkPolicy/high-TO-all",
+			highPriorityANP.ingressChainName(), util.IptablesAzureIngressPassMarkHex),
+		// BaselineAdminNetworkPolicy goes behind the NetworkPolicy jump and the base drop rule
+		fmt.Sprintf("-A %s -j AZURE-NPM-ACCEPT -m set --match-set %s dst -m comment --comment %s",
+			banp.egressChainName(), ipsets.TestNamedportSet.HashedName, egressAllowComment),
+		fmt.Sprintf("-A %s -j DROP -p TCP --dport 222:333 -m set --match-set %s src -m set ! --match-set %s dst -m comment --comment %s",
+			banp.ingressChainName(), ipsets.TestCIDRSet.HashedName, ipsets.TestKeyPodSet.HashedName, ingressDropComment),
+		fmt.Sprintf("-A AZURE-NPM-INGRESS -j %s -m comment --comment INGRESS-POLICY-BaselineAdminNetworkPolicy/default-TO-all",
+			banp.ingressChainName()),
+		fmt.Sprintf("-I AZURE-NPM-EGRESS 3 -j %s -m comment --comment EGRESS-POLICY-BaselineAdminNetworkPolicy/default-FROM-all",
+			banp.egressChainName()),
+		"COMMIT",
+		"",
+	}
+	dptestutils.AssertEqualLines(t, expectedLines, actualLines)
+}
+
+func TestCreatorForAddPoliciesWithVerdictLogging(t *testing.T) {
+	calls := []testutils.TestCmd{fakeIPTablesRestoreCommand}
+	ioshim := common.NewMockIOShim(calls)
+	defer ioshim.VerifyCalls(t, calls)
+	cfg := *ipsetConfig
+	cfg.VerdictLog = &VerdictLogCfg{NflogGroup: 100, RateLimitPerSecond: 5}
+	pMgr := NewPolicyManager(ioshim, &cfg)
+	require.NoError(t, pMgr.AddPolicies([]*NPMNetworkPolicy{egressNetPol}, nil))
+
+	auditNetPol := &NPMNetworkPolicy{
+		Namespace: "x",
+		PolicyKey: "x/audit",
+		ACLs:      []*ACLPolicy{ingressDeniedACL, ingressAllowedACL},
+		AuditOnly: true,
+	}
+	policies := []*NPMNetworkPolicy{auditNetPol}
+	creator := pMgr.creatorForNewNetworkPolicies(chainNames(policies), policies)
+	actualLines := strings.Split(creator.ToString(), "\n")
+	chain := auditNetPol.ingressChainName()
+	allowNflog := fmt.Sprintf("-j NFLOG --nflog-group 100 --nflog-prefix npm:%s:IN:%s:1 -m limit --limit 5/second --limit-burst 5",
+		LoggedAllow, util.Hash(auditNetPol.PolicyKey))
+	dropRuleSpecs := strings.TrimPrefix(ingressDropRule, fmt.Sprintf("-j MARK --set-mark %s ", util.IptablesAzureIngressDropMarkHex))
+	allowRuleSpecs := strings.TrimPrefix(ingressAllowRule, "-j AZURE-NPM-INGRESS-ALLOW-MARK ")
+	expectedLines := []string{
+		"*filter",
+		fmt.Sprintf(":%s - -", chain),
+		// the dropped flows only get the audit mark and the policy's verdict log ID,
+		// they are logged by the final rules of AZURE-NPM-INGRESS
+		fmt.Sprintf("-A %s -j MARK --set-mark %s %s", chain, markWithVerdictLogID(util.IptablesAzureIngressAuditMarkHex, 2), dropRuleSpecs),
+		fmt.Sprintf("-A %s %s %s", chain, allowNflog, allowRuleSpecs),
+		fmt.Sprintf("-A %s %s", chain, ingressAllowRule),
+		fmt.Sprintf("-I AZURE-NPM-INGRESS 1 -j %s -m comment --comment INGRESS-POLICY-x/audit-TO-all-IN-ns-x", chain),
+		"COMMIT",
+		"",
+	}
+	dptestutils.AssertEqualLines(t, expectedLines, actualLines)
+
+	// without verdict logging, audit only policies are enforced
+	pMgr.VerdictLog = nil
+	creator = pMgr.creatorForNewNetworkPolicies(chainNames(policies), policies)
+	require.Contains(t, creator.ToString(), fmt.Sprintf("-A %s %s", chain, ingressDropRule))
+	require.NotContains(t, creator.ToString(), util.IptablesNflog)
+}
+
+func TestCreatorForAddBaselinePolicyWithVerdictLogging(t *testing.T) {
+	calls := []testutils.TestCmd{fakeIPTablesRestoreCommand}
+	ioshim := common.NewMockIOShim(calls)
+	defer ioshim.VerifyCalls(t, calls)
+	cfg := *ipsetConfig
+	cfg.VerdictLog = &VerdictLogCfg{NflogGroup: 100, RateLimitPerSecond: 5}
+	pMgr := NewPolicyManager(ioshim, &cfg)
+	require.NoError(t, pMgr.AddPolicies([]*NPMNetworkPolicy{egressNetPol}, nil))
+
+	// the base rules of AZURE-NPM-EGRESS from bootup, behind the NetworkPolicy jump at the top
+	egressLines := []string{"NetworkPolicy jump"}
+	for _, line := range strings.Split(pMgr.creatorForBootup(stringsToMap([]string{})).ToString(), "\n") {
+		if strings.HasPrefix(line, "-A AZURE-NPM-EGRESS ") {
+			egressLines = append(egressLines, line)
+		}
+	}
+	acceptLineNumber := 0
+	for i, line := range egressLines {
+		if strings.Contains(line, "ACCEPT-ON-INGRESS-ALLOW-MARK") {
+			acceptLineNumber = i + 1
+		}
+	}
+	require.Equal(t, 5, acceptLineNumber, "NetworkPolicy jump, drop log, drop, audit log, then accept")
+
+	banp := NewAdminNPMNetworkPolicy("default", BaselineTier, 0)
+	banp.ACLs = []*ACLPolicy{egressAllowedACL}
+	policies := []*NPMNetworkPolicy{banp}
+	creator := pMgr.creatorForNewNetworkPolicies(chainNames(policies), policies)
+	actualLines := strings.Split(creator.ToString(), "\n")
+	expectedLines := []string{
+		"*filter",
+		fmt.Sprintf(":%s - -", banp.egressChainName()),
+		fmt.Sprintf("-A %s -j NFLOG --nflog-group 100 --nflog-prefix npm:%s:OUT:%s:0 -m limit --limit 5/second --limit-burst 5 -m set --match-set %s dst -m comment --comment %s",
+			banp.egressChainName(), LoggedAllow, util.Hash(banp.PolicyKey), ipsets.TestNamedportSet.HashedName, egressAllowComment),
+		fmt.Sprintf("-A %s -j AZURE-NPM-ACCEPT -m set --match-set %s dst -m comment --comment %s",
+			banp.egressChainName(), ipsets.TestNamedportSet.HashedName, egressAllowComment),
+		// BaselineAdminNetworkPolicy goes behind every rule dropping or logging on the drop and audit marks,
+		// so NetworkPolicy verdicts still win over it
+		fmt.Sprintf("-I AZURE-NPM-EGRESS %d -j %s -m comment --comment EGRESS-POLICY-BaselineAdminNetworkPolicy/default-FROM-all",
+			acceptLineNumber, banp.egressChainName()),
+		"COMMIT",
+		"",
+	}
+	dptestutils.AssertEqualLines(t, expectedLines, actualLines)
+}
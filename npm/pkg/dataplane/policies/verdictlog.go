@@ -0,0 +1,171 @@
+package policies
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	verdictLogPrefixPrefix = "npm"
+
+	// verdictLogIDMask are the bits of the packet mark which hold the verdict log ID of the NetworkPolicy which dropped the packet.
+	// The 16th to 27th bits are unused by NPM, kube-proxy and the other components running on AKS nodes.
+	verdictLogIDMask  uint32 = 0x0fff0000
+	verdictLogIDShift        = 16
+	maxVerdictLogID   uint32 = verdictLogIDMask >> verdictLogIDShift
+)
+
+var ErrInvalidVerdictLogPrefix = errors.New("invalid verdict log prefix")
+
+// VerdictLogCfg configures verdict logging, where packets matching an ACL are sent to an NFLOG group.
+type VerdictLogCfg struct {
+	// NflogGroup is the NFLOG group which the verdict log collector listens on
+	NflogGroup uint16
+	// RateLimitPerSecond is the maximum number of packets logged per second for each ACL
+	RateLimitPerSecond int
+}
+
+// LoggedVerdict is the verdict of an ACL as seen in verdict logs.
+type LoggedVerdict string
+
+const (
+	LoggedAllow LoggedVerdict = "ALLOW"
+	LoggedDrop  LoggedVerdict = "DROP"
+	LoggedPass  LoggedVerdict = "PASS"
+	// LoggedAudit is logged for ACLs of AuditOnly policies which would have dropped the packet
+	LoggedAudit LoggedVerdict = "AUDIT"
+)
+
+// VerdictLogPrefix identifies the ACL which logged a packet.
+// NFLOG prefixes are limited to 64 characters, so the policy is identified by the hash of its key like in its chain names.
+// NetworkPolicies only mark the flows they drop, since another NetworkPolicy may still allow them, so those flows are
+// logged by the final DROP and AUDIT rules of AZURE-NPM-INGRESS and AZURE-NPM-EGRESS instead. The prefix of these rules
+// has no PolicyHash and an ACLIndex of -1, and the packet mark carries the verdict log ID of the policy.
+type VerdictLogPrefix struct {
+	Verdict    LoggedVerdict
+	Direction  Direction
+	PolicyHash string
+	// ACLIndex is the index of the ACL in the policy's ACLs
+	ACLIndex int
+}
+
+// finalRuleVerdictLogPrefix is the prefix of the final DROP and AUDIT rules.
+func finalRuleVerdictLogPrefix(verdict LoggedVerdict, direction Direction) VerdictLogPrefix {
+	return VerdictLogPrefix{Verdict: verdict, Direction: direction, ACLIndex: -1}
+}
+
+// FromMark is true if the policy is identified by the verdict log ID in the packet mark.
+func (prefix VerdictLogPrefix) FromMark() bool {
+	return prefix.PolicyHash == ""
+}
+
+func (prefix VerdictLogPrefix) String() string {
+	if prefix.FromMark() {
+		return fmt.Sprintf("%s:%s:%s", verdictLogPrefixPrefix, prefix.Verdict, prefix.Direction)
+	}
+	return fmt.Sprintf("%s:%s:%s:%s:%d", verdictLogPrefixPrefix, prefix.Verdict, prefix.Direction, prefix.PolicyHash, prefix.ACLIndex)
+}
+
+// ParseVerdictLogPrefix parses the NFLOG prefix of a logged packet.
+func ParseVerdictLogPrefix(s string) (VerdictLogPrefix, error) {
+	fields := strings.Split(s, ":")
+	if (len(fields) != 3 && len(fields) != 5) || fields[0] != verdictLogPrefixPrefix {
+		return VerdictLogPrefix{}, fmt.Errorf("%w: %s", ErrInvalidVerdictLogPrefix, s)
+	}
+
+	verdict := LoggedVerdict(fields[1])
+	switch verdict {
+	case LoggedAllow, LoggedDrop, LoggedPass, LoggedAudit:
+	default:
+		return VerdictLogPrefix{}, fmt.Errorf("%w: unknown verdict in %s", ErrInvalidVerdictLogPrefix, s)
+	}
+
+	direction := Direction(fields[2])
+	if direction != Ingress && direction != Egress {
+		return VerdictLogPrefix{}, fmt.Errorf("%w: unknown direction in %s", ErrInvalidVerdictLogPrefix, s)
+	}
+
+	if len(fields) == 3 {
+		return finalRuleVerdictLogPrefix(verdict, direction), nil
+	}
+
+	aclIndex, err := strconv.Atoi(fields[4])
+	if err != nil || fields[3] == "" {
+		return VerdictLogPrefix{}, fmt.Errorf("%w: invalid policy hash or ACL index in %s", ErrInvalidVerdictLogPrefix, s)
+	}
+
+	return VerdictLogPrefix{
+		Verdict:    verdict,
+		Direction:  direction,
+		PolicyHash: fields[3],
+		ACLIndex:   aclIndex,
+	}, nil
+}
+
+// VerdictLogIDFromMark returns the verdict log ID of the NetworkPolicy which marked a packet as dropped.
+// Zero means that no policy could be identified.
+func VerdictLogIDFromMark(mark uint32) uint32 {
+	return (mark & verdictLogIDMask) >> verdictLogIDShift
+}
+
+// markWithVerdictLogID adds the verdict log ID to a <value>/<mask> mark.
+func markWithVerdictLogID(mark string, id uint32) string {
+	value, mask, _ := strings.Cut(mark, "/")
+	v, _ := strconv.ParseUint(strings.TrimPrefix(value, "0x"), 16, 32)
+	m, _ := strconv.ParseUint(strings.TrimPrefix(mask, "0x"), 16, 32)
+	return fmt.Sprintf("0x%x/0x%x", uint32(v)|id<<verdictLogIDShift, uint32(m)|verdictLogIDMask)
+}
+
+// verdictLogIDs assigns each NetworkPolicy a small ID which its drop ACLs set in the packet mark, so that the final
+// drop rule can log which policy dropped a packet. The IDs of removed policies are reused.
+type verdictLogIDs struct {
+	byKey map[string]uint32
+	keys  map[uint32]string
+	next  uint32
+}
+
+func newVerdictLogIDs() *verdictLogIDs {
+	return &verdictLogIDs{
+		byKey: make(map[string]uint32),
+		keys:  make(map[uint32]string),
+		next:  1,
+	}
+}
+
+// allocate returns the ID of the policy, assigning one if needed. It returns zero once all IDs are in use.
+func (ids *verdictLogIDs) allocate(policyKey string) uint32 {
+	if id, ok := ids.byKey[policyKey]; ok {
+		return id
+	}
+	for i := uint32(0); i < maxVerdictLogID; i++ {
+		id := ids.next
+		ids.next = ids.next%maxVerdictLogID + 1
+		if _, ok := ids.keys[id]; !ok {
+			ids.byKey[policyKey] = id
+			ids.keys[id] = policyKey
+			return id
+		}
+	}
+	return 0
+}
+
+func (ids *verdictLogIDs) release(policyKey string) {
+	if id, ok := ids.byKey[policyKey]; ok {
+		delete(ids.keys, id)
+		delete(ids.byKey, policyKey)
+	}
+}
+
+// loggedVerdict returns the verdict logged for the ACL.
+func (aclPolicy *ACLPolicy) loggedVerdict() LoggedVerdict {
+	switch aclPolicy.Target {
+	case Allowed:
+		return LoggedAllow
+	case Passed:
+		return LoggedPass
+	default:
+		return LoggedDrop
+	}
+}
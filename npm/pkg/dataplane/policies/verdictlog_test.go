@@ -0,0 +1,69 @@
+package policies
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerdictLogPrefix(t *testing.T) {
+	prefix := VerdictLogPrefix{
+		Verdict:    LoggedAudit,
+		Direction:  Egress,
+		PolicyHash: "4294967295",
+		ACLIndex:   12,
+	}
+	s := prefix.String()
+	require.Equal(t, "npm:AUDIT:OUT:4294967295:12", s)
+	// NFLOG prefixes are limited to 64 characters
+	require.LessOrEqual(t, len(s), 64)
+
+	parsed, err := ParseVerdictLogPrefix(s)
+	require.NoError(t, err)
+	require.Equal(t, prefix, parsed)
+
+	final := finalRuleVerdictLogPrefix(LoggedDrop, Ingress)
+	require.Equal(t, "npm:DROP:IN", final.String())
+	parsed, err = ParseVerdictLogPrefix(final.String())
+	require.NoError(t, err)
+	require.Equal(t, final, parsed)
+	require.True(t, parsed.FromMark())
+
+	for _, invalid := range []string{
+		"",
+		"npm:DROP:IN:123",
+		"npm:DROP:IN::0",
+		"foo:DROP:IN:123:0",
+		"npm:REJECT:IN:123:0",
+		"npm:DROP:BOTH:123:0",
+		"npm:DROP:IN:123:x",
+	} {
+		_, err := ParseVerdictLogPrefix(invalid)
+		require.ErrorIs(t, err, ErrInvalidVerdictLogPrefix, invalid)
+	}
+}
+
+func TestVerdictLogIDs(t *testing.T) {
+	require.Equal(t, "0x50400/0xfff0400", markWithVerdictLogID("0x400/0x400", 5))
+	require.Equal(t, uint32(5), VerdictLogIDFromMark(0x50400))
+	require.Zero(t, VerdictLogIDFromMark(0x400))
+
+	ids := newVerdictLogIDs()
+	require.Equal(t, uint32(1), ids.allocate("x/a"))
+	require.Equal(t, uint32(2), ids.allocate("x/b"))
+	require.Equal(t, uint32(1), ids.allocate("x/a"))
+
+	// released IDs are reused once the others are in use
+	ids.release("x/a")
+	ids.next = maxVerdictLogID
+	require.Equal(t, maxVerdictLogID, ids.allocate("x/c"))
+	require.Equal(t, uint32(1), ids.allocate("x/d"))
+	require.Equal(t, "x/d", ids.keys[1])
+
+	// zero once all IDs are in use
+	for i := uint32(0); i < maxVerdictLogID; i++ {
+		ids.allocate(fmt.Sprintf("y/%d", i))
+	}
+	require.Zero(t, ids.allocate("x/e"))
+}
@@ -0,0 +1,84 @@
+package dptestutils
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	grepCommand = "grep"
+
+	grepNoMatchExitCode = 1
+	grepErrorExitCode   = 2
+)
+
+// grep supports the flags which the dataplane pipes command output to: -q, -v, -o, -P, and -B.
+// Patterns are Go regular expressions, which cover the Perl syntax used with -P.
+func grep(args []string, input []byte) ([]byte, error) {
+	var quiet, invert, onlyMatching bool
+	linesBefore := 0
+	pattern := ""
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-q":
+			quiet = true
+		case "-v":
+			invert = true
+		case "-o":
+			onlyMatching = true
+		case "-P":
+		case "-B":
+			i++
+			if i == len(args) {
+				return exitWithError(grepErrorExitCode, "grep: option requires an argument -- 'B'")
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil {
+				return exitWithError(grepErrorExitCode, "grep: %s: invalid context length argument", args[i])
+			}
+			linesBefore = n
+		default:
+			if pattern != "" || strings.HasPrefix(args[i], "-") {
+				return exitWithError(grepErrorExitCode, "grep: unsupported argument %s", args[i])
+			}
+			pattern = args[i]
+		}
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return exitWithError(grepErrorExitCode, "grep: invalid pattern %s", pattern)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(input), "\n"), "\n")
+	if len(input) == 0 {
+		lines = nil
+	}
+	var out bytes.Buffer
+	matched := false
+	printedUpTo := -1
+	for i, line := range lines {
+		if re.MatchString(line) == invert {
+			continue
+		}
+		matched = true
+		if quiet {
+			break
+		}
+		if onlyMatching {
+			for _, match := range re.FindAllString(line, -1) {
+				out.WriteString(match + "\n")
+			}
+			continue
+		}
+		for j := max(i-linesBefore, printedUpTo+1); j <= i; j++ {
+			out.WriteString(lines[j] + "\n")
+		}
+		printedUpTo = i
+	}
+	if !matched {
+		return nil, codeExitError(grepNoMatchExitCode)
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,395 @@
+package dptestutils
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	ipsetCommand = "ipset"
+	// ipsetVersionPrefix starts ipset error messages
+	ipsetVersionPrefix = "ipset v7.5: "
+	ipsetErrorExitCode = 1
+
+	hashNetType    = "hash:net"
+	hashIPPortType = "hash:ip,port"
+	listSetType    = "list:set"
+
+	nomatchFlag     = "nomatch"
+	defaultMaxelem  = "65536"
+	defaultProtocol = "tcp"
+
+	// messages match the ipset error definitions in the ipsets package
+	setDoesntExistMessage       = "The set with the given name does not exist"
+	setInUseMessage             = "Set cannot be destroyed: it is in use by a kernel component"
+	setAlreadyExistsMessage     = "Set cannot be created: set with the same name already exists"
+	memberSetDoesntExistMessage = "Set to be added/deleted/tested as element does not exist"
+	elementExistsMessage        = "Element cannot be added to the set: it's already added"
+	elementDoesntExistMessage   = "Element cannot be deleted from the set: it's not added"
+)
+
+type fakeIPSet struct {
+	setType string
+	ipv6    bool
+	maxelem string
+	// members maps the normalized member to whether it's a nomatch entry
+	members map[string]bool
+}
+
+// ipsetError is the message of a failed ipset command.
+type ipsetError string
+
+func (e ipsetError) Error() string {
+	return string(e)
+}
+
+func (k *FakeKernel) ipset(args []string, input []byte) ([]byte, error) {
+	switch strings.Join(args, " ") {
+	case "list --name":
+		var out bytes.Buffer
+		for _, name := range k.ipsetNames() {
+			out.WriteString(name + "\n")
+		}
+		return out.Bytes(), nil
+	case "list":
+		return k.ipsetList(), nil
+	case "save":
+		return k.ipsetSave(), nil
+	case "restore":
+		return k.ipsetRestore(input)
+	}
+	return exitWithError(ipsetErrorExitCode, "%s%s: ipset %s", ipsetVersionPrefix, errUnsupportedCommand.Error(), strings.Join(args, " "))
+}
+
+// ipsetRestore applies lines until one fails, like ipset restore.
+func (k *FakeKernel) ipsetRestore(input []byte) ([]byte, error) {
+	for i, line := range strings.Split(string(input), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if err := k.ipsetLine(fields); err != nil {
+			return exitWithError(ipsetErrorExitCode, "%sError in line %d: %s", ipsetVersionPrefix, i+1, err.Error())
+		}
+	}
+	return nil, nil
+}
+
+func (k *FakeKernel) ipsetLine(fields []string) error {
+	if len(fields) < 2 {
+		return ipsetError("Missing mandatory argument: setname")
+	}
+	op, name, rest := fields[0], fields[1], fields[2:]
+	switch op {
+	case "-N", "create":
+		return k.createIPSet(name, rest)
+	case "-A", "add", "-D", "del":
+		set, ok := k.ipsets[name]
+		if !ok {
+			return ipsetError(setDoesntExistMessage)
+		}
+		if len(rest) == 0 {
+			return ipsetError("Missing mandatory argument")
+		}
+		member, err := k.normalizeMember(set, rest[0])
+		if err != nil {
+			return err
+		}
+		if op == "-A" || op == "add" {
+			nomatch, exist := false, false
+			for _, flag := range rest[1:] {
+				switch flag {
+				case nomatchFlag:
+					nomatch = true
+				case "--exist", "-exist":
+					exist = true
+				default:
+					return ipsetError("Unknown argument: " + flag)
+				}
+			}
+			if _, ok := set.members[member]; ok && !exist {
+				return ipsetError(elementExistsMessage)
+			}
+			set.members[member] = nomatch
+			return nil
+		}
+		if len(rest) > 1 {
+			return ipsetError("Unknown argument: " + rest[1])
+		}
+		if _, ok := set.members[member]; !ok {
+			return ipsetError(elementDoesntExistMessage)
+		}
+		delete(set.members, member)
+		return nil
+	case "-F", "flush":
+		set, ok := k.ipsets[name]
+		if !ok {
+			return ipsetError(setDoesntExistMessage)
+		}
+		set.members = make(map[string]bool)
+		return nil
+	case "-X", "destroy":
+		if _, ok := k.ipsets[name]; !ok {
+			return ipsetError(setDoesntExistMessage)
+		}
+		if k.ipsetReferences(name) > 0 {
+			return ipsetError(setInUseMessage)
+		}
+		delete(k.ipsets, name)
+		return nil
+	}
+	return ipsetError("Unknown command " + op)
+}
+
+func (k *FakeKernel) createIPSet(name string, specs []string) error {
+	set := &fakeIPSet{maxelem: defaultMaxelem, members: make(map[string]bool)}
+	exist := false
+	for i := 0; i < len(specs); i++ {
+		switch specs[i] {
+		case "--exist", "-exist":
+			exist = true
+		case "nethash", hashNetType:
+			set.setType = hashNetType
+		case "setlist", listSetType:
+			set.setType = listSetType
+		case hashIPPortType:
+			set.setType = hashIPPortType
+		case "maxelem", "family":
+			if i+1 == len(specs) {
+				return ipsetError("Missing mandatory argument for " + specs[i])
+			}
+			i++
+			if specs[i-1] == "maxelem" {
+				set.maxelem = specs[i]
+			} else {
+				set.ipv6 = specs[i] == "inet6"
+			}
+		default:
+			return ipsetError("Unknown argument: " + specs[i])
+		}
+	}
+	if set.setType == "" {
+		return ipsetError("Missing mandatory argument: typename")
+	}
+
+	if existing, ok := k.ipsets[name]; ok {
+		if exist && existing.setType == set.setType && existing.ipv6 == set.ipv6 && existing.maxelem == set.maxelem {
+			return nil
+		}
+		return ipsetError(setAlreadyExistsMessage)
+	}
+	k.ipsets[name] = set
+	return nil
+}
+
+// normalizeMember returns the member as ipset lists it.
+func (k *FakeKernel) normalizeMember(set *fakeIPSet, member string) (string, error) {
+	switch set.setType {
+	case listSetType:
+		if _, ok := k.ipsets[member]; !ok {
+			return "", ipsetError(memberSetDoesntExistMessage)
+		}
+		return member, nil
+	case hashIPPortType:
+		ipString, port, found := strings.Cut(member, ",")
+		ip := net.ParseIP(ipString)
+		if !found || ip == nil || (ip.To4() == nil) != set.ipv6 {
+			return "", ipsetError("Syntax error: cannot parse " + member)
+		}
+		protocol, portString, found := strings.Cut(port, ":")
+		if !found {
+			protocol, portString = defaultProtocol, port
+		}
+		if _, err := strconv.ParseUint(portString, 10, 16); err != nil {
+			return "", ipsetError("Syntax error: cannot parse " + member)
+		}
+		return fmt.Sprintf("%s,%s:%s", ip.String(), strings.ToLower(protocol), portString), nil
+	default:
+		ipNet, err := parseCIDR(member)
+		if err != nil || (ipNet.IP.To4() == nil) != set.ipv6 {
+			return "", ipsetError("Syntax error: cannot parse " + member)
+		}
+		ones, bits := ipNet.Mask.Size()
+		if ones == bits {
+			return ipNet.IP.String(), nil
+		}
+		return ipNet.String(), nil
+	}
+}
+
+// parseCIDR parses an IP as a host CIDR.
+func parseCIDR(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, ipsetError("invalid IP " + s)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR %s: %w", s, err)
+	}
+	if ip4 := ipNet.IP.To4(); ip4 != nil {
+		ipNet.IP = ip4
+	}
+	return ipNet, nil
+}
+
+// ipsetReferences counts the lists and iptables rules referring to the set.
+func (k *FakeKernel) ipsetReferences(name string) int {
+	refs := 0
+	for _, set := range k.ipsets {
+		if set.setType != listSetType {
+			continue
+		}
+		if _, ok := set.members[name]; ok {
+			refs++
+		}
+	}
+	for _, tables := range k.stacks {
+		for _, table := range tables {
+			for _, chain := range table.chains {
+				for _, rule := range chain.rules {
+					for _, match := range rule.sets {
+						if match.name == name {
+							refs++
+						}
+					}
+				}
+			}
+		}
+	}
+	return refs
+}
+
+// ipsetFlushAndDestroyAll flushes every set, then destroys them all unless one is referenced by iptables.
+func (k *FakeKernel) ipsetFlushAndDestroyAll() ([]byte, error) {
+	for _, set := range k.ipsets {
+		set.members = make(map[string]bool)
+	}
+	for name := range k.ipsets {
+		if k.ipsetReferences(name) > 0 {
+			return exitWithError(ipsetErrorExitCode, "%s%s", ipsetVersionPrefix, setInUseMessage)
+		}
+	}
+	k.ipsets = make(map[string]*fakeIPSet)
+	return nil, nil
+}
+
+func (k *FakeKernel) ipsetNames() []string {
+	names := make([]string, 0, len(k.ipsets))
+	for name := range k.ipsets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (set *fakeIPSet) header() string {
+	if set.setType == listSetType {
+		return "size 8"
+	}
+	family := "inet"
+	if set.ipv6 {
+		family = "inet6"
+	}
+	return fmt.Sprintf("family %s hashsize 1024 maxelem %s", family, set.maxelem)
+}
+
+func (set *fakeIPSet) sortedMembers() []string {
+	members := make([]string, 0, len(set.members))
+	for member, nomatch := range set.members {
+		if nomatch {
+			member += " " + nomatchFlag
+		}
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+func (k *FakeKernel) ipsetList() []byte {
+	var out bytes.Buffer
+	for _, name := range k.ipsetNames() {
+		set := k.ipsets[name]
+		fmt.Fprintf(&out, "Name: %s\nType: %s\nRevision: 6\nHeader: %s\nSize in memory: 512\nReferences: %d\nNumber of entries: %d\nMembers:\n",
+			name, set.setType, set.header(), k.ipsetReferences(name), len(set.members))
+		for _, member := range set.sortedMembers() {
+			out.WriteString(member + "\n")
+		}
+		out.WriteString("\n")
+	}
+	return out.Bytes()
+}
+
+func (k *FakeKernel) ipsetSave() []byte {
+	var out bytes.Buffer
+	for _, name := range k.ipsetNames() {
+		set := k.ipsets[name]
+		fmt.Fprintf(&out, "create %s %s %s\n", name, set.setType, set.header())
+		for _, member := range set.sortedMembers() {
+			fmt.Fprintf(&out, "add %s %s\n", name, member)
+		}
+	}
+	return out.Bytes()
+}
+
+// IPSetMembers returns the sorted members of a set, or nil if the set doesn't exist.
+func (k *FakeKernel) IPSetMembers(name string) []string {
+	k.Lock()
+	defer k.Unlock()
+	set, ok := k.ipsets[name]
+	if !ok {
+		return nil
+	}
+	return set.sortedMembers()
+}
+
+// ipsetMatches returns whether the packet is in the set for the directions of a --match-set flag.
+func (k *FakeKernel) ipsetMatches(name string, dirs []string, pkt *packet) bool {
+	set, ok := k.ipsets[name]
+	if !ok {
+		return false
+	}
+	switch set.setType {
+	case listSetType:
+		for member := range set.members {
+			if k.ipsetMatches(member, dirs, pkt) {
+				return true
+			}
+		}
+		return false
+	case hashIPPortType:
+		if len(dirs) < 2 || dirs[1] != "dst" || (pkt.ip(dirs[0]).To4() == nil) != set.ipv6 {
+			return false
+		}
+		member := fmt.Sprintf("%s,%s:%d", pkt.ip(dirs[0]).String(), pkt.protocol, pkt.dstPort)
+		_, ok := set.members[member]
+		return ok
+	default:
+		ip := pkt.ip(dirs[0])
+		if (ip.To4() == nil) != set.ipv6 {
+			return false
+		}
+		// the most specific entry decides whether the IP matches, so nomatch entries carve out exceptions
+		longest, nomatch := -1, false
+		for member, isNomatch := range set.members {
+			ipNet, err := parseCIDR(member)
+			if err != nil || !ipNet.Contains(ip) {
+				continue
+			}
+			if ones, _ := ipNet.Mask.Size(); ones > longest {
+				longest, nomatch = ones, isNomatch
+			}
+		}
+		return longest >= 0 && !nomatch
+	}
+}
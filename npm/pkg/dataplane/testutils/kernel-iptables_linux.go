@@ -0,0 +1,508 @@
+package dptestutils
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	nftBackend    = "nft"
+	legacyBackend = "legacy"
+
+	filterTable   = "filter"
+	mangleTable   = "mangle"
+	kubeHintChain = "KUBE-IPTABLES-HINT"
+
+	// exit codes of iptables for a bad rule and for a missing target, chain, or set
+	iptablesErrorExitCode   = 1
+	iptablesMissingExitCode = 2
+
+	acceptTarget  = "ACCEPT"
+	dropTarget    = "DROP"
+	rejectTarget  = "REJECT"
+	returnTarget  = "RETURN"
+	markTarget    = "MARK"
+	nflogTarget   = "NFLOG"
+	logTarget     = "LOG"
+	nfqueueTarget = "NFQUEUE"
+)
+
+var (
+	iptablesBinaryRegex = regexp.MustCompile(`^(ip6?tables)-(nft|legacy)(-restore)?$`)
+
+	builtinChains = map[string][]string{
+		filterTable: {"INPUT", "FORWARD", "OUTPUT"},
+		mangleTable: {"PREROUTING", "INPUT", "FORWARD", "OUTPUT", "POSTROUTING"},
+	}
+
+	builtinTargets = map[string]struct{}{
+		acceptTarget:  {},
+		dropTarget:    {},
+		rejectTarget:  {},
+		returnTarget:  {},
+		markTarget:    {},
+		nflogTarget:   {},
+		logTarget:     {},
+		nfqueueTarget: {},
+	}
+)
+
+// stackKey identifies the tables of one iptables backend for one IP family.
+type stackKey struct {
+	backend string
+	ipv6    bool
+}
+
+func (key stackKey) binary() string {
+	if key.ipv6 {
+		return "ip6tables-" + key.backend
+	}
+	return "iptables-" + key.backend
+}
+
+func parseIptablesBinary(name string) (key stackKey, restore, ok bool) {
+	match := iptablesBinaryRegex.FindStringSubmatch(name)
+	if match == nil {
+		return stackKey{}, false, false
+	}
+	return stackKey{backend: match[2], ipv6: match[1] == "ip6tables"}, match[3] != "", true
+}
+
+type fakeTable struct {
+	name   string
+	chains map[string]*fakeChain
+}
+
+type fakeChain struct {
+	builtin bool
+	rules   []*fakeRule
+}
+
+// iptablesError is the message and exit code of a failed iptables command.
+type iptablesError struct {
+	code int
+	msg  string
+}
+
+func (e *iptablesError) Error() string {
+	return e.msg
+}
+
+func badRuleError() *iptablesError {
+	return &iptablesError{iptablesErrorExitCode, "Bad rule (does a matching rule exist in that chain?)."}
+}
+
+func noChainError() *iptablesError {
+	return &iptablesError{iptablesErrorExitCode, "No chain/target/match by that name."}
+}
+
+func (k *FakeKernel) table(key stackKey, name string) (*fakeTable, error) {
+	tables, ok := k.stacks[key]
+	if !ok {
+		tables = make(map[string]*fakeTable)
+		k.stacks[key] = tables
+	}
+	if table, ok := tables[name]; ok {
+		return table, nil
+	}
+	builtins, ok := builtinChains[name]
+	if !ok {
+		return nil, &iptablesError{iptablesMissingExitCode, fmt.Sprintf("can't initialize iptables table `%s': Table does not exist", name)}
+	}
+	table := &fakeTable{name: name, chains: make(map[string]*fakeChain, len(builtins))}
+	for _, chain := range builtins {
+		table.chains[chain] = &fakeChain{builtin: true}
+	}
+	tables[name] = table
+	return table, nil
+}
+
+func (t *fakeTable) copy() *fakeTable {
+	c := &fakeTable{name: t.name, chains: make(map[string]*fakeChain, len(t.chains))}
+	for name, chain := range t.chains {
+		c.chains[name] = &fakeChain{builtin: chain.builtin, rules: append([]*fakeRule(nil), chain.rules...)}
+	}
+	return c
+}
+
+// iptables runs a single iptables command.
+func (k *FakeKernel) iptables(key stackKey, args []string) ([]byte, error) {
+	tableName := filterTable
+	op, chain := "", ""
+	var ruleArgs []string
+	lineNumbers := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-w":
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+			}
+		case "-t":
+			if i+1 == len(args) {
+				return k.iptablesFailure(key, &iptablesError{iptablesMissingExitCode, "option \"-t\" requires an argument"})
+			}
+			i++
+			tableName = args[i]
+		case "-n":
+		case "--line-numbers":
+			lineNumbers = true
+		case "-N", "-F", "-X", "-L":
+			op = args[i]
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+				chain = args[i]
+			}
+		case "-A", "-C", "-D", "-I":
+			if i+1 == len(args) {
+				return k.iptablesFailure(key, &iptablesError{iptablesMissingExitCode, fmt.Sprintf("option \"%s\" requires an argument", args[i])})
+			}
+			op, chain, ruleArgs = args[i], args[i+1], args[i+2:]
+			i = len(args)
+		default:
+			return k.iptablesFailure(key, &iptablesError{iptablesMissingExitCode, fmt.Sprintf("unknown argument \"%s\"", args[i])})
+		}
+	}
+	if op == "" {
+		return k.iptablesFailure(key, &iptablesError{iptablesMissingExitCode, "no command specified"})
+	}
+
+	table, err := k.table(key, tableName)
+	if err != nil {
+		return k.iptablesFailure(key, err.(*iptablesError)) //nolint:errorlint // table only returns iptablesErrors
+	}
+	if op == "-L" {
+		return k.listChains(table, chain, lineNumbers)
+	}
+	if err := k.applyOperation(key, table, op, chain, ruleArgs); err != nil {
+		return k.iptablesFailure(key, err)
+	}
+	return nil, nil
+}
+
+func (k *FakeKernel) iptablesFailure(key stackKey, err *iptablesError) ([]byte, error) {
+	if err.code == iptablesErrorExitCode {
+		return exitWithError(err.code, "iptables: %s", err.msg)
+	}
+	return exitWithError(err.code, "iptables v1.8.7 (%s): %s", key.backend, err.msg)
+}
+
+// iptablesRestore applies the whole file on COMMIT, or nothing if a line fails.
+func (k *FakeKernel) iptablesRestore(key stackKey, args []string, input []byte) ([]byte, error) {
+	expectedTable := ""
+	noflush := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-w":
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+			}
+		case "-T":
+			if i+1 == len(args) {
+				return exitWithError(iptablesMissingExitCode, "%s-restore: option \"-T\" requires an argument", key.binary())
+			}
+			i++
+			expectedTable = args[i]
+		case "--noflush", "-n":
+			noflush = true
+		default:
+			return exitWithError(iptablesMissingExitCode, "%s-restore: unknown argument \"%s\"", key.binary(), args[i])
+		}
+	}
+
+	var pending *fakeTable
+	for i, line := range strings.Split(string(input), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		lineFailed := func() ([]byte, error) {
+			return exitWithError(iptablesErrorExitCode, "%s-restore: line %d failed", key.binary(), i+1)
+		}
+
+		switch {
+		case strings.HasPrefix(fields[0], "*"):
+			name := strings.TrimPrefix(fields[0], "*")
+			if pending != nil || (expectedTable != "" && name != expectedTable) {
+				return lineFailed()
+			}
+			table, err := k.table(key, name)
+			if err != nil {
+				return lineFailed()
+			}
+			pending = table.copy()
+			if !noflush {
+				for chainName, chain := range pending.chains {
+					if !chain.builtin {
+						delete(pending.chains, chainName)
+					}
+					chain.rules = nil
+				}
+			}
+		case pending == nil:
+			return lineFailed()
+		case fields[0] == "COMMIT":
+			k.stacks[key][pending.name] = pending
+			pending = nil
+		case strings.HasPrefix(fields[0], ":"):
+			// declaring an existing chain flushes it
+			name := strings.TrimPrefix(fields[0], ":")
+			if chain, ok := pending.chains[name]; ok {
+				if !chain.builtin {
+					chain.rules = nil
+				}
+			} else {
+				pending.chains[name] = &fakeChain{}
+			}
+		default:
+			op, chain := fields[0], ""
+			var ruleArgs []string
+			if len(fields) > 1 {
+				chain, ruleArgs = fields[1], fields[2:]
+			}
+			if op == "-N" || op == "-F" || op == "-X" {
+				if len(ruleArgs) > 0 {
+					return lineFailed()
+				}
+			} else if op != "-A" && op != "-I" && op != "-D" {
+				return lineFailed()
+			}
+			if err := k.applyOperation(key, pending, op, chain, ruleArgs); err != nil {
+				return lineFailed()
+			}
+		}
+	}
+	if pending != nil {
+		return exitWithError(iptablesErrorExitCode, "%s-restore: COMMIT expected at line %d", key.binary(), len(strings.Split(string(input), "\n")))
+	}
+	return nil, nil
+}
+
+// applyOperation modifies the table for every operation except listing.
+func (k *FakeKernel) applyOperation(key stackKey, table *fakeTable, op, chainName string, ruleArgs []string) *iptablesError {
+	if op == "-N" {
+		if _, ok := table.chains[chainName]; ok {
+			return &iptablesError{iptablesErrorExitCode, "Chain already exists."}
+		}
+		table.chains[chainName] = &fakeChain{}
+		return nil
+	}
+
+	if chainName == "" {
+		switch op {
+		case "-F":
+			for _, chain := range table.chains {
+				chain.rules = nil
+			}
+			return nil
+		case "-X":
+			for _, name := range table.sortedChainNames() {
+				if table.chains[name].builtin {
+					continue
+				}
+				if err := table.deleteChain(name); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return noChainError()
+	}
+
+	if op == "-X" {
+		if _, ok := table.chains[chainName]; !ok {
+			return noChainError()
+		}
+		return table.deleteChain(chainName)
+	}
+
+	// a missing jump target or set fails before the chain is looked up
+	var rule *fakeRule
+	position := 0
+	if op == "-A" || op == "-C" || op == "-D" || op == "-I" {
+		if op == "-I" && len(ruleArgs) > 0 {
+			if n, err := strconv.Atoi(ruleArgs[0]); err == nil {
+				position, ruleArgs = n, ruleArgs[1:]
+			}
+		}
+		if op == "-D" && len(ruleArgs) == 1 {
+			if n, err := strconv.Atoi(ruleArgs[0]); err == nil {
+				position, ruleArgs = n, nil
+			}
+		}
+		if ruleArgs != nil || op != "-D" {
+			var err *iptablesError
+			if rule, err = k.parseRule(key, table, ruleArgs); err != nil {
+				return err
+			}
+		}
+	}
+
+	chain, ok := table.chains[chainName]
+	if !ok {
+		return noChainError()
+	}
+	switch op {
+	case "-F":
+		chain.rules = nil
+	case "-A":
+		chain.rules = append(chain.rules, rule)
+	case "-I":
+		if position == 0 {
+			position = 1
+		}
+		if position < 1 || position > len(chain.rules)+1 {
+			return &iptablesError{iptablesErrorExitCode, "Index of insertion too big."}
+		}
+		chain.rules = append(chain.rules[:position-1], append([]*fakeRule{rule}, chain.rules[position-1:]...)...)
+	case "-C", "-D":
+		index := position - 1
+		if rule != nil {
+			index = -1
+			for i, existing := range chain.rules {
+				if existing.equals(rule) {
+					index = i
+					break
+				}
+			}
+		}
+		if index < 0 || index >= len(chain.rules) {
+			if rule == nil {
+				return &iptablesError{iptablesErrorExitCode, "Index of deletion too big."}
+			}
+			return badRuleError()
+		}
+		if op == "-D" {
+			chain.rules = append(chain.rules[:index:index], chain.rules[index+1:]...)
+		}
+	default:
+		return &iptablesError{iptablesMissingExitCode, fmt.Sprintf("unknown option \"%s\"", op)}
+	}
+	return nil
+}
+
+func (t *fakeTable) deleteChain(name string) *iptablesError {
+	chain := t.chains[name]
+	if chain.builtin {
+		return &iptablesError{iptablesErrorExitCode, "Invalid argument."}
+	}
+	if t.references(name) > 0 {
+		return &iptablesError{iptablesErrorExitCode, "Too many links."}
+	}
+	if len(chain.rules) > 0 {
+		return &iptablesError{iptablesErrorExitCode, "Directory not empty."}
+	}
+	delete(t.chains, name)
+	return nil
+}
+
+// references counts the rules jumping to a chain.
+func (t *fakeTable) references(name string) int {
+	refs := 0
+	for _, chain := range t.chains {
+		for _, rule := range chain.rules {
+			if rule.target == name {
+				refs++
+			}
+		}
+	}
+	return refs
+}
+
+// sortedChainNames lists builtin chains in kernel order, then user-defined chains by name.
+func (t *fakeTable) sortedChainNames() []string {
+	names := make([]string, 0, len(t.chains))
+	userChains := make([]string, 0, len(t.chains))
+	for _, name := range builtinChains[t.name] {
+		names = append(names, name)
+	}
+	for name, chain := range t.chains {
+		if !chain.builtin {
+			userChains = append(userChains, name)
+		}
+	}
+	sort.Strings(userChains)
+	return append(names, userChains...)
+}
+
+func (k *FakeKernel) listChains(table *fakeTable, chainName string, lineNumbers bool) ([]byte, error) {
+	names := table.sortedChainNames()
+	if chainName != "" {
+		if _, ok := table.chains[chainName]; !ok {
+			return exitWithError(iptablesErrorExitCode, "iptables: %s", noChainError().msg)
+		}
+		names = []string{chainName}
+	}
+
+	var out bytes.Buffer
+	for i, name := range names {
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		chain := table.chains[name]
+		if chain.builtin {
+			fmt.Fprintf(&out, "Chain %s (policy ACCEPT)\n", name)
+		} else {
+			fmt.Fprintf(&out, "Chain %s (%d references)\n", name, table.references(name))
+		}
+		if lineNumbers {
+			out.WriteString("num  ")
+		}
+		out.WriteString("target     prot opt source               destination\n")
+		for j, rule := range chain.rules {
+			if lineNumbers {
+				fmt.Fprintf(&out, "%-4d ", j+1)
+			}
+			out.WriteString(rule.listing() + "\n")
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// Allowed returns whether every iptables backend accepts a new connection from the source to the destination port in the FORWARD chain.
+func (k *FakeKernel) Allowed(srcIP, dstIP, protocol string, dstPort int) (bool, error) {
+	pkt, err := newPacket(srcIP, dstIP, protocol, dstPort)
+	if err != nil {
+		return false, err
+	}
+
+	k.Lock()
+	defer k.Unlock()
+	for _, backend := range []string{nftBackend, legacyBackend} {
+		tables, ok := k.stacks[stackKey{backend: backend, ipv6: pkt.srcIP.To4() == nil}]
+		if !ok {
+			continue
+		}
+		table, ok := tables[filterTable]
+		if !ok {
+			continue
+		}
+		pkt.mark = 0
+		result, err := k.evaluateChain(table, "FORWARD", pkt, 0)
+		if err != nil {
+			return false, fmt.Errorf("failed to evaluate %s FORWARD chain for %s: %w", backend, pkt, err)
+		}
+		if result == dropVerdict {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Chains returns the names of the chains in a table of an iptables binary, e.g. iptables-nft.
+func (k *FakeKernel) Chains(binary, tableName string) []string {
+	key, _, ok := parseIptablesBinary(binary)
+	if !ok {
+		return nil
+	}
+	k.Lock()
+	defer k.Unlock()
+	table, ok := k.stacks[key][tableName]
+	if !ok {
+		return nil
+	}
+	return table.sortedChainNames()
+}
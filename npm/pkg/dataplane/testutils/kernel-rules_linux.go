@@ -0,0 +1,338 @@
+package dptestutils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ephemeralPort is the source port of packets, so rules matching well-known source ports only match responses
+	ephemeralPort = 49152
+	// maxJumpDepth stops evaluating chains which jump in a loop
+	maxJumpDepth = 64
+	fullMask     = 0xffffffff
+	newState     = "NEW"
+)
+
+var (
+	errJumpLoop       = errors.New("too many nested jumps")
+	errInvalidPacket  = errors.New("invalid packet")
+	errMissingTarget  = errors.New("jump target doesn't exist")
+	errUnknownVerdict = errors.New("unknown verdict")
+)
+
+type verdict int
+
+const (
+	continueVerdict verdict = iota
+	acceptVerdict
+	dropVerdict
+	returnVerdict
+)
+
+// packet is the first packet of a connection.
+type packet struct {
+	srcIP    net.IP
+	dstIP    net.IP
+	protocol string
+	dstPort  int
+	mark     uint32
+}
+
+func newPacket(srcIP, dstIP, protocol string, dstPort int) (*packet, error) {
+	src, dst := net.ParseIP(srcIP), net.ParseIP(dstIP)
+	if src == nil || dst == nil || (src.To4() == nil) != (dst.To4() == nil) {
+		return nil, fmt.Errorf("%w: source %s and destination %s must be IPs of the same family", errInvalidPacket, srcIP, dstIP)
+	}
+	return &packet{srcIP: src, dstIP: dst, protocol: strings.ToLower(protocol), dstPort: dstPort}, nil
+}
+
+func (pkt *packet) String() string {
+	return fmt.Sprintf("%s -> %s %s/%d", pkt.srcIP, pkt.dstIP, pkt.protocol, pkt.dstPort)
+}
+
+// ip returns the IP for the src or dst direction of a --match-set flag.
+func (pkt *packet) ip(dir string) net.IP {
+	if dir == "src" {
+		return pkt.srcIP
+	}
+	return pkt.dstIP
+}
+
+type portRange struct {
+	start, end int
+}
+
+func (r *portRange) contains(port int) bool {
+	return r != nil && port >= r.start && port <= r.end
+}
+
+type setMatch struct {
+	name    string
+	dirs    []string
+	negated bool
+}
+
+type markMatch struct {
+	value, mask uint32
+	negated     bool
+}
+
+type cidrMatch struct {
+	ipNet   *net.IPNet
+	negated bool
+}
+
+// fakeRule is a parsed rule. Only the matches and targets that NPM uses are supported.
+type fakeRule struct {
+	// spec is the rule as given, which identifies it for -C and -D
+	spec []string
+
+	protocol        string
+	protocolNegated bool
+	dstPort         *portRange
+	srcPort         *portRange
+	src             *cidrMatch
+	dst             *cidrMatch
+	sets            []setMatch
+	marks           []markMatch
+	// states is nil unless the rule matches conntrack states
+	states        []string
+	statesNegated bool
+
+	target                    string
+	setMarkValue, setMarkMask uint32
+}
+
+func (k *FakeKernel) parseRule(key stackKey, table *fakeTable, args []string) (*fakeRule, *iptablesError) {
+	rule := &fakeRule{spec: append([]string(nil), args...)}
+	negated := false
+	badArgs := func(format string, a ...interface{}) *iptablesError {
+		return &iptablesError{iptablesMissingExitCode, fmt.Sprintf(format, a...)}
+	}
+	for i := 0; i < len(args); i++ {
+		flag := args[i]
+		if flag == "!" {
+			negated = true
+			continue
+		}
+		value := ""
+		switch flag {
+		case "--queue-bypass":
+		default:
+			if i+1 == len(args) {
+				return nil, badArgs("option \"%s\" requires an argument", flag)
+			}
+			i++
+			value = args[i]
+		}
+
+		switch flag {
+		case "-m":
+			// modules are implied by their flags
+		case "-p":
+			rule.protocol, rule.protocolNegated = strings.ToLower(value), negated
+		case "--dport", "--sport":
+			if rule.protocol == "" {
+				return nil, badArgs("unknown option \"%s\"", flag)
+			}
+			r, err := parsePortRange(value)
+			if err != nil {
+				return nil, badArgs("invalid port/service `%s' specified", value)
+			}
+			if flag == "--dport" {
+				rule.dstPort = r
+			} else {
+				rule.srcPort = r
+			}
+		case "-s", "-d":
+			ipNet, err := parseCIDR(value)
+			if err != nil {
+				return nil, badArgs("host/network `%s' not found", value)
+			}
+			if flag == "-s" {
+				rule.src = &cidrMatch{ipNet: ipNet, negated: negated}
+			} else {
+				rule.dst = &cidrMatch{ipNet: ipNet, negated: negated}
+			}
+		case "--match-set":
+			if i+1 == len(args) {
+				return nil, badArgs("--match-set requires two args.")
+			}
+			i++
+			if _, ok := k.ipsets[value]; !ok {
+				return nil, badArgs("Set %s doesn't exist.", value)
+			}
+			rule.sets = append(rule.sets, setMatch{name: value, dirs: strings.Split(args[i], ","), negated: negated})
+		case "--mark":
+			mark, mask, err := parseMark(value)
+			if err != nil {
+				return nil, badArgs("Bad MARK value \"%s\"", value)
+			}
+			rule.marks = append(rule.marks, markMatch{value: mark, mask: mask, negated: negated})
+		case "--ctstate":
+			rule.states, rule.statesNegated = strings.Split(value, ","), negated
+		case "--comment", "--limit", "--limit-burst", "--nflog-group", "--nflog-prefix", "--queue-num", "--queue-bypass":
+			// no effect on the verdict
+		case "--set-mark":
+			mark, mask, err := parseMark(value)
+			if err != nil {
+				return nil, badArgs("Bad MARK value \"%s\"", value)
+			}
+			rule.setMarkValue, rule.setMarkMask = mark, mask
+		case "-j":
+			if _, ok := builtinTargets[value]; !ok {
+				if _, ok := table.chains[value]; !ok {
+					if key.backend == nftBackend {
+						return nil, badArgs("Chain '%s' does not exist", value)
+					}
+					return nil, badArgs("Couldn't load target `%s':No such file or directory", value)
+				}
+			}
+			rule.target = value
+		default:
+			return nil, badArgs("unknown option \"%s\"", flag)
+		}
+		negated = false
+	}
+	return rule, nil
+}
+
+func parsePortRange(s string) (*portRange, error) {
+	startString, endString, isRange := strings.Cut(s, ":")
+	start, err := strconv.ParseUint(startString, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %s: %w", s, err)
+	}
+	end := start
+	if isRange {
+		if end, err = strconv.ParseUint(endString, 10, 16); err != nil {
+			return nil, fmt.Errorf("invalid port %s: %w", s, err)
+		}
+	}
+	return &portRange{start: int(start), end: int(end)}, nil
+}
+
+// parseMark parses a mark with an optional mask, e.g. 0x200/0x200.
+func parseMark(s string) (value, mask uint32, err error) {
+	valueString, maskString, hasMask := strings.Cut(s, "/")
+	v, err := strconv.ParseUint(valueString, 0, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid mark %s: %w", s, err)
+	}
+	m := uint64(fullMask)
+	if hasMask {
+		if m, err = strconv.ParseUint(maskString, 0, 32); err != nil {
+			return 0, 0, fmt.Errorf("invalid mask %s: %w", s, err)
+		}
+	}
+	return uint32(v), uint32(m), nil
+}
+
+func (rule *fakeRule) equals(other *fakeRule) bool {
+	return strings.Join(rule.spec, " ") == strings.Join(other.spec, " ")
+}
+
+// listing returns the rule as iptables -L lists it, with the spec in place of the decoded matches.
+func (rule *fakeRule) listing() string {
+	protocol := "all"
+	if rule.protocol != "" {
+		protocol = rule.protocol
+	}
+	extras := make([]string, 0, len(rule.spec))
+	for i := 0; i < len(rule.spec); i++ {
+		if rule.spec[i] == "-j" || rule.spec[i] == "-p" {
+			i++
+			continue
+		}
+		extras = append(extras, rule.spec[i])
+	}
+	return fmt.Sprintf("%-10s %-4s --  0.0.0.0/0            0.0.0.0/0            %s", rule.target, protocol, strings.Join(extras, " "))
+}
+
+func (k *FakeKernel) matches(rule *fakeRule, pkt *packet) bool {
+	if rule.protocol != "" && (rule.protocol == pkt.protocol) == rule.protocolNegated {
+		return false
+	}
+	if rule.dstPort != nil && !rule.dstPort.contains(pkt.dstPort) {
+		return false
+	}
+	if rule.srcPort != nil && !rule.srcPort.contains(ephemeralPort) {
+		return false
+	}
+	if rule.src != nil && rule.src.ipNet.Contains(pkt.srcIP) == rule.src.negated {
+		return false
+	}
+	if rule.dst != nil && rule.dst.ipNet.Contains(pkt.dstIP) == rule.dst.negated {
+		return false
+	}
+	for _, match := range rule.sets {
+		if k.ipsetMatches(match.name, match.dirs, pkt) == match.negated {
+			return false
+		}
+	}
+	for _, match := range rule.marks {
+		if (pkt.mark&match.mask == match.value) == match.negated {
+			return false
+		}
+	}
+	if rule.states != nil {
+		isNew := false
+		for _, state := range rule.states {
+			isNew = isNew || state == newState
+		}
+		if isNew == rule.statesNegated {
+			return false
+		}
+	}
+	return true
+}
+
+// evaluateChain returns the verdict of a chain, which is returnVerdict if the packet reaches the end of a user-defined chain.
+func (k *FakeKernel) evaluateChain(table *fakeTable, chainName string, pkt *packet, depth int) (verdict, error) {
+	if depth > maxJumpDepth {
+		return dropVerdict, errJumpLoop
+	}
+	chain, ok := table.chains[chainName]
+	if !ok {
+		return dropVerdict, fmt.Errorf("%w: %s", errMissingTarget, chainName)
+	}
+	for _, rule := range chain.rules {
+		if !k.matches(rule, pkt) {
+			continue
+		}
+		switch rule.target {
+		case "", nflogTarget, logTarget:
+			continue
+		case acceptTarget, nfqueueTarget:
+			// queued packets are accepted by the userspace program
+			return acceptVerdict, nil
+		case dropTarget, rejectTarget:
+			return dropVerdict, nil
+		case returnTarget:
+			return returnVerdict, nil
+		case markTarget:
+			pkt.mark = (pkt.mark &^ rule.setMarkMask) | rule.setMarkValue
+		default:
+			result, err := k.evaluateChain(table, rule.target, pkt, depth+1)
+			if err != nil {
+				return dropVerdict, err
+			}
+			switch result {
+			case acceptVerdict, dropVerdict:
+				return result, nil
+			case continueVerdict, returnVerdict:
+			default:
+				return dropVerdict, errUnknownVerdict
+			}
+		}
+	}
+	if chain.builtin {
+		// the policy of every builtin chain is ACCEPT
+		return acceptVerdict, nil
+	}
+	return returnVerdict, nil
+}
@@ -0,0 +1,196 @@
+package dptestutils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-container-networking/common"
+	utilexec "k8s.io/utils/exec"
+)
+
+const (
+	bashCommand             = "bash"
+	bashCommandFlag         = "-c"
+	ipsetFlushAndDestroyAll = "ipset flush && ipset destroy"
+
+	commandNotFoundExitCode = 127
+)
+
+var errUnsupportedCommand = errors.New("command isn't supported by the fake kernel")
+
+// FakeKernel models the ipsets and iptables tables of a Linux node in memory.
+// It runs the ipset, iptables, iptables-restore, and grep commands which the Linux dataplane executes through its IOShim,
+// so tests can ask whether the kernel would allow a packet instead of asserting the exact commands.
+// Unsupported commands and flags fail, so a dataplane change that the model doesn't understand doesn't silently pass.
+type FakeKernel struct {
+	sync.Mutex
+	ipsets map[string]*fakeIPSet
+	// stacks holds the tables for each iptables backend and IP family
+	stacks map[stackKey]map[string]*fakeTable
+}
+
+// NewFakeKernel returns a kernel with empty tables, except for the hint chain which kube-proxy creates in the nft backend.
+func NewFakeKernel() *FakeKernel {
+	k := &FakeKernel{
+		ipsets: make(map[string]*fakeIPSet),
+		stacks: make(map[stackKey]map[string]*fakeTable),
+	}
+	mangle, _ := k.table(stackKey{backend: nftBackend}, mangleTable)
+	mangle.chains[kubeHintChain] = &fakeChain{}
+	return k
+}
+
+// IOShim returns an IOShim which runs commands against the kernel.
+func (k *FakeKernel) IOShim() *common.IOShim {
+	return &common.IOShim{Exec: k}
+}
+
+// Command returns a command which runs against the kernel once it's run or its output is read.
+func (k *FakeKernel) Command(cmd string, args ...string) utilexec.Cmd {
+	return &fakeCmd{kernel: k, name: cmd, args: args}
+}
+
+// CommandContext ignores the context since commands return immediately.
+func (k *FakeKernel) CommandContext(_ context.Context, cmd string, args ...string) utilexec.Cmd {
+	return k.Command(cmd, args...)
+}
+
+// LookPath returns the file since every supported binary is built in.
+func (*FakeKernel) LookPath(file string) (string, error) {
+	return file, nil
+}
+
+// run returns the combined output and exit error of a command.
+func (k *FakeKernel) run(name string, args []string, stdin io.Reader) ([]byte, error) {
+	var input []byte
+	if stdin != nil {
+		// read before locking since stdin may be the output of another command
+		var err error
+		if input, err = io.ReadAll(stdin); err != nil {
+			return nil, fmt.Errorf("failed to read stdin: %w", err)
+		}
+	}
+
+	if name == grepCommand {
+		return grep(args, input)
+	}
+
+	k.Lock()
+	defer k.Unlock()
+	switch {
+	case name == ipsetCommand:
+		return k.ipset(args, input)
+	case name == bashCommand && len(args) == 2 && args[0] == bashCommandFlag && args[1] == ipsetFlushAndDestroyAll:
+		return k.ipsetFlushAndDestroyAll()
+	}
+	if stack, restore, ok := parseIptablesBinary(name); ok {
+		if restore {
+			return k.iptablesRestore(stack, args, input)
+		}
+		return k.iptables(stack, args)
+	}
+	return exitWithError(commandNotFoundExitCode, "%s: %s %s", errUnsupportedCommand.Error(), name, strings.Join(args, " "))
+}
+
+// exitWithError returns the message as output along with an exit error like a failed process.
+func exitWithError(code int, format string, args ...interface{}) ([]byte, error) {
+	msg := fmt.Sprintf(format, args...)
+	return []byte(msg + "\n"), codeExitError(code)
+}
+
+func codeExitError(code int) error {
+	return utilexec.CodeExitError{Err: fmt.Errorf("exit status %d", code), Code: code}
+}
+
+// fakeCmd runs lazily so that piped commands can be started in any order.
+// Stdout and stderr are combined.
+type fakeCmd struct {
+	kernel *FakeKernel
+	name   string
+	args   []string
+	stdin  io.Reader
+	stdout io.Writer
+
+	once   sync.Once
+	output []byte
+	err    error
+}
+
+func (c *fakeCmd) run() {
+	c.once.Do(func() {
+		c.output, c.err = c.kernel.run(c.name, c.args, c.stdin)
+		if c.stdout != nil {
+			_, _ = c.stdout.Write(c.output)
+		}
+	})
+}
+
+func (c *fakeCmd) Run() error {
+	c.run()
+	return c.err
+}
+
+func (c *fakeCmd) CombinedOutput() ([]byte, error) {
+	c.run()
+	return c.output, c.err
+}
+
+func (c *fakeCmd) Output() ([]byte, error) {
+	return c.CombinedOutput()
+}
+
+func (*fakeCmd) SetDir(string) {}
+
+func (c *fakeCmd) SetStdin(in io.Reader) {
+	c.stdin = in
+}
+
+func (c *fakeCmd) SetStdout(out io.Writer) {
+	c.stdout = out
+}
+
+func (*fakeCmd) SetStderr(io.Writer) {}
+
+func (*fakeCmd) SetEnv([]string) {}
+
+func (c *fakeCmd) StdoutPipe() (io.ReadCloser, error) {
+	return &lazyReader{cmd: c}, nil
+}
+
+func (*fakeCmd) StderrPipe() (io.ReadCloser, error) {
+	return io.NopCloser(&bytes.Buffer{}), nil
+}
+
+func (*fakeCmd) Start() error {
+	return nil
+}
+
+func (c *fakeCmd) Wait() error {
+	c.run()
+	return c.err
+}
+
+func (*fakeCmd) Stop() {}
+
+// lazyReader runs its command on the first read.
+type lazyReader struct {
+	cmd    *fakeCmd
+	reader *bytes.Reader
+}
+
+func (r *lazyReader) Read(p []byte) (int, error) {
+	if r.reader == nil {
+		r.cmd.run()
+		r.reader = bytes.NewReader(r.cmd.output)
+	}
+	return r.reader.Read(p) //nolint:wrapcheck // io.EOF must be returned as is
+}
+
+func (*lazyReader) Close() error {
+	return nil
+}
@@ -58,8 +58,10 @@ type updateNPMPod struct {
 // todo definitely requires further optimization between the intersection
 // of types, PodMetadata, NpmPod and corev1.pod
 type PodMetadata struct {
-	PodKey   string
-	PodIP    string
+	PodKey string
+	PodIP  string
+	// PodIPv6 is the IPv6 address of a dual-stack pod. It is only added to sets when IPv6 is enabled.
+	PodIPv6  string
 	NodeName string
 }
 
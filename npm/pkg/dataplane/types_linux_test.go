@@ -0,0 +1,7 @@
+package dataplane
+
+// Action represents a single action on the DataPlane.
+// Linux has no equivalent of the HNS actions in Windows since the fake kernel has no state outside of the DataPlane's commands.
+type Action struct {
+	DPAction
+}
@@ -0,0 +1,167 @@
+// Package verdictlog collects the packets which NPM's iptables rules send to NFLOG when verdict logging is enabled.
+// Each packet is logged and counted with the policy, direction and verdict of the ACL which matched it.
+package verdictlog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/Azure/azure-container-networking/npm/metrics"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
+	"k8s.io/klog"
+)
+
+const (
+	ipv4HeaderMinLength = 20
+	ipv6HeaderLength    = 40
+
+	protocolTCP  = 6
+	protocolUDP  = 17
+	protocolSCTP = 132
+)
+
+var (
+	ErrUnsupportedOS = errors.New("verdict logging is only supported on Linux")
+	errShortPacket   = errors.New("packet is too short")
+	errIPVersion     = errors.New("unknown IP version")
+)
+
+// PolicyResolver finds the policy which generated a verdict log prefix, or whose verdict log ID is in the packet mark.
+// The DataPlane implements this interface.
+type PolicyResolver interface {
+	GetPolicyByHash(policyHash string) (*policies.NPMNetworkPolicy, bool)
+	GetPolicyByVerdictLogID(id uint32) (*policies.NPMNetworkPolicy, bool)
+}
+
+// Collector decodes packets logged to an NFLOG group.
+type Collector struct {
+	nflogGroup uint16
+	resolver   PolicyResolver
+}
+
+func NewCollector(cfg *policies.VerdictLogCfg, resolver PolicyResolver) *Collector {
+	return &Collector{
+		nflogGroup: cfg.NflogGroup,
+		resolver:   resolver,
+	}
+}
+
+// Verdict is a packet logged by an ACL.
+type Verdict struct {
+	policies.VerdictLogPrefix
+	// PolicyKey is empty if the policy was removed before the packet was collected
+	PolicyKey string
+	Namespace string
+	Packet
+}
+
+// Packet holds the headers of a logged packet which identify its flow.
+type Packet struct {
+	Protocol string
+	SrcIP    net.IP
+	DstIP    net.IP
+	// SrcPort and DstPort are zero unless the protocol is TCP, UDP or SCTP
+	SrcPort uint16
+	DstPort uint16
+}
+
+// handle logs and counts a packet logged with the NFLOG prefix.
+// The policy is only logged, since counting per policy would make the metric's cardinality grow with the number of policies.
+func (c *Collector) handle(prefix string, mark uint32, payload []byte) {
+	verdict, err := c.verdict(prefix, mark, payload)
+	if err != nil {
+		klog.Warningf("[verdictlog] failed to decode logged packet with prefix %q: %s", prefix, err.Error())
+		return
+	}
+
+	policyKey := verdict.PolicyKey
+	if policyKey == "" {
+		policyKey = "unknown"
+	}
+	klog.Infof("[verdictlog] verdict=%s policy=%s namespace=%s direction=%s acl=%d protocol=%s src=%s dst=%s srcPort=%d dstPort=%d",
+		verdict.Verdict, policyKey, verdict.Namespace, verdict.Direction, verdict.ACLIndex,
+		verdict.Protocol, verdict.SrcIP, verdict.DstIP, verdict.SrcPort, verdict.DstPort)
+	metrics.IncPolicyVerdicts(verdict.Namespace, string(verdict.Direction), string(verdict.Verdict))
+}
+
+func (c *Collector) verdict(prefix string, mark uint32, payload []byte) (*Verdict, error) {
+	logPrefix, err := policies.ParseVerdictLogPrefix(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prefix: %w", err)
+	}
+
+	packet, err := decodePacket(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode packet: %w", err)
+	}
+
+	verdict := &Verdict{
+		VerdictLogPrefix: logPrefix,
+		Packet:           *packet,
+	}
+	var policy *policies.NPMNetworkPolicy
+	var ok bool
+	if logPrefix.FromMark() {
+		policy, ok = c.resolver.GetPolicyByVerdictLogID(policies.VerdictLogIDFromMark(mark))
+	} else {
+		policy, ok = c.resolver.GetPolicyByHash(logPrefix.PolicyHash)
+	}
+	if ok {
+		verdict.PolicyKey = policy.PolicyKey
+		verdict.Namespace = policy.Namespace
+	}
+	return verdict, nil
+}
+
+// decodePacket decodes the IP header and the ports of a packet starting at its network header.
+func decodePacket(payload []byte) (*Packet, error) {
+	if len(payload) == 0 {
+		return nil, errShortPacket
+	}
+
+	var packet Packet
+	var protocol byte
+	var transport []byte
+	switch payload[0] >> 4 {
+	case 4:
+		headerLength := int(payload[0]&0x0f) * 4
+		if len(payload) < ipv4HeaderMinLength || len(payload) < headerLength {
+			return nil, errShortPacket
+		}
+		protocol = payload[9]
+		packet.SrcIP = net.IP(payload[12:16])
+		packet.DstIP = net.IP(payload[16:20])
+		transport = payload[headerLength:]
+	case 6:
+		if len(payload) < ipv6HeaderLength {
+			return nil, errShortPacket
+		}
+		// extension headers aren't followed, so the ports of such packets are unknown
+		protocol = payload[6]
+		packet.SrcIP = net.IP(payload[8:24])
+		packet.DstIP = net.IP(payload[24:40])
+		transport = payload[ipv6HeaderLength:]
+	default:
+		return nil, errIPVersion
+	}
+
+	switch protocol {
+	case protocolTCP:
+		packet.Protocol = string(policies.TCP)
+	case protocolUDP:
+		packet.Protocol = string(policies.UDP)
+	case protocolSCTP:
+		packet.Protocol = string(policies.SCTP)
+	default:
+		packet.Protocol = fmt.Sprintf("%d", protocol)
+		return &packet, nil
+	}
+	// the source and destination ports are the first 4 bytes of TCP, UDP and SCTP headers
+	if len(transport) >= 4 {
+		packet.SrcPort = binary.BigEndian.Uint16(transport[0:2])
+		packet.DstPort = binary.BigEndian.Uint16(transport[2:4])
+	}
+	return &packet, nil
+}
@@ -0,0 +1,115 @@
+package verdictlog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/klog"
+)
+
+const receiveBufferSize = 1 << 16
+
+// Run binds to the NFLOG group and handles logged packets until stopCh is closed.
+func (c *Collector) Run(stopCh <-chan struct{}) error {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_NETFILTER)
+	if err != nil {
+		return fmt.Errorf("failed to create netfilter netlink socket: %w", err)
+	}
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		unix.Close(fd)
+		return fmt.Errorf("failed to bind netfilter netlink socket: %w", err)
+	}
+
+	// kernels before 3.17 require binding NFLOG to each address family before binding to a group
+	requests := [][]byte{
+		configMessage(unix.AF_INET, 0, cmdAttr(nfulnlCfgCmdPFBind)),
+		configMessage(unix.AF_INET6, 0, cmdAttr(nfulnlCfgCmdPFBind)),
+		configMessage(unix.AF_UNSPEC, c.nflogGroup, cmdAttr(nfulnlCfgCmdBind)),
+		configMessage(unix.AF_UNSPEC, c.nflogGroup, copyModeAttr()),
+	}
+	for i, request := range requests {
+		if err := sendConfig(fd, uint32(i+1), request); err != nil {
+			unix.Close(fd)
+			return fmt.Errorf("failed to bind to NFLOG group %d: %w", c.nflogGroup, err)
+		}
+	}
+	klog.Infof("[verdictlog] collecting logged packets from NFLOG group %d", c.nflogGroup)
+
+	var stopped atomic.Bool
+	go func() {
+		<-stopCh
+		stopped.Store(true)
+		// unblocks Recvfrom
+		unix.Close(fd)
+	}()
+
+	buf := make([]byte, receiveBufferSize)
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			if stopped.Load() {
+				return nil
+			}
+			if errors.Is(err, unix.ENOBUFS) || errors.Is(err, unix.EINTR) {
+				// the kernel dropped logged packets because the socket buffer was full
+				continue
+			}
+			return fmt.Errorf("failed to receive from NFLOG group %d: %w", c.nflogGroup, err)
+		}
+
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			klog.Warningf("[verdictlog] failed to parse netlink messages: %s", err.Error())
+			continue
+		}
+		for _, msg := range msgs {
+			if msg.Header.Type != nflogMessageType(nfulnlMsgPacket) {
+				continue
+			}
+			packet, err := parseNflogPacket(msg.Data)
+			if err != nil {
+				klog.Warningf("[verdictlog] failed to parse NFLOG packet: %s", err.Error())
+				continue
+			}
+			c.handle(packet.prefix, packet.mark, packet.payload)
+		}
+	}
+}
+
+// sendConfig sends an NFULNL_MSG_CONFIG message and waits for the kernel to acknowledge it.
+func sendConfig(fd int, seq uint32, data []byte) error {
+	msg := make([]byte, unix.SizeofNlMsghdr, unix.SizeofNlMsghdr+len(data))
+	binary.NativeEndian.PutUint32(msg[0:4], uint32(unix.SizeofNlMsghdr+len(data)))
+	binary.NativeEndian.PutUint16(msg[4:6], nflogMessageType(nfulnlMsgConfig))
+	binary.NativeEndian.PutUint16(msg[6:8], unix.NLM_F_REQUEST|unix.NLM_F_ACK)
+	binary.NativeEndian.PutUint32(msg[8:12], seq)
+	msg = append(msg, data...)
+
+	if err := unix.Sendto(fd, msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return fmt.Errorf("failed to send config: %w", err)
+	}
+
+	buf := make([]byte, unix.Getpagesize())
+	n, _, err := unix.Recvfrom(fd, buf, 0)
+	if err != nil {
+		return fmt.Errorf("failed to receive ack: %w", err)
+	}
+	replies, err := syscall.ParseNetlinkMessage(buf[:n])
+	if err != nil {
+		return fmt.Errorf("failed to parse ack: %w", err)
+	}
+	for _, reply := range replies {
+		if reply.Header.Type != unix.NLMSG_ERROR || reply.Header.Seq != seq || len(reply.Data) < 4 {
+			continue
+		}
+		if errno := -int32(binary.NativeEndian.Uint32(reply.Data[0:4])); errno != 0 {
+			return fmt.Errorf("kernel rejected config: %w", syscall.Errno(errno))
+		}
+		return nil
+	}
+	return nil
+}
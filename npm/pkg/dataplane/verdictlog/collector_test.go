@@ -0,0 +1,141 @@
+package verdictlog
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/npm/metrics"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
+	"github.com/Azure/azure-container-networking/npm/util"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeResolver struct {
+	byHash map[string]*policies.NPMNetworkPolicy
+	byID   map[uint32]*policies.NPMNetworkPolicy
+}
+
+func (r fakeResolver) GetPolicyByHash(policyHash string) (*policies.NPMNetworkPolicy, bool) {
+	policy, ok := r.byHash[policyHash]
+	return policy, ok
+}
+
+func (r fakeResolver) GetPolicyByVerdictLogID(id uint32) (*policies.NPMNetworkPolicy, bool) {
+	policy, ok := r.byID[id]
+	return policy, ok
+}
+
+func ipv4TCPPacket(src, dst string, srcPort, dstPort uint16) []byte {
+	packet := make([]byte, 40)
+	packet[0] = 0x45
+	packet[9] = protocolTCP
+	copy(packet[12:16], net.ParseIP(src).To4())
+	copy(packet[16:20], net.ParseIP(dst).To4())
+	binary.BigEndian.PutUint16(packet[20:22], srcPort)
+	binary.BigEndian.PutUint16(packet[22:24], dstPort)
+	return packet
+}
+
+func TestDecodePacket(t *testing.T) {
+	packet, err := decodePacket(ipv4TCPPacket("10.0.0.1", "10.0.0.2", 40000, 443))
+	require.NoError(t, err)
+	require.Equal(t, "TCP", packet.Protocol)
+	require.Equal(t, "10.0.0.1", packet.SrcIP.String())
+	require.Equal(t, "10.0.0.2", packet.DstIP.String())
+	require.Equal(t, uint16(40000), packet.SrcPort)
+	require.Equal(t, uint16(443), packet.DstPort)
+
+	ipv6 := make([]byte, 48)
+	ipv6[0] = 0x60
+	ipv6[6] = protocolUDP
+	copy(ipv6[8:24], net.ParseIP("fd00::1"))
+	copy(ipv6[24:40], net.ParseIP("fd00::2"))
+	binary.BigEndian.PutUint16(ipv6[40:42], 53000)
+	binary.BigEndian.PutUint16(ipv6[42:44], 53)
+	packet, err = decodePacket(ipv6)
+	require.NoError(t, err)
+	require.Equal(t, "UDP", packet.Protocol)
+	require.Equal(t, "fd00::1", packet.SrcIP.String())
+	require.Equal(t, "fd00::2", packet.DstIP.String())
+	require.Equal(t, uint16(53), packet.DstPort)
+
+	icmp := ipv4TCPPacket("10.0.0.1", "10.0.0.2", 0, 0)
+	icmp[9] = 1
+	packet, err = decodePacket(icmp)
+	require.NoError(t, err)
+	require.Equal(t, "1", packet.Protocol)
+	require.Zero(t, packet.DstPort)
+
+	_, err = decodePacket(nil)
+	require.ErrorIs(t, err, errShortPacket)
+	_, err = decodePacket([]byte{0x45, 0})
+	require.ErrorIs(t, err, errShortPacket)
+	_, err = decodePacket(make([]byte, 40))
+	require.ErrorIs(t, err, errIPVersion)
+}
+
+func TestParseNflogPacket(t *testing.T) {
+	payload := ipv4TCPPacket("10.0.0.1", "10.0.0.2", 40000, 443)
+	data := configMessage(2, 100,
+		nlattr(1, []byte{0, 0, 0, 0}),
+		nlattr(nfulaMark, []byte{0, 0x05, 0x04, 0x00}),
+		nlattr(nfulaPrefix, []byte("npm:DROP:IN\x00")),
+		nlattr(nfulaPayload, payload),
+	)
+
+	packet, err := parseNflogPacket(data)
+	require.NoError(t, err)
+	require.Equal(t, "npm:DROP:IN", packet.prefix)
+	require.Equal(t, uint32(0x50400), packet.mark)
+	require.Equal(t, payload, packet.payload)
+
+	// an attribute longer than the message
+	malformed := append(configMessage(2, 100), 0xff, 0, 0, 0)
+	_, err = parseNflogPacket(malformed)
+	require.ErrorIs(t, err, errMalformedAttribute)
+}
+
+func TestVerdict(t *testing.T) {
+	metrics.ReinitializeAll()
+	policy := policies.NewNPMNetworkPolicy("deny-all", "x")
+	resolver := fakeResolver{
+		byHash: map[string]*policies.NPMNetworkPolicy{util.Hash(policy.PolicyKey): policy},
+		byID:   map[uint32]*policies.NPMNetworkPolicy{5: policy},
+	}
+	c := NewCollector(&policies.VerdictLogCfg{NflogGroup: 100, RateLimitPerSecond: 10}, resolver)
+
+	payload := ipv4TCPPacket("10.0.0.1", "10.0.0.2", 40000, 443)
+	verdict, err := c.verdict("npm:ALLOW:IN:"+util.Hash(policy.PolicyKey)+":2", 0, payload)
+	require.NoError(t, err)
+	require.Equal(t, policies.LoggedAllow, verdict.Verdict)
+	require.Equal(t, policies.Ingress, verdict.Direction)
+	require.Equal(t, 2, verdict.ACLIndex)
+	require.Equal(t, "x/deny-all", verdict.PolicyKey)
+	require.Equal(t, "x", verdict.Namespace)
+
+	// the final drop rules carry the policy in the mark
+	verdict, err = c.verdict("npm:AUDIT:OUT", 0x50020, payload)
+	require.NoError(t, err)
+	require.Equal(t, policies.LoggedAudit, verdict.Verdict)
+	require.Equal(t, policies.Egress, verdict.Direction)
+	require.Equal(t, "x/deny-all", verdict.PolicyKey)
+
+	// the policy may be removed before the packet is collected
+	verdict, err = c.verdict("npm:DROP:OUT:123:0", 0, payload)
+	require.NoError(t, err)
+	require.Empty(t, verdict.PolicyKey)
+	verdict, err = c.verdict("npm:DROP:OUT", 0x800, payload)
+	require.NoError(t, err)
+	require.Empty(t, verdict.PolicyKey)
+
+	_, err = c.verdict("not-npm", 0, payload)
+	require.ErrorIs(t, err, policies.ErrInvalidVerdictLogPrefix)
+
+	if !util.IsWindowsDP() {
+		c.handle("npm:DROP:IN", 0x50400, payload)
+		count, err := metrics.TotalPolicyVerdicts("x", "IN", "DROP")
+		require.NoError(t, err)
+		require.Equal(t, 1, count)
+	}
+}
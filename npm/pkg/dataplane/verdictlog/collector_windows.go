@@ -0,0 +1,6 @@
+package verdictlog
+
+// Run returns an error since Windows has no NFLOG. HNS ACLs aren't logged.
+func (c *Collector) Run(_ <-chan struct{}) error {
+	return ErrUnsupportedOS
+}
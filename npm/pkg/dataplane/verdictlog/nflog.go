@@ -0,0 +1,128 @@
+package verdictlog
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// nfnetlink_log constants from include/uapi/linux/netfilter/nfnetlink_log.h
+const (
+	nfnlSubsysULOG = 4
+
+	nfulnlMsgPacket = 0
+	nfulnlMsgConfig = 1
+
+	nfulaMark    = 2
+	nfulaPayload = 9
+	nfulaPrefix  = 10
+
+	nfulaCfgCmd  = 1
+	nfulaCfgMode = 2
+
+	nfulnlCfgCmdBind   = 1
+	nfulnlCfgCmdPFBind = 3
+
+	nfulnlCopyPacket = 2
+
+	// nfgenmsgLength is the length of the nfnetlink header following the netlink header
+	nfgenmsgLength  = 4
+	nlattrHeaderLen = 4
+	// nlaTypeMask strips the nested and byte order flags from the attribute type
+	nlaTypeMask = 0x3fff
+
+	// copyRange is the number of bytes of each packet sent by the kernel, which covers the IP and transport headers
+	copyRange = 128
+)
+
+var errMalformedAttribute = errors.New("malformed netlink attribute")
+
+// nflogMessageType is the netlink message type of NFLOG messages.
+func nflogMessageType(msgType uint16) uint16 {
+	return nfnlSubsysULOG<<8 | msgType
+}
+
+// nflogPacket holds the attributes of an NFULNL_MSG_PACKET message used by the collector.
+type nflogPacket struct {
+	prefix  string
+	mark    uint32
+	payload []byte
+}
+
+// parseNflogPacket returns the prefix, mark and payload attributes of an NFULNL_MSG_PACKET message following its netlink header.
+func parseNflogPacket(data []byte) (*nflogPacket, error) {
+	if len(data) < nfgenmsgLength {
+		return nil, errMalformedAttribute
+	}
+	packet := &nflogPacket{}
+	attrs := data[nfgenmsgLength:]
+	for len(attrs) >= nlattrHeaderLen {
+		attrLen := int(binary.NativeEndian.Uint16(attrs[0:2]))
+		attrType := binary.NativeEndian.Uint16(attrs[2:4]) & nlaTypeMask
+		if attrLen < nlattrHeaderLen || attrLen > len(attrs) {
+			return nil, errMalformedAttribute
+		}
+
+		value := attrs[nlattrHeaderLen:attrLen]
+		switch attrType {
+		case nfulaPrefix:
+			// the prefix is null terminated
+			for i, b := range value {
+				if b == 0 {
+					value = value[:i]
+					break
+				}
+			}
+			packet.prefix = string(value)
+		case nfulaMark:
+			if len(value) >= 4 {
+				packet.mark = binary.BigEndian.Uint32(value[0:4])
+			}
+		case nfulaPayload:
+			packet.payload = value
+		}
+
+		alignedLen := nlaAlign(attrLen)
+		if alignedLen > len(attrs) {
+			break
+		}
+		attrs = attrs[alignedLen:]
+	}
+	return packet, nil
+}
+
+// configMessage returns an NFULNL_MSG_CONFIG message for the NFLOG group without its netlink header.
+func configMessage(family uint8, group uint16, attrs ...[]byte) []byte {
+	msg := make([]byte, nfgenmsgLength)
+	msg[0] = family
+	// version is NFNETLINK_V0 and the resource ID is the group in network byte order
+	binary.BigEndian.PutUint16(msg[2:4], group)
+	for _, attr := range attrs {
+		msg = append(msg, attr...)
+	}
+	return msg
+}
+
+func cmdAttr(cmd uint8) []byte {
+	return nlattr(nfulaCfgCmd, []byte{cmd})
+}
+
+func copyModeAttr() []byte {
+	// struct nfulnl_msg_config_mode { __be32 copy_range; __u8 copy_mode; __u8 _pad; }
+	value := make([]byte, 6)
+	binary.BigEndian.PutUint32(value[0:4], copyRange)
+	value[4] = nfulnlCopyPacket
+	return nlattr(nfulaCfgMode, value)
+}
+
+func nlattr(attrType uint16, value []byte) []byte {
+	attrLen := nlattrHeaderLen + len(value)
+	attr := make([]byte, nlaAlign(attrLen))
+	binary.NativeEndian.PutUint16(attr[0:2], uint16(attrLen))
+	binary.NativeEndian.PutUint16(attr[2:4], attrType)
+	copy(attr[nlattrHeaderLen:], value)
+	return attr
+}
+
+func nlaAlign(length int) int {
+	return (length + 3) &^ 3
+}
@@ -19,6 +19,8 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type DataplaneEventsClient interface {
 	Connect(ctx context.Context, in *DatapathPodMetadata, opts ...grpc.CallOption) (DataplaneEvents_ConnectClient, error)
+	// ReportStatus is called by a datapath pod to report the programming status of its policies.
+	ReportStatus(ctx context.Context, in *PolicyStatusReport, opts ...grpc.CallOption) (*PolicyStatusAck, error)
 }
 
 type dataplaneEventsClient struct {
@@ -61,11 +63,22 @@ func (x *dataplaneEventsConnectClient) Recv() (*Events, error) {
 	return m, nil
 }
 
+func (c *dataplaneEventsClient) ReportStatus(ctx context.Context, in *PolicyStatusReport, opts ...grpc.CallOption) (*PolicyStatusAck, error) {
+	out := new(PolicyStatusAck)
+	err := c.cc.Invoke(ctx, "/protos.DataplaneEvents/ReportStatus", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // DataplaneEventsServer is the server API for DataplaneEvents service.
 // All implementations must embed UnimplementedDataplaneEventsServer
 // for forward compatibility
 type DataplaneEventsServer interface {
 	Connect(*DatapathPodMetadata, DataplaneEvents_ConnectServer) error
+	// ReportStatus is called by a datapath pod to report the programming status of its policies.
+	ReportStatus(context.Context, *PolicyStatusReport) (*PolicyStatusAck, error)
 	mustEmbedUnimplementedDataplaneEventsServer()
 }
 
@@ -76,6 +89,9 @@ type UnimplementedDataplaneEventsServer struct {
 func (UnimplementedDataplaneEventsServer) Connect(*DatapathPodMetadata, DataplaneEvents_ConnectServer) error {
 	return status.Errorf(codes.Unimplemented, "method Connect not implemented")
 }
+func (UnimplementedDataplaneEventsServer) ReportStatus(context.Context, *PolicyStatusReport) (*PolicyStatusAck, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReportStatus not implemented")
+}
 func (UnimplementedDataplaneEventsServer) mustEmbedUnimplementedDataplaneEventsServer() {}
 
 // UnsafeDataplaneEventsServer may be embedded to opt out of forward compatibility for this service.
@@ -110,13 +126,36 @@ func (x *dataplaneEventsConnectServer) Send(m *Events) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _DataplaneEvents_ReportStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PolicyStatusReport)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataplaneEventsServer).ReportStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protos.DataplaneEvents/ReportStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataplaneEventsServer).ReportStatus(ctx, req.(*PolicyStatusReport))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // DataplaneEvents_ServiceDesc is the grpc.ServiceDesc for DataplaneEvents service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
 var DataplaneEvents_ServiceDesc = grpc.ServiceDesc{
 	ServiceName: "protos.DataplaneEvents",
 	HandlerType: (*DataplaneEventsServer)(nil),
-	Methods:     []grpc.MethodDesc{},
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ReportStatus",
+			Handler:    _DataplaneEvents_ReportStatus_Handler,
+		},
+	},
 	Streams: []grpc.StreamDesc{
 		{
 			StreamName:    "Connect",
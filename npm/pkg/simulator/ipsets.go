@@ -0,0 +1,150 @@
+package simulator
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/Azure/azure-container-networking/npm/pkg/controlplane/controllers/common"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
+	"github.com/Azure/azure-container-networking/npm/util"
+)
+
+// kubeAllNamespaces is the list of every namespace set, like in the pod and namespace controllers.
+var kubeAllNamespaces = ipsets.NewIPSetMetadata(util.KubeAllNamespacesFlag, ipsets.KeyLabelOfNamespace)
+
+// ipsetWriter is the part of the dataplane which the pod and namespace controllers program IPSet membership with.
+type ipsetWriter interface {
+	AddToSets(setMetadatas []*ipsets.IPSetMetadata, podMetadata *dataplane.PodMetadata) error
+	AddToLists(listMetadatas, setMetadatas []*ipsets.IPSetMetadata) error
+}
+
+// memberSets adds pods to an IPSetManager like the DataPlane does.
+type memberSets struct {
+	*ipsets.IPSetManager
+}
+
+func (m memberSets) AddToSets(setMetadatas []*ipsets.IPSetMetadata, podMetadata *dataplane.PodMetadata) error {
+	if err := m.IPSetManager.AddToSets(setMetadatas, podMetadata.PodIP, podMetadata.PodKey); err != nil {
+		return fmt.Errorf("failed to add pod %s to sets: %w", podMetadata.PodKey, err)
+	}
+	if podMetadata.PodIPv6 != "" {
+		if err := m.IPSetManager.AddToSets(setMetadatas, podMetadata.PodIPv6, podMetadata.PodKey); err != nil {
+			return fmt.Errorf("failed to add IPv6 address of pod %s to sets: %w", podMetadata.PodKey, err)
+		}
+	}
+	return nil
+}
+
+// ipsetManager returns an IPSetManager with the sets of every object, building it if an object changed.
+// The sets stay in memory since they are never applied.
+func (s *Simulator) ipsetManager() (*ipsets.IPSetManager, error) {
+	if s.ipsetMgr != nil {
+		return s.ipsetMgr, nil
+	}
+
+	iMgr := ipsets.NewIPSetManager(&ipsets.IPSetManagerCfg{IPSetMode: ipsets.ApplyAllIPSets, EnableIPv6: true}, nil)
+	if err := s.programMembers(memberSets{iMgr}); err != nil {
+		return nil, err
+	}
+	for _, p := range s.policies {
+		if err := createPolicySets(iMgr, append(p.AllPodSelectorIPSets(), p.RuleIPSets...)); err != nil {
+			return nil, fmt.Errorf("failed to create sets of policy %s: %w", p.PolicyKey, err)
+		}
+	}
+	s.ipsetMgr = iMgr
+	return iMgr, nil
+}
+
+// programMembers adds namespaces and pods to their sets like the namespace and pod controllers.
+func (s *Simulator) programMembers(w ipsetWriter) error {
+	for _, ns := range s.sortedNamespaces() {
+		namespaceSets := []*ipsets.IPSetMetadata{ipsets.NewIPSetMetadata(ns.Name, ipsets.Namespace)}
+		lists := []*ipsets.IPSetMetadata{kubeAllNamespaces}
+		for key, value := range ns.LabelsMap {
+			lists = append(lists,
+				ipsets.NewIPSetMetadata(key, ipsets.KeyLabelOfNamespace),
+				ipsets.NewIPSetMetadata(util.GetIpSetFromLabelKV(key, value), ipsets.KeyValueLabelOfNamespace))
+		}
+		if err := w.AddToLists(lists, namespaceSets); err != nil {
+			return fmt.Errorf("failed to add namespace %s to lists: %w", ns.Name, err)
+		}
+	}
+
+	for _, pod := range s.sortedPods() {
+		podKey := pod.Namespace + "/" + pod.Name
+		podIP := s.memberIP(pod)
+		podMetadata := dataplane.NewPodMetadata(podKey, podIP, "")
+		podMetadata.PodIPv6 = pod.PodIPv6
+
+		sets := []*ipsets.IPSetMetadata{ipsets.NewIPSetMetadata(pod.Namespace, ipsets.Namespace)}
+		for key, value := range pod.Labels {
+			sets = append(sets,
+				ipsets.NewIPSetMetadata(key, ipsets.KeyLabelOfPod),
+				ipsets.NewIPSetMetadata(util.GetIpSetFromLabelKV(key, value), ipsets.KeyValueLabelOfPod))
+		}
+		if err := w.AddToSets(sets, podMetadata); err != nil {
+			return err
+		}
+
+		for i := range pod.ContainerPorts {
+			port := &pod.ContainerPorts[i]
+			if port.Name == "" {
+				continue
+			}
+			namedPortMetadata := dataplane.NewPodMetadata(podKey, namedPortMember(podIP, string(port.Protocol), port.ContainerPort), "")
+			if pod.PodIPv6 != "" {
+				namedPortMetadata.PodIPv6 = namedPortMember(pod.PodIPv6, string(port.Protocol), port.ContainerPort)
+			}
+			if err := w.AddToSets([]*ipsets.IPSetMetadata{ipsets.NewIPSetMetadata(port.Name, ipsets.NamedPorts)}, namedPortMetadata); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// createPolicySets creates the sets of a policy and adds their translated members like the DataPlane.
+func createPolicySets(iMgr *ipsets.IPSetManager, sets []*ipsets.TranslatedIPSet) error {
+	for _, set := range sets {
+		iMgr.CreateIPSets([]*ipsets.IPSetMetadata{set.Metadata})
+		switch {
+		case set.Metadata.Type == ipsets.CIDRBlocks:
+			for _, member := range set.Members {
+				if err := iMgr.AddToSets([]*ipsets.IPSetMetadata{set.Metadata}, member, ""); err != nil {
+					return fmt.Errorf("failed to add %s to set %s: %w", member, set.Metadata.GetPrefixName(), err)
+				}
+			}
+		case set.Metadata.Type == ipsets.NestedLabelOfPod && len(set.Members) > 0:
+			if err := iMgr.AddToLists([]*ipsets.IPSetMetadata{set.Metadata}, ipsets.GetMembersOfTranslatedSets(set.Members)); err != nil {
+				return fmt.Errorf("failed to add members to list %s: %w", set.Metadata.GetPrefixName(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// memberIP is the IP which the pod is added to sets with.
+// Pods of workload manifests have no IP, so they get a placeholder from 0.0.0.0/8 which only identifies them in the sets.
+// Placeholders never match ipBlocks since flows of these pods have no IP.
+func (s *Simulator) memberIP(pod *common.NpmPod) string {
+	if pod.PodIP != "" {
+		return pod.PodIP
+	}
+	podKey := pod.Namespace + "/" + pod.Name
+	if ip, ok := s.placeholderIPs[podKey]; ok {
+		return ip
+	}
+	n := len(s.placeholderIPs) + 1
+	ip := net.IPv4(0, byte(n>>16), byte(n>>8), byte(n)).String()
+	s.placeholderIPs[podKey] = ip
+	return ip
+}
+
+// namedPortMember is a member of a named port set, formatted like the pod controller.
+func namedPortMember(ip, protocol string, port int32) string {
+	if protocol == "" {
+		return fmt.Sprintf("%s,%d", ip, port)
+	}
+	return fmt.Sprintf("%s,%s:%d", ip, protocol, port)
+}
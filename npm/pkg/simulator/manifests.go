@@ -0,0 +1,177 @@
+package simulator
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	policyv1alpha1 "github.com/Azure/azure-container-networking/npm/pkg/apis/policy/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+var errNoManifests = errors.New("no manifest files found")
+
+// LoadPaths loads every YAML or JSON file in the paths. Directories are walked recursively.
+func (s *Simulator) LoadPaths(paths ...string) error {
+	numFiles := 0
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() || !isManifestFile(path) {
+				return nil
+			}
+			numFiles++
+			return s.loadFile(path)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to load manifests from %s: %w", root, err)
+		}
+	}
+	if numFiles == 0 {
+		return errNoManifests
+	}
+	return nil
+}
+
+func isManifestFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Simulator) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer f.Close()
+
+	if err := s.Load(f); err != nil {
+		return fmt.Errorf("failed to load %s: %w", path, err)
+	}
+	return nil
+}
+
+// Load adds the objects of a multi-document YAML or JSON stream.
+// Lists, such as the output of "kubectl get pods,namespaces,networkpolicies -A -o yaml", are flattened.
+// Documents which aren't Kubernetes objects and kinds which don't affect NetworkPolicies are ignored.
+func (s *Simulator) Load(r io.Reader) error {
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(r))
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read document: %w", err)
+		}
+
+		jsonDoc, err := utilyaml.ToJSON(doc)
+		if err != nil {
+			return fmt.Errorf("failed to convert document to JSON: %w", err)
+		}
+		var object map[string]interface{}
+		if err := json.Unmarshal(jsonDoc, &object); err != nil || object["kind"] == nil {
+			// not a Kubernetes object, e.g. a values file or a list of queries
+			continue
+		}
+		if err := s.addUnstructured(&unstructured.Unstructured{Object: object}); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Simulator) addUnstructured(obj *unstructured.Unstructured) error {
+	if obj.IsList() {
+		return obj.EachListItem(func(item runtime.Object) error {
+			return s.addUnstructured(item.(*unstructured.Unstructured)) //nolint:forcetypeassert // EachListItem only yields Unstructured items
+		})
+	}
+
+	switch obj.GetKind() {
+	case "Namespace":
+		ns := &corev1.Namespace{}
+		if err := fromUnstructured(obj, ns); err != nil {
+			return err
+		}
+		s.AddNamespace(ns)
+	case "Pod":
+		pod := &corev1.Pod{}
+		if err := fromUnstructured(obj, pod); err != nil {
+			return err
+		}
+		s.AddPod(pod)
+	case "Deployment":
+		deployment := &appsv1.Deployment{}
+		if err := fromUnstructured(obj, deployment); err != nil {
+			return err
+		}
+		s.addPodTemplate(&deployment.ObjectMeta, &deployment.Spec.Template)
+	case "StatefulSet":
+		statefulSet := &appsv1.StatefulSet{}
+		if err := fromUnstructured(obj, statefulSet); err != nil {
+			return err
+		}
+		s.addPodTemplate(&statefulSet.ObjectMeta, &statefulSet.Spec.Template)
+	case "DaemonSet":
+		daemonSet := &appsv1.DaemonSet{}
+		if err := fromUnstructured(obj, daemonSet); err != nil {
+			return err
+		}
+		s.addPodTemplate(&daemonSet.ObjectMeta, &daemonSet.Spec.Template)
+	case "ReplicaSet":
+		replicaSet := &appsv1.ReplicaSet{}
+		if err := fromUnstructured(obj, replicaSet); err != nil {
+			return err
+		}
+		s.addPodTemplate(&replicaSet.ObjectMeta, &replicaSet.Spec.Template)
+	case "Job":
+		job := &batchv1.Job{}
+		if err := fromUnstructured(obj, job); err != nil {
+			return err
+		}
+		s.addPodTemplate(&job.ObjectMeta, &job.Spec.Template)
+	case "NetworkPolicy":
+		netPol := &networkingv1.NetworkPolicy{}
+		if err := fromUnstructured(obj, netPol); err != nil {
+			return err
+		}
+		return s.AddNetworkPolicy(netPol)
+	case "AdminNetworkPolicy":
+		anp := &policyv1alpha1.AdminNetworkPolicy{}
+		if err := fromUnstructured(obj, anp); err != nil {
+			return err
+		}
+		return s.AddAdminNetworkPolicy(anp)
+	case "BaselineAdminNetworkPolicy":
+		banp := &policyv1alpha1.BaselineAdminNetworkPolicy{}
+		if err := fromUnstructured(obj, banp); err != nil {
+			return err
+		}
+		return s.AddBaselineAdminNetworkPolicy(banp)
+	}
+	return nil
+}
+
+func fromUnstructured(obj *unstructured.Unstructured, into interface{}) error {
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, into); err != nil {
+		return fmt.Errorf("failed to convert %s %s/%s: %w", obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+	}
+	return nil
+}
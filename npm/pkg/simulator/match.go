@@ -0,0 +1,126 @@
+package simulator
+
+import (
+	"net"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
+	"github.com/Azure/azure-container-networking/npm/util"
+)
+
+// selects returns true if the policy's pod selector matches the pod.
+func selects(iMgr *ipsets.IPSetManager, p *policies.NPMNetworkPolicy, e *endpoint) bool {
+	for i := range p.PodSelectorList {
+		setInfo := &p.PodSelectorList[i]
+		if isMember(iMgr, setInfo.IPSet, e) != setInfo.Included {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesACL returns true if the ACL's iptables rule would match the flow.
+func matchesACL(iMgr *ipsets.IPSetManager, acl *policies.ACLPolicy, f *flow) bool {
+	if acl.Protocol != policies.UnspecifiedProtocol && acl.Protocol != f.protocol {
+		return false
+	}
+	if acl.DstPorts.Port != 0 && (f.port < acl.DstPorts.Port || f.port > acl.DstPorts.EndPort) {
+		return false
+	}
+	for i := range acl.SrcList {
+		if !matchesSetInfo(iMgr, &acl.SrcList[i], f) {
+			return false
+		}
+	}
+	for i := range acl.DstList {
+		if !matchesSetInfo(iMgr, &acl.DstList[i], f) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesSetInfo(iMgr *ipsets.IPSetManager, setInfo *policies.SetInfo, f *flow) bool {
+	var member bool
+	switch setInfo.MatchType {
+	case policies.SrcMatch:
+		member = isMember(iMgr, setInfo.IPSet, f.src)
+	case policies.DstDstMatch:
+		member = hasNamedPort(iMgr, setInfo.IPSet, f.dst, f.port, f.protocol)
+	default:
+		member = isMember(iMgr, setInfo.IPSet, f.dst)
+	}
+	return member == setInfo.Included
+}
+
+// isMember returns true if the endpoint's IP is in the IPSet.
+func isMember(iMgr *ipsets.IPSetManager, setMetadata *ipsets.IPSetMetadata, e *endpoint) bool {
+	set := iMgr.GetIPSet(setMetadata.GetPrefixName())
+	if set == nil {
+		return false
+	}
+	if set.Type == ipsets.CIDRBlocks {
+		members, _ := set.GetSetContents()
+		return inCIDRBlocks(members, e.ip)
+	}
+	if e.member == "" {
+		return false
+	}
+
+	if set.Kind == ipsets.ListSet {
+		for _, memberSet := range set.MemberIPSets {
+			if _, ok := memberSet.IPPodKey[e.member]; ok {
+				return true
+			}
+		}
+		return false
+	}
+	if set.Type == ipsets.NamedPorts {
+		// a named port set holds "ip,protocol:port" members
+		for member := range set.IPPodKey {
+			if strings.HasPrefix(member, e.member+",") {
+				return true
+			}
+		}
+		return false
+	}
+	_, ok := set.IPPodKey[e.member]
+	return ok
+}
+
+// hasNamedPort returns true if the named port set has the destination IP and port.
+// A named port set holds "ip,protocol:port" members, where the protocol is omitted for TCP ports without one.
+func hasNamedPort(iMgr *ipsets.IPSetManager, setMetadata *ipsets.IPSetMetadata, e *endpoint, port int32, protocol policies.Protocol) bool {
+	set := iMgr.GetIPSet(setMetadata.GetPrefixName())
+	if set == nil || e.member == "" {
+		return false
+	}
+	if _, ok := set.IPPodKey[namedPortMember(e.member, string(protocol), port)]; ok {
+		return true
+	}
+	_, ok := set.IPPodKey[namedPortMember(e.member, "", port)]
+	return ok && protocol == policies.TCP
+}
+
+// inCIDRBlocks emulates a hash:net IPSet, where the most specific entry containing the IP decides the match.
+// Entries are either "cidr" or "cidr nomatch".
+func inCIDRBlocks(members []string, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	matched := false
+	longestPrefix := -1
+	for _, member := range members {
+		cidr, option, _ := strings.Cut(member, " ")
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil || !ipNet.Contains(ip) {
+			continue
+		}
+		if prefix, _ := ipNet.Mask.Size(); prefix > longestPrefix {
+			longestPrefix = prefix
+			matched = option != util.IpsetNomatch
+		}
+	}
+	return matched
+}
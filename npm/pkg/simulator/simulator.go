@@ -0,0 +1,477 @@
+// Package simulator evaluates NetworkPolicies offline with NPM's translation pipeline.
+// Objects are translated with the same code as the controllers and added to the sets of an in-memory IPSetManager,
+// and the resulting ACLs are evaluated against its sets in the order NPM's Linux dataplane evaluates them.
+package simulator
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/npm/metrics"
+	policyv1alpha1 "github.com/Azure/azure-container-networking/npm/pkg/apis/policy/v1alpha1"
+	"github.com/Azure/azure-container-networking/npm/pkg/controlplane/controllers/common"
+	"github.com/Azure/azure-container-networking/npm/pkg/controlplane/translation"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// namespaceNameLabel is set on every namespace by the API server.
+const namespaceNameLabel = "kubernetes.io/metadata.name"
+
+var (
+	ErrEndpointNotFound = errors.New("endpoint is neither a known pod nor an IP address")
+	ErrInvalidProtocol  = errors.New("protocol must be TCP, UDP or SCTP")
+	ErrInvalidPort      = errors.New("port must be between 0 and 65535")
+	errInvalidExpect    = errors.New("expect must be allowed or denied")
+)
+
+// Simulator holds the objects which decide whether a flow is allowed.
+type Simulator struct {
+	namespaces map[string]*common.Namespace
+	// pods are keyed by "namespace/name"
+	pods     map[string]*common.NpmPod
+	policies []*policies.NPMNetworkPolicy
+	// ipsetMgr holds the sets of every object. It is nil until a flow is simulated and whenever an object changes.
+	ipsetMgr *ipsets.IPSetManager
+	// placeholderIPs are the set members of pods without an IP, keyed by "namespace/name"
+	placeholderIPs map[string]string
+}
+
+func NewSimulator() *Simulator {
+	// the IPSetManager counts sets in the metrics
+	metrics.InitializeAll()
+	return &Simulator{
+		namespaces:     make(map[string]*common.Namespace),
+		pods:           make(map[string]*common.NpmPod),
+		placeholderIPs: make(map[string]string),
+	}
+}
+
+// AddNamespace adds or replaces a namespace.
+func (s *Simulator) AddNamespace(ns *corev1.Namespace) {
+	nsObj := common.NewNs(ns.Name)
+	nsObj.AppendLabels(ns.Labels, common.ClearExistingLabels)
+	nsObj.AppendLabels(map[string]string{namespaceNameLabel: ns.Name}, common.AppendToExistingLabels)
+	s.namespaces[ns.Name] = nsObj
+	s.ipsetMgr = nil
+}
+
+// AddPod adds or replaces a pod. Like the pod controller, host network and completed pods are skipped
+// since NPM doesn't add them to any IPSet.
+func (s *Simulator) AddPod(pod *corev1.Pod) {
+	if pod.Spec.HostNetwork || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return
+	}
+	npmPod := common.NewNpmPod(pod)
+	npmPod.Namespace = namespaceOrDefault(pod.Namespace)
+	npmPod.AppendLabels(pod.Labels, common.ClearExistingLabels)
+	npmPod.AppendContainerPorts(pod)
+	s.addNpmPod(npmPod)
+}
+
+// addPodTemplate adds a pod for a workload's template, named after the workload.
+// Manifests of workloads have no pod IPs, so the pod only matches label and namespace selectors.
+func (s *Simulator) addPodTemplate(meta *metav1.ObjectMeta, template *corev1.PodTemplateSpec) {
+	if template.Spec.HostNetwork {
+		return
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      meta.Name,
+			Namespace: meta.Namespace,
+			Labels:    template.Labels,
+		},
+		Spec: template.Spec,
+	}
+	s.AddPod(pod)
+}
+
+func (s *Simulator) addNpmPod(npmPod *common.NpmPod) {
+	if _, ok := s.namespaces[npmPod.Namespace]; !ok {
+		// the namespace may be created outside of the manifests
+		s.AddNamespace(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: npmPod.Namespace}})
+	}
+	s.pods[npmPod.Namespace+"/"+npmPod.Name] = npmPod
+	s.ipsetMgr = nil
+}
+
+// AddNetworkPolicy translates a NetworkPolicy like the NetworkPolicy controller.
+func (s *Simulator) AddNetworkPolicy(netPol *networkingv1.NetworkPolicy) error {
+	netPol = netPol.DeepCopy()
+	netPol.Namespace = namespaceOrDefault(netPol.Namespace)
+	defaultPolicyTypes(netPol)
+	npmNetPol, err := translation.TranslatePolicy(netPol, false)
+	if err != nil {
+		return fmt.Errorf("failed to translate NetworkPolicy %s/%s: %w", netPol.Namespace, netPol.Name, err)
+	}
+	s.addPolicy(npmNetPol)
+	return nil
+}
+
+// AddAdminNetworkPolicy translates an AdminNetworkPolicy like the AdminNetworkPolicy controller.
+func (s *Simulator) AddAdminNetworkPolicy(anp *policyv1alpha1.AdminNetworkPolicy) error {
+	npmNetPol, err := translation.TranslateAdminNetworkPolicy(anp)
+	if err != nil {
+		return fmt.Errorf("failed to translate AdminNetworkPolicy %s: %w", anp.Name, err)
+	}
+	s.addPolicy(npmNetPol)
+	return nil
+}
+
+// AddBaselineAdminNetworkPolicy translates a BaselineAdminNetworkPolicy like the AdminNetworkPolicy controller.
+func (s *Simulator) AddBaselineAdminNetworkPolicy(banp *policyv1alpha1.BaselineAdminNetworkPolicy) error {
+	npmNetPol, err := translation.TranslateBaselineAdminNetworkPolicy(banp)
+	if err != nil {
+		return fmt.Errorf("failed to translate BaselineAdminNetworkPolicy %s: %w", banp.Name, err)
+	}
+	s.addPolicy(npmNetPol)
+	return nil
+}
+
+func (s *Simulator) addPolicy(npmNetPol *policies.NPMNetworkPolicy) {
+	policies.NormalizePolicy(npmNetPol)
+	s.ipsetMgr = nil
+	for i, existing := range s.policies {
+		if existing.PolicyKey == npmNetPol.PolicyKey {
+			s.policies[i] = npmNetPol
+			return
+		}
+	}
+	s.policies = append(s.policies, npmNetPol)
+}
+
+// defaultPolicyTypes sets policyTypes like the API server does when a manifest omits them.
+func defaultPolicyTypes(netPol *networkingv1.NetworkPolicy) {
+	if len(netPol.Spec.PolicyTypes) > 0 {
+		return
+	}
+	netPol.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}
+	if len(netPol.Spec.Egress) > 0 {
+		netPol.Spec.PolicyTypes = append(netPol.Spec.PolicyTypes, networkingv1.PolicyTypeEgress)
+	}
+}
+
+func namespaceOrDefault(ns string) string {
+	if ns == "" {
+		return metav1.NamespaceDefault
+	}
+	return ns
+}
+
+// Query is a flow to evaluate.
+type Query struct {
+	// Src and Dst are either "namespace/name" of a pod or workload, or an IP address.
+	// An IP address which doesn't belong to a pod is outside of the cluster.
+	Src string `json:"src"`
+	Dst string `json:"dst"`
+	// Port is the destination port. Zero only matches rules without ports.
+	Port int32 `json:"port,omitempty"`
+	// Protocol defaults to TCP.
+	Protocol string `json:"protocol,omitempty"`
+	// Expect is optionally "allowed" or "denied". Results report whether the verdict matches it.
+	Expect string `json:"expect,omitempty"`
+}
+
+// Result is the verdict of a flow and the policies which decided it.
+type Result struct {
+	Query   Query           `json:"query"`
+	Src     Endpoint        `json:"src"`
+	Dst     Endpoint        `json:"dst"`
+	Allowed bool            `json:"allowed"`
+	Egress  DirectionResult `json:"egress"`
+	Ingress DirectionResult `json:"ingress"`
+	// Unexpected is true if the verdict doesn't match the query's expectation.
+	Unexpected bool `json:"unexpected,omitempty"`
+}
+
+// Endpoint is a resolved source or destination.
+type Endpoint struct {
+	Pod string `json:"pod,omitempty"`
+	// IP is empty for pods of workload manifests
+	IP string `json:"ip,omitempty"`
+	// External is true for IP addresses outside of the cluster, which no policy applies to
+	External bool `json:"external,omitempty"`
+}
+
+// DirectionResult is the verdict of the policies applied to the source's egress or the destination's ingress.
+type DirectionResult struct {
+	Allowed bool `json:"allowed"`
+	// Isolated is true if a NetworkPolicy selects the pod in this direction
+	Isolated bool `json:"isolated"`
+	// Policies are the policies which select the pod in this direction, in the order they were evaluated
+	Policies []PolicyVerdict `json:"policies,omitempty"`
+}
+
+// PolicyVerdict is the first ACL of a policy which matched the flow.
+type PolicyVerdict struct {
+	Policy string           `json:"policy"`
+	Tier   string           `json:"tier"`
+	Target policies.Verdict `json:"verdict,omitempty"`
+	// ACLIndex is the index of the matched ACL, which is also logged by NPM's verdict logging, or -1 if no ACL matched
+	ACLIndex int `json:"aclIndex"`
+}
+
+// flow is a resolved query.
+type flow struct {
+	src      *endpoint
+	dst      *endpoint
+	port     int32
+	protocol policies.Protocol
+}
+
+type endpoint struct {
+	pod *common.NpmPod
+	ip  net.IP
+	// member is the IP which the pod was added to sets with, or empty outside of the cluster
+	member string
+}
+
+// Simulate evaluates a flow with the same precedence as NPM's Linux dataplane:
+// AdminNetworkPolicies by priority, then NetworkPolicies, then BaselineAdminNetworkPolicies.
+// A flow is allowed if both the source's egress and the destination's ingress allow it.
+func (s *Simulator) Simulate(query *Query) (*Result, error) {
+	f, err := s.resolve(query)
+	if err != nil {
+		return nil, err
+	}
+	iMgr, err := s.ipsetManager()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		Query: *query,
+		Src:   f.src.toEndpoint(),
+		Dst:   f.dst.toEndpoint(),
+	}
+	result.Egress = s.evaluate(iMgr, f, policies.Egress)
+	result.Ingress = s.evaluate(iMgr, f, policies.Ingress)
+	result.Allowed = result.Egress.Allowed && result.Ingress.Allowed
+
+	switch query.Expect {
+	case "":
+	case "allowed":
+		result.Unexpected = !result.Allowed
+	case "denied":
+		result.Unexpected = result.Allowed
+	default:
+		return nil, fmt.Errorf("%w: %s", errInvalidExpect, query.Expect)
+	}
+	return result, nil
+}
+
+func (s *Simulator) resolve(query *Query) (*flow, error) {
+	protocol := policies.TCP
+	if query.Protocol != "" {
+		protocol = policies.Protocol(strings.ToUpper(query.Protocol))
+	}
+	if protocol != policies.TCP && protocol != policies.UDP && protocol != policies.SCTP {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidProtocol, query.Protocol)
+	}
+	if query.Port < 0 || query.Port > 65535 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidPort, query.Port)
+	}
+
+	src, err := s.resolveEndpoint(query.Src)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := s.resolveEndpoint(query.Dst)
+	if err != nil {
+		return nil, err
+	}
+
+	// pods given by name use an IP of the same family as the other endpoint
+	ipv6 := (src.ip != nil && src.ip.To4() == nil) || (dst.ip != nil && dst.ip.To4() == nil)
+	s.pickIP(src, ipv6)
+	s.pickIP(dst, ipv6)
+	return &flow{src: src, dst: dst, port: query.Port, protocol: protocol}, nil
+}
+
+func (s *Simulator) resolveEndpoint(name string) (*endpoint, error) {
+	if ip := net.ParseIP(name); ip != nil {
+		for _, pod := range s.sortedPods() {
+			if ip.Equal(net.ParseIP(pod.PodIP)) {
+				return &endpoint{pod: pod, ip: ip, member: pod.PodIP}, nil
+			}
+			if ip.Equal(net.ParseIP(pod.PodIPv6)) {
+				return &endpoint{pod: pod, ip: ip, member: pod.PodIPv6}, nil
+			}
+		}
+		return &endpoint{ip: ip}, nil
+	}
+
+	if !strings.Contains(name, "/") {
+		name = metav1.NamespaceDefault + "/" + name
+	}
+	pod, ok := s.pods[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrEndpointNotFound, name)
+	}
+	return &endpoint{pod: pod}, nil
+}
+
+func (s *Simulator) sortedPods() []*common.NpmPod {
+	keys := make([]string, 0, len(s.pods))
+	for key := range s.pods {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pods := make([]*common.NpmPod, 0, len(keys))
+	for _, key := range keys {
+		pods = append(pods, s.pods[key])
+	}
+	return pods
+}
+
+func (s *Simulator) sortedNamespaces() []*common.Namespace {
+	names := make([]string, 0, len(s.namespaces))
+	for name := range s.namespaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	namespaces := make([]*common.Namespace, 0, len(names))
+	for _, name := range names {
+		namespaces = append(namespaces, s.namespaces[name])
+	}
+	return namespaces
+}
+
+func (s *Simulator) pickIP(e *endpoint, ipv6 bool) {
+	if e.ip != nil || e.pod == nil {
+		return
+	}
+	if ipv6 && e.pod.PodIPv6 != "" {
+		e.ip = net.ParseIP(e.pod.PodIPv6)
+		e.member = e.pod.PodIPv6
+		return
+	}
+	e.ip = net.ParseIP(e.pod.PodIP)
+	e.member = s.memberIP(e.pod)
+}
+
+func (e *endpoint) toEndpoint() Endpoint {
+	var result Endpoint
+	if e.pod != nil {
+		result.Pod = e.pod.Namespace + "/" + e.pod.Name
+	} else {
+		result.External = true
+	}
+	if e.ip != nil {
+		result.IP = e.ip.String()
+	}
+	return result
+}
+
+// evaluate returns the verdict for the pod which the direction applies to.
+func (s *Simulator) evaluate(iMgr *ipsets.IPSetManager, f *flow, direction policies.Direction) DirectionResult {
+	subject := f.dst
+	if direction == policies.Egress {
+		subject = f.src
+	}
+	if subject.pod == nil {
+		// NPM only filters traffic of pods
+		return DirectionResult{Allowed: true}
+	}
+
+	var admin, netPols, baseline []*policies.NPMNetworkPolicy
+	for _, p := range s.policies {
+		if !hasDirection(p, direction) || !selects(iMgr, p, subject) {
+			continue
+		}
+		switch p.Tier {
+		case policies.AdminTier:
+			admin = append(admin, p)
+		case policies.BaselineTier:
+			baseline = append(baseline, p)
+		default:
+			netPols = append(netPols, p)
+		}
+	}
+	sort.Slice(admin, func(i, j int) bool {
+		if admin[i].Priority != admin[j].Priority {
+			return admin[i].Priority < admin[j].Priority
+		}
+		return admin[i].PolicyKey < admin[j].PolicyKey
+	})
+	sort.Slice(netPols, func(i, j int) bool { return netPols[i].PolicyKey < netPols[j].PolicyKey })
+	sort.Slice(baseline, func(i, j int) bool { return baseline[i].PolicyKey < baseline[j].PolicyKey })
+
+	var result DirectionResult
+	// an Allow or Deny of an AdminNetworkPolicy is final, while a Pass skips the remaining AdminNetworkPolicies
+	for _, p := range admin {
+		verdict := policyVerdict(iMgr, p, f, direction)
+		result.Policies = append(result.Policies, verdict)
+		if verdict.Target == policies.Passed {
+			break
+		}
+		if verdict.Target != "" {
+			result.Allowed = verdict.Target == policies.Allowed
+			return result
+		}
+	}
+
+	// NetworkPolicies are additive, so any allow wins
+	if len(netPols) > 0 {
+		result.Isolated = true
+		for _, p := range netPols {
+			verdict := policyVerdict(iMgr, p, f, direction)
+			result.Policies = append(result.Policies, verdict)
+			if verdict.Target == policies.Allowed {
+				result.Allowed = true
+			}
+		}
+		return result
+	}
+
+	for _, p := range baseline {
+		verdict := policyVerdict(iMgr, p, f, direction)
+		result.Policies = append(result.Policies, verdict)
+		if verdict.Target != "" {
+			result.Allowed = verdict.Target == policies.Allowed
+			return result
+		}
+	}
+
+	result.Allowed = true
+	return result
+}
+
+func policyVerdict(iMgr *ipsets.IPSetManager, p *policies.NPMNetworkPolicy, f *flow, direction policies.Direction) PolicyVerdict {
+	tier := string(p.Tier)
+	if p.Tier == policies.NetworkPolicyTier {
+		tier = "NetworkPolicy"
+	}
+	verdict := PolicyVerdict{
+		Policy:   p.PolicyKey,
+		Tier:     tier,
+		ACLIndex: -1,
+	}
+	for i, acl := range p.ACLs {
+		if aclHasDirection(acl, direction) && matchesACL(iMgr, acl, f) {
+			verdict.Target = acl.Target
+			verdict.ACLIndex = i
+			break
+		}
+	}
+	return verdict
+}
+
+func hasDirection(p *policies.NPMNetworkPolicy, direction policies.Direction) bool {
+	for _, acl := range p.ACLs {
+		if aclHasDirection(acl, direction) {
+			return true
+		}
+	}
+	return false
+}
+
+func aclHasDirection(acl *policies.ACLPolicy, direction policies.Direction) bool {
+	return acl.Direction == direction || acl.Direction == policies.Both
+}
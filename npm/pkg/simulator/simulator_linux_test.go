@@ -0,0 +1,193 @@
+package simulator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
+	dptestutils "github.com/Azure/azure-container-networking/npm/pkg/dataplane/testutils"
+	"github.com/Azure/azure-container-networking/npm/util"
+	"github.com/stretchr/testify/require"
+)
+
+// comparisonManifests are pods with IPs, so that every flow can also be sent through the fake kernel.
+const comparisonManifests = `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: alpha
+  labels:
+    ns: alpha
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: beta
+  labels:
+    ns: beta
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: a
+  namespace: alpha
+  labels:
+    app: a
+spec:
+  containers:
+  - name: a
+    image: a
+    ports:
+    - name: http
+      containerPort: 8080
+status:
+  podIP: 10.0.0.1
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: b
+  namespace: alpha
+  labels:
+    app: b
+    tier: web
+status:
+  podIP: 10.0.0.2
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: c
+  namespace: beta
+  labels:
+    app: c
+status:
+  podIP: 10.0.0.3
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: a-ingress
+  namespace: alpha
+spec:
+  podSelector:
+    matchLabels:
+      app: a
+  ingress:
+  - from:
+    - podSelector:
+        matchExpressions:
+        - key: app
+          operator: In
+          values: [b, c]
+    ports:
+    - port: http
+  - from:
+    - namespaceSelector:
+        matchLabels:
+          ns: beta
+    ports:
+    - protocol: UDP
+      port: 53
+  - from:
+    - ipBlock:
+        cidr: 20.0.0.0/24
+        except:
+        - 20.0.0.128/25
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: b-egress
+  namespace: alpha
+spec:
+  podSelector:
+    matchLabels:
+      tier: web
+  policyTypes:
+  - Egress
+  egress:
+  - to:
+    - podSelector: {}
+      namespaceSelector: {}
+    ports:
+    - port: 8000
+      endPort: 9000
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: c-default-deny
+  namespace: beta
+spec:
+  podSelector: {}
+  policyTypes:
+  - Ingress
+  - Egress
+  egress:
+  - to:
+    - ipBlock:
+        cidr: 0.0.0.0/0
+`
+
+// TestSimulatorMatchesDataplane programs the objects into a Linux DataPlane on a fake kernel
+// and checks that the simulator and the kernel agree on every flow.
+func TestSimulatorMatchesDataplane(t *testing.T) {
+	manifests := filepath.Join(t.TempDir(), "manifests.yaml")
+	require.NoError(t, os.WriteFile(manifests, []byte(comparisonManifests), 0o600))
+	s := NewSimulator()
+	require.NoError(t, s.LoadPaths(manifests))
+
+	kernel := dptestutils.NewFakeKernel()
+	stopCh := make(chan struct{}, 1)
+	defer func() { stopCh <- struct{}{} }()
+	cfg := &dataplane.Config{
+		IPSetManagerCfg: &ipsets.IPSetManagerCfg{
+			IPSetMode:   ipsets.ApplyAllIPSets,
+			NetworkName: "azure",
+		},
+		PolicyManagerCfg: &policies.PolicyManagerCfg{
+			NodeIP:               "6.7.8.9",
+			PolicyMode:           policies.IPSetPolicyMode,
+			PlaceAzureChainFirst: util.PlaceAzureChainFirst,
+		},
+	}
+	dp, err := dataplane.NewDataPlane("this-node", kernel.IOShim(), cfg, stopCh)
+	require.NoError(t, err)
+
+	// the DataPlane gets its own translation of the policies since it modifies them
+	dpPolicies := NewSimulator()
+	require.NoError(t, dpPolicies.LoadPaths(manifests))
+	require.NoError(t, s.programMembers(dp))
+	for _, p := range dpPolicies.policies {
+		require.NoError(t, dp.AddPolicy(p))
+	}
+	require.NoError(t, dp.ApplyDataPlane())
+
+	ips := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "20.0.0.1", "20.0.0.200"}
+	verdicts := make(map[bool]int)
+	for _, src := range ips {
+		for _, dst := range ips {
+			if src == dst {
+				continue
+			}
+			for _, protocol := range []string{"TCP", "UDP"} {
+				for _, port := range []int32{53, 80, 8080, 8500} {
+					name := fmt.Sprintf("%s %s -> %s:%d", protocol, src, dst, port)
+					result, err := s.Simulate(&Query{Src: src, Dst: dst, Port: port, Protocol: protocol})
+					require.NoError(t, err, name)
+					allowed, err := kernel.Allowed(src, dst, protocol, int(port))
+					require.NoError(t, err, name)
+					require.Equal(t, allowed, result.Allowed, "simulator and dataplane disagree on %s: %+v", name, result)
+					verdicts[allowed]++
+				}
+			}
+		}
+	}
+	require.NotZero(t, verdicts[true], "expected some allowed flows")
+	require.NotZero(t, verdicts[false], "expected some dropped flows")
+}
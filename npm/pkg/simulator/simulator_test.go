@@ -0,0 +1,309 @@
+package simulator
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
+	"github.com/Azure/azure-container-networking/npm/util"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	manifestsFile = "testdata/manifests.yaml"
+	queriesFile   = "testdata/queries.yaml"
+)
+
+func TestSimulateQueriesFile(t *testing.T) {
+	s := NewSimulator()
+	require.NoError(t, s.LoadPaths(manifestsFile))
+
+	b, err := os.ReadFile(queriesFile)
+	require.NoError(t, err)
+	var queries []Query
+	require.NoError(t, yaml.Unmarshal(b, &queries))
+	require.NotEmpty(t, queries)
+
+	for i := range queries {
+		result, err := s.Simulate(&queries[i])
+		require.NoError(t, err)
+		require.False(t, result.Unexpected, "query %+v", queries[i])
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	s := NewSimulator()
+	require.NoError(t, s.LoadPaths(manifestsFile))
+
+	// allowed by the named port rule
+	result, err := s.Simulate(&Query{Src: "shop/frontend", Dst: "shop/backend", Port: 8080})
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+	require.Equal(t, Endpoint{Pod: "shop/frontend"}, result.Src)
+	require.Equal(t, Endpoint{Pod: "shop/backend", IP: "10.0.0.10"}, result.Dst)
+	require.Equal(t, DirectionResult{
+		Allowed:  true,
+		Isolated: true,
+		Policies: []PolicyVerdict{{Policy: "shop/frontend-egress", Tier: "NetworkPolicy", Target: policies.Allowed, ACLIndex: 0}},
+	}, result.Egress)
+	require.Equal(t, DirectionResult{
+		Allowed:  true,
+		Isolated: true,
+		Policies: []PolicyVerdict{{Policy: "shop/backend-ingress", Tier: "NetworkPolicy", Target: policies.Allowed, ACLIndex: 0}},
+	}, result.Ingress)
+
+	// the egress policy allows it, but the port doesn't match any ingress rule
+	result, err = s.Simulate(&Query{Src: "shop/frontend", Dst: "shop/backend", Port: 80, Expect: "allowed"})
+	require.NoError(t, err)
+	require.False(t, result.Allowed)
+	require.True(t, result.Unexpected)
+	require.True(t, result.Egress.Allowed)
+	require.False(t, result.Ingress.Allowed)
+	require.Equal(t, policies.Dropped, result.Ingress.Policies[0].Target)
+
+	// prometheus isn't isolated, and the IP resolves to the backend pod
+	result, err = s.Simulate(&Query{Src: "monitoring/prometheus", Dst: "10.0.0.10", Port: 9090, Protocol: "tcp"})
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+	require.Equal(t, Endpoint{Pod: "monitoring/prometheus", IP: "10.0.0.20"}, result.Src)
+	require.Equal(t, DirectionResult{Allowed: true}, result.Egress)
+	require.Equal(t, 1, result.Ingress.Policies[0].ACLIndex)
+
+	// external destinations are only filtered by the source's egress policies
+	result, err = s.Simulate(&Query{Src: "monitoring/prometheus", Dst: "8.8.8.8", Port: 53, Protocol: "UDP"})
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+	require.Equal(t, Endpoint{IP: "8.8.8.8", External: true}, result.Dst)
+
+	result, err = s.Simulate(&Query{Src: "shop/frontend", Dst: "8.8.8.8", Port: 53, Protocol: "UDP", Expect: "denied"})
+	require.NoError(t, err)
+	require.False(t, result.Allowed)
+	require.False(t, result.Unexpected)
+}
+
+func TestSimulateErrors(t *testing.T) {
+	s := NewSimulator()
+	require.NoError(t, s.LoadPaths(manifestsFile))
+
+	_, err := s.Simulate(&Query{Src: "shop/missing", Dst: "shop/backend"})
+	require.ErrorIs(t, err, ErrEndpointNotFound)
+	_, err = s.Simulate(&Query{Src: "shop/frontend", Dst: "shop/backend", Protocol: "ICMP"})
+	require.ErrorIs(t, err, ErrInvalidProtocol)
+	_, err = s.Simulate(&Query{Src: "shop/frontend", Dst: "shop/backend", Port: 70000})
+	require.ErrorIs(t, err, ErrInvalidPort)
+	_, err = s.Simulate(&Query{Src: "shop/frontend", Dst: "shop/backend", Expect: "maybe"})
+	require.ErrorIs(t, err, errInvalidExpect)
+
+	require.ErrorIs(t, NewSimulator().LoadPaths(t.TempDir()), errNoManifests)
+}
+
+func TestLoad(t *testing.T) {
+	snapshot := `
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Pod
+  metadata:
+    name: a
+    labels:
+      app: a
+  status:
+    podIP: 10.0.0.1
+- apiVersion: v1
+  kind: Pod
+  metadata:
+    name: host
+  spec:
+    hostNetwork: true
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: a
+---
+# values of a chart
+replicas: 3
+---
+`
+	s := NewSimulator()
+	require.NoError(t, s.Load(strings.NewReader(snapshot)))
+	require.Len(t, s.pods, 1)
+	require.Equal(t, "10.0.0.1", s.pods["default/a"].PodIP)
+	require.Equal(t, map[string]string{namespaceNameLabel: "default"}, s.namespaces["default"].LabelsMap)
+
+	require.Error(t, s.Load(strings.NewReader("kind: Pod\nspec: 1\n")))
+}
+
+func TestSimulateNestedAndNegativeSelectors(t *testing.T) {
+	manifests := `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: db
+  labels:
+    app: db
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: api
+  labels:
+    app: api
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: batch
+  labels:
+    app: batch
+    untrusted: "true"
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: db
+spec:
+  podSelector:
+    matchLabels:
+      app: db
+  ingress:
+  - from:
+    - podSelector:
+        matchExpressions:
+        - key: app
+          operator: In
+          values: [api, batch]
+        - key: untrusted
+          operator: DoesNotExist
+`
+	if util.IsWindowsDP() {
+		t.Skip("negative selectors aren't supported on Windows")
+	}
+	s := NewSimulator()
+	require.NoError(t, s.Load(strings.NewReader(manifests)))
+
+	result, err := s.Simulate(&Query{Src: "api", Dst: "db", Port: 5432})
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+
+	result, err = s.Simulate(&Query{Src: "batch", Dst: "db", Port: 5432})
+	require.NoError(t, err)
+	require.False(t, result.Allowed)
+}
+
+func TestSimulateAdminNetworkPolicies(t *testing.T) {
+	manifests := `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: tenant
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: web
+  namespace: tenant
+  labels:
+    app: web
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: client
+  namespace: tenant
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: allow-all
+  namespace: tenant
+spec:
+  podSelector: {}
+  ingress:
+  - {}
+---
+apiVersion: policy.networking.k8s.io/v1alpha1
+kind: AdminNetworkPolicy
+metadata:
+  name: pass-dns
+spec:
+  priority: 5
+  subject:
+    namespaces: {}
+  ingress:
+  - action: Pass
+    from:
+    - namespaces: {}
+    ports:
+    - portNumber:
+        protocol: UDP
+        port: 53
+---
+apiVersion: policy.networking.k8s.io/v1alpha1
+kind: AdminNetworkPolicy
+metadata:
+  name: deny-tenant
+spec:
+  priority: 10
+  subject:
+    namespaces:
+      matchLabels:
+        kubernetes.io/metadata.name: tenant
+  ingress:
+  - action: Deny
+    from:
+    - namespaces: {}
+---
+apiVersion: policy.networking.k8s.io/v1alpha1
+kind: BaselineAdminNetworkPolicy
+metadata:
+  name: default
+spec:
+  subject:
+    namespaces: {}
+  ingress:
+  - action: Deny
+    from:
+    - namespaces: {}
+`
+	if util.IsWindowsDP() {
+		t.Skip("AdminNetworkPolicies aren't supported on Windows")
+	}
+	s := NewSimulator()
+	require.NoError(t, s.Load(strings.NewReader(manifests)))
+
+	// denied by the AdminNetworkPolicy even though a NetworkPolicy allows it
+	result, err := s.Simulate(&Query{Src: "tenant/client", Dst: "tenant/web", Port: 80})
+	require.NoError(t, err)
+	require.False(t, result.Allowed)
+	require.Equal(t, []PolicyVerdict{
+		{Policy: "AdminNetworkPolicy/pass-dns", Tier: string(policies.AdminTier), ACLIndex: -1},
+		{Policy: "AdminNetworkPolicy/deny-tenant", Tier: string(policies.AdminTier), Target: policies.Dropped, ACLIndex: 0},
+	}, result.Ingress.Policies)
+
+	// passed to the NetworkPolicy, so the BaselineAdminNetworkPolicy isn't evaluated
+	result, err = s.Simulate(&Query{Src: "tenant/client", Dst: "tenant/web", Port: 53, Protocol: "UDP"})
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+	require.True(t, result.Ingress.Isolated)
+	require.Len(t, result.Ingress.Policies, 2)
+	require.Equal(t, policies.Passed, result.Ingress.Policies[0].Target)
+	require.Equal(t, policies.Allowed, result.Ingress.Policies[1].Target)
+
+	// without the NetworkPolicy, the BaselineAdminNetworkPolicy denies passed flows
+	s.policies = s.policies[1:]
+	result, err = s.Simulate(&Query{Src: "tenant/client", Dst: "tenant/web", Port: 53, Protocol: "UDP"})
+	require.NoError(t, err)
+	require.False(t, result.Allowed)
+	require.Equal(t, "BaselineAdminNetworkPolicy/default", result.Ingress.Policies[1].Policy)
+}
+
+func TestInCIDRBlocks(t *testing.T) {
+	members := []string{"0.0.0.0/1", "128.0.0.0/1", "10.0.0.0/8 nomatch", "10.1.0.0/16"}
+	require.True(t, inCIDRBlocks(members, []byte{1, 2, 3, 4}))
+	require.False(t, inCIDRBlocks(members, []byte{10, 2, 3, 4}))
+	require.True(t, inCIDRBlocks(members, []byte{10, 1, 3, 4}))
+	require.False(t, inCIDRBlocks(members, nil))
+}
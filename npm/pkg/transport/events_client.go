@@ -27,7 +27,9 @@ var (
 	ErrAddressNil     = fmt.Errorf("address must be set")
 )
 
-func NewEventsClient(ctx context.Context, pod, node, addr string) (*EventsClient, error) {
+// NewEventsClient creates a client which verifies the controller with the CA in tlsFiles,
+// and presents the certificate in tlsFiles if it is set. The files are reloaded on change until the context is done.
+func NewEventsClient(ctx context.Context, pod, node, addr string, tlsFiles TLSFiles) (*EventsClient, error) {
 	if pod == "" || node == "" {
 		return nil, ErrPodNodeNameNil
 	}
@@ -38,16 +40,19 @@ func NewEventsClient(ctx context.Context, pod, node, addr string) (*EventsClient
 
 	klog.Infof("Connecting to NPM controller gRPC server at address %s\n", addr)
 
-	config, err := clientTLSConfig()
+	certs, err := newCertReloader(tlsFiles)
 	if err != nil {
 		klog.Errorf("failed to load client tls config : %s", err)
 		return nil, fmt.Errorf("failed to load client tls config : %w", err)
 	}
+	if err := certs.watch(ctx); err != nil {
+		return nil, fmt.Errorf("failed to watch client tls files : %w", err)
+	}
 
 	cc, err := grpc.DialContext(
 		ctx,
 		addr,
-		grpc.WithTransportCredentials(credentials.NewTLS(config)),
+		grpc.WithTransportCredentials(credentials.NewTLS(certs.clientTLSConfig())),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial %s: %w", addr, err)
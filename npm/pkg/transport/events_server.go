@@ -8,6 +8,7 @@ import (
 	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/dpshim"
 	"github.com/Azure/azure-container-networking/npm/pkg/protos"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/stats"
 	"k8s.io/klog/v2"
@@ -30,15 +31,30 @@ type EventsServer struct {
 	// port is the port the manager is listening on
 	port int
 
+	// tlsFiles are the server certificate and the CA of client certificates
+	tlsFiles TLSFiles
+
+	// authorizer is nil unless clients must present certificates bound to their node
+	authorizer *NodeAuthorizer
+
 	// inCh is the input channel for the manager
 	inCh chan *protos.Events
 
+	// nodeInCh is the input channel for events filtered for one node
+	nodeInCh chan *dpshim.NodeEvents
+
 	// regCh is the registration channel
 	regCh chan clientStreamConnection
 
 	// deregCh is the deregistration channel
 	deregCh chan deregistrationEvent
 
+	// statusCh is the channel for policy status reports from clients
+	statusCh chan *protos.PolicyStatusReport
+
+	// nodeGoneCh is the channel for the names of nodes whose clients all deregistered
+	nodeGoneCh chan string
+
 	// errCh is the error channel
 	errCh chan error
 
@@ -46,24 +62,33 @@ type EventsServer struct {
 	dp *dpshim.DPShim
 }
 
-// NewEventsServer creates an instance of the EventsServer
-func NewEventsServer(ctx context.Context, port int, dp *dpshim.DPShim) *EventsServer {
+// NewEventsServer creates an instance of the EventsServer.
+// If the authorizer is not nil, clients must present certificates signed by the CA in tlsFiles and bound to their node.
+func NewEventsServer(ctx context.Context, port int, tlsFiles TLSFiles, authorizer *NodeAuthorizer, dp *dpshim.DPShim) *EventsServer {
 	// Create a registration channel
 	regCh := make(chan clientStreamConnection, grpcMaxConcurrentStreams)
 
 	// Create a deregistration channel
 	deregCh := make(chan deregistrationEvent, grpcMaxConcurrentStreams)
 
+	// Create a policy status channel
+	statusCh := make(chan *protos.PolicyStatusReport, grpcMaxConcurrentStreams)
+
 	return &EventsServer{
 		ctx:           ctx,
-		Server:        NewServer(ctx, regCh),
+		Server:        NewServer(ctx, regCh, statusCh, authorizer),
 		Watchdog:      NewWatchdog(deregCh),
 		Registrations: make(map[string]clientStreamConnection),
 		port:          port,
+		tlsFiles:      tlsFiles,
+		authorizer:    authorizer,
 		inCh:          dp.OutChannel,
+		nodeInCh:      dp.NodeOutChannel,
 		errCh:         make(chan error),
 		deregCh:       deregCh,
 		regCh:         regCh,
+		statusCh:      statusCh,
+		nodeGoneCh:    make(chan string, grpcMaxConcurrentStreams),
 		dp:            dp,
 	}
 }
@@ -73,6 +98,16 @@ func (m *EventsServer) InputChannel() chan *protos.Events {
 	return m.inCh
 }
 
+// PolicyStatusChannel returns the channel of policy status reports from clients
+func (m *EventsServer) PolicyStatusChannel() <-chan *protos.PolicyStatusReport {
+	return m.statusCh
+}
+
+// NodeGoneChannel returns the channel of the names of nodes whose clients all deregistered
+func (m *EventsServer) NodeGoneChannel() <-chan string {
+	return m.nodeGoneCh
+}
+
 // Start starts the events manager (grpc server and watchdog)
 func (m *EventsServer) Start(stopCh <-chan struct{}) error {
 	klog.Info("Starting transport manager")
@@ -100,10 +135,13 @@ func (m *EventsServer) start(stopCh <-chan struct{}) error {
 			// within the same castegory we will have to paginate.
 			klog.Infof("Registering remote client %s", client)
 			m.Registrations[client.String()] = client
-			event, err := m.dp.HydrateClients()
+			event, err := m.dp.HydrateNode(client.GetNodeName())
 			if err != nil {
 				klog.Errorf("Failed to hydrate client %s: %v", client, err)
 			}
+			if event == nil {
+				continue
+			}
 			// (TODO) Hydration event takes a lock of whole DPShim instance, essentially blocking the
 			// controllers from receiving any more new events or servicing existing daemons.
 			// So we will need to add a buffering mechanism to wait until either we have a N number of daemons
@@ -122,6 +160,10 @@ func (m *EventsServer) start(stopCh <-chan struct{}) error {
 				if v.timestamp <= ev.timestamp {
 					klog.Infof("Deregistering remote client %s", ev.remoteAddr)
 					delete(m.Registrations, ev.remoteAddr)
+					if !m.nodeRegistered(v.GetNodeName()) {
+						m.dp.ForgetNode(v.GetNodeName())
+						m.nodeGone(v.GetNodeName())
+					}
 				} else {
 					klog.Info("Ignoring stale deregistration event")
 				}
@@ -137,6 +179,16 @@ func (m *EventsServer) start(stopCh <-chan struct{}) error {
 					klog.Errorf("Failed to send message to client %s: %v", client, err)
 				}
 			}
+		case msg := <-m.nodeInCh:
+			for clientName, client := range m.Registrations {
+				if client.GetNodeName() != msg.NodeName {
+					continue
+				}
+				klog.Infof("Servicing the event for node %s to %s", msg.NodeName, clientName)
+				if err := client.stream.SendMsg(msg.Events); err != nil {
+					klog.Errorf("Failed to send message to client %s: %v", client, err)
+				}
+			}
 		case <-m.ctx.Done():
 			klog.Info("Context Done. Stopping transport manager")
 			return nil
@@ -150,6 +202,25 @@ func (m *EventsServer) start(stopCh <-chan struct{}) error {
 	}
 }
 
+// nodeGone notifies the consumer of NodeGoneChannel without blocking, since there may be none
+func (m *EventsServer) nodeGone(nodeName string) {
+	select {
+	case m.nodeGoneCh <- nodeName:
+	default:
+		klog.Warningf("Dropping node gone notification for node %s", nodeName)
+	}
+}
+
+// nodeRegistered returns true if a client of the node is registered
+func (m *EventsServer) nodeRegistered(nodeName string) bool {
+	for _, client := range m.Registrations {
+		if client.GetNodeName() == nodeName {
+			return true
+		}
+	}
+	return false
+}
+
 func (m *EventsServer) handle() error {
 	klog.Infof("Starting transport manager listener on port %v", m.port)
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", m.port))
@@ -157,14 +228,17 @@ func (m *EventsServer) handle() error {
 		return fmt.Errorf("failed to handle server connections: %w", err)
 	}
 
-	// load the server certificates
-	creds, err := serverTLSCreds()
+	// load the server certificates and reload them on change
+	certs, err := newCertReloader(m.tlsFiles)
 	if err != nil {
 		return fmt.Errorf("failed to load TLS certificates: %w", err)
 	}
+	if err := certs.watch(m.ctx); err != nil {
+		return fmt.Errorf("failed to watch TLS certificates: %w", err)
+	}
 
 	var opts []grpc.ServerOption = []grpc.ServerOption{
-		grpc.Creds(creds),
+		grpc.Creds(credentials.NewTLS(certs.serverTLSConfig(m.authorizer != nil))),
 		grpc.MaxConcurrentStreams(grpcMaxConcurrentStreams),
 		grpc.StatsHandler(m.Watchdog),
 	}
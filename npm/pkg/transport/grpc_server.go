@@ -6,6 +6,7 @@ import (
 
 	"github.com/Azure/azure-container-networking/npm/pkg/protos"
 	"google.golang.org/grpc/peer"
+	"k8s.io/klog/v2"
 )
 
 // clientStreamConnection represents a client stream connection
@@ -24,20 +25,33 @@ func (c clientStreamConnection) String() string {
 // DataplaneEventsServer is the gRPC server for the DataplaneEvents service
 type DataplaneEventsServer struct {
 	protos.UnimplementedDataplaneEventsServer
-	ctx   context.Context
-	regCh chan<- clientStreamConnection
+	ctx      context.Context
+	regCh    chan<- clientStreamConnection
+	statusCh chan<- *protos.PolicyStatusReport
+	// authorizer is nil unless clients must present certificates bound to their node
+	authorizer *NodeAuthorizer
 }
 
-// NewServer creates a new DataplaneEventsServer instance
-func NewServer(ctx context.Context, ch chan clientStreamConnection) *DataplaneEventsServer {
+// NewServer creates a new DataplaneEventsServer instance. The authorizer may be nil.
+func NewServer(ctx context.Context, ch chan clientStreamConnection, statusCh chan *protos.PolicyStatusReport, authorizer *NodeAuthorizer) *DataplaneEventsServer {
 	return &DataplaneEventsServer{
-		ctx:   ctx,
-		regCh: ch,
+		ctx:        ctx,
+		regCh:      ch,
+		statusCh:   statusCh,
+		authorizer: authorizer,
 	}
 }
 
-// Connect is called when a client connects to the server
+// Connect is called when a client connects to the server.
+// With an authorizer, clients must present a certificate bound to the node they register for, since goal states are sensitive.
 func (d *DataplaneEventsServer) Connect(m *protos.DatapathPodMetadata, stream protos.DataplaneEvents_ConnectServer) error {
+	if d.authorizer != nil {
+		if err := d.authorizer.authorize(stream.Context(), m.GetPodName(), m.GetNodeName()); err != nil {
+			klog.Warningf("Rejecting registration of %s: %v", m.GetPodName(), err)
+			return err
+		}
+	}
+
 	p, ok := peer.FromContext(stream.Context())
 	if !ok {
 		return ErrNoPeer
@@ -58,3 +72,20 @@ func (d *DataplaneEventsServer) Connect(m *protos.DatapathPodMetadata, stream pr
 
 	return nil
 }
+
+// ReportStatus is called when a client reports the programming status of its policies.
+// Reports are dropped if nothing is consuming them, since the next report supersedes them.
+func (d *DataplaneEventsServer) ReportStatus(ctx context.Context, r *protos.PolicyStatusReport) (*protos.PolicyStatusAck, error) {
+	if d.authorizer != nil {
+		if err := d.authorizer.authorize(ctx, r.GetPodName(), r.GetNodeName()); err != nil {
+			klog.Warningf("Rejecting policy status report from %s: %v", r.GetPodName(), err)
+			return nil, err
+		}
+	}
+	select {
+	case d.statusCh <- r:
+	default:
+		klog.Warningf("Dropping policy status report from %s", r.GetPodName())
+	}
+	return &protos.PolicyStatusAck{}, nil
+}
@@ -1,48 +1,273 @@
 package transport
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 
+	"github.com/fsnotify/fsnotify"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
 )
 
 const (
-	serverCertPEMFilename = "tls.crt"
-	serverKeyPEMFilename  = "tls.key"
-	caCertPEMFilename     = "ca.crt"
-	path                  = "/usr/local/npm"
+	// nodeCommonNamePrefix is the prefix of the common name of kubelet client certificates
+	nodeCommonNamePrefix = "system:node:"
+
+	// labels of NPM daemon pods
+	daemonPodAppLabel       = "k8s-app"
+	daemonPodApp            = "azure-npm"
+	daemonPodComponentLabel = "component"
+	daemonPodComponent      = "daemon"
 )
 
-func serverTLSCreds() (credentials.TransportCredentials, error) {
-	certFilepath := path + "/" + serverCertPEMFilename
-	keyFilepath := path + "/" + serverKeyPEMFilename
+// TLSFiles are the PEM files of one side of the transport.
+// The controller serves its certificate, and verifies client certificates with the CA if it authorizes nodes.
+// Daemons verify the controller with the CA, and present their certificate as a client certificate if it is set.
+type TLSFiles struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+}
 
-	creds, err := credentials.NewServerTLSFromFile(certFilepath, keyFilepath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create creds from cert/key files : %w", err)
+// certReloader holds the certificate and CA pool loaded from TLSFiles and reloads them when the files change.
+// Established connections keep the certificates of their handshake, so reloading never drops streams.
+type certReloader struct {
+	files TLSFiles
+
+	sync.RWMutex
+	cert   *tls.Certificate
+	caPool *x509.CertPool
+}
+
+func newCertReloader(files TLSFiles) (*certReloader, error) {
+	r := &certReloader{files: files}
+	if err := r.load(); err != nil {
+		return nil, err
 	}
-	return creds, nil
+	return r, nil
 }
 
-func clientTLSConfig() (*tls.Config, error) {
-	caCertFilepath := path + "/" + caCertPEMFilename
-	// Load certificate of the CA who signed server's certificate
-	pemServerCA, err := os.ReadFile(caCertFilepath)
+// load reads the files which are set. A daemon without a certificate presents none.
+func (r *certReloader) load() error {
+	cert := &tls.Certificate{}
+	if r.files.CertFile != "" {
+		pair, err := tls.LoadX509KeyPair(r.files.CertFile, r.files.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load cert/key files : %w", err)
+		}
+		cert = &pair
+	}
+
+	var caPool *x509.CertPool
+	if r.files.CAFile != "" {
+		pemCA, err := os.ReadFile(r.files.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read the CA cert : %w", err)
+		}
+		caPool = x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM(pemCA) {
+			return fmt.Errorf("failed to append ca cert to cert pool : %w", ErrTLSCerts)
+		}
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	r.cert = cert
+	r.caPool = caPool
+	return nil
+}
+
+func (r *certReloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.RLock()
+	defer r.RUnlock()
+	return r.cert, r.caPool
+}
+
+// watch reloads the files whenever their directories change until the context is done.
+// Directories are watched since Secret volumes and kubelet certificate rotation replace files through symlinks.
+func (r *certReloader) watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		return nil, fmt.Errorf("Failed to read the CA cert : %w", err)
+		return fmt.Errorf("failed to create certificate watcher: %w", err)
+	}
+	dirs := map[string]struct{}{}
+	for _, file := range []string{r.files.CertFile, r.files.KeyFile, r.files.CAFile} {
+		if file != "" {
+			dirs[filepath.Dir(file)] = struct{}{}
+		}
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to watch certificate directory %s: %w", dir, err)
+		}
 	}
 
-	certPool := x509.NewCertPool()
-	if !certPool.AppendCertsFromPEM(pemServerCA) {
-		return nil, fmt.Errorf("failed to append ca cert to cert pool : %w", ErrTLSCerts)
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if ev.Op == fsnotify.Chmod {
+					continue
+				}
+				// files may be written one at a time, so failures are retried on the next event
+				if err := r.load(); err != nil {
+					klog.Warningf("failed to reload TLS certificates after %s, keeping the current ones: %v", ev, err)
+					continue
+				}
+				klog.Infof("reloaded TLS certificates after %s", ev)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				klog.Errorf("error watching TLS certificates: %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// serverTLSConfig serves the current certificate. If requireClientCerts is true,
+// clients must present certificates signed by the current CA.
+func (r *certReloader) serverTLSConfig(requireClientCerts bool) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, caPool := r.current()
+			config := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+			}
+			if requireClientCerts {
+				config.ClientCAs = caPool
+				config.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return config, nil
+		},
 	}
+}
 
-	// Create the credentials and return it
-	return &tls.Config{ //nolint // setting tls min version to 3
-		RootCAs:            certPool,
-		InsecureSkipVerify: false,
-	}, nil
+// clientTLSConfig presents the current certificate and verifies the server against the current CA.
+// Go only verifies against a fixed RootCAs, so verification is done in VerifyConnection instead.
+func (r *certReloader) clientTLSConfig() *tls.Config {
+	return &tls.Config{ //nolint:gosec // the server certificate is verified in VerifyConnection
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := r.current()
+			return cert, nil
+		},
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return fmt.Errorf("server presented no certificate : %w", ErrTLSCerts)
+			}
+			_, caPool := r.current()
+			opts := x509.VerifyOptions{
+				DNSName:       cs.ServerName,
+				Roots:         caPool,
+				Intermediates: x509.NewCertPool(),
+			}
+			for _, cert := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			if _, err := cs.PeerCertificates[0].Verify(opts); err != nil {
+				return fmt.Errorf("failed to verify server certificate : %w", err)
+			}
+			return nil
+		},
+	}
+}
+
+// NodeAuthorizer authorizes daemons to register and report status for a node if their verified client certificate is bound to it.
+// A certificate is bound to a node if the common name or a DNS name is the node name,
+// optionally prefixed with "system:node:" like kubelet client certificates.
+// A certificate is also bound to the node of a daemon pod if it has the URI SAN spiffe://<trust domain>/ns/<namespace>/pod/<pod>,
+// like the certificates which the cert-manager CSI driver issues to each daemon pod.
+type NodeAuthorizer struct {
+	pods corelisters.PodLister
+}
+
+// NewNodeAuthorizer creates a NodeAuthorizer which looks up the nodes of daemon pods in the lister.
+func NewNodeAuthorizer(pods corelisters.PodLister) *NodeAuthorizer {
+	return &NodeAuthorizer{pods: pods}
+}
+
+// authorize returns a PermissionDenied error unless the verified client certificate is bound to the node.
+func (a *NodeAuthorizer) authorize(ctx context.Context, podName, nodeName string) error {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ErrNoPeer
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return status.Errorf(codes.PermissionDenied, "client %s presented no verified certificate", p.Addr)
+	}
+	leaf := tlsInfo.State.VerifiedChains[0][0]
+	if nodeName == "" || !(certBoundToNode(leaf, nodeName) || a.daemonPodOnNode(leaf, podName, nodeName)) {
+		return status.Errorf(codes.PermissionDenied, "certificate %q of client %s is not bound to node %q", leaf.Subject.CommonName, p.Addr, nodeName)
+	}
+	return nil
+}
+
+// daemonPodOnNode returns true if the certificate names the daemon pod and the pod runs on the node.
+func (a *NodeAuthorizer) daemonPodOnNode(cert *x509.Certificate, podName, nodeName string) bool {
+	if a.pods == nil {
+		return false
+	}
+	for _, uri := range cert.URIs {
+		namespace, name, ok := parsePodURI(uri)
+		if !ok || name != podName {
+			continue
+		}
+		pod, err := a.pods.Pods(namespace).Get(name)
+		if err != nil {
+			klog.Warningf("failed to get daemon pod %s/%s of certificate: %v", namespace, name, err)
+			continue
+		}
+		if pod.Labels[daemonPodAppLabel] == daemonPodApp && pod.Labels[daemonPodComponentLabel] == daemonPodComponent && pod.Spec.NodeName == nodeName {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePodURI parses SPIFFE IDs of pods, which have the path /ns/<namespace>/pod/<name>.
+func parsePodURI(uri *url.URL) (namespace, name string, ok bool) {
+	if uri.Scheme != "spiffe" {
+		return "", "", false
+	}
+	parts := strings.Split(strings.TrimPrefix(uri.Path, "/"), "/")
+	if len(parts) != 4 || parts[0] != "ns" || parts[2] != "pod" || parts[1] == "" || parts[3] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[3], true
+}
+
+func certBoundToNode(cert *x509.Certificate, nodeName string) bool {
+	if strings.TrimPrefix(cert.Subject.CommonName, nodeCommonNamePrefix) == nodeName {
+		return true
+	}
+	for _, name := range cert.DNSNames {
+		if strings.TrimPrefix(name, nodeCommonNamePrefix) == nodeName {
+			return true
+		}
+	}
+	return false
 }
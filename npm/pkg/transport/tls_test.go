@@ -0,0 +1,245 @@
+package transport
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/npm/pkg/protos"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+type testCA struct {
+	cert   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	pem    []byte
+	serial int64
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "npm-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), serial: 1}
+}
+
+// writeCert writes a certificate signed by the CA, the key, and the CA to dir.
+func (ca *testCA) writeCert(t *testing.T, dir, commonName string, dnsNames []string, uris ...*url.URL) TLSFiles {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ca.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		URIs:         uris,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	files := TLSFiles{
+		CertFile: filepath.Join(dir, "tls.crt"),
+		KeyFile:  filepath.Join(dir, "tls.key"),
+		CAFile:   filepath.Join(dir, "ca.crt"),
+	}
+	require.NoError(t, os.WriteFile(files.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	require.NoError(t, os.WriteFile(files.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(files.CAFile, ca.pem, 0o600))
+	return files
+}
+
+func startTestServer(t *testing.T, ctx context.Context, files TLSFiles, authorizer *NodeAuthorizer) string {
+	t.Helper()
+	certs, err := newCertReloader(files)
+	require.NoError(t, err)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer(grpc.Creds(credentials.NewTLS(certs.serverTLSConfig(authorizer != nil))))
+	statusCh := make(chan *protos.PolicyStatusReport, 10)
+	protos.RegisterDataplaneEventsServer(server, NewServer(ctx, make(chan clientStreamConnection), statusCh, authorizer))
+	go server.Serve(lis) //nolint:errcheck // stopped by the test cleanup
+	t.Cleanup(server.Stop)
+
+	_, port, err := net.SplitHostPort(lis.Addr().String())
+	require.NoError(t, err)
+	return "localhost:" + port
+}
+
+func reportStatus(t *testing.T, ctx context.Context, certs *certReloader, addr, pod, node string) error {
+	t.Helper()
+	cc, err := grpc.NewClient(addr, grpc.WithTransportCredentials(credentials.NewTLS(certs.clientTLSConfig())))
+	require.NoError(t, err)
+	defer cc.Close()
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	_, err = protos.NewDataplaneEventsClient(cc).ReportStatus(ctx, &protos.PolicyStatusReport{PodName: pod, NodeName: node})
+	return err //nolint:wrapcheck // the status code is checked
+}
+
+func TestMutualTLSAuthorizesNode(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ca := newTestCA(t)
+	addr := startTestServer(t, ctx, ca.writeCert(t, t.TempDir(), "npm-controller", []string{"localhost"}), NewNodeAuthorizer(nil))
+
+	clientDir := t.TempDir()
+	certs, err := newCertReloader(ca.writeCert(t, clientDir, "system:node:node1", nil))
+	require.NoError(t, err)
+	require.NoError(t, certs.watch(ctx))
+
+	require.NoError(t, reportStatus(t, ctx, certs, addr, "npm-daemon", "node1"))
+
+	err = reportStatus(t, ctx, certs, addr, "npm-daemon", "node2")
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// a rotated certificate is used for new connections
+	oldCert, _ := certs.current()
+	ca.writeCert(t, clientDir, "", []string{"node2"})
+	require.Eventually(t, func() bool {
+		cert, _ := certs.current()
+		return cert != oldCert && cert.Leaf != nil && cert.Leaf.DNSNames[0] == "node2"
+	}, 10*time.Second, 50*time.Millisecond)
+	require.NoError(t, reportStatus(t, ctx, certs, addr, "npm-daemon", "node2"))
+}
+
+func TestPodCertificateAuthorizesNodeOfPod(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	daemonLabels := map[string]string{daemonPodAppLabel: daemonPodApp, daemonPodComponentLabel: daemonPodComponent}
+	require.NoError(t, indexer.Add(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "npm-daemon-a", Namespace: "kube-system", Labels: daemonLabels},
+		Spec:       corev1.PodSpec{NodeName: "node1"},
+	}))
+	require.NoError(t, indexer.Add(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "impostor", Namespace: "kube-system"},
+		Spec:       corev1.PodSpec{NodeName: "node2"},
+	}))
+
+	ca := newTestCA(t)
+	authorizer := NewNodeAuthorizer(corelisters.NewPodLister(indexer))
+	addr := startTestServer(t, ctx, ca.writeCert(t, t.TempDir(), "npm-controller", []string{"localhost"}), authorizer)
+
+	daemonURI, err := url.Parse("spiffe://cluster.local/ns/kube-system/pod/npm-daemon-a")
+	require.NoError(t, err)
+	certs, err := newCertReloader(ca.writeCert(t, t.TempDir(), "npm-daemon-a", nil, daemonURI))
+	require.NoError(t, err)
+	require.NoError(t, reportStatus(t, ctx, certs, addr, "npm-daemon-a", "node1"))
+	require.Equal(t, codes.PermissionDenied, status.Code(reportStatus(t, ctx, certs, addr, "npm-daemon-a", "node2")))
+
+	impostorURI, err := url.Parse("spiffe://cluster.local/ns/kube-system/pod/impostor")
+	require.NoError(t, err)
+	certs, err = newCertReloader(ca.writeCert(t, t.TempDir(), "impostor", nil, impostorURI))
+	require.NoError(t, err)
+	require.Equal(t, codes.PermissionDenied, status.Code(reportStatus(t, ctx, certs, addr, "impostor", "node2")), "not a daemon pod")
+}
+
+func TestNodeAuthorizationDisabled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ca := newTestCA(t)
+	serverFiles := ca.writeCert(t, t.TempDir(), "npm-controller", []string{"localhost"})
+	addr := startTestServer(t, ctx, TLSFiles{CertFile: serverFiles.CertFile, KeyFile: serverFiles.KeyFile}, nil)
+
+	// daemons only need the CA
+	certs, err := newCertReloader(TLSFiles{CAFile: serverFiles.CAFile})
+	require.NoError(t, err)
+	require.NoError(t, reportStatus(t, ctx, certs, addr, "npm-daemon", "node1"))
+}
+
+func TestClientRejectsUnknownServer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	addr := startTestServer(t, ctx, newTestCA(t).writeCert(t, t.TempDir(), "npm-controller", []string{"localhost"}), NewNodeAuthorizer(nil))
+	certs, err := newCertReloader(newTestCA(t).writeCert(t, t.TempDir(), "system:node:node1", nil))
+	require.NoError(t, err)
+
+	err = reportStatus(t, ctx, certs, addr, "npm-daemon", "node1")
+	require.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestParsePodURI(t *testing.T) {
+	tests := []struct {
+		uri       string
+		namespace string
+		name      string
+		ok        bool
+	}{
+		{"spiffe://cluster.local/ns/kube-system/pod/npm-daemon-a", "kube-system", "npm-daemon-a", true},
+		{"spiffe://cluster.local/ns/kube-system/sa/azure-npm", "", "", false},
+		{"https://cluster.local/ns/kube-system/pod/npm-daemon-a", "", "", false},
+		{"spiffe://cluster.local/ns//pod/npm-daemon-a", "", "", false},
+	}
+	for _, tt := range tests {
+		uri, err := url.Parse(tt.uri)
+		require.NoError(t, err)
+		namespace, name, ok := parsePodURI(uri)
+		require.Equal(t, tt.ok, ok, tt.uri)
+		require.Equal(t, tt.namespace, namespace, tt.uri)
+		require.Equal(t, tt.name, name, tt.uri)
+	}
+}
+
+func TestCertBoundToNode(t *testing.T) {
+	tests := []struct {
+		name  string
+		cert  *x509.Certificate
+		bound bool
+	}{
+		{"kubelet common name", &x509.Certificate{Subject: pkix.Name{CommonName: "system:node:node1"}}, true},
+		{"plain common name", &x509.Certificate{Subject: pkix.Name{CommonName: "node1"}}, true},
+		{"DNS name", &x509.Certificate{Subject: pkix.Name{CommonName: "npm"}, DNSNames: []string{"other", "node1"}}, true},
+		{"other node", &x509.Certificate{Subject: pkix.Name{CommonName: "system:node:node2"}}, false},
+		{"prefix of node name", &x509.Certificate{Subject: pkix.Name{CommonName: "system:node:node"}}, false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.bound, certBoundToNode(tt.cert, "node1"))
+		})
+	}
+}
@@ -16,6 +16,14 @@ const (
 	KubePodStatusSucceededFlag string = "Succeeded"
 	KubePodStatusUnknownFlag   string = "Unknown"
 
+	// NPMAuditOnlyAnnotation set to "true" on a NetworkPolicy makes NPM log the flows the policy would drop instead of dropping them.
+	// It only takes effect in Linux when verdict logging is enabled. Otherwise the policy is enforced.
+	NPMAuditOnlyAnnotation string = "npm.azure.com/audit-only"
+
+	// NPMFQDNEgressAnnotation on an egress NetworkPolicy holds comma separated domain names, such as "api.contoso.com,*.blob.core.windows.net".
+	// Selected pods may reach the IPs of matching names, which NPM learns from DNS responses. It only takes effect in Linux when FQDN egress is enabled.
+	NPMFQDNEgressAnnotation string = "npm.azure.com/fqdn-egress"
+
 	// The version of k8s that accept "AND" between namespaceSelector and podSelector is "1.11"
 	k8sMajorVerForNewPolicyDef string = "1"
 	k8sMinorVerForNewPolicyDef string = "11"
@@ -61,6 +69,8 @@ const (
 	IptablesDrop               string = "DROP"
 	IptablesReturn             string = "RETURN"
 	IptablesMark               string = "MARK"
+	IptablesNflog              string = "NFLOG"
+	IptablesNfqueue            string = "NFQUEUE"
 	IptablesSrcFlag            string = "src"
 	IptablesDstFlag            string = "dst"
 	IptablesNamedPortFlag      string = "dst,dst"
@@ -75,11 +85,19 @@ const (
 	IptablesMatchSetFlag       string = "--match-set"
 	IptablesSetMarkFlag        string = "--set-mark"
 	IptablesMarkFlag           string = "--mark"
+	IptablesNflogGroupFlag     string = "--nflog-group"
+	IptablesNflogPrefixFlag    string = "--nflog-prefix"
+	IptablesQueueNumFlag       string = "--queue-num"
+	IptablesQueueBypassFlag    string = "--queue-bypass"
+	IptablesLimitModuleFlag    string = "limit"
+	IptablesLimitFlag          string = "--limit"
+	IptablesLimitBurstFlag     string = "--limit-burst"
 	IptablesMarkVerb           string = "mark"
 	IptablesStateModuleFlag    string = "state"
 	IptablesStateFlag          string = "--state"
 	IptablesCtstateModuleFlag  string = "conntrack" // state module is obsolete: https://unix.stackexchange.com/questions/108169/what-is-the-difference-between-m-conntrack-ctstate-and-m-state-state
 	IptablesCtstateFlag        string = "--ctstate"
+	IptablesCtOrigDstFlag      string = "--ctorigdst"
 	IptablesMultiportFlag      string = "multiport"
 	IptablesRelatedState       string = "RELATED"
 	IptablesEstablishedState   string = "ESTABLISHED"
@@ -98,12 +116,14 @@ const (
 	IptablesKubeServicesChain          string = "KUBE-SERVICES"
 	IptablesForwardChain               string = "FORWARD"
 	IptablesInputChain                 string = "INPUT"
+	IptablesOutputChain                string = "OUTPUT"
 	IptablesAzureChain                 string = "AZURE-NPM"
 	IptablesAzureAcceptChain           string = "AZURE-NPM-ACCEPT"
 	IptablesAzureKubeSystemChain       string = "AZURE-NPM-KUBE-SYSTEM"
 	IptablesAzureIngressChain          string = "AZURE-NPM-INGRESS"
 	IptablesAzureIngressAllowMarkChain string = "AZURE-NPM-INGRESS-ALLOW-MARK"
 	IptablesAzureEgressChain           string = "AZURE-NPM-EGRESS"
+	IptablesAzureFQDNChain             string = "AZURE-NPM-FQDN"
 
 	// Chains used in NPM v1
 	IptablesAzureIngressPortChain  string = "AZURE-NPM-INGRESS-PORT"
@@ -141,6 +161,12 @@ const (
 	IptablesAzureIngressAllowMarkHex string = "0x200/0x200"
 	IptablesAzureIngressDropMarkHex  string = "0x400/0x400"
 	IptablesAzureEgressDropMarkHex   string = "0x800/0x800"
+	// AdminNetworkPolicy Pass marks skip the remaining AdminNetworkPolicies in a direction
+	IptablesAzureIngressPassMarkHex string = "0x100/0x100"
+	IptablesAzureEgressPassMarkHex  string = "0x80/0x80"
+	// Audit marks are set instead of drop marks by audit only NetworkPolicies when verdict logging is enabled
+	IptablesAzureIngressAuditMarkHex string = "0x40/0x40"
+	IptablesAzureEgressAuditMarkHex  string = "0x20/0x20"
 
 	// marks in NPM v1
 	IptablesAzureIngressMarkHex string = "0x2000"
@@ -198,6 +224,7 @@ const (
 	CIDRPrefix           string = "cidr-"
 	NestedLabelPrefix    string = "nestedlabel-"
 	EmptySetPrefix       string = "empty-"
+	FQDNPrefix           string = "fqdn-"
 
 	NegationPrefix string = "not-"
 
@@ -23,7 +23,12 @@ var (
 )
 
 func AllCurrentAzureChains(exec utilexec.Interface, lockWaitTimeSeconds string) (map[string]struct{}, error) {
-	iptablesListCommand := exec.Command(util.Iptables,
+	return AllCurrentAzureChainsWithCommand(exec, util.Iptables, lockWaitTimeSeconds)
+}
+
+// AllCurrentAzureChainsWithCommand is AllCurrentAzureChains for the given iptables binary, e.g. ip6tables-nft.
+func AllCurrentAzureChainsWithCommand(exec utilexec.Interface, iptablesCmd, lockWaitTimeSeconds string) (map[string]struct{}, error) {
+	iptablesListCommand := exec.Command(iptablesCmd,
 		util.IptablesWaitFlag, lockWaitTimeSeconds, util.IptablesTableFlag, util.IptablesFilterTable,
 		util.IptablesNumericFlag, util.IptablesListFlag,
 	)
@@ -342,6 +342,22 @@ func IsIPV4(ip string) bool {
 	return address.Is4()
 }
 
+// IsIPV6 returns true for an IPv6 address or CIDR. IPv4-mapped addresses are not considered IPv6.
+func IsIPV6(ip string) bool {
+	ipOnly := strings.Split(ip, "/")
+	address, err := netip.ParseAddr(ipOnly[0])
+	if err != nil || !address.Is6() || address.Is4In6() {
+		return false
+	}
+
+	if len(ipOnly) > 1 {
+		_, err := netip.ParsePrefix(ip)
+		return err == nil
+	}
+
+	return true
+}
+
 // Get preferred outbound ip of this machine
 // source: https://stackoverflow.com/questions/23558425/how-do-i-get-the-local-ip-address-in-go
 func NodeIP() (string, error) {
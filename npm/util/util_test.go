@@ -447,6 +447,23 @@ func TestSliceToString(t *testing.T) {
 	}
 }
 
+func TestIsIPV6(t *testing.T) {
+	for ip, want := range map[string]bool{
+		"fd00::1":        true,
+		"fd00::/64":      true,
+		"::/0":           true,
+		"fd00::/129":     false,
+		"10.0.0.1":       false,
+		"10.0.0.0/8":     false,
+		"::ffff:1.2.3.4": false,
+		"":               false,
+	} {
+		if got := IsIPV6(ip); got != want {
+			t.Errorf("IsIPV6(%q) got = %v, want %v", ip, got, want)
+		}
+	}
+}
+
 func TestNodeIP(t *testing.T) {
 	_, err := NodeIP()
 	require.Nil(t, err, "NodeIP() returned error")
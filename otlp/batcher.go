@@ -0,0 +1,157 @@
+package otlp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// maxBufferedBatches bounds the memory of a Batcher while the collector is unreachable: beyond this many batches
+// of either signal, new items are dropped.
+const maxBufferedBatches = 8
+
+// BatcherStats are the counters of a Batcher.
+type BatcherStats struct {
+	Exported uint64
+	Dropped  uint64
+	Failed   uint64
+}
+
+// Batcher buffers log records and metrics and exports them every batch interval, or as soon as a full batch is
+// buffered. Items which fail to export are dropped, the AppInsights spool covers durability.
+type Batcher struct {
+	exporter *Exporter
+	maxBatch int
+	onError  func(error)
+
+	mu      sync.Mutex
+	logs    []*logspb.LogRecord
+	metrics []*metricspb.Metric
+	stats   BatcherStats
+
+	full      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewBatcher creates a Batcher for the Exporter and starts exporting in the background until it's closed.
+// onError, if not nil, is called with every failed export. It must not emit into the Batcher.
+func NewBatcher(e *Exporter, onError func(error)) *Batcher {
+	b := &Batcher{
+		exporter: e,
+		maxBatch: e.cfg.MaxBatchSize,
+		onError:  onError,
+		full:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go b.run(e.cfg.BatchInterval.Duration)
+	return b
+}
+
+// EmitLog buffers a log record.
+func (b *Batcher) EmitLog(record *logspb.LogRecord) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.logs) >= b.maxBatch*maxBufferedBatches {
+		b.stats.Dropped++
+		return
+	}
+	b.logs = append(b.logs, record)
+	if len(b.logs) >= b.maxBatch {
+		b.signalFull()
+	}
+}
+
+// EmitMetric buffers a metric.
+func (b *Batcher) EmitMetric(metric *metricspb.Metric) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.metrics) >= b.maxBatch*maxBufferedBatches {
+		b.stats.Dropped++
+		return
+	}
+	b.metrics = append(b.metrics, metric)
+	if len(b.metrics) >= b.maxBatch {
+		b.signalFull()
+	}
+}
+
+func (b *Batcher) signalFull() {
+	select {
+	case b.full <- struct{}{}:
+	default:
+	}
+}
+
+// Stats returns the counters of the Batcher.
+func (b *Batcher) Stats() BatcherStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stats
+}
+
+// Flush exports everything buffered. It returns the first export error.
+func (b *Batcher) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	logs, metrics := b.logs, b.metrics
+	b.logs, b.metrics = nil, nil
+	b.mu.Unlock()
+
+	var firstErr error
+	record := func(n int, err error) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if err != nil {
+			b.stats.Failed += uint64(n)
+			if firstErr == nil {
+				firstErr = err
+			}
+			if b.onError != nil {
+				b.onError(err)
+			}
+			return
+		}
+		b.stats.Exported += uint64(n)
+	}
+	for len(logs) > 0 {
+		n := min(len(logs), b.maxBatch)
+		record(n, b.exporter.ExportLogs(ctx, logs[:n]))
+		logs = logs[n:]
+	}
+	for len(metrics) > 0 {
+		n := min(len(metrics), b.maxBatch)
+		record(n, b.exporter.ExportMetrics(ctx, metrics[:n]))
+		metrics = metrics[n:]
+	}
+	return firstErr
+}
+
+// Close stops the background export and flushes what's buffered.
+func (b *Batcher) Close(ctx context.Context) error {
+	b.closeOnce.Do(func() {
+		close(b.stop)
+	})
+	<-b.done
+	return b.Flush(ctx)
+}
+
+func (b *Batcher) run(interval time.Duration) {
+	defer close(b.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		case <-b.full:
+		}
+		// failed exports are counted and reported through onError
+		_ = b.Flush(context.Background())
+	}
+}
@@ -0,0 +1,178 @@
+package otlp
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// MetricsBridge exports the metrics of a Prometheus registry over OTLP. Counters, histograms and summaries are
+// exported as cumulative since the bridge started.
+type MetricsBridge struct {
+	gatherer prometheus.Gatherer
+	exporter *Exporter
+	start    time.Time
+}
+
+// NewMetricsBridge creates a MetricsBridge which exports what the Gatherer collects.
+func NewMetricsBridge(g prometheus.Gatherer, e *Exporter) *MetricsBridge {
+	return &MetricsBridge{gatherer: g, exporter: e, start: time.Now()}
+}
+
+// Export gathers the registry and exports it once. Metrics which fail to gather are skipped.
+func (m *MetricsBridge) Export(ctx context.Context) error {
+	families, gatherErr := m.gatherer.Gather()
+	if len(families) == 0 && gatherErr != nil {
+		return errors.Wrap(gatherErr, "failed to gather metrics")
+	}
+	metrics := convertMetricFamilies(families, m.start, time.Now())
+	for len(metrics) > 0 {
+		n := min(len(metrics), m.exporter.cfg.MaxBatchSize)
+		if err := m.exporter.ExportMetrics(ctx, metrics[:n]); err != nil {
+			return err
+		}
+		metrics = metrics[n:]
+	}
+	return errors.Wrap(gatherErr, "failed to gather some metrics")
+}
+
+// Run exports the registry every metrics interval until the context is done. Failed exports are passed to onError
+// if it's not nil.
+func (m *MetricsBridge) Run(ctx context.Context, onError func(error)) {
+	ticker := time.NewTicker(m.exporter.cfg.MetricsInterval.Duration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := m.Export(ctx); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+// convertMetricFamilies converts Prometheus metric families to OTLP metrics.
+func convertMetricFamilies(families []*dto.MetricFamily, start, now time.Time) []*metricspb.Metric {
+	startNanos := uint64(start.UnixNano())
+	out := make([]*metricspb.Metric, 0, len(families))
+	for _, family := range families {
+		metric := &metricspb.Metric{Name: family.GetName(), Description: family.GetHelp()}
+		switch family.GetType() {
+		case dto.MetricType_COUNTER:
+			sum := &metricspb.Sum{
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+				IsMonotonic:            true,
+			}
+			for _, m := range family.GetMetric() {
+				sum.DataPoints = append(sum.DataPoints, numberDataPoint(m, m.GetCounter().GetValue(), startNanos, now))
+			}
+			metric.Data = &metricspb.Metric_Sum{Sum: sum}
+		case dto.MetricType_GAUGE:
+			gauge := &metricspb.Gauge{}
+			for _, m := range family.GetMetric() {
+				gauge.DataPoints = append(gauge.DataPoints, numberDataPoint(m, m.GetGauge().GetValue(), 0, now))
+			}
+			metric.Data = &metricspb.Metric_Gauge{Gauge: gauge}
+		case dto.MetricType_UNTYPED:
+			gauge := &metricspb.Gauge{}
+			for _, m := range family.GetMetric() {
+				gauge.DataPoints = append(gauge.DataPoints, numberDataPoint(m, m.GetUntyped().GetValue(), 0, now))
+			}
+			metric.Data = &metricspb.Metric_Gauge{Gauge: gauge}
+		case dto.MetricType_HISTOGRAM:
+			histogram := &metricspb.Histogram{
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			}
+			for _, m := range family.GetMetric() {
+				histogram.DataPoints = append(histogram.DataPoints, histogramDataPoint(m, startNanos, now))
+			}
+			metric.Data = &metricspb.Metric_Histogram{Histogram: histogram}
+		case dto.MetricType_SUMMARY:
+			summary := &metricspb.Summary{}
+			for _, m := range family.GetMetric() {
+				summary.DataPoints = append(summary.DataPoints, summaryDataPoint(m, startNanos, now))
+			}
+			metric.Data = &metricspb.Metric_Summary{Summary: summary}
+		default:
+			// gauge histograms have no OTLP equivalent
+			continue
+		}
+		out = append(out, metric)
+	}
+	return out
+}
+
+func numberDataPoint(m *dto.Metric, value float64, startNanos uint64, now time.Time) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{
+		Attributes:        labelsToAttributes(m.GetLabel()),
+		StartTimeUnixNano: startNanos,
+		TimeUnixNano:      timestamp(m, now),
+		Value:             &metricspb.NumberDataPoint_AsDouble{AsDouble: value},
+	}
+}
+
+// histogramDataPoint converts the cumulative Prometheus buckets to the per-bucket counts of OTLP. The +Inf bucket
+// is implied by OTLP, so it only contributes its count.
+func histogramDataPoint(m *dto.Metric, startNanos uint64, now time.Time) *metricspb.HistogramDataPoint {
+	h := m.GetHistogram()
+	sum := h.GetSampleSum()
+	dp := &metricspb.HistogramDataPoint{
+		Attributes:        labelsToAttributes(m.GetLabel()),
+		StartTimeUnixNano: startNanos,
+		TimeUnixNano:      timestamp(m, now),
+		Count:             h.GetSampleCount(),
+		Sum:               &sum,
+	}
+	var prev uint64
+	for _, b := range h.GetBucket() {
+		if math.IsInf(b.GetUpperBound(), 1) {
+			continue
+		}
+		dp.ExplicitBounds = append(dp.ExplicitBounds, b.GetUpperBound())
+		dp.BucketCounts = append(dp.BucketCounts, b.GetCumulativeCount()-prev)
+		prev = b.GetCumulativeCount()
+	}
+	dp.BucketCounts = append(dp.BucketCounts, h.GetSampleCount()-prev)
+	return dp
+}
+
+func summaryDataPoint(m *dto.Metric, startNanos uint64, now time.Time) *metricspb.SummaryDataPoint {
+	s := m.GetSummary()
+	dp := &metricspb.SummaryDataPoint{
+		Attributes:        labelsToAttributes(m.GetLabel()),
+		StartTimeUnixNano: startNanos,
+		TimeUnixNano:      timestamp(m, now),
+		Count:             s.GetSampleCount(),
+		Sum:               s.GetSampleSum(),
+	}
+	for _, q := range s.GetQuantile() {
+		dp.QuantileValues = append(dp.QuantileValues, &metricspb.SummaryDataPoint_ValueAtQuantile{
+			Quantile: q.GetQuantile(),
+			Value:    q.GetValue(),
+		})
+	}
+	return dp
+}
+
+func labelsToAttributes(labels []*dto.LabelPair) []*commonpb.KeyValue {
+	attrs := make([]*commonpb.KeyValue, 0, len(labels))
+	for _, l := range labels {
+		attrs = append(attrs, StringAttribute(l.GetName(), l.GetValue()))
+	}
+	return attrs
+}
+
+func timestamp(m *dto.Metric, now time.Time) uint64 {
+	if m.TimestampMs != nil {
+		return uint64(time.UnixMilli(m.GetTimestampMs()).UnixNano())
+	}
+	return uint64(now.UnixNano())
+}
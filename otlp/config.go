@@ -0,0 +1,81 @@
+// Package otlp exports ACN logs, metrics and traces to an OpenTelemetry collector over OTLP/gRPC or OTLP/HTTP.
+// It runs alongside the Application Insights telemetry of aitelemetry and zapai: a zap core for logs, a bridge for
+// Prometheus registries, and a batcher which the AppInsights handle mirrors its telemetry to.
+package otlp
+
+import (
+	"github.com/Azure/azure-container-networking/internal/time"
+	"github.com/pkg/errors"
+)
+
+// Protocols of the OTLP exporter.
+const (
+	ProtocolGRPC = "grpc"
+	ProtocolHTTP = "http/protobuf"
+)
+
+const (
+	defaultGRPCEndpoint    = "localhost:4317"
+	defaultHTTPEndpoint    = "localhost:4318"
+	defaultTimeout         = 10 * time.Second
+	defaultBatchInterval   = 5 * time.Second
+	defaultMaxBatchSize    = 512
+	defaultMetricsInterval = 60 * time.Second
+)
+
+var ErrUnknownProtocol = errors.New("unknown OTLP protocol")
+
+// Config configures the OTLP exporter. The zero value exports over OTLP/gRPC with TLS to a collector on localhost.
+type Config struct {
+	// Endpoint is the host:port of the collector. For OTLP/HTTP it may also be a URL, to which the signal paths
+	// (/v1/logs, /v1/metrics and /v1/traces) are appended.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Protocol is either "grpc" or "http/protobuf". It defaults to "grpc".
+	Protocol string `json:"protocol,omitempty"`
+	// Insecure disables TLS.
+	Insecure bool `json:"insecure,omitempty"`
+	// Headers are sent with every export, e.g. for authentication.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Timeout bounds each export.
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// BatchInterval is the maximum delay before buffered logs and metrics are exported.
+	BatchInterval time.Duration `json:"batch_interval,omitempty"`
+	// MaxBatchSize is the maximum number of log records or metrics in a single export.
+	MaxBatchSize int `json:"max_batch_size,omitempty"`
+	// MetricsInterval is how often Prometheus registries are exported.
+	MetricsInterval time.Duration `json:"metrics_interval,omitempty"`
+	// ServiceName is the service.name resource attribute. It defaults to the name of the component.
+	ServiceName string `json:"service_name,omitempty"`
+	// ResourceAttributes are added to the resource of every export, e.g. the cluster or node name.
+	ResourceAttributes map[string]string `json:"resource_attributes,omitempty"`
+}
+
+// withDefaults returns a copy of the Config with the unset fields defaulted.
+func (c Config) withDefaults() (Config, error) {
+	switch c.Protocol {
+	case "":
+		c.Protocol = ProtocolGRPC
+	case ProtocolGRPC, ProtocolHTTP:
+	default:
+		return c, errors.Wrapf(ErrUnknownProtocol, "%q", c.Protocol)
+	}
+	if c.Endpoint == "" {
+		c.Endpoint = defaultGRPCEndpoint
+		if c.Protocol == ProtocolHTTP {
+			c.Endpoint = defaultHTTPEndpoint
+		}
+	}
+	if c.Timeout.Duration <= 0 {
+		c.Timeout.Duration = defaultTimeout
+	}
+	if c.BatchInterval.Duration <= 0 {
+		c.BatchInterval.Duration = defaultBatchInterval
+	}
+	if c.MaxBatchSize <= 0 {
+		c.MaxBatchSize = defaultMaxBatchSize
+	}
+	if c.MetricsInterval.Duration <= 0 {
+		c.MetricsInterval.Duration = defaultMetricsInterval
+	}
+	return c, nil
+}
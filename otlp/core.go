@@ -0,0 +1,170 @@
+package otlp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"go.uber.org/zap/zapcore"
+)
+
+// syncTimeout bounds the flush of Core.Sync.
+const syncTimeout = 5 * time.Second
+
+var _ zapcore.Core = &Core{}
+
+// Core is a zapcore.Core which emits log entries as OTLP log records into a Batcher.
+type Core struct {
+	zapcore.LevelEnabler
+	batcher *Batcher
+	attrs   []*commonpb.KeyValue
+}
+
+// NewCore creates a Core which emits the enabled entries into the Batcher.
+func NewCore(enab zapcore.LevelEnabler, b *Batcher) *Core {
+	return &Core{LevelEnabler: enab, batcher: b}
+}
+
+// With returns a copy of the Core with the fields added to every record.
+func (c *Core) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.attrs = append(append([]*commonpb.KeyValue{}, c.attrs...), fieldsToAttributes(fields)...)
+	return &clone
+}
+
+func (c *Core) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *Core) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	attrs := append(append([]*commonpb.KeyValue{}, c.attrs...), fieldsToAttributes(fields)...)
+	if ent.LoggerName != "" {
+		attrs = append(attrs, StringAttribute("logger.name", ent.LoggerName))
+	}
+	if ent.Caller.Defined {
+		attrs = append(attrs,
+			StringAttribute("code.filepath", ent.Caller.File),
+			&commonpb.KeyValue{Key: "code.lineno", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(ent.Caller.Line)}}},
+		)
+	}
+	if ent.Stack != "" {
+		attrs = append(attrs, StringAttribute("exception.stacktrace", ent.Stack))
+	}
+	c.batcher.EmitLog(&logspb.LogRecord{
+		TimeUnixNano:         uint64(ent.Time.UnixNano()),
+		ObservedTimeUnixNano: uint64(time.Now().UnixNano()),
+		SeverityNumber:       severity(ent.Level),
+		SeverityText:         ent.Level.CapitalString(),
+		Body:                 &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: ent.Message}},
+		Attributes:           attrs,
+	})
+	return nil
+}
+
+// Sync exports the buffered records.
+func (c *Core) Sync() error {
+	ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+	defer cancel()
+	return c.batcher.Flush(ctx)
+}
+
+// severity maps zap levels to the OTLP severity numbers.
+func severity(lvl zapcore.Level) logspb.SeverityNumber {
+	switch lvl {
+	case zapcore.DebugLevel:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG
+	case zapcore.InfoLevel:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_INFO
+	case zapcore.WarnLevel:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_WARN
+	case zapcore.ErrorLevel:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_ERROR
+	case zapcore.DPanicLevel:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_ERROR2
+	case zapcore.PanicLevel:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_FATAL
+	case zapcore.FatalLevel:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_FATAL2
+	default:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED
+	}
+}
+
+// fieldsToAttributes encodes zap fields to OTLP attributes, sorted by key.
+func fieldsToAttributes(fields []zapcore.Field) []*commonpb.KeyValue {
+	if len(fields) == 0 {
+		return nil
+	}
+	enc := zapcore.NewMapObjectEncoder()
+	for i := range fields {
+		fields[i].AddTo(enc)
+	}
+	keys := make([]string, 0, len(enc.Fields))
+	for k := range enc.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := make([]*commonpb.KeyValue, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, &commonpb.KeyValue{Key: k, Value: anyValue(enc.Fields[k])})
+	}
+	return attrs
+}
+
+// anyValue converts the values produced by zapcore.MapObjectEncoder to an OTLP value.
+func anyValue(v interface{}) *commonpb.AnyValue {
+	switch val := v.(type) {
+	case string:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: val}}
+	case bool:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: val}}
+	case int:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(val)}}
+	case int8:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(val)}}
+	case int16:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(val)}}
+	case int32:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(val)}}
+	case int64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: val}}
+	case uint8:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(val)}}
+	case uint16:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(val)}}
+	case uint32:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(val)}}
+	case float32:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: float64(val)}}
+	case float64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: val}}
+	case []byte:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BytesValue{BytesValue: val}}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		kvs := &commonpb.KeyValueList{}
+		for _, k := range keys {
+			kvs.Values = append(kvs.Values, &commonpb.KeyValue{Key: k, Value: anyValue(val[k])})
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: kvs}}
+	case []interface{}:
+		arr := &commonpb.ArrayValue{}
+		for _, elem := range val {
+			arr.Values = append(arr.Values, anyValue(elem))
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: arr}}
+	default:
+		// durations, times, uint64s and stringers keep their text form
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: fmt.Sprint(val)}}
+	}
+}
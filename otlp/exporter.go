@@ -0,0 +1,156 @@
+package otlp
+
+import (
+	"context"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+	collectorlogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// scopeName is the instrumentation scope of everything ACN exports.
+const scopeName = "github.com/Azure/azure-container-networking"
+
+var ErrPartialSuccess = errors.New("collector rejected part of the export")
+
+// client sends export requests to a collector over one of the OTLP protocols.
+type client interface {
+	exportLogs(context.Context, *collectorlogs.ExportLogsServiceRequest) error
+	exportMetrics(context.Context, *collectormetrics.ExportMetricsServiceRequest) error
+	exportTraces(context.Context, *collectortrace.ExportTraceServiceRequest) error
+	close() error
+}
+
+// Exporter exports logs, metrics and spans of a single service to an OTLP collector.
+type Exporter struct {
+	cfg      Config
+	resource *resourcepb.Resource
+	client   client
+}
+
+// NewExporter creates an Exporter for the service. The service name is used unless the Config sets one.
+func NewExporter(cfg *Config, serviceName string) (*Exporter, error) {
+	c, err := cfg.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	if c.ServiceName == "" {
+		c.ServiceName = serviceName
+	}
+	var cl client
+	if c.Protocol == ProtocolHTTP {
+		cl, err = newHTTPClient(&c)
+	} else {
+		cl, err = newGRPCClient(&c)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Exporter{
+		cfg:      c,
+		resource: newResource(&c),
+		client:   cl,
+	}, nil
+}
+
+// ExportLogs sends the log records to the collector.
+func (e *Exporter) ExportLogs(ctx context.Context, records []*logspb.LogRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.Timeout.Duration)
+	defer cancel()
+	return e.client.exportLogs(ctx, &collectorlogs.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource:  e.resource,
+			ScopeLogs: []*logspb.ScopeLogs{{Scope: scope(), LogRecords: records}},
+		}},
+	})
+}
+
+// ExportMetrics sends the metrics to the collector.
+func (e *Exporter) ExportMetrics(ctx context.Context, metrics []*metricspb.Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.Timeout.Duration)
+	defer cancel()
+	return e.client.exportMetrics(ctx, &collectormetrics.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource:     e.resource,
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Scope: scope(), Metrics: metrics}},
+		}},
+	})
+}
+
+// ExportSpans sends the spans to the collector.
+func (e *Exporter) ExportSpans(ctx context.Context, spans []*tracepb.Span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.Timeout.Duration)
+	defer cancel()
+	return e.client.exportTraces(ctx, &collectortrace.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			Resource:   e.resource,
+			ScopeSpans: []*tracepb.ScopeSpans{{Scope: scope(), Spans: spans}},
+		}},
+	})
+}
+
+// Close releases the connection to the collector.
+func (e *Exporter) Close() error {
+	return e.client.close()
+}
+
+func scope() *commonpb.InstrumentationScope {
+	return &commonpb.InstrumentationScope{Name: scopeName}
+}
+
+// newResource builds the resource which identifies the service in every export.
+func newResource(cfg *Config) *resourcepb.Resource {
+	attrs := map[string]string{"service.name": cfg.ServiceName}
+	if host, err := os.Hostname(); err == nil {
+		attrs["host.name"] = host
+	}
+	for k, v := range cfg.ResourceAttributes {
+		attrs[k] = v
+	}
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	res := &resourcepb.Resource{}
+	for _, k := range keys {
+		res.Attributes = append(res.Attributes, StringAttribute(k, attrs[k]))
+	}
+	return res
+}
+
+// StringAttribute returns an OTLP attribute with a string value.
+func StringAttribute(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+// StringAttributes returns the OTLP attributes of a string map, sorted by key.
+func StringAttributes(m map[string]string) []*commonpb.KeyValue {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := make([]*commonpb.KeyValue, 0, len(m))
+	for _, k := range keys {
+		attrs = append(attrs, StringAttribute(k, m[k]))
+	}
+	return attrs
+}
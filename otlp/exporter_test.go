@@ -0,0 +1,180 @@
+package otlp_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	acntime "github.com/Azure/azure-container-networking/internal/time"
+	"github.com/Azure/azure-container-networking/otlp"
+	"github.com/Azure/azure-container-networking/otlp/otlptest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func configs(r *otlptest.Receiver) map[string]*otlp.Config {
+	return map[string]*otlp.Config{
+		"grpc": {
+			Endpoint: r.GRPCEndpoint,
+			Protocol: otlp.ProtocolGRPC,
+			Insecure: true,
+			Headers:  map[string]string{"x-tenant": "acn"},
+		},
+		"http": {
+			Endpoint: r.HTTPEndpoint,
+			Protocol: otlp.ProtocolHTTP,
+			Headers:  map[string]string{"X-Tenant": "acn"},
+		},
+	}
+}
+
+func attributes(kvs []*commonpb.KeyValue) map[string]string {
+	out := map[string]string{}
+	for _, kv := range kvs {
+		switch v := kv.GetValue().GetValue().(type) {
+		case *commonpb.AnyValue_StringValue:
+			out[kv.GetKey()] = v.StringValue
+		default:
+			out[kv.GetKey()] = kv.GetValue().String()
+		}
+	}
+	return out
+}
+
+func TestCoreExportsLogs(t *testing.T) {
+	r := otlptest.NewReceiver(t)
+	for name, cfg := range configs(r) {
+		t.Run(name, func(t *testing.T) {
+			e, err := otlp.NewExporter(cfg, "azure-cns")
+			require.NoError(t, err)
+			defer e.Close()
+			b := otlp.NewBatcher(e, nil)
+
+			z := zap.New(otlp.NewCore(zapcore.InfoLevel, b)).With(zap.String("module", name))
+			z.Debug("filtered")
+			z.Warn("request failed", zap.String("ncid", "nc-1"), zap.Int("attempt", 2), zap.Error(errors.New("boom")))
+			require.NoError(t, b.Close(context.Background()))
+
+			var got *logspb.LogRecord
+			for _, record := range r.LogRecords() {
+				if attributes(record.GetAttributes())["module"] == name {
+					require.Nil(t, got, "only the warning is exported")
+					got = record
+				}
+			}
+			require.NotNil(t, got)
+			assert.Equal(t, "request failed", got.GetBody().GetStringValue())
+			assert.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_WARN, got.GetSeverityNumber())
+			assert.Equal(t, "WARN", got.GetSeverityText())
+			attrs := attributes(got.GetAttributes())
+			assert.Equal(t, "nc-1", attrs["ncid"])
+			assert.Equal(t, "boom", attrs["error"])
+			assert.Contains(t, attrs["attempt"], "2")
+			assert.Equal(t, otlp.BatcherStats{Exported: 1}, b.Stats())
+		})
+	}
+
+	for _, res := range r.Resources() {
+		assert.Equal(t, "azure-cns", attributes(res.GetAttributes())["service.name"])
+	}
+	for _, headers := range r.Headers() {
+		assert.Equal(t, "acn", headers["x-tenant"]+headers["X-Tenant"])
+	}
+}
+
+func TestMetricsBridgeExportsRegistry(t *testing.T) {
+	r := otlptest.NewReceiver(t)
+	for name, cfg := range configs(r) {
+		t.Run(name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name + "_requests_total"}, []string{"code"})
+			histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: name + "_latency_seconds", Buckets: []float64{0.1, 1}})
+			reg.MustRegister(counter, histogram)
+			counter.WithLabelValues("200").Add(3)
+			for _, v := range []float64{0.05, 0.5, 0.7, 5} {
+				histogram.Observe(v)
+			}
+
+			e, err := otlp.NewExporter(cfg, "azure-npm")
+			require.NoError(t, err)
+			defer e.Close()
+			require.NoError(t, otlp.NewMetricsBridge(reg, e).Export(context.Background()))
+
+			metrics := map[string]bool{}
+			for _, m := range r.Metrics() {
+				metrics[m.GetName()] = true
+				switch m.GetName() {
+				case name + "_requests_total":
+					sum := m.GetSum()
+					require.NotNil(t, sum)
+					assert.True(t, sum.GetIsMonotonic())
+					require.Len(t, sum.GetDataPoints(), 1)
+					assert.InDelta(t, 3, sum.GetDataPoints()[0].GetAsDouble(), 0)
+					assert.Equal(t, "200", attributes(sum.GetDataPoints()[0].GetAttributes())["code"])
+				case name + "_latency_seconds":
+					dp := m.GetHistogram().GetDataPoints()[0]
+					assert.Equal(t, uint64(4), dp.GetCount())
+					assert.Equal(t, []float64{0.1, 1}, dp.GetExplicitBounds())
+					assert.Equal(t, []uint64{1, 2, 1}, dp.GetBucketCounts())
+				}
+			}
+			assert.True(t, metrics[name+"_requests_total"])
+			assert.True(t, metrics[name+"_latency_seconds"])
+		})
+	}
+}
+
+func TestExportSpans(t *testing.T) {
+	r := otlptest.NewReceiver(t)
+	for name, cfg := range configs(r) {
+		t.Run(name, func(t *testing.T) {
+			e, err := otlp.NewExporter(cfg, "azure-cns")
+			require.NoError(t, err)
+			defer e.Close()
+			require.NoError(t, e.ExportSpans(context.Background(), []*tracepb.Span{{Name: name}}))
+		})
+	}
+	require.Len(t, r.Spans(), 2)
+}
+
+func TestBatcherCountsFailedExports(t *testing.T) {
+	r := otlptest.NewReceiver(t)
+	r.FailWith(http.StatusServiceUnavailable)
+	e, err := otlp.NewExporter(&otlp.Config{
+		Endpoint:      r.HTTPEndpoint,
+		Protocol:      otlp.ProtocolHTTP,
+		BatchInterval: acntime.Duration{Duration: time.Hour},
+		MaxBatchSize:  1,
+	}, "azure-cns")
+	require.NoError(t, err)
+	defer e.Close()
+
+	errs := make(chan error, 16)
+	b := otlp.NewBatcher(e, func(err error) { errs <- err })
+	// with a batch size of one, the buffer holds eight records, the rest are dropped
+	for i := 0; i < 10; i++ {
+		b.EmitLog(&logspb.LogRecord{})
+	}
+	// full batches are exported in the background, so the failures may be reported before Close
+	_ = b.Close(context.Background())
+	require.NotEmpty(t, errs)
+	require.ErrorIs(t, <-errs, otlp.ErrExportFailed)
+
+	stats := b.Stats()
+	assert.Zero(t, stats.Exported)
+	assert.Equal(t, uint64(10), stats.Failed+stats.Dropped)
+	assert.Empty(t, r.LogRecords())
+}
+
+func TestUnknownProtocol(t *testing.T) {
+	_, err := otlp.NewExporter(&otlp.Config{Protocol: "http/json"}, "azure-cns")
+	require.ErrorIs(t, err, otlp.ErrUnknownProtocol)
+}
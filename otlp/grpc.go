@@ -0,0 +1,80 @@
+package otlp
+
+import (
+	"context"
+	"crypto/tls"
+
+	"github.com/pkg/errors"
+	collectorlogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// grpcClient exports over OTLP/gRPC.
+type grpcClient struct {
+	conn    *grpc.ClientConn
+	md      metadata.MD
+	logs    collectorlogs.LogsServiceClient
+	metrics collectormetrics.MetricsServiceClient
+	traces  collectortrace.TraceServiceClient
+}
+
+func newGRPCClient(cfg *Config) (*grpcClient, error) {
+	creds := insecure.NewCredentials()
+	if !cfg.Insecure {
+		creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	}
+	// the connection is established lazily, so that an unreachable collector doesn't hold up the caller
+	conn, err := grpc.NewClient(cfg.Endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create OTLP/gRPC client for %s", cfg.Endpoint)
+	}
+	return &grpcClient{
+		conn:    conn,
+		md:      metadata.New(cfg.Headers),
+		logs:    collectorlogs.NewLogsServiceClient(conn),
+		metrics: collectormetrics.NewMetricsServiceClient(conn),
+		traces:  collectortrace.NewTraceServiceClient(conn),
+	}, nil
+}
+
+func (c *grpcClient) exportLogs(ctx context.Context, req *collectorlogs.ExportLogsServiceRequest) error {
+	resp, err := c.logs.Export(metadata.NewOutgoingContext(ctx, c.md), req)
+	if err != nil {
+		return errors.Wrap(err, "failed to export logs")
+	}
+	if rejected := resp.GetPartialSuccess().GetRejectedLogRecords(); rejected > 0 {
+		return errors.Wrapf(ErrPartialSuccess, "%d log records rejected: %s", rejected, resp.GetPartialSuccess().GetErrorMessage())
+	}
+	return nil
+}
+
+func (c *grpcClient) exportMetrics(ctx context.Context, req *collectormetrics.ExportMetricsServiceRequest) error {
+	resp, err := c.metrics.Export(metadata.NewOutgoingContext(ctx, c.md), req)
+	if err != nil {
+		return errors.Wrap(err, "failed to export metrics")
+	}
+	if rejected := resp.GetPartialSuccess().GetRejectedDataPoints(); rejected > 0 {
+		return errors.Wrapf(ErrPartialSuccess, "%d data points rejected: %s", rejected, resp.GetPartialSuccess().GetErrorMessage())
+	}
+	return nil
+}
+
+func (c *grpcClient) exportTraces(ctx context.Context, req *collectortrace.ExportTraceServiceRequest) error {
+	resp, err := c.traces.Export(metadata.NewOutgoingContext(ctx, c.md), req)
+	if err != nil {
+		return errors.Wrap(err, "failed to export spans")
+	}
+	if rejected := resp.GetPartialSuccess().GetRejectedSpans(); rejected > 0 {
+		return errors.Wrapf(ErrPartialSuccess, "%d spans rejected: %s", rejected, resp.GetPartialSuccess().GetErrorMessage())
+	}
+	return nil
+}
+
+func (c *grpcClient) close() error {
+	return errors.Wrap(c.conn.Close(), "failed to close OTLP/gRPC connection")
+}
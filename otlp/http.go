@@ -0,0 +1,120 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	collectorlogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// Paths of the OTLP/HTTP signals.
+const (
+	LogsPath    = "/v1/logs"
+	MetricsPath = "/v1/metrics"
+	TracesPath  = "/v1/traces"
+)
+
+const protobufContentType = "application/x-protobuf"
+
+var ErrExportFailed = errors.New("collector failed the export")
+
+// httpClient exports over OTLP/HTTP with binary protobuf payloads.
+type httpClient struct {
+	client  *http.Client
+	baseURL string
+	headers map[string]string
+}
+
+func newHTTPClient(cfg *Config) (*httpClient, error) {
+	baseURL := strings.TrimSuffix(cfg.Endpoint, "/")
+	if !strings.Contains(baseURL, "://") {
+		scheme := "https://"
+		if cfg.Insecure {
+			scheme = "http://"
+		}
+		baseURL = scheme + baseURL
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	return &httpClient{
+		client:  &http.Client{Transport: transport},
+		baseURL: baseURL,
+		headers: cfg.Headers,
+	}, nil
+}
+
+func (c *httpClient) exportLogs(ctx context.Context, req *collectorlogs.ExportLogsServiceRequest) error {
+	resp := &collectorlogs.ExportLogsServiceResponse{}
+	if err := c.post(ctx, LogsPath, req, resp); err != nil {
+		return errors.Wrap(err, "failed to export logs")
+	}
+	if rejected := resp.GetPartialSuccess().GetRejectedLogRecords(); rejected > 0 {
+		return errors.Wrapf(ErrPartialSuccess, "%d log records rejected: %s", rejected, resp.GetPartialSuccess().GetErrorMessage())
+	}
+	return nil
+}
+
+func (c *httpClient) exportMetrics(ctx context.Context, req *collectormetrics.ExportMetricsServiceRequest) error {
+	resp := &collectormetrics.ExportMetricsServiceResponse{}
+	if err := c.post(ctx, MetricsPath, req, resp); err != nil {
+		return errors.Wrap(err, "failed to export metrics")
+	}
+	if rejected := resp.GetPartialSuccess().GetRejectedDataPoints(); rejected > 0 {
+		return errors.Wrapf(ErrPartialSuccess, "%d data points rejected: %s", rejected, resp.GetPartialSuccess().GetErrorMessage())
+	}
+	return nil
+}
+
+func (c *httpClient) exportTraces(ctx context.Context, req *collectortrace.ExportTraceServiceRequest) error {
+	resp := &collectortrace.ExportTraceServiceResponse{}
+	if err := c.post(ctx, TracesPath, req, resp); err != nil {
+		return errors.Wrap(err, "failed to export spans")
+	}
+	if rejected := resp.GetPartialSuccess().GetRejectedSpans(); rejected > 0 {
+		return errors.Wrapf(ErrPartialSuccess, "%d spans rejected: %s", rejected, resp.GetPartialSuccess().GetErrorMessage())
+	}
+	return nil
+}
+
+// post sends the request to the path and decodes the response into out.
+func (c *httpClient) post(ctx context.Context, path string, in, out proto.Message) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal export request")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create export request")
+	}
+	req.Header.Set("Content-Type", protobufContentType)
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to send export request")
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to read export response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Wrapf(ErrExportFailed, "%s %s: %s", path, resp.Status, respBody)
+	}
+	// collectors may acknowledge with an empty body, which decodes to a full success
+	return errors.Wrap(proto.Unmarshal(respBody, out), "failed to decode export response")
+}
+
+func (c *httpClient) close() error {
+	c.client.CloseIdleConnections()
+	return nil
+}
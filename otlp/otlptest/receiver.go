@@ -0,0 +1,220 @@
+// Package otlptest provides a local OTLP receiver for tests, which accepts OTLP/gRPC and OTLP/HTTP exports and
+// records them.
+package otlptest
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	collectorlogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// Receiver is a local OTLP collector. It listens for OTLP/gRPC on GRPCEndpoint and for OTLP/HTTP on HTTPEndpoint.
+type Receiver struct {
+	GRPCEndpoint string
+	HTTPEndpoint string
+
+	mu       sync.Mutex
+	logs     []*logspb.ResourceLogs
+	metrics  []*metricspb.ResourceMetrics
+	spans    []*tracepb.ResourceSpans
+	headers  []map[string]string
+	failWith int
+}
+
+// NewReceiver starts a Receiver which is stopped when the test ends.
+func NewReceiver(t testing.TB) *Receiver {
+	t.Helper()
+	r := &Receiver{}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen for OTLP/gRPC: %v", err)
+	}
+	srv := grpc.NewServer()
+	collectorlogs.RegisterLogsServiceServer(srv, &logsServer{r: r})
+	collectormetrics.RegisterMetricsServiceServer(srv, &metricsServer{r: r})
+	collectortrace.RegisterTraceServiceServer(srv, &traceServer{r: r})
+	go srv.Serve(lis) //nolint:errcheck // stopped at cleanup
+	t.Cleanup(srv.Stop)
+	r.GRPCEndpoint = lis.Addr().String()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/logs", r.handle(&collectorlogs.ExportLogsServiceRequest{}, &collectorlogs.ExportLogsServiceResponse{}))
+	mux.HandleFunc("/v1/metrics", r.handle(&collectormetrics.ExportMetricsServiceRequest{}, &collectormetrics.ExportMetricsServiceResponse{}))
+	mux.HandleFunc("/v1/traces", r.handle(&collectortrace.ExportTraceServiceRequest{}, &collectortrace.ExportTraceServiceResponse{}))
+	hs := httptest.NewServer(mux)
+	t.Cleanup(hs.Close)
+	r.HTTPEndpoint = hs.URL
+	return r
+}
+
+// FailWith makes the OTLP/HTTP endpoint respond with the status code, or succeed again if it's zero.
+func (r *Receiver) FailWith(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failWith = status
+}
+
+// LogRecords returns the log records received so far.
+func (r *Receiver) LogRecords() []*logspb.LogRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*logspb.LogRecord
+	for _, rl := range r.logs {
+		for _, sl := range rl.GetScopeLogs() {
+			out = append(out, sl.GetLogRecords()...)
+		}
+	}
+	return out
+}
+
+// Metrics returns the metrics received so far.
+func (r *Receiver) Metrics() []*metricspb.Metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*metricspb.Metric
+	for _, rm := range r.metrics {
+		for _, sm := range rm.GetScopeMetrics() {
+			out = append(out, sm.GetMetrics()...)
+		}
+	}
+	return out
+}
+
+// Spans returns the spans received so far.
+func (r *Receiver) Spans() []*tracepb.Span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*tracepb.Span
+	for _, rs := range r.spans {
+		for _, ss := range rs.GetScopeSpans() {
+			out = append(out, ss.GetSpans()...)
+		}
+	}
+	return out
+}
+
+// Resources returns the resources of every export received so far.
+func (r *Receiver) Resources() []*resourcepb.Resource {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*resourcepb.Resource
+	for _, rl := range r.logs {
+		out = append(out, rl.GetResource())
+	}
+	for _, rm := range r.metrics {
+		out = append(out, rm.GetResource())
+	}
+	for _, rs := range r.spans {
+		out = append(out, rs.GetResource())
+	}
+	return out
+}
+
+// Headers returns the headers, or gRPC metadata, of every export received so far.
+func (r *Receiver) Headers() []map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]map[string]string{}, r.headers...)
+}
+
+func (r *Receiver) record(req proto.Message, headers map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.headers = append(r.headers, headers)
+	switch req := req.(type) {
+	case *collectorlogs.ExportLogsServiceRequest:
+		r.logs = append(r.logs, req.GetResourceLogs()...)
+	case *collectormetrics.ExportMetricsServiceRequest:
+		r.metrics = append(r.metrics, req.GetResourceMetrics()...)
+	case *collectortrace.ExportTraceServiceRequest:
+		r.spans = append(r.spans, req.GetResourceSpans()...)
+	}
+}
+
+// handle serves an OTLP/HTTP signal. req and resp are the prototypes of the signal's messages.
+func (r *Receiver) handle(req, resp proto.Message) http.HandlerFunc {
+	return func(w http.ResponseWriter, hr *http.Request) {
+		r.mu.Lock()
+		failWith := r.failWith
+		r.mu.Unlock()
+		if failWith != 0 {
+			w.WriteHeader(failWith)
+			return
+		}
+		body, err := io.ReadAll(hr.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		msg := req.ProtoReflect().New().Interface()
+		if err := proto.Unmarshal(body, msg); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		headers := map[string]string{}
+		for k := range hr.Header {
+			headers[k] = hr.Header.Get(k)
+		}
+		r.record(msg, headers)
+		out, _ := proto.Marshal(resp)
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		_, _ = w.Write(out)
+	}
+}
+
+func incomingHeaders(ctx context.Context) map[string]string {
+	headers := map[string]string{}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for k, v := range md {
+		if len(v) > 0 {
+			headers[k] = v[0]
+		}
+	}
+	return headers
+}
+
+type logsServer struct {
+	collectorlogs.UnimplementedLogsServiceServer
+	r *Receiver
+}
+
+func (s *logsServer) Export(ctx context.Context, req *collectorlogs.ExportLogsServiceRequest) (*collectorlogs.ExportLogsServiceResponse, error) {
+	s.r.record(req, incomingHeaders(ctx))
+	return &collectorlogs.ExportLogsServiceResponse{}, nil
+}
+
+type metricsServer struct {
+	collectormetrics.UnimplementedMetricsServiceServer
+	r *Receiver
+}
+
+func (s *metricsServer) Export(ctx context.Context, req *collectormetrics.ExportMetricsServiceRequest) (*collectormetrics.ExportMetricsServiceResponse, error) {
+	s.r.record(req, incomingHeaders(ctx))
+	return &collectormetrics.ExportMetricsServiceResponse{}, nil
+}
+
+type traceServer struct {
+	collectortrace.UnimplementedTraceServiceServer
+	r *Receiver
+}
+
+func (s *traceServer) Export(ctx context.Context, req *collectortrace.ExportTraceServiceRequest) (*collectortrace.ExportTraceServiceResponse, error) {
+	s.r.record(req, incomingHeaders(ctx))
+	return &collectortrace.ExportTraceServiceResponse{}, nil
+}
@@ -0,0 +1,101 @@
+package telemetry
+
+import (
+	"sync"
+	"time"
+)
+
+// CNI operation phases
+const (
+	PhaseIPAM      = "ipam"
+	PhaseNetNS     = "netns"
+	PhaseStateSave = "state_save"
+)
+
+// CNIOperation is a structured record of a single CNI invocation. Unlike CNIReport it carries no
+// free-form text so that long-lived consumers can aggregate it into metrics.
+type CNIOperation struct {
+	Command string
+	Mode    string
+	// ResultCode is the CNI error code returned to the runtime, 0 on success
+	ResultCode int
+	// ErrorCode is the errcode.Code of the error, empty on success or if the error isn't classified
+	ErrorCode string `json:",omitempty"`
+	// FailedPhase is the phase which returned the error, empty on success or if the error happened
+	// outside of a timed phase
+	FailedPhase     string `json:",omitempty"`
+	DurationSeconds float64
+	PhaseSeconds    map[string]float64
+}
+
+// OperationRecord wraps a CNIOperation on the telemetry socket.
+type OperationRecord struct {
+	Operation CNIOperation
+}
+
+// OperationTimer times a CNI invocation and its phases.
+type OperationTimer struct {
+	mu    sync.Mutex
+	start time.Time
+	op    CNIOperation
+}
+
+func NewOperationTimer(command, mode string) *OperationTimer {
+	return &OperationTimer{
+		start: time.Now(),
+		op: CNIOperation{
+			Command:      command,
+			Mode:         mode,
+			PhaseSeconds: map[string]float64{},
+		},
+	}
+}
+
+// SetMode sets the network mode once it is known, the timer is usually started before the network
+// config is parsed.
+func (t *OperationTimer) SetMode(mode string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.op.Mode = mode
+}
+
+// StartPhase starts timing the phase. The returned func stops the timer and marks the phase as
+// failed if err is not nil. Phases which run more than once are accumulated.
+func (t *OperationTimer) StartPhase(phase string) func(err error) {
+	start := time.Now()
+	return func(err error) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.op.PhaseSeconds[phase] += time.Since(start).Seconds()
+		if err != nil && t.op.FailedPhase == "" {
+			t.op.FailedPhase = phase
+		}
+	}
+}
+
+// Finish returns the record of the invocation.
+func (t *OperationTimer) Finish(resultCode int) *CNIOperation {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	op := t.op
+	op.ResultCode = resultCode
+	op.DurationSeconds = time.Since(t.start).Seconds()
+	op.PhaseSeconds = make(map[string]float64, len(t.op.PhaseSeconds))
+	for phase, seconds := range t.op.PhaseSeconds {
+		op.PhaseSeconds[phase] = seconds
+	}
+	return &op
+}
+
+// SendCNIOperation writes the operation record to the telemetry socket
+func SendCNIOperation(tb *TelemetryBuffer, op *CNIOperation) error {
+	if tb == nil {
+		return nil
+	}
+	reportMgr := &ReportManager{Report: &OperationRecord{Operation: *op}}
+	report, err := reportMgr.ReportToBytes()
+	if err != nil {
+		return err
+	}
+	return tb.send(report)
+}
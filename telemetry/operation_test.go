@@ -0,0 +1,48 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperationTimer(t *testing.T) {
+	timer := NewOperationTimer("ADD", "")
+	timer.SetMode("transparent")
+
+	timer.StartPhase(PhaseIPAM)(nil)
+	stopSave := timer.StartPhase(PhaseStateSave)
+	stopNetNS := timer.StartPhase(PhaseNetNS)
+	stopNetNS(errors.New("netns failed"))
+	stopSave(errors.New("save failed"))
+
+	op := timer.Finish(100)
+	require.Equal(t, "ADD", op.Command)
+	require.Equal(t, "transparent", op.Mode)
+	require.Equal(t, 100, op.ResultCode)
+	// the first phase to fail is reported
+	require.Equal(t, PhaseNetNS, op.FailedPhase)
+	require.Len(t, op.PhaseSeconds, 3)
+	require.GreaterOrEqual(t, op.DurationSeconds, op.PhaseSeconds[PhaseIPAM])
+
+	// the record is a snapshot
+	timer.StartPhase("other")(nil)
+	require.Len(t, op.PhaseSeconds, 3)
+}
+
+func TestOperationRecordToBytes(t *testing.T) {
+	reportMgr := &ReportManager{Report: &OperationRecord{Operation: CNIOperation{Command: "DEL", PhaseSeconds: map[string]float64{PhaseIPAM: 0.5}}}}
+	b, err := reportMgr.ReportToBytes()
+	require.NoError(t, err)
+
+	var tmp map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &tmp))
+	require.Contains(t, tmp, "Operation")
+
+	var record OperationRecord
+	require.NoError(t, json.Unmarshal(b, &record))
+	require.Equal(t, "DEL", record.Operation.Command)
+	require.InDelta(t, 0.5, record.Operation.PhaseSeconds[PhaseIPAM], 0)
+}
@@ -0,0 +1,48 @@
+package telemetry
+
+import (
+	"context"
+
+	"github.com/Azure/azure-container-networking/tracing"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// SpanRecord wraps the spans of a CNI invocation on the telemetry socket.
+type SpanRecord struct {
+	Spans []tracing.SpanData
+}
+
+// SendSpans writes the spans to the telemetry socket
+func SendSpans(tb *TelemetryBuffer, spans []tracing.SpanData) error {
+	if tb == nil || len(spans) == 0 {
+		return nil
+	}
+	reportMgr := &ReportManager{Report: &SpanRecord{Spans: spans}}
+	report, err := reportMgr.ReportToBytes()
+	if err != nil {
+		return err
+	}
+	return tb.send(report)
+}
+
+// spanExporter exports the spans of CNI to the telemetry service, which exports them if it's configured to.
+type spanExporter struct {
+	c *Client
+}
+
+// SpanExporter returns an exporter which sends spans to the telemetry service the client is connected to.
+func (c *Client) SpanExporter() sdktrace.SpanExporter {
+	return spanExporter{c: c}
+}
+
+func (e spanExporter) ExportSpans(_ context.Context, spans []sdktrace.ReadOnlySpan) error {
+	data := make([]tracing.SpanData, 0, len(spans))
+	for _, s := range spans {
+		data = append(data, tracing.NewSpanData(s))
+	}
+	return SendSpans(e.c.tb, data)
+}
+
+func (spanExporter) Shutdown(context.Context) error {
+	return nil
+}
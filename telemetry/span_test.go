@@ -0,0 +1,33 @@
+package telemetry
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-container-networking/aitelemetry/spool"
+	"github.com/Azure/azure-container-networking/tracing"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestSpansAreHandledByTheService(t *testing.T) {
+	spoolDir := t.TempDir()
+
+	cni := NewTelemetryBuffer(zap.NewNop())
+	require.NoError(t, cni.EnableSpool(spool.Config{Dir: spoolDir}))
+	spans := []tracing.SpanData{
+		{Name: "CNI ADD", TraceID: "0af7651916cd43dd8448eb211c80319c", SpanID: "b7ad6b7169203331"},
+		{Name: "POST /network/requestipconfigs", TraceID: "0af7651916cd43dd8448eb211c80319c", SpanID: "00f067aa0ba902b7", ParentSpanID: "b7ad6b7169203331"},
+	}
+	require.NoError(t, SendSpans(cni, spans))
+	require.NoError(t, SendSpans(cni, nil))
+	require.Equal(t, uint64(1), cni.SpoolStats().Spooled)
+
+	service := NewTelemetryBuffer(zap.NewNop())
+	require.NoError(t, service.EnableSpool(spool.Config{Dir: spoolDir}))
+	var got []tracing.SpanData
+	service.SetSpanHandler(func(spans []tracing.SpanData) {
+		got = append(got, spans...)
+	})
+	service.replaySpool()
+	require.Equal(t, spans, got)
+}
@@ -106,10 +106,10 @@ func (reportMgr *ReportManager) SendReport(tb *TelemetryBuffer) error {
 	var err error
 	var report []byte
 
-	if tb != nil && tb.Connected {
+	if tb != nil {
 		report, err = reportMgr.ReportToBytes()
 		if err == nil {
-			if _, err = tb.Write(report); err != nil {
+			if err = tb.send(report); err != nil {
 				if tb.logger != nil {
 					tb.logger.Error("telemetry write failed", zap.Error(err))
 				} else {
@@ -127,6 +127,8 @@ func (reportMgr *ReportManager) ReportToBytes() ([]byte, error) {
 	switch reportMgr.Report.(type) {
 	case *CNIReport:
 	case *AIMetric:
+	case *OperationRecord:
+	case *SpanRecord:
 	default:
 		return []byte{}, errors.Errorf("Invalid report type: %T", reportMgr.Report)
 	}
@@ -140,11 +142,11 @@ func SendCNIMetric(cniMetric *AIMetric, tb *TelemetryBuffer) error {
 	var err error
 	var report []byte
 
-	if tb != nil && tb.Connected {
+	if tb != nil {
 		reportMgr := &ReportManager{Report: cniMetric}
 		report, err = reportMgr.ReportToBytes()
 		if err == nil {
-			if _, err = tb.Write(report); err != nil {
+			if err = tb.send(report); err != nil {
 				tb.logger.Error("Error writing to telemetry socket", zap.Error(err))
 			}
 		}
@@ -154,11 +156,11 @@ func SendCNIMetric(cniMetric *AIMetric, tb *TelemetryBuffer) error {
 }
 
 func SendCNIEvent(tb *TelemetryBuffer, report *CNIReport) {
-	if tb != nil && tb.Connected {
+	if tb != nil {
 		reportMgr := &ReportManager{Report: report}
 		reportBytes, err := reportMgr.ReportToBytes()
 		if err == nil {
-			if _, err = tb.Write(reportBytes); err != nil {
+			if err = tb.send(reportBytes); err != nil {
 				tb.logger.Error("Error writing to telemetry socket", zap.Error(err))
 			}
 		}
@@ -6,6 +6,7 @@ import (
 	"sync"
 
 	"github.com/Azure/azure-container-networking/aitelemetry"
+	"github.com/Azure/azure-container-networking/aitelemetry/spool"
 	"go.uber.org/zap"
 )
 
@@ -48,12 +49,22 @@ func (c *Client) ConnectTelemetry(logger *zap.Logger) {
 	c.tb = NewTelemetryBuffer(logger)
 	c.tb.ConnectToTelemetry()
 	c.logger = logger
+	c.enableSpool()
 }
 
 func (c *Client) StartAndConnectTelemetry(logger *zap.Logger) {
 	c.tb = NewTelemetryBuffer(logger)
 	c.tb.ConnectToTelemetryService(telemetryNumberRetries, telemetryWaitTimeInMilliseconds)
 	c.logger = logger
+	c.enableSpool()
+}
+
+// enableSpool spools telemetry to disk when the telemetry service can't be reached, so that it is sent once the
+// telemetry service is running again instead of being lost
+func (c *Client) enableSpool() {
+	if err := c.tb.EnableSpool(spool.Config{Dir: CNISpoolDir}); err != nil {
+		c.sendLog("Couldn't enable telemetry spool: " + err.Error())
+	}
 }
 
 func (c *Client) DisconnectTelemetry() {
@@ -111,3 +122,13 @@ func (c *Client) SendMetric(name string, value float64, customDims map[string]st
 		c.sendLog("Couldn't send metric: " + err.Error())
 	}
 }
+
+// SendOperation sends the structured record of a CNI invocation
+func (c *Client) SendOperation(op *CNIOperation) {
+	if c.tb == nil {
+		return
+	}
+	if err := SendCNIOperation(c.tb, op); err != nil {
+		c.sendLog("Couldn't send operation: " + err.Error())
+	}
+}
@@ -14,9 +14,13 @@ import (
 	"sync"
 	"time"
 
+	"github.com/Azure/azure-container-networking/aitelemetry/spool"
 	"github.com/Azure/azure-container-networking/common"
 	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/otlp"
 	"github.com/Azure/azure-container-networking/platform"
+	"github.com/Azure/azure-container-networking/tracing"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
@@ -34,6 +38,11 @@ type TelemetryConfig struct {
 	BatchSizeInBytes              int
 	GetEnvRetryCount              int
 	GetEnvRetryWaitTimeInSecs     int
+	// SpoolDir holds telemetry on disk while AppInsights is unreachable. Spooling is disabled if it's empty.
+	SpoolDir            string
+	SpoolMaxSizeInBytes int64
+	// OTLP, if set, mirrors the telemetry to an OpenTelemetry collector
+	OTLP *otlp.Config
 }
 
 // FdName - file descriptor name
@@ -44,6 +53,8 @@ const (
 	Delimiter      = '\n'
 	MaxPayloadSize = 4096
 	MaxNumReports  = 1000
+	// spoolReplayInterval is how often the telemetry service replays the reports which CNI spooled
+	spoolReplayInterval = 30 * time.Second
 )
 
 // TelemetryBuffer object
@@ -58,6 +69,12 @@ type TelemetryBuffer struct {
 	mutex       sync.Mutex
 	logger      *zap.Logger
 	plc         platform.ExecClient
+	// operationHandler receives CNI operation records, they are dropped if it is not set
+	operationHandler func(CNIOperation)
+	// spanHandler receives the spans recorded by CNI, they are dropped if it is not set
+	spanHandler func([]tracing.SpanData)
+	// spool holds reports which could not be written to the telemetry service. The telemetry service replays it.
+	spool *spool.Spool
 }
 
 // Buffer object holds the different types of reports
@@ -144,8 +161,7 @@ func (tb *TelemetryBuffer) StartServer() error {
 						}
 						reportStr = reportStr[:len(reportStr)-1]
 
-						var tmp map[string]interface{}
-						err = json.Unmarshal(reportStr, &tmp)
+						report, err := decodeReport(reportStr)
 						if err != nil {
 							if tb.logger != nil {
 								tb.logger.Error("StartServer: unmarshal error", zap.Error(err))
@@ -154,27 +170,15 @@ func (tb *TelemetryBuffer) StartServer() error {
 							}
 							return
 						}
-						if _, ok := tmp["CniSucceeded"]; ok {
-							var cniReport CNIReport
-							err = json.Unmarshal([]byte(reportStr), &cniReport)
-							if err != nil {
-								return
-							}
-							tb.data <- cniReport
-						} else if _, ok := tmp["Metric"]; ok {
-							var aiMetric AIMetric
-							err = json.Unmarshal([]byte(reportStr), &aiMetric)
-							if err != nil {
-								return
-							}
-							tb.data <- aiMetric
-						} else {
+						if report == nil {
 							if tb.logger != nil {
-								tb.logger.Info("StartServer: default", zap.Any("case", tmp))
+								tb.logger.Info("StartServer: default", zap.ByteString("case", reportStr))
 							} else {
-								log.Logf("StartServer: default case:%+v...", tmp)
+								log.Logf("StartServer: default case:%s...", reportStr)
 							}
+							continue
 						}
+						tb.data <- report
 					}
 				}()
 			} else {
@@ -191,6 +195,32 @@ func (tb *TelemetryBuffer) StartServer() error {
 	return nil
 }
 
+// decodeReport decodes a report written by CNI. It returns nil for a report of an unknown type.
+func decodeReport(reportStr []byte) (interface{}, error) {
+	var tmp map[string]interface{}
+	if err := json.Unmarshal(reportStr, &tmp); err != nil {
+		return nil, err //nolint:wrapcheck // logged by the caller
+	}
+	if _, ok := tmp["CniSucceeded"]; ok {
+		var cniReport CNIReport
+		err := json.Unmarshal(reportStr, &cniReport)
+		return cniReport, err //nolint:wrapcheck // logged by the caller
+	} else if _, ok := tmp["Metric"]; ok {
+		var aiMetric AIMetric
+		err := json.Unmarshal(reportStr, &aiMetric)
+		return aiMetric, err //nolint:wrapcheck // logged by the caller
+	} else if _, ok := tmp["Operation"]; ok {
+		var record OperationRecord
+		err := json.Unmarshal(reportStr, &record)
+		return record, err //nolint:wrapcheck // logged by the caller
+	} else if _, ok := tmp["Spans"]; ok {
+		var record SpanRecord
+		err := json.Unmarshal(reportStr, &record)
+		return record, err //nolint:wrapcheck // logged by the caller
+	}
+	return nil, nil
+}
+
 func (tb *TelemetryBuffer) Connect() error {
 	err := tb.Dial(FdName)
 	if err == nil {
@@ -202,16 +232,32 @@ func (tb *TelemetryBuffer) Connect() error {
 	return err
 }
 
+// SetOperationHandler - set the handler called by PushData for each CNI operation record. Must be
+// called before PushData.
+func (tb *TelemetryBuffer) SetOperationHandler(handler func(CNIOperation)) {
+	tb.operationHandler = handler
+}
+
+// SetSpanHandler - set the handler called by PushData for the spans recorded by CNI. Must be called
+// before PushData.
+func (tb *TelemetryBuffer) SetSpanHandler(handler func([]tracing.SpanData)) {
+	tb.spanHandler = handler
+}
+
 // PushData - PushData running an instance if it isn't already being run elsewhere
 func (tb *TelemetryBuffer) PushData(ctx context.Context) {
 	defer tb.Close()
 
+	replayTicker := time.NewTicker(spoolReplayInterval)
+	defer replayTicker.Stop()
+	tb.replaySpool()
+
 	for {
 		select {
 		case report := <-tb.data:
-			tb.mutex.Lock()
-			push(report)
-			tb.mutex.Unlock()
+			tb.handleReport(report)
+		case <-replayTicker.C:
+			tb.replaySpool()
 		case <-tb.cancel:
 			if tb.logger != nil {
 				tb.logger.Info("server cancel event")
@@ -230,6 +276,78 @@ func (tb *TelemetryBuffer) PushData(ctx context.Context) {
 	}
 }
 
+func (tb *TelemetryBuffer) handleReport(report interface{}) {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+	switch record := report.(type) {
+	case OperationRecord:
+		if tb.operationHandler != nil {
+			tb.operationHandler(record.Operation)
+		}
+	case SpanRecord:
+		if tb.spanHandler != nil {
+			tb.spanHandler(record.Spans)
+		}
+	default:
+		push(report)
+	}
+}
+
+// EnableSpool spools reports to disk when they can't be written to the telemetry service, so that the telemetry
+// service can replay them once it's running. The telemetry service must enable the same spool to replay it.
+func (tb *TelemetryBuffer) EnableSpool(cfg spool.Config) error {
+	s, err := spool.New(cfg)
+	if err != nil {
+		return errors.Wrap(err, "failed to open telemetry spool")
+	}
+	tb.spool = s
+	return nil
+}
+
+// SpoolStats returns the counters of the spool, which are zero if it isn't enabled.
+func (tb *TelemetryBuffer) SpoolStats() spool.Stats {
+	if tb.spool == nil {
+		return spool.Stats{}
+	}
+	return tb.spool.Stats()
+}
+
+// send writes a report to the telemetry service, or spools it if the telemetry service can't be reached.
+func (tb *TelemetryBuffer) send(report []byte) error {
+	if tb.Connected {
+		_, err := tb.Write(report)
+		if err == nil || tb.spool == nil {
+			return err
+		}
+	}
+	if tb.spool == nil {
+		return nil
+	}
+	return errors.Wrap(tb.spool.Append(report), "failed to spool report")
+}
+
+// replaySpool handles the reports which CNI spooled while the telemetry service wasn't running.
+func (tb *TelemetryBuffer) replaySpool() {
+	if tb.spool == nil {
+		return
+	}
+	err := tb.spool.Replay(func(reportStr []byte) error {
+		report, err := decodeReport(reportStr)
+		if err != nil || report == nil {
+			return errors.Wrapf(spool.ErrDiscard, "undecodable report: %v", err)
+		}
+		tb.handleReport(report)
+		return nil
+	})
+	if err != nil {
+		if tb.logger != nil {
+			tb.logger.Error("Failed to replay telemetry spool", zap.Error(err))
+		} else {
+			log.Logf("[Telemetry] Failed to replay telemetry spool: %v", err)
+		}
+	}
+}
+
 // Write - write to the file descriptor.
 func (tb *TelemetryBuffer) Write(b []byte) (c int, err error) {
 	buf := make([]byte, len(b))
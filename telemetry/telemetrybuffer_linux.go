@@ -14,6 +14,10 @@ const (
 	TelemetryServiceProcessName = "azure-vnet-telemetry"
 	CniInstallDir               = "/opt/cni/bin"
 	metadataFile                = "/tmp/azuremetadata.json"
+	// CNISpoolDir holds the reports of CNI while the telemetry service is unreachable
+	CNISpoolDir = "/var/run/azure-vnet/telemetry/cni-spool"
+	// AISpoolDir holds the telemetry of the telemetry service while AppInsights is unreachable
+	AISpoolDir = "/var/run/azure-vnet/telemetry/ai-spool"
 )
 
 // Dial - try to connect to/create a socket with 'name'
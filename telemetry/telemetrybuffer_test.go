@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Azure/azure-container-networking/aitelemetry/spool"
 	"github.com/Azure/azure-container-networking/cni/log"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
@@ -207,3 +208,32 @@ func TestExtraneousClose(_ *testing.T) {
 	tb.Close()
 	tb.Close()
 }
+
+// TestSpoolWhileServiceUnreachable checks that CNI spools operations while the telemetry service isn't running, and
+// that the telemetry service replays them in order once it starts
+func TestSpoolWhileServiceUnreachable(t *testing.T) {
+	spoolDir := t.TempDir()
+
+	cni := NewTelemetryBuffer(zap.NewNop())
+	require.NoError(t, cni.EnableSpool(spool.Config{Dir: spoolDir}))
+	require.False(t, cni.Connected)
+	for _, command := range []string{"ADD", "DEL", "CHECK"} {
+		require.NoError(t, SendCNIOperation(cni, &CNIOperation{Command: command}))
+	}
+	require.Equal(t, uint64(3), cni.SpoolStats().Spooled)
+
+	service := NewTelemetryBuffer(zap.NewNop())
+	require.NoError(t, service.EnableSpool(spool.Config{Dir: spoolDir}))
+	var got []string
+	service.SetOperationHandler(func(op CNIOperation) {
+		got = append(got, op.Command)
+	})
+	service.replaySpool()
+
+	require.Equal(t, []string{"ADD", "DEL", "CHECK"}, got)
+	require.Equal(t, uint64(3), service.SpoolStats().Replayed)
+
+	// the spool is drained, so nothing is replayed twice
+	service.replaySpool()
+	require.Len(t, got, 3)
+}
@@ -15,6 +15,10 @@ const (
 	TelemetryServiceProcessName = "azure-vnet-telemetry.exe"
 	CniInstallDir               = "c:\\k\\azurecni\\bin"
 	metadataFile                = "azuremetadata.json"
+	// CNISpoolDir holds the reports of CNI while the telemetry service is unreachable
+	CNISpoolDir = "c:\\k\\azurecni\\telemetry\\cni-spool"
+	// AISpoolDir holds the telemetry of the telemetry service while AppInsights is unreachable
+	AISpoolDir = "c:\\k\\azurecni\\telemetry\\ai-spool"
 )
 
 // Dial - try to connect to a named pipe with 'name'
@@ -0,0 +1,55 @@
+// fabricemulator serves an emulated wireserver, NMAgent, and IMDS for running CNS without an Azure VM.
+// Point CNS at it by setting WireserverIP to the listen address and IMDSEndpoint to http://<listen address>.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Azure/azure-container-networking/test/fabricemulator"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "address to listen on")
+	statePath := flag.String("state", "", "path to a JSON file with the initial state. Defaults to a VM with one interface")
+	flag.Parse()
+
+	state := fabricemulator.DefaultState()
+	if *statePath != "" {
+		var err error
+		if state, err = fabricemulator.LoadState(*statePath); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load state: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           fabricemulator.New(state),
+		ReadHeaderTimeout: shutdownTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Printf("starting fabric emulator on %s. admin API at %s\n", *addr, fabricemulator.AdminPathPrefix)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "server failed: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,186 @@
+// Package fabricemulator emulates the fabric endpoints which CNS talks to from inside an Azure VM:
+// NMAgent through the wireserver plugin path (168.63.129.16/machine/plugins) and IMDS (169.254.169.254/metadata).
+// Unlike canned responses, the emulator keeps the state of a VM, so joining a network, putting an NC,
+// and then querying NC versions behaves like it does on a real VM. Faults such as latency, server errors,
+// and stale NC versions can be injected while it runs.
+//
+// The emulator serves both wireserver and IMDS paths from a single http.Handler, so CNS can be pointed at it
+// by setting WireserverIP and IMDSEndpoint in its config to the emulator's address.
+package fabricemulator
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	wireserverPluginPath = "/machine/plugins"
+	imdsPathPrefix       = "/metadata/"
+	// AdminPathPrefix is the path of the admin API, which reads and replaces the emulator's state and faults
+	AdminPathPrefix = "/fabricemulator/"
+
+	adminStatePath  = AdminPathPrefix + "state"
+	adminFaultsPath = AdminPathPrefix + "faults"
+)
+
+// Emulator is an http.Handler which serves wireserver, NMAgent, and IMDS requests from its State.
+type Emulator struct {
+	sync.Mutex
+	state State
+	rand  *rand.Rand
+	mux   *http.ServeMux
+	// sleep is replaceable so that tests don't wait for latency faults
+	sleep func(time.Duration)
+}
+
+// New returns an Emulator with the given initial state.
+func New(state State) *Emulator {
+	e := &Emulator{
+		state: state.copy(),
+		//nolint:gosec // fault injection doesn't need a secure random source
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+		mux:   http.NewServeMux(),
+		sleep: time.Sleep,
+	}
+	if e.state.NetworkContainers == nil {
+		e.state.NetworkContainers = make(map[string]*NetworkContainer)
+	}
+	e.mux.HandleFunc(wireserverPluginPath, e.withFaults(e.serveWireserverPlugin))
+	e.mux.HandleFunc(wireserverPluginPath+"/", e.withFaults(e.serveWireserverPlugin))
+	e.mux.HandleFunc(imdsPathPrefix, e.withFaults(e.serveIMDS))
+	e.mux.HandleFunc(adminStatePath, e.serveAdminState)
+	e.mux.HandleFunc(adminFaultsPath, e.serveAdminFaults)
+	return e
+}
+
+func (e *Emulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mux.ServeHTTP(w, r)
+}
+
+// State returns a copy of the current state.
+func (e *Emulator) State() State {
+	e.Lock()
+	defer e.Unlock()
+	return e.state.copy()
+}
+
+// SetState replaces the state, including faults.
+func (e *Emulator) SetState(state State) {
+	e.Lock()
+	defer e.Unlock()
+	e.state = state.copy()
+	if e.state.NetworkContainers == nil {
+		e.state.NetworkContainers = make(map[string]*NetworkContainer)
+	}
+}
+
+// SetFaults replaces the injected faults. Clearing StaleVersions programs the goal version of every NC.
+func (e *Emulator) SetFaults(faults Faults) {
+	e.Lock()
+	defer e.Unlock()
+	e.state.Faults = faults
+	if !faults.StaleVersions {
+		for _, nc := range e.state.NetworkContainers {
+			nc.Version = nc.GoalVersion
+		}
+	}
+}
+
+// withFaults injects latency and server errors before the handler runs.
+func (e *Emulator) withFaults(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		e.Lock()
+		faults := e.state.Faults
+		fail := false
+		if e.state.Faults.FailNext > 0 {
+			e.state.Faults.FailNext--
+			fail = true
+		} else if faults.ServerErrorRate > 0 && e.rand.Float64() < faults.ServerErrorRate {
+			fail = true
+		}
+		e.Unlock()
+
+		if faults.Latency > 0 {
+			e.sleep(time.Duration(faults.Latency))
+		}
+		if fail {
+			code := faults.ServerErrorCode
+			if code == 0 {
+				code = http.StatusInternalServerError
+			}
+			http.Error(w, "injected fault", code)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func (e *Emulator) serveAdminState(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, e.State())
+	case http.MethodPut:
+		var state State
+		if err := json.NewDecoder(r.Body).Decode(&state); err != nil {
+			http.Error(w, errors.Wrap(err, "failed to decode state").Error(), http.StatusBadRequest)
+			return
+		}
+		e.SetState(state)
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "expected GET or PUT", http.StatusMethodNotAllowed)
+	}
+}
+
+func (e *Emulator) serveAdminFaults(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, e.State().Faults)
+	case http.MethodPut:
+		var faults Faults
+		if err := json.NewDecoder(r.Body).Decode(&faults); err != nil {
+			http.Error(w, errors.Wrap(err, "failed to decode faults").Error(), http.StatusBadRequest)
+			return
+		}
+		e.SetFaults(faults)
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "expected GET or PUT", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// matchPath matches a slash-separated path against a pattern where "*" matches any single segment.
+// It returns the segments matched by wildcards.
+func matchPath(pattern, path string) ([]string, bool) {
+	patternParts := strings.Split(pattern, "/")
+	pathParts := strings.Split(path, "/")
+	if len(patternParts) != len(pathParts) {
+		return nil, false
+	}
+	var params []string
+	for i, part := range patternParts {
+		if part == "*" {
+			if pathParts[i] == "" {
+				return nil, false
+			}
+			params = append(params, pathParts[i])
+			continue
+		}
+		if !strings.EqualFold(part, pathParts[i]) {
+			return nil, false
+		}
+	}
+	return params, true
+}
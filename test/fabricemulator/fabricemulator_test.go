@@ -0,0 +1,319 @@
+package fabricemulator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/imds"
+	"github.com/Azure/azure-container-networking/cns/wireserver"
+	"github.com/Azure/azure-container-networking/nmagent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testVNetID     = "vnet-1"
+	testNCID       = "nc-1"
+	testAuthToken  = "token"
+	testPrimaryIP  = "10.240.0.4"
+	wrongAuthToken = "wrong"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Printf(string, ...any) {}
+
+func newTestServer(t *testing.T) (*Emulator, *httptest.Server) {
+	t.Helper()
+	e := New(DefaultState())
+	srv := httptest.NewServer(e)
+	t.Cleanup(srv.Close)
+	return e, srv
+}
+
+func newNMAgentClient(t *testing.T, srv *httptest.Server) *nmagent.Client {
+	t.Helper()
+	cfg, err := nmagent.NewConfig(srv.URL)
+	require.NoError(t, err)
+	client, err := nmagent.NewClient(cfg)
+	require.NoError(t, err)
+	return client
+}
+
+func putNCRequest(version uint64) *nmagent.PutNetworkContainerRequest {
+	return &nmagent.PutNetworkContainerRequest{
+		ID:                  testNCID,
+		VNetID:              testVNetID,
+		Version:             version,
+		SubnetName:          "subnet",
+		IPv4Addrs:           []string{"10.1.0.5"},
+		AuthenticationToken: testAuthToken,
+		PrimaryAddress:      testPrimaryIP,
+	}
+}
+
+func ncVersion(t *testing.T, client *nmagent.Client) string {
+	t.Helper()
+	v, err := client.GetNCVersion(context.Background(), nmagent.NCVersionRequest{
+		AuthToken:          testAuthToken,
+		NetworkContainerID: testNCID,
+		PrimaryAddress:     testPrimaryIP,
+	})
+	require.NoError(t, err)
+	return v.Version
+}
+
+func requireNMAgentStatus(t *testing.T, err error, code int) {
+	t.Helper()
+	var nmaErr nmagent.Error
+	require.True(t, errors.As(err, &nmaErr), "expected an nmagent error but got %v", err)
+	require.Equal(t, code, nmaErr.StatusCode())
+}
+
+func TestNCLifecycle(t *testing.T) {
+	e, srv := newTestServer(t)
+	client := newNMAgentClient(t, srv)
+	ctx := context.Background()
+
+	err := client.PutNetworkContainer(ctx, putNCRequest(1))
+	requireNMAgentStatus(t, err, http.StatusBadRequest)
+
+	require.NoError(t, client.JoinNetwork(ctx, nmagent.JoinNetworkRequest{NetworkID: testVNetID}))
+	require.NoError(t, client.PutNetworkContainer(ctx, putNCRequest(1)))
+	require.Equal(t, "1", ncVersion(t, client))
+
+	list, err := client.GetNCVersionList(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []nmagent.NCVersion{{NetworkContainerID: testNCID, Version: "1"}}, list.Containers)
+
+	// a different token can't read or replace the NC
+	_, err = client.GetNCVersion(ctx, nmagent.NCVersionRequest{AuthToken: wrongAuthToken, NetworkContainerID: testNCID, PrimaryAddress: testPrimaryIP})
+	requireNMAgentStatus(t, err, http.StatusUnauthorized)
+	wrongToken := putNCRequest(2)
+	wrongToken.AuthenticationToken = wrongAuthToken
+	requireNMAgentStatus(t, client.PutNetworkContainer(ctx, wrongToken), http.StatusUnauthorized)
+
+	require.NoError(t, client.DeleteNetworkContainer(ctx, nmagent.DeleteContainerRequest{
+		NCID:                testNCID,
+		PrimaryAddress:      testPrimaryIP,
+		AuthenticationToken: testAuthToken,
+	}))
+	_, err = client.GetNCVersion(ctx, nmagent.NCVersionRequest{AuthToken: testAuthToken, NetworkContainerID: testNCID, PrimaryAddress: testPrimaryIP})
+	requireNMAgentStatus(t, err, http.StatusNotFound)
+	require.Empty(t, e.State().NetworkContainers)
+}
+
+func TestPutNCOnUnknownInterface(t *testing.T) {
+	_, srv := newTestServer(t)
+	client := newNMAgentClient(t, srv)
+	ctx := context.Background()
+
+	require.NoError(t, client.JoinNetwork(ctx, nmagent.JoinNetworkRequest{NetworkID: testVNetID}))
+	req := putNCRequest(1)
+	req.PrimaryAddress = "10.240.0.100"
+	requireNMAgentStatus(t, client.PutNetworkContainer(ctx, req), http.StatusNotFound)
+}
+
+func TestStaleVersions(t *testing.T) {
+	e, srv := newTestServer(t)
+	client := newNMAgentClient(t, srv)
+	ctx := context.Background()
+
+	require.NoError(t, client.JoinNetwork(ctx, nmagent.JoinNetworkRequest{NetworkID: testVNetID}))
+	require.NoError(t, client.PutNetworkContainer(ctx, putNCRequest(1)))
+
+	e.SetFaults(Faults{StaleVersions: true})
+	require.NoError(t, client.PutNetworkContainer(ctx, putNCRequest(2)))
+	require.Equal(t, "1", ncVersion(t, client))
+	require.Equal(t, uint64(2), e.State().NetworkContainers[testNCID].GoalVersion)
+
+	e.SetFaults(Faults{})
+	require.Equal(t, "2", ncVersion(t, client))
+}
+
+func TestNetworkConfiguration(t *testing.T) {
+	state := DefaultState()
+	vnet := nmagent.VirtualNetwork{
+		CNetSpace:   "10.0.0.0/8",
+		VNetVersion: "12",
+		Subnets:     []nmagent.Subnet{{AddressPrefix: "10.1.0.0/16", SubnetName: "subnet"}},
+	}
+	state.VirtualNetworks = map[string]nmagent.VirtualNetwork{testVNetID: vnet}
+	e := New(state)
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+	client := newNMAgentClient(t, srv)
+	ctx := context.Background()
+
+	// not joined yet. The request is retried until the context expires.
+	shortCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	_, err := client.GetNetworkConfiguration(shortCtx, nmagent.GetNetworkConfigRequest{VNetID: testVNetID})
+	require.Error(t, err)
+
+	require.NoError(t, client.JoinNetwork(ctx, nmagent.JoinNetworkRequest{NetworkID: testVNetID}))
+	got, err := client.GetNetworkConfiguration(ctx, nmagent.GetNetworkConfigRequest{VNetID: testVNetID})
+	require.NoError(t, err)
+	require.Equal(t, vnet.Subnets, got.Subnets)
+	require.Equal(t, vnet.VNetVersion, got.VNetVersion)
+
+	require.NoError(t, client.DeleteNetwork(ctx, nmagent.DeleteNetworkRequest{NetworkID: testVNetID}))
+	require.Empty(t, e.State().JoinedNetworks)
+}
+
+func TestHomeAZAndSupportedAPIs(t *testing.T) {
+	_, srv := newTestServer(t)
+	client := newNMAgentClient(t, srv)
+	ctx := context.Background()
+
+	az, err := client.GetHomeAz(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint(1), az.HomeAz)
+	require.True(t, az.ContainsFixes(nmagent.HomeAZFixIPv6))
+
+	apis, err := client.SupportedAPIs(ctx)
+	require.NoError(t, err)
+	require.Equal(t, DefaultState().VM.SupportedAPIs, apis)
+}
+
+func TestInterfaces(t *testing.T) {
+	_, srv := newTestServer(t)
+	ctx := context.Background()
+
+	// through the NMAgent client
+	interfaces, err := newNMAgentClient(t, srv).GetInterfaceIPInfo(ctx)
+	require.NoError(t, err)
+	require.Len(t, interfaces.Entries, 1)
+	require.True(t, interfaces.Entries[0].IsPrimary)
+	require.Len(t, interfaces.Entries[0].InterfaceSubnets[0].IPAddress, 4)
+	require.True(t, interfaces.Entries[0].InterfaceSubnets[0].IPAddress[0].IsPrimary)
+
+	// through the CNS wireserver client
+	wsClient := &wireserver.Client{HostPort: srv.Listener.Addr().String(), HTTPClient: srv.Client(), Logger: nopLogger{}}
+	res, err := wsClient.GetInterfaces(ctx)
+	require.NoError(t, err)
+	require.Len(t, res.Interface, 1)
+	assert.Equal(t, "000D3A6E1234", res.Interface[0].MacAddress)
+	assert.Equal(t, "10.240.0.0/16", res.Interface[0].IPSubnet[0].Prefix)
+	assert.Equal(t, wireserver.Address{Address: testPrimaryIP, IsPrimary: true}, res.Interface[0].IPSubnet[0].IPAddress[0])
+	assert.Equal(t, wireserver.Address{Address: "10.240.0.7"}, res.Interface[0].IPSubnet[0].IPAddress[3])
+}
+
+func TestWireserverProxy(t *testing.T) {
+	e, srv := newTestServer(t)
+	proxy := &wireserver.Proxy{Host: srv.Listener.Addr().String(), HTTPClient: srv.Client()}
+	ctx := context.Background()
+	params := cns.NetworkContainerParameters{NCID: testNCID, AuthToken: testAuthToken, AssociatedInterfaceID: testPrimaryIP}
+
+	readStatus := func(resp *http.Response) string {
+		t.Helper()
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return body["httpStatusCode"]
+	}
+
+	resp, err := proxy.JoinNetwork(ctx, testVNetID)
+	require.NoError(t, err)
+	require.Equal(t, "200", readStatus(resp))
+
+	payload, err := json.Marshal(putNCRequest(3))
+	require.NoError(t, err)
+	resp, err = proxy.PublishNC(ctx, params, payload)
+	require.NoError(t, err)
+	require.Equal(t, "200", readStatus(resp))
+	require.Equal(t, uint64(3), e.State().NetworkContainers[testNCID].Version)
+
+	resp, err = proxy.UnpublishNC(ctx, params, nil)
+	require.NoError(t, err)
+	require.Equal(t, "200", readStatus(resp))
+	require.Empty(t, e.State().NetworkContainers)
+}
+
+func TestIMDS(t *testing.T) {
+	e, srv := newTestServer(t)
+	client := imds.NewClient(imds.Endpoint(srv.URL), imds.RetryAttempts(1))
+	ctx := context.Background()
+
+	vmID, err := client.GetVMUniqueID(ctx)
+	require.NoError(t, err)
+	require.Equal(t, DefaultState().VM.UniqueID, vmID)
+
+	state := e.State()
+	state.VM.Interfaces = append(state.VM.Interfaces, Interface{
+		MACAddress:    "00-0D-3A-6E-56-78",
+		CompartmentID: "nc-compartment",
+		Subnets:       []Subnet{{Prefix: "10.1.0.0/16", PrimaryIP: "10.1.0.4"}},
+	})
+	e.SetState(state)
+	interfaces, err := client.GetNetworkInterfaces(ctx)
+	require.NoError(t, err)
+	require.Len(t, interfaces, 2)
+	require.Equal(t, "00:0d:3a:6e:56:78", interfaces[1].MacAddress.String())
+	require.Equal(t, "nc-compartment", interfaces[1].InterfaceCompartmentID)
+
+	versions, err := client.GetIMDSVersions(ctx)
+	require.NoError(t, err)
+	require.Contains(t, versions.APIVersions, "2021-01-01")
+
+	// IMDS rejects requests without the Metadata header
+	resp, err := srv.Client().Get(srv.URL + "/metadata/instance/compute?api-version=2021-01-01")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestFaults(t *testing.T) {
+	e, srv := newTestServer(t)
+	var slept time.Duration
+	e.sleep = func(d time.Duration) { slept += d }
+	client := newNMAgentClient(t, srv)
+	ctx := context.Background()
+
+	e.SetFaults(Faults{FailNext: 2, ServerErrorCode: http.StatusServiceUnavailable, Latency: Duration(time.Second)})
+	for i := 0; i < 2; i++ {
+		_, err := client.GetNCVersionList(ctx)
+		requireNMAgentStatus(t, err, http.StatusServiceUnavailable)
+	}
+	_, err := client.GetNCVersionList(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 3*time.Second, slept)
+
+	e.SetFaults(Faults{ServerErrorRate: 1})
+	_, err = imds.NewClient(imds.Endpoint(srv.URL), imds.RetryAttempts(1)).GetVMUniqueID(ctx)
+	require.ErrorIs(t, err, imds.ErrUnexpectedStatusCode)
+}
+
+func TestAdminAPI(t *testing.T) {
+	e, srv := newTestServer(t)
+
+	faults := Faults{Latency: Duration(50 * time.Millisecond), StaleVersions: true}
+	b, err := json.Marshal(faults)
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPut, srv.URL+adminFaultsPath, bytes.NewReader(b))
+	require.NoError(t, err)
+	resp, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, faults, e.State().Faults)
+
+	resp, err = srv.Client().Get(srv.URL + adminStatePath)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	var state State
+	require.NoError(t, json.Unmarshal(body, &state))
+	require.Equal(t, DefaultState().VM, state.VM)
+	require.Equal(t, faults, state.Faults)
+}
@@ -0,0 +1,108 @@
+package fabricemulator
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	imdsComputePath  = "/metadata/instance/compute"
+	imdsNetworkPath  = "/metadata/instance/network"
+	imdsInstancePath = "/metadata/instance"
+	imdsVersionsPath = "/metadata/versions"
+)
+
+// imdsAPIVersions are the API versions which the emulator reports. It serves every version the same way.
+var imdsAPIVersions = []string{"2021-01-01", "2021-02-01", "2023-07-01", "2025-07-24"}
+
+// serveIMDS serves the IMDS instance metadata. Like IMDS, it requires the Metadata header and an api-version,
+// except for the versions API.
+func (e *Emulator) serveIMDS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "IMDS only accepts GET", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Header.Get("Metadata") != "true" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Bad request. Required metadata header not specified"})
+		return
+	}
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	if path == imdsVersionsPath {
+		writeJSON(w, http.StatusOK, map[string][]string{"apiVersions": imdsAPIVersions})
+		return
+	}
+	if r.URL.Query().Get("api-version") == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "Bad request. api-version was not specified in the request", "newest-versions": imdsAPIVersions})
+		return
+	}
+
+	e.Lock()
+	defer e.Unlock()
+	switch path {
+	case imdsComputePath:
+		writeJSON(w, http.StatusOK, e.imdsCompute())
+	case imdsNetworkPath:
+		writeJSON(w, http.StatusOK, e.imdsNetwork())
+	case imdsInstancePath:
+		writeJSON(w, http.StatusOK, map[string]any{"compute": e.imdsCompute(), "network": e.imdsNetwork()})
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Not found"})
+	}
+}
+
+func (e *Emulator) imdsCompute() map[string]any {
+	return map[string]any{
+		"azEnvironment": "AzurePublicCloud",
+		"location":      e.state.VM.Location,
+		"name":          e.state.VM.Name,
+		"vmId":          e.state.VM.UniqueID,
+		"zone":          strconv.FormatUint(uint64(e.state.VM.HomeAZ), 10),
+	}
+}
+
+type imdsIPAddress struct {
+	PrivateIPAddress string `json:"privateIpAddress"`
+	PublicIPAddress  string `json:"publicIpAddress"`
+}
+
+type imdsSubnet struct {
+	Address string `json:"address"`
+	Prefix  string `json:"prefix"`
+}
+
+type imdsIPv4 struct {
+	IPAddress []imdsIPAddress `json:"ipAddress"`
+	Subnet    []imdsSubnet    `json:"subnet"`
+}
+
+type imdsInterface struct {
+	MacAddress             string   `json:"macAddress"`
+	InterfaceCompartmentID string   `json:"interfaceCompartmentID,omitempty"`
+	IPv4                   imdsIPv4 `json:"ipv4"`
+}
+
+func (e *Emulator) imdsNetwork() map[string][]imdsInterface {
+	interfaces := make([]imdsInterface, 0, len(e.state.VM.Interfaces))
+	for _, iface := range e.state.VM.Interfaces {
+		out := imdsInterface{
+			MacAddress:             strings.ToUpper(stripMACSeparators(iface.MACAddress)),
+			InterfaceCompartmentID: iface.CompartmentID,
+			IPv4:                   imdsIPv4{IPAddress: []imdsIPAddress{}, Subnet: []imdsSubnet{}},
+		}
+		for _, subnet := range iface.Subnets {
+			for _, ip := range append([]string{subnet.PrimaryIP}, subnet.SecondaryIPs...) {
+				out.IPv4.IPAddress = append(out.IPv4.IPAddress, imdsIPAddress{PrivateIPAddress: ip})
+			}
+			if address, prefix, ok := strings.Cut(subnet.Prefix, "/"); ok {
+				out.IPv4.Subnet = append(out.IPv4.Subnet, imdsSubnet{Address: address, Prefix: prefix})
+			}
+		}
+		interfaces = append(interfaces, out)
+	}
+	return map[string][]imdsInterface{"interface": interfaces}
+}
+
+func stripMACSeparators(mac string) string {
+	return strings.NewReplacer(":", "", "-", "", ".", "").Replace(mac)
+}
@@ -0,0 +1,270 @@
+package fabricemulator
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/nmagent"
+)
+
+// NMAgent API paths, as the type parameter of a wireserver plugin request. Wildcards are path parameters.
+const (
+	getInterfaceInfoPath    = "getinterfaceinfov1"
+	getSupportedAPIsPath    = "GetSupportedApis"
+	getHomeAZPath           = "GetHomeAz/api-version/1"
+	ncVersionListPath       = "NetworkManagement/interfaces/api-version/2"
+	joinedNetworkPath       = "NetworkManagement/joinedVirtualNetworks/*/api-version/1"
+	deleteNetworkPath       = "NetworkManagement/joinedVirtualNetworks/*/api-version/1/method/DELETE"
+	networkContainerPath    = "NetworkManagement/interfaces/*/networkContainers/*/authenticationToken/*/api-version/1"
+	deleteContainerPath     = "NetworkManagement/interfaces/*/networkContainers/*/authenticationToken/*/api-version/1/method/DELETE"
+	networkContainerVerPath = "NetworkManagement/interfaces/*/networkContainers/*/version/authenticationToken/*/api-version/1"
+)
+
+// serveWireserverPlugin serves NMAgent requests proxied by wireserver.
+// Wireserver only accepts GETs and POSTs, so PUTs and DELETEs arrive as POSTs, with "method/DELETE" appended to the path of DELETEs.
+func (e *Emulator) serveWireserverPlugin(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("comp") != "nmagent" {
+		http.Error(w, "unknown plugin "+query.Get("comp"), http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "wireserver only accepts GET and POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Method == http.MethodPost && r.ContentLength == 0 {
+		http.Error(w, "POST requires a body", http.StatusLengthRequired)
+		return
+	}
+	path := strings.TrimPrefix(query.Get("type"), "/")
+
+	e.Lock()
+	defer e.Unlock()
+
+	if r.Method == http.MethodGet {
+		switch {
+		case strings.EqualFold(path, getInterfaceInfoPath):
+			e.getInterfaceInfo(w)
+		case strings.EqualFold(path, getSupportedAPIsPath):
+			writeXML(w, nmagent.SupportedAPIsResponseXML{SupportedApis: e.state.VM.SupportedAPIs})
+		case strings.EqualFold(path, getHomeAZPath):
+			writeNMAgentJSON(w, http.StatusOK, map[string]any{"homeAz": e.state.VM.HomeAZ, "apiVersion": e.state.VM.HomeAZAPIVersion})
+		case strings.EqualFold(path, ncVersionListPath):
+			e.getNCVersionList(w)
+		default:
+			if params, ok := matchPath(networkContainerVerPath, path); ok {
+				e.getNCVersion(w, params[0], params[1], params[2])
+			} else if params, ok := matchPath(joinedNetworkPath, path); ok {
+				e.getNetworkConfiguration(w, params[0])
+			} else {
+				writeNMAgentJSON(w, http.StatusNotFound, nil)
+			}
+		}
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	if params, ok := matchPath(deleteNetworkPath, path); ok {
+		e.deleteNetwork(w, params[0])
+	} else if params, ok := matchPath(joinedNetworkPath, path); ok {
+		e.joinNetwork(w, params[0])
+	} else if params, ok := matchPath(deleteContainerPath, path); ok {
+		e.deleteNC(w, params[0], params[1], params[2])
+	} else if params, ok := matchPath(networkContainerPath, path); ok {
+		e.putNC(w, params[0], params[1], params[2], body)
+	} else {
+		writeNMAgentJSON(w, http.StatusNotFound, nil)
+	}
+}
+
+// interfacesXML is the getinterfaceinfov1 response, which has MAC addresses in uppercase without separators.
+type interfacesXML struct {
+	XMLName    xml.Name       `xml:"Interfaces"`
+	Interfaces []interfaceXML `xml:"Interface"`
+}
+
+type interfaceXML struct {
+	MacAddress string      `xml:"MacAddress,attr"`
+	IsPrimary  bool        `xml:"IsPrimary,attr"`
+	Subnets    []subnetXML `xml:"IPSubnet"`
+}
+
+type subnetXML struct {
+	Prefix    string         `xml:"Prefix,attr"`
+	Addresses []ipAddressXML `xml:"IPAddress"`
+}
+
+type ipAddressXML struct {
+	Address   string `xml:"Address,attr"`
+	IsPrimary bool   `xml:"IsPrimary,attr"`
+}
+
+func (e *Emulator) getInterfaceInfo(w http.ResponseWriter) {
+	out := interfacesXML{}
+	for _, iface := range e.state.VM.Interfaces {
+		entry := interfaceXML{MacAddress: strings.ToUpper(stripMACSeparators(iface.MACAddress)), IsPrimary: iface.IsPrimary}
+		for _, subnet := range iface.Subnets {
+			s := subnetXML{Prefix: subnet.Prefix, Addresses: []ipAddressXML{{Address: subnet.PrimaryIP, IsPrimary: true}}}
+			for _, ip := range subnet.SecondaryIPs {
+				s.Addresses = append(s.Addresses, ipAddressXML{Address: ip})
+			}
+			entry.Subnets = append(entry.Subnets, s)
+		}
+		out.Interfaces = append(out.Interfaces, entry)
+	}
+	writeXML(w, out)
+}
+
+func (e *Emulator) isJoined(vnetID string) bool {
+	for _, id := range e.state.JoinedNetworks {
+		if strings.EqualFold(id, vnetID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Emulator) joinNetwork(w http.ResponseWriter, vnetID string) {
+	if !e.isJoined(vnetID) {
+		e.state.JoinedNetworks = append(e.state.JoinedNetworks, vnetID)
+	}
+	writeNMAgentJSON(w, http.StatusOK, nil)
+}
+
+func (e *Emulator) deleteNetwork(w http.ResponseWriter, vnetID string) {
+	for i, id := range e.state.JoinedNetworks {
+		if strings.EqualFold(id, vnetID) {
+			e.state.JoinedNetworks = append(e.state.JoinedNetworks[:i], e.state.JoinedNetworks[i+1:]...)
+			writeNMAgentJSON(w, http.StatusOK, nil)
+			return
+		}
+	}
+	writeNMAgentJSON(w, http.StatusNotFound, nil)
+}
+
+func (e *Emulator) getNetworkConfiguration(w http.ResponseWriter, vnetID string) {
+	if !e.isJoined(vnetID) {
+		writeNMAgentJSON(w, http.StatusNotFound, nil)
+		return
+	}
+	// a joined VNet without configuration has no delegated subnets
+	writeNMAgentJSON(w, http.StatusOK, e.state.VirtualNetworks[vnetID])
+}
+
+// hasPrimaryAddress is true if the address is the primary IP of an interface.
+func (e *Emulator) hasPrimaryAddress(address string) bool {
+	for _, iface := range e.state.VM.Interfaces {
+		for _, subnet := range iface.Subnets {
+			if subnet.PrimaryIP == address {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (e *Emulator) putNC(w http.ResponseWriter, primaryAddress, ncID, authToken string, body []byte) {
+	if !e.hasPrimaryAddress(primaryAddress) {
+		writeNMAgentJSON(w, http.StatusNotFound, nil)
+		return
+	}
+	var req nmagent.PutNetworkContainerRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeNMAgentJSON(w, http.StatusBadRequest, nil)
+		return
+	}
+	if req.VNetID != "" && !e.isJoined(req.VNetID) {
+		// NMAgent only programs NCs in joined VNets
+		writeNMAgentJSON(w, http.StatusBadRequest, nil)
+		return
+	}
+
+	nc, ok := e.state.NetworkContainers[ncID]
+	if !ok {
+		nc = &NetworkContainer{ID: ncID}
+		e.state.NetworkContainers[ncID] = nc
+	} else if nc.AuthenticationToken != authToken {
+		writeNMAgentJSON(w, http.StatusUnauthorized, nil)
+		return
+	}
+	nc.PrimaryAddress = primaryAddress
+	nc.AuthenticationToken = authToken
+	nc.VNetID = req.VNetID
+	nc.IPv4Addrs = req.IPv4Addrs
+	nc.GoalVersion = req.Version
+	if !e.state.Faults.StaleVersions {
+		nc.Version = req.Version
+	}
+	writeNMAgentJSON(w, http.StatusOK, nil)
+}
+
+func (e *Emulator) deleteNC(w http.ResponseWriter, primaryAddress, ncID, authToken string) {
+	nc, ok := e.state.NetworkContainers[ncID]
+	if !ok || nc.PrimaryAddress != primaryAddress {
+		writeNMAgentJSON(w, http.StatusNotFound, nil)
+		return
+	}
+	if nc.AuthenticationToken != authToken {
+		writeNMAgentJSON(w, http.StatusUnauthorized, nil)
+		return
+	}
+	delete(e.state.NetworkContainers, ncID)
+	writeNMAgentJSON(w, http.StatusOK, nil)
+}
+
+func (e *Emulator) getNCVersion(w http.ResponseWriter, primaryAddress, ncID, authToken string) {
+	nc, ok := e.state.NetworkContainers[ncID]
+	if !ok || nc.PrimaryAddress != primaryAddress {
+		writeNMAgentJSON(w, http.StatusNotFound, nil)
+		return
+	}
+	if nc.AuthenticationToken != authToken {
+		writeNMAgentJSON(w, http.StatusUnauthorized, nil)
+		return
+	}
+	writeNMAgentJSON(w, http.StatusOK, nmagent.NCVersion{NetworkContainerID: nc.ID, Version: strconv.FormatUint(nc.Version, 10)})
+}
+
+func (e *Emulator) getNCVersionList(w http.ResponseWriter) {
+	out := nmagent.NCVersionList{Containers: []nmagent.NCVersion{}}
+	for _, nc := range e.state.NetworkContainers {
+		out.Containers = append(out.Containers, nmagent.NCVersion{NetworkContainerID: nc.ID, Version: strconv.FormatUint(nc.Version, 10)})
+	}
+	writeNMAgentJSON(w, http.StatusOK, out)
+}
+
+// writeNMAgentJSON writes a JSON response the way wireserver relays it from NMAgent:
+// wireserver always responds 200 and the status code of NMAgent is embedded in the body as httpStatusCode.
+func writeNMAgentJSON(w http.ResponseWriter, code int, v any) {
+	fields := map[string]any{}
+	if v != nil {
+		b, err := json.Marshal(v)
+		if err == nil {
+			err = json.Unmarshal(b, &fields)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	fields["httpStatusCode"] = strconv.Itoa(code)
+	writeJSON(w, http.StatusOK, fields)
+}
+
+func writeXML(w http.ResponseWriter, v any) {
+	b, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = w.Write(b)
+}
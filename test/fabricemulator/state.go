@@ -0,0 +1,172 @@
+package fabricemulator
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/Azure/azure-container-networking/nmagent"
+	"github.com/pkg/errors"
+)
+
+// State is the fabric state of a single VM as seen from inside the VM through wireserver and IMDS.
+type State struct {
+	VM VM `json:"vm"`
+	// VirtualNetworks are the customer VNets which the VM can join, keyed by VNet ID
+	VirtualNetworks map[string]nmagent.VirtualNetwork `json:"virtualNetworks,omitempty"`
+	// JoinedNetworks are the IDs of the VNets which the VM has joined
+	JoinedNetworks []string `json:"joinedNetworks,omitempty"`
+	// NetworkContainers are the NCs which have been put on the VM's interfaces, keyed by NC ID
+	NetworkContainers map[string]*NetworkContainer `json:"networkContainers,omitempty"`
+	Faults            Faults                       `json:"faults"`
+}
+
+// VM describes the VM and its interfaces.
+type VM struct {
+	UniqueID string `json:"uniqueId"`
+	Name     string `json:"name"`
+	Location string `json:"location"`
+	HomeAZ   uint   `json:"homeAz"`
+	// HomeAZAPIVersion is the API version reported by GetHomeAz. Version 2 indicates the IPv6 fix is applied.
+	HomeAZAPIVersion uint        `json:"homeAzApiVersion"`
+	SupportedAPIs    []string    `json:"supportedApis,omitempty"`
+	Interfaces       []Interface `json:"interfaces"`
+}
+
+// Interface is a NIC of the VM.
+type Interface struct {
+	// MACAddress is in the format of IMDS and NMAgent, e.g. 000D3A6E1234
+	MACAddress string `json:"macAddress"`
+	IsPrimary  bool   `json:"isPrimary"`
+	// CompartmentID is reported by IMDS for interfaces which belong to a network container
+	CompartmentID string   `json:"compartmentId,omitempty"`
+	Subnets       []Subnet `json:"subnets"`
+}
+
+// Subnet is a subnet of an interface with the interface's IPs in it.
+type Subnet struct {
+	Prefix       string   `json:"prefix"`
+	PrimaryIP    string   `json:"primaryIp"`
+	SecondaryIPs []string `json:"secondaryIps,omitempty"`
+}
+
+// NetworkContainer is an NC which has been put on an interface.
+type NetworkContainer struct {
+	ID                  string   `json:"id"`
+	PrimaryAddress      string   `json:"primaryAddress"`
+	AuthenticationToken string   `json:"authenticationToken"`
+	VNetID              string   `json:"vnetId"`
+	IPv4Addrs           []string `json:"ipv4Addrs,omitempty"`
+	// Version is the version which NMAgent reports as programmed
+	Version uint64 `json:"version"`
+	// GoalVersion is the latest version which has been put. It's ahead of Version while versions are stale.
+	GoalVersion uint64 `json:"goalVersion"`
+}
+
+// Faults are injected into responses.
+type Faults struct {
+	// Latency delays every response
+	Latency Duration `json:"latency,omitempty"`
+	// FailNext fails the next n requests with ServerErrorCode
+	FailNext int `json:"failNext,omitempty"`
+	// ServerErrorRate is the probability from 0 to 1 that a request fails with ServerErrorCode
+	ServerErrorRate float64 `json:"serverErrorRate,omitempty"`
+	// ServerErrorCode defaults to 500
+	ServerErrorCode int `json:"serverErrorCode,omitempty"`
+	// StaleVersions keeps reporting the versions of NCs from before the fault was injected,
+	// as if NMAgent hasn't programmed new goal states yet. Clearing the fault programs every NC's goal version.
+	StaleVersions bool `json:"staleVersions,omitempty"`
+}
+
+// Duration is a time.Duration which is a string like "100ms" in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(time.Duration(d).String())
+	return b, errors.Wrap(err, "failed to marshal duration")
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return errors.Wrap(err, "failed to unmarshal duration")
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse duration %s", s)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// DefaultState is a VM with one primary interface and a few secondary IPs, like an AKS node with Azure CNI.
+func DefaultState() State {
+	return State{
+		VM: VM{
+			UniqueID:         "a8e5c9b7-2f4e-4b1c-9d6a-3f2e1c0b9a87",
+			Name:             "aks-nodepool1-12345678-vmss_0",
+			Location:         "westus2",
+			HomeAZ:           1,
+			HomeAZAPIVersion: 2, //nolint:gomnd // version 2 has the IPv6 fix
+			SupportedAPIs: []string{
+				"GetSupportedApis",
+				"NetworkManagement/interfaces/api-version/2",
+				"GetHomeAz/api-version/1",
+			},
+			Interfaces: []Interface{
+				{
+					MACAddress: "000D3A6E1234",
+					IsPrimary:  true,
+					Subnets: []Subnet{
+						{
+							Prefix:       "10.240.0.0/16",
+							PrimaryIP:    "10.240.0.4",
+							SecondaryIPs: []string{"10.240.0.5", "10.240.0.6", "10.240.0.7"},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// LoadState reads a State from a JSON file.
+func LoadState(path string) (State, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return State{}, errors.Wrapf(err, "failed to read state file %s", path)
+	}
+	var s State
+	if err := json.Unmarshal(b, &s); err != nil {
+		return State{}, errors.Wrapf(err, "failed to unmarshal state file %s", path)
+	}
+	return s, nil
+}
+
+// copy returns a deep copy so that callers can't modify the emulator's state without its lock.
+func (s *State) copy() State {
+	out := *s
+	out.VM.SupportedAPIs = append([]string(nil), s.VM.SupportedAPIs...)
+	out.VM.Interfaces = make([]Interface, len(s.VM.Interfaces))
+	for i, iface := range s.VM.Interfaces {
+		iface.Subnets = append([]Subnet(nil), iface.Subnets...)
+		for j := range iface.Subnets {
+			iface.Subnets[j].SecondaryIPs = append([]string(nil), iface.Subnets[j].SecondaryIPs...)
+		}
+		out.VM.Interfaces[i] = iface
+	}
+	out.VirtualNetworks = make(map[string]nmagent.VirtualNetwork, len(s.VirtualNetworks))
+	for id, vnet := range s.VirtualNetworks {
+		vnet.DNSServers = append([]string(nil), vnet.DNSServers...)
+		vnet.Subnets = append([]nmagent.Subnet(nil), vnet.Subnets...)
+		out.VirtualNetworks[id] = vnet
+	}
+	out.JoinedNetworks = append([]string(nil), s.JoinedNetworks...)
+	out.NetworkContainers = make(map[string]*NetworkContainer, len(s.NetworkContainers))
+	for id, nc := range s.NetworkContainers {
+		ncCopy := *nc
+		ncCopy.IPv4Addrs = append([]string(nil), nc.IPv4Addrs...)
+		out.NetworkContainers[id] = &ncCopy
+	}
+	return out
+}
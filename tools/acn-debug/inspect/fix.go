@@ -0,0 +1,71 @@
+package inspect
+
+import "fmt"
+
+// Fixer applies repairs to the node. Implementations must be safe to call for objects which have
+// already been cleaned up concurrently.
+type Fixer interface {
+	// DeleteEndpoint removes the endpoint from the CNI state, deletes its host side configuration and
+	// releases its ips in CNS.
+	DeleteEndpoint(ep *Endpoint) error
+	// ReleaseAssignment releases the ip in CNS.
+	ReleaseAssignment(a *Assignment) error
+	// DeleteLink deletes the interface from the host network namespace.
+	DeleteLink(name string) error
+}
+
+// Action is the outcome of attempting to fix a single issue.
+type Action struct {
+	Issue   Issue  `json:"issue"`
+	Applied bool   `json:"applied"`
+	Error   string `json:"error,omitempty"`
+	// Skipped is set for issues which cannot be repaired automatically.
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// Fix attempts to repair every issue in the report. Endpoints without a netns are deleted, CNS ips
+// without an endpoint are released and orphaned veths are deleted. Other issues are reported as
+// skipped since they need the pod to be recreated.
+func Fix(report *Report, fixer Fixer) []Action {
+	actions := []Action{}
+	attempted, deletedEndpoints := map[string]bool{}, map[string]bool{}
+	for _, issue := range report.Issues() {
+		action := Action{Issue: issue}
+		var err error
+		switch issue.Kind {
+		case NetNsMissing:
+			if attempted[issue.Endpoint.ID] {
+				continue
+			}
+			attempted[issue.Endpoint.ID] = true
+			if err = fixer.DeleteEndpoint(issue.Endpoint); err == nil {
+				deletedEndpoints[issue.Endpoint.ID] = true
+			}
+		case CNSIPWithoutEndpoint:
+			err = fixer.ReleaseAssignment(issue.Assignment)
+		case OrphanedVeth:
+			err = fixer.DeleteLink(issue.Interface)
+		default:
+			action.Skipped = true
+			actions = append(actions, action)
+			continue
+		}
+		if err != nil {
+			action.Error = fmt.Sprintf("%s: %s", issue.Kind, err.Error())
+		} else {
+			action.Applied = true
+		}
+		actions = append(actions, action)
+	}
+
+	// issues on endpoints which have since been deleted are resolved with them
+	filtered := actions[:0]
+	for i := range actions {
+		a := actions[i]
+		if a.Skipped && a.Issue.Endpoint != nil && deletedEndpoints[a.Issue.Endpoint.ID] {
+			continue
+		}
+		filtered = append(filtered, a)
+	}
+	return filtered
+}
@@ -0,0 +1,56 @@
+//go:build linux
+// +build linux
+
+package inspect
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/Azure/azure-container-networking/netlink"
+	vishnetlink "github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// NetlinkHost implements Host against the live host network namespace.
+type NetlinkHost struct {
+	nl netlink.NetlinkInterface
+}
+
+func NewNetlinkHost(nl netlink.NetlinkInterface) *NetlinkHost {
+	return &NetlinkHost{nl: nl}
+}
+
+func (h *NetlinkHost) NetNsExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func (h *NetlinkHost) Links() ([]Link, error) {
+	links, err := vishnetlink.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list interfaces: %w", err)
+	}
+	out := make([]Link, 0, len(links))
+	for _, link := range links {
+		out = append(out, Link{Name: link.Attrs().Name, Type: link.Type()})
+	}
+	return out, nil
+}
+
+func (h *NetlinkHost) HasRoute(dst net.IPNet, ifName string) (bool, error) {
+	iface, err := net.InterfaceByName(ifName)
+	if err != nil {
+		return false, fmt.Errorf("failed to get interface %s: %w", ifName, err)
+	}
+	family := unix.AF_INET6
+	if dst.IP.To4() != nil {
+		family = unix.AF_INET
+	}
+	routes, err := h.nl.GetIPRoute(&netlink.Route{Family: family, Dst: &dst, LinkIndex: iface.Index})
+	if err != nil {
+		return false, fmt.Errorf("failed to get routes: %w", err)
+	}
+	return len(routes) > 0, nil
+}
@@ -0,0 +1,318 @@
+// Package inspect correlates CNI endpoint state, CNS IP assignments and the live host network
+// configuration into a per-pod view and flags inconsistencies between them.
+package inspect
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/lease"
+)
+
+// IssueKind identifies a class of inconsistency.
+type IssueKind string
+
+const (
+	// NetNsMissing is an endpoint whose network namespace no longer exists.
+	NetNsMissing IssueKind = "netns-missing"
+	// HostVethMissing is an endpoint whose host side veth no longer exists.
+	HostVethMissing IssueKind = "host-veth-missing"
+	// HostRouteMissing is an endpoint ip without a host route through the endpoint's host veth, or
+	// through the host ipvlan slave for ipvlan endpoints.
+	HostRouteMissing IssueKind = "host-route-missing"
+	// EndpointIPNotInCNS is an endpoint ip which CNS does not have assigned.
+	EndpointIPNotInCNS IssueKind = "endpoint-ip-not-in-cns"
+	// CNSIPWithoutEndpoint is an ip assigned in CNS to an azure-vnet pod interface which no endpoint in
+	// the CNI state uses.
+	CNSIPWithoutEndpoint IssueKind = "cns-ip-without-endpoint"
+	// OrphanedVeth is a host veth created by the CNI which no endpoint of any network references.
+	OrphanedVeth IssueKind = "orphaned-veth"
+)
+
+const (
+	// HostVethPrefix is the prefix of host side veths created by azure-vnet.
+	HostVethPrefix = "azv"
+	// IPVlanHostIfName is the host ipvlan slave shared by the ipvlan endpoints. It is never orphaned.
+	IPVlanHostIfName = "azipvl-host"
+	// ModeIPVlan is the network mode of ipvlan endpoints, whose HostIfName is never created.
+	ModeIPVlan = "ipvlan"
+	// LinkTypeVeth is the link type of host veths.
+	LinkTypeVeth = "veth"
+)
+
+// endpointIDContainerIDLen is the length of the infra container id prefix of azure-vnet endpoint ids.
+const endpointIDContainerIDLen = 8
+
+// Endpoint is the subset of the CNI endpoint state used for inspection.
+type Endpoint struct {
+	NetworkID string `json:"networkID"`
+	// Mode is the mode of the endpoint's network, e.g. bridge, transparent or ipvlan.
+	Mode         string      `json:"mode,omitempty"`
+	ID           string      `json:"id"`
+	ContainerID  string      `json:"containerID"`
+	PodName      string      `json:"podName"`
+	PodNamespace string      `json:"podNamespace"`
+	NetNsPath    string      `json:"netNsPath"`
+	IfName       string      `json:"ifName"`
+	HostIfName   string      `json:"hostIfName,omitempty"`
+	IPAddresses  []net.IPNet `json:"ipAddresses"`
+	// NICType and NetworkContainerID identify SwiftV2 delegated NIC endpoints.
+	NICType            string `json:"nicType,omitempty"`
+	NetworkContainerID string `json:"networkContainerID,omitempty"`
+}
+
+// Assignment is an ip assigned to a pod in CNS.
+type Assignment struct {
+	IP               string `json:"ip"`
+	NCID             string `json:"ncID"`
+	PodName          string `json:"podName"`
+	PodNamespace     string `json:"podNamespace"`
+	InfraContainerID string `json:"infraContainerID"`
+	InterfaceID      string `json:"interfaceID"`
+}
+
+// Issue is a single inconsistency. Endpoint, Assignment and Interface identify the object to fix.
+type Issue struct {
+	Kind       IssueKind   `json:"kind"`
+	Detail     string      `json:"detail"`
+	Endpoint   *Endpoint   `json:"-"`
+	Assignment *Assignment `json:"-"`
+	Interface  string      `json:"interface,omitempty"`
+}
+
+// PodView is everything known about a single pod.
+type PodView struct {
+	PodName      string       `json:"podName"`
+	PodNamespace string       `json:"podNamespace"`
+	Endpoints    []Endpoint   `json:"endpoints"`
+	Assignments  []Assignment `json:"assignments"`
+	Issues       []Issue      `json:"issues,omitempty"`
+}
+
+// Report is the result of an inspection. Issues which do not belong to a pod, such as orphaned veths,
+// are reported on the node.
+type Report struct {
+	Pods       []*PodView `json:"pods"`
+	NodeIssues []Issue    `json:"nodeIssues,omitempty"`
+	// CNSAvailable is false when CNS could not be queried, in which case CNS checks are skipped.
+	CNSAvailable bool `json:"cnsAvailable"`
+}
+
+// Link is an interface in the host network namespace.
+type Link struct {
+	Name string
+	// Type is the netlink link type, e.g. veth or ipvlan.
+	Type string
+}
+
+// Host answers questions about the live network configuration of the node.
+type Host interface {
+	NetNsExists(path string) bool
+	// Links returns all interfaces in the host network namespace.
+	Links() ([]Link, error)
+	// HasRoute returns true if there is a route for dst through the named interface.
+	HasRoute(dst net.IPNet, ifName string) (bool, error)
+}
+
+// Issues returns every issue in the report, pod issues first.
+func (r *Report) Issues() []Issue {
+	var issues []Issue
+	for _, pod := range r.Pods {
+		issues = append(issues, pod.Issues...)
+	}
+	return append(issues, r.NodeIssues...)
+}
+
+// Inspect builds the per-pod view and flags inconsistencies. endpoints must hold the endpoints of every
+// network, since host veths which none of them references are reported as orphaned. assignments is
+// ignored if cnsAvailable is false.
+func Inspect(endpoints []Endpoint, assignments []Assignment, cnsAvailable bool, host Host) (*Report, error) {
+	report := &Report{CNSAvailable: cnsAvailable}
+	pods := map[string]*PodView{}
+	pod := func(name, namespace string) *PodView {
+		key := namespace + "/" + name
+		if _, ok := pods[key]; !ok {
+			pods[key] = &PodView{PodName: name, PodNamespace: namespace}
+		}
+		return pods[key]
+	}
+
+	links, err := host.Links()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list host interfaces: %w", err)
+	}
+	hostLinks := map[string]bool{}
+	for _, link := range links {
+		hostLinks[link.Name] = true
+	}
+
+	assignedIPs := map[string]bool{}
+	if cnsAvailable {
+		for i := range assignments {
+			assignedIPs[assignments[i].IP] = true
+		}
+	}
+
+	endpointIPs := map[string]bool{}
+	referencedLinks := map[string]bool{}
+	swiftV2NCs := map[string]bool{}
+	for i := range endpoints {
+		ep := &endpoints[i]
+		if ep.NICType != "" && ep.NICType != string(cns.InfraNIC) && ep.NetworkContainerID != "" {
+			swiftV2NCs[ep.NetworkContainerID] = true
+		}
+		view := pod(ep.PodName, ep.PodNamespace)
+		view.Endpoints = append(view.Endpoints, *ep)
+		for _, ip := range ep.IPAddresses {
+			endpointIPs[ip.IP.String()] = true
+		}
+		if ep.HostIfName != "" {
+			referencedLinks[ep.HostIfName] = true
+		}
+
+		if ep.NetNsPath != "" && !host.NetNsExists(ep.NetNsPath) {
+			view.Issues = append(view.Issues, Issue{
+				Kind:     NetNsMissing,
+				Detail:   fmt.Sprintf("endpoint %s netns %s does not exist", ep.ID, ep.NetNsPath),
+				Endpoint: ep,
+			})
+		}
+
+		if ep.Mode == ModeIPVlan {
+			// ipvlan endpoints have no host veth, the host reaches them through the shared host slave
+			issues, err := checkHostRoutes(host, ep, IPVlanHostIfName, hostLinks[IPVlanHostIfName])
+			if err != nil {
+				return nil, err
+			}
+			view.Issues = append(view.Issues, issues...)
+		} else if ep.HostIfName != "" {
+			if !hostLinks[ep.HostIfName] {
+				view.Issues = append(view.Issues, Issue{
+					Kind:      HostVethMissing,
+					Detail:    fmt.Sprintf("endpoint %s host veth %s does not exist", ep.ID, ep.HostIfName),
+					Endpoint:  ep,
+					Interface: ep.HostIfName,
+				})
+			} else {
+				issues, err := checkHostRoutes(host, ep, ep.HostIfName, true)
+				if err != nil {
+					return nil, err
+				}
+				view.Issues = append(view.Issues, issues...)
+			}
+		}
+
+		if cnsAvailable {
+			for _, ip := range ep.IPAddresses {
+				if !assignedIPs[ip.IP.String()] {
+					view.Issues = append(view.Issues, Issue{
+						Kind:     EndpointIPNotInCNS,
+						Detail:   fmt.Sprintf("endpoint %s ip %s is not assigned in CNS", ep.ID, ip.IP.String()),
+						Endpoint: ep,
+					})
+				}
+			}
+		}
+	}
+
+	if cnsAvailable {
+		for i := range assignments {
+			a := &assignments[i]
+			view := pod(a.PodName, a.PodNamespace)
+			view.Assignments = append(view.Assignments, *a)
+			if !endpointIPs[a.IP] && ownedByCNI(a, swiftV2NCs) {
+				view.Issues = append(view.Issues, Issue{
+					Kind:       CNSIPWithoutEndpoint,
+					Detail:     fmt.Sprintf("ip %s is assigned in CNS but no endpoint uses it", a.IP),
+					Assignment: a,
+				})
+			}
+		}
+	}
+
+	sort.Slice(links, func(i, j int) bool { return links[i].Name < links[j].Name })
+	for _, link := range links {
+		if isOrphanedVeth(link, referencedLinks) {
+			report.NodeIssues = append(report.NodeIssues, Issue{
+				Kind:      OrphanedVeth,
+				Detail:    fmt.Sprintf("host veth %s is not referenced by any endpoint", link.Name),
+				Interface: link.Name,
+			})
+		}
+	}
+
+	for _, view := range pods {
+		report.Pods = append(report.Pods, view)
+	}
+	sort.Slice(report.Pods, func(i, j int) bool {
+		if report.Pods[i].PodNamespace != report.Pods[j].PodNamespace {
+			return report.Pods[i].PodNamespace < report.Pods[j].PodNamespace
+		}
+		return report.Pods[i].PodName < report.Pods[j].PodName
+	})
+
+	return report, nil
+}
+
+// checkHostRoutes reports the endpoint ips without a host route through the interface. If the interface
+// does not exist, every ip is reported.
+func checkHostRoutes(host Host, ep *Endpoint, ifName string, exists bool) ([]Issue, error) {
+	var issues []Issue
+	for _, ip := range ep.IPAddresses {
+		dst := hostRouteDst(ip.IP)
+		ok := false
+		if exists {
+			var err error
+			if ok, err = host.HasRoute(dst, ifName); err != nil {
+				return nil, fmt.Errorf("failed to check route for %s: %w", dst.String(), err)
+			}
+		}
+		if !ok {
+			issues = append(issues, Issue{
+				Kind:      HostRouteMissing,
+				Detail:    fmt.Sprintf("no route for %s via %s", dst.String(), ifName),
+				Endpoint:  ep,
+				Interface: ifName,
+			})
+		}
+	}
+	return issues, nil
+}
+
+// isOrphanedVeth returns true if the link is a veth with the azure-vnet prefix which no endpoint references.
+// Only veths are considered, so the host ipvlan slave and other CNI owned links are never reported.
+func isOrphanedVeth(link Link, referencedLinks map[string]bool) bool {
+	return link.Type == LinkTypeVeth && link.Name != IPVlanHostIfName &&
+		strings.HasPrefix(link.Name, HostVethPrefix) && !referencedLinks[link.Name]
+}
+
+// ownedByCNI returns true if the ip was assigned to a pod interface of this CNI. azure-vnet identifies
+// pod interfaces by the first 8 characters of the infra container id and the interface name, which
+// tells its ips apart from those assigned through azure-ipam, whose interface id is the container id.
+// Ips held for unconsumed offline leases and ips of SwiftV2 delegated NIC NCs are never owned.
+func ownedByCNI(a *Assignment, swiftV2NCs map[string]bool) bool {
+	if a.InfraContainerID == "" || a.PodNamespace == lease.Namespace || swiftV2NCs[a.NCID] {
+		return false
+	}
+	ifName := strings.TrimPrefix(a.InterfaceID, endpointIDPrefix(a.InfraContainerID))
+	return ifName != "" && ifName != a.InterfaceID
+}
+
+// endpointIDPrefix returns the prefix of the azure-vnet endpoint ids of the infra container, as built
+// by network.ConstructEndpointID.
+func endpointIDPrefix(infraContainerID string) string {
+	if len(infraContainerID) <= endpointIDContainerIDLen {
+		return infraContainerID + "-"
+	}
+	return infraContainerID[:endpointIDContainerIDLen] + "-"
+}
+
+func hostRouteDst(ip net.IP) net.IPNet {
+	if ip.To4() != nil {
+		return net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)} //nolint:gomnd // ipv4 host prefix
+	}
+	return net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)} //nolint:gomnd // ipv6 host prefix
+}
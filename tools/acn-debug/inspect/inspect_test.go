@@ -0,0 +1,251 @@
+package inspect
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns/lease"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeHost struct {
+	netns  map[string]bool
+	links  []Link
+	routes map[string]bool
+}
+
+func (h *fakeHost) NetNsExists(path string) bool { return h.netns[path] }
+
+func (h *fakeHost) Links() ([]Link, error) { return h.links, nil }
+
+func veths(names ...string) []Link {
+	links := []Link{{Name: "eth0", Type: "device"}}
+	for _, name := range names {
+		links = append(links, Link{Name: name, Type: LinkTypeVeth})
+	}
+	return links
+}
+
+func (h *fakeHost) HasRoute(dst net.IPNet, ifName string) (bool, error) {
+	return h.routes[dst.String()+"@"+ifName], nil
+}
+
+type fakeFixer struct {
+	deletedEndpoints []string
+	released         []string
+	deletedLinks     []string
+	err              error
+}
+
+func (f *fakeFixer) DeleteEndpoint(ep *Endpoint) error {
+	f.deletedEndpoints = append(f.deletedEndpoints, ep.ID)
+	return f.err
+}
+
+func (f *fakeFixer) ReleaseAssignment(a *Assignment) error {
+	f.released = append(f.released, a.IP)
+	return f.err
+}
+
+func (f *fakeFixer) DeleteLink(name string) error {
+	f.deletedLinks = append(f.deletedLinks, name)
+	return f.err
+}
+
+func ipNet(ip string) net.IPNet {
+	return net.IPNet{IP: net.ParseIP(ip), Mask: net.CIDRMask(24, 32)}
+}
+
+func testState() ([]Endpoint, []Assignment, *fakeHost) {
+	endpoints := []Endpoint{
+		{
+			ID: "healthy-eth0", ContainerID: "healthy", PodName: "a", PodNamespace: "default",
+			NetNsPath: "/var/run/netns/a", HostIfName: "azv1", IPAddresses: []net.IPNet{ipNet("10.0.0.4")},
+		},
+		{
+			ID: "stale-eth0", ContainerID: "stale", PodName: "b", PodNamespace: "default",
+			NetNsPath: "/var/run/netns/b", HostIfName: "azv2", IPAddresses: []net.IPNet{ipNet("10.0.0.5")},
+		},
+	}
+	assignments := []Assignment{
+		{IP: "10.0.0.4", PodName: "a", PodNamespace: "default", InfraContainerID: "healthy0123", InterfaceID: "healthy0-eth0"},
+		{IP: "10.0.0.9", PodName: "c", PodNamespace: "kube-system", InfraContainerID: "leaked00123", InterfaceID: "leaked00-eth0"},
+	}
+	host := &fakeHost{
+		netns:  map[string]bool{"/var/run/netns/a": true},
+		links:  veths("azv1", "azv2", "azv3"),
+		routes: map[string]bool{"10.0.0.4/32@azv1": true},
+	}
+	return endpoints, assignments, host
+}
+
+func kinds(issues []Issue) []IssueKind {
+	out := []IssueKind{}
+	for _, issue := range issues {
+		out = append(out, issue.Kind)
+	}
+	return out
+}
+
+func TestInspect(t *testing.T) {
+	endpoints, assignments, host := testState()
+	report, err := Inspect(endpoints, assignments, true, host)
+	require.NoError(t, err)
+
+	require.Len(t, report.Pods, 3)
+	require.Equal(t, "a", report.Pods[0].PodName)
+	require.Empty(t, report.Pods[0].Issues)
+	require.Len(t, report.Pods[0].Assignments, 1)
+
+	require.Equal(t, "b", report.Pods[1].PodName)
+	require.Equal(t, []IssueKind{NetNsMissing, HostRouteMissing, EndpointIPNotInCNS}, kinds(report.Pods[1].Issues))
+
+	require.Equal(t, "c", report.Pods[2].PodName)
+	require.Equal(t, []IssueKind{CNSIPWithoutEndpoint}, kinds(report.Pods[2].Issues))
+
+	require.Equal(t, []IssueKind{OrphanedVeth}, kinds(report.NodeIssues))
+	require.Equal(t, "azv3", report.NodeIssues[0].Interface)
+}
+
+func TestInspectIgnoresIPsNotOwnedByCNI(t *testing.T) {
+	endpoints, _, host := testState()
+	endpoints = append(endpoints, Endpoint{
+		ID: "swiftv2-eth1", ContainerID: "swiftv2", PodName: "d", PodNamespace: "default",
+		NICType: "FrontendNIC", NetworkContainerID: "swiftv2-nc",
+	})
+	assignments := []Assignment{
+		// azure-ipam uses the container id as the interface id
+		{IP: "10.0.0.10", PodName: "e", PodNamespace: "default", InfraContainerID: "ipam0123", InterfaceID: "ipam0123"},
+		// unconsumed offline lease
+		{IP: "10.0.0.11", PodName: "lease-0", PodNamespace: lease.Namespace, InfraContainerID: "lease0123", InterfaceID: "lease012-eth0"},
+		// SwiftV2 delegated NIC
+		{IP: "10.0.0.12", NCID: "swiftv2-nc", PodName: "d", PodNamespace: "default", InfraContainerID: "swiftv2123", InterfaceID: "swiftv21-eth1"},
+		// no pod info
+		{IP: "10.0.0.13"},
+		{IP: "10.0.0.14", PodName: "f", PodNamespace: "default", InfraContainerID: "short", InterfaceID: "short-eth0"},
+	}
+	report, err := Inspect(endpoints, assignments, true, host)
+	require.NoError(t, err)
+
+	var leaked []string
+	for _, issue := range report.Issues() {
+		if issue.Kind == CNSIPWithoutEndpoint {
+			leaked = append(leaked, issue.Assignment.IP)
+		}
+	}
+	require.Equal(t, []string{"10.0.0.14"}, leaked)
+}
+
+func TestInspectWithoutCNS(t *testing.T) {
+	endpoints, assignments, host := testState()
+	report, err := Inspect(endpoints, assignments, false, host)
+	require.NoError(t, err)
+
+	require.Len(t, report.Pods, 2)
+	require.Equal(t, []IssueKind{NetNsMissing, HostRouteMissing}, kinds(report.Pods[1].Issues))
+}
+
+func TestInspectHostVethMissing(t *testing.T) {
+	endpoints, _, host := testState()
+	host.links = veths("azv1")
+	report, err := Inspect(endpoints, nil, false, host)
+	require.NoError(t, err)
+
+	require.Equal(t, []IssueKind{NetNsMissing, HostVethMissing}, kinds(report.Pods[1].Issues))
+	require.Empty(t, report.NodeIssues)
+}
+
+func TestInspectOrphanedVeths(t *testing.T) {
+	endpoints, _, host := testState()
+	// the host veth of an endpoint in another network is referenced
+	endpoints = append(endpoints, Endpoint{
+		NetworkID: "multitenancy", ID: "mt-eth0", ContainerID: "mt", PodName: "g", PodNamespace: "default",
+		NetNsPath: "/var/run/netns/a", HostIfName: "azv3", IPAddresses: []net.IPNet{ipNet("10.1.0.4")},
+	})
+	host.routes["10.1.0.4/32@azv3"] = true
+	// neither the host ipvlan slave nor links which aren't veths are orphaned
+	host.links = append(host.links,
+		Link{Name: IPVlanHostIfName, Type: "ipvlan"},
+		Link{Name: "azvipvl-host", Type: "ipvlan"},
+		Link{Name: "azv4", Type: "ipvlan"},
+		Link{Name: "azv5", Type: LinkTypeVeth},
+	)
+	report, err := Inspect(endpoints, nil, false, host)
+	require.NoError(t, err)
+
+	require.Equal(t, []IssueKind{OrphanedVeth}, kinds(report.NodeIssues))
+	require.Equal(t, "azv5", report.NodeIssues[0].Interface)
+}
+
+func TestInspectIPVlanEndpoint(t *testing.T) {
+	endpoints := []Endpoint{
+		{
+			ID: "ipvlan-eth0", ContainerID: "ipvlan", PodName: "a", PodNamespace: "default", Mode: ModeIPVlan,
+			NetNsPath: "/var/run/netns/a", HostIfName: "azvipvlan", IPAddresses: []net.IPNet{ipNet("10.0.0.4")},
+		},
+		{
+			ID: "noroute-eth0", ContainerID: "noroute", PodName: "b", PodNamespace: "default", Mode: ModeIPVlan,
+			NetNsPath: "/var/run/netns/a", HostIfName: "azvnoroute", IPAddresses: []net.IPNet{ipNet("10.0.0.5")},
+		},
+	}
+	host := &fakeHost{
+		netns:  map[string]bool{"/var/run/netns/a": true},
+		links:  append(veths(), Link{Name: IPVlanHostIfName, Type: "ipvlan"}),
+		routes: map[string]bool{"10.0.0.4/32@" + IPVlanHostIfName: true},
+	}
+	report, err := Inspect(endpoints, nil, false, host)
+	require.NoError(t, err)
+
+	// the host veth of ipvlan endpoints is never created, the route goes through the host slave
+	require.Empty(t, report.Pods[0].Issues)
+	require.Equal(t, []IssueKind{HostRouteMissing}, kinds(report.Pods[1].Issues))
+	require.Equal(t, IPVlanHostIfName, report.Pods[1].Issues[0].Interface)
+
+	// without the host slave, no ipvlan endpoint is reachable from the host
+	host.links = veths()
+	report, err = Inspect(endpoints, nil, false, host)
+	require.NoError(t, err)
+	require.Equal(t, []IssueKind{HostRouteMissing}, kinds(report.Pods[0].Issues))
+	require.Empty(t, report.NodeIssues)
+}
+
+func TestFix(t *testing.T) {
+	endpoints, assignments, host := testState()
+	report, err := Inspect(endpoints, assignments, true, host)
+	require.NoError(t, err)
+
+	fixer := &fakeFixer{}
+	actions := Fix(report, fixer)
+	require.Equal(t, []string{"stale-eth0"}, fixer.deletedEndpoints)
+	require.Equal(t, []string{"10.0.0.9"}, fixer.released)
+	require.Equal(t, []string{"azv3"}, fixer.deletedLinks)
+
+	// the other issues of the deleted endpoint are resolved with it
+	require.Len(t, actions, 3)
+	for _, a := range actions {
+		require.True(t, a.Applied)
+	}
+}
+
+func TestFixErrors(t *testing.T) {
+	endpoints, assignments, host := testState()
+	report, err := Inspect(endpoints, assignments, true, host)
+	require.NoError(t, err)
+
+	actions := Fix(report, &fakeFixer{err: errors.New("boom")})
+	// the endpoint was not deleted so its remaining issues are reported as skipped
+	require.Len(t, actions, 5)
+	var failed, skipped int
+	for _, a := range actions {
+		require.False(t, a.Applied)
+		if a.Skipped {
+			skipped++
+		} else {
+			failed++
+			require.Contains(t, a.Error, "boom")
+		}
+	}
+	require.Equal(t, 3, failed)
+	require.Equal(t, 2, skipped)
+}
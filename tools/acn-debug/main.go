@@ -0,0 +1,323 @@
+//go:build linux
+// +build linux
+
+// acn-debug inspects the azure-vnet CNI state, the CNS ip assignments and the host network
+// configuration of a node and reports where they disagree.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	cnsclient "github.com/Azure/azure-container-networking/cns/client"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/dhcp"
+	"github.com/Azure/azure-container-networking/iptables"
+	"github.com/Azure/azure-container-networking/netio"
+	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/network"
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/Azure/azure-container-networking/processlock"
+	"github.com/Azure/azure-container-networking/store"
+	"github.com/Azure/azure-container-networking/tools/acn-debug/inspect"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+const (
+	outputText  = "text"
+	outputJSON  = "json"
+	lockTimeout = 10 * time.Second
+)
+
+var errUnknownOutput = errors.New("unknown output format")
+
+type options struct {
+	stateFile string
+	cnsURL    string
+	output    string
+	fix       bool
+}
+
+func main() {
+	if err := newRootCmd().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func newRootCmd() *cobra.Command {
+	opts := &options{}
+	cmd := &cobra.Command{
+		Use:   "acn-debug",
+		Short: "Inspect azure-vnet endpoints, CNS ip assignments and host networking on this node",
+		Long: "Correlates the azure-vnet CNI state file, the ips CNS has assigned and the live host interfaces and routes " +
+			"into a per-pod view, and flags stale endpoints, leaked ips, orphaned veths and missing routes. " +
+			"With --fix, stale endpoints are deleted, leaked ips are released and orphaned veths are removed.",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return run(cmd.Context(), opts, cmd.OutOrStdout(), cmd.ErrOrStderr())
+		},
+	}
+	cmd.Flags().StringVar(&opts.stateFile, "state-file", platform.CNIStateFilePath, "path of the azure-vnet CNI state file")
+	cmd.Flags().StringVar(&opts.cnsURL, "cns-url", "", "CNS base url, empty for the default local endpoint")
+	cmd.Flags().StringVarP(&opts.output, "output", "o", outputText, "output format, text or json")
+	cmd.Flags().BoolVar(&opts.fix, "fix", false, "repair stale endpoints, leaked CNS ips and orphaned veths")
+	return cmd
+}
+
+func run(ctx context.Context, opts *options, stdout, stderr io.Writer) error {
+	if opts.output != outputText && opts.output != outputJSON {
+		return fmt.Errorf("%w: %s", errUnknownOutput, opts.output)
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	logger := zap.NewNop()
+	lockclient, err := processlock.NewFileLock(platform.CNILockPath + "azure-vnet" + store.LockExtension)
+	if err != nil {
+		return fmt.Errorf("failed to create state lock: %w", err)
+	}
+	kvs, err := store.NewJsonFileStore(opts.stateFile, lockclient, logger)
+	if err != nil {
+		return fmt.Errorf("failed to open state file %s: %w", opts.stateFile, err)
+	}
+	// the CNI holds the lock for the duration of ADD and DEL, so only take it when the state is modified
+	if opts.fix {
+		if err = kvs.Lock(lockTimeout); err != nil {
+			return fmt.Errorf("failed to lock state file: %w", err)
+		}
+		defer kvs.Unlock() //nolint:errcheck // best effort
+	}
+
+	nl := netlink.NewNetlink()
+	nm, err := network.NewNetworkManager(nl, platform.NewExecClient(logger), &netio.NetIO{},
+		network.NewNamespaceClient(), iptables.NewClient(), dhcp.New(logger))
+	if err != nil {
+		return fmt.Errorf("failed to create network manager: %w", err)
+	}
+	if err = nm.Initialize(&common.PluginConfig{Store: kvs}, false); err != nil {
+		return fmt.Errorf("failed to load state file %s: %w", opts.stateFile, err)
+	}
+
+	// endpoints of every network are loaded, a veth is only orphaned if none of them references it
+	networks := map[string]networkState{}
+	var endpoints []inspect.Endpoint
+	for _, networkID := range nm.GetNetworkIDs() {
+		nwInfo, err := nm.GetNetworkInfo(networkID)
+		if err != nil {
+			return fmt.Errorf("failed to get network %s: %w", networkID, err)
+		}
+		epInfos, err := nm.GetAllEndpoints(networkID)
+		if err != nil && !errors.Is(err, store.ErrStoreEmpty) {
+			return fmt.Errorf("failed to get endpoints of network %s: %w", networkID, err)
+		}
+		networks[networkID] = networkState{mode: nwInfo.Mode, epInfos: epInfos}
+		endpoints = appendEndpoints(endpoints, networkID, nwInfo.Mode, epInfos)
+	}
+
+	cnsc, err := cnsclient.New(opts.cnsURL, cnsclient.DefaultTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create CNS client: %w", err)
+	}
+	cnsAvailable := true
+	ipConfigs, err := cnsc.GetIPAddressesMatchingStates(ctx, types.Assigned)
+	if err != nil {
+		fmt.Fprintf(stderr, "warning: CNS is unavailable, skipping CNS checks: %v\n", err)
+		cnsAvailable = false
+	}
+	assignments := make([]inspect.Assignment, 0, len(ipConfigs))
+	for i := range ipConfigs {
+		a := inspect.Assignment{IP: ipConfigs[i].IPAddress, NCID: ipConfigs[i].NCID}
+		if podInfo := ipConfigs[i].PodInfo; podInfo != nil {
+			a.PodName = podInfo.Name()
+			a.PodNamespace = podInfo.Namespace()
+			a.InfraContainerID = podInfo.InfraContainerID()
+			a.InterfaceID = podInfo.InterfaceID()
+		}
+		assignments = append(assignments, a)
+	}
+
+	report, err := inspect.Inspect(endpoints, assignments, cnsAvailable, inspect.NewNetlinkHost(nl))
+	if err != nil {
+		return err
+	}
+
+	var actions []inspect.Action
+	if opts.fix {
+		actions = inspect.Fix(report, &nodeFixer{
+			ctx:          ctx,
+			nm:           nm,
+			networks:     networks,
+			cnsc:         cnsc,
+			cnsAvailable: cnsAvailable,
+			nl:           nl,
+		})
+	}
+
+	if opts.output == outputJSON {
+		return writeJSON(stdout, report, actions, opts.fix)
+	}
+	writeText(stdout, report, actions, opts.fix)
+	return nil
+}
+
+// appendEndpoints appends the endpoints of the network to endpoints.
+func appendEndpoints(endpoints []inspect.Endpoint, networkID, mode string, epInfos map[string]*network.EndpointInfo) []inspect.Endpoint {
+	for _, epInfo := range epInfos {
+		endpoints = append(endpoints, inspect.Endpoint{
+			NetworkID:          networkID,
+			Mode:               mode,
+			ID:                 epInfo.EndpointID,
+			ContainerID:        epInfo.ContainerID,
+			PodName:            epInfo.PODName,
+			PodNamespace:       epInfo.PODNameSpace,
+			NetNsPath:          epInfo.NetNsPath,
+			IfName:             epInfo.IfName,
+			HostIfName:         epInfo.HostIfName,
+			IPAddresses:        epInfo.IPAddresses,
+			NICType:            string(epInfo.NICType),
+			NetworkContainerID: epInfo.NetworkContainerID,
+		})
+	}
+	return endpoints
+}
+
+// networkState is the mode and the endpoints of a CNI network.
+type networkState struct {
+	mode    string
+	epInfos map[string]*network.EndpointInfo
+}
+
+// nodeFixer repairs the node through the network manager, CNS and netlink.
+type nodeFixer struct {
+	ctx          context.Context
+	nm           network.NetworkManager
+	networks     map[string]networkState
+	cnsc         *cnsclient.Client
+	cnsAvailable bool
+	nl           netlink.NetlinkInterface
+}
+
+func (f *nodeFixer) DeleteEndpoint(ep *inspect.Endpoint) error {
+	nw := f.networks[ep.NetworkID]
+	epInfo, ok := nw.epInfos[ep.ID]
+	if !ok {
+		return nil
+	}
+	if err := f.nm.DeleteEndpoint(ep.NetworkID, ep.ID, epInfo, nw.mode); err != nil {
+		return fmt.Errorf("failed to delete endpoint %s: %w", ep.ID, err)
+	}
+	// DeleteEndpoint only updates the in-memory state, persist it as the CNI does after DEL
+	if err := f.nm.DeleteState([]*network.EndpointInfo{epInfo}); err != nil {
+		return fmt.Errorf("failed to save state after deleting endpoint %s: %w", ep.ID, err)
+	}
+	if !f.cnsAvailable || len(ep.IPAddresses) == 0 {
+		return nil
+	}
+	ips := make([]string, 0, len(ep.IPAddresses))
+	for _, ip := range ep.IPAddresses {
+		ips = append(ips, ip.IP.String())
+	}
+	return f.release(ep.ID, ep.ContainerID, ep.PodName, ep.PodNamespace, ips)
+}
+
+func (f *nodeFixer) ReleaseAssignment(a *inspect.Assignment) error {
+	if !f.cnsAvailable {
+		return nil
+	}
+	return f.release(a.InterfaceID, a.InfraContainerID, a.PodName, a.PodNamespace, []string{a.IP})
+}
+
+func (f *nodeFixer) DeleteLink(name string) error {
+	if err := f.nl.DeleteLink(name); err != nil {
+		return fmt.Errorf("failed to delete link %s: %w", name, err)
+	}
+	return nil
+}
+
+func (f *nodeFixer) release(interfaceID, infraContainerID, podName, podNamespace string, ips []string) error {
+	orchestratorContext, err := json.Marshal(cns.KubernetesPodInfo{PodName: podName, PodNamespace: podNamespace})
+	if err != nil {
+		return fmt.Errorf("failed to marshal pod info: %w", err)
+	}
+	err = f.cnsc.ReleaseIPs(f.ctx, cns.IPConfigsRequest{
+		PodInterfaceID:      interfaceID,
+		InfraContainerID:    infraContainerID,
+		OrchestratorContext: orchestratorContext,
+		DesiredIPAddresses:  ips,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to release ips %v: %w", ips, err)
+	}
+	return nil
+}
+
+func writeJSON(w io.Writer, report *inspect.Report, actions []inspect.Action, fix bool) error {
+	out := struct {
+		*inspect.Report
+		Actions []inspect.Action `json:"actions,omitempty"`
+	}{Report: report}
+	if fix {
+		out.Actions = actions
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	return nil
+}
+
+func writeText(w io.Writer, report *inspect.Report, actions []inspect.Action, fix bool) {
+	for _, pod := range report.Pods {
+		fmt.Fprintf(w, "%s/%s\n", pod.PodNamespace, pod.PodName)
+		for i := range pod.Endpoints {
+			ep := &pod.Endpoints[i]
+			ips := make([]string, 0, len(ep.IPAddresses))
+			for _, ip := range ep.IPAddresses {
+				ips = append(ips, ip.String())
+			}
+			fmt.Fprintf(w, "  endpoint %s container=%s netns=%s host-if=%s ips=[%s]\n",
+				ep.ID, ep.ContainerID, ep.NetNsPath, ep.HostIfName, strings.Join(ips, ", "))
+		}
+		for _, a := range pod.Assignments {
+			fmt.Fprintf(w, "  cns ip %s nc=%s interface=%s\n", a.IP, a.NCID, a.InterfaceID)
+		}
+		for _, issue := range pod.Issues {
+			fmt.Fprintf(w, "  ! %s: %s\n", issue.Kind, issue.Detail)
+		}
+	}
+	if len(report.NodeIssues) > 0 {
+		fmt.Fprintln(w, "node")
+		for _, issue := range report.NodeIssues {
+			fmt.Fprintf(w, "  ! %s: %s\n", issue.Kind, issue.Detail)
+		}
+	}
+	if !report.CNSAvailable {
+		fmt.Fprintln(w, "CNS checks skipped: CNS unavailable")
+	}
+	fmt.Fprintf(w, "%d pods, %d issues\n", len(report.Pods), len(report.Issues()))
+
+	if !fix {
+		return
+	}
+	for _, a := range actions {
+		switch {
+		case a.Skipped:
+			fmt.Fprintf(w, "skipped %s: %s\n", a.Issue.Kind, a.Issue.Detail)
+		case a.Applied:
+			fmt.Fprintf(w, "fixed %s: %s\n", a.Issue.Kind, a.Issue.Detail)
+		default:
+			fmt.Fprintf(w, "failed %s\n", a.Error)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/Azure/azure-container-networking/otlp"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// OTLPExporter is an sdktrace.SpanExporter which exports spans to an OpenTelemetry collector.
+type OTLPExporter struct {
+	exporter *otlp.Exporter
+}
+
+// NewOTLPExporter creates an OTLPExporter for the service.
+func NewOTLPExporter(cfg *otlp.Config, serviceName string) (*OTLPExporter, error) {
+	exporter, err := otlp.NewExporter(cfg, serviceName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create OTLP span exporter")
+	}
+	return &OTLPExporter{exporter: exporter}, nil
+}
+
+func (e *OTLPExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	out := make([]*tracepb.Span, 0, len(spans))
+	for _, s := range spans {
+		out = append(out, spanProto(s))
+	}
+	return e.exporter.ExportSpans(ctx, out) //nolint:wrapcheck // the otlp errors are wrapped
+}
+
+func (e *OTLPExporter) Shutdown(context.Context) error {
+	return e.exporter.Close() //nolint:wrapcheck // the otlp errors are wrapped
+}
+
+// Relay exports spans which were recorded by another process, e.g. the spans which CNI sends to the telemetry
+// service. Spans are batched and exported in the background.
+type Relay struct {
+	processor sdktrace.SpanProcessor
+}
+
+func NewRelay(exporter sdktrace.SpanExporter) *Relay {
+	return &Relay{processor: sdktrace.NewBatchSpanProcessor(exporter)}
+}
+
+// Export queues the spans for export. Spans are dropped if the queue is full.
+func (r *Relay) Export(spans []SpanData) {
+	for i := range spans {
+		r.processor.OnEnd(spans[i].Snapshot())
+	}
+}
+
+// Shutdown exports the queued spans and shuts the exporter down.
+func (r *Relay) Shutdown(ctx context.Context) error {
+	return r.processor.Shutdown(ctx) //nolint:wrapcheck // returned as is
+}
+
+func spanProto(s sdktrace.ReadOnlySpan) *tracepb.Span {
+	sc := s.SpanContext()
+	traceID, spanID := sc.TraceID(), sc.SpanID()
+	span := &tracepb.Span{
+		TraceId:           traceID[:],
+		SpanId:            spanID[:],
+		TraceState:        sc.TraceState().String(),
+		Name:              s.Name(),
+		Kind:              tracepb.Span_SpanKind(s.SpanKind()), // the OTLP span kinds are numbered like the API's
+		StartTimeUnixNano: uint64(s.StartTime().UnixNano()),
+		EndTimeUnixNano:   uint64(s.EndTime().UnixNano()),
+		Attributes:        keyValueProtos(s.Attributes()),
+		Status:            &tracepb.Status{Message: s.Status().Description},
+	}
+	if parent := s.Parent(); parent.IsValid() {
+		parentID := parent.SpanID()
+		span.ParentSpanId = parentID[:]
+	}
+	switch s.Status().Code {
+	case codes.Error:
+		span.Status.Code = tracepb.Status_STATUS_CODE_ERROR
+	case codes.Ok:
+		span.Status.Code = tracepb.Status_STATUS_CODE_OK
+	case codes.Unset:
+	}
+	for _, e := range s.Events() {
+		span.Events = append(span.Events, &tracepb.Span_Event{
+			Name:         e.Name,
+			TimeUnixNano: uint64(e.Time.UnixNano()),
+			Attributes:   keyValueProtos(e.Attributes),
+		})
+	}
+	for _, l := range s.Links() {
+		linkTraceID, linkSpanID := l.SpanContext.TraceID(), l.SpanContext.SpanID()
+		span.Links = append(span.Links, &tracepb.Span_Link{
+			TraceId:    linkTraceID[:],
+			SpanId:     linkSpanID[:],
+			Attributes: keyValueProtos(l.Attributes),
+		})
+	}
+	return span
+}
+
+func keyValueProtos(kvs []attribute.KeyValue) []*commonpb.KeyValue {
+	out := make([]*commonpb.KeyValue, 0, len(kvs))
+	for _, kv := range kvs {
+		var v *commonpb.AnyValue
+		switch kv.Value.Type() {
+		case attribute.BOOL:
+			v = &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: kv.Value.AsBool()}}
+		case attribute.INT64:
+			v = &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: kv.Value.AsInt64()}}
+		case attribute.FLOAT64:
+			v = &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: kv.Value.AsFloat64()}}
+		default:
+			v = &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: kv.Value.Emit()}}
+		}
+		out = append(out, &commonpb.KeyValue{Key: string(kv.Key), Value: v})
+	}
+	return out
+}
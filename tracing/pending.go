@@ -0,0 +1,62 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Pending holds the trace context of requests whose effect is applied asynchronously, e.g. the IP requests which
+// the pool monitor scales the pool for. The work which applies the effect continues the trace of the oldest request
+// and links the traces of the others.
+type Pending struct {
+	mu    sync.Mutex
+	max   int
+	spans []trace.SpanContext
+}
+
+// NewPending creates a Pending which holds up to max requests. Requests beyond that are not traced further.
+func NewPending(max int) *Pending {
+	return &Pending{max: max}
+}
+
+// Add records the trace context of the request. It's a no-op on a nil Pending or without trace context.
+func (p *Pending) Add(ctx context.Context) {
+	if p == nil {
+		return
+	}
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.spans) < p.max {
+		p.spans = append(p.spans, sc)
+	}
+}
+
+// Start takes the pending requests and starts a span which continues their traces. If there are no pending
+// requests, nothing is traced: the context is returned as is, with a span which isn't recording.
+func (p *Pending) Start(ctx context.Context, name string) (context.Context, trace.Span) {
+	if p == nil {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+	p.mu.Lock()
+	spans := p.spans
+	p.spans = nil
+	p.mu.Unlock()
+	if len(spans) == 0 {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+
+	links := make([]trace.Link, 0, len(spans)-1)
+	for _, sc := range spans[1:] {
+		links = append(links, trace.Link{SpanContext: sc})
+	}
+	return tracer().Start(trace.ContextWithRemoteSpanContext(ctx, spans[0]), name, //nolint:spancheck // ended by the caller
+		trace.WithLinks(links...),
+		trace.WithAttributes(attribute.Int("pending.requests", len(spans))))
+}
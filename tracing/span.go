@@ -0,0 +1,113 @@
+package tracing
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SpanData is a finished span which can be sent to another process as JSON, e.g. by CNI to the telemetry service,
+// which exports it. IDs are hex encoded and attribute values are formatted as strings.
+type SpanData struct {
+	Name          string
+	TraceID       string
+	SpanID        string
+	ParentSpanID  string `json:",omitempty"`
+	Kind          int    `json:",omitempty"`
+	Start         time.Time
+	End           time.Time
+	Attributes    map[string]string `json:",omitempty"`
+	Events        []EventData       `json:",omitempty"`
+	Links         []LinkData        `json:",omitempty"`
+	StatusCode    int               `json:",omitempty"`
+	StatusMessage string            `json:",omitempty"`
+}
+
+// EventData is an event of a SpanData.
+type EventData struct {
+	Name       string
+	Time       time.Time
+	Attributes map[string]string `json:",omitempty"`
+}
+
+// LinkData is a link of a SpanData to a span in another trace.
+type LinkData struct {
+	TraceID string
+	SpanID  string
+}
+
+// NewSpanData converts a span recorded by the SDK.
+func NewSpanData(s sdktrace.ReadOnlySpan) SpanData {
+	d := SpanData{
+		Name:          s.Name(),
+		TraceID:       s.SpanContext().TraceID().String(),
+		SpanID:        s.SpanContext().SpanID().String(),
+		Kind:          int(s.SpanKind()),
+		Start:         s.StartTime(),
+		End:           s.EndTime(),
+		Attributes:    stringAttributes(s.Attributes()),
+		StatusCode:    int(s.Status().Code),
+		StatusMessage: s.Status().Description,
+	}
+	if s.Parent().IsValid() {
+		d.ParentSpanID = s.Parent().SpanID().String()
+	}
+	for _, e := range s.Events() {
+		d.Events = append(d.Events, EventData{Name: e.Name, Time: e.Time, Attributes: stringAttributes(e.Attributes)})
+	}
+	for _, l := range s.Links() {
+		d.Links = append(d.Links, LinkData{TraceID: l.SpanContext.TraceID().String(), SpanID: l.SpanContext.SpanID().String()})
+	}
+	return d
+}
+
+// Snapshot converts the SpanData back to a span which can be exported by an sdktrace.SpanExporter. Spans with
+// invalid IDs are converted to spans with zero IDs, which exporters drop.
+func (d *SpanData) Snapshot() sdktrace.ReadOnlySpan {
+	traceID, _ := trace.TraceIDFromHex(d.TraceID)
+	spanID, _ := trace.SpanIDFromHex(d.SpanID)
+	stub := tracetest.SpanStub{
+		Name:        d.Name,
+		SpanContext: trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled}),
+		SpanKind:    trace.SpanKind(d.Kind),
+		StartTime:   d.Start,
+		EndTime:     d.End,
+		Attributes:  keyValues(d.Attributes),
+		Status:      sdktrace.Status{Code: codes.Code(d.StatusCode), Description: d.StatusMessage},
+	}
+	if parentID, err := trace.SpanIDFromHex(d.ParentSpanID); err == nil {
+		stub.Parent = trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: parentID, TraceFlags: trace.FlagsSampled, Remote: true})
+	}
+	for _, e := range d.Events {
+		stub.Events = append(stub.Events, sdktrace.Event{Name: e.Name, Time: e.Time, Attributes: keyValues(e.Attributes)})
+	}
+	for _, l := range d.Links {
+		linkTraceID, _ := trace.TraceIDFromHex(l.TraceID)
+		linkSpanID, _ := trace.SpanIDFromHex(l.SpanID)
+		stub.Links = append(stub.Links, sdktrace.Link{SpanContext: trace.NewSpanContext(trace.SpanContextConfig{TraceID: linkTraceID, SpanID: linkSpanID})})
+	}
+	return stub.Snapshot()
+}
+
+func stringAttributes(kvs []attribute.KeyValue) map[string]string {
+	if len(kvs) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		m[string(kv.Key)] = kv.Value.Emit()
+	}
+	return m
+}
+
+func keyValues(m map[string]string) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(m))
+	for k, v := range m {
+		kvs = append(kvs, attribute.String(k, v))
+	}
+	return kvs
+}
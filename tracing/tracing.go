@@ -0,0 +1,85 @@
+// Package tracing traces requests across ACN components with W3C trace context. A CNI command starts a trace,
+// the CNS client propagates it in the traceparent header, CNS continues it in its handlers and in the pool monitor,
+// and the NMAgent and wireserver clients add spans for their calls.
+//
+// Spans are recorded with the OpenTelemetry SDK and exported through a pluggable sdktrace.SpanExporter, e.g. the
+// OTLPExporter. Trace context is propagated whether or not the process exports spans itself, so a trace is not
+// broken by a component which doesn't export.
+package tracing
+
+import (
+	"context"
+
+	"github.com/Azure/azure-container-networking/otlp"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// scopeName is the instrumentation scope of the ACN spans.
+const scopeName = "github.com/Azure/azure-container-networking"
+
+var ErrNoExporter = errors.New("tracing is configured without an exporter")
+
+// propagator propagates W3C trace context. It's used instead of the global propagator so that trace context is
+// propagated even if the process never configures OpenTelemetry.
+var propagator = propagation.TraceContext{}
+
+// Config configures tracing of a component.
+type Config struct {
+	// OTLP configures the exporter of the spans.
+	OTLP *otlp.Config `json:"otlp,omitempty"`
+	// SampleRatio is the ratio of traces started by the component which are sampled. Traces continued by the
+	// component are sampled if their parent is. It defaults to sampling every trace.
+	SampleRatio float64 `json:"sample_ratio,omitempty"`
+}
+
+// Init records spans of the service and exports them with the exporter. It returns a function which flushes the
+// spans and shuts the exporter down.
+func Init(exporter sdktrace.SpanExporter, serviceName string, sampleRatio float64) func(context.Context) error {
+	if sampleRatio <= 0 {
+		sampleRatio = 1
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown
+}
+
+// InitFromConfig records spans of the service and exports them over OTLP.
+func InitFromConfig(cfg *Config, serviceName string) (func(context.Context) error, error) {
+	if cfg.OTLP == nil {
+		return nil, ErrNoExporter
+	}
+	exporter, err := NewOTLPExporter(cfg.OTLP, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	return Init(exporter, serviceName, cfg.SampleRatio), nil
+}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(scopeName)
+}
+
+// Start starts a span as a child of the span in the context.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer().Start(ctx, name, trace.WithAttributes(attrs...)) //nolint:spancheck // ended by the caller
+}
+
+// End ends the span, and marks it as failed if err is not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,151 @@
+package tracing_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/otlp"
+	"github.com/Azure/azure-container-networking/otlp/otlptest"
+	"github.com/Azure/azure-container-networking/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// keepSpans is an in-memory exporter which keeps the spans on shutdown.
+type keepSpans struct {
+	*tracetest.InMemoryExporter
+}
+
+func (keepSpans) Shutdown(context.Context) error { return nil }
+
+// record installs an in-memory exporter for the test and returns a function which flushes it and returns the spans.
+func record(t *testing.T) func() tracetest.SpanStubs {
+	exporter := keepSpans{tracetest.NewInMemoryExporter()}
+	shutdown := tracing.Init(exporter, "test", 1)
+	return func() tracetest.SpanStubs {
+		require.NoError(t, shutdown(context.Background()))
+		return exporter.GetSpans()
+	}
+}
+
+func TestTraceContextIsPropagated(t *testing.T) {
+	spans := record(t)
+	srv := httptest.NewServer(tracing.Handler("/ipam", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, span := tracing.Start(r.Context(), "handler")
+		span.End()
+	})))
+	defer srv.Close()
+
+	ctx, root := tracing.Start(context.Background(), "CNI ADD")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+"/ipam", http.NoBody)
+	require.NoError(t, err)
+	resp, err := (&http.Client{Transport: tracing.NewTransport(nil)}).Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	root.End()
+	assert.Empty(t, req.Header, "the caller's request is not modified")
+
+	byName := map[string]tracetest.SpanStub{}
+	for _, s := range spans() {
+		byName[s.Name] = s
+	}
+	require.Len(t, byName, 4)
+	client, server, handler := byName["POST /ipam"], byName["/ipam"], byName["handler"]
+	for _, s := range []tracetest.SpanStub{client, server, handler} {
+		assert.Equal(t, root.SpanContext().TraceID(), s.SpanContext.TraceID(), s.Name)
+	}
+	assert.Equal(t, root.SpanContext().SpanID(), client.Parent.SpanID())
+	assert.Equal(t, client.SpanContext.SpanID(), server.Parent.SpanID())
+	assert.True(t, server.Parent.IsRemote())
+	assert.Equal(t, server.SpanContext.SpanID(), handler.Parent.SpanID())
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind)
+}
+
+func TestTraceContextIsPropagatedWithoutExporting(t *testing.T) {
+	// the default provider doesn't record spans, but passes the trace context of the caller on
+	var got string
+	h := tracing.Handler("/ipam", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := http.Header{}
+		tracing.Inject(r.Context(), header)
+		got = header.Get("traceparent")
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/ipam", http.NoBody)
+	req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", got)
+}
+
+func TestPendingContinuesTheOldestTrace(t *testing.T) {
+	spans := record(t)
+	p := tracing.NewPending(2)
+	var requests []trace.SpanContext
+	for i := 0; i < 3; i++ {
+		ctx, span := tracing.Start(context.Background(), "request")
+		p.Add(ctx)
+		span.End()
+		requests = append(requests, span.SpanContext())
+	}
+	p.Add(context.Background()) // no trace context
+
+	_, span := p.Start(context.Background(), "reconcile")
+	span.End()
+	_, span = p.Start(context.Background(), "reconcile")
+	assert.False(t, span.IsRecording(), "nothing is pending")
+	span.End()
+
+	var reconciles tracetest.SpanStubs
+	for _, s := range spans() {
+		if s.Name == "reconcile" {
+			reconciles = append(reconciles, s)
+		}
+	}
+	require.Len(t, reconciles, 1)
+	assert.Equal(t, requests[0].TraceID(), reconciles[0].SpanContext.TraceID())
+	assert.Equal(t, requests[0].SpanID(), reconciles[0].Parent.SpanID())
+	require.Len(t, reconciles[0].Links, 1, "the third request is beyond the max")
+	assert.Equal(t, requests[1], reconciles[0].Links[0].SpanContext)
+}
+
+func TestRelayExportsSpansOverOTLP(t *testing.T) {
+	spans := record(t)
+	ctx, parent := tracing.Start(context.Background(), "CNI ADD")
+	_, child := tracing.Start(ctx, "ipam")
+	tracing.End(child, assert.AnError)
+	parent.End()
+
+	// the spans are sent over the telemetry socket as JSON
+	var sent []tracing.SpanData
+	for _, s := range spans().Snapshots() {
+		sent = append(sent, tracing.NewSpanData(s))
+	}
+	b, err := json.Marshal(sent)
+	require.NoError(t, err)
+	var received []tracing.SpanData
+	require.NoError(t, json.Unmarshal(b, &received))
+
+	r := otlptest.NewReceiver(t)
+	exporter, err := tracing.NewOTLPExporter(&otlp.Config{Endpoint: r.GRPCEndpoint, Insecure: true}, "azure-vnet")
+	require.NoError(t, err)
+	relay := tracing.NewRelay(exporter)
+	relay.Export(received)
+	require.NoError(t, relay.Shutdown(context.Background()))
+
+	exported := r.Spans()
+	require.Len(t, exported, 2)
+	for _, s := range exported {
+		traceID := parent.SpanContext().TraceID()
+		assert.Equal(t, traceID[:], s.GetTraceId())
+		if s.GetName() == "ipam" {
+			parentID := parent.SpanContext().SpanID()
+			assert.Equal(t, parentID[:], s.GetParentSpanId())
+			assert.Equal(t, assert.AnError.Error(), s.GetStatus().GetMessage())
+			require.Len(t, s.GetEvents(), 1)
+			assert.Equal(t, "exception", s.GetEvents()[0].GetName())
+		}
+	}
+}